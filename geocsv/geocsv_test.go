@@ -0,0 +1,165 @@
+package geocsv
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/mst"
+	"pinkey.ltd/xr/proj"
+)
+
+const assets = "\ufeffasset_id,Name,Longitude,Latitude,Height,heading,installed,cost\n" +
+	"101,pole A,116.391,39.907,45.5,90,yes,12.5\n" +
+	"102,\"pole, B\",116.392,39.908,46,,no,13\n" +
+	"103,pole C,,,,,,\n"
+
+func TestReadAllPoints(t *testing.T) {
+	fc, err := ReadAll(strings.NewReader(assets), &Options{IDColumn: "asset_id"})
+	assert.Nil(t, err)
+	assert.Len(t, fc.Features, 3)
+
+	f := fc.Features[0]
+	assert.Equal(t, int64(101), f.ID)
+	assert.Equal(t, geojson.Point, f.Geometry.Type)
+	assert.Equal(t, vec3.Vec[float64]{116.391, 39.907, 45.5}, f.Geometry.Point)
+	assert.True(t, f.Geometry.HasZ)
+	assert.Equal(t, "pole A", f.Properties["Name"])
+	assert.Equal(t, int64(90), f.Properties["heading"])
+	assert.Equal(t, true, f.Properties["installed"])
+	assert.Equal(t, 12.5, f.Properties["cost"])
+	assert.NotContains(t, f.Properties, "Longitude")
+
+	assert.Equal(t, "pole, B", fc.Features[1].Properties["Name"])
+	assert.Equal(t, 13.0, fc.Features[1].Properties["cost"])
+	assert.Nil(t, fc.Features[1].Properties["heading"])
+	assert.Nil(t, fc.Features[2].Geometry)
+}
+
+func TestReaderOptions(t *testing.T) {
+	data := "# exported inventory\n1;10.5;20.25;a\n2;11;21;b\n"
+	rd, err := NewReader(strings.NewReader(data), &Options{
+		Comma:     ';',
+		Comment:   '#',
+		NoHeader:  true,
+		Columns:   []string{"id", "e", "n", "code"},
+		LonColumn: "e",
+		LatColumn: "n",
+		Types:     map[string]FieldType{"id": FieldString},
+		InferRows: 1,
+	})
+	assert.Nil(t, err)
+	assert.True(t, rd.HasGeometry())
+
+	f, err := rd.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []Column{{Name: "id", Index: 0, Type: FieldString}, {Name: "code", Index: 3, Type: FieldString}}, rd.Columns())
+	assert.Equal(t, 0, f.ID)
+	assert.Equal(t, "1", f.Properties["id"])
+	assert.Equal(t, vec3.Vec[float64]{10.5, 20.25, 0}, f.Geometry.Point)
+	assert.False(t, f.Geometry.HasZ)
+
+	f, err = rd.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, f.ID)
+	_, err = rd.Next()
+	assert.Equal(t, io.EOF, err)
+
+	_, err = NewReader(strings.NewReader(data), &Options{NoHeader: true, Columns: []string{"a"}, LonColumn: "x"})
+	assert.NotNil(t, err)
+}
+
+func TestInferFallback(t *testing.T) {
+	// the sample only sees integers, later text is kept as string
+	data := "name,value\na,1\nb,2\nc,n/a\n"
+	rd, err := NewReader(strings.NewReader(data), &Options{InferRows: 2})
+	assert.Nil(t, err)
+	assert.False(t, rd.HasGeometry())
+	var vals []interface{}
+	for {
+		f, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		vals = append(vals, f.Properties["value"])
+	}
+	assert.Equal(t, []interface{}{int64(1), int64(2), "n/a"}, vals)
+
+	fc, err := ReadAll(strings.NewReader(data), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", fc.Features[0].Properties["value"])
+}
+
+func TestReadWKT(t *testing.T) {
+	data := "id\tgeom\tlabel\n" +
+		"1\tPOINT Z (1 2 3)\tp\n" +
+		"2\tSRID=4326;LINESTRING(0 0, 1 1, 2 0)\tl\n" +
+		"3\tPOLYGON ((0 0, 1 0, 1 1, 0 0), (0.1 0.1, 0.2 0.2, 0.2 0.1, 0.1 0.1))\tpg\n" +
+		"4\tMULTIPOINT ((0 0), (1 1))\tmp\n" +
+		"5\tMULTIPOLYGON (((0 0, 1 0, 1 1, 0 0)), ((2 2, 3 2, 3 3, 2 2)))\tmpg\n" +
+		"6\tGEOMETRYCOLLECTION (POINT (1 1), LINESTRINGM (0 0 5, 1 1 6))\tgc\n" +
+		"7\tPOINT EMPTY\te\n"
+	fc, err := ReadAll(strings.NewReader(data), &Options{Comma: '\t'})
+	assert.Nil(t, err)
+	assert.Len(t, fc.Features, 7)
+
+	g := fc.Features[0].Geometry
+	assert.Equal(t, geojson.Point, g.Type)
+	assert.Equal(t, vec3.Vec[float64]{1, 2, 3}, g.Point)
+	assert.True(t, g.HasZ)
+	assert.Len(t, fc.Features[1].Geometry.LineString, 3)
+	assert.Len(t, fc.Features[2].Geometry.Polygon, 2)
+	assert.Equal(t, []vec3.Vec[float64]{{0, 0, 0}, {1, 1, 0}}, fc.Features[3].Geometry.MultiPoint)
+	assert.Len(t, fc.Features[4].Geometry.MultiPolygon, 2)
+	gc := fc.Features[5].Geometry
+	assert.Len(t, gc.Geometries, 2)
+	assert.Equal(t, vec3.Vec[float64]{1, 1, 0}, gc.Geometries[1].LineString[1])
+	assert.Nil(t, fc.Features[6].Geometry)
+	assert.Equal(t, "pg", fc.Features[2].Properties["label"])
+
+	_, err = ReadAll(strings.NewReader("wkt\nPOINT (1)\n"), nil)
+	assert.NotNil(t, err)
+	_, err = ReadAll(strings.NewReader("wkt\nCIRCLE (1 2)\n"), nil)
+	assert.NotNil(t, err)
+}
+
+func TestPlaceInstances(t *testing.T) {
+	fc, err := ReadAll(strings.NewReader(assets), &Options{IDColumn: "asset_id"})
+	assert.Nil(t, err)
+	mesh := &mst.BaseMesh[float64]{}
+	inst, err := PlaceInstances(mesh, fc.Features, &Placement{Heading: "heading"})
+	assert.Nil(t, err)
+	assert.Len(t, inst.Transfors, 2)
+	assert.Equal(t, []uint64{101, 102}, inst.Features)
+
+	x, y, z := proj.Lonlat2Ecef(116.391, 39.907, 45.5)
+	m := inst.Transfors[0]
+	assert.InDelta(t, x, m[3][0], 1e-6)
+	assert.InDelta(t, y, m[3][1], 1e-6)
+	assert.InDelta(t, z, m[3][2], 1e-6)
+
+	// heading 90 turns the model north axis to the east
+	enu := proj.Enu2Ecef(116.391, 39.907, 45.5)
+	assert.InDelta(t, enu[0][0], m[1][0], 1e-9)
+	assert.InDelta(t, enu[0][1], m[1][1], 1e-9)
+	assert.InDelta(t, enu[0][2], m[1][2], 1e-9)
+
+	// projected input
+	utm, err := proj.FromEPSG(32650)
+	assert.Nil(t, err)
+	e, n, _, err := proj.Transform(proj.NewGeographic(proj.WGS84), utm, 116.391, 39.907, 45.5)
+	assert.Nil(t, err)
+	f := geojson.NewFeature(geojson.NewPointGeometry(vec3.Vec[float64]{e, n, 45.5}))
+	inst, err = PlaceInstances(mesh, []*geojson.Feature{f}, &Placement{CRS: utm})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{0}, inst.Features)
+	assert.InDelta(t, x, inst.Transfors[0][3][0], 1e-4)
+	assert.InDelta(t, z, inst.Transfors[0][3][2], 1e-4)
+
+	_, err = PlaceInstances(mesh, fc.Features, &Placement{Scale: "Name"})
+	assert.NotNil(t, err)
+}
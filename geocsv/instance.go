@@ -0,0 +1,109 @@
+package geocsv
+
+import (
+	"fmt"
+	"math"
+
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/quaternion"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/mst"
+	"pinkey.ltd/xr/proj"
+)
+
+// Placement controls how PlaceInstances positions a model at each point.
+type Placement struct {
+	CRS     *proj.CRS // CRS of the point coordinates, WGS84 longitude and latitude when nil
+	Heading string    // property holding a heading in degrees clockwise from north
+	Scale   string    // property holding a uniform scale
+}
+
+// PlaceInstances places mesh at every point feature. Each transform maps
+// the east, north, up frame at the point to WGS84 ECEF, rotated by the
+// heading and scaled. The instance feature id is the integer feature ID or
+// the position in features. Features without point geometry are skipped.
+func PlaceInstances[T float64 | float32](mesh *mst.BaseMesh[T], features []*geojson.Feature, p *Placement) (*mst.InstanceMesh[T], error) {
+	if p == nil {
+		p = &Placement{}
+	}
+	var tr *proj.Transformer
+	if p.CRS != nil {
+		wgs84, err := proj.FromEPSG(4326)
+		if err != nil {
+			return nil, err
+		}
+		if tr, err = proj.NewTransformer(p.CRS, wgs84); err != nil {
+			return nil, err
+		}
+	}
+	inst := &mst.InstanceMesh[T]{Mesh: mesh}
+	for i, f := range features {
+		if f.Geometry == nil || f.Geometry.Type != geojson.Point {
+			continue
+		}
+		pt := f.Geometry.Point
+		if tr != nil {
+			var err error
+			if pt[0], pt[1], pt[2], err = tr.Transform(pt[0], pt[1], pt[2]); err != nil {
+				return nil, fmt.Errorf("geocsv: feature %d: %w", i, err)
+			}
+		}
+		heading, err := number(f.Properties, p.Heading, 0)
+		if err != nil {
+			return nil, fmt.Errorf("geocsv: feature %d: %w", i, err)
+		}
+		scale, err := number(f.Properties, p.Scale, 1)
+		if err != nil {
+			return nil, fmt.Errorf("geocsv: feature %d: %w", i, err)
+		}
+		q := quaternion.FromZAxisAngle(-heading * math.Pi / 180)
+		local := mat4.Compose(&vec3.Vec[float64]{}, &q, &vec3.Vec[float64]{scale, scale, scale})
+		mt := mat4.AssignMul(proj.Enu2Ecef(pt[0], pt[1], pt[2]), local)
+
+		var m mat4.Mat[T]
+		for c := 0; c < 4; c++ {
+			for k := 0; k < 4; k++ {
+				m[c][k] = T(mt[c][k])
+			}
+		}
+		inst.Transfors = append(inst.Transfors, &m)
+		inst.Features = append(inst.Features, featureID(f, i))
+	}
+	return inst, nil
+}
+
+func number(props map[string]interface{}, key string, def float64) (float64, error) {
+	if key == "" || props[key] == nil {
+		return def, nil
+	}
+	switch v := props[key].(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	}
+	return 0, fmt.Errorf("property %q is not a number", key)
+}
+
+func featureID(f *geojson.Feature, i int) uint64 {
+	switch v := f.ID.(type) {
+	case int:
+		if v >= 0 {
+			return uint64(v)
+		}
+	case int64:
+		if v >= 0 {
+			return uint64(v)
+		}
+	case uint64:
+		return v
+	case float64:
+		if v >= 0 && v == math.Trunc(v) {
+			return uint64(v)
+		}
+	}
+	return uint64(i)
+}
@@ -0,0 +1,401 @@
+// Package geocsv imports point and attribute tables from delimited text
+// files with coordinate or WKT geometry columns.
+package geocsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/geom"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// FieldType is the inferred type of an attribute column.
+type FieldType int
+
+const (
+	FieldString FieldType = iota
+	FieldInt
+	FieldFloat
+	FieldBool
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case FieldInt:
+		return "int"
+	case FieldFloat:
+		return "float"
+	case FieldBool:
+		return "bool"
+	}
+	return "string"
+}
+
+// Column describes one attribute column.
+type Column struct {
+	Name  string
+	Index int
+	Type  FieldType
+}
+
+// Options configures a Reader. Column names are matched case insensitively.
+// Geometry columns left empty are detected from common header names.
+type Options struct {
+	Comma     rune     // field delimiter, ',' by default
+	Comment   rune     // lines starting with it are skipped
+	NoHeader  bool     // the first line holds data, Columns names the fields
+	Columns   []string // column names overriding the header
+	LonColumn string   // longitude or easting
+	LatColumn string   // latitude or northing
+	AltColumn string   // optional height
+	WKTColumn string   // geometry as WKT, used instead of coordinate columns
+	IDColumn  string   // feature id, the row number by default
+	Types     map[string]FieldType
+	InferRows int // rows sampled for type inference by Next, 1000 by default
+}
+
+var (
+	lonNames = []string{"lon", "lng", "long", "longitude", "x", "easting"}
+	latNames = []string{"lat", "latitude", "y", "northing"}
+	altNames = []string{"alt", "altitude", "height", "elevation", "ele", "z"}
+	wktNames = []string{"wkt", "geometry", "geom", "the_geom", "shape"}
+)
+
+// Reader reads features from a delimited text file.
+type Reader struct {
+	opt     Options
+	csv     *csv.Reader
+	header  []string
+	columns []Column
+	lon     int
+	lat     int
+	alt     int
+	wkt     int
+	id      int
+	pending [][]string
+	typed   bool
+	row     int
+}
+
+// NewReader reads the header and prepares geometry columns. Type inference
+// happens on the first call to Next or ReadAll.
+func NewReader(r io.Reader, opt *Options) (*Reader, error) {
+	rd := &Reader{lon: -1, lat: -1, alt: -1, wkt: -1, id: -1}
+	if opt != nil {
+		rd.opt = *opt
+	}
+	if rd.opt.Comma == 0 {
+		rd.opt.Comma = ','
+	}
+	if rd.opt.InferRows <= 0 {
+		rd.opt.InferRows = 1000
+	}
+	rd.csv = csv.NewReader(r)
+	rd.csv.Comma = rd.opt.Comma
+	rd.csv.Comment = rd.opt.Comment
+	rd.csv.FieldsPerRecord = -1
+	rd.csv.TrimLeadingSpace = true
+
+	if !rd.opt.NoHeader {
+		rec, err := rd.csv.Read()
+		if err != nil {
+			return nil, fmt.Errorf("geocsv: reading header: %w", err)
+		}
+		rec[0] = strings.TrimPrefix(rec[0], "\ufeff")
+		rd.header = rec
+	}
+	if len(rd.opt.Columns) > 0 {
+		rd.header = rd.opt.Columns
+	}
+	if len(rd.header) == 0 {
+		return nil, errors.New("geocsv: no column names")
+	}
+	if err := rd.resolveColumns(); err != nil {
+		return nil, err
+	}
+	return rd, nil
+}
+
+func (rd *Reader) find(name string, auto []string) (int, error) {
+	if name != "" {
+		for i, h := range rd.header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("geocsv: column %q not found", name)
+	}
+	for _, a := range auto {
+		for i, h := range rd.header {
+			if strings.EqualFold(strings.TrimSpace(h), a) {
+				return i, nil
+			}
+		}
+	}
+	return -1, nil
+}
+
+func (rd *Reader) resolveColumns() error {
+	var err error
+	if rd.opt.WKTColumn != "" {
+		if rd.wkt, err = rd.find(rd.opt.WKTColumn, nil); err != nil {
+			return err
+		}
+	} else {
+		if rd.lon, err = rd.find(rd.opt.LonColumn, lonNames); err != nil {
+			return err
+		}
+		if rd.lat, err = rd.find(rd.opt.LatColumn, latNames); err != nil {
+			return err
+		}
+		if rd.lon >= 0 && rd.lat >= 0 {
+			if rd.alt, err = rd.find(rd.opt.AltColumn, altNames); err != nil {
+				return err
+			}
+		} else {
+			rd.lon, rd.lat = -1, -1
+			rd.wkt, _ = rd.find("", wktNames)
+		}
+	}
+	if rd.opt.IDColumn != "" {
+		if rd.id, err = rd.find(rd.opt.IDColumn, nil); err != nil {
+			return err
+		}
+	}
+	for i, h := range rd.header {
+		if i == rd.lon || i == rd.lat || i == rd.alt || i == rd.wkt {
+			continue
+		}
+		rd.columns = append(rd.columns, Column{Name: strings.TrimSpace(h), Index: i})
+	}
+	return nil
+}
+
+// HasGeometry reports whether coordinate or WKT columns were found.
+func (rd *Reader) HasGeometry() bool {
+	return rd.wkt >= 0 || rd.lon >= 0
+}
+
+// Columns returns the attribute columns. Types are known after the first
+// call to Next or ReadAll.
+func (rd *Reader) Columns() []Column {
+	return rd.columns
+}
+
+func (rd *Reader) readRecord() ([]string, error) {
+	if len(rd.pending) > 0 {
+		rec := rd.pending[0]
+		rd.pending = rd.pending[1:]
+		return rec, nil
+	}
+	return rd.csv.Read()
+}
+
+// infer determines column types from the given rows. Empty cells do not
+// take part; a column without values is a string column.
+func (rd *Reader) infer(rows [][]string) {
+	rd.typed = true
+	for c := range rd.columns {
+		col := &rd.columns[c]
+		if t, ok := rd.opt.Types[col.Name]; ok {
+			col.Type = t
+			continue
+		}
+		isInt, isFloat, isBool, seen := true, true, true, false
+		for _, rec := range rows {
+			if col.Index >= len(rec) {
+				continue
+			}
+			v := strings.TrimSpace(rec[col.Index])
+			if v == "" {
+				continue
+			}
+			seen = true
+			if isInt {
+				_, err := strconv.ParseInt(v, 10, 64)
+				isInt = err == nil
+			}
+			if isFloat {
+				_, err := strconv.ParseFloat(v, 64)
+				isFloat = err == nil
+			}
+			if isBool {
+				_, err := parseBool(v)
+				isBool = err == nil
+			}
+		}
+		switch {
+		case !seen:
+			col.Type = FieldString
+		case isInt:
+			col.Type = FieldInt
+		case isFloat:
+			col.Type = FieldFloat
+		case isBool:
+			col.Type = FieldBool
+		default:
+			col.Type = FieldString
+		}
+	}
+}
+
+func parseBool(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "true", "yes", "t", "y":
+		return true, nil
+	case "false", "no", "f", "n":
+		return false, nil
+	}
+	return false, fmt.Errorf("geocsv: invalid bool %q", v)
+}
+
+// Next returns the next row as feature, or io.EOF at the end of the input.
+// Types are inferred from the first InferRows rows; later values that do not
+// match their column type are kept as strings.
+func (rd *Reader) Next() (*geojson.Feature, error) {
+	if !rd.typed {
+		for len(rd.pending) < rd.opt.InferRows {
+			rec, err := rd.csv.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("geocsv: %w", err)
+			}
+			rd.pending = append(rd.pending, rec)
+		}
+		rd.infer(rd.pending)
+	}
+	rec, err := rd.readRecord()
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("geocsv: %w", err)
+	}
+	rd.row++
+	f, err := rd.feature(rec)
+	if err != nil {
+		return nil, fmt.Errorf("geocsv: row %d: %w", rd.row, err)
+	}
+	return f, nil
+}
+
+// ReadAll reads the remaining rows. Types are inferred from all of them.
+func (rd *Reader) ReadAll() (*geojson.FeatureCollection, error) {
+	if !rd.typed {
+		rest, err := rd.csv.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("geocsv: %w", err)
+		}
+		rd.pending = append(rd.pending, rest...)
+		rd.infer(rd.pending)
+	}
+	fc := geojson.NewFeatureCollection()
+	for {
+		f, err := rd.Next()
+		if err == io.EOF {
+			return fc, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		fc.Append(f)
+	}
+}
+
+func (rd *Reader) cell(rec []string, i int) string {
+	if i < 0 || i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
+
+func (rd *Reader) feature(rec []string) (*geojson.Feature, error) {
+	f := geojson.NewFeature(nil)
+	switch {
+	case rd.wkt >= 0:
+		if s := rd.cell(rec, rd.wkt); s != "" {
+			g, _, err := geom.ParseEWKT(s)
+			if err != nil {
+				return nil, err
+			}
+			f.Geometry = geojson.FromGeom(g)
+		}
+	case rd.lon >= 0:
+		g, err := rd.point(rec)
+		if err != nil {
+			return nil, err
+		}
+		f.Geometry = g
+	}
+	for _, col := range rd.columns {
+		s := rd.cell(rec, col.Index)
+		if s == "" {
+			f.Properties[col.Name] = nil
+			continue
+		}
+		f.Properties[col.Name] = convert(s, col.Type)
+	}
+	if rd.id >= 0 {
+		f.ID = f.Properties[strings.TrimSpace(rd.header[rd.id])]
+	} else {
+		f.ID = rd.row - 1
+	}
+	return f, nil
+}
+
+// point reads the coordinate columns. Rows without coordinates have no geometry.
+func (rd *Reader) point(rec []string) (*geojson.Geometry, error) {
+	var p vec3.Vec[float64]
+	for k, i := range []int{rd.lon, rd.lat, rd.alt} {
+		s := rd.cell(rec, i)
+		if s == "" {
+			if k < 2 {
+				return nil, nil
+			}
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinate %q", s)
+		}
+		p[k] = v
+	}
+	g := geojson.NewPointGeometry(p)
+	g.HasZ = rd.alt >= 0
+	return g, nil
+}
+
+func convert(s string, t FieldType) interface{} {
+	switch t {
+	case FieldInt:
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return v
+		}
+	case FieldFloat:
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v
+		}
+	case FieldBool:
+		if v, err := parseBool(s); err == nil {
+			return v
+		}
+	}
+	return s
+}
+
+// ReadAll reads a whole file into a feature collection.
+func ReadAll(r io.Reader, opt *Options) (*geojson.FeatureCollection, error) {
+	rd, err := NewReader(r, opt)
+	if err != nil {
+		return nil, err
+	}
+	return rd.ReadAll()
+}
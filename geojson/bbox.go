@@ -0,0 +1,119 @@
+package geojson
+
+import (
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// Bound3D returns the bounding box of all positions. The box of an empty
+// geometry is vec3.MinBox, with Min greater than Max.
+func (g *Geometry) Bound3D() vec3.Box[float64] {
+	box := vec3.MinBox
+	g.extend(&box)
+	return box
+}
+
+// Bound returns the two dimensional bounding rectangle of all positions.
+func (g *Geometry) Bound() vec2.Rect[float64] {
+	return toRect(g.Bound3D())
+}
+
+func (g *Geometry) extend(box *vec3.Box[float64]) {
+	if g == nil {
+		return
+	}
+	each := func(ps []vec3.Vec[float64]) {
+		for i := range ps {
+			box.Extend(&ps[i])
+		}
+	}
+	switch g.Type {
+	case Point:
+		box.Extend(&g.Point)
+	case MultiPoint:
+		each(g.MultiPoint)
+	case LineString:
+		each(g.LineString)
+	case MultiLineString:
+		for _, l := range g.MultiLineString {
+			each(l)
+		}
+	case Polygon:
+		for _, r := range g.Polygon {
+			each(r)
+		}
+	case MultiPolygon:
+		for _, p := range g.MultiPolygon {
+			for _, r := range p {
+				each(r)
+			}
+		}
+	case GeometryCollection:
+		for _, c := range g.Geometries {
+			c.extend(box)
+		}
+	}
+}
+
+// ComputeBBox sets the bbox member from the positions of the geometry.
+func (g *Geometry) ComputeBBox() {
+	g.BBox = bboxSlice(g.Bound3D(), g.HasZ)
+}
+
+// Bound3D returns the bounding box of the feature geometry.
+func (f *Feature) Bound3D() vec3.Box[float64] {
+	box := vec3.MinBox
+	f.Geometry.extend(&box)
+	return box
+}
+
+// Bound returns the bounding rectangle of the feature geometry.
+func (f *Feature) Bound() vec2.Rect[float64] {
+	return toRect(f.Bound3D())
+}
+
+// ComputeBBox sets the bbox member of the feature.
+func (f *Feature) ComputeBBox() {
+	f.BBox = bboxSlice(f.Bound3D(), f.Geometry != nil && f.Geometry.HasZ)
+}
+
+// Bound3D returns the bounding box of all features.
+func (fc *FeatureCollection) Bound3D() vec3.Box[float64] {
+	box := vec3.MinBox
+	for _, f := range fc.Features {
+		f.Geometry.extend(&box)
+	}
+	return box
+}
+
+// Bound returns the bounding rectangle of all features.
+func (fc *FeatureCollection) Bound() vec2.Rect[float64] {
+	return toRect(fc.Bound3D())
+}
+
+// ComputeBBox sets the bbox member of the collection and of every feature.
+func (fc *FeatureCollection) ComputeBBox() {
+	hasZ := false
+	for _, f := range fc.Features {
+		f.ComputeBBox()
+		hasZ = hasZ || (f.Geometry != nil && f.Geometry.HasZ)
+	}
+	fc.BBox = bboxSlice(fc.Bound3D(), hasZ)
+}
+
+func toRect(box vec3.Box[float64]) vec2.Rect[float64] {
+	return vec2.Rect[float64]{
+		Min: vec2.Vec[float64]{box.Min[0], box.Min[1]},
+		Max: vec2.Vec[float64]{box.Max[0], box.Max[1]},
+	}
+}
+
+func bboxSlice(box vec3.Box[float64], hasZ bool) []float64 {
+	if box.Min[0] > box.Max[0] {
+		return nil
+	}
+	if hasZ {
+		return box.Slice()
+	}
+	return []float64{box.Min[0], box.Min[1], box.Max[0], box.Max[1]}
+}
@@ -0,0 +1,109 @@
+package geojson
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	TYPE_FEATURE            = "Feature"
+	TYPE_FEATURE_COLLECTION = "FeatureCollection"
+)
+
+// Feature is a spatially bounded entity with free form properties.
+type Feature struct {
+	ID         interface{} // string or number, nil when absent
+	Geometry   *Geometry   // nil for unlocated features
+	Properties map[string]interface{}
+	BBox       []float64
+}
+
+func NewFeature(g *Geometry) *Feature {
+	return &Feature{Geometry: g, Properties: make(map[string]interface{})}
+}
+
+type featureJSON struct {
+	Type       string                 `json:"type"`
+	ID         interface{}            `json:"id,omitempty"`
+	BBox       []float64              `json:"bbox,omitempty"`
+	Geometry   *Geometry              `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// MarshalJSON encodes the feature.
+func (f *Feature) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&featureJSON{Type: TYPE_FEATURE, ID: f.ID, BBox: f.BBox, Geometry: f.Geometry, Properties: f.Properties})
+}
+
+// UnmarshalJSON decodes the feature.
+func (f *Feature) UnmarshalJSON(data []byte) error {
+	var raw featureJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Type != TYPE_FEATURE {
+		return fmt.Errorf("geojson: expected type %q, got %q", TYPE_FEATURE, raw.Type)
+	}
+	*f = Feature{ID: raw.ID, Geometry: raw.Geometry, Properties: raw.Properties, BBox: raw.BBox}
+	return nil
+}
+
+// FeatureCollection is a list of features.
+type FeatureCollection struct {
+	Features []*Feature
+	BBox     []float64
+}
+
+func NewFeatureCollection() *FeatureCollection {
+	return &FeatureCollection{Features: []*Feature{}}
+}
+
+func (fc *FeatureCollection) Append(f *Feature) *FeatureCollection {
+	fc.Features = append(fc.Features, f)
+	return fc
+}
+
+type featureCollectionJSON struct {
+	Type     string     `json:"type"`
+	BBox     []float64  `json:"bbox,omitempty"`
+	Features []*Feature `json:"features"`
+}
+
+// MarshalJSON encodes the collection.
+func (fc *FeatureCollection) MarshalJSON() ([]byte, error) {
+	fs := fc.Features
+	if fs == nil {
+		fs = []*Feature{}
+	}
+	return json.Marshal(&featureCollectionJSON{Type: TYPE_FEATURE_COLLECTION, BBox: fc.BBox, Features: fs})
+}
+
+// UnmarshalJSON decodes the collection.
+func (fc *FeatureCollection) UnmarshalJSON(data []byte) error {
+	var raw featureCollectionJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Type != TYPE_FEATURE_COLLECTION {
+		return fmt.Errorf("geojson: expected type %q, got %q", TYPE_FEATURE_COLLECTION, raw.Type)
+	}
+	for i, f := range raw.Features {
+		if f == nil {
+			return fmt.Errorf("geojson: feature %d is null", i)
+		}
+	}
+	*fc = FeatureCollection{Features: raw.Features, BBox: raw.BBox}
+	return nil
+}
+
+// UnmarshalFeatureCollection decodes a FeatureCollection and validates all geometries.
+func UnmarshalFeatureCollection(data []byte) (*FeatureCollection, error) {
+	fc := &FeatureCollection{}
+	if err := json.Unmarshal(data, fc); err != nil {
+		return nil, err
+	}
+	if err := fc.Validate(); err != nil {
+		return nil, err
+	}
+	return fc, nil
+}
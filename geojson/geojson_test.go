@@ -0,0 +1,283 @@
+package geojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/geom"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+const testCollection = `{
+  "type": "FeatureCollection",
+  "name": "sample",
+  "features": [
+    {"type": "Feature", "id": 1, "geometry": {"type": "Point", "coordinates": [102.0, 0.5]}, "properties": {"prop0": "value0"}},
+    {"type": "Feature", "id": "line", "geometry": {"type": "LineString", "coordinates": [[102.0, 0.0, 10], [103.0, 1.0, 20], [104.0, 0.0, 30], [105.0, 1.0, 40]]}, "properties": {"prop1": 0.0}},
+    {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[100.0, 0.0], [101.0, 0.0], [101.0, 1.0], [100.0, 1.0], [100.0, 0.0]], [[100.2, 0.2], [100.2, 0.8], [100.8, 0.8], [100.8, 0.2], [100.2, 0.2]]]}, "properties": null},
+    {"type": "Feature", "geometry": {"type": "MultiPolygon", "coordinates": [[[[102.0, 2.0], [103.0, 2.0], [103.0, 3.0], [102.0, 3.0], [102.0, 2.0]]]]}, "properties": {}},
+    {"type": "Feature", "geometry": {"type": "GeometryCollection", "geometries": [{"type": "MultiPoint", "coordinates": [[100.0, 0.0], [101.0, 1.0]]}, {"type": "MultiLineString", "coordinates": [[[100.0, 0.0], [101.0, 1.0]], [[102.0, 2.0], [103.0, 3.0]]]}]}, "properties": {}},
+    {"type": "Feature", "geometry": null, "properties": {"name": "unlocated"}}
+  ],
+  "bbox": [100.0, 0.0, 105.0, 3.0]
+}`
+
+func TestUnmarshal(t *testing.T) {
+	fc, err := UnmarshalFeatureCollection([]byte(testCollection))
+	assert.Nil(t, err)
+	assert.Len(t, fc.Features, 6)
+	assert.Equal(t, []float64{100, 0, 105, 3}, fc.BBox)
+
+	pt := fc.Features[0]
+	assert.Equal(t, 1.0, pt.ID)
+	assert.Equal(t, Point, pt.Geometry.Type)
+	assert.Equal(t, vec3.Vec[float64]{102, 0.5, 0}, pt.Geometry.Point)
+	assert.False(t, pt.Geometry.HasZ)
+	assert.Equal(t, "value0", pt.Properties["prop0"])
+
+	line := fc.Features[1].Geometry
+	assert.True(t, line.HasZ)
+	assert.Equal(t, vec3.Vec[float64]{104, 0, 30}, line.LineString[2])
+
+	assert.Len(t, fc.Features[2].Geometry.Polygon, 2)
+	assert.Nil(t, fc.Features[2].Properties)
+	assert.Len(t, fc.Features[4].Geometry.Geometries, 2)
+	assert.Nil(t, fc.Features[5].Geometry)
+
+	_, err = UnmarshalFeatureCollection([]byte(`{"type":"Feature","geometry":null,"properties":null}`))
+	assert.NotNil(t, err)
+	_, err = UnmarshalFeatureCollection([]byte(`{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Point","coordinates":[1]}}]}`))
+	assert.NotNil(t, err)
+	_, err = UnmarshalFeatureCollection([]byte(`{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Circle","coordinates":[1,2]}}]}`))
+	assert.NotNil(t, err)
+}
+
+func TestRoundTrip(t *testing.T) {
+	fc, err := UnmarshalFeatureCollection([]byte(testCollection))
+	assert.Nil(t, err)
+	bt, err := json.Marshal(fc)
+	assert.Nil(t, err)
+
+	var want, got interface{}
+	assert.Nil(t, json.Unmarshal([]byte(testCollection), &want))
+	assert.Nil(t, json.Unmarshal(bt, &got))
+	// foreign members are not kept
+	delete(want.(map[string]interface{}), "name")
+	assert.Equal(t, want, got)
+
+	// 2D geometries are written without altitude
+	bt, err = json.Marshal(NewPointGeometry(vec3.Vec[float64]{1, 2, 0}))
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"type":"Point","coordinates":[1,2]}`, string(bt))
+	g := NewPointGeometry(vec3.Vec[float64]{1, 2, 3})
+	g.HasZ = true
+	bt, err = json.Marshal(g)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"type":"Point","coordinates":[1,2,3]}`, string(bt))
+
+	bt, err = json.Marshal(NewFeatureCollection())
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"type":"FeatureCollection","features":[]}`, string(bt))
+	bt, err = json.Marshal(&Feature{})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"type":"Feature","geometry":null,"properties":null}`, string(bt))
+}
+
+func TestBound(t *testing.T) {
+	fc, err := UnmarshalFeatureCollection([]byte(testCollection))
+	assert.Nil(t, err)
+
+	assert.Equal(t, vec2.Rect[float64]{Min: vec2.Vec[float64]{100, 0}, Max: vec2.Vec[float64]{105, 3}}, fc.Bound())
+	box := fc.Features[1].Bound3D()
+	assert.Equal(t, vec3.Box[float64]{Min: vec3.Vec[float64]{102, 0, 10}, Max: vec3.Vec[float64]{105, 1, 40}}, box)
+
+	fc.BBox = nil
+	fc.ComputeBBox()
+	assert.Equal(t, []float64{100, 0, 0, 105, 3, 40}, fc.BBox)
+	assert.Equal(t, []float64{102, 0.5, 102, 0.5}, fc.Features[0].BBox)
+	assert.Nil(t, fc.Features[5].BBox)
+
+	g := fc.Features[4].Geometry
+	g.ComputeBBox()
+	assert.Equal(t, []float64{100, 0, 103, 3}, g.BBox)
+}
+
+func TestValidate(t *testing.T) {
+	square := func(ccw bool) []vec3.Vec[float64] {
+		r := []vec3.Vec[float64]{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}, {0, 0, 0}}
+		if !ccw {
+			r = []vec3.Vec[float64]{{0, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}, {0, 0, 0}}
+		}
+		return r
+	}
+	tests := []struct {
+		name string
+		g    *Geometry
+		err  error
+	}{
+		{"point", NewPointGeometry(vec3.Vec[float64]{1, 2, 0}), nil},
+		{"short line", NewLineStringGeometry([]vec3.Vec[float64]{{0, 0, 0}}), ErrLineTooShort},
+		{"polygon", NewPolygonGeometry([][]vec3.Vec[float64]{square(true)}), nil},
+		{"clockwise shell", NewPolygonGeometry([][]vec3.Vec[float64]{square(false)}), ErrWindingOrder},
+		{"counterclockwise hole", NewPolygonGeometry([][]vec3.Vec[float64]{square(true), square(true)}), ErrWindingOrder},
+		{"open ring", NewPolygonGeometry([][]vec3.Vec[float64]{square(true)[:4]}), ErrRingNotClosed},
+		{"short ring", NewPolygonGeometry([][]vec3.Vec[float64]{{{0, 0, 0}, {1, 0, 0}, {0, 0, 0}}}), ErrRingTooShort},
+		{"empty polygon", NewPolygonGeometry(nil), ErrEmptyPolygon},
+		{"nested", NewGeometryCollection(NewMultiPolygonGeometry([][]vec3.Vec[float64]{square(false)})), ErrWindingOrder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.g.Validate()
+			if tt.err == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+
+	g := NewPolygonGeometry([][]vec3.Vec[float64]{square(false), square(true)})
+	g.Rewind()
+	assert.Nil(t, g.Validate())
+	assert.Greater(t, RingArea(g.Polygon[0]), 0.0)
+}
+
+func TestDecoder(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(testCollection))
+	dec.Strict = true
+	var fs []*Feature
+	for {
+		f, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		if err != nil {
+			return
+		}
+		fs = append(fs, f)
+	}
+	assert.Len(t, fs, 6)
+	assert.Equal(t, "line", fs[1].ID)
+	assert.Equal(t, []float64{100, 0, 105, 3}, dec.BBox)
+	_, err := dec.Next()
+	assert.Equal(t, io.EOF, err)
+
+	dec = NewDecoder(strings.NewReader(`{"type":"Feature","features":[]}`))
+	_, err = dec.Next()
+	assert.NotNil(t, err)
+
+	dec = NewDecoder(strings.NewReader(`{"features":[{"type":"Feature","geometry":{"type":"LineString","coordinates":[[0,0]]},"properties":{}}],"type":"FeatureCollection"}`))
+	_, err = dec.Next()
+	assert.Nil(t, err)
+	dec = NewDecoder(strings.NewReader(`{"features":[{"type":"Feature","geometry":{"type":"LineString","coordinates":[[0,0]]},"properties":{}}],"type":"FeatureCollection"}`))
+	dec.Strict = true
+	_, err = dec.Next()
+	assert.ErrorIs(t, err, ErrLineTooShort)
+
+	dec = NewDecoder(strings.NewReader(`{"type":"FeatureCollection","features":[`))
+	_, err = dec.Next()
+	assert.NotNil(t, err)
+}
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for i := 0; i < 3; i++ {
+		f := NewFeature(NewPointGeometry(vec3.Vec[float64]{float64(i), float64(i), 0}))
+		f.ID = fmt.Sprint(i)
+		assert.Nil(t, enc.Encode(f))
+	}
+	assert.Nil(t, enc.Close())
+	assert.NotNil(t, enc.Close())
+
+	fc, err := UnmarshalFeatureCollection(buf.Bytes())
+	assert.Nil(t, err)
+	assert.Len(t, fc.Features, 3)
+	assert.Equal(t, "2", fc.Features[2].ID)
+
+	buf.Reset()
+	enc = NewEncoder(&buf)
+	assert.Nil(t, enc.Close())
+	assert.JSONEq(t, `{"type":"FeatureCollection","features":[]}`, buf.String())
+}
+
+func TestGeomConversion(t *testing.T) {
+	for _, s := range []string{
+		"POINT Z (1 2 3)",
+		"LINESTRING (0 0, 1 1)",
+		"POLYGON ((0 0, 1 0, 1 1, 0 0))",
+		"MULTIPOINT ((0 0), (1 1))",
+		"MULTILINESTRING ((0 0, 1 1), (2 2, 3 3))",
+		"MULTIPOLYGON Z (((0 0 1, 1 0 1, 1 1 1, 0 0 1)))",
+		"GEOMETRYCOLLECTION (POINT (1 1), LINESTRING (0 0, 1 1))",
+	} {
+		g, err := geom.ParseWKT(s)
+		assert.Nil(t, err)
+		gj := FromGeom(g)
+		assert.Equal(t, g.Layout().HasZ(), gj.HasZ)
+		assert.Equal(t, s, geom.MarshalWKT(gj.Geom()))
+	}
+
+	g, err := geom.ParseWKT("LINESTRING M (0 0 5, 1 1 6)")
+	assert.Nil(t, err)
+	gj := FromGeom(g)
+	assert.False(t, gj.HasZ)
+	assert.Equal(t, []vec3.Vec[float64]{{0, 0, 0}, {1, 1, 0}}, gj.LineString)
+	assert.Nil(t, FromGeom(geom.NewPointEmpty(geom.XY)))
+}
+
+func TestDistance(t *testing.T) {
+	square := [][]vec3.Vec[float64]{
+		{{0, 0, 0}, {10, 0, 0}, {10, 10, 0}, {0, 10, 0}, {0, 0, 0}},
+		{{4, 4, 0}, {6, 4, 0}, {6, 6, 0}, {4, 6, 0}, {4, 4, 0}},
+	}
+	tests := []struct {
+		g    *Geometry
+		p    vec2.Vec[float64]
+		want float64
+	}{
+		{NewPointGeometry(vec3.Vec[float64]{1, 1, 5}), vec2.Vec[float64]{4, 5}, 5},
+		{NewLineStringGeometry([]vec3.Vec[float64]{{0, 0, 0}, {10, 0, 0}}), vec2.Vec[float64]{5, 2}, 2},
+		{NewLineStringGeometry([]vec3.Vec[float64]{{0, 0, 0}, {10, 0, 0}}), vec2.Vec[float64]{13, 4}, 5},
+		{NewPolygonGeometry(square), vec2.Vec[float64]{2, 2}, 0},
+		{NewPolygonGeometry(square), vec2.Vec[float64]{5, 5}, 1},
+		{NewPolygonGeometry(square), vec2.Vec[float64]{12, 5}, 2},
+		{NewMultiPolygonGeometry(square, [][]vec3.Vec[float64]{{{20, 0, 0}, {30, 0, 0}, {30, 10, 0}, {20, 0, 0}}}), vec2.Vec[float64]{25, 1}, 0},
+		{NewGeometryCollection(NewPointGeometry(vec3.Vec[float64]{0, 0, 0}), NewPointGeometry(vec3.Vec[float64]{3, 0, 0})), vec2.Vec[float64]{3, 1}, 1},
+	}
+	for i, tt := range tests {
+		assert.InDelta(t, tt.want, tt.g.Distance(tt.p), 1e-12, i)
+	}
+}
+
+func TestIntersects(t *testing.T) {
+	square := NewPolygonGeometry([][]vec3.Vec[float64]{
+		{{0, 0, 0}, {10, 0, 0}, {10, 10, 0}, {0, 10, 0}, {0, 0, 0}},
+		{{4, 4, 0}, {6, 4, 0}, {6, 6, 0}, {4, 6, 0}, {4, 4, 0}},
+	})
+	tests := []struct {
+		g    *Geometry
+		want bool
+	}{
+		{NewPointGeometry(vec3.Vec[float64]{1, 1, 0}), true},
+		{NewPointGeometry(vec3.Vec[float64]{5, 5, 0}), false},
+		{NewPointGeometry(vec3.Vec[float64]{10, 5, 0}), true},
+		{NewLineStringGeometry([]vec3.Vec[float64]{{-5, 5, 0}, {15, 5, 0}}), true},
+		{NewLineStringGeometry([]vec3.Vec[float64]{{-5, 15, 0}, {15, 12, 0}}), false},
+		{NewLineStringGeometry([]vec3.Vec[float64]{{4.5, 4.5, 0}, {5.5, 5.5, 0}}), false},
+		{NewPolygonGeometry([][]vec3.Vec[float64]{{{-1, -1, 0}, {20, -1, 0}, {20, 20, 0}, {-1, -1, 0}}}), true},
+		{NewPolygonGeometry([][]vec3.Vec[float64]{{{5, -5, 0}, {6, 15, 0}, {4, 15, 0}, {5, -5, 0}}}), true},
+		{NewGeometryCollection(NewPointGeometry(vec3.Vec[float64]{20, 20, 0}), NewPointGeometry(vec3.Vec[float64]{2, 8, 0})), true},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.want, square.Intersects(tt.g), i)
+		assert.Equal(t, tt.want, tt.g.Intersects(square), i)
+	}
+}
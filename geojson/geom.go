@@ -0,0 +1,119 @@
+package geojson
+
+import (
+	"pinkey.ltd/xr/geom"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// FromGeom converts a simple features geometry. Measures are dropped and
+// an empty point, which GeoJSON cannot express, converts to nil.
+func FromGeom(g geom.Geometry) *Geometry {
+	var out *Geometry
+	switch g := g.(type) {
+	case *geom.Point:
+		if g.IsEmpty() {
+			return nil
+		}
+		out = NewPointGeometry(g.Coord.Vec)
+	case *geom.LineString:
+		out = NewLineStringGeometry(fromCoords(g.Coords))
+	case *geom.Polygon:
+		out = NewPolygonGeometry(fromRings(g.Rings))
+	case *geom.MultiPoint:
+		out = NewMultiPointGeometry(fromCoords(g.Coords)...)
+	case *geom.MultiLineString:
+		out = NewMultiLineStringGeometry(fromRings(g.Lines)...)
+	case *geom.MultiPolygon:
+		out = NewMultiPolygonGeometry()
+		for _, p := range g.Polygons {
+			out.MultiPolygon = append(out.MultiPolygon, fromRings(p))
+		}
+	case *geom.GeometryCollection:
+		out = NewGeometryCollection()
+		for _, c := range g.Geometries {
+			if cg := FromGeom(c); cg != nil {
+				out.Geometries = append(out.Geometries, cg)
+			}
+		}
+	default:
+		return nil
+	}
+	out.HasZ = g.Layout().HasZ()
+	return out
+}
+
+// Geom converts the geometry to the simple features model, XYZ when the
+// geometry has altitudes and XY otherwise.
+func (g *Geometry) Geom() geom.Geometry {
+	l := geom.XY
+	if g.HasZ {
+		l = geom.XYZ
+	}
+	switch g.Type {
+	case Point:
+		return geom.NewPoint(l, geom.Coord{Vec: g.Point})
+	case MultiPoint:
+		return geom.NewMultiPoint(l, toCoords(g.MultiPoint))
+	case LineString:
+		return geom.NewLineString(l, toCoords(g.LineString))
+	case MultiLineString:
+		return geom.NewMultiLineString(l, toRings(g.MultiLineString))
+	case Polygon:
+		return geom.NewPolygon(l, toRings(g.Polygon))
+	case MultiPolygon:
+		var ps [][][]geom.Coord
+		for _, p := range g.MultiPolygon {
+			ps = append(ps, toRings(p))
+		}
+		return geom.NewMultiPolygon(l, ps)
+	}
+	gc := geom.NewGeometryCollection(l)
+	for _, c := range g.Geometries {
+		gc.Geometries = append(gc.Geometries, c.Geom())
+	}
+	return gc
+}
+
+func fromCoords(cs []geom.Coord) []vec3.Vec[float64] {
+	if cs == nil {
+		return nil
+	}
+	ps := make([]vec3.Vec[float64], len(cs))
+	for i, c := range cs {
+		ps[i] = c.Vec
+	}
+	return ps
+}
+
+func fromRings(rs [][]geom.Coord) [][]vec3.Vec[float64] {
+	if rs == nil {
+		return nil
+	}
+	out := make([][]vec3.Vec[float64], len(rs))
+	for i, r := range rs {
+		out[i] = fromCoords(r)
+	}
+	return out
+}
+
+func toCoords(ps []vec3.Vec[float64]) []geom.Coord {
+	if ps == nil {
+		return nil
+	}
+	cs := make([]geom.Coord, len(ps))
+	for i, p := range ps {
+		cs[i] = geom.Coord{Vec: p}
+	}
+	return cs
+}
+
+func toRings(rs [][]vec3.Vec[float64]) [][]geom.Coord {
+	if rs == nil {
+		return nil
+	}
+	out := make([][]geom.Coord, len(rs))
+	for i, r := range rs {
+		out[i] = toCoords(r)
+	}
+	return out
+}
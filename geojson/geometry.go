@@ -0,0 +1,240 @@
+// Package geojson reads and writes RFC 7946 GeoJSON.
+//
+// Positions are stored as vec3.Vec[float64] in longitude, latitude, altitude
+// order. Geometries remember whether their input carried altitudes so that
+// two dimensional data is written back without a zero altitude.
+package geojson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// GeometryType is the value of the "type" member of a geometry.
+type GeometryType string
+
+const (
+	Point              GeometryType = "Point"
+	MultiPoint         GeometryType = "MultiPoint"
+	LineString         GeometryType = "LineString"
+	MultiLineString    GeometryType = "MultiLineString"
+	Polygon            GeometryType = "Polygon"
+	MultiPolygon       GeometryType = "MultiPolygon"
+	GeometryCollection GeometryType = "GeometryCollection"
+)
+
+// Geometry is a GeoJSON geometry. Only the coordinate field matching Type is used.
+type Geometry struct {
+	Type            GeometryType
+	Point           vec3.Vec[float64]
+	MultiPoint      []vec3.Vec[float64]
+	LineString      []vec3.Vec[float64]
+	MultiLineString [][]vec3.Vec[float64]
+	Polygon         [][]vec3.Vec[float64]
+	MultiPolygon    [][][]vec3.Vec[float64]
+	Geometries      []*Geometry
+	BBox            []float64
+	HasZ            bool // positions carry an altitude
+}
+
+func NewPointGeometry(p vec3.Vec[float64]) *Geometry {
+	return &Geometry{Type: Point, Point: p}
+}
+
+func NewMultiPointGeometry(ps ...vec3.Vec[float64]) *Geometry {
+	return &Geometry{Type: MultiPoint, MultiPoint: ps}
+}
+
+func NewLineStringGeometry(line []vec3.Vec[float64]) *Geometry {
+	return &Geometry{Type: LineString, LineString: line}
+}
+
+func NewMultiLineStringGeometry(lines ...[]vec3.Vec[float64]) *Geometry {
+	return &Geometry{Type: MultiLineString, MultiLineString: lines}
+}
+
+func NewPolygonGeometry(rings [][]vec3.Vec[float64]) *Geometry {
+	return &Geometry{Type: Polygon, Polygon: rings}
+}
+
+func NewMultiPolygonGeometry(polys ...[][]vec3.Vec[float64]) *Geometry {
+	return &Geometry{Type: MultiPolygon, MultiPolygon: polys}
+}
+
+func NewGeometryCollection(gs ...*Geometry) *Geometry {
+	return &Geometry{Type: GeometryCollection, Geometries: gs}
+}
+
+type geometryJSON struct {
+	Type        GeometryType    `json:"type"`
+	BBox        []float64       `json:"bbox,omitempty"`
+	Coordinates json.RawMessage `json:"coordinates,omitempty"`
+	Geometries  []*Geometry     `json:"geometries,omitempty"`
+}
+
+// MarshalJSON encodes the geometry.
+func (g *Geometry) MarshalJSON() ([]byte, error) {
+	var coords interface{}
+	switch g.Type {
+	case Point:
+		coords = g.position(g.Point)
+	case MultiPoint:
+		coords = g.positions(g.MultiPoint)
+	case LineString:
+		coords = g.positions(g.LineString)
+	case MultiLineString:
+		coords = g.rings(g.MultiLineString)
+	case Polygon:
+		coords = g.rings(g.Polygon)
+	case MultiPolygon:
+		ps := make([][][][]float64, len(g.MultiPolygon))
+		for i, p := range g.MultiPolygon {
+			ps[i] = g.rings(p)
+		}
+		coords = ps
+	case GeometryCollection:
+		gs := g.Geometries
+		if gs == nil {
+			gs = []*Geometry{}
+		}
+		return json.Marshal(struct {
+			Type       GeometryType `json:"type"`
+			BBox       []float64    `json:"bbox,omitempty"`
+			Geometries []*Geometry  `json:"geometries"`
+		}{g.Type, g.BBox, gs})
+	default:
+		return nil, fmt.Errorf("geojson: unknown geometry type %q", g.Type)
+	}
+	raw, err := json.Marshal(coords)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&geometryJSON{Type: g.Type, BBox: g.BBox, Coordinates: raw})
+}
+
+func (g *Geometry) position(p vec3.Vec[float64]) []float64 {
+	if g.HasZ {
+		return []float64{p[0], p[1], p[2]}
+	}
+	return []float64{p[0], p[1]}
+}
+
+func (g *Geometry) positions(ps []vec3.Vec[float64]) [][]float64 {
+	r := make([][]float64, len(ps))
+	for i, p := range ps {
+		r[i] = g.position(p)
+	}
+	return r
+}
+
+func (g *Geometry) rings(rs [][]vec3.Vec[float64]) [][][]float64 {
+	r := make([][][]float64, len(rs))
+	for i, ps := range rs {
+		r[i] = g.positions(ps)
+	}
+	return r
+}
+
+// UnmarshalJSON decodes the geometry.
+func (g *Geometry) UnmarshalJSON(data []byte) error {
+	var raw geometryJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*g = Geometry{Type: raw.Type, BBox: raw.BBox}
+	if raw.Type == GeometryCollection {
+		g.Geometries = raw.Geometries
+		for _, c := range g.Geometries {
+			if c == nil {
+				return errors.New("geojson: null geometry in GeometryCollection")
+			}
+			g.HasZ = g.HasZ || c.HasZ
+		}
+		return nil
+	}
+	if len(raw.Coordinates) == 0 {
+		return fmt.Errorf("geojson: %s without coordinates", raw.Type)
+	}
+	var err error
+	switch raw.Type {
+	case Point:
+		var c []float64
+		if err = json.Unmarshal(raw.Coordinates, &c); err == nil {
+			g.Point, err = g.toPosition(c)
+		}
+	case MultiPoint:
+		var c [][]float64
+		if err = json.Unmarshal(raw.Coordinates, &c); err == nil {
+			g.MultiPoint, err = g.toPositions(c)
+		}
+	case LineString:
+		var c [][]float64
+		if err = json.Unmarshal(raw.Coordinates, &c); err == nil {
+			g.LineString, err = g.toPositions(c)
+		}
+	case MultiLineString:
+		var c [][][]float64
+		if err = json.Unmarshal(raw.Coordinates, &c); err == nil {
+			g.MultiLineString, err = g.toRings(c)
+		}
+	case Polygon:
+		var c [][][]float64
+		if err = json.Unmarshal(raw.Coordinates, &c); err == nil {
+			g.Polygon, err = g.toRings(c)
+		}
+	case MultiPolygon:
+		var c [][][][]float64
+		if err = json.Unmarshal(raw.Coordinates, &c); err == nil {
+			g.MultiPolygon = make([][][]vec3.Vec[float64], len(c))
+			for i := range c {
+				if g.MultiPolygon[i], err = g.toRings(c[i]); err != nil {
+					break
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("geojson: unknown geometry type %q", raw.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("geojson: %s: %w", raw.Type, err)
+	}
+	return nil
+}
+
+func (g *Geometry) toPosition(c []float64) (vec3.Vec[float64], error) {
+	switch {
+	case len(c) < 2:
+		return vec3.Vec[float64]{}, fmt.Errorf("position needs at least 2 elements, got %d", len(c))
+	case len(c) == 2:
+		return vec3.Vec[float64]{c[0], c[1], 0}, nil
+	}
+	g.HasZ = true
+	return vec3.Vec[float64]{c[0], c[1], c[2]}, nil
+}
+
+func (g *Geometry) toPositions(c [][]float64) ([]vec3.Vec[float64], error) {
+	r := make([]vec3.Vec[float64], len(c))
+	for i := range c {
+		p, err := g.toPosition(c[i])
+		if err != nil {
+			return nil, err
+		}
+		r[i] = p
+	}
+	return r, nil
+}
+
+func (g *Geometry) toRings(c [][][]float64) ([][]vec3.Vec[float64], error) {
+	r := make([][]vec3.Vec[float64], len(c))
+	for i := range c {
+		ps, err := g.toPositions(c[i])
+		if err != nil {
+			return nil, err
+		}
+		r[i] = ps
+	}
+	return r, nil
+}
@@ -0,0 +1,217 @@
+package geojson
+
+import (
+	"math"
+
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// Distance returns the planar distance from p to the geometry in
+// coordinate units, zero when p lies inside a polygon. Altitudes are
+// ignored.
+func (g *Geometry) Distance(p vec2.Vec[float64]) float64 {
+	switch g.Type {
+	case Point:
+		return pointDistance(p, g.Point)
+	case MultiPoint:
+		d := math.Inf(1)
+		for _, q := range g.MultiPoint {
+			d = math.Min(d, pointDistance(p, q))
+		}
+		return d
+	case LineString:
+		return lineDistance(p, g.LineString)
+	case MultiLineString:
+		d := math.Inf(1)
+		for _, l := range g.MultiLineString {
+			d = math.Min(d, lineDistance(p, l))
+		}
+		return d
+	case Polygon:
+		return polygonDistance(p, g.Polygon)
+	case MultiPolygon:
+		d := math.Inf(1)
+		for _, poly := range g.MultiPolygon {
+			d = math.Min(d, polygonDistance(p, poly))
+		}
+		return d
+	}
+	d := math.Inf(1)
+	for _, c := range g.Geometries {
+		d = math.Min(d, c.Distance(p))
+	}
+	return d
+}
+
+func pointDistance(p vec2.Vec[float64], q vec3.Vec[float64]) float64 {
+	return math.Hypot(p[0]-q[0], p[1]-q[1])
+}
+
+func segmentDistance(p vec2.Vec[float64], a, b vec3.Vec[float64]) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	l2 := dx*dx + dy*dy
+	if l2 == 0 {
+		return pointDistance(p, a)
+	}
+	t := math.Max(0, math.Min(1, ((p[0]-a[0])*dx+(p[1]-a[1])*dy)/l2))
+	return math.Hypot(p[0]-a[0]-t*dx, p[1]-a[1]-t*dy)
+}
+
+func lineDistance(p vec2.Vec[float64], line []vec3.Vec[float64]) float64 {
+	if len(line) == 1 {
+		return pointDistance(p, line[0])
+	}
+	d := math.Inf(1)
+	for i := 1; i < len(line); i++ {
+		d = math.Min(d, segmentDistance(p, line[i-1], line[i]))
+	}
+	return d
+}
+
+func polygonDistance(p vec2.Vec[float64], rings [][]vec3.Vec[float64]) float64 {
+	// even-odd over all rings excludes holes
+	inside := false
+	d := math.Inf(1)
+	for _, r := range rings {
+		for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+			a, b := r[j], r[i]
+			if (a[1] > p[1]) != (b[1] > p[1]) && p[0] < (b[0]-a[0])*(p[1]-a[1])/(b[1]-a[1])+a[0] {
+				inside = !inside
+			}
+		}
+		d = math.Min(d, lineDistance(p, r))
+	}
+	if inside {
+		return 0
+	}
+	return d
+}
+
+// Intersects reports whether two geometries share at least one point in
+// the plane. Altitudes are ignored.
+func (g *Geometry) Intersects(o *Geometry) bool {
+	a, b := g.Bound(), o.Bound()
+	if !a.Intersects(&b) {
+		return false
+	}
+	// one contains a vertex of the other or their edges cross
+	hit := false
+	g.vertices(func(p vec3.Vec[float64]) bool {
+		hit = o.Distance(vec2.Vec[float64]{p[0], p[1]}) == 0
+		return !hit
+	})
+	if hit {
+		return true
+	}
+	o.vertices(func(p vec3.Vec[float64]) bool {
+		hit = g.Distance(vec2.Vec[float64]{p[0], p[1]}) == 0
+		return !hit
+	})
+	if hit {
+		return true
+	}
+	g.edges(func(a0, a1 vec3.Vec[float64]) bool {
+		o.edges(func(b0, b1 vec3.Vec[float64]) bool {
+			hit = segmentsCross(a0, a1, b0, b1)
+			return !hit
+		})
+		return !hit
+	})
+	return hit
+}
+
+// vertices calls fn for every position until it returns false.
+func (g *Geometry) vertices(fn func(vec3.Vec[float64]) bool) bool {
+	each := func(ps []vec3.Vec[float64]) bool {
+		for _, p := range ps {
+			if !fn(p) {
+				return false
+			}
+		}
+		return true
+	}
+	switch g.Type {
+	case Point:
+		return fn(g.Point)
+	case MultiPoint:
+		return each(g.MultiPoint)
+	case LineString:
+		return each(g.LineString)
+	case MultiLineString:
+		for _, l := range g.MultiLineString {
+			if !each(l) {
+				return false
+			}
+		}
+	case Polygon:
+		for _, r := range g.Polygon {
+			if !each(r) {
+				return false
+			}
+		}
+	case MultiPolygon:
+		for _, poly := range g.MultiPolygon {
+			for _, r := range poly {
+				if !each(r) {
+					return false
+				}
+			}
+		}
+	}
+	for _, c := range g.Geometries {
+		if !c.vertices(fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// edges calls fn for every line and ring segment until it returns false.
+func (g *Geometry) edges(fn func(a, b vec3.Vec[float64]) bool) bool {
+	each := func(ps []vec3.Vec[float64]) bool {
+		for i := 1; i < len(ps); i++ {
+			if !fn(ps[i-1], ps[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	var lines [][]vec3.Vec[float64]
+	switch g.Type {
+	case LineString:
+		lines = [][]vec3.Vec[float64]{g.LineString}
+	case MultiLineString:
+		lines = g.MultiLineString
+	case Polygon:
+		lines = g.Polygon
+	case MultiPolygon:
+		for _, poly := range g.MultiPolygon {
+			lines = append(lines, poly...)
+		}
+	}
+	for _, l := range lines {
+		if !each(l) {
+			return false
+		}
+	}
+	for _, c := range g.Geometries {
+		if !c.edges(fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func orientation(a, b, c vec3.Vec[float64]) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+// segmentsCross reports whether the interiors of two segments cross.
+// Touching segments share a vertex lying on the other segment and are
+// found by the vertex test of Intersects.
+func segmentsCross(a0, a1, b0, b1 vec3.Vec[float64]) bool {
+	d1, d2 := orientation(b0, b1, a0), orientation(b0, b1, a1)
+	d3, d4 := orientation(a0, a1, b0), orientation(a0, a1, b1)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
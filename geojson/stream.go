@@ -0,0 +1,174 @@
+package geojson
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Decoder reads the features of a FeatureCollection one at a time without
+// holding the whole collection in memory.
+type Decoder struct {
+	// Strict validates every geometry while decoding.
+	Strict bool
+	// BBox holds the bbox of the collection once it has been read.
+	BBox []float64
+
+	dec      *json.Decoder
+	started  bool
+	inArray  bool
+	done     bool
+	typeSeen bool
+	index    int
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{dec: json.NewDecoder(r)}
+}
+
+// Next returns the next feature of the collection or io.EOF after the last one.
+func (d *Decoder) Next() (*Feature, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+	if !d.started {
+		if err := d.expectDelim('{'); err != nil {
+			return nil, err
+		}
+		d.started = true
+	}
+	for {
+		if d.inArray {
+			if d.dec.More() {
+				f := &Feature{}
+				if err := d.dec.Decode(f); err != nil {
+					return nil, fmt.Errorf("geojson: feature %d: %w", d.index, err)
+				}
+				d.index++
+				if d.Strict {
+					if err := f.Validate(); err != nil {
+						return nil, fmt.Errorf("feature %d: %w", d.index-1, err)
+					}
+				}
+				return f, nil
+			}
+			if err := d.expectDelim(']'); err != nil {
+				return nil, err
+			}
+			d.inArray = false
+			continue
+		}
+		if !d.dec.More() {
+			if err := d.expectDelim('}'); err != nil {
+				return nil, err
+			}
+			d.done = true
+			if !d.typeSeen {
+				return nil, errors.New("geojson: FeatureCollection without type")
+			}
+			return nil, io.EOF
+		}
+		tok, err := d.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch key, _ := tok.(string); key {
+		case "type":
+			var t string
+			if err := d.dec.Decode(&t); err != nil {
+				return nil, err
+			}
+			if t != TYPE_FEATURE_COLLECTION {
+				return nil, fmt.Errorf("geojson: expected type %q, got %q", TYPE_FEATURE_COLLECTION, t)
+			}
+			d.typeSeen = true
+		case "bbox":
+			if err := d.dec.Decode(&d.BBox); err != nil {
+				return nil, err
+			}
+		case "features":
+			if err := d.expectDelim('['); err != nil {
+				return nil, err
+			}
+			d.inArray = true
+		default:
+			// foreign members
+			var skip json.RawMessage
+			if err := d.dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (d *Decoder) expectDelim(delim json.Delim) error {
+	tok, err := d.dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("geojson: expected %q, got %v", delim, tok)
+	}
+	return nil
+}
+
+var errEncoderClosed = errors.New("geojson: encoder is closed")
+
+// Encoder writes a FeatureCollection one feature at a time. Close must be
+// called to terminate the collection.
+type Encoder struct {
+	w     *bufio.Writer
+	count int
+	err   error
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// Encode appends a feature to the collection.
+func (e *Encoder) Encode(f *Feature) error {
+	if e.err != nil {
+		return e.err
+	}
+	bt, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if e.count == 0 {
+		_, e.err = e.w.WriteString(`{"type":"FeatureCollection","features":[`)
+	} else {
+		e.err = e.w.WriteByte(',')
+	}
+	if e.err == nil {
+		_, e.err = e.w.Write(bt)
+	}
+	e.count++
+	return e.err
+}
+
+// Close terminates the collection and flushes the output.
+func (e *Encoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.count == 0 {
+		_, e.err = e.w.WriteString(`{"type":"FeatureCollection","features":[`)
+	}
+	if e.err == nil {
+		_, e.err = e.w.WriteString("]}\n")
+	}
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	if e.err == nil {
+		e.err = errEncoderClosed
+		return nil
+	}
+	return e.err
+}
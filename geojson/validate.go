@@ -0,0 +1,149 @@
+package geojson
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+var (
+	ErrInvalidPosition = errors.New("geojson: position is not finite")
+	ErrLineTooShort    = errors.New("geojson: line string needs at least 2 positions")
+	ErrRingTooShort    = errors.New("geojson: linear ring needs at least 4 positions")
+	ErrRingNotClosed   = errors.New("geojson: linear ring is not closed")
+	ErrWindingOrder    = errors.New("geojson: exterior rings must be counterclockwise and holes clockwise")
+	ErrEmptyPolygon    = errors.New("geojson: polygon without exterior ring")
+)
+
+// Validate checks the geometry against RFC 7946: finite positions, line
+// strings with two or more positions, closed rings with four or more
+// positions, counterclockwise exterior rings and clockwise holes.
+func (g *Geometry) Validate() error {
+	switch g.Type {
+	case Point:
+		return validatePositions([]vec3.Vec[float64]{g.Point})
+	case MultiPoint:
+		return validatePositions(g.MultiPoint)
+	case LineString:
+		return validateLine(g.LineString)
+	case MultiLineString:
+		for i, l := range g.MultiLineString {
+			if err := validateLine(l); err != nil {
+				return fmt.Errorf("line %d: %w", i, err)
+			}
+		}
+	case Polygon:
+		return validatePolygon(g.Polygon)
+	case MultiPolygon:
+		for i, p := range g.MultiPolygon {
+			if err := validatePolygon(p); err != nil {
+				return fmt.Errorf("polygon %d: %w", i, err)
+			}
+		}
+	case GeometryCollection:
+		for i, c := range g.Geometries {
+			if err := c.Validate(); err != nil {
+				return fmt.Errorf("geometry %d: %w", i, err)
+			}
+		}
+	default:
+		return fmt.Errorf("geojson: unknown geometry type %q", g.Type)
+	}
+	return nil
+}
+
+// Validate checks the geometry of the feature, if any.
+func (f *Feature) Validate() error {
+	if f.Geometry == nil {
+		return nil
+	}
+	return f.Geometry.Validate()
+}
+
+// Validate checks the geometries of all features.
+func (fc *FeatureCollection) Validate() error {
+	for i, f := range fc.Features {
+		if err := f.Validate(); err != nil {
+			return fmt.Errorf("feature %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validatePositions(ps []vec3.Vec[float64]) error {
+	for _, p := range ps {
+		for _, c := range p {
+			if math.IsNaN(c) || math.IsInf(c, 0) {
+				return ErrInvalidPosition
+			}
+		}
+	}
+	return nil
+}
+
+func validateLine(ps []vec3.Vec[float64]) error {
+	if len(ps) < 2 {
+		return ErrLineTooShort
+	}
+	return validatePositions(ps)
+}
+
+func validatePolygon(rings [][]vec3.Vec[float64]) error {
+	if len(rings) == 0 {
+		return ErrEmptyPolygon
+	}
+	for i, r := range rings {
+		if len(r) < 4 {
+			return fmt.Errorf("ring %d: %w", i, ErrRingTooShort)
+		}
+		if r[0] != r[len(r)-1] {
+			return fmt.Errorf("ring %d: %w", i, ErrRingNotClosed)
+		}
+		if err := validatePositions(r); err != nil {
+			return fmt.Errorf("ring %d: %w", i, err)
+		}
+		if area := RingArea(r); (i == 0 && area < 0) || (i > 0 && area > 0) {
+			return fmt.Errorf("ring %d: %w", i, ErrWindingOrder)
+		}
+	}
+	return nil
+}
+
+// RingArea returns the signed planar area of a closed ring, positive for
+// counterclockwise rings.
+func RingArea(ring []vec3.Vec[float64]) float64 {
+	var a float64
+	for i := 0; i+1 < len(ring); i++ {
+		a += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return a / 2
+}
+
+// Rewind reverses rings as needed so that exterior rings are
+// counterclockwise and holes clockwise.
+func (g *Geometry) Rewind() {
+	switch g.Type {
+	case Polygon:
+		rewindPolygon(g.Polygon)
+	case MultiPolygon:
+		for _, p := range g.MultiPolygon {
+			rewindPolygon(p)
+		}
+	case GeometryCollection:
+		for _, c := range g.Geometries {
+			c.Rewind()
+		}
+	}
+}
+
+func rewindPolygon(rings [][]vec3.Vec[float64]) {
+	for i, r := range rings {
+		if area := RingArea(r); (i == 0 && area < 0) || (i > 0 && area > 0) {
+			for a, b := 0, len(r)-1; a < b; a, b = a+1, b-1 {
+				r[a], r[b] = r[b], r[a]
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package geom is an OGC simple features geometry model with WKT, WKB and
+// EWKB codecs.
+//
+// Coordinates are stored as vec3.Vec[float64] with an optional measure.
+// The layout of a geometry tells which of Z and M are meaningful; Z is zero
+// for two dimensional geometries.
+package geom
+
+import (
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// Layout is the coordinate dimension of a geometry.
+type Layout int
+
+const (
+	XY Layout = iota
+	XYZ
+	XYM
+	XYZM
+)
+
+func (l Layout) HasZ() bool {
+	return l == XYZ || l == XYZM
+}
+
+func (l Layout) HasM() bool {
+	return l == XYM || l == XYZM
+}
+
+// Stride is the number of ordinates of a coordinate.
+func (l Layout) Stride() int {
+	return [...]int{2, 3, 3, 4}[l]
+}
+
+func (l Layout) String() string {
+	return [...]string{"XY", "XYZ", "XYM", "XYZM"}[l]
+}
+
+// GeometryType is the WKB geometry type code.
+type GeometryType uint32
+
+const (
+	POINT              GeometryType = 1
+	LINESTRING         GeometryType = 2
+	POLYGON            GeometryType = 3
+	MULTIPOINT         GeometryType = 4
+	MULTILINESTRING    GeometryType = 5
+	MULTIPOLYGON       GeometryType = 6
+	GEOMETRYCOLLECTION GeometryType = 7
+)
+
+var geometryTypeNames = map[GeometryType]string{
+	POINT:              "POINT",
+	LINESTRING:         "LINESTRING",
+	POLYGON:            "POLYGON",
+	MULTIPOINT:         "MULTIPOINT",
+	MULTILINESTRING:    "MULTILINESTRING",
+	MULTIPOLYGON:       "MULTIPOLYGON",
+	GEOMETRYCOLLECTION: "GEOMETRYCOLLECTION",
+}
+
+func (t GeometryType) String() string {
+	if n, ok := geometryTypeNames[t]; ok {
+		return n
+	}
+	return "UNKNOWN"
+}
+
+// Coord is a position with an optional measure.
+type Coord struct {
+	Vec vec3.Vec[float64]
+	M   float64
+}
+
+// C2 creates a two dimensional coordinate.
+func C2(x, y float64) Coord {
+	return Coord{Vec: vec3.Vec[float64]{x, y, 0}}
+}
+
+// C3 creates a coordinate with altitude.
+func C3(x, y, z float64) Coord {
+	return Coord{Vec: vec3.Vec[float64]{x, y, z}}
+}
+
+// C4 creates a coordinate with altitude and measure.
+func C4(x, y, z, m float64) Coord {
+	return Coord{Vec: vec3.Vec[float64]{x, y, z}, M: m}
+}
+
+func (c Coord) XY() vec2.Vec[float64] {
+	return vec2.Vec[float64]{c.Vec[0], c.Vec[1]}
+}
+
+// Geometry is implemented by all geometry types.
+type Geometry interface {
+	Type() GeometryType
+	Layout() Layout
+	IsEmpty() bool
+}
+
+type Point struct {
+	layout Layout
+	empty  bool
+	Coord  Coord
+}
+
+func NewPoint(l Layout, c Coord) *Point {
+	return &Point{layout: l, Coord: c}
+}
+
+// NewPointEmpty creates the empty point "POINT EMPTY".
+func NewPointEmpty(l Layout) *Point {
+	return &Point{layout: l, empty: true}
+}
+
+func (p *Point) Type() GeometryType { return POINT }
+func (p *Point) Layout() Layout     { return p.layout }
+func (p *Point) IsEmpty() bool      { return p.empty }
+
+type LineString struct {
+	layout Layout
+	Coords []Coord
+}
+
+func NewLineString(l Layout, coords []Coord) *LineString {
+	return &LineString{layout: l, Coords: coords}
+}
+
+func (g *LineString) Type() GeometryType { return LINESTRING }
+func (g *LineString) Layout() Layout     { return g.layout }
+func (g *LineString) IsEmpty() bool      { return len(g.Coords) == 0 }
+
+// Polygon is an exterior ring followed by holes.
+type Polygon struct {
+	layout Layout
+	Rings  [][]Coord
+}
+
+func NewPolygon(l Layout, rings [][]Coord) *Polygon {
+	return &Polygon{layout: l, Rings: rings}
+}
+
+func (g *Polygon) Type() GeometryType { return POLYGON }
+func (g *Polygon) Layout() Layout     { return g.layout }
+func (g *Polygon) IsEmpty() bool      { return len(g.Rings) == 0 }
+
+type MultiPoint struct {
+	layout Layout
+	Coords []Coord
+}
+
+func NewMultiPoint(l Layout, coords []Coord) *MultiPoint {
+	return &MultiPoint{layout: l, Coords: coords}
+}
+
+func (g *MultiPoint) Type() GeometryType { return MULTIPOINT }
+func (g *MultiPoint) Layout() Layout     { return g.layout }
+func (g *MultiPoint) IsEmpty() bool      { return len(g.Coords) == 0 }
+
+type MultiLineString struct {
+	layout Layout
+	Lines  [][]Coord
+}
+
+func NewMultiLineString(l Layout, lines [][]Coord) *MultiLineString {
+	return &MultiLineString{layout: l, Lines: lines}
+}
+
+func (g *MultiLineString) Type() GeometryType { return MULTILINESTRING }
+func (g *MultiLineString) Layout() Layout     { return g.layout }
+func (g *MultiLineString) IsEmpty() bool      { return len(g.Lines) == 0 }
+
+type MultiPolygon struct {
+	layout   Layout
+	Polygons [][][]Coord
+}
+
+func NewMultiPolygon(l Layout, polygons [][][]Coord) *MultiPolygon {
+	return &MultiPolygon{layout: l, Polygons: polygons}
+}
+
+func (g *MultiPolygon) Type() GeometryType { return MULTIPOLYGON }
+func (g *MultiPolygon) Layout() Layout     { return g.layout }
+func (g *MultiPolygon) IsEmpty() bool      { return len(g.Polygons) == 0 }
+
+type GeometryCollection struct {
+	layout     Layout
+	Geometries []Geometry
+}
+
+func NewGeometryCollection(l Layout, gs ...Geometry) *GeometryCollection {
+	return &GeometryCollection{layout: l, Geometries: gs}
+}
+
+func (g *GeometryCollection) Type() GeometryType { return GEOMETRYCOLLECTION }
+func (g *GeometryCollection) Layout() Layout     { return g.layout }
+func (g *GeometryCollection) IsEmpty() bool      { return len(g.Geometries) == 0 }
+
+// Bound returns the bounding box of all coordinates. The box of an empty
+// geometry is vec3.MinBox.
+func Bound(g Geometry) vec3.Box[float64] {
+	box := vec3.MinBox
+	extend(&box, g)
+	return box
+}
+
+func extend(box *vec3.Box[float64], g Geometry) {
+	each := func(cs []Coord) {
+		for i := range cs {
+			box.Extend(&cs[i].Vec)
+		}
+	}
+	switch g := g.(type) {
+	case *Point:
+		if !g.empty {
+			box.Extend(&g.Coord.Vec)
+		}
+	case *LineString:
+		each(g.Coords)
+	case *MultiPoint:
+		each(g.Coords)
+	case *Polygon:
+		for _, r := range g.Rings {
+			each(r)
+		}
+	case *MultiLineString:
+		for _, l := range g.Lines {
+			each(l)
+		}
+	case *MultiPolygon:
+		for _, p := range g.Polygons {
+			for _, r := range p {
+				each(r)
+			}
+		}
+	case *GeometryCollection:
+		for _, c := range g.Geometries {
+			extend(box, c)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package geom
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+var canonicalWKT = []string{
+	"POINT (1 2)",
+	"POINT Z (1 2 3)",
+	"POINT M (1 2 4)",
+	"POINT ZM (1 2 3 4)",
+	"POINT EMPTY",
+	"POINT Z EMPTY",
+	"LINESTRING (0 0, 1 1.5, -2 0.25)",
+	"LINESTRING EMPTY",
+	"POLYGON ((0 0, 10 0, 10 10, 0 0), (1 1, 2 1, 2 2, 1 1))",
+	"POLYGON Z ((0 0 1, 1 0 1, 1 1 1, 0 0 1))",
+	"MULTIPOINT ((0 0), (1 1))",
+	"MULTIPOINT M ((0 0 1), (1 1 2))",
+	"MULTILINESTRING ((0 0, 1 1), (2 2, 3 3))",
+	"MULTIPOLYGON (((0 0, 1 0, 1 1, 0 0)), ((2 2, 3 2, 3 3, 2 2)))",
+	"MULTIPOLYGON EMPTY",
+	"GEOMETRYCOLLECTION (POINT (1 1), LINESTRING (0 0, 1 1))",
+	"GEOMETRYCOLLECTION Z (POINT Z (1 1 1), POLYGON Z ((0 0 0, 1 0 0, 1 1 0, 0 0 0)))",
+	"GEOMETRYCOLLECTION EMPTY",
+}
+
+func TestWKTRoundTrip(t *testing.T) {
+	for _, s := range canonicalWKT {
+		g, err := ParseWKT(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, s, MarshalWKT(g))
+	}
+}
+
+func TestParseWKTVariants(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"point(1 2)", "POINT (1 2)"},
+		{"POINTZ(1 2 3)", "POINT Z (1 2 3)"},
+		{"POINT (1 2 3)", "POINT Z (1 2 3)"},
+		{"POINT (1 2 3 4)", "POINT ZM (1 2 3 4)"},
+		{"LINESTRINGM (0 0 5, 1 1 6)", "LINESTRING M (0 0 5, 1 1 6)"},
+		{"MULTIPOINT (0 0, 1 1)", "MULTIPOINT ((0 0), (1 1))"},
+		{"MULTIPOINT Z((0 0 1),(1 1 2))", "MULTIPOINT Z ((0 0 1), (1 1 2))"},
+		{"  POLYGON\n((0 0,1 0,1 1,0 0))  ", "POLYGON ((0 0, 1 0, 1 1, 0 0))"},
+		{"GEOMETRYCOLLECTION (POINT Z (1 2 3))", "GEOMETRYCOLLECTION Z (POINT Z (1 2 3))"},
+		{"POINT (1e3 -2.5E-1)", "POINT (1000 -0.25)"},
+	}
+	for _, tt := range tests {
+		g, err := ParseWKT(tt.in)
+		assert.Nil(t, err, tt.in)
+		assert.Equal(t, tt.out, MarshalWKT(g))
+	}
+
+	for _, s := range []string{
+		"",
+		"POINT",
+		"POINT (1)",
+		"POINT (1 2, 3 4)",
+		"POINT Z (1 2)",
+		"LINESTRING (0 0, 1 1 1)",
+		"LINESTRING (0 0, 1 x)",
+		"CIRCLE (1 2)",
+		"POINT (1 2) POINT (3 4)",
+		"POLYGON ((0 0, 1 0, 1 1, 0 0)",
+		"SRID=4326;POINT (1 2)",
+	} {
+		_, err := ParseWKT(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestEWKT(t *testing.T) {
+	g, srid, err := ParseEWKT("SRID=4326;POINT (116.39 39.9)")
+	assert.Nil(t, err)
+	assert.Equal(t, 4326, srid)
+	assert.Equal(t, C2(116.39, 39.9), g.(*Point).Coord)
+	assert.Equal(t, "SRID=4326;POINT (116.39 39.9)", MarshalEWKT(g, srid))
+	assert.Equal(t, "POINT (116.39 39.9)", MarshalEWKT(g, 0))
+
+	g, srid, err = ParseEWKT("POINT (1 2)")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, srid)
+	assert.Equal(t, XY, g.Layout())
+
+	_, _, err = ParseEWKT("SRID=x;POINT (1 2)")
+	assert.NotNil(t, err)
+}
+
+func TestWKBKnownEncodings(t *testing.T) {
+	tests := []struct {
+		wkt   string
+		srid  int
+		ewkb  bool
+		order binary.ByteOrder
+		hex   string
+	}{
+		{"POINT (1 2)", 0, false, binary.LittleEndian, "0101000000000000000000f03f0000000000000040"},
+		{"POINT (1 2)", 0, false, binary.BigEndian, "00000000013ff00000000000004000000000000000"},
+		{"POINT Z (1 2 3)", 0, false, binary.LittleEndian, "01e9030000000000000000f03f00000000000000400000000000000840"},
+		{"POINT M (1 2 3)", 0, false, binary.BigEndian, "00000007d13ff000000000000040000000000000004008000000000000"},
+		{"POINT Z (1 2 3)", 0, true, binary.LittleEndian, "0101000080000000000000f03f00000000000000400000000000000840"},
+		{"POINT (1 2)", 4326, true, binary.LittleEndian, "0101000020e6100000000000000000f03f0000000000000040"},
+		{"POINT (1 2)", 4326, true, binary.BigEndian, "0020000001000010e63ff00000000000004000000000000000"},
+		{"LINESTRING (0 0, 1 1)", 0, false, binary.LittleEndian,
+			"010200000002000000" + "00000000000000000000000000000000" + "000000000000f03f000000000000f03f"},
+		{"MULTIPOINT ((0 0))", 0, false, binary.BigEndian,
+			"000000000400000001" + "0000000001" + "00000000000000000000000000000000"},
+	}
+	for _, tt := range tests {
+		g, err := ParseWKT(tt.wkt)
+		assert.Nil(t, err)
+		var b []byte
+		if tt.ewkb {
+			b, err = MarshalEWKB(g, tt.srid, tt.order)
+		} else {
+			b, err = MarshalWKB(g, tt.order)
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, tt.hex, hex.EncodeToString(b), tt.wkt)
+
+		raw, _ := hex.DecodeString(tt.hex)
+		d, srid, err := UnmarshalEWKB(raw)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.srid, srid)
+		assert.Equal(t, tt.wkt, MarshalWKT(d))
+	}
+}
+
+func TestWKBRoundTrip(t *testing.T) {
+	for _, s := range canonicalWKT {
+		g, err := ParseWKT(s)
+		assert.Nil(t, err)
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			b, err := MarshalWKB(g, order)
+			assert.Nil(t, err)
+			d, err := UnmarshalWKB(b)
+			assert.Nil(t, err, s)
+			assert.Equal(t, s, MarshalWKT(d))
+
+			b, err = MarshalEWKB(g, 3857, order)
+			assert.Nil(t, err)
+			d, srid, err := UnmarshalEWKB(b)
+			assert.Nil(t, err, s)
+			assert.Equal(t, 3857, srid)
+			assert.Equal(t, s, MarshalWKT(d))
+		}
+	}
+}
+
+func TestWKBEmptyPoint(t *testing.T) {
+	b, err := MarshalWKB(NewPointEmpty(XY), binary.LittleEndian)
+	assert.Nil(t, err)
+	assert.Len(t, b, 21)
+	assert.True(t, math.IsNaN(math.Float64frombits(binary.LittleEndian.Uint64(b[5:]))))
+}
+
+func TestWKBErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"02",
+		"0101000000000000000000f03f", // truncated
+		"0101000000000000000000f03f000000000000004000", // trailing bytes
+		"0109000000000000000000f03f0000000000000040",   // unknown type
+		"010200000000000010",                           // huge count
+		"010400000001000000010200000000000000",         // linestring in multipoint
+	} {
+		raw, _ := hex.DecodeString(s)
+		_, err := UnmarshalWKB(raw)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestBound(t *testing.T) {
+	g, err := ParseWKT("GEOMETRYCOLLECTION (POINT Z (5 -1 2), LINESTRING Z (0 0 0, 1 3 1))")
+	assert.Nil(t, err)
+	box := Bound(g)
+	assert.Equal(t, vec3.Vec[float64]{0, -1, 0}, box.Min)
+	assert.Equal(t, vec3.Vec[float64]{5, 3, 2}, box.Max)
+	assert.Equal(t, vec3.MinBox, Bound(NewPointEmpty(XY)))
+
+	assert.Equal(t, 4, XYZM.Stride())
+	assert.Equal(t, "MULTIPOLYGON", MULTIPOLYGON.String())
+	assert.Equal(t, "POINT M (1 2 3)", MarshalWKT(NewPoint(XYM, C4(1, 2, 9, 3))))
+}
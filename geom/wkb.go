@@ -0,0 +1,424 @@
+package geom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	wkbXDR = 0 // big endian
+	wkbNDR = 1 // little endian
+
+	ewkbZ    = 0x80000000
+	ewkbM    = 0x40000000
+	ewkbSRID = 0x20000000
+)
+
+// maxWKBCount guards allocations against corrupt element counts.
+const maxWKBCount = 1 << 26
+
+var errWKBCount = errors.New("geom: WKB element count too large")
+
+// MarshalWKB encodes the geometry as ISO WKB. Empty points are written with
+// NaN ordinates.
+func MarshalWKB(g Geometry, order binary.ByteOrder) ([]byte, error) {
+	w := &wkbWriter{order: order}
+	if err := w.write(g, false, 0); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+// MarshalEWKB encodes the geometry as PostGIS extended WKB. The SRID is
+// only written when it is not zero.
+func MarshalEWKB(g Geometry, srid int, order binary.ByteOrder) ([]byte, error) {
+	w := &wkbWriter{order: order}
+	if err := w.write(g, true, srid); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+type wkbWriter struct {
+	buf   bytes.Buffer
+	order binary.ByteOrder
+}
+
+func (w *wkbWriter) u32(v uint32) {
+	var b [4]byte
+	w.order.PutUint32(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *wkbWriter) f64(v float64) {
+	var b [8]byte
+	w.order.PutUint64(b[:], math.Float64bits(v))
+	w.buf.Write(b[:])
+}
+
+func (w *wkbWriter) coord(l Layout, c Coord) {
+	w.f64(c.Vec[0])
+	w.f64(c.Vec[1])
+	if l.HasZ() {
+		w.f64(c.Vec[2])
+	}
+	if l.HasM() {
+		w.f64(c.M)
+	}
+}
+
+func (w *wkbWriter) coords(l Layout, cs []Coord) {
+	w.u32(uint32(len(cs)))
+	for _, c := range cs {
+		w.coord(l, c)
+	}
+}
+
+func (w *wkbWriter) rings(l Layout, rs [][]Coord) {
+	w.u32(uint32(len(rs)))
+	for _, r := range rs {
+		w.coords(l, r)
+	}
+}
+
+func (w *wkbWriter) header(t GeometryType, l Layout, ewkb bool, srid int) {
+	if w.order == binary.BigEndian {
+		w.buf.WriteByte(wkbXDR)
+	} else {
+		w.buf.WriteByte(wkbNDR)
+	}
+	code := uint32(t)
+	if ewkb {
+		if l.HasZ() {
+			code |= ewkbZ
+		}
+		if l.HasM() {
+			code |= ewkbM
+		}
+		if srid != 0 {
+			code |= ewkbSRID
+		}
+		w.u32(code)
+		if srid != 0 {
+			w.u32(uint32(srid))
+		}
+		return
+	}
+	switch l {
+	case XYZ:
+		code += 1000
+	case XYM:
+		code += 2000
+	case XYZM:
+		code += 3000
+	}
+	w.u32(code)
+}
+
+func (w *wkbWriter) write(g Geometry, ewkb bool, srid int) error {
+	l := g.Layout()
+	w.header(g.Type(), l, ewkb, srid)
+	switch g := g.(type) {
+	case *Point:
+		if g.empty {
+			nan := math.NaN()
+			w.coord(l, Coord{Vec: [3]float64{nan, nan, nan}, M: nan})
+		} else {
+			w.coord(l, g.Coord)
+		}
+	case *LineString:
+		w.coords(l, g.Coords)
+	case *Polygon:
+		w.rings(l, g.Rings)
+	case *MultiPoint:
+		w.u32(uint32(len(g.Coords)))
+		for _, c := range g.Coords {
+			w.header(POINT, l, ewkb, 0)
+			w.coord(l, c)
+		}
+	case *MultiLineString:
+		w.u32(uint32(len(g.Lines)))
+		for _, ls := range g.Lines {
+			w.header(LINESTRING, l, ewkb, 0)
+			w.coords(l, ls)
+		}
+	case *MultiPolygon:
+		w.u32(uint32(len(g.Polygons)))
+		for _, p := range g.Polygons {
+			w.header(POLYGON, l, ewkb, 0)
+			w.rings(l, p)
+		}
+	case *GeometryCollection:
+		w.u32(uint32(len(g.Geometries)))
+		for _, c := range g.Geometries {
+			if err := w.write(c, ewkb, 0); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("geom: cannot encode %T as WKB", g)
+	}
+	return nil
+}
+
+// UnmarshalWKB decodes ISO WKB. EWKB input is accepted as well; its SRID is ignored.
+func UnmarshalWKB(b []byte) (Geometry, error) {
+	g, _, err := UnmarshalEWKB(b)
+	return g, err
+}
+
+// UnmarshalEWKB decodes PostGIS extended WKB and returns the embedded SRID,
+// zero when absent. ISO WKB input is accepted as well.
+func UnmarshalEWKB(b []byte) (Geometry, int, error) {
+	r := &wkbReader{b: b}
+	g, srid, err := r.read()
+	if err != nil {
+		return nil, 0, err
+	}
+	if r.pos != len(b) {
+		return nil, 0, fmt.Errorf("geom: %d trailing bytes after WKB geometry", len(b)-r.pos)
+	}
+	return g, srid, nil
+}
+
+type wkbReader struct {
+	b     []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (r *wkbReader) take(n int) ([]byte, error) {
+	if r.pos+n > len(r.b) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	s := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return s, nil
+}
+
+func (r *wkbReader) u32() (uint32, error) {
+	s, err := r.take(4)
+	if err != nil {
+		return 0, err
+	}
+	return r.order.Uint32(s), nil
+}
+
+func (r *wkbReader) count() (int, error) {
+	n, err := r.u32()
+	if err != nil {
+		return 0, err
+	}
+	if n > maxWKBCount {
+		return 0, errWKBCount
+	}
+	return int(n), nil
+}
+
+func (r *wkbReader) f64() (float64, error) {
+	s, err := r.take(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(r.order.Uint64(s)), nil
+}
+
+func (r *wkbReader) header() (GeometryType, Layout, int, error) {
+	s, err := r.take(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	switch s[0] {
+	case wkbXDR:
+		r.order = binary.BigEndian
+	case wkbNDR:
+		r.order = binary.LittleEndian
+	default:
+		return 0, 0, 0, fmt.Errorf("geom: invalid WKB byte order %d", s[0])
+	}
+	code, err := r.u32()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	hasZ, hasM := code&ewkbZ != 0, code&ewkbM != 0
+	srid := 0
+	if code&ewkbSRID != 0 {
+		v, err := r.u32()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		srid = int(int32(v))
+	}
+	code &^= ewkbZ | ewkbM | ewkbSRID
+	switch code / 1000 {
+	case 1:
+		hasZ = true
+	case 2:
+		hasM = true
+	case 3:
+		hasZ, hasM = true, true
+	}
+	t := GeometryType(code % 1000)
+	if _, ok := geometryTypeNames[t]; !ok {
+		return 0, 0, 0, fmt.Errorf("geom: unsupported WKB geometry type %d", code)
+	}
+	l := XY
+	switch {
+	case hasZ && hasM:
+		l = XYZM
+	case hasZ:
+		l = XYZ
+	case hasM:
+		l = XYM
+	}
+	return t, l, srid, nil
+}
+
+func (r *wkbReader) coord(l Layout) (Coord, error) {
+	var c Coord
+	var err error
+	if c.Vec[0], err = r.f64(); err != nil {
+		return c, err
+	}
+	if c.Vec[1], err = r.f64(); err != nil {
+		return c, err
+	}
+	if l.HasZ() {
+		if c.Vec[2], err = r.f64(); err != nil {
+			return c, err
+		}
+	}
+	if l.HasM() {
+		if c.M, err = r.f64(); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+func (r *wkbReader) coords(l Layout) ([]Coord, error) {
+	n, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	cs := make([]Coord, 0, min(n, len(r.b)/16))
+	for i := 0; i < n; i++ {
+		c, err := r.coord(l)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+func (r *wkbReader) rings(l Layout) ([][]Coord, error) {
+	n, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	var rs [][]Coord
+	for i := 0; i < n; i++ {
+		cs, err := r.coords(l)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, cs)
+	}
+	return rs, nil
+}
+
+// member reads a collection member that must be of type t and layout l.
+func (r *wkbReader) member(t GeometryType, l Layout) (Geometry, error) {
+	g, _, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+	if g.Type() != t || g.Layout() != l {
+		return nil, fmt.Errorf("geom: unexpected %s %s member in WKB collection", g.Type(), g.Layout())
+	}
+	return g, nil
+}
+
+func (r *wkbReader) read() (Geometry, int, error) {
+	t, l, srid, err := r.header()
+	if err != nil {
+		return nil, 0, err
+	}
+	switch t {
+	case POINT:
+		c, err := r.coord(l)
+		if err != nil {
+			return nil, 0, err
+		}
+		if math.IsNaN(c.Vec[0]) && math.IsNaN(c.Vec[1]) {
+			return NewPointEmpty(l), srid, nil
+		}
+		return NewPoint(l, c), srid, nil
+	case LINESTRING:
+		cs, err := r.coords(l)
+		if err != nil {
+			return nil, 0, err
+		}
+		return NewLineString(l, cs), srid, nil
+	case POLYGON:
+		rs, err := r.rings(l)
+		if err != nil {
+			return nil, 0, err
+		}
+		return NewPolygon(l, rs), srid, nil
+	}
+
+	n, err := r.count()
+	if err != nil {
+		return nil, 0, err
+	}
+	order := r.order
+	defer func() { r.order = order }()
+	switch t {
+	case MULTIPOINT:
+		mp := NewMultiPoint(l, nil)
+		for i := 0; i < n; i++ {
+			g, err := r.member(POINT, l)
+			if err != nil {
+				return nil, 0, err
+			}
+			mp.Coords = append(mp.Coords, g.(*Point).Coord)
+		}
+		return mp, srid, nil
+	case MULTILINESTRING:
+		ml := NewMultiLineString(l, nil)
+		for i := 0; i < n; i++ {
+			g, err := r.member(LINESTRING, l)
+			if err != nil {
+				return nil, 0, err
+			}
+			ml.Lines = append(ml.Lines, g.(*LineString).Coords)
+		}
+		return ml, srid, nil
+	case MULTIPOLYGON:
+		mp := NewMultiPolygon(l, nil)
+		for i := 0; i < n; i++ {
+			g, err := r.member(POLYGON, l)
+			if err != nil {
+				return nil, 0, err
+			}
+			mp.Polygons = append(mp.Polygons, g.(*Polygon).Rings)
+		}
+		return mp, srid, nil
+	default:
+		gc := NewGeometryCollection(l)
+		for i := 0; i < n; i++ {
+			g, _, err := r.read()
+			if err != nil {
+				return nil, 0, err
+			}
+			gc.Geometries = append(gc.Geometries, g)
+		}
+		return gc, srid, nil
+	}
+}
@@ -0,0 +1,418 @@
+package geom
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MarshalWKT formats the geometry as WKT, for example "POINT Z (1 2 3)".
+func MarshalWKT(g Geometry) string {
+	var b strings.Builder
+	writeWKT(&b, g)
+	return b.String()
+}
+
+// MarshalEWKT formats the geometry as EWKT with a "SRID=<srid>;" prefix
+// when srid is not zero.
+func MarshalEWKT(g Geometry, srid int) string {
+	if srid == 0 {
+		return MarshalWKT(g)
+	}
+	return fmt.Sprintf("SRID=%d;%s", srid, MarshalWKT(g))
+}
+
+func writeWKT(b *strings.Builder, g Geometry) {
+	b.WriteString(g.Type().String())
+	switch g.Layout() {
+	case XYZ:
+		b.WriteString(" Z")
+	case XYM:
+		b.WriteString(" M")
+	case XYZM:
+		b.WriteString(" ZM")
+	}
+	if g.IsEmpty() {
+		b.WriteString(" EMPTY")
+		return
+	}
+	b.WriteByte(' ')
+	l := g.Layout()
+	switch g := g.(type) {
+	case *Point:
+		writeWKTCoords(b, l, []Coord{g.Coord})
+	case *LineString:
+		writeWKTCoords(b, l, g.Coords)
+	case *Polygon:
+		writeWKTRings(b, l, g.Rings)
+	case *MultiPoint:
+		b.WriteByte('(')
+		for i, c := range g.Coords {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeWKTCoords(b, l, []Coord{c})
+		}
+		b.WriteByte(')')
+	case *MultiLineString:
+		writeWKTRings(b, l, g.Lines)
+	case *MultiPolygon:
+		b.WriteByte('(')
+		for i, p := range g.Polygons {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeWKTRings(b, l, p)
+		}
+		b.WriteByte(')')
+	case *GeometryCollection:
+		b.WriteByte('(')
+		for i, c := range g.Geometries {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeWKT(b, c)
+		}
+		b.WriteByte(')')
+	}
+}
+
+func writeWKTCoords(b *strings.Builder, l Layout, cs []Coord) {
+	b.WriteByte('(')
+	for i, c := range cs {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(formatOrdinate(c.Vec[0]))
+		b.WriteByte(' ')
+		b.WriteString(formatOrdinate(c.Vec[1]))
+		if l.HasZ() {
+			b.WriteByte(' ')
+			b.WriteString(formatOrdinate(c.Vec[2]))
+		}
+		if l.HasM() {
+			b.WriteByte(' ')
+			b.WriteString(formatOrdinate(c.M))
+		}
+	}
+	b.WriteByte(')')
+}
+
+func writeWKTRings(b *strings.Builder, l Layout, rs [][]Coord) {
+	b.WriteByte('(')
+	for i, r := range rs {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		writeWKTCoords(b, l, r)
+	}
+	b.WriteByte(')')
+}
+
+func formatOrdinate(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// ParseWKT parses a WKT geometry. Without a Z, M or ZM tag the layout is
+// taken from the number of ordinates of the first coordinate.
+func ParseWKT(s string) (Geometry, error) {
+	g, srid, err := ParseEWKT(s)
+	if err == nil && srid != 0 {
+		return nil, fmt.Errorf("geom: unexpected SRID in WKT %q", s)
+	}
+	return g, err
+}
+
+// ParseEWKT parses WKT with an optional "SRID=<srid>;" prefix.
+func ParseEWKT(s string) (Geometry, int, error) {
+	p := &wktParser{s: s}
+	srid := 0
+	if strings.EqualFold(p.peek(), "SRID") {
+		p.next()
+		if err := p.expect("="); err != nil {
+			return nil, 0, err
+		}
+		tok := p.next()
+		v, err := strconv.Atoi(tok)
+		if err != nil {
+			return nil, 0, fmt.Errorf("geom: invalid SRID %q", tok)
+		}
+		srid = v
+		if err := p.expect(";"); err != nil {
+			return nil, 0, err
+		}
+	}
+	g, err := p.parseGeometry()
+	if err != nil {
+		return nil, 0, err
+	}
+	if t := p.next(); t != "" {
+		return nil, 0, fmt.Errorf("geom: unexpected %q after WKT geometry", t)
+	}
+	return g, srid, nil
+}
+
+type wktParser struct {
+	s   string
+	pos int
+}
+
+func (p *wktParser) next() string {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	if p.pos >= len(p.s) {
+		return ""
+	}
+	if c := p.s[p.pos]; strings.IndexByte("(),;=", c) >= 0 {
+		p.pos++
+		return string(c)
+	}
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n(),;=", p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *wktParser) peek() string {
+	save := p.pos
+	t := p.next()
+	p.pos = save
+	return t
+}
+
+func (p *wktParser) expect(tok string) error {
+	if t := p.next(); t != tok {
+		return fmt.Errorf("geom: expected %q in WKT, got %q", tok, t)
+	}
+	return nil
+}
+
+// list parses "(" item { "," item } ")".
+func (p *wktParser) list(item func() error) error {
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for {
+		if err := item(); err != nil {
+			return err
+		}
+		switch t := p.next(); t {
+		case ")":
+			return nil
+		case ",":
+		default:
+			return fmt.Errorf("geom: expected ',' or ')' in WKT, got %q", t)
+		}
+	}
+}
+
+var wktTypes = map[string]GeometryType{
+	"POINT":              POINT,
+	"LINESTRING":         LINESTRING,
+	"POLYGON":            POLYGON,
+	"MULTIPOINT":         MULTIPOINT,
+	"MULTILINESTRING":    MULTILINESTRING,
+	"MULTIPOLYGON":       MULTIPOLYGON,
+	"GEOMETRYCOLLECTION": GEOMETRYCOLLECTION,
+}
+
+// layoutUnknown marks a layout that is taken from the first coordinate.
+const layoutUnknown Layout = -1
+
+func (p *wktParser) parseGeometry() (Geometry, error) {
+	name := strings.ToUpper(p.next())
+	l := layoutUnknown
+	typ, ok := wktTypes[name]
+	if !ok {
+		// the dimension may be attached to the name as in "POINTZ"
+		for _, sl := range []Layout{XYZM, XYZ, XYM} {
+			suffix := strings.TrimPrefix(sl.String(), "XY")
+			if t, found := wktTypes[strings.TrimSuffix(name, suffix)]; found && strings.HasSuffix(name, suffix) {
+				typ, l, ok = t, sl, true
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("geom: unsupported WKT geometry %q", name)
+		}
+	}
+	if l == layoutUnknown {
+		switch strings.ToUpper(p.peek()) {
+		case "Z":
+			l = XYZ
+		case "M":
+			l = XYM
+		case "ZM":
+			l = XYZM
+		}
+		if l != layoutUnknown {
+			p.next()
+		}
+	}
+	if strings.EqualFold(p.peek(), "EMPTY") {
+		p.next()
+		if l == layoutUnknown {
+			l = XY
+		}
+		return emptyGeometry(typ, l), nil
+	}
+
+	switch typ {
+	case POINT:
+		cs, err := p.coords(&l)
+		if err != nil {
+			return nil, err
+		}
+		if len(cs) != 1 {
+			return nil, fmt.Errorf("geom: POINT needs one coordinate, got %d", len(cs))
+		}
+		return NewPoint(l, cs[0]), nil
+	case LINESTRING:
+		cs, err := p.coords(&l)
+		if err != nil {
+			return nil, err
+		}
+		return NewLineString(l, cs), nil
+	case POLYGON:
+		rs, err := p.rings(&l)
+		if err != nil {
+			return nil, err
+		}
+		return NewPolygon(l, rs), nil
+	case MULTIPOINT:
+		var cs []Coord
+		err := p.list(func() error {
+			// members may be bare coordinates or in parentheses
+			if p.peek() != "(" {
+				c, err := p.coord(&l)
+				cs = append(cs, c)
+				return err
+			}
+			one, err := p.coords(&l)
+			if err == nil && len(one) != 1 {
+				err = fmt.Errorf("geom: MULTIPOINT member needs one coordinate, got %d", len(one))
+			}
+			if err == nil {
+				cs = append(cs, one[0])
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return NewMultiPoint(l, cs), nil
+	case MULTILINESTRING:
+		ls, err := p.rings(&l)
+		if err != nil {
+			return nil, err
+		}
+		return NewMultiLineString(l, ls), nil
+	case MULTIPOLYGON:
+		var ps [][][]Coord
+		err := p.list(func() error {
+			rs, err := p.rings(&l)
+			ps = append(ps, rs)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return NewMultiPolygon(l, ps), nil
+	default:
+		var gs []Geometry
+		err := p.list(func() error {
+			g, err := p.parseGeometry()
+			if err != nil {
+				return err
+			}
+			if l == layoutUnknown {
+				l = g.Layout()
+			}
+			gs = append(gs, g)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return NewGeometryCollection(l, gs...), nil
+	}
+}
+
+func (p *wktParser) coord(l *Layout) (Coord, error) {
+	var vals []float64
+	for {
+		t := p.peek()
+		if t == "," || t == ")" || t == "" {
+			break
+		}
+		p.next()
+		v, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return Coord{}, fmt.Errorf("geom: invalid WKT number %q", t)
+		}
+		vals = append(vals, v)
+	}
+	if *l == layoutUnknown {
+		switch len(vals) {
+		case 2:
+			*l = XY
+		case 3:
+			*l = XYZ
+		case 4:
+			*l = XYZM
+		}
+	}
+	if *l == layoutUnknown || len(vals) != l.Stride() {
+		return Coord{}, fmt.Errorf("geom: WKT coordinate has %d ordinates", len(vals))
+	}
+	c := Coord{Vec: [3]float64{vals[0], vals[1], 0}}
+	switch *l {
+	case XYZ:
+		c.Vec[2] = vals[2]
+	case XYM:
+		c.M = vals[2]
+	case XYZM:
+		c.Vec[2], c.M = vals[2], vals[3]
+	}
+	return c, nil
+}
+
+func (p *wktParser) coords(l *Layout) ([]Coord, error) {
+	var cs []Coord
+	err := p.list(func() error {
+		c, err := p.coord(l)
+		cs = append(cs, c)
+		return err
+	})
+	return cs, err
+}
+
+func (p *wktParser) rings(l *Layout) ([][]Coord, error) {
+	var rs [][]Coord
+	err := p.list(func() error {
+		cs, err := p.coords(l)
+		rs = append(rs, cs)
+		return err
+	})
+	return rs, err
+}
+
+func emptyGeometry(t GeometryType, l Layout) Geometry {
+	switch t {
+	case POINT:
+		return NewPointEmpty(l)
+	case LINESTRING:
+		return NewLineString(l, nil)
+	case POLYGON:
+		return NewPolygon(l, nil)
+	case MULTIPOINT:
+		return NewMultiPoint(l, nil)
+	case MULTILINESTRING:
+		return NewMultiLineString(l, nil)
+	case MULTIPOLYGON:
+		return NewMultiPolygon(l, nil)
+	}
+	return NewGeometryCollection(l)
+}
@@ -0,0 +1,307 @@
+// Package kml reads and writes OGC KML 2.2 documents and KMZ archives.
+package kml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+const KML_NAMESPACE = "http://www.opengis.net/kml/2.2"
+
+// KML is the root element of a document.
+type KML struct {
+	XMLName   xml.Name   `xml:"kml"`
+	Xmlns     string     `xml:"xmlns,attr,omitempty"`
+	Document  *Document  `xml:"Document,omitempty"`
+	Folder    *Folder    `xml:"Folder,omitempty"`
+	Placemark *Placemark `xml:"Placemark,omitempty"`
+}
+
+// Container holds the members shared by Document and Folder.
+type Container struct {
+	ID           string        `xml:"id,attr,omitempty"`
+	Name         string        `xml:"name,omitempty"`
+	Visibility   *bool         `xml:"visibility,omitempty"`
+	Open         *bool         `xml:"open,omitempty"`
+	Description  string        `xml:"description,omitempty"`
+	ExtendedData *ExtendedData `xml:"ExtendedData,omitempty"`
+	Styles       []*Style      `xml:"Style"`
+	StyleMaps    []*StyleMap   `xml:"StyleMap"`
+	Folders      []*Folder     `xml:"Folder"`
+	Placemarks   []*Placemark  `xml:"Placemark"`
+}
+
+type Document struct {
+	Container
+}
+
+type Folder struct {
+	Container
+}
+
+// Placemark is a feature with a geometry. At most one geometry field is set.
+type Placemark struct {
+	ID            string         `xml:"id,attr,omitempty"`
+	Name          string         `xml:"name,omitempty"`
+	Visibility    *bool          `xml:"visibility,omitempty"`
+	Description   string         `xml:"description,omitempty"`
+	StyleURL      string         `xml:"styleUrl,omitempty"`
+	Style         *Style         `xml:"Style,omitempty"`
+	ExtendedData  *ExtendedData  `xml:"ExtendedData,omitempty"`
+	Point         *Point         `xml:"Point,omitempty"`
+	LineString    *LineString    `xml:"LineString,omitempty"`
+	Polygon       *Polygon       `xml:"Polygon,omitempty"`
+	MultiGeometry *MultiGeometry `xml:"MultiGeometry,omitempty"`
+	Model         *Model         `xml:"Model,omitempty"`
+}
+
+// Coordinates is a KML coordinate list of "lon,lat[,alt]" tuples separated by white space.
+type Coordinates []vec3.Vec[float64]
+
+// MarshalText formats the coordinates.
+func (c Coordinates) MarshalText() ([]byte, error) {
+	var b strings.Builder
+	for i, p := range c {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(strconv.FormatFloat(p[0], 'f', -1, 64))
+		b.WriteByte(',')
+		b.WriteString(strconv.FormatFloat(p[1], 'f', -1, 64))
+		b.WriteByte(',')
+		b.WriteString(strconv.FormatFloat(p[2], 'f', -1, 64))
+	}
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText parses the coordinates.
+func (c *Coordinates) UnmarshalText(text []byte) error {
+	tuples := strings.Fields(string(text))
+	r := make(Coordinates, 0, len(tuples))
+	for _, t := range tuples {
+		parts := strings.Split(t, ",")
+		if len(parts) < 2 || len(parts) > 3 {
+			return fmt.Errorf("kml: invalid coordinate tuple %q", t)
+		}
+		var p vec3.Vec[float64]
+		for i, s := range parts {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return fmt.Errorf("kml: invalid coordinate tuple %q", t)
+			}
+			p[i] = f
+		}
+		r = append(r, p)
+	}
+	*c = r
+	return nil
+}
+
+type Point struct {
+	ID           string      `xml:"id,attr,omitempty"`
+	Extrude      bool        `xml:"extrude,omitempty"`
+	AltitudeMode string      `xml:"altitudeMode,omitempty"`
+	Coordinates  Coordinates `xml:"coordinates"`
+}
+
+type LineString struct {
+	ID           string      `xml:"id,attr,omitempty"`
+	Extrude      bool        `xml:"extrude,omitempty"`
+	Tessellate   bool        `xml:"tessellate,omitempty"`
+	AltitudeMode string      `xml:"altitudeMode,omitempty"`
+	Coordinates  Coordinates `xml:"coordinates"`
+}
+
+type LinearRing struct {
+	ID          string      `xml:"id,attr,omitempty"`
+	Coordinates Coordinates `xml:"coordinates"`
+}
+
+type Boundary struct {
+	LinearRing LinearRing `xml:"LinearRing"`
+}
+
+type Polygon struct {
+	ID              string     `xml:"id,attr,omitempty"`
+	Extrude         bool       `xml:"extrude,omitempty"`
+	Tessellate      bool       `xml:"tessellate,omitempty"`
+	AltitudeMode    string     `xml:"altitudeMode,omitempty"`
+	OuterBoundaryIs Boundary   `xml:"outerBoundaryIs"`
+	InnerBoundaryIs []Boundary `xml:"innerBoundaryIs"`
+}
+
+type MultiGeometry struct {
+	ID              string           `xml:"id,attr,omitempty"`
+	Points          []*Point         `xml:"Point"`
+	LineStrings     []*LineString    `xml:"LineString"`
+	Polygons        []*Polygon       `xml:"Polygon"`
+	Models          []*Model         `xml:"Model"`
+	MultiGeometries []*MultiGeometry `xml:"MultiGeometry"`
+}
+
+// ExtendedData carries untyped Data pairs and typed SchemaData.
+type ExtendedData struct {
+	Data       []Data       `xml:"Data"`
+	SchemaData []SchemaData `xml:"SchemaData"`
+}
+
+type Data struct {
+	Name        string `xml:"name,attr"`
+	DisplayName string `xml:"displayName,omitempty"`
+	Value       string `xml:"value"`
+}
+
+type SchemaData struct {
+	SchemaURL  string       `xml:"schemaUrl,attr,omitempty"`
+	SimpleData []SimpleData `xml:"SimpleData"`
+}
+
+type SimpleData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Get returns the value of a Data or SimpleData element.
+func (e *ExtendedData) Get(name string) (string, bool) {
+	if e == nil {
+		return "", false
+	}
+	for _, d := range e.Data {
+		if d.Name == name {
+			return d.Value, true
+		}
+	}
+	for _, s := range e.SchemaData {
+		for _, d := range s.SimpleData {
+			if d.Name == name {
+				return d.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Set sets the value of a Data element.
+func (e *ExtendedData) Set(name, value string) {
+	for i := range e.Data {
+		if e.Data[i].Name == name {
+			e.Data[i].Value = value
+			return
+		}
+	}
+	e.Data = append(e.Data, Data{Name: name, Value: value})
+}
+
+// Decode reads a KML document.
+func Decode(r io.Reader) (*KML, error) {
+	k := &KML{}
+	if err := xml.NewDecoder(r).Decode(k); err != nil {
+		return nil, fmt.Errorf("kml: %w", err)
+	}
+	return k, nil
+}
+
+// Encode writes the document with an XML header.
+func (k *KML) Encode(w io.Writer) error {
+	if k.Xmlns == "" {
+		k.Xmlns = KML_NAMESPACE
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(k); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Placemarks returns all placemarks of the document including those nested
+// in folders. The placemarks of a container precede those of its folders.
+func (k *KML) Placemarks() []*Placemark {
+	var res []*Placemark
+	if k.Placemark != nil {
+		res = append(res, k.Placemark)
+	}
+	if k.Document != nil {
+		res = k.Document.collect(res)
+	}
+	if k.Folder != nil {
+		res = k.Folder.collect(res)
+	}
+	return res
+}
+
+func (c *Container) collect(res []*Placemark) []*Placemark {
+	res = append(res, c.Placemarks...)
+	for _, f := range c.Folders {
+		res = f.collect(res)
+	}
+	return res
+}
+
+// Models returns the models of all placemarks including those in MultiGeometry.
+func (k *KML) Models() []*Model {
+	var res []*Model
+	for _, p := range k.Placemarks() {
+		if p.Model != nil {
+			res = append(res, p.Model)
+		}
+		res = p.MultiGeometry.collectModels(res)
+	}
+	return res
+}
+
+func (m *MultiGeometry) collectModels(res []*Model) []*Model {
+	if m == nil {
+		return res
+	}
+	res = append(res, m.Models...)
+	for _, c := range m.MultiGeometries {
+		res = c.collectModels(res)
+	}
+	return res
+}
+
+// FindStyle resolves a style URL of the form "#id" against the styles and
+// style maps of the document. Style maps resolve to their "normal" style.
+func (k *KML) FindStyle(url string) *Style {
+	id, ok := strings.CutPrefix(url, "#")
+	if !ok || k.Document == nil {
+		return nil
+	}
+	return k.Document.findStyle(id, 0)
+}
+
+func (c *Container) findStyle(id string, depth int) *Style {
+	for _, s := range c.Styles {
+		if s.ID == id {
+			return s
+		}
+	}
+	if depth > 4 {
+		return nil
+	}
+	for _, m := range c.StyleMaps {
+		if m.ID != id {
+			continue
+		}
+		for _, p := range m.Pairs {
+			if p.Key == "normal" {
+				if p.Style != nil {
+					return p.Style
+				}
+				if ref, ok := strings.CutPrefix(p.StyleURL, "#"); ok {
+					return c.findStyle(ref, depth+1)
+				}
+			}
+		}
+	}
+	return nil
+}
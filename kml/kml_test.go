@@ -0,0 +1,195 @@
+package kml
+
+import (
+	"bytes"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/mst"
+	"pinkey.ltd/xr/proj"
+)
+
+const testKML = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+  <Document>
+    <name>survey</name>
+    <Style id="red">
+      <LineStyle><color>ff0000ff</color><width>2</width></LineStyle>
+      <PolyStyle><color>7f0000ff</color><fill>1</fill></PolyStyle>
+    </Style>
+    <StyleMap id="redMap">
+      <Pair><key>normal</key><styleUrl>#red</styleUrl></Pair>
+      <Pair><key>highlight</key><styleUrl>#red</styleUrl></Pair>
+    </StyleMap>
+    <Placemark id="p1">
+      <name>marker</name>
+      <ExtendedData>
+        <Data name="height"><value>12.5</value></Data>
+      </ExtendedData>
+      <Point><coordinates>116.391,39.907,50</coordinates></Point>
+    </Placemark>
+    <Folder>
+      <name>lines</name>
+      <Placemark>
+        <styleUrl>#redMap</styleUrl>
+        <LineString>
+          <tessellate>1</tessellate>
+          <coordinates>
+            116.0,39.0,0 116.1,39.1,0
+            116.2,39.0
+          </coordinates>
+        </LineString>
+      </Placemark>
+      <Folder>
+        <Placemark>
+          <Polygon>
+            <outerBoundaryIs><LinearRing><coordinates>0,0 1,0 1,1 0,1 0,0</coordinates></LinearRing></outerBoundaryIs>
+            <innerBoundaryIs><LinearRing><coordinates>0.2,0.2 0.2,0.8 0.8,0.8 0.2,0.2</coordinates></LinearRing></innerBoundaryIs>
+          </Polygon>
+        </Placemark>
+      </Folder>
+    </Folder>
+    <Placemark>
+      <MultiGeometry>
+        <Point><coordinates>1,2,3</coordinates></Point>
+        <Model>
+          <altitudeMode>absolute</altitudeMode>
+          <Location><longitude>116.391</longitude><latitude>39.907</latitude><altitude>30</altitude></Location>
+          <Orientation><heading>90</heading><tilt>0</tilt><roll>0</roll></Orientation>
+          <Scale><x>2</x><y>2</y><z>2</z></Scale>
+          <Link><href>models/house.dae</href></Link>
+        </Model>
+      </MultiGeometry>
+    </Placemark>
+  </Document>
+</kml>`
+
+func TestDecode(t *testing.T) {
+	k, err := Decode(strings.NewReader(testKML))
+	assert.Nil(t, err)
+	assert.Equal(t, "survey", k.Document.Name)
+
+	pms := k.Placemarks()
+	assert.Len(t, pms, 4)
+	assert.Equal(t, "p1", pms[0].ID)
+	assert.Equal(t, Coordinates{{116.391, 39.907, 50}}, pms[0].Point.Coordinates)
+	v, ok := pms[0].ExtendedData.Get("height")
+	assert.True(t, ok)
+	assert.Equal(t, "12.5", v)
+
+	line := pms[2].LineString
+	assert.NotNil(t, line)
+	assert.True(t, line.Tessellate)
+	assert.Equal(t, Coordinates{{116, 39, 0}, {116.1, 39.1, 0}, {116.2, 39, 0}}, line.Coordinates)
+
+	poly := pms[3].Polygon
+	assert.NotNil(t, poly)
+	assert.Len(t, poly.OuterBoundaryIs.LinearRing.Coordinates, 5)
+	assert.Len(t, poly.InnerBoundaryIs, 1)
+
+	st := k.FindStyle(pms[2].StyleURL)
+	assert.NotNil(t, st)
+	assert.Equal(t, "red", st.ID)
+	c, err := st.LineStyle.Color.NRGBA()
+	assert.Nil(t, err)
+	assert.Equal(t, color.NRGBA{R: 255, A: 255}, c)
+	assert.Nil(t, k.FindStyle("#missing"))
+
+	models := k.Models()
+	assert.Len(t, models, 1)
+	assert.Equal(t, "models/house.dae", models[0].Link.Href)
+	assert.Equal(t, 2.0, models[0].Scale.X)
+
+	_, err = Decode(strings.NewReader(`<kml><Placemark><Point><coordinates>1</coordinates></Point></Placemark></kml>`))
+	assert.NotNil(t, err)
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	k, err := Decode(strings.NewReader(testKML))
+	assert.Nil(t, err)
+	var buf bytes.Buffer
+	assert.Nil(t, k.Encode(&buf))
+	assert.True(t, strings.HasPrefix(buf.String(), "<?xml"))
+	assert.Contains(t, buf.String(), `<kml xmlns="http://www.opengis.net/kml/2.2">`)
+
+	k2, err := Decode(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, k.Placemarks(), k2.Placemarks())
+	assert.Equal(t, k.Document.Styles, k2.Document.Styles)
+}
+
+func TestColor(t *testing.T) {
+	c := NewColor(color.NRGBA{R: 0x11, G: 0x22, B: 0x33, A: 0x44})
+	assert.Equal(t, Color("44332211"), c)
+	rgba, err := c.NRGBA()
+	assert.Nil(t, err)
+	assert.Equal(t, color.NRGBA{R: 0x11, G: 0x22, B: 0x33, A: 0x44}, rgba)
+	_, err = Color("fff").NRGBA()
+	assert.NotNil(t, err)
+}
+
+func TestModelMatrix(t *testing.T) {
+	m := NewModel("house.dae", 116.391, 39.907, 30)
+	m.Orientation.Heading = 90
+	m.Scale = &Scale{X: 2, Y: 2, Z: 2}
+	mt := m.Matrix()
+
+	// the model origin is placed at the location
+	x, y, z := proj.Lonlat2Ecef(116.391, 39.907, 30)
+	assert.InDelta(t, x, mt[3][0], 1e-6)
+	assert.InDelta(t, y, mt[3][1], 1e-6)
+	assert.InDelta(t, z, mt[3][2], 1e-6)
+
+	// heading 90 turns the model y axis (north) to the east
+	enu := proj.Enu2Ecef(116.391, 39.907, 30)
+	north := vec3.Vec[float64]{0, 1, 0}
+	mt.TransformVec3(&north)
+	east := vec3.Vec[float64]{2, 0, 0}
+	enu.TransformVec3(&east)
+	assert.InDelta(t, east[0], north[0], 1e-6)
+	assert.InDelta(t, east[1], north[1], 1e-6)
+	assert.InDelta(t, east[2], north[2], 1e-6)
+
+	// up stays up and is scaled
+	up := vec3.Vec[float64]{0, 0, 1}
+	mt.TransformVec3(&up)
+	ux, uy, uz := proj.Lonlat2Ecef(116.391, 39.907, 32)
+	assert.InDelta(t, ux, up[0], 1e-6)
+	assert.InDelta(t, uy, up[1], 1e-6)
+	assert.InDelta(t, uz, up[2], 1e-6)
+}
+
+func TestModelInstances(t *testing.T) {
+	k, err := Decode(strings.NewReader(testKML))
+	assert.Nil(t, err)
+	mesh := &mst.BaseMesh[float64]{}
+	inst := ModelInstances(mesh, k.Models()...)
+	assert.Same(t, mesh, inst.Mesh)
+	assert.Len(t, inst.Transfors, 1)
+	assert.Equal(t, []uint64{0}, inst.Features)
+	sx := math.Sqrt(inst.Transfors[0][0][0]*inst.Transfors[0][0][0] + inst.Transfors[0][0][1]*inst.Transfors[0][0][1] + inst.Transfors[0][0][2]*inst.Transfors[0][0][2])
+	assert.InDelta(t, 2, sx, 1e-9)
+}
+
+func TestKMZ(t *testing.T) {
+	k, err := Decode(strings.NewReader(testKML))
+	assert.Nil(t, err)
+	kmz := &KMZ{KML: k, Files: map[string][]byte{"models/house.dae": []byte("<COLLADA/>")}}
+	var buf bytes.Buffer
+	assert.Nil(t, kmz.Write(&buf))
+
+	back, err := ReadKMZ(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	assert.Len(t, back.KML.Placemarks(), 4)
+	assert.Len(t, back.Files, 1)
+	bt, ok := back.Resource("./models/house.dae")
+	assert.True(t, ok)
+	assert.Equal(t, "<COLLADA/>", string(bt))
+
+	_, err = ReadKMZ(bytes.NewReader([]byte("not a zip")), 9)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,111 @@
+package kml
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// KMZ_ROOT_DOCUMENT is the name of the main document inside a KMZ archive.
+const KMZ_ROOT_DOCUMENT = "doc.kml"
+
+// KMZ is a zipped KML document together with its resources such as models
+// and textures.
+type KMZ struct {
+	KML   *KML
+	Files map[string][]byte // resources by archive path
+}
+
+// ReadKMZ reads an archive. The main document is doc.kml or, failing that,
+// the first .kml file in the root of the archive.
+func ReadKMZ(r io.ReaderAt, size int64) (*KMZ, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("kml: %w", err)
+	}
+	kmz := &KMZ{Files: make(map[string][]byte)}
+	var root string
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := f.Name
+		if root == "" && strings.EqualFold(path.Ext(name), ".kml") && !strings.Contains(name, "/") {
+			root = name
+		}
+		if name == KMZ_ROOT_DOCUMENT {
+			root = name
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		bt, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		kmz.Files[name] = bt
+	}
+	if root == "" {
+		return nil, errors.New("kml: KMZ archive without KML document")
+	}
+	if kmz.KML, err = Decode(bytes.NewReader(kmz.Files[root])); err != nil {
+		return nil, err
+	}
+	delete(kmz.Files, root)
+	return kmz, nil
+}
+
+// OpenKMZ reads an archive from a file.
+func OpenKMZ(filename string) (*KMZ, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ReadKMZ(f, st.Size())
+}
+
+// Write stores the document as doc.kml, followed by the resources in name order.
+func (z *KMZ) Write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	fw, err := zw.Create(KMZ_ROOT_DOCUMENT)
+	if err != nil {
+		return err
+	}
+	if err := z.KML.Encode(fw); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(z.Files))
+	for name := range z.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(z.Files[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Resource returns the content of a file referenced by a model link or icon.
+func (z *KMZ) Resource(href string) ([]byte, bool) {
+	bt, ok := z.Files[path.Clean(strings.TrimPrefix(href, "./"))]
+	return bt, ok
+}
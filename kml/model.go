@@ -0,0 +1,107 @@
+package kml
+
+import (
+	"math"
+
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/quaternion"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/mst"
+	"pinkey.ltd/xr/proj"
+)
+
+// Model places a COLLADA model at a geographic location.
+type Model struct {
+	ID           string       `xml:"id,attr,omitempty"`
+	AltitudeMode string       `xml:"altitudeMode,omitempty"`
+	Location     Location     `xml:"Location"`
+	Orientation  *Orientation `xml:"Orientation,omitempty"`
+	Scale        *Scale       `xml:"Scale,omitempty"`
+	Link         *Link        `xml:"Link,omitempty"`
+	ResourceMap  *ResourceMap `xml:"ResourceMap,omitempty"`
+}
+
+type Location struct {
+	Longitude float64 `xml:"longitude"`
+	Latitude  float64 `xml:"latitude"`
+	Altitude  float64 `xml:"altitude"`
+}
+
+// Orientation holds rotations in degrees. Heading turns clockwise around the
+// up axis starting at north, tilt around the east axis and roll around the
+// north axis; they are applied in roll, tilt, heading order.
+type Orientation struct {
+	Heading float64 `xml:"heading"`
+	Tilt    float64 `xml:"tilt"`
+	Roll    float64 `xml:"roll"`
+}
+
+type Scale struct {
+	X float64 `xml:"x"`
+	Y float64 `xml:"y"`
+	Z float64 `xml:"z"`
+}
+
+type Link struct {
+	Href string `xml:"href"`
+}
+
+type ResourceMap struct {
+	Aliases []Alias `xml:"Alias"`
+}
+
+type Alias struct {
+	TargetHref string `xml:"targetHref"`
+	SourceHref string `xml:"sourceHref"`
+}
+
+// LocalMatrix returns the orientation and scale of the model in its east,
+// north, up frame.
+func (m *Model) LocalMatrix() *mat4.Mat[float64] {
+	q := quaternion.H[float64]{0, 0, 0, 1}
+	if o := m.Orientation; o != nil {
+		heading := quaternion.FromZAxisAngle(-o.Heading * math.Pi / 180)
+		tilt := quaternion.FromXAxisAngle(o.Tilt * math.Pi / 180)
+		roll := quaternion.FromYAxisAngle(o.Roll * math.Pi / 180)
+		q = quaternion.Mul3(&heading, &tilt, &roll)
+	}
+	scale := vec3.Vec[float64]{1, 1, 1}
+	if s := m.Scale; s != nil {
+		scale = vec3.Vec[float64]{s.X, s.Y, s.Z}
+	}
+	return mat4.Compose(&vec3.Vec[float64]{}, &q, &scale)
+}
+
+// Matrix returns the transform from model coordinates to WGS84 ECEF. The
+// altitude is used as ellipsoidal height regardless of the altitude mode.
+func (m *Model) Matrix() *mat4.Mat[float64] {
+	enu := proj.Enu2Ecef(m.Location.Longitude, m.Location.Latitude, m.Location.Altitude)
+	return mat4.AssignMul(enu, m.LocalMatrix())
+}
+
+// NewModel creates a model at a location with identity orientation and scale.
+func NewModel(href string, lon, lat, alt float64) *Model {
+	return &Model{
+		Location:    Location{Longitude: lon, Latitude: lat, Altitude: alt},
+		Orientation: &Orientation{},
+		Scale:       &Scale{X: 1, Y: 1, Z: 1},
+		Link:        &Link{Href: href},
+	}
+}
+
+// ModelInstances places a mesh at every model as one MST instance node.
+func ModelInstances[T float64 | float32](mesh *mst.BaseMesh[T], models ...*Model) *mst.InstanceMesh[T] {
+	inst := &mst.InstanceMesh[T]{Mesh: mesh}
+	for i, m := range models {
+		mt := m.Matrix()
+		var tr mat4.Mat[T]
+		for c := 0; c < 4; c++ {
+			for k := 0; k < 4; k++ {
+				tr[c][k] = T(mt[c][k])
+			}
+		}
+		inst.Transfors = append(inst.Transfors, &tr)
+		inst.Features = append(inst.Features, uint64(i))
+	}
+	return inst
+}
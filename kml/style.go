@@ -0,0 +1,78 @@
+package kml
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+)
+
+type Style struct {
+	ID         string      `xml:"id,attr,omitempty"`
+	IconStyle  *IconStyle  `xml:"IconStyle,omitempty"`
+	LabelStyle *LabelStyle `xml:"LabelStyle,omitempty"`
+	LineStyle  *LineStyle  `xml:"LineStyle,omitempty"`
+	PolyStyle  *PolyStyle  `xml:"PolyStyle,omitempty"`
+}
+
+type StyleMap struct {
+	ID    string `xml:"id,attr,omitempty"`
+	Pairs []Pair `xml:"Pair"`
+}
+
+type Pair struct {
+	Key      string `xml:"key"`
+	StyleURL string `xml:"styleUrl,omitempty"`
+	Style    *Style `xml:"Style,omitempty"`
+}
+
+type Icon struct {
+	Href string `xml:"href"`
+}
+
+type IconStyle struct {
+	Color   Color    `xml:"color,omitempty"`
+	Scale   float64  `xml:"scale,omitempty"`
+	Heading float64  `xml:"heading,omitempty"`
+	Icon    *Icon    `xml:"Icon,omitempty"`
+	HotSpot *HotSpot `xml:"hotSpot,omitempty"`
+}
+
+type HotSpot struct {
+	X      float64 `xml:"x,attr"`
+	Y      float64 `xml:"y,attr"`
+	XUnits string  `xml:"xunits,attr,omitempty"`
+	YUnits string  `xml:"yunits,attr,omitempty"`
+}
+
+type LabelStyle struct {
+	Color Color   `xml:"color,omitempty"`
+	Scale float64 `xml:"scale,omitempty"`
+}
+
+type LineStyle struct {
+	Color Color   `xml:"color,omitempty"`
+	Width float64 `xml:"width,omitempty"`
+}
+
+type PolyStyle struct {
+	Color   Color `xml:"color,omitempty"`
+	Fill    *bool `xml:"fill,omitempty"`
+	Outline *bool `xml:"outline,omitempty"`
+}
+
+// Color is a KML color in aabbggrr hex notation.
+type Color string
+
+// NewColor formats a color in KML notation.
+func NewColor(c color.NRGBA) Color {
+	return Color(fmt.Sprintf("%02x%02x%02x%02x", c.A, c.B, c.G, c.R))
+}
+
+// NRGBA parses the color.
+func (c Color) NRGBA() (color.NRGBA, error) {
+	v, err := strconv.ParseUint(string(c), 16, 32)
+	if err != nil || len(c) != 8 {
+		return color.NRGBA{}, fmt.Errorf("kml: invalid color %q", string(c))
+	}
+	return color.NRGBA{R: uint8(v), G: uint8(v >> 8), B: uint8(v >> 16), A: uint8(v >> 24)}, nil
+}
@@ -0,0 +1,213 @@
+package mst
+
+import (
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// BatchOptions controls Batch.
+type BatchOptions struct {
+	// MaxVertices caps the vertices of a merged node, 0 means no limit. The
+	// default keeps indices within uint16 for the glTF export.
+	MaxVertices int
+}
+
+var DefaultBatchOptions = BatchOptions{MaxVertices: maxShortVertices}
+
+// BatchStats reports the node counts before and after batching.
+type BatchStats struct {
+	Before int
+	After  int
+}
+
+func (s *BatchStats) add(o BatchStats) {
+	s.Before += o.Before
+	s.After += o.After
+}
+
+// batchKey tells nodes apart that can not share a glTF primitive.
+type batchKey struct {
+	batchid                    int
+	normal, uv, color, tangent bool
+}
+
+// batchCorner is a vertex of a source node with its normal and uv indices.
+type batchCorner struct {
+	node      int
+	v, vn, vt uint32
+}
+
+type batch[T float64 | float32] struct {
+	nd    *MeshNode[T]
+	index map[batchCorner]uint32
+}
+
+// Batch merges the nodes sharing a material into as few nodes as
+// MaxVertices allows. Node matrices are baked into the vertices, so merged
+// nodes have no Mat. Every vertex keeps the feature it came from in
+// FeatureIds: the index of its source node, or the source node's own
+// FeatureIds when it has them, so batching twice keeps the first features.
+// Nodes differing in the attributes they carry are kept apart.
+func (m *BaseMesh[T]) Batch(opts BatchOptions) BatchStats {
+	stats := BatchStats{Before: len(m.Nodes)}
+	var out []*MeshNode[T]
+	open := map[batchKey]*batch[T]{}
+
+	for ni, nd := range m.Nodes {
+		nv := len(nd.Vertices)
+		key := batchKey{
+			normal:  len(nd.Normals) > 0,
+			uv:      len(nd.TexCoords) > 0,
+			color:   len(nd.Colors) == nv && nv > 0,
+			tangent: len(nd.Tangents) == nv && nv > 0,
+		}
+		var tr *vertexTransform[T]
+		if nd.Mat != nil {
+			tr = newVertexTransform(nd.Mat)
+		}
+		hasFeature := len(nd.FeatureIds) == nv && nv > 0
+
+		add := func(b *batch[T], c batchCorner) uint32 {
+			if i, ok := b.index[c]; ok {
+				return i
+			}
+			dst := b.nd
+			i := uint32(len(dst.Vertices))
+			p := nd.Vertices[c.v]
+			if tr != nil {
+				p = tr.point(p)
+			}
+			dst.Vertices = append(dst.Vertices, p)
+			if key.normal {
+				var vn vec3.Vec[T]
+				if int(c.vn) < len(nd.Normals) {
+					vn = nd.Normals[c.vn]
+					if tr != nil {
+						vn = tr.normalVec(vn)
+					}
+				}
+				dst.Normals = append(dst.Normals, vn)
+			}
+			if key.uv {
+				var vt vec2.Vec[T]
+				if int(c.vt) < len(nd.TexCoords) {
+					vt = nd.TexCoords[c.vt]
+				}
+				dst.TexCoords = append(dst.TexCoords, vt)
+			}
+			if key.color {
+				dst.Colors = append(dst.Colors, nd.Colors[c.v])
+			}
+			if key.tangent {
+				tn := nd.Tangents[c.v]
+				if tr != nil {
+					tn = tr.tangent(tn)
+				}
+				dst.Tangents = append(dst.Tangents, tn)
+			}
+			fid := uint32(ni)
+			if hasFeature {
+				fid = nd.FeatureIds[c.v]
+			}
+			dst.FeatureIds = append(dst.FeatureIds, fid)
+			b.index[c] = i
+			return i
+		}
+		// target returns the open batch of k with room for the corners,
+		// starting a new one when it is full
+		target := func(k batchKey, cs []batchCorner) *batch[T] {
+			b := open[k]
+			if b != nil && opts.MaxVertices > 0 {
+				fresh := 0
+				for i, c := range cs {
+					if _, ok := b.index[c]; !ok && !dupCorner(cs[:i], c) {
+						fresh++
+					}
+				}
+				if len(b.nd.Vertices)+fresh > opts.MaxVertices {
+					b = nil
+				}
+			}
+			if b == nil {
+				b = &batch[T]{nd: &MeshNode[T]{}, index: map[batchCorner]uint32{}}
+				open[k] = b
+				out = append(out, b.nd)
+			}
+			return b
+		}
+		group := func(b *batch[T], batchid int) *MeshTriangle {
+			if len(b.nd.FaceGroup) == 0 {
+				b.nd.FaceGroup = []*MeshTriangle{{Batchid: batchid}}
+			}
+			return b.nd.FaceGroup[0]
+		}
+		outline := func(b *batch[T], batchid int) *MeshOutline {
+			if len(b.nd.EdgeGroup) == 0 {
+				b.nd.EdgeGroup = []*MeshOutline{{Batchid: batchid}}
+			}
+			return b.nd.EdgeGroup[0]
+		}
+
+		for _, g := range nd.FaceGroup {
+			k := key
+			k.batchid = g.Batchid
+			for _, f := range g.Faces {
+				var cs [3]batchCorner
+				for j := range 3 {
+					v := f.Vertex[j]
+					cs[j] = batchCorner{ni, v, v, v}
+					if f.Normal != nil {
+						cs[j].vn = f.Normal[j]
+					}
+					if f.Uv != nil {
+						cs[j].vt = f.Uv[j]
+					}
+				}
+				if tr != nil && tr.mirror {
+					cs[1], cs[2] = cs[2], cs[1]
+				}
+				b := target(k, cs[:])
+				var idx [3]uint32
+				for j, c := range cs {
+					idx[j] = add(b, c)
+				}
+				fg := group(b, g.Batchid)
+				fg.Faces = append(fg.Faces, &Face{Vertex: idx})
+			}
+		}
+		for _, g := range nd.EdgeGroup {
+			k := key
+			k.batchid = g.Batchid
+			for _, e := range g.Edges {
+				a, c := uint32(e[0]), uint32(e[1])
+				cs := []batchCorner{{ni, a, a, a}, {ni, c, c, c}}
+				b := target(k, cs)
+				eg := outline(b, g.Batchid)
+				eg.Edges = append(eg.Edges, [2]int{int(add(b, cs[0])), int(add(b, cs[1]))})
+			}
+		}
+	}
+	m.Nodes = out
+	stats.After = len(out)
+	return stats
+}
+
+func dupCorner(cs []batchCorner, c batchCorner) bool {
+	for _, o := range cs {
+		if o == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Batch batches the nodes of the mesh and, separately, of each instance.
+func (m *Mesh[T]) Batch(opts BatchOptions) BatchStats {
+	stats := m.BaseMesh.Batch(opts)
+	for _, inst := range m.InstanceNode {
+		if inst.Mesh != nil {
+			stats.add(inst.Mesh.Batch(opts))
+		}
+	}
+	return stats
+}
@@ -0,0 +1,118 @@
+package mst
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/qmuntal/gltf"
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+func batchMesh() *Mesh[float64] {
+	ms := NewMesh[float64]()
+	a, b, c := cubeNode(), cubeNode(), quadNode()
+	a.Mat = &mat4.Mat[float64]{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {10, 0, 0, 1}}
+	c.Normals, c.TexCoords = nil, nil
+	c.FaceGroup[0].Batchid = 1
+	c.EdgeGroup = []*MeshOutline{{Batchid: 1, Edges: [][2]int{{0, 4}}}}
+	ms.Nodes = append(ms.Nodes, a, b, c)
+	return ms
+}
+
+func TestBatch(t *testing.T) {
+	ms := batchMesh()
+	stats := ms.Batch(DefaultBatchOptions)
+	assert.Equal(t, BatchStats{Before: 3, After: 2}, stats)
+
+	nd := ms.Nodes[0]
+	assert.Nil(t, nd.Mat)
+	assert.Equal(t, 16, len(nd.Vertices))
+	assert.Equal(t, 24, len(nd.FaceGroup[0].Faces))
+	assert.Equal(t, vec3.Vec[float64]{10, 0, 0}, nd.Vertices[0])
+	assert.Equal(t, []uint32{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1}, nd.FeatureIds)
+
+	nd = ms.Nodes[1]
+	assert.Equal(t, 1, nd.FaceGroup[0].Batchid)
+	assert.Equal(t, 1, nd.EdgeGroup[0].Batchid)
+	assert.Equal(t, [][2]int{{0, 4}}, nd.EdgeGroup[0].Edges)
+	assert.Equal(t, vec3.Vec[float64]{2, 0, 0}, nd.Vertices[4])
+	for _, id := range nd.FeatureIds {
+		assert.Equal(t, uint32(2), id)
+	}
+
+	// batching again keeps the features and merges nothing new
+	assert.Equal(t, BatchStats{Before: 2, After: 2}, ms.Batch(DefaultBatchOptions))
+	assert.Equal(t, uint32(1), ms.Nodes[0].FeatureIds[15])
+
+	// the cubes do not fit one node of 10 vertices
+	ms = batchMesh()
+	assert.Equal(t, 3, ms.Batch(BatchOptions{MaxVertices: 10}).After)
+	for _, nd := range ms.Nodes {
+		assert.LessOrEqual(t, len(nd.Vertices), 10)
+	}
+	assert.Equal(t, 12, len(ms.Nodes[0].FaceGroup[0].Faces))
+
+	// a full batch still exports uint16 indices
+	nd = &MeshNode[float64]{Vertices: make([]vec3.Vec[float64], DefaultBatchOptions.MaxVertices)}
+	assert.True(t, shortIndices(nd))
+	nd.Vertices = append(nd.Vertices, vec3.Vec[float64]{})
+	assert.False(t, shortIndices(nd))
+}
+
+func TestBatchMirror(t *testing.T) {
+	ms := NewMesh[float64]()
+	nd := cubeNode()
+	nd.ComputeNormals(DefaultNormalOptions)
+	nd.Mat = &mat4.Mat[float64]{{-2, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}
+	ms.Nodes = append(ms.Nodes, nd)
+	ms.Batch(DefaultBatchOptions)
+
+	// faces keep facing outwards, along their baked normals
+	nd = ms.Nodes[0]
+	center := vec3.Vec[float64]{-1, 0.5, 0.5}
+	for _, f := range nd.FaceGroup[0].Faces {
+		a, b, c := nd.Vertices[f.Vertex[0]], nd.Vertices[f.Vertex[1]], nd.Vertices[f.Vertex[2]]
+		e1, e2 := vec3.Sub(&b, &a), vec3.Sub(&c, &a)
+		fn := vec3.Cross(&e1, &e2)
+		out := vec3.Sub(&a, &center)
+		assert.Greater(t, vec3.Dot(&fn, &out), 0.0)
+		vn := nd.Normals[f.Vertex[0]]
+		assert.Greater(t, vec3.Dot(&fn, &vn), 0.0)
+		assert.InDelta(t, 1, vn.Length(), 1e-9)
+	}
+}
+
+func TestBatchExport(t *testing.T) {
+	ms := batchMesh()
+	ms.Nodes[2].EdgeGroup = nil
+	ms.Batch(DefaultBatchOptions)
+
+	var buf bytes.Buffer
+	MeshMarshal(&buf, ms)
+	got := MeshUnMarshal[float64](&buf)
+	assert.Equal(t, ms.Nodes[0].FeatureIds, got.Nodes[0].FeatureIds)
+	assert.Equal(t, ms.Nodes[1].FeatureIds, got.Nodes[1].FeatureIds)
+
+	// V5 files keep their layout without feature ids
+	v5 := *ms
+	v5.Version = V5
+	buf.Reset()
+	MeshMarshal(&buf, &v5)
+	got = MeshUnMarshal[float64](&buf)
+	assert.Empty(t, got.Nodes[0].FeatureIds)
+	assert.Equal(t, ms.Nodes[1].Vertices, got.Nodes[1].Vertices)
+
+	doc := CreateDoc()
+	assert.Nil(t, BuildGltf(doc, ms, false, true))
+	assert.Contains(t, doc.ExtensionsUsed, EXT_MESH_FEATURES)
+	ps := doc.Meshes[0].Primitives[0]
+	assert.Equal(t, gltf.ComponentUshort, doc.Accessors[*ps.Indices].ComponentType)
+	assert.Equal(t, 16, doc.Accessors[ps.Attributes["_FEATURE_ID_0"]].Count)
+	for _, bv := range doc.BufferViews[1:] {
+		assert.Zero(t, bv.ByteOffset%4)
+	}
+	_, err := GetGltfBinary(doc, 8)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,690 @@
+package mst
+
+import (
+	"math"
+
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// BVHOptions controls the building of a MeshBVH.
+type BVHOptions struct {
+	// LeafSize is the number of triangles below which nodes are not split.
+	LeafSize int
+}
+
+var DefaultBVHOptions = BVHOptions{LeafSize: 4}
+
+// bvhBins is the number of buckets the surface area heuristic tries splits
+// between.
+const bvhBins = 16
+
+type bvhNode struct {
+	box   vec3.Box[float64]
+	first int32 // first child, or first primitive of a leaf
+	count int32 // primitives of a leaf, 0 for inner nodes
+}
+
+// bvhTree is a bounding volume hierarchy over primitives given by their
+// boxes. The children of an inner node are stored next to each other.
+type bvhTree struct {
+	nodes []bvhNode
+	prims []int32
+}
+
+// joinBox grows a to contain b, cheaper than Box.Join in the build loops.
+func joinBox(a, b *vec3.Box[float64]) {
+	for k := range 3 {
+		a.Min[k], a.Max[k] = min(a.Min[k], b.Min[k]), max(a.Max[k], b.Max[k])
+	}
+}
+
+func boxArea(b *vec3.Box[float64]) float64 {
+	d := b.Diagonal()
+	return 2 * (d[0]*d[1] + d[1]*d[2] + d[2]*d[0])
+}
+
+func buildBVH(boxes []vec3.Box[float64], leafSize int) *bvhTree {
+	t := &bvhTree{prims: make([]int32, len(boxes))}
+	if len(boxes) == 0 {
+		return t
+	}
+	centers := make([]vec3.Vec[float64], len(boxes))
+	for i := range boxes {
+		t.prims[i] = int32(i)
+		centers[i] = boxes[i].Center()
+	}
+	t.nodes = make([]bvhNode, 1, 2*len(boxes)/max(leafSize, 1)+1)
+	t.split(0, 0, len(boxes), boxes, centers, max(leafSize, 1))
+	return t
+}
+
+// split fills node ni with the primitives lo to hi, dividing them where the
+// surface area heuristic finds it cheapest.
+func (t *bvhTree) split(ni, lo, hi int, boxes []vec3.Box[float64], centers []vec3.Vec[float64], leafSize int) {
+	box, cb := vec3.MinBox, vec3.MinBox
+	for _, p := range t.prims[lo:hi] {
+		joinBox(&box, &boxes[p])
+		c := vec3.Box[float64]{Min: centers[p], Max: centers[p]}
+		joinBox(&cb, &c)
+	}
+	t.nodes[ni].box = box
+	n := hi - lo
+	leaf := func() {
+		t.nodes[ni].first, t.nodes[ni].count = int32(lo), int32(n)
+	}
+	if n <= leafSize {
+		leaf()
+		return
+	}
+
+	type bin struct {
+		box vec3.Box[float64]
+		n   int
+	}
+	binOf := func(axis int, c *vec3.Vec[float64]) int {
+		b := int((c[axis] - cb.Min[axis]) / (cb.Max[axis] - cb.Min[axis]) * bvhBins)
+		return min(max(b, 0), bvhBins-1)
+	}
+	bestCost, bestAxis, bestBin := math.MaxFloat64, -1, 0
+	for axis := range 3 {
+		if cb.Max[axis] <= cb.Min[axis] {
+			continue
+		}
+		var bins [bvhBins]bin
+		for i := range bins {
+			bins[i].box = vec3.MinBox
+		}
+		for _, p := range t.prims[lo:hi] {
+			b := &bins[binOf(axis, &centers[p])]
+			joinBox(&b.box, &boxes[p])
+			b.n++
+		}
+		var rightArea [bvhBins]float64
+		var rightN [bvhBins]int
+		acc, cnt := vec3.MinBox, 0
+		for i := bvhBins - 1; i > 0; i-- {
+			joinBox(&acc, &bins[i].box)
+			cnt += bins[i].n
+			rightArea[i], rightN[i] = boxArea(&acc), cnt
+		}
+		acc, cnt = vec3.MinBox, 0
+		for i := 0; i < bvhBins-1; i++ {
+			joinBox(&acc, &bins[i].box)
+			cnt += bins[i].n
+			if cnt == 0 || rightN[i+1] == 0 {
+				continue
+			}
+			if cost := boxArea(&acc)*float64(cnt) + rightArea[i+1]*float64(rightN[i+1]); cost < bestCost {
+				bestCost, bestAxis, bestBin = cost, axis, i
+			}
+		}
+	}
+	// a split has to save more than the traversal step it adds, but large
+	// leaves are split anyway
+	if bestAxis < 0 || bestCost >= float64(n-1)*boxArea(&box) && n <= 8*leafSize {
+		leaf()
+		return
+	}
+	mid := lo
+	for i := lo; i < hi; i++ {
+		if binOf(bestAxis, &centers[t.prims[i]]) <= bestBin {
+			t.prims[i], t.prims[mid] = t.prims[mid], t.prims[i]
+			mid++
+		}
+	}
+	first := len(t.nodes)
+	t.nodes = append(t.nodes, bvhNode{}, bvhNode{})
+	t.nodes[ni].first = int32(first)
+	t.split(first, lo, mid, boxes, centers, leafSize)
+	t.split(first+1, mid, hi, boxes, centers, leafSize)
+}
+
+// slab returns where the ray enters the box, if it does before tmax.
+func slab(b *vec3.Box[float64], o, inv *vec3.Vec[float64], tmax float64) (float64, bool) {
+	t0, t1 := 0.0, tmax
+	for k := range 3 {
+		a, c := (b.Min[k]-o[k])*inv[k], (b.Max[k]-o[k])*inv[k]
+		if a > c {
+			a, c = c, a
+		}
+		// NaN from rays in the plane of a side is ignored
+		if a > t0 {
+			t0 = a
+		}
+		if c < t1 {
+			t1 = c
+		}
+		if t0 > t1 {
+			return 0, false
+		}
+	}
+	return t0, true
+}
+
+// raycast visits the leaves the ray passes before *tmax, nearest first.
+// hit may shorten *tmax.
+func (t *bvhTree) raycast(o, d *vec3.Vec[float64], tmax *float64, hit func(prim int32)) {
+	if len(t.nodes) == 0 {
+		return
+	}
+	inv := vec3.Vec[float64]{1 / d[0], 1 / d[1], 1 / d[2]}
+	stack := []int32{0}
+	for len(stack) > 0 {
+		nd := &t.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if _, ok := slab(&nd.box, o, &inv, *tmax); !ok {
+			continue
+		}
+		if nd.count > 0 {
+			for _, p := range t.prims[nd.first : nd.first+nd.count] {
+				hit(p)
+			}
+			continue
+		}
+		l, r := nd.first, nd.first+1
+		tl, okl := slab(&t.nodes[l].box, o, &inv, *tmax)
+		tr, okr := slab(&t.nodes[r].box, o, &inv, *tmax)
+		if okl && okr && tr < tl {
+			l, r, okl, okr = r, l, okr, okl
+		}
+		if okr {
+			stack = append(stack, r)
+		}
+		if okl {
+			stack = append(stack, l)
+		}
+	}
+}
+
+// visit calls leaf for the primitives under the nodes passing test.
+func (t *bvhTree) visit(test func(b *vec3.Box[float64]) bool, leaf func(prim int32)) {
+	if len(t.nodes) == 0 {
+		return
+	}
+	stack := []int32{0}
+	for len(stack) > 0 {
+		nd := &t.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if !test(&nd.box) {
+			continue
+		}
+		if nd.count > 0 {
+			for _, p := range t.prims[nd.first : nd.first+nd.count] {
+				leaf(p)
+			}
+			continue
+		}
+		stack = append(stack, nd.first, nd.first+1)
+	}
+}
+
+// nearest visits the leaves closer than *best, nearest first, by the
+// squared distances dist gives to node boxes. visit may lower *best.
+func (t *bvhTree) nearest(dist func(b *vec3.Box[float64]) float64, best *float64, visit func(prim int32)) {
+	if len(t.nodes) == 0 {
+		return
+	}
+	var walk func(ni int32, d float64)
+	walk = func(ni int32, d float64) {
+		nd := &t.nodes[ni]
+		if d >= *best {
+			return
+		}
+		if nd.count > 0 {
+			for _, p := range t.prims[nd.first : nd.first+nd.count] {
+				visit(p)
+			}
+			return
+		}
+		l, r := nd.first, nd.first+1
+		dl, dr := dist(&t.nodes[l].box), dist(&t.nodes[r].box)
+		if dr < dl {
+			l, r, dl, dr = r, l, dr, dl
+		}
+		walk(l, dl)
+		walk(r, dr)
+	}
+	walk(0, dist(&t.nodes[0].box))
+}
+
+// TriangleRef identifies a face of a mesh.
+type TriangleRef struct {
+	Instance int // index into InstanceNode, -1 for the nodes of the mesh
+	Copy     int // index into the transforms of the instance
+	Node     int
+	Group    int // index into FaceGroup
+	Face     int
+	Batchid  int // into the materials of the mesh holding the face
+}
+
+// RayHit is the nearest face a ray hits.
+type RayHit struct {
+	TriangleRef
+	T     float64 // along the ray, in lengths of its direction
+	U, V  float64 // barycentric weights of the second and third vertex
+	Point vec3.Vec[float64]
+}
+
+// NearestHit is the face closest to a point.
+type NearestHit struct {
+	TriangleRef
+	Distance float64
+	U, V     float64
+	Point    vec3.Vec[float64]
+}
+
+type bvhTriangle struct {
+	p                          [3]vec3.Vec[float64]
+	node, group, face, batchid int32
+}
+
+func (tri *bvhTriangle) ref(inst, cp int) TriangleRef {
+	return TriangleRef{Instance: inst, Copy: cp, Node: int(tri.node), Group: int(tri.group), Face: int(tri.face), Batchid: int(tri.batchid)}
+}
+
+// bvhMesh holds the triangles of a BaseMesh with the node matrices baked.
+// The triangles of the mesh itself go into the top level tree instead of
+// a tree of their own.
+type bvhMesh struct {
+	tris []bvhTriangle
+	tree *bvhTree
+}
+
+func newBVHMesh[T float64 | float32](bm *BaseMesh[T]) *bvhMesh {
+	m := &bvhMesh{}
+	for ni, nd := range bm.Nodes {
+		var tr *vertexTransform[T]
+		if nd.Mat != nil {
+			tr = newVertexTransform(nd.Mat)
+		}
+		for gi, g := range nd.FaceGroup {
+			for fi, f := range g.Faces {
+				tri := bvhTriangle{node: int32(ni), group: int32(gi), face: int32(fi), batchid: int32(g.Batchid)}
+				for k := range 3 {
+					v := nd.Vertices[f.Vertex[k]]
+					if tr != nil {
+						v = tr.point(v)
+					}
+					tri.p[k] = vec3.Vec[float64]{float64(v[0]), float64(v[1]), float64(v[2])}
+				}
+				m.tris = append(m.tris, tri)
+			}
+		}
+	}
+	return m
+}
+
+func (m *bvhMesh) boxes() []vec3.Box[float64] {
+	boxes := make([]vec3.Box[float64], len(m.tris))
+	for i := range m.tris {
+		boxes[i] = triangleBox(&m.tris[i].p)
+	}
+	return boxes
+}
+
+func triangleBox(p *[3]vec3.Vec[float64]) vec3.Box[float64] {
+	b := vec3.Box[float64]{Min: p[0], Max: p[0]}
+	b.Extend(&p[1])
+	b.Extend(&p[2])
+	return b
+}
+
+func transformBox(mt *mat4.Mat[float64], b *vec3.Box[float64]) vec3.Box[float64] {
+	r := vec3.MinBox
+	for k := range 8 {
+		c := b.Min
+		for j := range 3 {
+			if k>>j&1 != 0 {
+				c[j] = b.Max[j]
+			}
+		}
+		mt.TransformVec3(&c)
+		r.Extend(&c)
+	}
+	return r
+}
+
+// affineInverse inverts a matrix without projection.
+func affineInverse(m *mat4.Mat[float64]) mat4.Mat[float64] {
+	a := func(r, c int) float64 { return m[c][r] }
+	var cof [3][3]float64
+	det := 0.0
+	for r := range 3 {
+		for c := range 3 {
+			r1, r2 := (r+1)%3, (r+2)%3
+			c1, c2 := (c+1)%3, (c+2)%3
+			cof[r][c] = a(r1, c1)*a(r2, c2) - a(r1, c2)*a(r2, c1)
+		}
+		det += a(0, r) * cof[0][r]
+	}
+	var inv mat4.Mat[float64]
+	for r := range 3 {
+		for c := range 3 {
+			inv[c][r] = cof[c][r] / det
+		}
+	}
+	for r := range 3 {
+		for c := range 3 {
+			inv[3][r] -= inv[c][r] * m[3][c]
+		}
+	}
+	inv[3][3] = 1
+	return inv
+}
+
+// bvhCopy is a placed copy of an instance mesh.
+type bvhCopy struct {
+	inst, cp int
+	mesh     *bvhMesh
+	mat, inv mat4.Mat[float64]
+}
+
+func (c *bvhCopy) world(tri *bvhTriangle) [3]vec3.Vec[float64] {
+	var p [3]vec3.Vec[float64]
+	for k := range 3 {
+		p[k] = c.mat.MulVec3(&tri.p[k])
+	}
+	return p
+}
+
+// MeshBVH is a bounding volume hierarchy over the faces of a mesh. Placed
+// instances are leaves bounded by their transformed boxes, each instance
+// mesh having a hierarchy of its own.
+type MeshBVH struct {
+	base   *bvhMesh
+	copies []bvhCopy
+	top    *bvhTree
+}
+
+// NewMeshBVH indexes the faces of m, built by the surface area heuristic.
+// The mesh must not change while the index is in use.
+func NewMeshBVH[T float64 | float32](m *Mesh[T], opts BVHOptions) *MeshBVH {
+	b := &MeshBVH{base: newBVHMesh(&m.BaseMesh)}
+	boxes := b.base.boxes()
+	for ii, inst := range m.InstanceNode {
+		if inst.Mesh == nil {
+			continue
+		}
+		sub := newBVHMesh(inst.Mesh)
+		if len(sub.tris) == 0 {
+			continue
+		}
+		sub.tree = buildBVH(sub.boxes(), opts.LeafSize)
+		for ci, tf := range inst.Transfors {
+			c := bvhCopy{inst: ii, cp: ci, mesh: sub}
+			for i := range 4 {
+				for j := range 4 {
+					c.mat[i][j] = float64(tf[i][j])
+				}
+			}
+			c.inv = affineInverse(&c.mat)
+			b.copies = append(b.copies, c)
+			boxes = append(boxes, transformBox(&c.mat, &sub.tree.nodes[0].box))
+		}
+	}
+	b.top = buildBVH(boxes, opts.LeafSize)
+	return b
+}
+
+// Bounds returns the box around all faces.
+func (b *MeshBVH) Bounds() vec3.Box[float64] {
+	if len(b.top.nodes) == 0 {
+		return vec3.Box[float64]{}
+	}
+	return b.top.nodes[0].box
+}
+
+func rayTriangle(o, d *vec3.Vec[float64], p *[3]vec3.Vec[float64]) (t, u, v float64, ok bool) {
+	e1, e2 := vec3.Sub(&p[1], &p[0]), vec3.Sub(&p[2], &p[0])
+	pv := vec3.Cross(d, &e2)
+	det := vec3.Dot(&e1, &pv)
+	if det == 0 {
+		return 0, 0, 0, false
+	}
+	inv := 1 / det
+	tv := vec3.Sub(o, &p[0])
+	if u = vec3.Dot(&tv, &pv) * inv; u < 0 || u > 1 {
+		return 0, 0, 0, false
+	}
+	qv := vec3.Cross(&tv, &e1)
+	if v = vec3.Dot(d, &qv) * inv; v < 0 || u+v > 1 {
+		return 0, 0, 0, false
+	}
+	return vec3.Dot(&e2, &qv) * inv, u, v, true
+}
+
+// Raycast returns the first face hit by the ray from o along d, both sides
+// of faces counting, within maxT lengths of d.
+func (b *MeshBVH) Raycast(o, d vec3.Vec[float64], maxT float64) (RayHit, bool) {
+	var hit RayHit
+	found := false
+	tmax := maxT
+	test := func(tri *bvhTriangle, o, d *vec3.Vec[float64], inst, cp int) {
+		if t, u, v, ok := rayTriangle(o, d, &tri.p); ok && t >= 0 && t <= tmax {
+			tmax, found = t, true
+			hit = RayHit{TriangleRef: tri.ref(inst, cp), T: t, U: u, V: v}
+		}
+	}
+	b.top.raycast(&o, &d, &tmax, func(p int32) {
+		if int(p) < len(b.base.tris) {
+			test(&b.base.tris[p], &o, &d, -1, -1)
+			return
+		}
+		// the ray parameter is the same in the space of the copy
+		c := &b.copies[int(p)-len(b.base.tris)]
+		lo, ld := c.inv.MulVec3(&o), c.inv.MulVec3W(&d, 0)
+		c.mesh.tree.raycast(&lo, &ld, &tmax, func(q int32) {
+			test(&c.mesh.tris[q], &lo, &ld, c.inst, c.cp)
+		})
+	})
+	if found {
+		hit.Point = vec3.Vec[float64]{o[0] + hit.T*d[0], o[1] + hit.T*d[1], o[2] + hit.T*d[2]}
+	}
+	return hit, found
+}
+
+// triangleBoxOverlap tests a triangle against a box on the separating axes
+// of Akenine-Möller.
+func triangleBoxOverlap(p *[3]vec3.Vec[float64], box *vec3.Box[float64]) bool {
+	c := box.Center()
+	h := box.Diagonal()
+	h.Scale(0.5)
+	var v [3]vec3.Vec[float64]
+	for k := range 3 {
+		v[k] = vec3.Sub(&p[k], &c)
+	}
+	separated := func(a *vec3.Vec[float64]) bool {
+		p0, p1, p2 := vec3.Dot(a, &v[0]), vec3.Dot(a, &v[1]), vec3.Dot(a, &v[2])
+		r := h[0]*math.Abs(a[0]) + h[1]*math.Abs(a[1]) + h[2]*math.Abs(a[2])
+		return min(p0, p1, p2) > r || max(p0, p1, p2) < -r
+	}
+	for k := range 3 {
+		if min(v[0][k], v[1][k], v[2][k]) > h[k] || max(v[0][k], v[1][k], v[2][k]) < -h[k] {
+			return false
+		}
+	}
+	var e [3]vec3.Vec[float64]
+	for k := range 3 {
+		e[k] = vec3.Sub(&v[(k+1)%3], &v[k])
+	}
+	n := vec3.Cross(&e[0], &e[1])
+	if separated(&n) {
+		return false
+	}
+	for k := range 3 {
+		var axis vec3.Vec[float64]
+		axis[k] = 1
+		for j := range 3 {
+			if a := vec3.Cross(&axis, &e[j]); separated(&a) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// QueryBox returns the faces overlapping box.
+func (b *MeshBVH) QueryBox(box vec3.Box[float64]) []TriangleRef {
+	var refs []TriangleRef
+	b.top.visit(func(nb *vec3.Box[float64]) bool { return nb.Intersects(&box) }, func(p int32) {
+		if int(p) < len(b.base.tris) {
+			if tri := &b.base.tris[p]; triangleBoxOverlap(&tri.p, &box) {
+				refs = append(refs, tri.ref(-1, -1))
+			}
+			return
+		}
+		c := &b.copies[int(p)-len(b.base.tris)]
+		c.mesh.tree.visit(func(nb *vec3.Box[float64]) bool {
+			wb := transformBox(&c.mat, nb)
+			return wb.Intersects(&box)
+		}, func(q int32) {
+			tri := &c.mesh.tris[q]
+			if w := c.world(tri); triangleBoxOverlap(&w, &box) {
+				refs = append(refs, tri.ref(c.inst, c.cp))
+			}
+		})
+	})
+	return refs
+}
+
+func boxOutside(b *vec3.Box[float64], planes []ClipPlane) bool {
+	for i := range planes {
+		// the corner furthest along the normal
+		var c vec3.Vec[float64]
+		for k := range 3 {
+			if planes[i].Normal[k] >= 0 {
+				c[k] = b.Max[k]
+			} else {
+				c[k] = b.Min[k]
+			}
+		}
+		if planes[i].Distance(&c) < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func triangleOutside(p *[3]vec3.Vec[float64], planes []ClipPlane) bool {
+	for i := range planes {
+		if planes[i].Distance(&p[0]) < 0 && planes[i].Distance(&p[1]) < 0 && planes[i].Distance(&p[2]) < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryFrustum returns the faces not completely outside one of planes,
+// each keeping its positive side. Faces near the edges of the frustum may
+// be returned without touching it.
+func (b *MeshBVH) QueryFrustum(planes []ClipPlane) []TriangleRef {
+	var refs []TriangleRef
+	b.top.visit(func(nb *vec3.Box[float64]) bool { return !boxOutside(nb, planes) }, func(p int32) {
+		if int(p) < len(b.base.tris) {
+			if tri := &b.base.tris[p]; !triangleOutside(&tri.p, planes) {
+				refs = append(refs, tri.ref(-1, -1))
+			}
+			return
+		}
+		c := &b.copies[int(p)-len(b.base.tris)]
+		c.mesh.tree.visit(func(nb *vec3.Box[float64]) bool {
+			wb := transformBox(&c.mat, nb)
+			return !boxOutside(&wb, planes)
+		}, func(q int32) {
+			tri := &c.mesh.tris[q]
+			if w := c.world(tri); !triangleOutside(&w, planes) {
+				refs = append(refs, tri.ref(c.inst, c.cp))
+			}
+		})
+	})
+	return refs
+}
+
+func boxDistance2(b *vec3.Box[float64], p *vec3.Vec[float64]) float64 {
+	d := 0.0
+	for k := range 3 {
+		if e := max(b.Min[k]-p[k], p[k]-b.Max[k], 0); e > 0 {
+			d += e * e
+		}
+	}
+	return d
+}
+
+// closestOnTriangle returns the point of the triangle closest to p with its
+// barycentric weights of the second and third vertex, after Ericson.
+func closestOnTriangle(p *vec3.Vec[float64], t *[3]vec3.Vec[float64]) (q vec3.Vec[float64], u, v float64) {
+	a, b, c := &t[0], &t[1], &t[2]
+	at := func(u, v float64) vec3.Vec[float64] {
+		var r vec3.Vec[float64]
+		for k := range 3 {
+			r[k] = a[k] + u*(b[k]-a[k]) + v*(c[k]-a[k])
+		}
+		return r
+	}
+	ab, ac, ap := vec3.Sub(b, a), vec3.Sub(c, a), vec3.Sub(p, a)
+	d1, d2 := vec3.Dot(&ab, &ap), vec3.Dot(&ac, &ap)
+	if d1 <= 0 && d2 <= 0 {
+		return *a, 0, 0
+	}
+	bp := vec3.Sub(p, b)
+	d3, d4 := vec3.Dot(&ab, &bp), vec3.Dot(&ac, &bp)
+	if d3 >= 0 && d4 <= d3 {
+		return *b, 1, 0
+	}
+	if vc := d1*d4 - d3*d2; vc <= 0 && d1 >= 0 && d3 <= 0 {
+		w := d1 / (d1 - d3)
+		return at(w, 0), w, 0
+	}
+	cp := vec3.Sub(p, c)
+	d5, d6 := vec3.Dot(&ab, &cp), vec3.Dot(&ac, &cp)
+	if d6 >= 0 && d5 <= d6 {
+		return *c, 0, 1
+	}
+	if vb := d5*d2 - d1*d6; vb <= 0 && d2 >= 0 && d6 <= 0 {
+		w := d2 / (d2 - d6)
+		return at(0, w), 0, w
+	}
+	if va := d3*d6 - d5*d4; va <= 0 && d4-d3 >= 0 && d5-d6 >= 0 {
+		w := (d4 - d3) / ((d4 - d3) + (d5 - d6))
+		return at(1-w, w), 1 - w, w
+	}
+	va, vb, vc := d3*d6-d5*d4, d5*d2-d1*d6, d1*d4-d3*d2
+	s := 1 / (va + vb + vc)
+	return at(vb*s, vc*s), vb * s, vc * s
+}
+
+// Nearest returns the face closest to p within maxDist.
+func (b *MeshBVH) Nearest(p vec3.Vec[float64], maxDist float64) (NearestHit, bool) {
+	var hit NearestHit
+	found := false
+	best := maxDist * maxDist
+	test := func(tri *bvhTriangle, w *[3]vec3.Vec[float64], inst, cp int) {
+		q, u, v := closestOnTriangle(&p, w)
+		d := vec3.Sub(&q, &p)
+		if l := d.LengthSqr(); l < best || (!found && l <= best) {
+			best, found = l, true
+			hit = NearestHit{TriangleRef: tri.ref(inst, cp), U: u, V: v, Point: q}
+		}
+	}
+	b.top.nearest(func(nb *vec3.Box[float64]) float64 { return boxDistance2(nb, &p) }, &best, func(i int32) {
+		if int(i) < len(b.base.tris) {
+			tri := &b.base.tris[i]
+			test(tri, &tri.p, -1, -1)
+			return
+		}
+		c := &b.copies[int(i)-len(b.base.tris)]
+		c.mesh.tree.nearest(func(nb *vec3.Box[float64]) float64 {
+			wb := transformBox(&c.mat, nb)
+			return boxDistance2(&wb, &p)
+		}, &best, func(q int32) {
+			tri := &c.mesh.tris[q]
+			w := c.world(tri)
+			test(tri, &w, c.inst, c.cp)
+		})
+	})
+	if found {
+		hit.Distance = math.Sqrt(best)
+	}
+	return hit, found
+}
@@ -0,0 +1,207 @@
+package mst
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// worldTriangles returns the faces of a mesh with the instances flattened
+// and the matrices baked.
+func worldTriangles(ms *Mesh[float64]) [][3]vec3.Vec[float64] {
+	ms.FlattenInstances()
+	ms.BakeNodeMatrices()
+	var tris [][3]vec3.Vec[float64]
+	for _, nd := range ms.Nodes {
+		tris = append(tris, facePositions(nd)...)
+	}
+	return tris
+}
+
+// terrainNode returns a wavy grid of n by n cells.
+func terrainNode(n int) *MeshNode[float64] {
+	nd := &MeshNode[float64]{FaceGroup: []*MeshTriangle{{}}}
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			nd.Vertices = append(nd.Vertices, vec3.Vec[float64]{float64(x), float64(y), math.Sin(float64(x)/7) * math.Cos(float64(y)/5) * 4})
+		}
+	}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			a := uint32(y*(n+1) + x)
+			b, c, d := a+1, a+uint32(n+1), a+uint32(n+2)
+			nd.FaceGroup[0].Faces = append(nd.FaceGroup[0].Faces, &Face{Vertex: [3]uint32{a, b, d}}, &Face{Vertex: [3]uint32{a, d, c}})
+		}
+	}
+	return nd
+}
+
+func bvhMeshes() (*Mesh[float64], [][3]vec3.Vec[float64]) {
+	ms := instanceMesh()
+	ms.Instance(DefaultInstanceOptions)
+	flat := instanceMesh()
+	flat.Instance(DefaultInstanceOptions)
+	return ms, worldTriangles(flat)
+}
+
+func randomVec(rng *rand.Rand, lo, hi float64) vec3.Vec[float64] {
+	return vec3.Vec[float64]{lo + rng.Float64()*(hi-lo), lo + rng.Float64()*(hi-lo), lo + rng.Float64()*(hi-lo)}
+}
+
+func TestMeshBVHRaycast(t *testing.T) {
+	ms, tris := bvhMeshes()
+	b := NewMeshBVH(ms, DefaultBVHOptions)
+	assert.InDelta(t, 9.0, b.Bounds().Max[0], 1e-9)
+
+	hit, ok := b.Raycast(vec3.Vec[float64]{0.5, 0.5, 10}, vec3.Vec[float64]{0, 0, -2}, math.Inf(1))
+	assert.True(t, ok)
+	assert.Equal(t, TriangleRef{Instance: 0, Copy: 0, Node: 0, Group: 0, Face: hit.Face, Batchid: 0}, hit.TriangleRef)
+	assert.InDelta(t, 4.5, hit.T, 1e-9)
+	for k, v := range []float64{0.5, 0.5, 1} {
+		assert.InDelta(t, v, hit.Point[k], 1e-9)
+	}
+	// the quad is a node of the mesh
+	hit, ok = b.Raycast(vec3.Vec[float64]{1.5, 0.5, 0.5}, vec3.Vec[float64]{0, 0, -1}, math.Inf(1))
+	assert.True(t, ok)
+	assert.Equal(t, -1, hit.Instance)
+	assert.Equal(t, 0, hit.Node)
+	assert.Equal(t, 0, hit.Batchid)
+	_, ok = b.Raycast(vec3.Vec[float64]{0.5, 0.5, 10}, vec3.Vec[float64]{0, 0, 1}, math.Inf(1))
+	assert.False(t, ok)
+	_, ok = b.Raycast(vec3.Vec[float64]{0.5, 0.5, 10}, vec3.Vec[float64]{0, 0, -1}, 8)
+	assert.False(t, ok)
+
+	rng := rand.New(rand.NewSource(1))
+	for range 500 {
+		o, to := randomVec(rng, -12, 20), randomVec(rng, -4, 10)
+		d := vec3.Sub(&to, &o)
+		want := math.Inf(1)
+		for i := range tris {
+			if tt, _, _, ok := rayTriangle(&o, &d, &tris[i]); ok && tt >= 0 && tt < want {
+				want = tt
+			}
+		}
+		hit, ok := b.Raycast(o, d, math.Inf(1))
+		assert.Equal(t, !math.IsInf(want, 1), ok)
+		if ok {
+			assert.InDelta(t, want, hit.T, 1e-9)
+		}
+	}
+}
+
+func TestMeshBVHQueries(t *testing.T) {
+	ms, tris := bvhMeshes()
+	b := NewMeshBVH(ms, BVHOptions{LeafSize: 1})
+
+	rng := rand.New(rand.NewSource(2))
+	for range 100 {
+		c := randomVec(rng, -4, 10)
+		box := vec3.Box[float64]{Min: c, Max: vec3.Vec[float64]{c[0] + rng.Float64()*3, c[1] + rng.Float64()*3, c[2] + rng.Float64()*3}}
+		want := 0
+		for i := range tris {
+			if triangleBoxOverlap(&tris[i], &box) {
+				want++
+			}
+		}
+		refs := b.QueryBox(box)
+		assert.Equal(t, want, len(refs))
+
+		// a frustum of the box sides finds at least the same faces
+		inFrustum := map[TriangleRef]bool{}
+		for _, r := range b.QueryFrustum(BoxRegion(box).planes) {
+			inFrustum[r] = true
+		}
+		for _, r := range refs {
+			assert.True(t, inFrustum[r])
+		}
+
+		p := randomVec(rng, -6, 12)
+		best := math.Inf(1)
+		for i := range tris {
+			q, _, _ := closestOnTriangle(&p, &tris[i])
+			d := vec3.Sub(&q, &p)
+			best = min(best, d.Length())
+		}
+		hit, ok := b.Nearest(p, math.Inf(1))
+		assert.True(t, ok)
+		assert.InDelta(t, best, hit.Distance, 1e-9)
+		_, ok = b.Nearest(p, best*0.99)
+		assert.False(t, ok)
+	}
+
+	b = NewMeshBVH(NewMesh[float64](), DefaultBVHOptions)
+	_, ok := b.Raycast(vec3.Vec[float64]{}, vec3.Vec[float64]{0, 0, 1}, math.Inf(1))
+	assert.False(t, ok)
+	_, ok = b.Nearest(vec3.Vec[float64]{}, math.Inf(1))
+	assert.False(t, ok)
+	assert.Empty(t, b.QueryBox(vec3.Box[float64]{Max: vec3.Vec[float64]{1, 1, 1}}))
+}
+
+func TestClosestOnTriangle(t *testing.T) {
+	tri := [3]vec3.Vec[float64]{{0, 0, 0}, {2, 0, 0}, {0, 2, 0}}
+	tests := []struct {
+		p, want vec3.Vec[float64]
+		u, v    float64
+	}{
+		{vec3.Vec[float64]{0.5, 0.5, 3}, vec3.Vec[float64]{0.5, 0.5, 0}, 0.25, 0.25},
+		{vec3.Vec[float64]{-1, -1, 0}, vec3.Vec[float64]{0, 0, 0}, 0, 0},
+		{vec3.Vec[float64]{3, -1, 0}, vec3.Vec[float64]{2, 0, 0}, 1, 0},
+		{vec3.Vec[float64]{1, -1, 1}, vec3.Vec[float64]{1, 0, 0}, 0.5, 0},
+		{vec3.Vec[float64]{2, 2, 0}, vec3.Vec[float64]{1, 1, 0}, 0.5, 0.5},
+		{vec3.Vec[float64]{-1, 1, 0}, vec3.Vec[float64]{0, 1, 0}, 0, 0.5},
+	}
+	for _, tt := range tests {
+		q, u, v := closestOnTriangle(&tt.p, &tri)
+		assert.Equal(t, tt.want, q)
+		assert.Equal(t, tt.u, u)
+		assert.Equal(t, tt.v, v)
+	}
+}
+
+func terrainBVH(b *testing.B) *MeshBVH {
+	ms := NewMesh[float64]()
+	ms.Nodes = append(ms.Nodes, terrainNode(256))
+	b.ResetTimer()
+	return NewMeshBVH(ms, DefaultBVHOptions)
+}
+
+func BenchmarkNewMeshBVH(b *testing.B) {
+	ms := NewMesh[float64]()
+	ms.Nodes = append(ms.Nodes, terrainNode(256))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewMeshBVH(ms, DefaultBVHOptions)
+	}
+}
+
+func BenchmarkRaycast(b *testing.B) {
+	bvh := terrainBVH(b)
+	rng := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		o := vec3.Vec[float64]{rng.Float64() * 256, rng.Float64() * 256, 50}
+		bvh.Raycast(o, vec3.Vec[float64]{rng.Float64() - 0.5, rng.Float64() - 0.5, -1}, math.Inf(1))
+	}
+}
+
+func BenchmarkNearest(b *testing.B) {
+	bvh := terrainBVH(b)
+	rng := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bvh.Nearest(vec3.Vec[float64]{rng.Float64() * 256, rng.Float64() * 256, rng.Float64() * 20}, math.Inf(1))
+	}
+}
+
+func BenchmarkQueryBox(b *testing.B) {
+	bvh := terrainBVH(b)
+	rng := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := vec3.Vec[float64]{rng.Float64() * 250, rng.Float64() * 250, -5}
+		bvh.QueryBox(vec3.Box[float64]{Min: c, Max: vec3.Vec[float64]{c[0] + 6, c[1] + 6, 5}})
+	}
+}
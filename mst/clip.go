@@ -0,0 +1,997 @@
+package mst
+
+import (
+	"math"
+	"sort"
+
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/go3d/vec4"
+)
+
+// ClipPlane keeps the points p with Normal·p + D >= 0.
+type ClipPlane struct {
+	Normal vec3.Vec[float64]
+	D      float64
+}
+
+func (pl *ClipPlane) Distance(p *vec3.Vec[float64]) float64 {
+	return vec3.Dot(&pl.Normal, p) + pl.D
+}
+
+// clipWall is the plane through an edge of a footprint, facing inwards,
+// with the planes bounding it at the ends of the edge.
+type clipWall struct {
+	plane ClipPlane
+	ends  [2]ClipPlane
+	a, b  vec2.Vec[float64]
+}
+
+// ClipRegion is the volume Clip keeps: the intersection of half spaces and,
+// optionally, a polygon footprint in the xy plane extruded along z.
+type ClipRegion struct {
+	planes []ClipPlane
+	ring   []vec2.Vec[float64] // counter clockwise
+	walls  []clipWall
+}
+
+func unitPlane(pl ClipPlane) ClipPlane {
+	if l := pl.Normal.Length(); l > 0 {
+		pl.Normal.Scale(1 / l)
+		pl.D /= l
+	}
+	return pl
+}
+
+// PlaneRegion keeps the positive side of pl.
+func PlaneRegion(pl ClipPlane) *ClipRegion {
+	return &ClipRegion{planes: []ClipPlane{unitPlane(pl)}}
+}
+
+// BoxRegion keeps the inside of box.
+func BoxRegion(box vec3.Box[float64]) *ClipRegion {
+	r := &ClipRegion{}
+	for k := range 3 {
+		var lo, hi ClipPlane
+		lo.Normal[k], lo.D = 1, -box.Min[k]
+		hi.Normal[k], hi.D = -1, box.Max[k]
+		r.planes = append(r.planes, lo, hi)
+	}
+	return r
+}
+
+// PolygonRegion keeps the inside of ring, a polygon in the xy plane that
+// may be concave, extruded from zmin to zmax. The ring may be closed or
+// not and of either orientation, infinite bounds leave z open.
+func PolygonRegion(ring []vec2.Vec[float64], zmin, zmax float64) *ClipRegion {
+	r := &ClipRegion{}
+	if !math.IsInf(zmin, 0) {
+		r.planes = append(r.planes, ClipPlane{Normal: vec3.Vec[float64]{0, 0, 1}, D: -zmin})
+	}
+	if !math.IsInf(zmax, 0) {
+		r.planes = append(r.planes, ClipPlane{Normal: vec3.Vec[float64]{0, 0, -1}, D: zmax})
+	}
+	for _, p := range ring {
+		if len(r.ring) == 0 || r.ring[len(r.ring)-1] != p {
+			r.ring = append(r.ring, p)
+		}
+	}
+	for len(r.ring) > 1 && r.ring[0] == r.ring[len(r.ring)-1] {
+		r.ring = r.ring[:len(r.ring)-1]
+	}
+	if area2(r.ring) < 0 {
+		for i, j := 0, len(r.ring)-1; i < j; i, j = i+1, j-1 {
+			r.ring[i], r.ring[j] = r.ring[j], r.ring[i]
+		}
+	}
+	for i, a := range r.ring {
+		b := r.ring[(i+1)%len(r.ring)]
+		e := vec2.Sub(&b, &a)
+		l := e.Length()
+		e.Scale(1 / l)
+		w := clipWall{a: a, b: b}
+		w.plane = ClipPlane{Normal: vec3.Vec[float64]{-e[1], e[0], 0}, D: e[1]*a[0] - e[0]*a[1]}
+		w.ends[0] = ClipPlane{Normal: vec3.Vec[float64]{e[0], e[1], 0}, D: -vec2.Dot(&e, &a)}
+		w.ends[1] = ClipPlane{Normal: vec3.Vec[float64]{-e[0], -e[1], 0}, D: vec2.Dot(&e, &b)}
+		r.walls = append(r.walls, w)
+	}
+	return r
+}
+
+// area2 returns twice the signed area of a ring, positive when counter
+// clockwise.
+func area2(ring []vec2.Vec[float64]) float64 {
+	a := 0.0
+	for i, p := range ring {
+		q := ring[(i+1)%len(ring)]
+		a += p[0]*q[1] - q[0]*p[1]
+	}
+	return a
+}
+
+// inRing tells whether p lies inside ring by the even odd rule.
+func inRing(ring []vec2.Vec[float64], x, y float64) bool {
+	in := false
+	for i, a := range ring {
+		b := ring[(i+1)%len(ring)]
+		if (a[1] > y) != (b[1] > y) && x < a[0]+(y-a[1])*(b[0]-a[0])/(b[1]-a[1]) {
+			in = !in
+		}
+	}
+	return in
+}
+
+const (
+	clipOutside  = -1
+	clipCrossing = 0
+	clipInside   = 1
+)
+
+// classify tells whether box lies inside the region, outside of it or
+// crosses its surface. Boxes near a footprint are taken as crossing.
+func (r *ClipRegion) classify(box *vec3.Box[float64], tol float64) int {
+	res := clipInside
+	for i := range r.planes {
+		lo, hi := math.MaxFloat64, -math.MaxFloat64
+		for k := range 8 {
+			c := vec3.Vec[float64]{box.Min[0], box.Min[1], box.Min[2]}
+			if k&1 != 0 {
+				c[0] = box.Max[0]
+			}
+			if k&2 != 0 {
+				c[1] = box.Max[1]
+			}
+			if k&4 != 0 {
+				c[2] = box.Max[2]
+			}
+			d := r.planes[i].Distance(&c)
+			lo, hi = min(lo, d), max(hi, d)
+		}
+		if hi < -tol {
+			return clipOutside
+		}
+		if lo < -tol {
+			res = clipCrossing
+		}
+	}
+	if len(r.ring) > 0 {
+		lo, hi := ringBounds(r.ring)
+		if box.Max[0] < lo[0]-tol || box.Min[0] > hi[0]+tol || box.Max[1] < lo[1]-tol || box.Min[1] > hi[1]+tol {
+			return clipOutside
+		}
+		res = clipCrossing
+	}
+	return res
+}
+
+func ringBounds(ring []vec2.Vec[float64]) (lo, hi vec2.Vec[float64]) {
+	lo, hi = vec2.Vec[float64]{math.MaxFloat64, math.MaxFloat64}, vec2.Vec[float64]{-math.MaxFloat64, -math.MaxFloat64}
+	for _, p := range ring {
+		lo = vec2.Vec[float64]{min(lo[0], p[0]), min(lo[1], p[1])}
+		hi = vec2.Vec[float64]{max(hi[0], p[0]), max(hi[1], p[1])}
+	}
+	return lo, hi
+}
+
+// ClipOptions controls Clip.
+type ClipOptions struct {
+	// Cap closes the cuts through closed geometry with faces on the clip
+	// surface. Caps of a footprint are not welded to the cut faces along
+	// its vertical edges.
+	Cap bool
+	// CapGroup puts the caps in a face group of their own with CapBatchid,
+	// otherwise they join the group of the faces they close.
+	CapGroup   bool
+	CapBatchid int
+	// Tolerance is how close to a clip surface a vertex counts as on it.
+	Tolerance float64
+}
+
+var DefaultClipOptions = ClipOptions{Tolerance: 1e-9}
+
+// ClipStats counts the faces before and after clipping.
+type ClipStats struct {
+	Before int
+	After  int
+	Caps   int // faces added to close the cuts
+}
+
+// clipVertex holds the attributes of a vertex, interpolated along cuts.
+type clipVertex struct {
+	p   vec3.Vec[float64]
+	n   vec3.Vec[float64]
+	uv  vec2.Vec[float64]
+	c   [3]float64
+	tan vec4.Vec[float64]
+	fid uint32
+}
+
+func lessVec3(a, b *vec3.Vec[float64]) bool {
+	for k := range 3 {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return false
+}
+
+func unitInPlace(v []float64) {
+	l := 0.0
+	for _, x := range v {
+		l += x * x
+	}
+	if l > 0 {
+		l = math.Sqrt(l)
+		for k := range v {
+			v[k] /= l
+		}
+	}
+}
+
+// cut returns the point where a plane crosses from a to b, at distances da
+// and db. The ends are ordered first so that faces sharing the edge agree
+// on the exact point.
+func cut(a, b *clipVertex, da, db float64) clipVertex {
+	if da == 0 {
+		return *a
+	}
+	if db == 0 {
+		return *b
+	}
+	if lessVec3(&b.p, &a.p) {
+		a, b, da, db = b, a, db, da
+	}
+	t := da / (da - db)
+	v := clipVertex{fid: a.fid}
+	for k := range 3 {
+		v.p[k] = a.p[k] + t*(b.p[k]-a.p[k])
+		v.n[k] = a.n[k] + t*(b.n[k]-a.n[k])
+		v.c[k] = a.c[k] + t*(b.c[k]-a.c[k])
+		v.tan[k] = a.tan[k] + t*(b.tan[k]-a.tan[k])
+	}
+	for k := range 2 {
+		v.uv[k] = a.uv[k] + t*(b.uv[k]-a.uv[k])
+	}
+	v.tan[3] = a.tan[3]
+	if t >= 0.5 {
+		v.fid, v.tan[3] = b.fid, b.tan[3]
+	}
+	unitInPlace(v.n[:])
+	unitInPlace(v.tan[:3])
+	return v
+}
+
+func planeDistance(pl *ClipPlane, p *vec3.Vec[float64], tol float64) float64 {
+	d := pl.Distance(p)
+	if math.Abs(d) <= tol {
+		return 0
+	}
+	return d
+}
+
+// splitPolygon splits a convex polygon by pl into its parts on the positive
+// and the negative side. The cut runs from enter, where the polygon comes
+// into the positive side, to exit, reversed to the winding of the polygon,
+// as the cap closing the positive part has to run it.
+func splitPolygon(poly []clipVertex, pl *ClipPlane, tol float64) (in, out []clipVertex, enter, exit clipVertex, crossed bool) {
+	d := make([]float64, len(poly))
+	pos, neg := false, false
+	for i := range poly {
+		d[i] = planeDistance(pl, &poly[i].p, tol)
+		pos, neg = pos || d[i] > 0, neg || d[i] < 0
+	}
+	if !neg {
+		return poly, nil, enter, exit, false
+	}
+	hasEnter, hasExit := false, false
+	for i := range poly {
+		j := (i + 1) % len(poly)
+		a, b, da, db := &poly[i], &poly[j], d[i], d[j]
+		if da >= 0 {
+			in = append(in, *a)
+		}
+		if da <= 0 {
+			out = append(out, *a)
+		}
+		if da >= 0 && db < 0 {
+			exit, hasExit = cut(a, b, da, db), true
+		} else if da < 0 && db >= 0 {
+			enter, hasEnter = cut(a, b, da, db), true
+		}
+		if (da > 0 && db < 0) || (da < 0 && db > 0) {
+			x := cut(a, b, da, db)
+			in, out = append(in, x), append(out, x)
+		}
+	}
+	if !pos {
+		in = nil
+	}
+	crossed = hasEnter && hasExit && enter.p != exit.p
+	return in, out, enter, exit, crossed
+}
+
+type clipPoly struct {
+	v   []clipVertex
+	cap bool
+}
+
+type clipGroup struct {
+	batchid int
+	polys   []clipPoly
+}
+
+type clipOutline struct {
+	batchid int
+	edges   [][2]clipVertex
+}
+
+// clipSegment is a piece of the section through a clip surface.
+type clipSegment struct {
+	a, b  vec3.Vec[float64]
+	group *clipGroup
+	fid   uint32
+}
+
+type clipWork struct {
+	opts     ClipOptions
+	groups   []*clipGroup
+	outlines []*clipOutline
+	capGroup *clipGroup
+
+	hasNormals, hasUvs, hasColors, hasTangents bool
+}
+
+func nodeClipVertex[T float64 | float32](n *MeshNode[T], v uint32, vn, vt int) clipVertex {
+	var cv clipVertex
+	p := n.Vertices[v]
+	cv.p = vec3.Vec[float64]{float64(p[0]), float64(p[1]), float64(p[2])}
+	if vn >= 0 && vn < len(n.Normals) {
+		nm := n.Normals[vn]
+		cv.n = vec3.Vec[float64]{float64(nm[0]), float64(nm[1]), float64(nm[2])}
+	}
+	if vt >= 0 && vt < len(n.TexCoords) {
+		cv.uv = vec2.Vec[float64]{float64(n.TexCoords[vt][0]), float64(n.TexCoords[vt][1])}
+	}
+	if int(v) < len(n.Colors) {
+		c := n.Colors[v]
+		cv.c = [3]float64{float64(c[0]), float64(c[1]), float64(c[2])}
+	}
+	if int(v) < len(n.Tangents) {
+		tn := n.Tangents[v]
+		cv.tan = vec4.Vec[float64]{float64(tn[0]), float64(tn[1]), float64(tn[2]), float64(tn[3])}
+	}
+	if int(v) < len(n.FeatureIds) {
+		cv.fid = n.FeatureIds[v]
+	}
+	return cv
+}
+
+func newClipWork[T float64 | float32](n *MeshNode[T], opts ClipOptions) *clipWork {
+	w := &clipWork{
+		opts:        opts,
+		hasNormals:  len(n.Normals) > 0,
+		hasUvs:      len(n.TexCoords) > 0,
+		hasColors:   len(n.Colors) > 0,
+		hasTangents: len(n.Tangents) > 0,
+	}
+	for _, g := range n.FaceGroup {
+		cg := &clipGroup{batchid: g.Batchid}
+		for _, f := range g.Faces {
+			poly := make([]clipVertex, 3)
+			for k := range 3 {
+				vn, vt := int(f.Vertex[k]), int(f.Vertex[k])
+				if f.Normal != nil {
+					vn = int(f.Normal[k])
+				}
+				if f.Uv != nil {
+					vt = int(f.Uv[k])
+				}
+				poly[k] = nodeClipVertex(n, f.Vertex[k], vn, vt)
+			}
+			cg.polys = append(cg.polys, clipPoly{v: poly})
+		}
+		w.groups = append(w.groups, cg)
+	}
+	// outlines only have per vertex attributes
+	vn, vt := len(n.Normals) == len(n.Vertices), len(n.TexCoords) == len(n.Vertices)
+	for _, g := range n.EdgeGroup {
+		co := &clipOutline{batchid: g.Batchid}
+		for _, e := range g.Edges {
+			var ce [2]clipVertex
+			for k := range 2 {
+				in, it := -1, -1
+				if vn {
+					in = e[k]
+				}
+				if vt {
+					it = e[k]
+				}
+				ce[k] = nodeClipVertex(n, uint32(e[k]), in, it)
+			}
+			co.edges = append(co.edges, ce)
+		}
+		w.outlines = append(w.outlines, co)
+	}
+	return w
+}
+
+// clipPlane drops everything on the negative side of pl and caps the cut.
+func (w *clipWork) clipPlane(pl *ClipPlane) {
+	tol := w.opts.Tolerance
+	var segs []clipSegment
+	for _, g := range w.groups {
+		var polys []clipPoly
+		for _, p := range g.polys {
+			in, _, enter, exit, crossed := splitPolygon(p.v, pl, tol)
+			if crossed {
+				segs = append(segs, clipSegment{a: enter.p, b: exit.p, group: g, fid: enter.fid})
+			}
+			if len(in) >= 3 {
+				polys = append(polys, clipPoly{v: in, cap: p.cap})
+			}
+		}
+		g.polys = polys
+	}
+	for _, o := range w.outlines {
+		var edges [][2]clipVertex
+		for _, e := range o.edges {
+			da, db := planeDistance(pl, &e[0].p, tol), planeDistance(pl, &e[1].p, tol)
+			if da < 0 && db < 0 {
+				continue
+			}
+			if da < 0 {
+				e[0] = cut(&e[0], &e[1], da, db)
+			} else if db < 0 {
+				e[1] = cut(&e[0], &e[1], da, db)
+			}
+			if e[0].p != e[1].p {
+				edges = append(edges, e)
+			}
+		}
+		o.edges = edges
+	}
+	if w.opts.Cap {
+		w.cap(segs, pl, nil)
+	}
+}
+
+// clipRing keeps the faces inside the footprint of r. Faces are split by
+// the lines of the edges near them, the pieces are then either inside or
+// outside.
+func (w *clipWork) clipRing(r *ClipRegion) {
+	tol := w.opts.Tolerance
+	var sections [][]clipSegment
+	if w.opts.Cap {
+		sections = make([][]clipSegment, len(r.walls))
+		for i := range r.walls {
+			for _, g := range w.groups {
+				for _, p := range g.polys {
+					if _, _, enter, exit, crossed := splitPolygon(p.v, &r.walls[i].plane, tol); crossed {
+						sections[i] = append(sections[i], clipSegment{a: enter.p, b: exit.p, group: g, fid: enter.fid})
+					}
+				}
+			}
+		}
+	}
+	rlo, rhi := ringBounds(r.ring)
+	near := func(w *clipWall, lo, hi vec2.Vec[float64]) bool {
+		return max(w.a[0], w.b[0]) >= lo[0]-tol && min(w.a[0], w.b[0]) <= hi[0]+tol &&
+			max(w.a[1], w.b[1]) >= lo[1]-tol && min(w.a[1], w.b[1]) <= hi[1]+tol
+	}
+	for _, g := range w.groups {
+		var polys []clipPoly
+		for _, p := range g.polys {
+			lo, hi := vec2.Vec[float64]{math.MaxFloat64, math.MaxFloat64}, vec2.Vec[float64]{-math.MaxFloat64, -math.MaxFloat64}
+			for _, v := range p.v {
+				lo = vec2.Vec[float64]{min(lo[0], v.p[0]), min(lo[1], v.p[1])}
+				hi = vec2.Vec[float64]{max(hi[0], v.p[0]), max(hi[1], v.p[1])}
+			}
+			if hi[0] < rlo[0]-tol || lo[0] > rhi[0]+tol || hi[1] < rlo[1]-tol || lo[1] > rhi[1]+tol {
+				continue
+			}
+			pieces := [][]clipVertex{p.v}
+			for i := range r.walls {
+				if !near(&r.walls[i], lo, hi) {
+					continue
+				}
+				var next [][]clipVertex
+				for _, pc := range pieces {
+					in, out, _, _, _ := splitPolygon(pc, &r.walls[i].plane, tol)
+					if len(in) >= 3 {
+						next = append(next, in)
+					}
+					if len(out) >= 3 {
+						next = append(next, out)
+					}
+				}
+				pieces = next
+			}
+			for _, pc := range pieces {
+				var c vec2.Vec[float64]
+				for _, v := range pc {
+					c[0], c[1] = c[0]+v.p[0], c[1]+v.p[1]
+				}
+				if inRing(r.ring, c[0]/float64(len(pc)), c[1]/float64(len(pc))) {
+					polys = append(polys, clipPoly{v: pc, cap: p.cap})
+				}
+			}
+		}
+		g.polys = polys
+	}
+	for _, o := range w.outlines {
+		var edges [][2]clipVertex
+		for _, e := range o.edges {
+			pieces := [][2]clipVertex{e}
+			for i := range r.walls {
+				pl := &r.walls[i].plane
+				var next [][2]clipVertex
+				for _, pc := range pieces {
+					da, db := planeDistance(pl, &pc[0].p, tol), planeDistance(pl, &pc[1].p, tol)
+					if (da > 0 && db < 0) || (da < 0 && db > 0) {
+						x := cut(&pc[0], &pc[1], da, db)
+						next = append(next, [2]clipVertex{pc[0], x}, [2]clipVertex{x, pc[1]})
+					} else {
+						next = append(next, pc)
+					}
+				}
+				pieces = next
+			}
+			for _, pc := range pieces {
+				if pc[0].p != pc[1].p && inRing(r.ring, (pc[0].p[0]+pc[1].p[0])/2, (pc[0].p[1]+pc[1].p[1])/2) {
+					edges = append(edges, pc)
+				}
+			}
+		}
+		o.edges = edges
+	}
+	for i, segs := range sections {
+		w.cap(segs, &r.walls[i].plane, r.walls[i].ends[:])
+	}
+}
+
+// chainLoops joins the segments running head to tail into closed loops of
+// segment indices. Open chains are dropped.
+func chainLoops(segs []clipSegment) [][]int {
+	from := make(map[vec3.Vec[float64]][]int, len(segs))
+	for i, s := range segs {
+		from[s.a] = append(from[s.a], i)
+	}
+	used := make([]bool, len(segs))
+	var loops [][]int
+	for i := range segs {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		loop := []int{i}
+		closed := false
+		for cur := i; ; {
+			if segs[cur].b == segs[i].a {
+				closed = true
+				break
+			}
+			next := -1
+			for _, j := range from[segs[cur].b] {
+				if !used[j] {
+					next = j
+					break
+				}
+			}
+			if next < 0 {
+				break
+			}
+			used[next] = true
+			loop = append(loop, next)
+			cur = next
+		}
+		if closed && len(loop) >= 3 {
+			loops = append(loops, loop)
+		}
+	}
+	return loops
+}
+
+// planeBasis returns unit vectors u, v in the plane of n with u × v = -n,
+// so that faces facing against n wind counter clockwise in u, v.
+func planeBasis(n *vec3.Vec[float64]) (u, v vec3.Vec[float64]) {
+	k := 0
+	for i := 1; i < 3; i++ {
+		if math.Abs(n[i]) < math.Abs(n[k]) {
+			k = i
+		}
+	}
+	var a vec3.Vec[float64]
+	a[k] = 1
+	u = vec3.Cross(&a, n)
+	u.Scale(1 / u.Length())
+	v = vec3.Cross(&u, n)
+	return u, v
+}
+
+// cap fills the loops of segs with faces facing against pl, cut to the
+// bounds. Caps get planar uvs and white colors.
+func (w *clipWork) cap(segs []clipSegment, pl *ClipPlane, bounds []ClipPlane) {
+	loops := chainLoops(segs)
+	if len(loops) == 0 {
+		return
+	}
+	u, v := planeBasis(&pl.Normal)
+	var pos []vec3.Vec[float64]
+	var pts []vec2.Vec[float64]
+	rings := make([][]int, len(loops))
+	for i, loop := range loops {
+		for _, si := range loop {
+			p := segs[si].a
+			rings[i] = append(rings[i], len(pts))
+			pos = append(pos, p)
+			pts = append(pts, vec2.Vec[float64]{vec3.Dot(&p, &u), vec3.Dot(&p, &v)})
+		}
+	}
+	normal := vec3.Vec[float64]{-pl.Normal[0], -pl.Normal[1], -pl.Normal[2]}
+	tris, owners := triangulateRings(pts, rings)
+	for k, t := range tris {
+		s := &segs[loops[owners[k]][0]]
+		g := s.group
+		if w.opts.CapGroup {
+			if w.capGroup == nil {
+				w.capGroup = &clipGroup{batchid: w.opts.CapBatchid}
+				w.groups = append(w.groups, w.capGroup)
+			}
+			g = w.capGroup
+		}
+		poly := make([]clipVertex, 3)
+		for j, i := range t {
+			cv := clipVertex{p: pos[i], fid: s.fid}
+			if w.hasNormals {
+				cv.n = normal
+			}
+			if w.hasUvs {
+				cv.uv = pts[i]
+			}
+			if w.hasColors {
+				cv.c = [3]float64{255, 255, 255}
+			}
+			if w.hasTangents {
+				cv.tan = vec4.Vec[float64]{u[0], u[1], u[2], 1}
+			}
+			poly[j] = cv
+		}
+		for i := range bounds {
+			if poly, _, _, _, _ = splitPolygon(poly, &bounds[i], w.opts.Tolerance); len(poly) < 3 {
+				break
+			}
+		}
+		if len(poly) >= 3 {
+			g.polys = append(g.polys, clipPoly{v: poly, cap: true})
+		}
+	}
+}
+
+// build replaces the geometry of n by the clipped faces and outlines, with
+// per vertex attributes. It returns the number of faces and caps.
+func buildClipped[T float64 | float32](n *MeshNode[T], w *clipWork) (faces, caps int) {
+	n.Vertices, n.Normals, n.TexCoords, n.Colors, n.Tangents, n.FeatureIds = nil, nil, nil, nil, nil, nil
+	n.FaceGroup, n.EdgeGroup = nil, nil
+	fids := false
+	index := map[clipVertex]uint32{}
+	add := func(cv *clipVertex) uint32 {
+		if i, ok := index[*cv]; ok {
+			return i
+		}
+		i := uint32(len(n.Vertices))
+		index[*cv] = i
+		n.Vertices = append(n.Vertices, vec3.Vec[T]{T(cv.p[0]), T(cv.p[1]), T(cv.p[2])})
+		if w.hasNormals {
+			n.Normals = append(n.Normals, vec3.Vec[T]{T(cv.n[0]), T(cv.n[1]), T(cv.n[2])})
+		}
+		if w.hasUvs {
+			n.TexCoords = append(n.TexCoords, vec2.Vec[T]{T(cv.uv[0]), T(cv.uv[1])})
+		}
+		if w.hasColors {
+			var c [3]byte
+			for k := range 3 {
+				c[k] = byte(math.Round(min(max(cv.c[k], 0), 255)))
+			}
+			n.Colors = append(n.Colors, c)
+		}
+		if w.hasTangents {
+			n.Tangents = append(n.Tangents, vec4.Vec[T]{T(cv.tan[0]), T(cv.tan[1]), T(cv.tan[2]), T(cv.tan[3])})
+		}
+		n.FeatureIds = append(n.FeatureIds, cv.fid)
+		fids = fids || cv.fid != 0
+		return i
+	}
+	for _, g := range w.groups {
+		mt := &MeshTriangle{Batchid: g.batchid}
+		for _, p := range g.polys {
+			idx := make([]uint32, 0, len(p.v))
+			for i := range p.v {
+				k := add(&p.v[i])
+				if len(idx) == 0 || idx[len(idx)-1] != k {
+					idx = append(idx, k)
+				}
+			}
+			for len(idx) > 1 && idx[0] == idx[len(idx)-1] {
+				idx = idx[:len(idx)-1]
+			}
+			for k := 1; k+1 < len(idx); k++ {
+				if idx[0] == idx[k+1] || idx[k] == idx[k+1] {
+					continue
+				}
+				mt.Faces = append(mt.Faces, &Face{Vertex: [3]uint32{idx[0], idx[k], idx[k+1]}})
+				if p.cap {
+					caps++
+				}
+			}
+		}
+		if len(mt.Faces) > 0 {
+			faces += len(mt.Faces)
+			n.FaceGroup = append(n.FaceGroup, mt)
+		}
+	}
+	for _, o := range w.outlines {
+		mo := &MeshOutline{Batchid: o.batchid}
+		for _, e := range o.edges {
+			mo.Edges = append(mo.Edges, [2]int{int(add(&e[0])), int(add(&e[1]))})
+		}
+		if len(mo.Edges) > 0 {
+			n.EdgeGroup = append(n.EdgeGroup, mo)
+		}
+	}
+	if !fids {
+		n.FeatureIds = nil
+	}
+	return faces, caps
+}
+
+// Clip cuts the node to r. Faces crossing its surface are split, with the
+// attributes of the new vertices interpolated, and the face groups keep
+// their Batchid. Mat is baked first.
+func (n *MeshNode[T]) Clip(r *ClipRegion, opts ClipOptions) ClipStats {
+	n.BakeMatrix()
+	var stats ClipStats
+	for _, g := range n.FaceGroup {
+		stats.Before += len(g.Faces)
+	}
+	w := newClipWork(n, opts)
+	for i := range r.planes {
+		w.clipPlane(&r.planes[i])
+	}
+	if len(r.ring) > 0 {
+		w.clipRing(r)
+	}
+	stats.After, stats.Caps = buildClipped(n, w)
+	return stats
+}
+
+// Clip cuts the mesh to r and drops the nodes left empty. Copies of
+// instances inside r stay instances, those crossing its surface become
+// nodes to be clipped.
+func (m *Mesh[T]) Clip(r *ClipRegion, opts ClipOptions) ClipStats {
+	var insts []*InstanceMesh[T]
+	for _, inst := range m.InstanceNode {
+		if inst.Mesh == nil {
+			insts = append(insts, inst)
+			continue
+		}
+		offset := -1
+		var tfs []*mat4.Mat[T]
+		var features []uint64
+		for i, tf := range inst.Transfors {
+			box := inst.copyBox(tf)
+			switch r.classify(&box, opts.Tolerance) {
+			case clipInside:
+				tfs = append(tfs, tf)
+				if i < len(inst.Features) {
+					features = append(features, inst.Features[i])
+				}
+			case clipCrossing:
+				if offset < 0 {
+					offset = len(m.Materials)
+					m.Materials = append(m.Materials, inst.Mesh.Materials...)
+				}
+				m.Nodes = append(m.Nodes, inst.copyNodes(i, offset)...)
+			}
+		}
+		if len(tfs) == 0 {
+			continue
+		}
+		inst.Transfors, inst.Features = tfs, features
+		inst.ComputeBBox()
+		insts = append(insts, inst)
+	}
+	m.InstanceNode = insts
+
+	var stats ClipStats
+	nodes := m.Nodes[:0]
+	for _, nd := range m.Nodes {
+		s := nd.Clip(r, opts)
+		stats.Before += s.Before
+		stats.After += s.After
+		stats.Caps += s.Caps
+		if len(nd.FaceGroup) > 0 || len(nd.EdgeGroup) > 0 {
+			nodes = append(nodes, nd)
+		}
+	}
+	m.Nodes = nodes
+	return stats
+}
+
+// triangulateRings fills the polygons given as rings of indices into pts,
+// outer rings counter clockwise and holes clockwise, by ear clipping. Holes
+// are bridged into the ring around them first. Every triangle comes with
+// the index of the outer ring it fills.
+func triangulateRings(pts []vec2.Vec[float64], rings [][]int) (tris [][3]int, owners []int) {
+	area := func(ring []int) float64 {
+		a := 0.0
+		for i, k := range ring {
+			p, q := pts[k], pts[ring[(i+1)%len(ring)]]
+			a += p[0]*q[1] - q[0]*p[1]
+		}
+		return a / 2
+	}
+	contains := func(ring []int, p vec2.Vec[float64]) bool {
+		in := false
+		for i, k := range ring {
+			a, b := pts[k], pts[ring[(i+1)%len(ring)]]
+			if (a[1] > p[1]) != (b[1] > p[1]) && p[0] < a[0]+(p[1]-a[1])*(b[0]-a[0])/(b[1]-a[1]) {
+				in = !in
+			}
+		}
+		return in
+	}
+	var outers, holes []int
+	areas := make([]float64, len(rings))
+	for i, ring := range rings {
+		areas[i] = area(ring)
+		if areas[i] > 0 {
+			outers = append(outers, i)
+		} else if areas[i] < 0 {
+			holes = append(holes, i)
+		}
+	}
+	inner := make(map[int][]int)
+	for _, h := range holes {
+		best := -1
+		for _, o := range outers {
+			if contains(rings[o], pts[rings[h][0]]) && (best < 0 || areas[o] < areas[best]) {
+				best = o
+			}
+		}
+		if best >= 0 {
+			inner[best] = append(inner[best], h)
+		}
+	}
+	for _, o := range outers {
+		poly := rings[o]
+		hs := inner[o]
+		maxX := func(h int) float64 {
+			x := -math.MaxFloat64
+			for _, k := range rings[h] {
+				x = max(x, pts[k][0])
+			}
+			return x
+		}
+		sort.Slice(hs, func(i, j int) bool { return maxX(hs[i]) > maxX(hs[j]) })
+		for i, h := range hs {
+			var rest [][]int
+			for _, r := range hs[i+1:] {
+				rest = append(rest, rings[r])
+			}
+			poly = bridgeHole(pts, poly, rings[h], rest)
+		}
+		earClip(pts, poly, func(a, b, c int) {
+			tris = append(tris, [3]int{a, b, c})
+			owners = append(owners, o)
+		})
+	}
+	return tris, owners
+}
+
+func orient(a, b, c vec2.Vec[float64]) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+// onSegment tells whether p lies on the open segment ab.
+func onSegment(p, a, b vec2.Vec[float64]) bool {
+	if p == a || p == b || orient(a, b, p) != 0 {
+		return false
+	}
+	return min(a[0], b[0]) <= p[0] && p[0] <= max(a[0], b[0]) && min(a[1], b[1]) <= p[1] && p[1] <= max(a[1], b[1])
+}
+
+// bridgeHole joins hole into poly by a cut from its rightmost vertex to
+// the closest vertex of poly seen from there.
+func bridgeHole(pts []vec2.Vec[float64], poly, hole []int, others [][]int) []int {
+	hi := 0
+	for i, k := range hole {
+		if pts[k][0] > pts[hole[hi]][0] {
+			hi = i
+		}
+	}
+	h := pts[hole[hi]]
+	rings := append([][]int{poly, hole}, others...)
+	visible := func(p vec2.Vec[float64]) bool {
+		for _, ring := range rings {
+			for i, k := range ring {
+				a, b := pts[k], pts[ring[(i+1)%len(ring)]]
+				o1, o2 := orient(h, p, a), orient(h, p, b)
+				o3, o4 := orient(a, b, h), orient(a, b, p)
+				if o1*o2 < 0 && o3*o4 < 0 {
+					return false
+				}
+				if onSegment(a, h, p) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	best, bestD := -1, math.MaxFloat64
+	for i, k := range poly {
+		d := vec2.Sub(&pts[k], &h)
+		if l := d.LengthSqr(); l < bestD && visible(pts[k]) {
+			best, bestD = i, l
+		}
+	}
+	if best < 0 {
+		return poly
+	}
+	out := append([]int(nil), poly[:best+1]...)
+	for k := 0; k <= len(hole); k++ {
+		out = append(out, hole[(hi+k)%len(hole)])
+	}
+	return append(out, poly[best:]...)
+}
+
+// earClip triangulates a simple counter clockwise polygon. Corners it can
+// not clip, left over by degenerate input, are dropped.
+func earClip(pts []vec2.Vec[float64], poly []int, emit func(a, b, c int)) {
+	idx := append([]int(nil), poly...)
+	isEar := func(a, b, c int) bool {
+		pa, pb, pc := pts[a], pts[b], pts[c]
+		if orient(pa, pb, pc) <= 0 {
+			return false
+		}
+		for _, k := range idx {
+			p := pts[k]
+			if p == pa || p == pb || p == pc {
+				continue
+			}
+			if orient(pa, pb, p) >= 0 && orient(pb, pc, p) >= 0 && orient(pc, pa, p) >= 0 {
+				return false
+			}
+		}
+		return true
+	}
+	i, miss := 0, 0
+	for len(idx) > 3 {
+		n := len(idx)
+		i %= n
+		a, b, c := idx[(i+n-1)%n], idx[i], idx[(i+1)%n]
+		if isEar(a, b, c) {
+			emit(a, b, c)
+			idx = append(idx[:i], idx[i+1:]...)
+			miss = 0
+			continue
+		}
+		i++
+		if miss++; miss < n {
+			continue
+		}
+		// no ear left, drop the flattest corner
+		flat, best := 0, math.MaxFloat64
+		for j := range idx {
+			o := math.Abs(orient(pts[idx[(j+n-1)%n]], pts[idx[j]], pts[idx[(j+1)%n]]))
+			if o < best {
+				flat, best = j, o
+			}
+		}
+		idx = append(idx[:flat], idx[flat+1:]...)
+		miss = 0
+	}
+	if len(idx) == 3 && orient(pts[idx[0]], pts[idx[1]], pts[idx[2]]) > 0 {
+		emit(idx[0], idx[1], idx[2])
+	}
+}
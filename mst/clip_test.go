@@ -0,0 +1,183 @@
+package mst
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+func nodeVolume(nd *MeshNode[float64]) float64 {
+	v := 0.0
+	for _, g := range nd.FaceGroup {
+		for _, f := range g.Faces {
+			a, b, c := nd.Vertices[f.Vertex[0]], nd.Vertices[f.Vertex[1]], nd.Vertices[f.Vertex[2]]
+			bc := vec3.Cross(&b, &c)
+			v += vec3.Dot(&a, &bc) / 6
+		}
+	}
+	return v
+}
+
+// openEdges counts the boundary and non-manifold edges over all groups.
+func openEdges(nd *MeshNode[float64]) int {
+	c := nd.Clone()
+	for _, g := range c.FaceGroup[1:] {
+		c.FaceGroup[0].Faces = append(c.FaceGroup[0].Faces, g.Faces...)
+	}
+	c.FaceGroup = c.FaceGroup[:1]
+	return c.ExtractOutlines(OutlineOptions{Boundary: true, NonManifold: true, FeatureAngle: math.Pi})
+}
+
+func findVertex(nd *MeshNode[float64], p vec3.Vec[float64]) int {
+	for i, v := range nd.Vertices {
+		d := vec3.Sub(&v, &p)
+		if d.Length() < 1e-9 {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestClipPlane(t *testing.T) {
+	nd := quadNode()
+	stats := nd.Clip(PlaneRegion(ClipPlane{Normal: vec3.Vec[float64]{2, 0, 0}, D: -3}), DefaultClipOptions)
+	assert.Equal(t, ClipStats{Before: 4, After: 3}, stats)
+	for _, v := range nd.Vertices {
+		assert.GreaterOrEqual(t, v[0], 1.5)
+	}
+	// uvs run back to 0 on the right half
+	i := findVertex(nd, vec3.Vec[float64]{1.5, 0, 0})
+	assert.Equal(t, vec2.Vec[float64]{0.5, 0}, nd.TexCoords[i])
+	assert.Equal(t, vec3.Vec[float64]{0, 0, 1}, nd.Normals[i])
+
+	nd = quadNode()
+	nd.Clip(PlaneRegion(ClipPlane{Normal: vec3.Vec[float64]{1, 0, 0}, D: -0.5}), DefaultClipOptions)
+	i = findVertex(nd, vec3.Vec[float64]{0.5, 0.5, 0})
+	assert.InDelta(t, 0.5, nd.TexCoords[i][0], 1e-12)
+	assert.InDelta(t, 0.5, nd.TexCoords[i][1], 1e-12)
+
+	// a capped cube stays closed
+	nd = cubeNode()
+	nd.ComputeNormals(DefaultNormalOptions)
+	opts := DefaultClipOptions
+	opts.Cap = true
+	stats = nd.Clip(PlaneRegion(ClipPlane{Normal: vec3.Vec[float64]{0, 0, 1}, D: -0.25}), opts)
+	assert.Equal(t, 6, stats.Caps)
+	assert.InDelta(t, 0.75, nodeVolume(nd), 1e-12)
+	assert.Zero(t, openEdges(nd))
+	for _, v := range nd.Vertices {
+		assert.GreaterOrEqual(t, v[2], 0.25)
+	}
+	assertOutwards(t, nd, vec3.Vec[float64]{0.5, 0.5, 0.625})
+
+	nd = cubeNode()
+	nd.Clip(PlaneRegion(ClipPlane{Normal: vec3.Vec[float64]{0, 0, 1}, D: -0.25}), DefaultClipOptions)
+	assert.Equal(t, 8, openEdges(nd))
+
+	// nothing left
+	nd = cubeNode()
+	nd.Clip(PlaneRegion(ClipPlane{Normal: vec3.Vec[float64]{0, 0, 1}, D: -2}), opts)
+	assert.Empty(t, nd.FaceGroup)
+	assert.Empty(t, nd.Vertices)
+}
+
+func TestClipBox(t *testing.T) {
+	nd := cubeNode()
+	nd.FaceGroup = append(nd.FaceGroup, &MeshTriangle{Batchid: 1, Faces: nd.FaceGroup[0].Faces[6:]})
+	nd.FaceGroup[0].Faces = nd.FaceGroup[0].Faces[:6]
+	nd.EdgeGroup = []*MeshOutline{{Batchid: 1, Edges: [][2]int{{0, 7}}}}
+	nd.Colors = make([][3]byte, 8)
+	nd.Colors[7] = [3]byte{200, 100, 0}
+
+	opts := DefaultClipOptions
+	opts.Cap = true
+	box := vec3.Box[float64]{Min: vec3.Vec[float64]{0.25, 0.25, 0.25}, Max: vec3.Vec[float64]{2, 2, 2}}
+	nd.Clip(BoxRegion(box), opts)
+	assert.InDelta(t, 0.75*0.75*0.75, nodeVolume(nd), 1e-12)
+	assert.Zero(t, openEdges(nd))
+	assert.Equal(t, 2, len(nd.FaceGroup))
+	assert.Equal(t, 0, nd.FaceGroup[0].Batchid)
+	assert.Equal(t, 1, nd.FaceGroup[1].Batchid)
+
+	// the diagonal outline starts on the box now, with its color interpolated
+	e := nd.EdgeGroup[0].Edges
+	assert.Equal(t, 1, len(e))
+	assert.Equal(t, vec3.Vec[float64]{0.25, 0.25, 0.25}, nd.Vertices[e[0][0]])
+	assert.Equal(t, [3]byte{50, 25, 0}, nd.Colors[e[0][0]])
+	assert.Equal(t, vec3.Vec[float64]{1, 1, 1}, nd.Vertices[e[0][1]])
+
+	// caps of their own
+	nd = cubeNode()
+	opts.CapGroup, opts.CapBatchid = true, 7
+	stats := nd.Clip(BoxRegion(box), opts)
+	assert.Equal(t, 2, len(nd.FaceGroup))
+	assert.Equal(t, 7, nd.FaceGroup[1].Batchid)
+	assert.Equal(t, stats.Caps, len(nd.FaceGroup[1].Faces))
+	assert.Equal(t, stats.After, stats.Caps+len(nd.FaceGroup[0].Faces))
+}
+
+func TestClipPolygon(t *testing.T) {
+	plate := func() *MeshNode[float64] {
+		nd := cubeNode()
+		nd.Transform(scaling(4, 4, 1))
+		return nd
+	}
+	// an L of area 5
+	ring := []vec2.Vec[float64]{{0, 0}, {0, 3}, {1, 3}, {1, 1}, {3, 1}, {3, 0}, {0, 0}}
+	opts := DefaultClipOptions
+	opts.Cap = true
+
+	nd := plate()
+	nd.Clip(PolygonRegion(ring, math.Inf(-1), math.Inf(1)), opts)
+	assert.InDelta(t, 5, nodeVolume(nd), 1e-9)
+	for _, v := range nd.Vertices {
+		assert.True(t, v[0] <= 1 || v[1] <= 1)
+		assert.LessOrEqual(t, v[0], 3.0)
+		assert.LessOrEqual(t, v[1], 3.0)
+	}
+
+	nd = plate()
+	nd.Clip(PolygonRegion(ring, 0.25, 0.75), opts)
+	assert.InDelta(t, 2.5, nodeVolume(nd), 1e-9)
+
+	nd = plate()
+	nd.Clip(PolygonRegion(ring, math.Inf(-1), math.Inf(1)), DefaultClipOptions)
+	assert.Greater(t, openEdges(nd), 0)
+	assert.Nil(t, nd.FaceGroup[0].Faces[0].Normal)
+
+	// footprints away from the node leave nothing
+	nd = plate()
+	far := []vec2.Vec[float64]{{10, 10}, {11, 10}, {11, 11}}
+	assert.Equal(t, 0, nd.Clip(PolygonRegion(far, math.Inf(-1), math.Inf(1)), opts).After)
+}
+
+func TestMeshClip(t *testing.T) {
+	ms := instanceMesh()
+	ms.Instance(DefaultInstanceOptions)
+	// the first cube inside, the turned one across the box, the large and
+	// the mirrored cubes outside
+	box := vec3.Box[float64]{Min: vec3.Vec[float64]{-1, -1, -1}, Max: vec3.Vec[float64]{4.5, 2, 2}}
+	opts := DefaultClipOptions
+	opts.Cap = true
+	stats := ms.Clip(BoxRegion(box), opts)
+	assert.Greater(t, stats.Caps, 0)
+
+	inst := ms.InstanceNode[0]
+	assert.Equal(t, []uint64{0}, inst.Features)
+	assert.Equal(t, 1, len(inst.Transfors))
+	assert.InDelta(t, 1, inst.BBox[3], 1e-9)
+
+	// the quad and the clipped copy are left
+	assert.Equal(t, 2, len(ms.Nodes))
+	assert.Equal(t, 3, len(ms.Materials))
+	nd := ms.Nodes[1]
+	assert.Equal(t, 2, nd.FaceGroup[0].Batchid)
+	assert.Equal(t, uint32(2), nd.FeatureIds[0])
+	assert.InDelta(t, 0.5, nodeVolume(nd), 1e-9)
+	for _, v := range nd.Vertices {
+		assert.LessOrEqual(t, v[0], 4.5+1e-9)
+	}
+}
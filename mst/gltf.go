@@ -10,6 +10,9 @@ import (
 
 	"github.com/qmuntal/gltf"
 	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/go3d/vec4"
 )
 
 const GLTF_VERSION = "2.0"
@@ -115,6 +118,72 @@ type buildContext struct {
 	bvPos   int
 	bvTex   int
 	bvNorm  int
+	bvTang  int
+	bvFeat  int
+}
+
+const EXT_MESH_FEATURES = "EXT_mesh_features"
+
+// maxShortVertices is the most vertices uint16 indices address, 0xffff is
+// left out as the primitive restart value.
+const maxShortVertices = 0xffff
+
+// shortIndices reports whether the face indices of the node fit uint16.
+func shortIndices[T float64 | float32](nd *MeshNode[T]) bool {
+	return len(nd.Vertices) <= maxShortVertices
+}
+
+func hasFeatureIds[T float64 | float32](nd *MeshNode[T]) bool {
+	return len(nd.FeatureIds) > 0 && len(nd.FeatureIds) == len(nd.Vertices)
+}
+
+// featureCount returns the number of distinct feature ids of the node.
+func featureCount[T float64 | float32](nd *MeshNode[T]) int {
+	seen := map[uint32]bool{}
+	for _, id := range nd.FeatureIds {
+		seen[id] = true
+	}
+	return len(seen)
+}
+
+func addExtensionUsed(doc *gltf.Document, name string) {
+	for _, nm := range doc.ExtensionsUsed {
+		if nm == name {
+			return
+		}
+	}
+	doc.ExtensionsUsed = append(doc.ExtensionsUsed, name)
+}
+
+// toFloat32Vec3 converts vectors to the float32 layout required by glTF accessors.
+func toFloat32Vec3[T float64 | float32](vs []vec3.Vec[T]) [][3]float32 {
+	r := make([][3]float32, len(vs))
+	for i, v := range vs {
+		r[i] = [3]float32{float32(v[0]), float32(v[1]), float32(v[2])}
+	}
+	return r
+}
+
+func toFloat32Vec2[T float64 | float32](vs []vec2.Vec[T]) [][2]float32 {
+	r := make([][2]float32, len(vs))
+	for i, v := range vs {
+		r[i] = [2]float32{float32(v[0]), float32(v[1])}
+	}
+	return r
+}
+
+func toFloat32Vec4[T float64 | float32](vs []vec4.Vec[T]) [][4]float32 {
+	r := make([][4]float32, len(vs))
+	for i, v := range vs {
+		r[i] = [4]float32{float32(v[0]), float32(v[1]), float32(v[2]), float32(v[3])}
+	}
+	return r
+}
+
+// hasTangents reports whether the node has a complete tangent frame, glTF
+// requires NORMAL next to TANGENT.
+func hasTangents[T float64 | float32](nd *MeshNode[T]) bool {
+	return len(nd.Tangents) > 0 && len(nd.Tangents) == len(nd.Vertices) && len(nd.Normals) == len(nd.Vertices)
 }
 
 func buildMeshBuffer[T float64 | float32](ctx *buildContext, buffer *gltf.Buffer, bufferViews []*gltf.BufferView, nd *MeshNode[T]) []*gltf.BufferView {
@@ -124,18 +193,25 @@ func buildMeshBuffer[T float64 | float32](ctx *buildContext, buffer *gltf.Buffer
 	indecs := &gltf.BufferView{}
 	startLen := buffer.ByteLength
 	indecs.ByteOffset = startLen
+	short := shortIndices(nd)
 	for _, g := range nd.FaceGroup {
 		for _, f := range g.Faces {
-			binary.Write(buf, binary.LittleEndian, f.Vertex)
+			if short {
+				binary.Write(buf, binary.LittleEndian, [3]uint16{uint16(f.Vertex[0]), uint16(f.Vertex[1]), uint16(f.Vertex[2])})
+			} else {
+				binary.Write(buf, binary.LittleEndian, f.Vertex)
+			}
 		}
 	}
 	indecs.ByteLength = buf.Len()
 	indecs.Buffer = 0
 	bufferViews = append(bufferViews, indecs)
+	// keep the float attributes aligned
+	buf.Write(make([]byte, calcPadding(startLen+buf.Len(), 4)))
 
 	postions := &gltf.BufferView{}
 	postions.ByteOffset = (buf.Len()) + startLen
-	binary.Write(buf, binary.LittleEndian, nd.Vertices)
+	binary.Write(buf, binary.LittleEndian, toFloat32Vec3(nd.Vertices))
 	postions.ByteLength = (buf.Len()) - postions.ByteOffset + startLen
 	postions.Buffer = 0
 	ctx.bvPos = len(bufferViews)
@@ -145,7 +221,7 @@ func buildMeshBuffer[T float64 | float32](ctx *buildContext, buffer *gltf.Buffer
 	ctx.bvTex = len(bufferViews)
 	if len(nd.TexCoords) > 0 {
 		texcood.ByteOffset = (buf.Len()) + startLen
-		binary.Write(buf, binary.LittleEndian, nd.TexCoords)
+		binary.Write(buf, binary.LittleEndian, toFloat32Vec2(nd.TexCoords))
 		texcood.ByteLength = (buf.Len()) - texcood.ByteOffset + startLen
 		texcood.Buffer = 0
 		bufferViews = append(bufferViews, texcood)
@@ -155,11 +231,35 @@ func buildMeshBuffer[T float64 | float32](ctx *buildContext, buffer *gltf.Buffer
 	ctx.bvNorm = len(bufferViews)
 	if len(nd.Normals) > 0 {
 		normalView.ByteOffset = (buf.Len()) + startLen
-		binary.Write(buf, binary.LittleEndian, nd.Normals)
+		binary.Write(buf, binary.LittleEndian, toFloat32Vec3(nd.Normals))
 		normalView.ByteLength = (buf.Len()) - normalView.ByteOffset + startLen
 		normalView.Buffer = 0
 		bufferViews = append(bufferViews, normalView)
 	}
+
+	tangentView := &gltf.BufferView{}
+	ctx.bvTang = len(bufferViews)
+	if hasTangents(nd) {
+		tangentView.ByteOffset = (buf.Len()) + startLen
+		binary.Write(buf, binary.LittleEndian, toFloat32Vec4(nd.Tangents))
+		tangentView.ByteLength = (buf.Len()) - tangentView.ByteOffset + startLen
+		tangentView.Buffer = 0
+		bufferViews = append(bufferViews, tangentView)
+	}
+
+	featureView := &gltf.BufferView{}
+	ctx.bvFeat = len(bufferViews)
+	if hasFeatureIds(nd) {
+		ids := make([]float32, len(nd.FeatureIds))
+		for i, id := range nd.FeatureIds {
+			ids[i] = float32(id)
+		}
+		featureView.ByteOffset = (buf.Len()) + startLen
+		binary.Write(buf, binary.LittleEndian, ids)
+		featureView.ByteLength = (buf.Len()) - featureView.ByteOffset + startLen
+		featureView.Buffer = 0
+		bufferViews = append(bufferViews, featureView)
+	}
 	buffer.ByteLength += (buf.Len())
 	buffer.Data = append(buffer.Data, buf.Bytes()...)
 
@@ -184,7 +284,7 @@ func buildOutlineBuffer[T float64 | float32](ctx *buildContext, buffer *gltf.Buf
 
 	postions := &gltf.BufferView{}
 	postions.ByteOffset = (buf.Len()) + startLen
-	binary.Write(buf, binary.LittleEndian, nd.Vertices)
+	binary.Write(buf, binary.LittleEndian, toFloat32Vec3(nd.Vertices))
 	postions.ByteLength = (buf.Len()) - postions.ByteOffset + startLen
 	postions.Buffer = 0
 	ctx.bvPos = len(bufferViews)
@@ -282,12 +382,27 @@ func buildMesh[T float64 | float32](ctx *buildContext, accessors []*gltf.Accesso
 			tmp++
 			ps.Attributes["NORMAL"] = tmp
 		}
+		if hasTangents(nd) {
+			tmp++
+			ps.Attributes["TANGENT"] = tmp
+		}
+		if hasFeatureIds(nd) {
+			tmp++
+			ps.Attributes["_FEATURE_ID_0"] = tmp
+			ps.Extensions = gltf.Extensions{EXT_MESH_FEATURES: map[string]interface{}{
+				"featureIds": []interface{}{map[string]interface{}{"featureCount": featureCount(nd), "attribute": 0}},
+			}}
+		}
 		ps.Mode = gltf.PrimitiveTriangles
 		mesh.Primitives = append(mesh.Primitives, ps)
 
 		indexacc := &gltf.Accessor{}
 		indexacc.ComponentType = gltf.ComponentUint
 		indexacc.ByteOffset = start * 12
+		if shortIndices(nd) {
+			indexacc.ComponentType = gltf.ComponentUshort
+			indexacc.ByteOffset = start * 6
+		}
 		indexacc.Count = len(patch.Faces) * 3
 		start += len(patch.Faces)
 		bfindex := ctx.bvIndex
@@ -326,6 +441,26 @@ func buildMesh[T float64 | float32](ctx *buildContext, accessors []*gltf.Accesso
 		nlacc.BufferView = &bvNorm
 		accessors = append(accessors, nlacc)
 	}
+
+	if hasTangents(nd) {
+		tgacc := &gltf.Accessor{}
+		tgacc.ComponentType = gltf.ComponentFloat
+		tgacc.Type = gltf.AccessorVec4
+		tgacc.Count = len(nd.Tangents)
+		bvTang := ctx.bvTang
+		tgacc.BufferView = &bvTang
+		accessors = append(accessors, tgacc)
+	}
+
+	if hasFeatureIds(nd) {
+		ftacc := &gltf.Accessor{}
+		ftacc.ComponentType = gltf.ComponentFloat
+		ftacc.Type = gltf.AccessorScalar
+		ftacc.Count = len(nd.FeatureIds)
+		bvFeat := ctx.bvFeat
+		ftacc.BufferView = &bvFeat
+		accessors = append(accessors, ftacc)
+	}
 	return mesh, accessors
 }
 
@@ -347,6 +482,9 @@ func buildGltf[T float64 | float32](doc *gltf.Document, mh *BaseMesh[T], trans [
 			var mesh *gltf.Mesh
 			mesh, doc.Accessors = buildMesh(ctx, doc.Accessors, mstNd)
 			doc.Meshes = append(doc.Meshes, mesh)
+			if hasFeatureIds(mstNd) {
+				addExtensionUsed(doc, EXT_MESH_FEATURES)
+			}
 		}
 
 		if trans == nil {
@@ -592,16 +730,7 @@ func fillMaterials[T float64 | float32](doc *gltf.Document, mts []MeshMaterial)
 		doc.Materials = append(doc.Materials, gm)
 	}
 	if useExtension {
-		has := false
-		for _, nm := range doc.ExtensionsUsed {
-			if nm == specular.ExtensionName {
-				has = true
-				break
-			}
-		}
-		if !has {
-			doc.ExtensionsUsed = append(doc.ExtensionsUsed, specular.ExtensionName)
-		}
+		addExtensionUsed(doc, specular.ExtensionName)
 	}
 	return nil
 }
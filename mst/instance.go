@@ -0,0 +1,397 @@
+package mst
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"slices"
+
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/go3d/vec4"
+)
+
+// InstanceOptions controls Instance.
+type InstanceOptions struct {
+	// MinCount is the number of copies geometry needs to become an instance.
+	MinCount int
+	// Tolerance is how far, relative to the size of a node, a transformed
+	// vertex may be off its copy.
+	Tolerance float64
+	// Similarity also matches copies of a different uniform scale.
+	Similarity bool
+}
+
+var DefaultInstanceOptions = InstanceOptions{MinCount: 2, Tolerance: 1e-4, Similarity: true}
+
+// InstanceStats reports the nodes replaced by instances.
+type InstanceStats struct {
+	Nodes     int // nodes converted
+	Instances int // instance meshes created
+}
+
+// nodeShape is a node with its matrix baked and its points centered.
+type nodeShape struct {
+	points   []vec3.Vec[float64]
+	normals  []vec3.Vec[float64]
+	features []uint32
+	center   vec3.Vec[float64]
+	radius   float64 // root mean square distance to the center
+}
+
+func newNodeShape[T float64 | float32](n *MeshNode[T]) *nodeShape {
+	var tr *vertexTransform[T]
+	if n.Mat != nil {
+		tr = newVertexTransform(n.Mat)
+	}
+	s := &nodeShape{points: make([]vec3.Vec[float64], len(n.Vertices))}
+	for i, v := range n.Vertices {
+		if tr != nil {
+			v = tr.point(v)
+		}
+		s.points[i] = vec3.Vec[float64]{float64(v[0]), float64(v[1]), float64(v[2])}
+		s.center.Add(&s.points[i])
+	}
+	if len(s.points) > 0 {
+		s.center.Scale(1 / float64(len(s.points)))
+	}
+	for i := range s.points {
+		s.points[i].Sub(&s.center)
+		s.radius += s.points[i].LengthSqr()
+	}
+	if len(s.points) > 0 {
+		s.radius = math.Sqrt(s.radius / float64(len(s.points)))
+	}
+	if len(n.FeatureIds) == len(n.Vertices) {
+		s.features = n.FeatureIds
+	}
+	if len(n.Normals) == len(n.Vertices) {
+		s.normals = make([]vec3.Vec[float64], len(n.Normals))
+		for i, vn := range n.Normals {
+			if tr != nil {
+				vn = tr.normalVec(vn)
+			}
+			s.normals[i] = vec3.Vec[float64]{float64(vn[0]), float64(vn[1]), float64(vn[2])}
+		}
+	}
+	return s
+}
+
+// CanonicalHash hashes the geometry of the node so that copies moved,
+// rotated and, when scaleInvariant, uniformly scaled hash the same: it
+// covers the topology, uvs, colors, feature ids, materials and the distances of the
+// vertices to their centroid. Copies have to list their vertices and faces
+// in the same order. Equal hashes are candidates only, see Instance.
+func (n *MeshNode[T]) CanonicalHash(scaleInvariant bool) uint64 {
+	return canonicalHash(n, newNodeShape(n), scaleInvariant)
+}
+
+func canonicalHash[T float64 | float32](n *MeshNode[T], s *nodeShape, scaleInvariant bool) uint64 {
+	h := fnv.New64a()
+	put := func(vs ...any) {
+		for _, v := range vs {
+			binary.Write(h, binary.LittleEndian, v)
+		}
+	}
+	// coarse buckets, the exact match is checked on the transform
+	quant := func(f float64) int64 { return int64(math.Round(f * 1e3)) }
+
+	put(uint32(len(n.Vertices)), uint32(len(n.Normals)), uint32(len(n.TexCoords)), uint32(len(n.Colors)), uint32(len(n.FeatureIds)))
+	for _, g := range n.FaceGroup {
+		put(int64(g.Batchid), uint32(len(g.Faces)))
+		for _, f := range g.Faces {
+			put(f.Vertex)
+			if f.Normal != nil {
+				put(*f.Normal)
+			}
+			if f.Uv != nil {
+				put(*f.Uv)
+			}
+		}
+	}
+	for _, g := range n.EdgeGroup {
+		put(int64(g.Batchid), uint32(len(g.Edges)))
+		for _, e := range g.Edges {
+			put(int64(e[0]), int64(e[1]))
+		}
+	}
+	for _, vt := range n.TexCoords {
+		put(quant(float64(vt[0])), quant(float64(vt[1])))
+	}
+	for _, c := range n.Colors {
+		put(c)
+	}
+	put(n.FeatureIds)
+	scale := 1.0
+	if scaleInvariant && s.radius > 0 {
+		scale = 1 / s.radius
+	}
+	if !scaleInvariant {
+		put(quant(s.radius))
+	}
+	for _, p := range s.points {
+		put(quant(p.Length() * scale))
+	}
+	return h.Sum64()
+}
+
+// similarity solves for the rotation and scale taking the centered points
+// of a onto those of b (Horn's quaternion method) and reports whether every
+// vertex lands within tol.
+func similarity(a, b *nodeShape, allowScale bool, tol float64) (r [3][3]float64, scale float64, ok bool) {
+	if len(a.points) != len(b.points) || a.radius == 0 || b.radius == 0 || !slices.Equal(a.features, b.features) {
+		return r, 0, false
+	}
+	scale = 1
+	if allowScale {
+		scale = b.radius / a.radius
+	} else if math.Abs(a.radius-b.radius) > tol*a.radius {
+		return r, 0, false
+	}
+
+	var m [3][3]float64
+	for i, p := range a.points {
+		q := b.points[i]
+		for j := range 3 {
+			for k := range 3 {
+				m[j][k] += p[j] * q[k]
+			}
+		}
+	}
+	sxx, sxy, sxz := m[0][0], m[0][1], m[0][2]
+	syx, syy, syz := m[1][0], m[1][1], m[1][2]
+	szx, szy, szz := m[2][0], m[2][1], m[2][2]
+	nm := [4][4]float64{
+		{sxx + syy + szz, syz - szy, szx - sxz, sxy - syx},
+		{syz - szy, sxx - syy - szz, sxy + syx, szx + sxz},
+		{szx - sxz, sxy + syx, -sxx + syy - szz, syz + szy},
+		{sxy - syx, szx + sxz, syz + szy, -sxx - syy + szz},
+	}
+	w, x, y, z := largestEigenvector(nm)
+	r = [3][3]float64{
+		{1 - 2*(y*y+z*z), 2 * (x*y - w*z), 2 * (x*z + w*y)},
+		{2 * (x*y + w*z), 1 - 2*(x*x+z*z), 2 * (y*z - w*x)},
+		{2 * (x*z - w*y), 2 * (y*z + w*x), 1 - 2*(x*x+y*y)},
+	}
+
+	maxErr := tol * b.radius
+	for i, p := range a.points {
+		for j := range 3 {
+			v := scale * (r[j][0]*p[0] + r[j][1]*p[1] + r[j][2]*p[2])
+			if math.Abs(v-b.points[i][j]) > maxErr {
+				return r, 0, false
+			}
+		}
+	}
+	if (a.normals == nil) != (b.normals == nil) {
+		return r, 0, false
+	}
+	for i, vn := range a.normals {
+		for j := range 3 {
+			v := r[j][0]*vn[0] + r[j][1]*vn[1] + r[j][2]*vn[2]
+			if math.Abs(v-b.normals[i][j]) > 1e-3 {
+				return r, 0, false
+			}
+		}
+	}
+	return r, scale, true
+}
+
+// largestEigenvector returns the unit eigenvector of the largest eigenvalue
+// of a symmetric matrix using Jacobi rotations.
+func largestEigenvector(a [4][4]float64) (float64, float64, float64, float64) {
+	v := [4][4]float64{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}
+	for sweep := 0; sweep < 50; sweep++ {
+		off := 0.0
+		for p := 0; p < 4; p++ {
+			for q := p + 1; q < 4; q++ {
+				off += a[p][q] * a[p][q]
+			}
+		}
+		if off < 1e-30 {
+			break
+		}
+		for p := 0; p < 4; p++ {
+			for q := p + 1; q < 4; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < 4; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := 0; k < 4; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+				for k := 0; k < 4; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p], v[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+				}
+			}
+		}
+	}
+	best := 0
+	for i := 1; i < 4; i++ {
+		if a[i][i] > a[best][best] {
+			best = i
+		}
+	}
+	return v[0][best], v[1][best], v[2][best], v[3][best]
+}
+
+type instanceCluster[T float64 | float32] struct {
+	hash    uint64
+	proto   int
+	members []int
+	mats    []*mat4.Mat[T]
+}
+
+// Instance finds nodes that are moved, rotated or scaled copies of each
+// other and replaces every set of at least MinCount copies by an
+// InstanceNode. The first copy, centered at its centroid, becomes the
+// instance mesh with the materials it uses, the transforms place it at
+// every copy and Features keeps the index of the node each came from.
+func (m *Mesh[T]) Instance(opts InstanceOptions) InstanceStats {
+	var stats InstanceStats
+	shapes := make([]*nodeShape, len(m.Nodes))
+	buckets := map[uint64][]*instanceCluster[T]{}
+	var clusters []*instanceCluster[T]
+	for i, nd := range m.Nodes {
+		s := newNodeShape(nd)
+		shapes[i] = s
+		if s.radius == 0 {
+			continue
+		}
+		h := canonicalHash(nd, s, opts.Similarity)
+		var hit *instanceCluster[T]
+		var r [3][3]float64
+		var scale float64
+		for _, c := range buckets[h] {
+			var ok bool
+			if r, scale, ok = similarity(shapes[c.proto], s, opts.Similarity, opts.Tolerance); ok {
+				hit = c
+				break
+			}
+		}
+		if hit == nil {
+			hit = &instanceCluster[T]{hash: h, proto: i}
+			buckets[h] = append(buckets[h], hit)
+			clusters = append(clusters, hit)
+			r, scale = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, 1
+		}
+		mt := &mat4.Mat[T]{}
+		for c := range 3 {
+			for k := range 3 {
+				mt[c][k] = T(scale * r[k][c])
+			}
+			mt[3][c] = T(s.center[c])
+		}
+		mt[3][3] = 1
+		hit.members = append(hit.members, i)
+		hit.mats = append(hit.mats, mt)
+	}
+
+	minCount := max(opts.MinCount, 1)
+	gone := make([]bool, len(m.Nodes))
+	for _, c := range clusters {
+		if len(c.members) < minCount {
+			continue
+		}
+		inst := &InstanceMesh[T]{Transfors: c.mats, Hash: c.hash, Mesh: m.prototype(m.Nodes[c.proto], shapes[c.proto])}
+		bbox := vec3.MinBox
+		for _, i := range c.members {
+			gone[i] = true
+			inst.Features = append(inst.Features, uint64(i))
+			for _, p := range shapes[i].points {
+				w := vec3.Add(&p, &shapes[i].center)
+				bbox.Extend(&w)
+			}
+		}
+		inst.BBox = &[6]float64{bbox.Min[0], bbox.Min[1], bbox.Min[2], bbox.Max[0], bbox.Max[1], bbox.Max[2]}
+		m.InstanceNode = append(m.InstanceNode, inst)
+		stats.Instances++
+		stats.Nodes += len(c.members)
+	}
+	nodes := m.Nodes[:0]
+	for i, nd := range m.Nodes {
+		if !gone[i] {
+			nodes = append(nodes, nd)
+		}
+	}
+	m.Nodes = nodes
+	return stats
+}
+
+// prototype copies a node centered at its centroid, with the materials it
+// uses renumbered.
+func (m *Mesh[T]) prototype(n *MeshNode[T], s *nodeShape) *BaseMesh[T] {
+	bm := &BaseMesh[T]{Code: m.Code}
+	nd := &MeshNode[T]{
+		Vertices:   make([]vec3.Vec[T], len(s.points)),
+		TexCoords:  n.TexCoords,
+		Colors:     n.Colors,
+		FeatureIds: n.FeatureIds,
+	}
+	for i, p := range s.points {
+		nd.Vertices[i] = vec3.Vec[T]{T(p[0]), T(p[1]), T(p[2])}
+	}
+	// the points are placed by the matrix already, the directions follow
+	var tr *vertexTransform[T]
+	if n.Mat != nil {
+		tr = newVertexTransform(n.Mat)
+	}
+	switch {
+	case s.normals != nil:
+		nd.Normals = make([]vec3.Vec[T], len(s.normals))
+		for i, vn := range s.normals {
+			nd.Normals[i] = vec3.Vec[T]{T(vn[0]), T(vn[1]), T(vn[2])}
+		}
+	case tr != nil && len(n.Normals) > 0:
+		nd.Normals = make([]vec3.Vec[T], len(n.Normals))
+		for i, vn := range n.Normals {
+			nd.Normals[i] = tr.normalVec(vn)
+		}
+	default:
+		nd.Normals = n.Normals
+	}
+	nd.Tangents = n.Tangents
+	if tr != nil && len(n.Tangents) > 0 {
+		nd.Tangents = make([]vec4.Vec[T], len(n.Tangents))
+		for i, tn := range n.Tangents {
+			nd.Tangents[i] = tr.tangent(tn)
+		}
+	}
+	remap := map[int]int{}
+	batch := func(id int) int {
+		if id < 0 || id >= len(m.Materials) {
+			return id
+		}
+		if j, ok := remap[id]; ok {
+			return j
+		}
+		remap[id] = len(bm.Materials)
+		bm.Materials = append(bm.Materials, m.Materials[id])
+		return remap[id]
+	}
+	for _, g := range n.FaceGroup {
+		fg := &MeshTriangle{Batchid: batch(g.Batchid)}
+		for _, f := range g.Faces {
+			c := *f
+			fg.Faces = append(fg.Faces, &c)
+		}
+		nd.FaceGroup = append(nd.FaceGroup, fg)
+	}
+	for _, g := range n.EdgeGroup {
+		nd.EdgeGroup = append(nd.EdgeGroup, &MeshOutline{Batchid: batch(g.Batchid), Edges: g.Edges})
+	}
+	bm.Nodes = []*MeshNode[T]{nd}
+	return bm
+}
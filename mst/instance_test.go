@@ -0,0 +1,155 @@
+package mst
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// placed returns a matrix rotating by angle around the unit axis, scaling
+// by s and moving to t.
+func placed(axis vec3.Vec[float64], angle, s float64, t vec3.Vec[float64]) *mat4.Mat[float64] {
+	c, sn := math.Cos(angle), math.Sin(angle)
+	x, y, z := axis[0], axis[1], axis[2]
+	r := [3][3]float64{
+		{c + x*x*(1-c), x*y*(1-c) - z*sn, x*z*(1-c) + y*sn},
+		{y*x*(1-c) + z*sn, c + y*y*(1-c), y*z*(1-c) - x*sn},
+		{z*x*(1-c) - y*sn, z*y*(1-c) + x*sn, c + z*z*(1-c)},
+	}
+	m := &mat4.Mat[float64]{}
+	for col := range 3 {
+		for row := range 3 {
+			m[col][row] = s * r[row][col]
+		}
+		m[3][col] = t[col]
+	}
+	m[3][3] = 1
+	return m
+}
+
+// bake moves the vertices of a node by its matrix.
+func bake(nd *MeshNode[float64]) *MeshNode[float64] {
+	for i := range nd.Vertices {
+		nd.Mat.TransformVec3(&nd.Vertices[i])
+	}
+	nd.Mat = nil
+	return nd
+}
+
+func instanceMesh() *Mesh[float64] {
+	ms := NewMesh[float64]()
+	ms.Materials = []MeshMaterial{&BaseMaterial{Color: [3]byte{1, 2, 3}}, &BaseMaterial{Color: [3]byte{4, 5, 6}}}
+	d := 1 / math.Sqrt(3)
+	a := cubeNode()
+	a.FaceGroup[0].Batchid = 1
+	b := cubeNode()
+	b.FaceGroup[0].Batchid = 1
+	b.Mat = placed(vec3.Vec[float64]{0, 0, 1}, math.Pi/2, 1, vec3.Vec[float64]{5, 0, 0})
+	c := cubeNode()
+	c.FaceGroup[0].Batchid = 1
+	c.Mat = placed(vec3.Vec[float64]{d, d, d}, 0.7, 2, vec3.Vec[float64]{-3, 4, 1})
+	bake(c)
+	// a mirrored copy is no rotation
+	e := cubeNode()
+	e.FaceGroup[0].Batchid = 1
+	e.Mat = &mat4.Mat[float64]{{-1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {9, 9, 9, 1}}
+	ms.Nodes = append(ms.Nodes, a, quadNode(), b, c, e)
+	return ms
+}
+
+func TestInstance(t *testing.T) {
+	ms := instanceMesh()
+	want := []*nodeShape{newNodeShape(ms.Nodes[0]), newNodeShape(ms.Nodes[2]), newNodeShape(ms.Nodes[3])}
+	assert.Equal(t, ms.Nodes[0].CanonicalHash(true), ms.Nodes[3].CanonicalHash(true))
+	assert.NotEqual(t, ms.Nodes[0].CanonicalHash(false), ms.Nodes[3].CanonicalHash(false))
+
+	stats := ms.Instance(DefaultInstanceOptions)
+	assert.Equal(t, InstanceStats{Nodes: 3, Instances: 1}, stats)
+	assert.Equal(t, 2, len(ms.Nodes))
+	inst := ms.InstanceNode[0]
+	assert.Equal(t, []uint64{0, 2, 3}, inst.Features)
+	// the mirrored cube hashes alike but is no rotation of the others
+	assert.Equal(t, inst.Hash, ms.Nodes[1].CanonicalHash(true))
+	assert.Equal(t, 1, len(inst.Mesh.Materials))
+	assert.Equal(t, [3]byte{4, 5, 6}, inst.Mesh.Materials[0].GetColor())
+	assert.Equal(t, 0, inst.Mesh.Nodes[0].FaceGroup[0].Batchid)
+
+	// the transforms put the prototype back on every copy
+	proto := inst.Mesh.Nodes[0]
+	for k, mt := range inst.Transfors {
+		for i, v := range proto.Vertices {
+			p := mt.MulVec3(&v)
+			w := vec3.Add(&want[k].points[i], &want[k].center)
+			for j := range 3 {
+				assert.InDelta(t, w[j], p[j], 1e-6)
+			}
+		}
+	}
+	bbox := vec3.MinBox
+	for _, s := range want {
+		for _, p := range s.points {
+			w := vec3.Add(&p, &s.center)
+			bbox.Extend(&w)
+		}
+	}
+	assert.Equal(t, &[6]float64{bbox.Min[0], bbox.Min[1], bbox.Min[2], bbox.Max[0], bbox.Max[1], bbox.Max[2]}, inst.BBox)
+	assert.InDelta(t, 5.0, inst.BBox[3], 1e-9)
+
+	// without scaling the large copy stays a node
+	ms = instanceMesh()
+	stats = ms.Instance(InstanceOptions{MinCount: 2, Tolerance: 1e-4})
+	assert.Equal(t, InstanceStats{Nodes: 2, Instances: 1}, stats)
+	assert.Equal(t, 3, len(ms.Nodes))
+	assert.Equal(t, []uint64{0, 2}, ms.InstanceNode[0].Features)
+
+	ms = instanceMesh()
+	assert.Equal(t, InstanceStats{}, ms.Instance(InstanceOptions{MinCount: 4, Tolerance: 1e-4, Similarity: true}))
+	assert.Equal(t, 5, len(ms.Nodes))
+
+	// face normals of turned copies turn with the prototype points
+	ms = NewMesh[float64]()
+	for _, x := range []float64{0, 5} {
+		nd := cubeNode()
+		nd.Normals = []vec3.Vec[float64]{{1, 0, 0}}
+		for _, f := range nd.FaceGroup[0].Faces {
+			f.Normal = &[3]uint32{}
+		}
+		nd.Mat = placed(vec3.Vec[float64]{0, 0, 1}, math.Pi/2, 1, vec3.Vec[float64]{x, 0, 0})
+		ms.Nodes = append(ms.Nodes, nd)
+	}
+	assert.Equal(t, 1, ms.Instance(DefaultInstanceOptions).Instances)
+	proto = ms.InstanceNode[0].Mesh.Nodes[0]
+	assert.Nil(t, proto.Mat)
+	assert.InDelta(t, 0, proto.Normals[0][0], 1e-12)
+	assert.InDelta(t, 1, proto.Normals[0][1], 1e-12)
+}
+
+func TestInstanceFeatureIds(t *testing.T) {
+	// two batches of two cubes each, the second batch a moved copy
+	ms := NewMesh[float64]()
+	for _, x := range []float64{0, 2, 10, 12} {
+		nd := cubeNode()
+		nd.Mat = placed(vec3.Vec[float64]{0, 0, 1}, 0, 1, vec3.Vec[float64]{x, 0, 0})
+		ms.Nodes = append(ms.Nodes, nd)
+	}
+	ms.Batch(BatchOptions{MaxVertices: 16})
+	assert.Equal(t, 2, len(ms.Nodes))
+
+	// the batches differ in their features only
+	want := [][]uint32{ms.Nodes[0].FeatureIds, ms.Nodes[1].FeatureIds}
+	assert.NotEqual(t, ms.Nodes[0].CanonicalHash(false), ms.Nodes[1].CanonicalHash(false))
+	assert.Equal(t, InstanceStats{}, ms.Instance(InstanceOptions{MinCount: 2, Tolerance: 1e-4}))
+	for i, nd := range ms.Nodes {
+		assert.Equal(t, want[i], nd.FeatureIds)
+	}
+
+	ms.Nodes[1].FeatureIds = slices.Clone(want[0])
+	assert.Equal(t, InstanceStats{Nodes: 2, Instances: 1}, ms.Instance(InstanceOptions{MinCount: 2, Tolerance: 1e-4}))
+	proto := ms.InstanceNode[0].Mesh.Nodes[0]
+	assert.Equal(t, want[0], proto.FeatureIds)
+	assert.Equal(t, len(proto.Vertices), len(proto.FeatureIds))
+}
@@ -0,0 +1,227 @@
+package mst
+
+import (
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// MeshReport measures the surface and the topology of geometry. Vertices at
+// the same position count as one, so seams of split normals or uvs are no
+// boundaries.
+type MeshReport struct {
+	Vertices   int `json:"vertices"` // distinct positions used by faces
+	Faces      int `json:"faces"`
+	Degenerate int `json:"degenerate"` // faces without area
+	Edges      int `json:"edges"`
+
+	Area float64 `json:"area"`
+	// AreaByBatch splits the area by Batchid. For a mesh it covers its own
+	// nodes, the instances report theirs.
+	AreaByBatch map[int]float64 `json:"areaByBatch"`
+	// Volume is signed, positive for closed geometry facing outwards.
+	Volume float64 `json:"volume"`
+
+	BoundaryEdges    int `json:"boundaryEdges"`    // edges of a single face
+	NonManifoldEdges int `json:"nonManifoldEdges"` // edges of more than two faces
+	// InconsistentEdges are edges of two faces running them the same way.
+	InconsistentEdges int `json:"inconsistentEdges"`
+	Holes             int `json:"holes"` // connected runs of boundary edges
+	Components        int `json:"components"`
+	// EulerCharacteristic is V - E + F, counting faces with three distinct
+	// vertices. A closed component without handles adds 2.
+	EulerCharacteristic int `json:"eulerCharacteristic"`
+
+	Closed   bool `json:"closed"`   // no boundary and no non-manifold edges
+	Oriented bool `json:"oriented"` // no inconsistent edges
+
+	Nodes     []MeshReport `json:"nodes,omitempty"`
+	Instances []MeshReport `json:"instances,omitempty"`
+}
+
+func newMeshReport() MeshReport {
+	return MeshReport{AreaByBatch: map[int]float64{}, Closed: true, Oriented: true}
+}
+
+// add sums o into r, with its areas by Batchid when batches is set.
+func (r *MeshReport) add(o *MeshReport, batches bool) {
+	r.Vertices += o.Vertices
+	r.Faces += o.Faces
+	r.Degenerate += o.Degenerate
+	r.Edges += o.Edges
+	r.Area += o.Area
+	r.Volume += o.Volume
+	r.BoundaryEdges += o.BoundaryEdges
+	r.NonManifoldEdges += o.NonManifoldEdges
+	r.InconsistentEdges += o.InconsistentEdges
+	r.Holes += o.Holes
+	r.Components += o.Components
+	r.EulerCharacteristic += o.EulerCharacteristic
+	r.Closed = r.Closed && o.Closed
+	r.Oriented = r.Oriented && o.Oriented
+	if batches {
+		for id, a := range o.AreaByBatch {
+			r.AreaByBatch[id] += a
+		}
+	}
+}
+
+// unionFind joins vertex indices into sets.
+type unionFind []uint32
+
+func newUnionFind(n int) unionFind {
+	u := make(unionFind, n)
+	for i := range u {
+		u[i] = uint32(i)
+	}
+	return u
+}
+
+func (u unionFind) find(i uint32) uint32 {
+	for u[i] != i {
+		u[i] = u[u[i]]
+		i = u[i]
+	}
+	return i
+}
+
+func (u unionFind) union(a, b uint32) {
+	u[u.find(a)] = u.find(b)
+}
+
+// Measure reports on the node placed by its matrix.
+func (n *MeshNode[T]) Measure() MeshReport {
+	return n.measure(n.Mat)
+}
+
+// measure reports on the node placed by mt. Volumes of mirrored nodes are
+// negated, as their faces are drawn flipped.
+func (n *MeshNode[T]) measure(mt *mat4.Mat[T]) MeshReport {
+	r := newMeshReport()
+	var tr *vertexTransform[T]
+	if mt != nil {
+		tr = newVertexTransform(mt)
+	}
+	pos := make([]vec3.Vec[float64], len(n.Vertices))
+	for i, v := range n.Vertices {
+		if tr != nil {
+			v = tr.point(v)
+		}
+		pos[i] = vec3.Vec[float64]{float64(v[0]), float64(v[1]), float64(v[2])}
+	}
+	canon := positionCanon(n)
+
+	type edgeUse struct {
+		faces   int
+		forward int // faces running the edge from its lower vertex
+	}
+	edges := map[[2]uint32]*edgeUse{}
+	var order [][2]uint32
+	used := make([]bool, len(n.Vertices))
+	uf := newUnionFind(len(n.Vertices))
+	faces := 0
+	for _, g := range n.FaceGroup {
+		for _, f := range g.Faces {
+			r.Faces++
+			p0, p1, p2 := &pos[f.Vertex[0]], &pos[f.Vertex[1]], &pos[f.Vertex[2]]
+			e1, e2 := vec3.Sub(p1, p0), vec3.Sub(p2, p0)
+			c := vec3.Cross(&e1, &e2)
+			area := c.Length() / 2
+			if area == 0 {
+				r.Degenerate++
+			}
+			r.Area += area
+			r.AreaByBatch[g.Batchid] += area
+			c12 := vec3.Cross(p1, p2)
+			r.Volume += vec3.Dot(p0, &c12) / 6
+
+			a, b, cv := canon[f.Vertex[0]], canon[f.Vertex[1]], canon[f.Vertex[2]]
+			if a == b || b == cv || cv == a {
+				continue
+			}
+			faces++
+			for k, v := range [3]uint32{a, b, cv} {
+				w := [3]uint32{a, b, cv}[(k+1)%3]
+				used[v] = true
+				uf.union(v, w)
+				key := [2]uint32{min(v, w), max(v, w)}
+				e, ok := edges[key]
+				if !ok {
+					e = &edgeUse{}
+					edges[key] = e
+					order = append(order, key)
+				}
+				e.faces++
+				if v < w {
+					e.forward++
+				}
+			}
+		}
+	}
+	if tr != nil && tr.mirror {
+		r.Volume = -r.Volume
+	}
+
+	holes := newUnionFind(len(n.Vertices))
+	onBoundary := make([]bool, len(n.Vertices))
+	for _, key := range order {
+		e := edges[key]
+		switch {
+		case e.faces == 1:
+			r.BoundaryEdges++
+			holes.union(key[0], key[1])
+			onBoundary[key[0]], onBoundary[key[1]] = true, true
+		case e.faces > 2:
+			r.NonManifoldEdges++
+		case e.forward != 1:
+			r.InconsistentEdges++
+		}
+	}
+	for i := range used {
+		if used[i] {
+			r.Vertices++
+			if uf.find(uint32(i)) == uint32(i) {
+				r.Components++
+			}
+		}
+		if onBoundary[i] && holes.find(uint32(i)) == uint32(i) {
+			r.Holes++
+		}
+	}
+	r.Edges = len(edges)
+	r.EulerCharacteristic = r.Vertices - r.Edges + faces
+	r.Closed = faces > 0 && r.BoundaryEdges == 0 && r.NonManifoldEdges == 0
+	r.Oriented = r.InconsistentEdges == 0
+	return r
+}
+
+// Measure reports on the whole mesh, with a report for every node and for
+// every instance mesh over all its copies.
+func (m *Mesh[T]) Measure() MeshReport {
+	total := newMeshReport()
+	for _, nd := range m.Nodes {
+		r := nd.Measure()
+		total.add(&r, true)
+		total.Nodes = append(total.Nodes, r)
+	}
+	for _, inst := range m.InstanceNode {
+		if inst.Mesh == nil {
+			continue
+		}
+		ir := newMeshReport()
+		for _, tf := range inst.Transfors {
+			for _, nd := range inst.Mesh.Nodes {
+				mt := tf
+				if nd.Mat != nil {
+					mt = mat4.AssignMul(tf, nd.Mat)
+				}
+				r := nd.measure(mt)
+				ir.add(&r, true)
+			}
+		}
+		ir.Closed = ir.Closed && ir.Faces > 0
+		total.add(&ir, false)
+		total.Instances = append(total.Instances, ir)
+	}
+	total.Closed = total.Closed && total.Faces > 0
+	return total
+}
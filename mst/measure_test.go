@@ -0,0 +1,100 @@
+package mst
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+func TestMeasureNode(t *testing.T) {
+	r := cubeNode().Measure()
+	assert.Equal(t, 8, r.Vertices)
+	assert.Equal(t, 12, r.Faces)
+	assert.Equal(t, 18, r.Edges)
+	assert.InDelta(t, 6, r.Area, 1e-12)
+	assert.InDelta(t, 1, r.Volume, 1e-12)
+	assert.Equal(t, 2, r.EulerCharacteristic)
+	assert.Equal(t, 1, r.Components)
+	assert.Zero(t, r.Holes)
+	assert.True(t, r.Closed)
+	assert.True(t, r.Oriented)
+
+	// split vertices at the seams are still one surface
+	nd := cubeNode()
+	nd.ResortVtVn(nil)
+	nd.Mat = scaling(2, 1, 1)
+	r = nd.Measure()
+	assert.Equal(t, 8, r.Vertices)
+	assert.InDelta(t, 10, r.Area, 1e-12)
+	assert.InDelta(t, 2, r.Volume, 1e-12)
+	assert.True(t, r.Closed)
+
+	// mirrored nodes are drawn flipped
+	nd = cubeNode()
+	nd.Mat = scaling(-1, 1, 1)
+	assert.InDelta(t, 1, nd.Measure().Volume, 1e-12)
+
+	r = quadNode().Measure()
+	assert.Equal(t, 6, r.BoundaryEdges)
+	assert.Equal(t, 1, r.Holes)
+	assert.Equal(t, 1, r.EulerCharacteristic)
+	assert.False(t, r.Closed)
+	assert.True(t, r.Oriented)
+
+	// a flipped face and a cube with the top off
+	nd = cubeNode()
+	f := nd.FaceGroup[0].Faces[0]
+	f.Vertex[1], f.Vertex[2] = f.Vertex[2], f.Vertex[1]
+	r = nd.Measure()
+	assert.Equal(t, 3, r.InconsistentEdges)
+	assert.True(t, r.Closed)
+	assert.False(t, r.Oriented)
+
+	nd = cubeNode()
+	nd.FaceGroup = append(nd.FaceGroup, &MeshTriangle{Batchid: 3, Faces: nd.FaceGroup[0].Faces[:2]})
+	nd.FaceGroup[0].Faces = nd.FaceGroup[0].Faces[4:]
+	r = nd.Measure()
+	assert.Equal(t, 4, r.BoundaryEdges)
+	assert.Equal(t, 1, r.Holes)
+	assert.Equal(t, 1, r.EulerCharacteristic)
+	assert.Equal(t, map[int]float64{0: 4, 3: 1}, r.AreaByBatch)
+
+	// a second shell, a fin on an edge and a sliver
+	nd = cubeNode()
+	nd.Vertices = append(nd.Vertices, vec3.Vec[float64]{1, -1, 0}, vec3.Vec[float64]{5, 5, 5}, vec3.Vec[float64]{6, 5, 5}, vec3.Vec[float64]{5, 6, 5})
+	nd.FaceGroup[0].Faces = append(nd.FaceGroup[0].Faces,
+		&Face{Vertex: [3]uint32{0, 1, 8}}, &Face{Vertex: [3]uint32{9, 10, 11}}, &Face{Vertex: [3]uint32{0, 1, 1}})
+	r = nd.Measure()
+	assert.Equal(t, 2, r.Components)
+	assert.Equal(t, 1, r.NonManifoldEdges)
+	assert.Equal(t, 1, r.Degenerate)
+	assert.Equal(t, 2, r.Holes)
+	assert.False(t, r.Closed)
+}
+
+func TestMeasureMesh(t *testing.T) {
+	ms := instanceMesh()
+	want := ms.Measure()
+	assert.Equal(t, 5, len(want.Nodes))
+	assert.InDelta(t, 44, want.Area, 1e-9)
+	assert.InDelta(t, 11, want.Volume, 1e-9)
+	assert.InDelta(t, 2, want.AreaByBatch[0], 1e-9)
+	assert.False(t, want.Closed)
+
+	// instances measure as their copies
+	ms.Instance(DefaultInstanceOptions)
+	r := ms.Measure()
+	assert.Equal(t, 1, len(r.Instances))
+	assert.InDelta(t, 36, r.Instances[0].Area, 1e-9)
+	assert.InDelta(t, 10, r.Instances[0].Volume, 1e-9)
+	assert.True(t, r.Instances[0].Closed)
+	assert.Equal(t, 3, r.Instances[0].Components)
+	assert.InDelta(t, want.Area, r.Area, 1e-9)
+	assert.InDelta(t, want.Volume, r.Volume, 1e-9)
+	assert.Equal(t, want.Faces, r.Faces)
+	assert.Equal(t, want.EulerCharacteristic, r.EulerCharacteristic)
+	assert.Equal(t, map[int]float64{0: 2, 1: 6}, r.AreaByBatch)
+
+	assert.False(t, NewMesh[float64]().Measure().Closed)
+}
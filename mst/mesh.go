@@ -21,6 +21,7 @@ import (
 	"pinkey.ltd/xr/go3d/mat4"
 	"pinkey.ltd/xr/go3d/vec2"
 	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/go3d/vec4"
 )
 
 const MESH_SIGNATURE string = "fwtm"
@@ -29,6 +30,8 @@ const V1 uint32 = 1
 const V2 uint32 = 2
 const V3 uint32 = 3
 const V4 uint32 = 4
+const V5 uint32 = 5
+const V6 uint32 = 6
 
 const (
 	MESH_TRIANGLE_MATERIAL_TYPE_COLOR   = 0
@@ -191,25 +194,41 @@ type MeshOutline struct {
 }
 
 type MeshNode[T float64 | float32] struct {
-	Vertices  []vec3.Vec[T]   `json:"vertices"`
-	Normals   []vec3.Vec[T]   `json:"normals,omitempty"`
-	Colors    [][3]byte       `json:"colors,omitempty"`
-	TexCoords []vec2.Vec[T]   `json:"texCoords,omitempty"`
-	Mat       *mat4.Mat[T]    `json:"mat,omitempty"`
-	FaceGroup []*MeshTriangle `json:"faceGroup,omitempty"`
-	EdgeGroup []*MeshOutline  `json:"edgeGroup,omitempty"`
-}
-
+	Vertices  []vec3.Vec[T] `json:"vertices"`
+	Normals   []vec3.Vec[T] `json:"normals,omitempty"`
+	Colors    [][3]byte     `json:"colors,omitempty"`
+	TexCoords []vec2.Vec[T] `json:"texCoords,omitempty"`
+	Tangents  []vec4.Vec[T] `json:"tangents,omitempty"`
+	// FeatureIds identifies the feature of each vertex, see Batch
+	FeatureIds []uint32        `json:"featureIds,omitempty"`
+	Mat        *mat4.Mat[T]    `json:"mat,omitempty"`
+	FaceGroup  []*MeshTriangle `json:"faceGroup,omitempty"`
+	EdgeGroup  []*MeshOutline  `json:"edgeGroup,omitempty"`
+}
+
+// ResortVtVn gives every face corner its own vertex. Normals and uvs are
+// looked up through Face.Normal and Face.Uv, or per vertex when those are
+// nil.
 func (n *MeshNode[T]) ResortVtVn(m *Mesh[T]) {
 	var vs, vns []vec3.Vec[T]
 	var vts []vec2.Vec[T]
+	var cls [][3]byte
+	var tns []vec4.Vec[T]
+	var fids []uint32
 	var idx uint32
+	hasTangent := len(n.Tangents) == len(n.Vertices) && len(n.Tangents) > 0
+	hasFeature := len(n.FeatureIds) == len(n.Vertices) && len(n.FeatureIds) > 0
+	perVertexNormal := len(n.Normals) == len(n.Vertices)
+	perVertexUv := len(n.TexCoords) == len(n.Vertices)
+	hasColor := len(n.Colors) == len(n.Vertices) && len(n.Colors) > 0
 	for _, g := range n.FaceGroup {
 		for _, f := range g.Faces {
 			if f.Normal != nil {
 				vns = append(vns, n.Normals[int((*f.Normal)[0])])
 				vns = append(vns, n.Normals[int((*f.Normal)[1])])
 				vns = append(vns, n.Normals[int((*f.Normal)[2])])
+			} else if perVertexNormal {
+				vns = append(vns, n.Normals[f.Vertex[0]], n.Normals[f.Vertex[1]], n.Normals[f.Vertex[2]])
 			} else {
 				vns = append(vns, vec3.Vec[T]{0, 0, 1})
 				vns = append(vns, vec3.Vec[T]{0, 0, 1})
@@ -219,56 +238,48 @@ func (n *MeshNode[T]) ResortVtVn(m *Mesh[T]) {
 				vts = append(vts, n.TexCoords[int((*f.Uv)[0])])
 				vts = append(vts, n.TexCoords[int((*f.Uv)[1])])
 				vts = append(vts, n.TexCoords[int((*f.Uv)[2])])
+			} else if perVertexUv {
+				vts = append(vts, n.TexCoords[f.Vertex[0]], n.TexCoords[f.Vertex[1]], n.TexCoords[f.Vertex[2]])
 			} else {
 				vts = append(vts, vec2.Vec[T]{0, 0})
 				vts = append(vts, vec2.Vec[T]{0, 0})
 				vts = append(vts, vec2.Vec[T]{0, 0})
 			}
+			if hasColor {
+				cls = append(cls, n.Colors[f.Vertex[0]], n.Colors[f.Vertex[1]], n.Colors[f.Vertex[2]])
+			}
+			if hasTangent {
+				tns = append(tns, n.Tangents[f.Vertex[0]], n.Tangents[f.Vertex[1]], n.Tangents[f.Vertex[2]])
+			}
+			if hasFeature {
+				fids = append(fids, n.FeatureIds[f.Vertex[0]], n.FeatureIds[f.Vertex[1]], n.FeatureIds[f.Vertex[2]])
+			}
 			vs = append(vs, n.Vertices[int(f.Vertex[0])])
 			vs = append(vs, n.Vertices[int(f.Vertex[1])])
 			vs = append(vs, n.Vertices[int(f.Vertex[2])])
 			f.Vertex = [3]uint32{idx, uint32(idx + 1), uint32(idx + 2)}
+			f.Normal, f.Uv = nil, nil
 			idx += 3
 		}
 	}
 	n.Vertices = vs
 	n.Normals = vns
 	n.TexCoords = vts
+	if hasColor {
+		n.Colors = cls
+	}
+	if hasTangent {
+		n.Tangents = tns
+	}
+	if hasFeature {
+		n.FeatureIds = fids
+	}
 }
 
+// ReComputeNormal computes smooth, angle weighted vertex normals without
+// splitting vertices. See ComputeNormals for hard edges.
 func (n *MeshNode[T]) ReComputeNormal() {
-	normals := make([]vec3.Vec[T], len(n.Vertices))
-	for _, g := range n.FaceGroup {
-		for _, f := range g.Faces {
-			pt1 := n.Vertices[f.Vertex[0]]
-			pt2 := n.Vertices[f.Vertex[1]]
-			pt3 := n.Vertices[f.Vertex[2]]
-
-			sub1 := vec3.Sub(&pt3, &pt2)
-			sub2 := vec3.Sub(&pt1, &pt2)
-
-			cro := vec3.Cross(&sub1, &sub2)
-			l := cro.Length()
-			f.Normal = &f.Vertex
-			if l == 0 {
-				continue
-			}
-			weightedNormal := cro.Scale(1 / l)
-
-			n1 := &normals[f.Vertex[0]]
-			n1.Add(weightedNormal)
-			n1.Normalize()
-
-			n2 := &normals[f.Vertex[1]]
-			n2.Add(weightedNormal)
-			n2.Normalize()
-
-			n3 := &normals[f.Vertex[2]]
-			n3.Add(weightedNormal)
-			n3.Normalize()
-		}
-	}
-	n.Normals = normals
+	n.ComputeNormals(NormalOptions{Weighting: NORMAL_WEIGHT_ANGLE, CreaseAngle: math.Pi})
 }
 
 type InstanceMesh[T float64 | float32] struct {
@@ -311,7 +322,7 @@ type Mesh[T float64 | float32] struct {
 }
 
 func NewMesh[T float64 | float32]() *Mesh[T] {
-	return &Mesh[T]{Version: V4}
+	return &Mesh[T]{Version: V6}
 }
 
 func (m *Mesh[T]) NodeCount() int {
@@ -723,7 +734,7 @@ func MeshMarshal[T float64 | float32](wt io.Writer, ms *Mesh[T]) {
 	writeLittleByte(wt, ms.Version)
 	baseMeshMarshal(wt, &ms.BaseMesh, ms.Version)
 	MeshInstanceNodesMarshal(wt, ms.InstanceNode, ms.Version)
-	if ms.Version == V4 {
+	if ms.Version >= V4 {
 		writeLittleByte(wt, ms.Code)
 	}
 }
@@ -731,9 +742,21 @@ func MeshMarshal[T float64 | float32](wt io.Writer, ms *Mesh[T]) {
 func baseMeshMarshal[T float64 | float32](wt io.Writer, ms *BaseMesh[T], v uint32) {
 	MtlsMarshal(wt, ms.Materials, v)
 	MeshNodesMarshal(wt, ms.Nodes)
-	if v == V4 {
+	if v >= V4 {
 		writeLittleByte(wt, ms.Code)
 	}
+	if v >= V5 {
+		for _, nd := range ms.Nodes {
+			writeLittleByte(wt, uint32(len(nd.Tangents)))
+			for i := range nd.Tangents {
+				writeLittleByte(wt, nd.Tangents[i][:])
+			}
+			if v >= V6 {
+				writeLittleByte(wt, uint32(len(nd.FeatureIds)))
+				writeLittleByte(wt, nd.FeatureIds)
+			}
+		}
+	}
 }
 
 func MeshUnMarshal[T float64 | float32](rd io.Reader) *Mesh[T] {
@@ -743,7 +766,7 @@ func MeshUnMarshal[T float64 | float32](rd io.Reader) *Mesh[T] {
 	readLittleByte(rd, &ms.Version)
 	ms.BaseMesh = *baseMeshUnMarshal[T](rd, ms.Version)
 	ms.InstanceNode = MeshInstanceNodesUnMarshal[T](rd, ms.Version)
-	if ms.Version == V4 {
+	if ms.Version >= V4 {
 		readLittleByte(rd, &ms.Code)
 	}
 	return &ms
@@ -753,9 +776,24 @@ func baseMeshUnMarshal[T float64 | float32](rd io.Reader, v uint32) *BaseMesh[T]
 	ms := &BaseMesh[T]{}
 	ms.Materials = MtlsUnMarshal(rd, v)
 	ms.Nodes = MeshNodesUnMarshal[T](rd)
-	if v == V4 {
+	if v >= V4 {
 		readLittleByte(rd, &ms.Code)
 	}
+	if v >= V5 {
+		for _, nd := range ms.Nodes {
+			var size uint32
+			readLittleByte(rd, &size)
+			nd.Tangents = make([]vec4.Vec[T], size)
+			for i := range nd.Tangents {
+				readLittleByte(rd, nd.Tangents[i][:])
+			}
+			if v >= V6 {
+				readLittleByte(rd, &size)
+				nd.FeatureIds = make([]uint32, size)
+				readLittleByte(rd, nd.FeatureIds)
+			}
+		}
+	}
 	return ms
 }
 
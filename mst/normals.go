@@ -0,0 +1,179 @@
+package mst
+
+import (
+	"math"
+
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+const (
+	NORMAL_WEIGHT_AREA    = 0 // faces count by their area
+	NORMAL_WEIGHT_ANGLE   = 1 // faces count by their corner angle at the vertex
+	NORMAL_WEIGHT_UNIFORM = 2 // every face counts the same
+)
+
+// NormalOptions controls ComputeNormals.
+type NormalOptions struct {
+	Weighting int
+	// CreaseAngle in radians: faces meeting at a larger angle do not share
+	// vertex normals, the vertices along such hard edges are split. Pi or
+	// more smooths across every edge.
+	CreaseAngle float64
+	// Flat gives every face its own normal, coplanar neighbours still share
+	// vertices.
+	Flat bool
+}
+
+var DefaultNormalOptions = NormalOptions{Weighting: NORMAL_WEIGHT_ANGLE, CreaseAngle: math.Pi / 6}
+
+type normalCorner struct {
+	face *Face
+	k    int
+}
+
+type normalKey[T float64 | float32] struct {
+	v, uv uint32
+	n     vec3.Vec[T]
+}
+
+// ComputeNormals replaces the normals of the node by vertex normals
+// averaged over the faces around each vertex. Vertices on hard edges are
+// duplicated with their other attributes, the first copy keeps its index, so
+// edge groups stay valid. Normals and uvs become per vertex, tangents are
+// dropped as they depend on the normals.
+func (n *MeshNode[T]) ComputeNormals(opts NormalOptions) {
+	nv := len(n.Vertices)
+	var corners []normalCorner
+	var faceNormals []vec3.Vec[float64]
+	var weights [][3]float64
+	incident := make([][]int, nv)
+	for _, g := range n.FaceGroup {
+		for _, f := range g.Faces {
+			i := len(faceNormals)
+			var p [3]vec3.Vec[float64]
+			for k := range 3 {
+				v := n.Vertices[f.Vertex[k]]
+				p[k] = vec3.Vec[float64]{float64(v[0]), float64(v[1]), float64(v[2])}
+				incident[f.Vertex[k]] = append(incident[f.Vertex[k]], i*3+k)
+				corners = append(corners, normalCorner{f, k})
+			}
+			e1, e2 := vec3.Sub(&p[1], &p[0]), vec3.Sub(&p[2], &p[0])
+			c := vec3.Cross(&e1, &e2)
+			area := c.Length() / 2
+			if area > 0 {
+				c.Scale(1 / (2 * area))
+			}
+			faceNormals = append(faceNormals, c)
+
+			var w [3]float64
+			for k := range 3 {
+				switch opts.Weighting {
+				case NORMAL_WEIGHT_ANGLE:
+					a, b := vec3.Sub(&p[(k+1)%3], &p[k]), vec3.Sub(&p[(k+2)%3], &p[k])
+					w[k] = vec3.Angle(&a, &b)
+					if math.IsNaN(w[k]) {
+						w[k] = 0
+					}
+				case NORMAL_WEIGHT_UNIFORM:
+					w[k] = 1
+				default:
+					w[k] = area
+				}
+			}
+			weights = append(weights, w)
+		}
+	}
+
+	cosCrease := math.Cos(opts.CreaseAngle)
+	if opts.CreaseAngle >= math.Pi {
+		cosCrease = -2
+	}
+	// the normal of a corner sums the faces around its vertex which are
+	// smooth to its own face, corners with equal sums share a vertex
+	cornerNormal := func(c int) vec3.Vec[T] {
+		fi := c / 3
+		fn := faceNormals[fi]
+		if opts.Flat {
+			return vec3.Vec[T]{T(fn[0]), T(fn[1]), T(fn[2])}
+		}
+		var sum vec3.Vec[float64]
+		for _, o := range incident[corners[c].face.Vertex[corners[c].k]] {
+			on := faceNormals[o/3]
+			if on.IsZero() || !fn.IsZero() && vec3.Dot(&fn, &on) < cosCrease {
+				continue
+			}
+			s := on.Scaled(weights[o/3][o%3])
+			sum.Add(&s)
+		}
+		if l := sum.Length(); l > 0 {
+			sum.Scale(1 / l)
+		}
+		return vec3.Vec[T]{T(sum[0]), T(sum[1]), T(sum[2])}
+	}
+
+	hasUv := len(n.TexCoords) > 0
+	hasColor := len(n.Colors) == nv && nv > 0
+	hasFeature := len(n.FeatureIds) == nv && nv > 0
+	normals := make([]vec3.Vec[T], nv)
+	var uvs []vec2.Vec[T]
+	if hasUv {
+		uvs = make([]vec2.Vec[T], nv)
+		copy(uvs, n.TexCoords)
+	}
+	used := make([]bool, nv)
+	index := map[normalKey[T]]uint32{}
+	for c, cn := range corners {
+		f, k := cn.face, cn.k
+		v := f.Vertex[k]
+		key := normalKey[T]{v: v, uv: v, n: cornerNormal(c)}
+		if f.Uv != nil {
+			key.uv = f.Uv[k]
+		}
+		i, ok := index[key]
+		if !ok {
+			i = v
+			if used[v] {
+				i = uint32(len(n.Vertices))
+				n.Vertices = append(n.Vertices, n.Vertices[v])
+				normals = append(normals, vec3.Vec[T]{})
+				if hasUv {
+					uvs = append(uvs, vec2.Vec[T]{})
+				}
+				if hasColor {
+					n.Colors = append(n.Colors, n.Colors[v])
+				}
+				if hasFeature {
+					n.FeatureIds = append(n.FeatureIds, n.FeatureIds[v])
+				}
+			}
+			used[v] = true
+			normals[i] = key.n
+			if hasUv && int(key.uv) < len(n.TexCoords) {
+				uvs[i] = n.TexCoords[key.uv]
+			}
+			index[key] = i
+		}
+		f.Vertex[k] = i
+	}
+	for _, cn := range corners {
+		cn.face.Normal, cn.face.Uv = nil, nil
+	}
+	n.Normals, n.TexCoords = normals, uvs
+	n.Tangents = nil
+}
+
+// ComputeNormals computes the normals of every node of the mesh and of its
+// instances.
+func (m *Mesh[T]) ComputeNormals(opts NormalOptions) {
+	for _, nd := range m.Nodes {
+		nd.ComputeNormals(opts)
+	}
+	for _, inst := range m.InstanceNode {
+		if inst.Mesh != nil {
+			for _, nd := range inst.Mesh.Nodes {
+				nd.ComputeNormals(opts)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package mst
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+func assertVecNear(t *testing.T, want, got vec3.Vec[float64]) {
+	t.Helper()
+	for k := range 3 {
+		assert.InDelta(t, want[k], got[k], 1e-9, "want %v, got %v", want, got)
+	}
+}
+
+func TestComputeNormals(t *testing.T) {
+	// hard edges split every corner of the cube into three vertices
+	nd := cubeNode()
+	nd.FeatureIds = []uint32{0, 1, 2, 3, 4, 5, 6, 7}
+	want := facePositions(nd)
+	nd.ComputeNormals(DefaultNormalOptions)
+	assert.Equal(t, 24, len(nd.Vertices))
+	assert.Equal(t, 24, len(nd.Normals))
+	assert.Equal(t, 24, len(nd.FeatureIds))
+	for i, v := range nd.Vertices {
+		assert.Equal(t, uint32(v[0]+2*v[1]+4*v[2]), nd.FeatureIds[i])
+	}
+	assert.Equal(t, want, facePositions(nd))
+	for _, f := range nd.FaceGroup[0].Faces {
+		a, b, c := nd.Vertices[f.Vertex[0]], nd.Vertices[f.Vertex[1]], nd.Vertices[f.Vertex[2]]
+		e1, e2 := vec3.Sub(&b, &a), vec3.Sub(&c, &a)
+		fn := vec3.Cross(&e1, &e2)
+		for k := range 3 {
+			assertVecNear(t, fn, nd.Normals[f.Vertex[k]])
+		}
+		assert.Nil(t, f.Normal)
+	}
+
+	// smoothing keeps the vertices and points the normals along the diagonals
+	nd = cubeNode()
+	nd.ComputeNormals(NormalOptions{Weighting: NORMAL_WEIGHT_ANGLE, CreaseAngle: math.Pi})
+	assert.Equal(t, 8, len(nd.Vertices))
+	d := 1 / math.Sqrt(3)
+	for i, v := range nd.Vertices {
+		want := vec3.Vec[float64]{(2*v[0] - 1) * d, (2*v[1] - 1) * d, (2*v[2] - 1) * d}
+		assertVecNear(t, want, nd.Normals[i])
+	}
+
+	// flat shading shares vertices between the two triangles of a side
+	nd = cubeNode()
+	nd.ComputeNormals(NormalOptions{Flat: true})
+	assert.Equal(t, 24, len(nd.Vertices))
+	assert.Equal(t, want, facePositions(nd))
+
+	// a crease wider than the 90 degree edges smooths the whole cube
+	nd = cubeNode()
+	nd.ComputeNormals(NormalOptions{CreaseAngle: math.Pi / 2 * 1.01})
+	assert.Equal(t, 8, len(nd.Vertices))
+}
+
+func TestComputeNormalsWeighting(t *testing.T) {
+	// a large triangle in the xy plane and a small one tilted up, sharing
+	// the vertex at the origin
+	node := func() *MeshNode[float64] {
+		return &MeshNode[float64]{
+			Vertices: []vec3.Vec[float64]{{0, 0, 0}, {4, 0, 0}, {0, 4, 0}, {0, -1, 0}, {0, 0, 1}},
+			FaceGroup: []*MeshTriangle{{Faces: []*Face{
+				{Vertex: [3]uint32{0, 1, 2}},
+				{Vertex: [3]uint32{0, 3, 4}},
+			}}},
+		}
+	}
+	smooth := func(w int) vec3.Vec[float64] {
+		nd := node()
+		nd.ComputeNormals(NormalOptions{Weighting: w, CreaseAngle: math.Pi})
+		return nd.Normals[0]
+	}
+	// both faces have a right angle at the origin
+	d := 1 / math.Sqrt(2)
+	assertVecNear(t, vec3.Vec[float64]{-d, 0, d}, smooth(NORMAL_WEIGHT_ANGLE))
+	assertVecNear(t, vec3.Vec[float64]{-d, 0, d}, smooth(NORMAL_WEIGHT_UNIFORM))
+	// areas are 8 and 0.5
+	l := math.Hypot(0.5, 8)
+	assertVecNear(t, vec3.Vec[float64]{-0.5 / l, 0, 8 / l}, smooth(NORMAL_WEIGHT_AREA))
+}
+
+func TestComputeNormalsAttributes(t *testing.T) {
+	// the split vertex keeps its uv and color, the edge keeps the first copy
+	nd := &MeshNode[float64]{
+		Vertices:  []vec3.Vec[float64]{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+		TexCoords: []vec2.Vec[float64]{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
+		Colors:    [][3]byte{{1, 1, 1}, {2, 2, 2}, {3, 3, 3}, {4, 4, 4}},
+		FaceGroup: []*MeshTriangle{{Faces: []*Face{
+			{Vertex: [3]uint32{0, 1, 2}},
+			{Vertex: [3]uint32{0, 3, 1}},
+		}}},
+		EdgeGroup: []*MeshOutline{{Edges: [][2]int{{0, 1}}}},
+	}
+	nd.ComputeNormals(DefaultNormalOptions)
+	assert.Equal(t, 6, len(nd.Vertices))
+	assert.Equal(t, 6, len(nd.TexCoords))
+	assert.Equal(t, 6, len(nd.Colors))
+	f := nd.FaceGroup[0].Faces[1]
+	assert.Equal(t, vec3.Vec[float64]{0, 1, 0}, nd.Normals[f.Vertex[0]])
+	assert.Equal(t, vec3.Vec[float64]{0, 0, 1}, nd.Normals[0])
+	assert.Equal(t, [3]byte{1, 1, 1}, nd.Colors[f.Vertex[0]])
+	assert.Equal(t, [][2]int{{0, 1}}, nd.EdgeGroup[0].Edges)
+
+	// resorting keeps the per vertex attributes of each corner
+	nd.ResortVtVn(nil)
+	assert.Equal(t, 6, len(nd.Vertices))
+	assert.Equal(t, 6, len(nd.Colors))
+	assert.Equal(t, vec3.Vec[float64]{0, 1, 0}, nd.Normals[3])
+	assert.Equal(t, vec2.Vec[float64]{1, 1}, nd.TexCoords[4])
+	assert.Equal(t, [3]byte{4, 4, 4}, nd.Colors[4])
+}
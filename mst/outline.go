@@ -0,0 +1,187 @@
+package mst
+
+import (
+	"math"
+
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// OutlineOptions selects the edges ExtractOutlines keeps.
+type OutlineOptions struct {
+	Boundary    bool // edges of a single face
+	NonManifold bool // edges shared by more than two faces
+	// FeatureAngle in radians: edges between two faces whose normals differ
+	// by more are kept. Pi or more disables feature edges.
+	FeatureAngle float64
+	// Chain joins the edges into polylines, one MeshOutline each, so that
+	// every edge starts where the one before ended.
+	Chain bool
+}
+
+var DefaultOutlineOptions = OutlineOptions{Boundary: true, NonManifold: true, FeatureAngle: math.Pi / 6}
+
+type outlineEdge struct {
+	a, b  uint32 // vertex indices as seen first
+	faces []int
+}
+
+// positionCanon maps every vertex to the first one at its position.
+func positionCanon[T float64 | float32](n *MeshNode[T]) []uint32 {
+	canon := make([]uint32, len(n.Vertices))
+	byPos := make(map[[3]uint64]uint32, len(n.Vertices))
+	for i, v := range n.Vertices {
+		key := [3]uint64{math.Float64bits(float64(v[0]) + 0), math.Float64bits(float64(v[1]) + 0), math.Float64bits(float64(v[2]) + 0)}
+		if j, ok := byPos[key]; ok {
+			canon[i] = j
+		} else {
+			byPos[key] = uint32(i)
+			canon[i] = uint32(i)
+		}
+	}
+	return canon
+}
+
+// ExtractOutlines replaces the edge groups of the node by the boundary,
+// non-manifold and feature edges of each face group, carrying its Batchid.
+// Vertices at the same position count as one, so seams of split normals or
+// uvs are not taken for boundaries. It returns the number of edges found.
+func (n *MeshNode[T]) ExtractOutlines(opts OutlineOptions) int {
+	canon := positionCanon(n)
+	cosFeature := math.Cos(opts.FeatureAngle)
+
+	count := 0
+	var groups []*MeshOutline
+	for _, g := range n.FaceGroup {
+		normals := make([]vec3.Vec[float64], len(g.Faces))
+		edges := map[[2]uint32]*outlineEdge{}
+		var order [][2]uint32
+		for fi, f := range g.Faces {
+			var p [3]vec3.Vec[float64]
+			for k := range 3 {
+				v := n.Vertices[f.Vertex[k]]
+				p[k] = vec3.Vec[float64]{float64(v[0]), float64(v[1]), float64(v[2])}
+			}
+			e1, e2 := vec3.Sub(&p[1], &p[0]), vec3.Sub(&p[2], &p[0])
+			nm := vec3.Cross(&e1, &e2)
+			if l := nm.Length(); l > 0 {
+				nm.Scale(1 / l)
+			}
+			normals[fi] = nm
+			for k := range 3 {
+				a, b := canon[f.Vertex[k]], canon[f.Vertex[(k+1)%3]]
+				if a == b {
+					continue
+				}
+				key := [2]uint32{min(a, b), max(a, b)}
+				e, ok := edges[key]
+				if !ok {
+					e = &outlineEdge{a: a, b: b}
+					edges[key] = e
+					order = append(order, key)
+				}
+				e.faces = append(e.faces, fi)
+			}
+		}
+
+		var keep [][2]int
+		for _, key := range order {
+			e := edges[key]
+			ok := false
+			switch len(e.faces) {
+			case 1:
+				ok = opts.Boundary
+			case 2:
+				if opts.FeatureAngle < math.Pi {
+					n1, n2 := normals[e.faces[0]], normals[e.faces[1]]
+					ok = !n1.IsZero() && !n2.IsZero() && vec3.Dot(&n1, &n2) < cosFeature
+				}
+			default:
+				ok = opts.NonManifold
+			}
+			if ok {
+				keep = append(keep, [2]int{int(e.a), int(e.b)})
+			}
+		}
+		if len(keep) == 0 {
+			continue
+		}
+		count += len(keep)
+		if !opts.Chain {
+			groups = append(groups, &MeshOutline{Batchid: g.Batchid, Edges: keep})
+			continue
+		}
+		for _, line := range chainEdges(keep) {
+			groups = append(groups, &MeshOutline{Batchid: g.Batchid, Edges: line})
+		}
+	}
+	n.EdgeGroup = groups
+	return count
+}
+
+// chainEdges orders edges into polylines. Lines run between vertices not
+// shared by exactly two edges, what remains are closed loops.
+func chainEdges(edges [][2]int) [][][2]int {
+	adj := map[int][]int{}
+	for i, e := range edges {
+		adj[e[0]] = append(adj[e[0]], i)
+		adj[e[1]] = append(adj[e[1]], i)
+	}
+	used := make([]bool, len(edges))
+	var lines [][][2]int
+	walk := func(start, first int) {
+		var line [][2]int
+		v, i := start, first
+		for {
+			used[i] = true
+			e := edges[i]
+			next := e[0]
+			if next == v {
+				next = e[1]
+			}
+			line = append(line, [2]int{v, next})
+			v = next
+			if len(adj[v]) != 2 {
+				break
+			}
+			i = adj[v][0]
+			if used[i] {
+				i = adj[v][1]
+			}
+			if used[i] {
+				break
+			}
+		}
+		lines = append(lines, line)
+	}
+	// open lines first, starting at their ends or junctions
+	for i, e := range edges {
+		for _, v := range e {
+			if !used[i] && len(adj[v]) != 2 {
+				walk(v, i)
+			}
+		}
+	}
+	for i, e := range edges {
+		if !used[i] {
+			walk(e[0], i)
+		}
+	}
+	return lines
+}
+
+// ExtractOutlines extracts the outlines of every node of the mesh and of its
+// instances and returns the number of edges found.
+func (m *Mesh[T]) ExtractOutlines(opts OutlineOptions) int {
+	count := 0
+	for _, nd := range m.Nodes {
+		count += nd.ExtractOutlines(opts)
+	}
+	for _, inst := range m.InstanceNode {
+		if inst.Mesh != nil {
+			for _, nd := range inst.Mesh.Nodes {
+				count += nd.ExtractOutlines(opts)
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,68 @@
+package mst
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+func TestExtractOutlines(t *testing.T) {
+	// the cube edges are feature edges, the side diagonals are not
+	nd := cubeNode()
+	nd.FaceGroup[0].Batchid = 3
+	assert.Equal(t, 12, nd.ExtractOutlines(DefaultOutlineOptions))
+	assert.Equal(t, 1, len(nd.EdgeGroup))
+	assert.Equal(t, 3, nd.EdgeGroup[0].Batchid)
+	for _, e := range nd.EdgeGroup[0].Edges {
+		a, b := nd.Vertices[e[0]], nd.Vertices[e[1]]
+		d := vec3.Sub(&a, &b)
+		assert.Equal(t, 1.0, d.Length())
+	}
+
+	// split vertices along the seams are still one edge
+	nd = cubeNode()
+	nd.ResortVtVn(nil)
+	assert.Equal(t, 12, nd.ExtractOutlines(DefaultOutlineOptions))
+	assert.Equal(t, 0, nd.ExtractOutlines(OutlineOptions{Boundary: true, FeatureAngle: math.Pi}))
+	assert.Empty(t, nd.EdgeGroup)
+
+	// every corner of the cube joins three edges, so no edges chain up
+	nd = cubeNode()
+	nd.ExtractOutlines(OutlineOptions{FeatureAngle: math.Pi / 4, Chain: true})
+	assert.Equal(t, 12, len(nd.EdgeGroup))
+}
+
+func TestExtractOutlinesBoundary(t *testing.T) {
+	// a square of two triangles and a fin on its diagonal in another group
+	nd := &MeshNode[float64]{
+		Vertices: []vec3.Vec[float64]{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}, {0.5, 0.5, 1}, {0.5, 0.5, -1}},
+		FaceGroup: []*MeshTriangle{
+			{Batchid: 0, Faces: []*Face{{Vertex: [3]uint32{0, 1, 2}}, {Vertex: [3]uint32{0, 2, 3}}}},
+			{Batchid: 1, Faces: []*Face{{Vertex: [3]uint32{0, 2, 4}}, {Vertex: [3]uint32{0, 2, 5}}, {Vertex: [3]uint32{2, 0, 1}}}},
+		},
+	}
+	assert.Equal(t, 4+1+6, nd.ExtractOutlines(OutlineOptions{Boundary: true, NonManifold: true, FeatureAngle: math.Pi}))
+	assert.Equal(t, [][2]int{{0, 1}, {1, 2}, {2, 3}, {3, 0}}, nd.EdgeGroup[0].Edges)
+	assert.Equal(t, 1, nd.EdgeGroup[1].Batchid)
+	assert.Equal(t, [2]int{0, 2}, nd.EdgeGroup[1].Edges[0])
+
+	// the square is flat, only the fin base is left
+	assert.Equal(t, 1, nd.ExtractOutlines(OutlineOptions{NonManifold: true, FeatureAngle: math.Pi / 6}))
+	assert.Equal(t, 1, len(nd.EdgeGroup))
+	assert.Equal(t, [][2]int{{0, 2}}, nd.EdgeGroup[0].Edges)
+
+	// the square boundary chains into a closed loop, the fin boundaries
+	// into lines between the junctions at 0 and 2
+	nd.ExtractOutlines(OutlineOptions{Boundary: true, FeatureAngle: math.Pi, Chain: true})
+	assert.Equal(t, [][2]int{{0, 1}, {1, 2}, {2, 3}, {3, 0}}, nd.EdgeGroup[0].Edges)
+	var lines [][][2]int
+	for _, g := range nd.EdgeGroup[1:] {
+		lines = append(lines, g.Edges)
+		for i := 1; i < len(g.Edges); i++ {
+			assert.Equal(t, g.Edges[i-1][1], g.Edges[i][0])
+		}
+	}
+	assert.Equal(t, [][][2]int{{{2, 4}, {4, 0}}, {{2, 5}, {5, 0}}, {{0, 1}, {1, 2}}}, lines)
+}
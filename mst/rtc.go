@@ -0,0 +1,148 @@
+package mst
+
+import (
+	"github.com/qmuntal/gltf"
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// CESIUM_RTC_EXTENSION is the name of the glTF extension carrying a relative-to-center origin.
+const CESIUM_RTC_EXTENSION = "CESIUM_RTC"
+
+const (
+	// RTC_MODE_ROOT_NODE wraps the scene in a root node translated by the origin.
+	RTC_MODE_ROOT_NODE = 0
+	// RTC_MODE_CESIUM records the origin in the CESIUM_RTC extension.
+	RTC_MODE_CESIUM = 1
+)
+
+// RTCCenter returns the center of the world space bounding box of the mesh,
+// including node matrices and instance positions. It is used as local origin
+// so that re-based coordinates stay small enough for float32.
+func (m *Mesh[T]) RTCCenter() vec3.Vec[float64] {
+	bbox := vec3.MinBox
+	for _, nd := range m.Nodes {
+		for i := range nd.Vertices {
+			v := vec3.Vec[float64]{float64(nd.Vertices[i][0]), float64(nd.Vertices[i][1]), float64(nd.Vertices[i][2])}
+			if nd.Mat != nil {
+				v = transformPoint(nd.Mat, &v)
+			}
+			bbox.Extend(&v)
+		}
+	}
+	for _, inst := range m.InstanceNode {
+		for _, mt := range inst.Transfors {
+			v := vec3.Vec[float64]{float64(mt[3][0]), float64(mt[3][1]), float64(mt[3][2])}
+			bbox.Extend(&v)
+		}
+	}
+	if bbox.Min[0] > bbox.Max[0] {
+		return vec3.Vec[float64]{}
+	}
+	return bbox.Center()
+}
+
+// Rebase moves the mesh so that origin becomes the new coordinate origin.
+// Vertices of nodes without a matrix and the translations of instance
+// transforms are shifted in float64. Nodes with a matrix get their vertices
+// centered and the center moved into the translation, so that both stay
+// small whether the matrix or the vertices held the world position.
+func (m *Mesh[T]) Rebase(origin vec3.Vec[float64]) {
+	for _, nd := range m.Nodes {
+		if nd.Mat != nil {
+			var c vec3.Vec[float64]
+			for _, v := range nd.Vertices {
+				c.Add(&vec3.Vec[float64]{float64(v[0]), float64(v[1]), float64(v[2])})
+			}
+			if len(nd.Vertices) > 0 {
+				c.Scale(1 / float64(len(nd.Vertices)))
+			}
+			for i := range nd.Vertices {
+				v := &nd.Vertices[i]
+				v[0] = T(float64(v[0]) - c[0])
+				v[1] = T(float64(v[1]) - c[1])
+				v[2] = T(float64(v[2]) - c[2])
+			}
+			w := transformPoint(nd.Mat, &c)
+			nd.Mat[3][0] = T(w[0] - origin[0])
+			nd.Mat[3][1] = T(w[1] - origin[1])
+			nd.Mat[3][2] = T(w[2] - origin[2])
+			continue
+		}
+		for i := range nd.Vertices {
+			v := &nd.Vertices[i]
+			v[0] = T(float64(v[0]) - origin[0])
+			v[1] = T(float64(v[1]) - origin[1])
+			v[2] = T(float64(v[2]) - origin[2])
+		}
+	}
+	for _, inst := range m.InstanceNode {
+		for _, mt := range inst.Transfors {
+			mt[3][0] = T(float64(mt[3][0]) - origin[0])
+			mt[3][1] = T(float64(mt[3][1]) - origin[1])
+			mt[3][2] = T(float64(mt[3][2]) - origin[2])
+		}
+		if inst.BBox != nil {
+			for i := 0; i < 6; i++ {
+				inst.BBox[i] -= origin[i%3]
+			}
+		}
+	}
+}
+
+// ToRTC re-bases the mesh on its RTCCenter and returns the origin.
+func (m *Mesh[T]) ToRTC() vec3.Vec[float64] {
+	origin := m.RTCCenter()
+	m.Rebase(origin)
+	return origin
+}
+
+// RTCTileTransform returns the column major 3D Tiles tile transform that
+// places content re-based on origin.
+func RTCTileTransform(origin vec3.Vec[float64]) [16]float64 {
+	return [16]float64{
+		1, 0, 0, 0,
+		0, 1, 0, 0,
+		0, 0, 1, 0,
+		origin[0], origin[1], origin[2], 1,
+	}
+}
+
+// SetGltfRTC records the origin of re-based content in the document, either
+// as translation of a new root node or as CESIUM_RTC extension.
+func SetGltfRTC(doc *gltf.Document, origin vec3.Vec[float64], mode int) {
+	switch mode {
+	case RTC_MODE_CESIUM:
+		if doc.Extensions == nil {
+			doc.Extensions = make(gltf.Extensions)
+		}
+		doc.Extensions[CESIUM_RTC_EXTENSION] = map[string]interface{}{
+			"center": []float64{origin[0], origin[1], origin[2]},
+		}
+		for _, nm := range doc.ExtensionsUsed {
+			if nm == CESIUM_RTC_EXTENSION {
+				return
+			}
+		}
+		doc.ExtensionsUsed = append(doc.ExtensionsUsed, CESIUM_RTC_EXTENSION)
+	default:
+		if len(doc.Scenes) == 0 {
+			return
+		}
+		root := &gltf.Node{
+			Name:        "rtc",
+			Translation: [3]float64{origin[0], origin[1], origin[2]},
+			Children:    doc.Scenes[0].Nodes,
+		}
+		doc.Nodes = append(doc.Nodes, root)
+		doc.Scenes[0].Nodes = []int{len(doc.Nodes) - 1}
+	}
+}
+
+func transformPoint[T float64 | float32](m *mat4.Mat[T], v *vec3.Vec[float64]) vec3.Vec[float64] {
+	var r vec3.Vec[float64]
+	for k := 0; k < 3; k++ {
+		r[k] = float64(m[0][k])*v[0] + float64(m[1][k])*v[1] + float64(m[2][k])*v[2] + float64(m[3][k])
+	}
+	return r
+}
@@ -0,0 +1,175 @@
+package mst
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/go3d/vec4"
+)
+
+var rtcWorld = vec3.Vec[float64]{-2389250.4338499242, 4518270.200871248, 3802675.424745363}
+
+func rtcTestMesh() *Mesh[float64] {
+	ms := NewMesh[float64]()
+	nd := &MeshNode[float64]{}
+	for i := 0; i < 8; i++ {
+		nd.Vertices = append(nd.Vertices, vec3.Vec[float64]{
+			rtcWorld[0] + float64(i&1)*12.345,
+			rtcWorld[1] + float64(i>>1&1)*6.789,
+			rtcWorld[2] + float64(i>>2&1)*3.211,
+		})
+	}
+	nd.FaceGroup = []*MeshTriangle{{Batchid: 0, Faces: []*Face{{Vertex: [3]uint32{0, 1, 2}}, {Vertex: [3]uint32{1, 3, 2}}}}}
+	ms.Nodes = append(ms.Nodes, nd)
+	ms.Materials = append(ms.Materials, &BaseMaterial{Color: [3]byte{255, 255, 255}})
+	return ms
+}
+
+func maxRoundTripError(vs []vec3.Vec[float64], ref []vec3.Vec[float64], origin vec3.Vec[float64]) float64 {
+	var maxErr float64
+	for i := range vs {
+		for k := 0; k < 3; k++ {
+			back := float64(float32(vs[i][k])) + origin[k]
+			maxErr = math.Max(maxErr, math.Abs(back-ref[i][k]))
+		}
+	}
+	return maxErr
+}
+
+func TestRTCRoundTrip(t *testing.T) {
+	ms := rtcTestMesh()
+	ref := append([]vec3.Vec[float64]{}, ms.Nodes[0].Vertices...)
+
+	naive := maxRoundTripError(ref, ref, vec3.Vec[float64]{})
+	assert.Greater(t, naive, 0.01)
+
+	origin := ms.ToRTC()
+	assert.InDelta(t, rtcWorld[0]+12.345/2, origin[0], 1e-6)
+	assert.InDelta(t, rtcWorld[1]+6.789/2, origin[1], 1e-6)
+	assert.InDelta(t, rtcWorld[2]+3.211/2, origin[2], 1e-6)
+
+	rtc := maxRoundTripError(ms.Nodes[0].Vertices, ref, origin)
+	assert.Less(t, rtc, 0.001)
+}
+
+func TestRTCRebaseMatrixAndInstances(t *testing.T) {
+	ms := rtcTestMesh()
+	nd := ms.Nodes[0]
+	nd.Mat = &mat4.Mat[float64]{
+		vec4.Vec[float64]{1, 0, 0, 0},
+		vec4.Vec[float64]{0, 1, 0, 0},
+		vec4.Vec[float64]{0, 0, 1, 0},
+		vec4.Vec[float64]{100, 200, 300, 1},
+	}
+	var world []vec3.Vec[float64]
+	for i := range nd.Vertices {
+		world = append(world, transformPoint(nd.Mat, &nd.Vertices[i]))
+	}
+	inst := &InstanceMesh[float64]{
+		Transfors: []*mat4.Mat[float64]{{
+			vec4.Vec[float64]{1, 0, 0, 0},
+			vec4.Vec[float64]{0, 1, 0, 0},
+			vec4.Vec[float64]{0, 0, 1, 0},
+			vec4.Vec[float64]{rtcWorld[0], rtcWorld[1], rtcWorld[2], 1},
+		}},
+		BBox: &[6]float64{rtcWorld[0] - 1, rtcWorld[1] - 1, rtcWorld[2] - 1, rtcWorld[0] + 1, rtcWorld[1] + 1, rtcWorld[2] + 1},
+		Mesh: &BaseMesh[float64]{},
+	}
+	ms.InstanceNode = append(ms.InstanceNode, inst)
+
+	origin := vec3.Vec[float64]{rtcWorld[0], rtcWorld[1], rtcWorld[2]}
+	ms.Rebase(origin)
+
+	// the node keeps its place, centered on its vertices
+	for i := range nd.Vertices {
+		w := transformPoint(nd.Mat, &nd.Vertices[i])
+		for k := range 3 {
+			assert.InDelta(t, world[i][k]-origin[k], w[k], 1e-6)
+		}
+	}
+	assert.InDelta(t, 100+12.345/2, nd.Mat[3][0], 1e-6)
+	assert.InDelta(t, 6.789/2, nd.Vertices[3][1], 1e-6)
+	assert.Equal(t, vec4.Vec[float64]{0, 0, 0, 1}, inst.Transfors[0][3])
+	assert.Equal(t, [6]float64{-1, -1, -1, 1, 1, 1}, *inst.BBox)
+}
+
+func TestRTCRoundTripMatrix(t *testing.T) {
+	// a turned node whose vertices still hold the world position
+	ms := rtcTestMesh()
+	nd := ms.Nodes[0]
+	nd.Mat = &mat4.Mat[float64]{{0, 1, 0, 0}, {-1, 0, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}
+	var ref []vec3.Vec[float64]
+	for i := range nd.Vertices {
+		ref = append(ref, transformPoint(nd.Mat, &nd.Vertices[i]))
+	}
+	origin := ms.ToRTC()
+
+	// positions and matrix go to glTF as float32
+	var mt mat4.Mat[float64]
+	for c := range 4 {
+		for r := range 4 {
+			mt[c][r] = float64(float32(nd.Mat[c][r]))
+		}
+	}
+	var maxErr float64
+	for i, v := range nd.Vertices {
+		v32 := vec3.Vec[float64]{float64(float32(v[0])), float64(float32(v[1])), float64(float32(v[2]))}
+		w := transformPoint(&mt, &v32)
+		for k := range 3 {
+			maxErr = math.Max(maxErr, math.Abs(w[k]+origin[k]-ref[i][k]))
+		}
+	}
+	assert.Less(t, maxErr, 0.001)
+}
+
+func TestRTCTileTransform(t *testing.T) {
+	tr := RTCTileTransform(rtcWorld)
+	assert.Equal(t, rtcWorld[0], tr[12])
+	assert.Equal(t, rtcWorld[1], tr[13])
+	assert.Equal(t, rtcWorld[2], tr[14])
+	assert.Equal(t, 1.0, tr[15])
+}
+
+func TestSetGltfRTC(t *testing.T) {
+	ms := rtcTestMesh()
+	origin := ms.ToRTC()
+
+	doc := CreateDoc()
+	assert.Nil(t, BuildGltf(doc, ms, false, false))
+	nodes := doc.Scenes[0].Nodes
+	SetGltfRTC(doc, origin, RTC_MODE_ROOT_NODE)
+	assert.Len(t, doc.Scenes[0].Nodes, 1)
+	root := doc.Nodes[doc.Scenes[0].Nodes[0]]
+	assert.Equal(t, "rtc", root.Name)
+	assert.Equal(t, [3]float64{origin[0], origin[1], origin[2]}, root.Translation)
+	assert.Equal(t, nodes, root.Children)
+
+	doc = CreateDoc()
+	assert.Nil(t, BuildGltf(doc, ms, false, false))
+	SetGltfRTC(doc, origin, RTC_MODE_CESIUM)
+	SetGltfRTC(doc, origin, RTC_MODE_CESIUM)
+	assert.Equal(t, []string{CESIUM_RTC_EXTENSION}, doc.ExtensionsUsed)
+	bt, err := json.Marshal(doc.Extensions[CESIUM_RTC_EXTENSION])
+	assert.Nil(t, err)
+	var ext struct {
+		Center [3]float64 `json:"center"`
+	}
+	assert.Nil(t, json.Unmarshal(bt, &ext))
+	assert.Equal(t, [3]float64{origin[0], origin[1], origin[2]}, ext.Center)
+
+	_, err = GetGltfBinary(doc, 8)
+	assert.Nil(t, err)
+}
+
+func TestGltfFloat32Positions(t *testing.T) {
+	ms := rtcTestMesh()
+	ms.ToRTC()
+	doc := CreateDoc()
+	assert.Nil(t, BuildGltf(doc, ms, false, false))
+	pos := doc.BufferViews[1]
+	assert.Equal(t, len(ms.Nodes[0].Vertices)*3*4, pos.ByteLength)
+}
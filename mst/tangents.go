@@ -0,0 +1,180 @@
+package mst
+
+import (
+	"errors"
+	"math"
+
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/go3d/vec4"
+)
+
+var ErrNoTangentBasis = errors.New("mst: tangents need per vertex normals and uvs")
+
+type tangentKey struct {
+	v    uint32
+	flip bool
+}
+
+// ComputeTangents fills Tangents the way MikkTSpace does: the uv derivative
+// of every face is projected onto the tangent plane of each corner normal
+// and summed with the corner angle as weight. W holds the handedness, the
+// bitangent is cross(normal, tangent) * w as glTF expects. Vertices shared
+// by faces of mirrored uvs are split, the first copy keeps its index.
+//
+// Normals and uvs have to be per vertex, see Weld and ComputeNormals.
+func (n *MeshNode[T]) ComputeTangents() error {
+	nv := len(n.Vertices)
+	if len(n.Normals) != nv || len(n.TexCoords) != nv {
+		return ErrNoTangentBasis
+	}
+	for _, g := range n.FaceGroup {
+		for _, f := range g.Faces {
+			if f.Normal != nil || f.Uv != nil {
+				return ErrNoTangentBasis
+			}
+		}
+	}
+
+	f64 := func(v vec3.Vec[T]) vec3.Vec[float64] {
+		return vec3.Vec[float64]{float64(v[0]), float64(v[1]), float64(v[2])}
+	}
+	// projected is the part of v orthogonal to the unit vector nm
+	projected := func(v, nm vec3.Vec[float64]) vec3.Vec[float64] {
+		s := nm.Scaled(vec3.Dot(&v, &nm))
+		return vec3.Sub(&v, &s)
+	}
+	unit := func(v vec3.Vec[float64]) vec3.Vec[float64] {
+		if l := v.Length(); l > 0 {
+			v.Scale(1 / l)
+		}
+		return v
+	}
+
+	sums := map[tangentKey]*vec3.Vec[float64]{}
+	var keys []tangentKey
+	type corner struct {
+		f   *Face
+		k   int
+		key tangentKey
+	}
+	var corners []corner
+	for _, g := range n.FaceGroup {
+		for _, f := range g.Faces {
+			var p [3]vec3.Vec[float64]
+			var uv [3]vec2.Vec[float64]
+			for k := range 3 {
+				p[k] = f64(n.Vertices[f.Vertex[k]])
+				t := n.TexCoords[f.Vertex[k]]
+				uv[k] = vec2.Vec[float64]{float64(t[0]), float64(t[1])}
+			}
+			e1, e2 := vec3.Sub(&p[1], &p[0]), vec3.Sub(&p[2], &p[0])
+			s1, t1 := uv[1][0]-uv[0][0], uv[1][1]-uv[0][1]
+			s2, t2 := uv[2][0]-uv[0][0], uv[2][1]-uv[0][1]
+			det := s1*t2 - s2*t1
+			var tan, bitan vec3.Vec[float64]
+			if det != 0 {
+				a, b := e1.Scaled(t2), e2.Scaled(t1)
+				tan = vec3.Sub(&a, &b)
+				a, b = e2.Scaled(s1), e1.Scaled(s2)
+				bitan = vec3.Sub(&a, &b)
+				if det < 0 {
+					tan.Scale(-1)
+					bitan.Scale(-1)
+				}
+			}
+			fn := vec3.Cross(&e1, &e2)
+			// mirrored uvs turn the uv frame against the geometric normal
+			c := vec3.Cross(&fn, &tan)
+			flip := vec3.Dot(&c, &bitan) < 0
+
+			for k := range 3 {
+				key := tangentKey{f.Vertex[k], flip}
+				corners = append(corners, corner{f, k, key})
+				sum, ok := sums[key]
+				if !ok {
+					sum = &vec3.Vec[float64]{}
+					sums[key] = sum
+					keys = append(keys, key)
+				}
+				if tan.IsZero() || fn.IsZero() {
+					continue
+				}
+				nm := unit(f64(n.Normals[f.Vertex[k]]))
+				a, b := vec3.Sub(&p[(k+1)%3], &p[k]), vec3.Sub(&p[(k+2)%3], &p[k])
+				a, b = projected(a, nm), projected(b, nm)
+				w := vec3.Angle(&a, &b)
+				if math.IsNaN(w) {
+					w = 0
+				}
+				t := unit(projected(tan, nm))
+				t.Scale(w)
+				sum.Add(&t)
+			}
+		}
+	}
+
+	hasColor := len(n.Colors) == nv && nv > 0
+	hasFeature := len(n.FeatureIds) == nv && nv > 0
+	tangents := make([]vec4.Vec[T], nv)
+	index := map[tangentKey]uint32{}
+	used := make([]bool, nv)
+	for _, key := range keys {
+		v := key.v
+		i := v
+		if used[v] {
+			i = uint32(len(n.Vertices))
+			n.Vertices = append(n.Vertices, n.Vertices[v])
+			n.Normals = append(n.Normals, n.Normals[v])
+			n.TexCoords = append(n.TexCoords, n.TexCoords[v])
+			if hasColor {
+				n.Colors = append(n.Colors, n.Colors[v])
+			}
+			if hasFeature {
+				n.FeatureIds = append(n.FeatureIds, n.FeatureIds[v])
+			}
+			tangents = append(tangents, vec4.Vec[T]{})
+		}
+		used[v] = true
+		index[key] = i
+
+		nm := unit(f64(n.Normals[v]))
+		t := unit(projected(*sums[key], nm))
+		if t.IsZero() {
+			// no usable uvs around the vertex, any tangent will do
+			axis := vec3.Vec[float64]{1, 0, 0}
+			if math.Abs(nm[0]) > 0.9 {
+				axis = vec3.Vec[float64]{0, 1, 0}
+			}
+			t = unit(projected(axis, nm))
+		}
+		w := T(1)
+		if key.flip {
+			w = -1
+		}
+		tangents[i] = vec4.Vec[T]{T(t[0]), T(t[1]), T(t[2]), w}
+	}
+	for _, c := range corners {
+		c.f.Vertex[c.k] = index[c.key]
+	}
+	n.Tangents = tangents
+	return nil
+}
+
+// ComputeTangents computes the tangents of every node of the mesh and of its
+// instances. Nodes without per vertex normals and uvs, such as untextured
+// ones, are left without tangents.
+func (m *Mesh[T]) ComputeTangents() error {
+	nodes := m.Nodes
+	for _, inst := range m.InstanceNode {
+		if inst.Mesh != nil {
+			nodes = append(nodes[:len(nodes):len(nodes)], inst.Mesh.Nodes...)
+		}
+	}
+	for _, nd := range nodes {
+		if err := nd.ComputeTangents(); err != nil && !errors.Is(err, ErrNoTangentBasis) {
+			return err
+		}
+	}
+	return nil
+}
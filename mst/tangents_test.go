@@ -0,0 +1,119 @@
+package mst
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/go3d/vec4"
+)
+
+// quadNode returns two quads in the xy plane facing +z, sharing the edge at
+// x = 1. The uvs of the second quad are mirrored along u.
+func quadNode() *MeshNode[float64] {
+	return &MeshNode[float64]{
+		Vertices:  []vec3.Vec[float64]{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1, 1, 0}, {2, 0, 0}, {2, 1, 0}},
+		Normals:   []vec3.Vec[float64]{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1}},
+		TexCoords: []vec2.Vec[float64]{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 0}, {0, 1}},
+		FaceGroup: []*MeshTriangle{{Faces: []*Face{
+			{Vertex: [3]uint32{0, 1, 2}}, {Vertex: [3]uint32{1, 3, 2}},
+			{Vertex: [3]uint32{1, 4, 3}}, {Vertex: [3]uint32{4, 5, 3}},
+		}}},
+	}
+}
+
+func TestComputeTangents(t *testing.T) {
+	nd := quadNode()
+	nd.Colors = [][3]byte{{0, 0, 0}, {1, 1, 1}, {2, 2, 2}, {3, 3, 3}, {4, 4, 4}, {5, 5, 5}}
+	nd.FeatureIds = []uint32{0, 1, 2, 3, 4, 5}
+	want := facePositions(nd)
+	assert.Nil(t, nd.ComputeTangents())
+	// the shared edge is split by handedness
+	assert.Equal(t, 8, len(nd.Vertices))
+	assert.Equal(t, 8, len(nd.Tangents))
+	assert.Equal(t, 8, len(nd.Normals))
+	assert.Equal(t, 8, len(nd.Colors))
+	assert.Equal(t, 8, len(nd.FeatureIds))
+	assert.Equal(t, [3]byte{3, 3, 3}, nd.Colors[7])
+	assert.Equal(t, uint32(3), nd.FeatureIds[7])
+	assert.Equal(t, want, facePositions(nd))
+	for i, f := range nd.FaceGroup[0].Faces {
+		for _, v := range f.Vertex {
+			if i < 2 {
+				assert.Equal(t, vec4.Vec[float64]{1, 0, 0, 1}, nd.Tangents[v])
+			} else {
+				assert.Equal(t, vec4.Vec[float64]{-1, 0, 0, -1}, nd.Tangents[v])
+			}
+		}
+	}
+
+	// faces without usable uvs still get a tangent orthogonal to the normal
+	nd = quadNode()
+	for i := range nd.TexCoords {
+		nd.TexCoords[i] = vec2.Vec[float64]{0.5, 0.5}
+	}
+	assert.Nil(t, nd.ComputeTangents())
+	for i, tn := range nd.Tangents {
+		v := tn.Vec3()
+		assert.InDelta(t, 0, vec3.Dot(&v, &nd.Normals[i]), 1e-9)
+		assert.InDelta(t, 1, v.Length(), 1e-9)
+	}
+
+	nd = quadNode()
+	nd.TexCoords = nil
+	assert.Equal(t, ErrNoTangentBasis, nd.ComputeTangents())
+	nd = quadNode()
+	nd.FaceGroup[0].Faces[0].Uv = &[3]uint32{0, 1, 2}
+	assert.Equal(t, ErrNoTangentBasis, nd.ComputeTangents())
+}
+
+func TestTangentsMarshal(t *testing.T) {
+	ms := NewMesh[float64]()
+	assert.Equal(t, V6, ms.Version)
+	ms.Nodes = append(ms.Nodes, quadNode())
+	assert.Nil(t, ms.ComputeTangents())
+
+	var buf bytes.Buffer
+	MeshMarshal(&buf, ms)
+	got := MeshUnMarshal[float64](&buf)
+	assert.Equal(t, ms.Nodes[0].Tangents, got.Nodes[0].Tangents)
+
+	// older versions have no room for tangents
+	ms.Version = V4
+	buf.Reset()
+	MeshMarshal(&buf, ms)
+	got = MeshUnMarshal[float64](&buf)
+	assert.Equal(t, V4, got.Version)
+	assert.Empty(t, got.Nodes[0].Tangents)
+	assert.Equal(t, ms.Nodes[0].Vertices, got.Nodes[0].Vertices)
+
+	ms.Version = V5
+	doc := CreateDoc()
+	assert.Nil(t, BuildGltf(doc, ms, false, true))
+	ps := doc.Meshes[0].Primitives[0]
+	acc := doc.Accessors[ps.Attributes["TANGENT"]]
+	assert.Equal(t, 8, acc.Count)
+	assert.Equal(t, 8*16, doc.BufferViews[*acc.BufferView].ByteLength)
+	assert.Equal(t, 8, doc.Accessors[ps.Attributes["NORMAL"]].Count)
+}
+
+func TestMeshComputeTangentsMixed(t *testing.T) {
+	// untextured nodes are left alone, in the mesh and in instances
+	plain := quadNode()
+	plain.TexCoords = nil
+	inst := &BaseMesh[float64]{Nodes: []*MeshNode[float64]{quadNode(), cubeNode()}}
+	ms := NewMesh[float64]()
+	ms.Nodes = append(ms.Nodes, quadNode(), plain)
+	ms.InstanceNode = append(ms.InstanceNode, &InstanceMesh[float64]{Mesh: inst})
+	assert.Nil(t, ms.ComputeTangents())
+	assert.Equal(t, 8, len(ms.Nodes[0].Tangents))
+	assert.Nil(t, ms.Nodes[1].Tangents)
+	assert.Equal(t, 6, len(ms.Nodes[1].Vertices))
+	assert.Equal(t, 8, len(inst.Nodes[0].Tangents))
+	assert.Nil(t, inst.Nodes[1].Tangents)
+
+	doc := CreateDoc()
+	assert.Nil(t, BuildGltf(doc, ms, false, true))
+}
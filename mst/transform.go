@@ -0,0 +1,357 @@
+package mst
+
+import (
+	"errors"
+	"math"
+
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/go3d/vec4"
+)
+
+// vertexTransform applies a matrix to the attributes of vertices. Normals go
+// through the cofactor matrix, the inverse transpose up to scale, and
+// mirroring matrices flip the tangent handedness.
+type vertexTransform[T float64 | float32] struct {
+	mat    mat4.Mat[T]
+	normal [3][3]float64 // row major
+	mirror bool
+}
+
+func newVertexTransform[T float64 | float32](m *mat4.Mat[T]) *vertexTransform[T] {
+	t := &vertexTransform[T]{mat: *m}
+	a := func(r, c int) float64 { return float64(m[c][r]) }
+	det := 0.0
+	for r := range 3 {
+		for c := range 3 {
+			r1, r2 := (r+1)%3, (r+2)%3
+			c1, c2 := (c+1)%3, (c+2)%3
+			t.normal[r][c] = a(r1, c1)*a(r2, c2) - a(r1, c2)*a(r2, c1)
+		}
+		det += a(0, r) * t.normal[0][r]
+	}
+	t.mirror = det < 0
+	return t
+}
+
+func (t *vertexTransform[T]) point(v vec3.Vec[T]) vec3.Vec[T] {
+	t.mat.TransformVec3(&v)
+	return v
+}
+
+func (t *vertexTransform[T]) vector(v vec3.Vec[T]) vec3.Vec[T] {
+	t.mat.TransformVec3W(&v, 0)
+	return v
+}
+
+// unitVec3 scales v to length one, zero vectors stay zero.
+func unitVec3[T float64 | float32](v [3]float64) vec3.Vec[T] {
+	l := math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+	if l == 0 {
+		return vec3.Vec[T]{}
+	}
+	return vec3.Vec[T]{T(v[0] / l), T(v[1] / l), T(v[2] / l)}
+}
+
+func (t *vertexTransform[T]) normalVec(n vec3.Vec[T]) vec3.Vec[T] {
+	var r [3]float64
+	for i := range 3 {
+		for k := range 3 {
+			r[i] += t.normal[i][k] * float64(n[k])
+		}
+		if t.mirror {
+			r[i] = -r[i]
+		}
+	}
+	return unitVec3[T](r)
+}
+
+func (t *vertexTransform[T]) tangent(v vec4.Vec[T]) vec4.Vec[T] {
+	d := t.vector(vec3.Vec[T]{v[0], v[1], v[2]})
+	d = unitVec3[T]([3]float64{float64(d[0]), float64(d[1]), float64(d[2])})
+	w := v[3]
+	if t.mirror {
+		w = -w
+	}
+	return vec4.Vec[T]{d[0], d[1], d[2], w}
+}
+
+// Transform moves the vertices of the node by mt, turning normals with its
+// inverse transpose. Faces are flipped when mt mirrors, so they keep facing
+// outwards. Mat is left alone.
+func (n *MeshNode[T]) Transform(mt *mat4.Mat[T]) {
+	tr := newVertexTransform(mt)
+	for i, v := range n.Vertices {
+		n.Vertices[i] = tr.point(v)
+	}
+	for i, vn := range n.Normals {
+		n.Normals[i] = tr.normalVec(vn)
+	}
+	for i, tn := range n.Tangents {
+		n.Tangents[i] = tr.tangent(tn)
+	}
+	if !tr.mirror {
+		return
+	}
+	// index arrays may be shared between faces, so they are replaced
+	for _, g := range n.FaceGroup {
+		for _, f := range g.Faces {
+			f.Vertex[1], f.Vertex[2] = f.Vertex[2], f.Vertex[1]
+			if f.Normal != nil {
+				f.Normal = &[3]uint32{f.Normal[0], f.Normal[2], f.Normal[1]}
+			}
+			if f.Uv != nil {
+				f.Uv = &[3]uint32{f.Uv[0], f.Uv[2], f.Uv[1]}
+			}
+		}
+	}
+}
+
+// BakeMatrix applies Mat to the vertices and clears it.
+func (n *MeshNode[T]) BakeMatrix() {
+	if n.Mat != nil {
+		n.Transform(n.Mat)
+		n.Mat = nil
+	}
+}
+
+// Clone returns a deep copy of the node.
+func (n *MeshNode[T]) Clone() *MeshNode[T] {
+	c := &MeshNode[T]{
+		Vertices:   append([]vec3.Vec[T](nil), n.Vertices...),
+		Normals:    append([]vec3.Vec[T](nil), n.Normals...),
+		Colors:     append([][3]byte(nil), n.Colors...),
+		TexCoords:  append([]vec2.Vec[T](nil), n.TexCoords...),
+		Tangents:   append([]vec4.Vec[T](nil), n.Tangents...),
+		FeatureIds: append([]uint32(nil), n.FeatureIds...),
+	}
+	if n.Mat != nil {
+		mt := *n.Mat
+		c.Mat = &mt
+	}
+	for _, g := range n.FaceGroup {
+		fg := &MeshTriangle{Batchid: g.Batchid, Faces: make([]*Face, len(g.Faces))}
+		for i, f := range g.Faces {
+			nf := &Face{Vertex: f.Vertex}
+			if f.Normal != nil {
+				vn := *f.Normal
+				nf.Normal = &vn
+			}
+			if f.Uv != nil {
+				vt := *f.Uv
+				nf.Uv = &vt
+			}
+			fg.Faces[i] = nf
+		}
+		c.FaceGroup = append(c.FaceGroup, fg)
+	}
+	for _, g := range n.EdgeGroup {
+		c.EdgeGroup = append(c.EdgeGroup, &MeshOutline{Batchid: g.Batchid, Edges: append([][2]int(nil), g.Edges...)})
+	}
+	return c
+}
+
+// Transform moves the nodes by mt. Nodes with a matrix keep their vertices
+// and get mt * Mat, a mirroring mt then leaves their winding to the
+// matrix; bake them first to flip their faces as well.
+func (m *BaseMesh[T]) Transform(mt *mat4.Mat[T]) {
+	for _, nd := range m.Nodes {
+		if nd.Mat != nil {
+			nd.Mat = mat4.AssignMul(mt, nd.Mat)
+		} else {
+			nd.Transform(mt)
+		}
+	}
+}
+
+// BakeMatrices bakes the matrices of all nodes.
+func (m *BaseMesh[T]) BakeMatrices() {
+	for _, nd := range m.Nodes {
+		nd.BakeMatrix()
+	}
+}
+
+// ComputeBBox updates BBox to the box around every placed copy of the
+// instance mesh and returns it.
+func (inst *InstanceMesh[T]) ComputeBBox() *[6]float64 {
+	bbox := vec3.MinBox
+	for _, tf := range inst.Transfors {
+		b := inst.copyBox(tf)
+		bbox.Join(&b)
+	}
+	inst.BBox = &[6]float64{bbox.Min[0], bbox.Min[1], bbox.Min[2], bbox.Max[0], bbox.Max[1], bbox.Max[2]}
+	return inst.BBox
+}
+
+// copyBox returns the box around the copy placed by tf.
+func (inst *InstanceMesh[T]) copyBox(tf *mat4.Mat[T]) vec3.Box[float64] {
+	bbox := vec3.MinBox
+	for _, nd := range inst.Mesh.Nodes {
+		b := nd.GetBoundbox()
+		if len(nd.Vertices) == 0 {
+			continue
+		}
+		mt := tf
+		if nd.Mat != nil {
+			mt = mat4.AssignMul(tf, nd.Mat)
+		}
+		for k := range 8 {
+			c := vec3.Vec[T]{T(b[(k&1)*3]), T(b[1+(k>>1&1)*3]), T(b[2+(k>>2&1)*3])}
+			mt.TransformVec3(&c)
+			bbox.Extend(&vec3.Vec[float64]{float64(c[0]), float64(c[1]), float64(c[2])})
+		}
+	}
+	return bbox
+}
+
+// Transform moves the whole mesh by mt: the nodes as BaseMesh.Transform
+// does and the instances by premultiplying their transforms.
+func (m *Mesh[T]) Transform(mt *mat4.Mat[T]) {
+	m.BaseMesh.Transform(mt)
+	for _, inst := range m.InstanceNode {
+		for i, tf := range inst.Transfors {
+			inst.Transfors[i] = mat4.AssignMul(mt, tf)
+		}
+		if inst.Mesh != nil {
+			inst.ComputeBBox()
+		}
+	}
+}
+
+// BakeNodeMatrices bakes the matrices of the nodes of the mesh and of its
+// instance meshes.
+func (m *Mesh[T]) BakeNodeMatrices() {
+	m.BaseMesh.BakeMatrices()
+	for _, inst := range m.InstanceNode {
+		if inst.Mesh != nil {
+			inst.Mesh.BakeMatrices()
+			inst.ComputeBBox()
+		}
+	}
+}
+
+// FlattenInstances turns every placed instance into regular nodes, baked
+// with its transform. The materials of the instance meshes are appended to
+// the mesh and, when the instances have features, the copies get them as
+// FeatureIds.
+func (m *Mesh[T]) FlattenInstances() {
+	for _, inst := range m.InstanceNode {
+		if inst.Mesh == nil {
+			continue
+		}
+		offset := len(m.Materials)
+		m.Materials = append(m.Materials, inst.Mesh.Materials...)
+		for i := range inst.Transfors {
+			m.Nodes = append(m.Nodes, inst.copyNodes(i, offset)...)
+		}
+	}
+	m.InstanceNode = nil
+}
+
+// copyNodes returns the nodes of the i-th placed copy, baked with its
+// transform and with their materials moved by offset.
+func (inst *InstanceMesh[T]) copyNodes(i int, offset int) []*MeshNode[T] {
+	var nds []*MeshNode[T]
+	tf := inst.Transfors[i]
+	for _, src := range inst.Mesh.Nodes {
+		nd := src.Clone()
+		mt := tf
+		if nd.Mat != nil {
+			mt = mat4.AssignMul(tf, nd.Mat)
+			nd.Mat = nil
+		}
+		nd.Transform(mt)
+		for _, g := range nd.FaceGroup {
+			if g.Batchid >= 0 {
+				g.Batchid += offset
+			}
+		}
+		for _, g := range nd.EdgeGroup {
+			if g.Batchid >= 0 {
+				g.Batchid += offset
+			}
+		}
+		if i < len(inst.Features) {
+			nd.FeatureIds = make([]uint32, len(nd.Vertices))
+			for k := range nd.FeatureIds {
+				nd.FeatureIds[k] = uint32(inst.Features[i])
+			}
+		}
+		nds = append(nds, nd)
+	}
+	return nds
+}
+
+const (
+	AXIS_Z_UP_RIGHT_HANDED = 0 // x east, y north, z up, as ECEF and ENU frames
+	AXIS_Y_UP_RIGHT_HANDED = 1 // x right, y up, z towards the viewer, as glTF
+	AXIS_Z_UP_LEFT_HANDED  = 2 // x forward, y right, z up
+	AXIS_Y_UP_LEFT_HANDED  = 3 // x right, y up, z forward
+)
+
+var ErrUnknownAxis = errors.New("mst: unknown axis convention")
+
+// axisToZUp holds, for every convention, the rows of the matrix taking it
+// to AXIS_Z_UP_RIGHT_HANDED.
+var axisToZUp = [4][3][3]float64{
+	{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+	{{1, 0, 0}, {0, 0, -1}, {0, 1, 0}},
+	{{1, 0, 0}, {0, -1, 0}, {0, 0, 1}},
+	{{1, 0, 0}, {0, 0, 1}, {0, 1, 0}},
+}
+
+// AxisMatrix returns the matrix converting coordinates from one axis
+// convention to another, both one of the AXIS_* constants.
+func AxisMatrix[T float64 | float32](from, to int) (*mat4.Mat[T], error) {
+	if from < 0 || from >= len(axisToZUp) || to < 0 || to >= len(axisToZUp) {
+		return nil, ErrUnknownAxis
+	}
+	a, b := axisToZUp[from], axisToZUp[to]
+	mt := &mat4.Mat[T]{}
+	// b is orthonormal, b^T * a takes from to to
+	for r := range 3 {
+		for c := range 3 {
+			var v float64
+			for k := range 3 {
+				v += b[k][r] * a[k][c]
+			}
+			mt[c][r] = T(v)
+		}
+	}
+	mt[3][3] = 1
+	return mt, nil
+}
+
+// ConvertAxis converts the mesh between axis conventions. Instance meshes
+// are converted as well, so their transforms stay rotations. Switching
+// handedness mirrors, the nodes are baked first to flip their faces.
+func (m *Mesh[T]) ConvertAxis(from, to int) error {
+	mt, err := AxisMatrix[T](from, to)
+	if err != nil {
+		return err
+	}
+	inv, _ := AxisMatrix[T](to, from)
+	mirror := newVertexTransform(mt).mirror
+	meshes := []*BaseMesh[T]{&m.BaseMesh}
+	for _, inst := range m.InstanceNode {
+		if inst.Mesh != nil {
+			meshes = append(meshes, inst.Mesh)
+		}
+	}
+	for _, bm := range meshes {
+		if mirror {
+			bm.BakeMatrices()
+		}
+		bm.Transform(mt)
+	}
+	for _, inst := range m.InstanceNode {
+		for i, tf := range inst.Transfors {
+			inst.Transfors[i] = mat4.AssignMul(mt, mat4.AssignMul(tf, inv))
+		}
+		if inst.Mesh != nil {
+			inst.ComputeBBox()
+		}
+	}
+	return nil
+}
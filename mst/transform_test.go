@@ -0,0 +1,142 @@
+package mst
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+func scaling(x, y, z float64) *mat4.Mat[float64] {
+	return &mat4.Mat[float64]{{x, 0, 0, 0}, {0, y, 0, 0}, {0, 0, z, 0}, {0, 0, 0, 1}}
+}
+
+// assertOutwards checks that the faces of a closed node wind around center
+// and agree with their vertex normals.
+func assertOutwards(t *testing.T, nd *MeshNode[float64], center vec3.Vec[float64]) {
+	t.Helper()
+	for _, f := range nd.FaceGroup[0].Faces {
+		a, b, c := nd.Vertices[f.Vertex[0]], nd.Vertices[f.Vertex[1]], nd.Vertices[f.Vertex[2]]
+		e1, e2 := vec3.Sub(&b, &a), vec3.Sub(&c, &a)
+		fn := vec3.Cross(&e1, &e2)
+		out := vec3.Sub(&a, &center)
+		assert.Greater(t, vec3.Dot(&fn, &out), 0.0)
+		for _, v := range f.Vertex {
+			assert.Greater(t, vec3.Dot(&fn, &nd.Normals[v]), 0.0)
+		}
+	}
+}
+
+func TestNodeTransform(t *testing.T) {
+	// normals of a slanted plane under non-uniform scale
+	d := 1 / math.Sqrt(2)
+	nd := &MeshNode[float64]{
+		Vertices:  []vec3.Vec[float64]{{0, 0, 0}, {1, 0, 1}, {0, 1, 0}},
+		Normals:   []vec3.Vec[float64]{{d, 0, -d}, {d, 0, -d}, {d, 0, -d}},
+		FaceGroup: []*MeshTriangle{{Faces: []*Face{{Vertex: [3]uint32{0, 1, 2}}}}},
+	}
+	nd.Transform(scaling(2, 1, 1))
+	assert.Equal(t, vec3.Vec[float64]{2, 0, 1}, nd.Vertices[1])
+	want := vec3.Vec[float64]{1 / math.Sqrt(5), 0, -2 / math.Sqrt(5)}
+	for k := range 3 {
+		assert.InDelta(t, want[k], nd.Normals[0][k], 1e-9)
+	}
+	e := vec3.Sub(&nd.Vertices[1], &nd.Vertices[0])
+	assert.InDelta(t, 0, vec3.Dot(&e, &nd.Normals[0]), 1e-9)
+
+	// mirroring flips the faces, shared index arrays only once
+	nd = cubeNode()
+	nd.ComputeNormals(DefaultNormalOptions)
+	shared := &[3]uint32{0, 1, 2}
+	nd.FaceGroup[0].Faces[0].Uv, nd.FaceGroup[0].Faces[1].Uv = shared, shared
+	nd.Transform(scaling(-1, 1, 1))
+	assertOutwards(t, nd, vec3.Vec[float64]{-0.5, 0.5, 0.5})
+	assert.Equal(t, [3]uint32{0, 2, 1}, *nd.FaceGroup[0].Faces[0].Uv)
+	assert.Equal(t, [3]uint32{0, 2, 1}, *nd.FaceGroup[0].Faces[1].Uv)
+	assert.Equal(t, [3]uint32{0, 1, 2}, *shared)
+}
+
+func TestMeshTransform(t *testing.T) {
+	ms := instanceMesh()
+	moved := &mat4.Mat[float64]{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 100, 1}}
+	ms.Nodes[1].Mat = moved
+	ms.Instance(DefaultInstanceOptions)
+	bbox := *ms.InstanceNode[0].ComputeBBox()
+
+	ms.Transform(moved)
+	assert.Equal(t, 200.0, ms.Nodes[0].Mat[3][2])
+	assert.Equal(t, vec3.Vec[float64]{9, 9, 109}, ms.Nodes[1].Mat[3].Vec3())
+	assert.InDelta(t, bbox[2]+100, ms.InstanceNode[0].BBox[2], 1e-9)
+	assert.InDelta(t, bbox[5]+100, ms.InstanceNode[0].BBox[5], 1e-9)
+
+	ms.BakeNodeMatrices()
+	assert.Nil(t, ms.Nodes[0].Mat)
+	assert.Equal(t, vec3.Vec[float64]{0, 0, 200}, ms.Nodes[0].Vertices[0])
+	// the mirrored cube was baked with its faces flipped
+	nd := ms.Nodes[1]
+	nd.ComputeNormals(DefaultNormalOptions)
+	assertOutwards(t, nd, vec3.Vec[float64]{8.5, 9.5, 109.5})
+}
+
+func TestFlattenInstances(t *testing.T) {
+	ms := instanceMesh()
+	var want [][]vec3.Vec[float64]
+	for _, nd := range ms.Nodes {
+		want = append(want, newNodeShape(nd).points)
+	}
+	centers := []vec3.Vec[float64]{newNodeShape(ms.Nodes[0]).center, newNodeShape(ms.Nodes[2]).center, newNodeShape(ms.Nodes[3]).center}
+	ms.Instance(DefaultInstanceOptions)
+	ms.FlattenInstances()
+
+	assert.Empty(t, ms.InstanceNode)
+	assert.Equal(t, 5, len(ms.Nodes))
+	assert.Equal(t, 3, len(ms.Materials))
+	for k, id := range []int{0, 2, 3} {
+		nd := ms.Nodes[2+k]
+		assert.Nil(t, nd.Mat)
+		assert.Equal(t, 2, nd.FaceGroup[0].Batchid)
+		assert.Equal(t, uint32(id), nd.FeatureIds[0])
+		for i, v := range nd.Vertices {
+			w := vec3.Add(&want[id][i], &centers[k])
+			for j := range 3 {
+				assert.InDelta(t, w[j], v[j], 1e-6)
+			}
+		}
+	}
+}
+
+func TestConvertAxis(t *testing.T) {
+	up := vec3.Vec[float64]{0, 1, 0}
+	mt, err := AxisMatrix[float64](AXIS_Y_UP_RIGHT_HANDED, AXIS_Z_UP_RIGHT_HANDED)
+	assert.Nil(t, err)
+	assert.Equal(t, vec3.Vec[float64]{0, 0, 1}, mt.MulVec3(&up))
+	for from := range 4 {
+		for to := range 4 {
+			a, _ := AxisMatrix[float64](from, to)
+			b, _ := AxisMatrix[float64](to, from)
+			assert.Equal(t, mat4.Mat[float64]{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}, *mat4.AssignMul(a, b))
+		}
+	}
+
+	ms := instanceMesh()
+	ms.Nodes[0].ComputeNormals(DefaultNormalOptions)
+	ms.Nodes[1].Mat = scaling(1, 1, 1)
+	assert.Nil(t, ms.ConvertAxis(AXIS_Z_UP_RIGHT_HANDED, AXIS_Y_UP_LEFT_HANDED))
+	assert.Nil(t, ms.Nodes[1].Mat)
+	assertOutwards(t, ms.Nodes[0], vec3.Vec[float64]{0.5, 0.5, 0.5})
+	assert.Equal(t, vec3.Vec[float64]{0, 1, 0}, ms.Nodes[0].Vertices[4])
+
+	// instance transforms stay rotations
+	ms = instanceMesh()
+	ms.Instance(DefaultInstanceOptions)
+	assert.Nil(t, ms.ConvertAxis(AXIS_Z_UP_RIGHT_HANDED, AXIS_Z_UP_LEFT_HANDED))
+	for _, tf := range ms.InstanceNode[0].Transfors {
+		assert.False(t, newVertexTransform(tf).mirror)
+	}
+
+	_, err = AxisMatrix[float64](AXIS_Y_UP_LEFT_HANDED+1, AXIS_Z_UP_RIGHT_HANDED)
+	assert.Equal(t, ErrUnknownAxis, err)
+	assert.Equal(t, ErrUnknownAxis, ms.ConvertAxis(AXIS_Z_UP_RIGHT_HANDED, -1))
+}
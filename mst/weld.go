@@ -0,0 +1,225 @@
+package mst
+
+import (
+	"math"
+
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/go3d/vec4"
+)
+
+// WeldOptions sets how far apart vertex attributes may be for Weld to merge
+// the vertices. Zero epsilons require exact equality, colors and feature ids
+// always have to be equal. Tangents use NormalEpsilon.
+type WeldOptions struct {
+	PositionEpsilon float64
+	NormalEpsilon   float64
+	UvEpsilon       float64
+}
+
+var DefaultWeldOptions = WeldOptions{PositionEpsilon: 1e-6, NormalEpsilon: 1e-4, UvEpsilon: 1e-6}
+
+// WeldStats reports the vertex counts before and after welding.
+type WeldStats struct {
+	Before     int
+	After      int
+	Degenerate int // faces removed because welding collapsed them
+}
+
+// Saved returns the number of vertices removed.
+func (s WeldStats) Saved() int {
+	return s.Before - s.After
+}
+
+func (s *WeldStats) add(o WeldStats) {
+	s.Before += o.Before
+	s.After += o.After
+	s.Degenerate += o.Degenerate
+}
+
+// weldKey is a face corner, the indices of its position, normal and uv.
+type weldKey [3]uint32
+
+type weldCell [3]int64
+
+// Weld merges vertices whose attributes match within opts, the inverse of
+// ResortVtVn. Faces and edges are remapped, unused vertices dropped and
+// normals and uvs become per vertex, so Face.Normal and Face.Uv are cleared.
+func (n *MeshNode[T]) Weld(opts WeldOptions) WeldStats {
+	stats := WeldStats{Before: len(n.Vertices)}
+	hasNormal := len(n.Normals) > 0
+	hasUv := len(n.TexCoords) > 0
+	hasColor := len(n.Colors) == len(n.Vertices) && len(n.Colors) > 0
+	hasTangent := len(n.Tangents) == len(n.Vertices) && len(n.Tangents) > 0
+	hasFeature := len(n.FeatureIds) == len(n.Vertices) && len(n.FeatureIds) > 0
+
+	var vs, vns []vec3.Vec[T]
+	var vts []vec2.Vec[T]
+	var cls [][3]byte
+	var tns []vec4.Vec[T]
+	var fids []uint32
+	corners := map[weldKey]uint32{}
+	byPosition := map[uint32]uint32{}
+	cells := map[weldCell][]uint32{}
+
+	cell := func(p vec3.Vec[T]) weldCell {
+		var c weldCell
+		for k := range 3 {
+			if opts.PositionEpsilon > 0 {
+				c[k] = int64(math.Floor(float64(p[k]) / opts.PositionEpsilon))
+			} else {
+				c[k] = int64(math.Float64bits(float64(p[k]) + 0))
+			}
+		}
+		return c
+	}
+	near := func(a, b []T, eps float64) bool {
+		for k := range a {
+			if math.Abs(float64(a[k]-b[k])) > eps {
+				return false
+			}
+		}
+		return true
+	}
+	// find returns the welded vertex for a corner, adding it when no
+	// existing vertex is close enough
+	find := func(key weldKey) uint32 {
+		if i, ok := corners[key]; ok {
+			return i
+		}
+		p := n.Vertices[key[0]]
+		var vn vec3.Vec[T]
+		var vt vec2.Vec[T]
+		var cl [3]byte
+		var tn vec4.Vec[T]
+		var fid uint32
+		if hasNormal && int(key[1]) < len(n.Normals) {
+			vn = n.Normals[key[1]]
+		}
+		if hasUv && int(key[2]) < len(n.TexCoords) {
+			vt = n.TexCoords[key[2]]
+		}
+		if hasColor {
+			cl = n.Colors[key[0]]
+		}
+		if hasTangent {
+			tn = n.Tangents[key[0]]
+		}
+		if hasFeature {
+			fid = n.FeatureIds[key[0]]
+		}
+		c := cell(p)
+		d := int64(1)
+		if opts.PositionEpsilon <= 0 {
+			d = 0
+		}
+		for x := c[0] - d; x <= c[0]+d; x++ {
+			for y := c[1] - d; y <= c[1]+d; y++ {
+				for z := c[2] - d; z <= c[2]+d; z++ {
+					for _, i := range cells[weldCell{x, y, z}] {
+						if !near(vs[i][:], p[:], opts.PositionEpsilon) ||
+							hasNormal && !near(vns[i][:], vn[:], opts.NormalEpsilon) ||
+							hasUv && !near(vts[i][:], vt[:], opts.UvEpsilon) ||
+							hasColor && cls[i] != cl ||
+							hasTangent && !near(tns[i][:], tn[:], opts.NormalEpsilon) ||
+							hasFeature && fids[i] != fid {
+							continue
+						}
+						corners[key] = i
+						return i
+					}
+				}
+			}
+		}
+		i := uint32(len(vs))
+		vs = append(vs, p)
+		if hasNormal {
+			vns = append(vns, vn)
+		}
+		if hasUv {
+			vts = append(vts, vt)
+		}
+		if hasColor {
+			cls = append(cls, cl)
+		}
+		if hasTangent {
+			tns = append(tns, tn)
+		}
+		if hasFeature {
+			fids = append(fids, fid)
+		}
+		cells[c] = append(cells[c], i)
+		corners[key] = i
+		if _, ok := byPosition[key[0]]; !ok {
+			byPosition[key[0]] = i
+		}
+		return i
+	}
+
+	for _, g := range n.FaceGroup {
+		faces := g.Faces[:0]
+		for _, f := range g.Faces {
+			var idx [3]uint32
+			for k := range 3 {
+				key := weldKey{f.Vertex[k], f.Vertex[k], f.Vertex[k]}
+				if f.Normal != nil {
+					key[1] = f.Normal[k]
+				}
+				if f.Uv != nil {
+					key[2] = f.Uv[k]
+				}
+				idx[k] = find(key)
+			}
+			if idx[0] == idx[1] || idx[1] == idx[2] || idx[0] == idx[2] {
+				stats.Degenerate++
+				continue
+			}
+			f.Vertex, f.Normal, f.Uv = idx, nil, nil
+			faces = append(faces, f)
+		}
+		g.Faces = faces
+	}
+	for _, g := range n.EdgeGroup {
+		edges := g.Edges[:0]
+		for _, e := range g.Edges {
+			var idx [2]int
+			for k := range 2 {
+				v := uint32(e[k])
+				i, ok := byPosition[v]
+				if !ok {
+					i = find(weldKey{v, v, v})
+				}
+				idx[k] = int(i)
+			}
+			if idx[0] != idx[1] {
+				edges = append(edges, idx)
+			}
+		}
+		g.Edges = edges
+	}
+
+	n.Vertices, n.Normals, n.TexCoords, n.Colors, n.Tangents = vs, vns, vts, cls, tns
+	n.FeatureIds = fids
+	stats.After = len(vs)
+	return stats
+}
+
+// Weld welds every node of the mesh.
+func (m *BaseMesh[T]) Weld(opts WeldOptions) WeldStats {
+	var stats WeldStats
+	for _, nd := range m.Nodes {
+		stats.add(nd.Weld(opts))
+	}
+	return stats
+}
+
+// Weld welds the nodes of the mesh and of its instances.
+func (m *Mesh[T]) Weld(opts WeldOptions) WeldStats {
+	stats := m.BaseMesh.Weld(opts)
+	for _, inst := range m.InstanceNode {
+		if inst.Mesh != nil {
+			stats.add(inst.Mesh.Weld(opts))
+		}
+	}
+	return stats
+}
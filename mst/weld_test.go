@@ -0,0 +1,124 @@
+package mst
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// cubeNode returns a unit cube of 8 vertices and 12 outward facing triangles.
+func cubeNode() *MeshNode[float64] {
+	nd := &MeshNode[float64]{}
+	for i := 0; i < 8; i++ {
+		nd.Vertices = append(nd.Vertices, vec3.Vec[float64]{float64(i & 1), float64(i >> 1 & 1), float64(i >> 2 & 1)})
+	}
+	nd.FaceGroup = []*MeshTriangle{{Batchid: 0, Faces: []*Face{
+		{Vertex: [3]uint32{0, 2, 1}}, {Vertex: [3]uint32{1, 2, 3}}, // bottom
+		{Vertex: [3]uint32{4, 5, 6}}, {Vertex: [3]uint32{5, 7, 6}}, // top
+		{Vertex: [3]uint32{0, 1, 4}}, {Vertex: [3]uint32{1, 5, 4}}, // front
+		{Vertex: [3]uint32{2, 6, 3}}, {Vertex: [3]uint32{3, 6, 7}}, // back
+		{Vertex: [3]uint32{0, 4, 2}}, {Vertex: [3]uint32{2, 4, 6}}, // left
+		{Vertex: [3]uint32{1, 3, 5}}, {Vertex: [3]uint32{3, 7, 5}}, // right
+	}}}
+	return nd
+}
+
+func facePositions(nd *MeshNode[float64]) [][3]vec3.Vec[float64] {
+	var ps [][3]vec3.Vec[float64]
+	for _, g := range nd.FaceGroup {
+		for _, f := range g.Faces {
+			ps = append(ps, [3]vec3.Vec[float64]{nd.Vertices[f.Vertex[0]], nd.Vertices[f.Vertex[1]], nd.Vertices[f.Vertex[2]]})
+		}
+	}
+	return ps
+}
+
+func TestWeld(t *testing.T) {
+	nd := cubeNode()
+	want := facePositions(nd)
+	nd.ResortVtVn(nil)
+	assert.Equal(t, 36, len(nd.Vertices))
+
+	stats := nd.Weld(DefaultWeldOptions)
+	assert.Equal(t, WeldStats{Before: 36, After: 8}, stats)
+	assert.Equal(t, 28, stats.Saved())
+	assert.Equal(t, 8, len(nd.Normals))
+	assert.Equal(t, 8, len(nd.TexCoords))
+	assert.Equal(t, want, facePositions(nd))
+
+	// flat normals keep the corners of different sides apart
+	nd = cubeNode()
+	nd.ResortVtVn(nil)
+	nd.Normals = nil
+	for _, f := range nd.FaceGroup[0].Faces {
+		a, b, c := nd.Vertices[f.Vertex[0]], nd.Vertices[f.Vertex[1]], nd.Vertices[f.Vertex[2]]
+		e1, e2 := vec3.Sub(&b, &a), vec3.Sub(&c, &a)
+		fn := vec3.Cross(&e1, &e2)
+		fn.Normalize()
+		nd.Normals = append(nd.Normals, fn, fn, fn)
+	}
+	assert.Equal(t, 24, nd.Weld(DefaultWeldOptions).After)
+}
+
+func TestWeldEpsilon(t *testing.T) {
+	nd := &MeshNode[float64]{
+		Vertices:  []vec3.Vec[float64]{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1e-8, 1, 0}, {1, 0, 0}, {2, 2, 2}, {1, 1e-7, 0}},
+		TexCoords: []vec2.Vec[float64]{{0, 0}, {1, 0}, {0, 1}, {0, 1}, {0.5, 0}, {0, 0}, {1, 0}},
+		Colors:    [][3]byte{{1, 1, 1}, {1, 1, 1}, {1, 1, 1}, {1, 1, 1}, {1, 1, 1}, {1, 1, 1}, {9, 9, 9}},
+		FaceGroup: []*MeshTriangle{
+			{Batchid: 1, Faces: []*Face{{Vertex: [3]uint32{0, 1, 2}}, {Vertex: [3]uint32{3, 4, 0}}}},
+			{Batchid: 2, Faces: []*Face{{Vertex: [3]uint32{6, 3, 0}}}},
+		},
+		EdgeGroup: []*MeshOutline{{Batchid: 1, Edges: [][2]int{{2, 3}, {0, 3}, {5, 0}}}},
+	}
+	stats := nd.Weld(DefaultWeldOptions)
+	// 3 joins 2; 4 differs in uv, 6 in color, 5 is only used by an edge
+	assert.Equal(t, 7, stats.Before)
+	assert.Equal(t, 6, stats.After)
+	assert.Equal(t, [3]uint32{0, 1, 2}, nd.FaceGroup[0].Faces[0].Vertex)
+	assert.Equal(t, [3]uint32{2, 3, 0}, nd.FaceGroup[0].Faces[1].Vertex)
+	assert.Equal(t, [3]uint32{4, 2, 0}, nd.FaceGroup[1].Faces[0].Vertex)
+	assert.Equal(t, [][2]int{{0, 2}, {5, 0}}, nd.EdgeGroup[0].Edges)
+	assert.Equal(t, vec3.Vec[float64]{2, 2, 2}, nd.Vertices[5])
+	assert.Equal(t, [3]byte{9, 9, 9}, nd.Colors[4])
+
+	// exact welding keeps the jittered vertex
+	nd = &MeshNode[float64]{
+		Vertices:  []vec3.Vec[float64]{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1e-8, 0, 0}, {9, 9, 9}},
+		FaceGroup: []*MeshTriangle{{Faces: []*Face{{Vertex: [3]uint32{0, 1, 2}}, {Vertex: [3]uint32{3, 1, 2}}}}},
+	}
+	assert.Equal(t, WeldStats{Before: 5, After: 4}, nd.Weld(WeldOptions{}))
+
+	// welding may collapse slivers
+	nd = &MeshNode[float64]{
+		Vertices:  []vec3.Vec[float64]{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1, 1e-9, 0}},
+		FaceGroup: []*MeshTriangle{{Faces: []*Face{{Vertex: [3]uint32{0, 1, 2}}, {Vertex: [3]uint32{0, 1, 3}}}}},
+	}
+	stats = nd.Weld(DefaultWeldOptions)
+	assert.Equal(t, 1, stats.Degenerate)
+	assert.Equal(t, 1, len(nd.FaceGroup[0].Faces))
+}
+
+func TestWeldSeparateIndices(t *testing.T) {
+	nd := &MeshNode[float64]{
+		Vertices: []vec3.Vec[float64]{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1, 1, 0}},
+		Normals:  []vec3.Vec[float64]{{0, 0, 1}, {0, 0, -1}},
+	}
+	up, down := [3]uint32{0, 0, 0}, [3]uint32{1, 1, 1}
+	nd.FaceGroup = []*MeshTriangle{{Faces: []*Face{
+		{Vertex: [3]uint32{0, 1, 2}, Normal: &up},
+		{Vertex: [3]uint32{1, 3, 2}, Normal: &up},
+		{Vertex: [3]uint32{0, 2, 1}, Normal: &down},
+	}}}
+	ms := NewMesh[float64]()
+	ms.Nodes = append(ms.Nodes, nd)
+	stats := ms.Weld(DefaultWeldOptions)
+	assert.Equal(t, 7, stats.After)
+	assert.Equal(t, len(nd.Vertices), len(nd.Normals))
+	for _, f := range nd.FaceGroup[0].Faces {
+		assert.Nil(t, f.Normal)
+	}
+	assert.Equal(t, vec3.Vec[float64]{0, 0, -1}, nd.Normals[nd.FaceGroup[0].Faces[2].Vertex[0]])
+}
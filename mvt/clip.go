@@ -0,0 +1,223 @@
+package mvt
+
+import (
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// Clip returns the part of g inside r, or nil when nothing is left. Lines
+// are split where they leave the rectangle and polygon rings are cut with
+// the Sutherland-Hodgman algorithm, so a clipped polygon may run along the
+// rectangle edges.
+func Clip(g *geojson.Geometry, r vec2.Rect[float64]) *geojson.Geometry {
+	if g == nil {
+		return nil
+	}
+	switch g.Type {
+	case geojson.Point:
+		if inside(g.Point, r) {
+			return g
+		}
+	case geojson.MultiPoint:
+		var ps []vec3.Vec[float64]
+		for _, p := range g.MultiPoint {
+			if inside(p, r) {
+				ps = append(ps, p)
+			}
+		}
+		if len(ps) > 0 {
+			return geojson.NewMultiPointGeometry(ps...)
+		}
+	case geojson.LineString:
+		return lines(clipLine(g.LineString, r, nil))
+	case geojson.MultiLineString:
+		var ls [][]vec3.Vec[float64]
+		for _, l := range g.MultiLineString {
+			ls = clipLine(l, r, ls)
+		}
+		return lines(ls)
+	case geojson.Polygon:
+		if p := clipPolygon(g.Polygon, r); p != nil {
+			return geojson.NewPolygonGeometry(p)
+		}
+	case geojson.MultiPolygon:
+		var ps [][][]vec3.Vec[float64]
+		for _, p := range g.MultiPolygon {
+			if p = clipPolygon(p, r); p != nil {
+				ps = append(ps, p)
+			}
+		}
+		switch len(ps) {
+		case 0:
+		case 1:
+			return geojson.NewPolygonGeometry(ps[0])
+		default:
+			return geojson.NewMultiPolygonGeometry(ps...)
+		}
+	case geojson.GeometryCollection:
+		var gs []*geojson.Geometry
+		for _, c := range g.Geometries {
+			if c = Clip(c, r); c != nil {
+				gs = append(gs, c)
+			}
+		}
+		if len(gs) > 0 {
+			return geojson.NewGeometryCollection(gs...)
+		}
+	}
+	return nil
+}
+
+func inside(p vec3.Vec[float64], r vec2.Rect[float64]) bool {
+	return p[0] >= r.Min[0] && p[0] <= r.Max[0] && p[1] >= r.Min[1] && p[1] <= r.Max[1]
+}
+
+func lines(ls [][]vec3.Vec[float64]) *geojson.Geometry {
+	switch len(ls) {
+	case 0:
+		return nil
+	case 1:
+		return geojson.NewLineStringGeometry(ls[0])
+	}
+	return geojson.NewMultiLineStringGeometry(ls...)
+}
+
+// clipLine appends the pieces of line inside r to out.
+func clipLine(line []vec3.Vec[float64], r vec2.Rect[float64], out [][]vec3.Vec[float64]) [][]vec3.Vec[float64] {
+	var cur []vec3.Vec[float64]
+	for i := 0; i+1 < len(line); i++ {
+		a, b, ok := clipSegment(line[i], line[i+1], r)
+		if !ok {
+			if len(cur) > 1 {
+				out = append(out, cur)
+			}
+			cur = nil
+			continue
+		}
+		if len(cur) == 0 || cur[len(cur)-1] != a {
+			if len(cur) > 1 {
+				out = append(out, cur)
+			}
+			cur = []vec3.Vec[float64]{a}
+		}
+		cur = append(cur, b)
+		if b != line[i+1] {
+			// the segment leaves the rectangle
+			out = append(out, cur)
+			cur = nil
+		}
+	}
+	if len(cur) > 1 {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// clipSegment clips the segment a b to r with the Liang-Barsky algorithm.
+func clipSegment(a, b vec3.Vec[float64], r vec2.Rect[float64]) (vec3.Vec[float64], vec3.Vec[float64], bool) {
+	t0, t1 := 0.0, 1.0
+	d := vec3.Vec[float64]{b[0] - a[0], b[1] - a[1], b[2] - a[2]}
+	edges := [4][2]float64{
+		{-d[0], a[0] - r.Min[0]},
+		{d[0], r.Max[0] - a[0]},
+		{-d[1], a[1] - r.Min[1]},
+		{d[1], r.Max[1] - a[1]},
+	}
+	for _, e := range edges {
+		p, q := e[0], e[1]
+		if p == 0 {
+			if q < 0 {
+				return a, b, false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			if t > t1 {
+				return a, b, false
+			}
+			t0 = max(t0, t)
+		} else {
+			if t < t0 {
+				return a, b, false
+			}
+			t1 = min(t1, t)
+		}
+	}
+	at := func(t float64) vec3.Vec[float64] {
+		return vec3.Vec[float64]{a[0] + t*d[0], a[1] + t*d[1], a[2] + t*d[2]}
+	}
+	na, nb := a, b
+	if t0 > 0 {
+		na = at(t0)
+	}
+	if t1 < 1 {
+		nb = at(t1)
+	}
+	return na, nb, true
+}
+
+// clipPolygon clips every ring of a polygon and returns nil when the
+// exterior ring vanishes.
+func clipPolygon(rings [][]vec3.Vec[float64], r vec2.Rect[float64]) [][]vec3.Vec[float64] {
+	var out [][]vec3.Vec[float64]
+	for i, ring := range rings {
+		c := clipRing(ring, r)
+		if len(c) < 4 {
+			if i == 0 {
+				return nil
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// clipRing clips a closed ring against the four edges of r in turn.
+func clipRing(ring []vec3.Vec[float64], r vec2.Rect[float64]) []vec3.Vec[float64] {
+	if len(ring) > 1 && ring[0] == ring[len(ring)-1] {
+		ring = ring[:len(ring)-1]
+	}
+	for edge := 0; edge < 4 && len(ring) > 0; edge++ {
+		axis := edge / 2
+		limit, keepBelow := r.Min[axis], false
+		if edge%2 == 1 {
+			limit, keepBelow = r.Max[axis], true
+		}
+		in := func(p vec3.Vec[float64]) bool {
+			if keepBelow {
+				return p[axis] <= limit
+			}
+			return p[axis] >= limit
+		}
+		var next []vec3.Vec[float64]
+		prev := ring[len(ring)-1]
+		for _, p := range ring {
+			switch {
+			case in(p) && !in(prev):
+				next = append(next, intersect(prev, p, axis, limit), p)
+			case in(p):
+				next = append(next, p)
+			case in(prev):
+				next = append(next, intersect(prev, p, axis, limit))
+			}
+			prev = p
+		}
+		ring = next
+	}
+	if len(ring) < 3 {
+		return nil
+	}
+	return append(ring, ring[0])
+}
+
+// intersect returns the point of segment a b where the coordinate axis
+// equals v.
+func intersect(a, b vec3.Vec[float64], axis int, v float64) vec3.Vec[float64] {
+	t := (v - a[axis]) / (b[axis] - a[axis])
+	p := vec3.Vec[float64]{a[0] + t*(b[0]-a[0]), a[1] + t*(b[1]-a[1]), a[2] + t*(b[2]-a[2])}
+	p[axis] = v
+	return p
+}
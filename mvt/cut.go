@@ -0,0 +1,201 @@
+package mvt
+
+import (
+	"math"
+
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/tiles"
+)
+
+const DEFAULT_BUFFER = 64
+
+// Options controls how features are cut into tiles.
+type Options struct {
+	Extent int // DEFAULT_EXTENT when zero
+	// Buffer is the margin in extent units kept around the tile so that
+	// lines and polygon outlines continue across tile edges.
+	Buffer int
+	// Tolerance is the simplification tolerance in extent units, zero
+	// keeps every vertex. Being relative to the tile, the same tolerance
+	// simplifies more at lower zoom levels.
+	Tolerance float64
+}
+
+var DefaultOptions = Options{Extent: DEFAULT_EXTENT, Buffer: DEFAULT_BUFFER, Tolerance: 1}
+
+// NewLayer projects WGS84 features to tile t of grid, clips them to the
+// tile with the buffer of opts and simplifies them. Features outside the
+// buffered tile are dropped and geometry collections are split into one
+// feature per member.
+func NewLayer(name string, features []*geojson.Feature, grid *tiles.Grid, t tiles.Tile, opts Options) *Layer {
+	extent := opts.Extent
+	if extent <= 0 {
+		extent = DEFAULT_EXTENT
+	}
+	l := &Layer{Name: name, Version: VERSION, Extent: extent}
+	tr := newTileTransform(grid, t, extent)
+	buf := float64(opts.Buffer)
+	clip := vec2.Rect[float64]{Min: vec2.Vec[float64]{-buf, -buf}, Max: vec2.Vec[float64]{float64(extent) + buf, float64(extent) + buf}}
+	for _, f := range features {
+		if f.Geometry == nil {
+			continue
+		}
+		g := tr.project(f.Geometry)
+		if g == nil {
+			continue
+		}
+		if b := g.Bound(); !b.Intersects(&clip) {
+			continue
+		}
+		g = Simplify(Clip(g, clip), opts.Tolerance)
+		if g == nil {
+			continue
+		}
+		id := featureIDOf(f.ID)
+		if g.Type == geojson.GeometryCollection {
+			for _, c := range flatten(g, nil) {
+				l.Features = append(l.Features, &Feature{ID: id, Geometry: c, Properties: f.Properties})
+			}
+			continue
+		}
+		l.Features = append(l.Features, &Feature{ID: id, Geometry: g, Properties: f.Properties})
+	}
+	return l
+}
+
+func flatten(g *geojson.Geometry, out []*geojson.Geometry) []*geojson.Geometry {
+	if g.Type != geojson.GeometryCollection {
+		return append(out, g)
+	}
+	for _, c := range g.Geometries {
+		out = flatten(c, out)
+	}
+	return out
+}
+
+// featureIDOf keeps non-negative integer ids, which are the only ones a
+// tile can hold.
+func featureIDOf(id interface{}) uint64 {
+	switch id := id.(type) {
+	case float64:
+		if id >= 0 && id == math.Trunc(id) && id < 1<<63 {
+			return uint64(id)
+		}
+	case int:
+		if id >= 0 {
+			return uint64(id)
+		}
+	case int64:
+		if id >= 0 {
+			return uint64(id)
+		}
+	case uint64:
+		return id
+	}
+	return 0
+}
+
+// tileTransform maps between WGS84 and the coordinates of a tile.
+type tileTransform struct {
+	grid   *tiles.Grid
+	bounds vec2.Rect[float64]
+	scaleX float64
+	scaleY float64
+}
+
+func newTileTransform(grid *tiles.Grid, t tiles.Tile, extent int) *tileTransform {
+	b := grid.TileBounds(t)
+	return &tileTransform{
+		grid:   grid,
+		bounds: b,
+		scaleX: float64(extent) / (b.Max[0] - b.Min[0]),
+		scaleY: float64(extent) / (b.Max[1] - b.Min[1]),
+	}
+}
+
+func (tr *tileTransform) project(g *geojson.Geometry) *geojson.Geometry {
+	ok := true
+	out := mapGeometry(g, func(p vec3.Vec[float64]) vec3.Vec[float64] {
+		x, y, err := tr.grid.LonLat(p[0], p[1])
+		if err != nil {
+			ok = false
+		}
+		return vec3.Vec[float64]{(x - tr.bounds.Min[0]) * tr.scaleX, (tr.bounds.Max[1] - y) * tr.scaleY, p[2]}
+	})
+	if !ok {
+		return nil
+	}
+	return out
+}
+
+func (tr *tileTransform) unproject(g *geojson.Geometry) *geojson.Geometry {
+	return mapGeometry(g, func(p vec3.Vec[float64]) vec3.Vec[float64] {
+		lon, lat, _ := tr.grid.ToLonLat(tr.bounds.Min[0]+p[0]/tr.scaleX, tr.bounds.Max[1]-p[1]/tr.scaleY)
+		return vec3.Vec[float64]{lon, lat, p[2]}
+	})
+}
+
+// mapGeometry returns a copy of g with every position passed through fn.
+func mapGeometry(g *geojson.Geometry, fn func(vec3.Vec[float64]) vec3.Vec[float64]) *geojson.Geometry {
+	line := func(ps []vec3.Vec[float64]) []vec3.Vec[float64] {
+		out := make([]vec3.Vec[float64], len(ps))
+		for i, p := range ps {
+			out[i] = fn(p)
+		}
+		return out
+	}
+	rings := func(rs [][]vec3.Vec[float64]) [][]vec3.Vec[float64] {
+		out := make([][]vec3.Vec[float64], len(rs))
+		for i, r := range rs {
+			out[i] = line(r)
+		}
+		return out
+	}
+	out := &geojson.Geometry{Type: g.Type, HasZ: g.HasZ}
+	switch g.Type {
+	case geojson.Point:
+		out.Point = fn(g.Point)
+	case geojson.MultiPoint:
+		out.MultiPoint = line(g.MultiPoint)
+	case geojson.LineString:
+		out.LineString = line(g.LineString)
+	case geojson.MultiLineString:
+		out.MultiLineString = rings(g.MultiLineString)
+	case geojson.Polygon:
+		out.Polygon = rings(g.Polygon)
+	case geojson.MultiPolygon:
+		out.MultiPolygon = make([][][]vec3.Vec[float64], len(g.MultiPolygon))
+		for i, p := range g.MultiPolygon {
+			out.MultiPolygon[i] = rings(p)
+		}
+	case geojson.GeometryCollection:
+		for _, c := range g.Geometries {
+			out.Geometries = append(out.Geometries, mapGeometry(c, fn))
+		}
+	}
+	return out
+}
+
+// GeoJSON converts the features of a layer decoded from tile t of grid
+// back to WGS84, with polygons wound as GeoJSON expects.
+func (l *Layer) GeoJSON(grid *tiles.Grid, t tiles.Tile) *geojson.FeatureCollection {
+	tr := newTileTransform(grid, t, l.extent())
+	fc := geojson.NewFeatureCollection()
+	for _, f := range l.Features {
+		gf := geojson.NewFeature(nil)
+		if f.ID != 0 {
+			gf.ID = f.ID
+		}
+		for k, v := range f.Properties {
+			gf.Properties[k] = v
+		}
+		if f.Geometry != nil {
+			gf.Geometry = tr.unproject(f.Geometry)
+			gf.Geometry.Rewind()
+		}
+		fc.Append(gf)
+	}
+	return fc
+}
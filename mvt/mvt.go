@@ -0,0 +1,617 @@
+// Package mvt encodes and decodes Mapbox Vector Tiles 2.1 and cuts
+// GeoJSON features into tiles.
+//
+// Feature geometries of a Layer are geojson geometries in tile coordinates:
+// x grows to the east and y to the south from the top left corner of the
+// tile, and the tile spans 0 to Extent in both directions. Coordinates are
+// rounded to integers when a tile is marshalled.
+package mvt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+const (
+	VERSION        = 2
+	DEFAULT_EXTENT = 4096
+)
+
+// GeomType is the geometry type of a tile feature.
+type GeomType int
+
+const (
+	UNKNOWN GeomType = iota
+	POINT
+	LINESTRING
+	POLYGON
+)
+
+// Geometry commands.
+const (
+	cmdMoveTo    = 1
+	cmdLineTo    = 2
+	cmdClosePath = 7
+)
+
+// Field numbers of vector_tile.proto.
+const (
+	tileLayers = 3
+
+	layerName     = 1
+	layerFeatures = 2
+	layerKeys     = 3
+	layerValues   = 4
+	layerExtent   = 5
+	layerVersion  = 15
+
+	featureID       = 1
+	featureTags     = 2
+	featureType     = 3
+	featureGeometry = 4
+
+	valueString = 1
+	valueFloat  = 2
+	valueDouble = 3
+	valueInt    = 4
+	valueUint   = 5
+	valueSint   = 6
+	valueBool   = 7
+)
+
+// Tile is a vector tile made of named layers.
+type Tile struct {
+	Layers []*Layer
+}
+
+// Layer returns the layer with the given name or nil.
+func (t *Tile) Layer(name string) *Layer {
+	for _, l := range t.Layers {
+		if l.Name == name {
+			return l
+		}
+	}
+	return nil
+}
+
+type Layer struct {
+	Name     string
+	Version  int // VERSION when zero
+	Extent   int // DEFAULT_EXTENT when zero
+	Features []*Feature
+}
+
+func (l *Layer) extent() int {
+	if l.Extent <= 0 {
+		return DEFAULT_EXTENT
+	}
+	return l.Extent
+}
+
+// Feature is a tile feature. Point, LineString and Polygon geometries and
+// their multi variants are supported.
+type Feature struct {
+	ID         uint64 // zero when absent
+	Geometry   *geojson.Geometry
+	Properties map[string]interface{}
+}
+
+// Type returns the tile geometry type of the feature.
+func (f *Feature) Type() GeomType {
+	if f.Geometry == nil {
+		return UNKNOWN
+	}
+	switch f.Geometry.Type {
+	case geojson.Point, geojson.MultiPoint:
+		return POINT
+	case geojson.LineString, geojson.MultiLineString:
+		return LINESTRING
+	case geojson.Polygon, geojson.MultiPolygon:
+		return POLYGON
+	}
+	return UNKNOWN
+}
+
+// Marshal encodes the tile. Layers and features whose geometry collapses
+// when rounded to integer coordinates are left out.
+func Marshal(t *Tile) ([]byte, error) {
+	var w pbfWriter
+	for _, l := range t.Layers {
+		b, err := marshalLayer(l)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			w.bytes(tileLayers, b)
+		}
+	}
+	return w.buf, nil
+}
+
+func marshalLayer(l *Layer) ([]byte, error) {
+	if l.Name == "" {
+		return nil, errors.New("mvt: layer without name")
+	}
+	var (
+		keys    []string
+		keyIdx  = map[string]int{}
+		values  []interface{}
+		valIdx  = map[interface{}]int{}
+		feats   pbfWriter
+		written int
+	)
+	for _, f := range l.Features {
+		geom, err := encodeGeometry(f.Geometry)
+		if err != nil {
+			return nil, fmt.Errorf("mvt: layer %s: %w", l.Name, err)
+		}
+		if len(geom) == 0 {
+			continue
+		}
+		var fw pbfWriter
+		if f.ID != 0 {
+			fw.varint(featureID, f.ID)
+		}
+		names := make([]string, 0, len(f.Properties))
+		for k := range f.Properties {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		var tags []uint32
+		for _, k := range names {
+			v := normalizeValue(f.Properties[k])
+			if v == nil {
+				continue
+			}
+			ki, ok := keyIdx[k]
+			if !ok {
+				ki = len(keys)
+				keyIdx[k] = ki
+				keys = append(keys, k)
+			}
+			vi, ok := valIdx[v]
+			if !ok {
+				vi = len(values)
+				valIdx[v] = vi
+				values = append(values, v)
+			}
+			tags = append(tags, uint32(ki), uint32(vi))
+		}
+		if len(tags) > 0 {
+			fw.packed(featureTags, tags)
+		}
+		fw.varint(featureType, uint64(f.Type()))
+		fw.packed(featureGeometry, geom)
+		feats.bytes(layerFeatures, fw.buf)
+		written++
+	}
+	if written == 0 {
+		return nil, nil
+	}
+
+	var w pbfWriter
+	version := l.Version
+	if version == 0 {
+		version = VERSION
+	}
+	w.varint(layerVersion, uint64(version))
+	w.string(layerName, l.Name)
+	w.buf = append(w.buf, feats.buf...)
+	for _, k := range keys {
+		w.string(layerKeys, k)
+	}
+	for _, v := range values {
+		w.bytes(layerValues, marshalValue(v))
+	}
+	w.varint(layerExtent, uint64(l.extent()))
+	return w.buf, nil
+}
+
+// normalizeValue maps a property value to one of the comparable types
+// written to tiles: string, float32, float64, int64, uint64 or bool.
+// Integral float64 values become integers and nested values are encoded
+// as JSON.
+func normalizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string, float32, int64, uint64, bool:
+		return v
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+		return v
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func marshalValue(v interface{}) []byte {
+	var w pbfWriter
+	switch v := v.(type) {
+	case string:
+		w.string(valueString, v)
+	case float32:
+		w.float(valueFloat, v)
+	case float64:
+		w.double(valueDouble, v)
+	case int64:
+		if v < 0 {
+			w.sint(valueSint, v)
+		} else {
+			w.varint(valueInt, uint64(v))
+		}
+	case uint64:
+		w.varint(valueUint, v)
+	case bool:
+		b := uint64(0)
+		if v {
+			b = 1
+		}
+		w.varint(valueBool, b)
+	}
+	return w.buf
+}
+
+// Unmarshal decodes a tile. Integer values are decoded as int64, except
+// for uint values which become uint64, and float values become float64.
+func Unmarshal(data []byte) (*Tile, error) {
+	t := &Tile{}
+	r := pbfReader{buf: data}
+	for r.next() {
+		if r.field != tileLayers || r.wire != wireBytes {
+			continue
+		}
+		l, err := unmarshalLayer(r.data)
+		if err != nil {
+			return nil, err
+		}
+		t.Layers = append(t.Layers, l)
+	}
+	return t, r.err
+}
+
+func unmarshalLayer(data []byte) (*Layer, error) {
+	l := &Layer{Version: 1, Extent: DEFAULT_EXTENT}
+	var (
+		keys   []string
+		values []interface{}
+		raw    [][]byte
+	)
+	r := pbfReader{buf: data}
+	for r.next() {
+		switch {
+		case r.field == layerName && r.wire == wireBytes:
+			l.Name = string(r.data)
+		case r.field == layerFeatures && r.wire == wireBytes:
+			raw = append(raw, r.data)
+		case r.field == layerKeys && r.wire == wireBytes:
+			keys = append(keys, string(r.data))
+		case r.field == layerValues && r.wire == wireBytes:
+			v, err := unmarshalValue(r.data)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		case r.field == layerExtent && r.wire == wireVarint:
+			l.Extent = int(r.num)
+		case r.field == layerVersion && r.wire == wireVarint:
+			l.Version = int(r.num)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	for _, b := range raw {
+		f, err := unmarshalFeature(b, keys, values)
+		if err != nil {
+			return nil, fmt.Errorf("mvt: layer %s: %w", l.Name, err)
+		}
+		l.Features = append(l.Features, f)
+	}
+	return l, nil
+}
+
+func unmarshalFeature(data []byte, keys []string, values []interface{}) (*Feature, error) {
+	f := &Feature{Properties: map[string]interface{}{}}
+	var (
+		tags, geom []uint32
+		typ        GeomType
+		err        error
+	)
+	r := pbfReader{buf: data}
+	for r.next() {
+		switch r.field {
+		case featureID:
+			f.ID = r.num
+		case featureTags:
+			tags, err = r.uint32s(tags)
+		case featureType:
+			typ = GeomType(r.num)
+		case featureGeometry:
+			geom, err = r.uint32s(geom)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(tags)%2 != 0 {
+		return nil, errors.New("odd number of tags")
+	}
+	for i := 0; i < len(tags); i += 2 {
+		k, v := int(tags[i]), int(tags[i+1])
+		if k >= len(keys) || v >= len(values) {
+			return nil, errors.New("tag index out of range")
+		}
+		f.Properties[keys[k]] = values[v]
+	}
+	f.Geometry, err = decodeGeometry(typ, geom)
+	return f, err
+}
+
+func unmarshalValue(data []byte) (interface{}, error) {
+	var v interface{}
+	r := pbfReader{buf: data}
+	for r.next() {
+		switch r.field {
+		case valueString:
+			v = string(r.data)
+		case valueFloat:
+			v = float64(math.Float32frombits(uint32(r.num)))
+		case valueDouble:
+			v = math.Float64frombits(r.num)
+		case valueInt:
+			v = int64(r.num)
+		case valueUint:
+			v = r.num
+		case valueSint:
+			v = unzigzag(r.num)
+		case valueBool:
+			v = r.num != 0
+		}
+	}
+	return v, r.err
+}
+
+// encodeGeometry rounds the geometry to integer coordinates and writes it
+// as a command sequence. Polygon rings are rewound so that exterior rings
+// have a positive area in tile coordinates.
+func encodeGeometry(g *geojson.Geometry) ([]uint32, error) {
+	if g == nil {
+		return nil, nil
+	}
+	var e geomEncoder
+	switch g.Type {
+	case geojson.Point:
+		e.points([]vec3.Vec[float64]{g.Point})
+	case geojson.MultiPoint:
+		e.points(g.MultiPoint)
+	case geojson.LineString:
+		e.line(g.LineString)
+	case geojson.MultiLineString:
+		for _, l := range g.MultiLineString {
+			e.line(l)
+		}
+	case geojson.Polygon:
+		e.polygon(g.Polygon)
+	case geojson.MultiPolygon:
+		for _, p := range g.MultiPolygon {
+			e.polygon(p)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %s", g.Type)
+	}
+	return e.buf, nil
+}
+
+type geomEncoder struct {
+	buf  []uint32
+	x, y int64 // cursor
+}
+
+func command(id, count int) uint32 {
+	return uint32(id&7) | uint32(count)<<3
+}
+
+func (e *geomEncoder) moveBy(p [2]int64) {
+	e.buf = append(e.buf, uint32(zigzag(p[0]-e.x)), uint32(zigzag(p[1]-e.y)))
+	e.x, e.y = p[0], p[1]
+}
+
+func (e *geomEncoder) points(ps []vec3.Vec[float64]) {
+	if len(ps) == 0 {
+		return
+	}
+	e.buf = append(e.buf, command(cmdMoveTo, len(ps)))
+	for _, p := range ps {
+		e.moveBy(round(p))
+	}
+}
+
+func (e *geomEncoder) line(ps []vec3.Vec[float64]) {
+	q := quantize(ps)
+	if len(q) < 2 {
+		return
+	}
+	e.buf = append(e.buf, command(cmdMoveTo, 1))
+	e.moveBy(q[0])
+	e.buf = append(e.buf, command(cmdLineTo, len(q)-1))
+	for _, p := range q[1:] {
+		e.moveBy(p)
+	}
+}
+
+func (e *geomEncoder) polygon(rings [][]vec3.Vec[float64]) {
+	for i, r := range rings {
+		q := quantize(r)
+		if len(q) > 1 && q[0] == q[len(q)-1] {
+			q = q[:len(q)-1]
+		}
+		area := quantizedArea(q)
+		if len(q) < 3 || area == 0 {
+			if i == 0 {
+				// without its exterior ring the holes mean nothing
+				return
+			}
+			continue
+		}
+		if (i == 0) != (area > 0) {
+			for a, b := 1, len(q)-1; a < b; a, b = a+1, b-1 {
+				q[a], q[b] = q[b], q[a]
+			}
+		}
+		e.buf = append(e.buf, command(cmdMoveTo, 1))
+		e.moveBy(q[0])
+		e.buf = append(e.buf, command(cmdLineTo, len(q)-1))
+		for _, p := range q[1:] {
+			e.moveBy(p)
+		}
+		e.buf = append(e.buf, command(cmdClosePath, 1))
+	}
+}
+
+func round(p vec3.Vec[float64]) [2]int64 {
+	return [2]int64{int64(math.Round(p[0])), int64(math.Round(p[1]))}
+}
+
+// quantize rounds positions and drops repeated ones.
+func quantize(ps []vec3.Vec[float64]) [][2]int64 {
+	q := make([][2]int64, 0, len(ps))
+	for _, p := range ps {
+		r := round(p)
+		if len(q) == 0 || q[len(q)-1] != r {
+			q = append(q, r)
+		}
+	}
+	return q
+}
+
+// quantizedArea returns twice the signed area of an open ring.
+func quantizedArea(q [][2]int64) int64 {
+	var a int64
+	for i := range q {
+		j := (i + 1) % len(q)
+		a += q[i][0]*q[j][1] - q[j][0]*q[i][1]
+	}
+	return a
+}
+
+func decodeGeometry(typ GeomType, cmds []uint32) (*geojson.Geometry, error) {
+	var (
+		parts  [][]vec3.Vec[float64]
+		cur    []vec3.Vec[float64]
+		x, y   int64
+		closed []bool
+	)
+	for i := 0; i < len(cmds); {
+		id, count := int(cmds[i]&7), int(cmds[i]>>3)
+		i++
+		switch id {
+		case cmdMoveTo, cmdLineTo:
+			if i+2*count > len(cmds) {
+				return nil, errors.New("truncated geometry")
+			}
+			for n := 0; n < count; n++ {
+				x += unzigzag(uint64(cmds[i]))
+				y += unzigzag(uint64(cmds[i+1]))
+				i += 2
+				p := vec3.Vec[float64]{float64(x), float64(y), 0}
+				if id == cmdMoveTo {
+					if cur != nil {
+						parts, closed = append(parts, cur), append(closed, false)
+					}
+					cur = []vec3.Vec[float64]{p}
+				} else {
+					if cur == nil {
+						return nil, errors.New("LineTo before MoveTo")
+					}
+					cur = append(cur, p)
+				}
+			}
+		case cmdClosePath:
+			if cur == nil {
+				return nil, errors.New("ClosePath before MoveTo")
+			}
+			cur = append(cur, cur[0])
+			parts, closed = append(parts, cur), append(closed, true)
+			cur = nil
+		default:
+			return nil, fmt.Errorf("unknown geometry command %d", id)
+		}
+	}
+	if cur != nil {
+		parts, closed = append(parts, cur), append(closed, false)
+	}
+
+	switch typ {
+	case POINT:
+		var ps []vec3.Vec[float64]
+		for _, p := range parts {
+			ps = append(ps, p...)
+		}
+		switch len(ps) {
+		case 0:
+			return nil, nil
+		case 1:
+			return geojson.NewPointGeometry(ps[0]), nil
+		}
+		return geojson.NewMultiPointGeometry(ps...), nil
+	case LINESTRING:
+		switch len(parts) {
+		case 0:
+			return nil, nil
+		case 1:
+			return geojson.NewLineStringGeometry(parts[0]), nil
+		}
+		return geojson.NewMultiLineStringGeometry(parts...), nil
+	case POLYGON:
+		var polys [][][]vec3.Vec[float64]
+		for i, r := range parts {
+			if !closed[i] {
+				return nil, errors.New("polygon ring without ClosePath")
+			}
+			area := geojson.RingArea(r)
+			switch {
+			case area > 0:
+				polys = append(polys, [][]vec3.Vec[float64]{r})
+			case area < 0 && len(polys) > 0:
+				polys[len(polys)-1] = append(polys[len(polys)-1], r)
+			}
+		}
+		switch len(polys) {
+		case 0:
+			return nil, nil
+		case 1:
+			return geojson.NewPolygonGeometry(polys[0]), nil
+		}
+		return geojson.NewMultiPolygonGeometry(polys...), nil
+	}
+	return nil, nil
+}
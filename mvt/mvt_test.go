@@ -0,0 +1,226 @@
+package mvt
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/tiles"
+	"pinkey.ltd/xr/wfs"
+)
+
+func ring(ps ...float64) []vec3.Vec[float64] {
+	var r []vec3.Vec[float64]
+	for i := 0; i+1 < len(ps); i += 2 {
+		r = append(r, vec3.Vec[float64]{ps[i], ps[i+1], 0})
+	}
+	return r
+}
+
+func TestEncodeGeometry(t *testing.T) {
+	// examples of the specification
+	tests := []struct {
+		geom *geojson.Geometry
+		cmds []uint32
+	}{
+		{geojson.NewPointGeometry(vec3.Vec[float64]{25, 17, 0}), []uint32{9, 50, 34}},
+		{geojson.NewMultiPointGeometry(ring(5, 7, 3, 2)...), []uint32{17, 10, 14, 3, 9}},
+		{geojson.NewLineStringGeometry(ring(2, 2, 2, 10, 10, 10)), []uint32{9, 4, 4, 18, 0, 16, 16, 0}},
+		{geojson.NewMultiLineStringGeometry(ring(2, 2, 2, 10, 10, 10), ring(1, 1, 3, 5)), []uint32{9, 4, 4, 18, 0, 16, 16, 0, 9, 17, 17, 10, 4, 8}},
+		{geojson.NewPolygonGeometry([][]vec3.Vec[float64]{ring(3, 6, 8, 12, 20, 34, 3, 6)}), []uint32{9, 6, 12, 18, 10, 12, 24, 44, 15}},
+		// the exterior ring is rewound, coordinates are rounded and
+		// repeated positions dropped
+		{geojson.NewPolygonGeometry([][]vec3.Vec[float64]{ring(3, 6, 20.2, 33.9, 20, 34, 8, 12, 3, 6)}), []uint32{9, 6, 12, 18, 10, 12, 24, 44, 15}},
+		{geojson.NewLineStringGeometry(ring(1, 1, 1.2, 1.1)), nil},
+	}
+	for _, tt := range tests {
+		cmds, err := encodeGeometry(tt.geom)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.cmds, cmds, tt.geom.Type)
+	}
+
+	_, err := encodeGeometry(geojson.NewGeometryCollection())
+	assert.NotNil(t, err)
+}
+
+func TestMarshal(t *testing.T) {
+	hole := ring(4, 4, 6, 4, 6, 6, 4, 6, 4, 4)
+	layer := &Layer{Name: "test", Features: []*Feature{
+		{ID: 1, Geometry: geojson.NewPointGeometry(vec3.Vec[float64]{10, 20, 0}), Properties: map[string]interface{}{
+			"name": "a", "count": 3.0, "ratio": 0.5, "delta": -2, "ok": true, "tags": []string{"x"}, "missing": nil,
+		}},
+		{ID: 2, Geometry: geojson.NewLineStringGeometry(ring(0, 0, 100, 0, 100, 100)), Properties: map[string]interface{}{"name": "a"}},
+		{Geometry: geojson.NewMultiPolygonGeometry(
+			[][]vec3.Vec[float64]{ring(0, 0, 10, 0, 10, 10, 0, 10, 0, 0), hole},
+			[][]vec3.Vec[float64]{ring(20, 20, 30, 20, 30, 30, 20, 20)},
+		)},
+		{Geometry: geojson.NewLineStringGeometry(ring(5, 5, 5.1, 5.1))},
+	}}
+	data, err := Marshal(&Tile{Layers: []*Layer{layer, {Name: "empty"}}})
+	assert.Nil(t, err)
+
+	tile, err := Unmarshal(data)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tile.Layers))
+	assert.Nil(t, tile.Layer("empty"))
+	l := tile.Layer("test")
+	assert.Equal(t, VERSION, l.Version)
+	assert.Equal(t, DEFAULT_EXTENT, l.Extent)
+	assert.Equal(t, 3, len(l.Features))
+
+	f := l.Features[0]
+	assert.Equal(t, uint64(1), f.ID)
+	assert.Equal(t, POINT, f.Type())
+	assert.Equal(t, vec3.Vec[float64]{10, 20, 0}, f.Geometry.Point)
+	assert.Equal(t, map[string]interface{}{
+		"name": "a", "count": int64(3), "ratio": 0.5, "delta": int64(-2), "ok": true, "tags": `["x"]`,
+	}, f.Properties)
+	assert.Equal(t, "a", l.Features[1].Properties["name"])
+	assert.Equal(t, LINESTRING, l.Features[1].Type())
+
+	p := l.Features[2]
+	assert.Equal(t, uint64(0), p.ID)
+	assert.Equal(t, geojson.MultiPolygon, p.Geometry.Type)
+	assert.Equal(t, 2, len(p.Geometry.MultiPolygon))
+	assert.Equal(t, 2, len(p.Geometry.MultiPolygon[0]))
+	assert.Greater(t, geojson.RingArea(p.Geometry.MultiPolygon[0][0]), 0.0)
+	assert.Less(t, geojson.RingArea(p.Geometry.MultiPolygon[0][1]), 0.0)
+	assert.Equal(t, 4, len(p.Geometry.MultiPolygon[1][0]))
+
+	// the same values are shared between features
+	data2, err := Marshal(&Tile{Layers: []*Layer{{Name: "test", Features: layer.Features[:1]}}})
+	assert.Nil(t, err)
+	assert.Less(t, len(data2), len(data))
+
+	_, err = Unmarshal(data[:len(data)-3])
+	assert.NotNil(t, err)
+	_, err = Marshal(&Tile{Layers: []*Layer{{Features: layer.Features}}})
+	assert.NotNil(t, err)
+}
+
+func TestClip(t *testing.T) {
+	r := vec2.Rect[float64]{Max: vec2.Vec[float64]{10, 10}}
+
+	assert.Nil(t, Clip(geojson.NewPointGeometry(vec3.Vec[float64]{11, 5, 0}), r))
+	mp := Clip(geojson.NewMultiPointGeometry(ring(1, 1, 20, 20, 10, 10)...), r)
+	assert.Equal(t, ring(1, 1, 10, 10), mp.MultiPoint)
+
+	// a line leaving and entering again is split
+	l := Clip(geojson.NewLineStringGeometry(ring(-5, 5, 5, 5, 5, 15, 8, 15, 8, 5, 9, 5)), r)
+	assert.Equal(t, geojson.MultiLineString, l.Type)
+	assert.Equal(t, [][]vec3.Vec[float64]{ring(0, 5, 5, 5, 5, 10), ring(8, 10, 8, 5, 9, 5)}, l.MultiLineString)
+	assert.Nil(t, Clip(geojson.NewLineStringGeometry(ring(-5, -5, -1, 20)), r))
+
+	p := Clip(geojson.NewPolygonGeometry([][]vec3.Vec[float64]{
+		ring(-5, -5, 5, -5, 5, 5, -5, 5, -5, -5),
+		ring(20, 20, 21, 20, 21, 21, 20, 20),
+	}), r)
+	assert.Equal(t, geojson.Polygon, p.Type)
+	assert.Equal(t, 1, len(p.Polygon))
+	assert.InDelta(t, 25, geojson.RingArea(p.Polygon[0]), 1e-9)
+	for _, q := range p.Polygon[0] {
+		assert.True(t, inside(q, r))
+	}
+	assert.Nil(t, Clip(geojson.NewPolygonGeometry([][]vec3.Vec[float64]{ring(20, 20, 21, 20, 21, 21, 20, 20)}), r))
+}
+
+func TestSimplify(t *testing.T) {
+	line := geojson.NewLineStringGeometry(ring(0, 0, 1, 0.1, 2, -0.1, 3, 5, 4, 6, 5, 7))
+	assert.Equal(t, ring(0, 0, 2, -0.1, 3, 5, 5, 7), Simplify(line, 0.5).LineString)
+	assert.Equal(t, line, Simplify(line, 0))
+
+	// small rings keep their shape
+	tri := geojson.NewPolygonGeometry([][]vec3.Vec[float64]{ring(0, 0, 1, 0, 1, 1, 0, 0)})
+	assert.Equal(t, tri.Polygon, Simplify(tri, 10).Polygon)
+}
+
+func TestNewLayer(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	center := geojson.NewFeature(geojson.NewPointGeometry(vec3.Vec[float64]{0, 0, 0}))
+	center.ID = 7.0
+	center.Properties["name"] = "null island"
+	fc.Append(center)
+	far := geojson.NewFeature(geojson.NewPointGeometry(vec3.Vec[float64]{-100, -40, 0}))
+	fc.Append(far)
+	both := geojson.NewFeature(geojson.NewGeometryCollection(
+		geojson.NewPointGeometry(vec3.Vec[float64]{45, 45, 0}),
+		geojson.NewLineStringGeometry(ring(-10, 10, 90, 10)),
+	))
+	both.ID = "text ids are dropped"
+	fc.Append(both)
+
+	// the north east quarter of the world at zoom 1
+	tile := tiles.Tile{Z: 1, X: 1, Y: 0}
+	l := NewLayer("places", fc.Features, tiles.WebMercator, tile, DefaultOptions)
+	assert.Equal(t, 3, len(l.Features))
+	assert.Equal(t, uint64(7), l.Features[0].ID)
+	assert.InDelta(t, 0, l.Features[0].Geometry.Point[0], 1e-6)
+	assert.InDelta(t, 4096, l.Features[0].Geometry.Point[1], 1e-6)
+	assert.Equal(t, uint64(0), l.Features[1].ID)
+	assert.Equal(t, geojson.Point, l.Features[1].Geometry.Type)
+	line := l.Features[2].Geometry.LineString
+	assert.InDelta(t, -DEFAULT_BUFFER, line[0][0], 1e-6)
+
+	data, err := Marshal(&Tile{Layers: []*Layer{l}})
+	assert.Nil(t, err)
+	decoded, err := Unmarshal(data)
+	assert.Nil(t, err)
+	back := decoded.Layer("places").GeoJSON(tiles.WebMercator, tile)
+	assert.Equal(t, 3, len(back.Features))
+	assert.Equal(t, uint64(7), back.Features[0].ID)
+	assert.Equal(t, "null island", back.Features[0].Properties["name"])
+	assert.InDelta(t, 45, back.Features[1].Geometry.Point[0], 0.05)
+	assert.InDelta(t, 45, back.Features[1].Geometry.Point[1], 0.05)
+}
+
+func TestSource(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	fc.Append(geojson.NewFeature(geojson.NewPolygonGeometry([][]vec3.Vec[float64]{ring(100, 20, 120, 20, 120, 40, 100, 40, 100, 20)})))
+	store := wfs.NewMemoryStore()
+	cities := geojson.NewFeatureCollection()
+	beijing := geojson.NewFeature(geojson.NewPointGeometry(vec3.Vec[float64]{116.4, 39.9, 0}))
+	beijing.Properties["name"] = "Beijing"
+	cities.Append(beijing)
+	cities.Append(geojson.NewFeature(geojson.NewPointGeometry(vec3.Vec[float64]{-74, 40.7, 0})))
+	store.Add(&wfs.FeatureType{Name: "cities"}, cities)
+
+	src := NewSource("china", 0, 6,
+		&SourceLayer{Name: "land", Features: NewCollection(fc)},
+		&SourceLayer{Name: "cities", Features: &StoreFeatures{Store: store, TypeName: "cities"}},
+	)
+	srv := httptest.NewServer(tiles.NewHandler(src))
+	defer srv.Close()
+
+	get := func(path string) (*http.Response, []byte) {
+		resp, err := http.Get(srv.URL + path)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return resp, body
+	}
+
+	tile := tiles.LonLatToTile(116.4, 39.9, 4)
+	resp, body := get("/" + tile.String() + ".pbf")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/vnd.mapbox-vector-tile", resp.Header.Get("Content-Type"))
+	vt, err := Unmarshal(body)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(vt.Layers))
+	assert.Equal(t, POLYGON, vt.Layer("land").Features[0].Type())
+	assert.Equal(t, 1, len(vt.Layer("cities").Features))
+	assert.Equal(t, "Beijing", vt.Layer("cities").Features[0].Properties["name"])
+
+	// nothing in the south atlantic
+	resp, body = get("/4/7/10.mvt")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 0, len(body))
+
+	resp, _ = get("/7/0/0.pbf")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
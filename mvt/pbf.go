@@ -0,0 +1,150 @@
+package mvt
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Wire types of the protocol buffer encoding.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("mvt: truncated message")
+
+// pbfWriter appends protocol buffer fields to a byte slice.
+type pbfWriter struct {
+	buf []byte
+}
+
+func (w *pbfWriter) key(field, wire int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field)<<3|uint64(wire))
+}
+
+func (w *pbfWriter) varint(field int, v uint64) {
+	w.key(field, wireVarint)
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *pbfWriter) sint(field int, v int64) {
+	w.varint(field, zigzag(v))
+}
+
+func (w *pbfWriter) double(field int, v float64) {
+	w.key(field, wireFixed64)
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(v))
+}
+
+func (w *pbfWriter) float(field int, v float32) {
+	w.key(field, wireFixed32)
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, math.Float32bits(v))
+}
+
+func (w *pbfWriter) bytes(field int, b []byte) {
+	w.key(field, wireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *pbfWriter) string(field int, s string) {
+	w.bytes(field, []byte(s))
+}
+
+// packed writes a packed repeated uint32 field.
+func (w *pbfWriter) packed(field int, vs []uint32) {
+	var b []byte
+	for _, v := range vs {
+		b = binary.AppendUvarint(b, uint64(v))
+	}
+	w.bytes(field, b)
+}
+
+// pbfReader iterates over the fields of a message.
+type pbfReader struct {
+	buf   []byte
+	field int
+	wire  int
+	// value of the current field: the number for varint and fixed wire
+	// types, the payload for length delimited fields
+	num  uint64
+	data []byte
+	err  error
+}
+
+// next advances to the next field and reports whether there is one.
+func (r *pbfReader) next() bool {
+	if r.err != nil || len(r.buf) == 0 {
+		return false
+	}
+	k, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = errTruncated
+		return false
+	}
+	r.buf = r.buf[n:]
+	r.field, r.wire = int(k>>3), int(k&7)
+	switch r.wire {
+	case wireVarint:
+		r.num, n = binary.Uvarint(r.buf)
+		if n <= 0 {
+			r.err = errTruncated
+			return false
+		}
+		r.buf = r.buf[n:]
+	case wireFixed64:
+		if len(r.buf) < 8 {
+			r.err = errTruncated
+			return false
+		}
+		r.num, r.buf = binary.LittleEndian.Uint64(r.buf), r.buf[8:]
+	case wireFixed32:
+		if len(r.buf) < 4 {
+			r.err = errTruncated
+			return false
+		}
+		r.num, r.buf = uint64(binary.LittleEndian.Uint32(r.buf)), r.buf[4:]
+	case wireBytes:
+		l, n := binary.Uvarint(r.buf)
+		if n <= 0 || uint64(len(r.buf)-n) < l {
+			r.err = errTruncated
+			return false
+		}
+		r.data, r.buf = r.buf[n:n+int(l)], r.buf[n+int(l):]
+	default:
+		r.err = errors.New("mvt: unsupported wire type")
+		return false
+	}
+	return true
+}
+
+// uint32s decodes the current field as a packed or single uint32.
+func (r *pbfReader) uint32s(vs []uint32) ([]uint32, error) {
+	if r.wire == wireVarint {
+		return append(vs, uint32(r.num)), nil
+	}
+	if r.wire != wireBytes {
+		return vs, errors.New("mvt: expected packed integers")
+	}
+	b := r.data
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return vs, errTruncated
+		}
+		vs = append(vs, uint32(v))
+		b = b[n:]
+	}
+	return vs, nil
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
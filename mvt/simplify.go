@@ -0,0 +1,96 @@
+package mvt
+
+import (
+	"math"
+
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+// Simplify removes vertices closer than tolerance to the line through their
+// neighbours with the Douglas-Peucker algorithm. Rings keep at least four
+// positions and lines their end points.
+func Simplify(g *geojson.Geometry, tolerance float64) *geojson.Geometry {
+	if g == nil || tolerance <= 0 {
+		return g
+	}
+	switch g.Type {
+	case geojson.LineString:
+		return geojson.NewLineStringGeometry(simplifyLine(g.LineString, tolerance))
+	case geojson.MultiLineString:
+		ls := make([][]vec3.Vec[float64], len(g.MultiLineString))
+		for i, l := range g.MultiLineString {
+			ls[i] = simplifyLine(l, tolerance)
+		}
+		return geojson.NewMultiLineStringGeometry(ls...)
+	case geojson.Polygon:
+		return geojson.NewPolygonGeometry(simplifyRings(g.Polygon, tolerance))
+	case geojson.MultiPolygon:
+		ps := make([][][]vec3.Vec[float64], len(g.MultiPolygon))
+		for i, p := range g.MultiPolygon {
+			ps[i] = simplifyRings(p, tolerance)
+		}
+		return geojson.NewMultiPolygonGeometry(ps...)
+	case geojson.GeometryCollection:
+		gs := make([]*geojson.Geometry, len(g.Geometries))
+		for i, c := range g.Geometries {
+			gs[i] = Simplify(c, tolerance)
+		}
+		return geojson.NewGeometryCollection(gs...)
+	}
+	return g
+}
+
+func simplifyRings(rings [][]vec3.Vec[float64], tolerance float64) [][]vec3.Vec[float64] {
+	out := make([][]vec3.Vec[float64], len(rings))
+	for i, r := range rings {
+		if s := simplifyLine(r, tolerance); len(s) >= 4 {
+			out[i] = s
+		} else {
+			out[i] = r
+		}
+	}
+	return out
+}
+
+func simplifyLine(ps []vec3.Vec[float64], tolerance float64) []vec3.Vec[float64] {
+	if len(ps) < 3 {
+		return ps
+	}
+	keep := make([]bool, len(ps))
+	keep[0], keep[len(ps)-1] = true, true
+	sq := tolerance * tolerance
+	stack := [][2]int{{0, len(ps) - 1}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		far, farDist := -1, sq
+		for i := s[0] + 1; i < s[1]; i++ {
+			if d := segmentDistanceSq(ps[i], ps[s[0]], ps[s[1]]); d > farDist {
+				far, farDist = i, d
+			}
+		}
+		if far >= 0 {
+			keep[far] = true
+			stack = append(stack, [2]int{s[0], far}, [2]int{far, s[1]})
+		}
+	}
+	out := make([]vec3.Vec[float64], 0, len(ps))
+	for i, p := range ps {
+		if keep[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// segmentDistanceSq returns the squared planar distance of p to segment a b.
+func segmentDistanceSq(p, a, b vec3.Vec[float64]) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((p[0]-a[0])*dx+(p[1]-a[1])*dy)/l))
+	}
+	x, y := a[0]+t*dx-p[0], a[1]+t*dy-p[1]
+	return x*x + y*y
+}
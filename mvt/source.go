@@ -0,0 +1,166 @@
+package mvt
+
+import (
+	"context"
+	"time"
+
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/tiles"
+	"pinkey.ltd/xr/wfs"
+)
+
+// FeatureSource provides the WGS84 features of a tile layer.
+type FeatureSource interface {
+	// Features returns the features that may intersect the WGS84 bounds.
+	// Extra features are harmless, they are clipped away.
+	Features(ctx context.Context, bounds vec2.Rect[float64], z int) ([]*geojson.Feature, error)
+}
+
+// Collection serves the features of a GeoJSON feature collection.
+type Collection struct {
+	fc     *geojson.FeatureCollection
+	bounds []vec2.Rect[float64]
+}
+
+func NewCollection(fc *geojson.FeatureCollection) *Collection {
+	c := &Collection{fc: fc, bounds: make([]vec2.Rect[float64], len(fc.Features))}
+	for i, f := range fc.Features {
+		c.bounds[i] = f.Geometry.Bound()
+	}
+	return c
+}
+
+func (c *Collection) Features(ctx context.Context, bounds vec2.Rect[float64], z int) ([]*geojson.Feature, error) {
+	var fs []*geojson.Feature
+	for i, f := range c.fc.Features {
+		if f.Geometry != nil && c.bounds[i].Intersects(&bounds) {
+			fs = append(fs, f)
+		}
+	}
+	return fs, nil
+}
+
+// StoreFeatures serves a feature type of a WFS feature store.
+type StoreFeatures struct {
+	Store    wfs.Store
+	TypeName string
+}
+
+func (s *StoreFeatures) Features(ctx context.Context, bounds vec2.Rect[float64], z int) ([]*geojson.Feature, error) {
+	box := geojson.NewPolygonGeometry([][]vec3.Vec[float64]{{
+		{bounds.Min[0], bounds.Min[1], 0},
+		{bounds.Max[0], bounds.Min[1], 0},
+		{bounds.Max[0], bounds.Max[1], 0},
+		{bounds.Min[0], bounds.Max[1], 0},
+		{bounds.Min[0], bounds.Min[1], 0},
+	}})
+	q := &wfs.Query{TypeName: s.TypeName, Filter: &wfs.Spatial{Op: wfs.BBOX, Geometry: box}, Count: -1}
+	found, _, err := s.Store.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	fs := make([]*geojson.Feature, len(found))
+	for i, f := range found {
+		fs[i] = f.Feature
+	}
+	return fs, nil
+}
+
+// SourceLayer is a layer of the tiles of a Source.
+type SourceLayer struct {
+	Name     string
+	Features FeatureSource
+}
+
+// Source cuts vector tiles on the fly. It is a tiles.TileSource, so
+// tiles.NewHandler serves it with caching and compression.
+type Source struct {
+	Layers []*SourceLayer
+	// Options applies to every tile. Simplification is skipped at the
+	// maximum zoom level, whose tiles are overzoomed by clients.
+	Options Options
+	info    tiles.Info
+	modTime time.Time
+}
+
+// NewSource creates a source of WebMercator tiles from minZoom to maxZoom.
+func NewSource(name string, minZoom, maxZoom int, layers ...*SourceLayer) *Source {
+	return &Source{
+		Layers:  layers,
+		Options: DefaultOptions,
+		info: tiles.Info{
+			Name:    name,
+			Format:  tiles.PBF,
+			Grid:    tiles.WebMercator,
+			MinZoom: minZoom,
+			MaxZoom: maxZoom,
+			Bounds:  vec2.Rect[float64]{Min: vec2.Vec[float64]{-180, -85.05112877980659}, Max: vec2.Vec[float64]{180, 85.05112877980659}},
+		},
+		modTime: time.Now(),
+	}
+}
+
+func (s *Source) Info() *tiles.Info {
+	return &s.info
+}
+
+// Tile returns the encoded tile t. Tiles without features are empty but
+// still valid.
+func (s *Source) Tile(ctx context.Context, t tiles.Tile) (*tiles.TileData, error) {
+	grid := s.info.Grid
+	if !grid.Valid(t) {
+		return nil, tiles.ErrTileNotFound
+	}
+	opts := s.Options
+	if t.Z >= s.info.MaxZoom {
+		opts.Tolerance = 0
+	}
+	bounds, err := s.queryBounds(t, opts)
+	if err != nil {
+		return nil, err
+	}
+	tile := &Tile{}
+	for _, sl := range s.Layers {
+		fs, err := sl.Features.Features(ctx, bounds, t.Z)
+		if err != nil {
+			return nil, err
+		}
+		if l := NewLayer(sl.Name, fs, grid, t, opts); len(l.Features) > 0 {
+			tile.Layers = append(tile.Layers, l)
+		}
+	}
+	data, err := Marshal(tile)
+	if err != nil {
+		return nil, err
+	}
+	return &tiles.TileData{Data: data, ModTime: s.modTime}, nil
+}
+
+// queryBounds returns the WGS84 bounds of t grown by the buffer.
+func (s *Source) queryBounds(t tiles.Tile, opts Options) (vec2.Rect[float64], error) {
+	grid := s.info.Grid
+	b := grid.TileBounds(t)
+	extent := opts.Extent
+	if extent <= 0 {
+		extent = DEFAULT_EXTENT
+	}
+	margin := (b.Max[0] - b.Min[0]) * float64(opts.Buffer) / float64(extent)
+	minLon, minLat, err := grid.ToLonLat(max(b.Min[0]-margin, grid.Extent.Min[0]), max(b.Min[1]-margin, grid.Extent.Min[1]))
+	if err != nil {
+		return b, err
+	}
+	maxLon, maxLat, err := grid.ToLonLat(min(b.Max[0]+margin, grid.Extent.Max[0]), min(b.Max[1]+margin, grid.Extent.Max[1]))
+	if err != nil {
+		return b, err
+	}
+	// positions beyond the grid are projected onto its edges
+	if b.Min[1]-margin <= grid.Extent.Min[1] {
+		minLat = -90
+	}
+	if b.Max[1]+margin >= grid.Extent.Max[1] {
+		maxLat = 90
+	}
+	return vec2.Rect[float64]{Min: vec2.Vec[float64]{minLon, minLat}, Max: vec2.Vec[float64]{maxLon, maxLat}}, nil
+}
@@ -0,0 +1,286 @@
+package ogcapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/wfs"
+)
+
+// Collection describes a feature or 3D collection.
+type Collection struct {
+	ID             string   `json:"id"`
+	Title          string   `json:"title,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	Links          []Link   `json:"links"`
+	Extent         *Extent  `json:"extent,omitempty"`
+	ItemType       string   `json:"itemType,omitempty"`
+	CollectionType string   `json:"collectionType,omitempty"`
+	CRS            []string `json:"crs,omitempty"`
+	// Content links to the 3D content of a GeoVolumes collection.
+	Content []Link `json:"content,omitempty"`
+}
+
+type Extent struct {
+	Spatial *SpatialExtent `json:"spatial,omitempty"`
+}
+
+type SpatialExtent struct {
+	BBox [][]float64 `json:"bbox"`
+	CRS  string      `json:"crs"`
+}
+
+func (s *Server) featureType(id string) (*wfs.FeatureType, error) {
+	if s.Store != nil {
+		for _, ft := range s.Store.FeatureTypes() {
+			if ft.Name == id {
+				return ft, nil
+			}
+		}
+	}
+	return nil, notFound("collection " + id)
+}
+
+func (s *Server) featureCollection(base string, ft *wfs.FeatureType) *Collection {
+	href := base + "/collections/" + url.PathEscape(ft.Name)
+	b := ft.Bounds
+	return &Collection{
+		ID:          ft.Name,
+		Title:       ft.Title,
+		Description: ft.Abstract,
+		Links: []Link{
+			{Href: href, Rel: "self", Type: JSON_TYPE, Title: "this document"},
+			{Href: href + "/items", Rel: "items", Type: GEOJSON_TYPE, Title: "features"},
+		},
+		Extent: &Extent{Spatial: &SpatialExtent{
+			BBox: [][]float64{{b.Min[0], b.Min[1], b.Max[0], b.Max[1]}},
+			CRS:  CRS84,
+		}},
+		ItemType: "feature",
+		CRS:      []string{CRS84},
+	}
+}
+
+type featureCollectionJSON struct {
+	Type           string             `json:"type"`
+	Features       []*geojson.Feature `json:"features"`
+	Links          []Link             `json:"links"`
+	TimeStamp      string             `json:"timeStamp"`
+	NumberMatched  int                `json:"numberMatched"`
+	NumberReturned int                `json:"numberReturned"`
+}
+
+var itemsParams = map[string]bool{"f": true, "limit": true, "offset": true, "bbox": true, "bbox-crs": true, "datetime": true}
+
+func (s *Server) items(w http.ResponseWriter, r *http.Request, base string, ft *wfs.FeatureType) error {
+	q := r.URL.Query()
+	limit, offset := s.DefaultLimit, 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return badRequest("limit must be a positive integer")
+		}
+		limit = min(n, s.MaxLimit)
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return badRequest("offset must be a non-negative integer")
+		}
+		offset = n
+	}
+
+	var filters wfs.And
+	if v := q.Get("bbox"); v != "" {
+		if c := q.Get("bbox-crs"); c != "" && c != CRS84 {
+			return badRequest("unsupported bbox-crs " + c)
+		}
+		box, err := parseBBox(v)
+		if err != nil {
+			return err
+		}
+		filters = append(filters, &wfs.Spatial{Op: wfs.BBOX, Geometry: box})
+	}
+	if v := q.Get("datetime"); v != "" {
+		tf, err := parseDatetime(v)
+		if err != nil {
+			return err
+		}
+		tf.property = s.TimeProperty
+		filters = append(filters, tf)
+	}
+	for name := range q {
+		if itemsParams[name] {
+			continue
+		}
+		if !hasProperty(ft, name) {
+			return badRequest("unknown parameter " + name)
+		}
+		filters = append(filters, &wfs.Comparison{Op: wfs.PROPERTY_IS_EQUAL_TO, Property: name, Literal: q.Get(name), MatchCase: true})
+	}
+
+	query := &wfs.Query{TypeName: ft.Name, StartIndex: offset, Count: limit}
+	if len(filters) > 0 {
+		query.Filter = filters
+	}
+	found, matched, err := s.Store.Query(r.Context(), query)
+	if err != nil {
+		return err
+	}
+
+	href := base + "/collections/" + url.PathEscape(ft.Name) + "/items"
+	page := func(offset int) string {
+		p := url.Values{}
+		for k, v := range q {
+			p[k] = v
+		}
+		p.Set("limit", strconv.Itoa(limit))
+		p.Set("offset", strconv.Itoa(offset))
+		return href + "?" + p.Encode()
+	}
+	fc := &featureCollectionJSON{
+		Type:           geojson.TYPE_FEATURE_COLLECTION,
+		Features:       make([]*geojson.Feature, len(found)),
+		Links:          []Link{{Href: page(offset), Rel: "self", Type: GEOJSON_TYPE, Title: "this document"}},
+		TimeStamp:      time.Now().UTC().Format(time.RFC3339),
+		NumberMatched:  matched,
+		NumberReturned: len(found),
+	}
+	for i, f := range found {
+		fc.Features[i] = f.Feature
+	}
+	if offset+len(found) < matched {
+		fc.Links = append(fc.Links, Link{Href: page(offset + len(found)), Rel: "next", Type: GEOJSON_TYPE, Title: "next page"})
+	}
+	if offset > 0 {
+		fc.Links = append(fc.Links, Link{Href: page(max(offset-limit, 0)), Rel: "prev", Type: GEOJSON_TYPE, Title: "previous page"})
+	}
+	return writeJSON(w, GEOJSON_TYPE, fc)
+}
+
+func (s *Server) item(w http.ResponseWriter, r *http.Request, base string, ft *wfs.FeatureType, id string) error {
+	q := &wfs.Query{TypeName: ft.Name, Filter: wfs.ResourceID{ft.Name + "." + id}, Count: 1}
+	found, _, err := s.Store.Query(r.Context(), q)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return notFound("feature " + id)
+	}
+	data, err := json.Marshal(found[0].Feature)
+	if err != nil {
+		return err
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	href := base + "/collections/" + url.PathEscape(ft.Name)
+	doc["links"], _ = json.Marshal([]Link{
+		{Href: href + "/items/" + url.PathEscape(id), Rel: "self", Type: GEOJSON_TYPE, Title: "this document"},
+		{Href: href, Rel: "collection", Type: JSON_TYPE, Title: "the collection"},
+	})
+	return writeJSON(w, GEOJSON_TYPE, doc)
+}
+
+func hasProperty(ft *wfs.FeatureType, name string) bool {
+	for _, p := range ft.Properties {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBBox parses a bbox of four or six numbers, the latter with minimum
+// and maximum heights which are ignored.
+func parseBBox(s string) (*geojson.Geometry, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 && len(parts) != 6 {
+		return nil, badRequest("bbox needs 4 or 6 numbers")
+	}
+	v := make([]float64, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, badRequest("invalid bbox " + s)
+		}
+		v[i] = n
+	}
+	if len(v) == 6 {
+		v = []float64{v[0], v[1], v[3], v[4]}
+	}
+	if v[0] > v[2] || v[1] > v[3] {
+		return nil, badRequest("invalid bbox " + s)
+	}
+	return geojson.NewPolygonGeometry([][]vec3.Vec[float64]{{
+		{v[0], v[1], 0}, {v[2], v[1], 0}, {v[2], v[3], 0}, {v[0], v[3], 0}, {v[0], v[1], 0},
+	}}), nil
+}
+
+// timeFilter matches features whose time property lies in an interval.
+// A zero bound leaves the interval open on that side.
+type timeFilter struct {
+	property   string
+	start, end time.Time
+}
+
+func (t *timeFilter) Match(f *wfs.Feature) bool {
+	s, ok := f.Properties[t.property].(string)
+	if !ok {
+		return false
+	}
+	start, end, err := parseTime(s)
+	if err != nil {
+		return false
+	}
+	return (t.end.IsZero() || !start.After(t.end)) && (t.start.IsZero() || !end.Before(t.start))
+}
+
+// parseDatetime parses an instant or an interval with "/" between open
+// ("..") or closed bounds.
+func parseDatetime(s string) (*timeFilter, error) {
+	tf := &timeFilter{}
+	from, to, isInterval := strings.Cut(s, "/")
+	if !isInterval {
+		start, end, err := parseTime(s)
+		if err != nil {
+			return nil, badRequest("invalid datetime " + s)
+		}
+		tf.start, tf.end = start, end
+		return tf, nil
+	}
+	if from != "" && from != ".." {
+		start, _, err := parseTime(from)
+		if err != nil {
+			return nil, badRequest("invalid datetime " + s)
+		}
+		tf.start = start
+	}
+	if to != "" && to != ".." {
+		_, end, err := parseTime(to)
+		if err != nil {
+			return nil, badRequest("invalid datetime " + s)
+		}
+		tf.end = end
+	}
+	return tf, nil
+}
+
+// parseTime parses an RFC 3339 instant, or a date which spans the whole day.
+func parseTime(s string) (time.Time, time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, t, nil
+	}
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return d, d, err
+	}
+	return d, d.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
@@ -0,0 +1,85 @@
+package ogcapi
+
+import (
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/tiles3d"
+)
+
+const TILES3D_TYPE = "application/json+3dtiles"
+
+// Volume is a 3D GeoVolumes collection serving a 3D Tiles tileset at
+// /collections/{id}/3dtiles/.
+type Volume struct {
+	ID          string
+	Title       string
+	Description string
+	// Tileset holds tiles3d.TILESET_FILE and the files it references,
+	// for example the result of tiles3d.FromMesh, an os.DirFS or a
+	// tiles3d.Archive.
+	Tileset fs.FS
+	// Bounds is the WGS84 extent with ellipsoidal heights. It is taken
+	// from the root tile when zero.
+	Bounds vec3.Box[float64]
+}
+
+func (s *Server) volume(id string) *Volume {
+	for _, v := range s.Volumes {
+		if v.ID == id {
+			return v
+		}
+	}
+	return nil
+}
+
+func (s *Server) volumeCollection(base string, v *Volume) (*Collection, error) {
+	b := v.Bounds
+	if b == (vec3.Box[float64]{}) {
+		ts, err := tiles3d.ReadTileset(v.Tileset, tiles3d.TILESET_FILE)
+		if err != nil {
+			return nil, err
+		}
+		if b, err = ts.Region(); err != nil {
+			return nil, err
+		}
+	}
+	href := base + "/collections/" + url.PathEscape(v.ID)
+	return &Collection{
+		ID:          v.ID,
+		Title:       v.Title,
+		Description: v.Description,
+		Links:       []Link{{Href: href, Rel: "self", Type: JSON_TYPE, Title: "this document"}},
+		Extent: &Extent{Spatial: &SpatialExtent{
+			BBox: [][]float64{{b.Min[0], b.Min[1], b.Min[2], b.Max[0], b.Max[1], b.Max[2]}},
+			CRS:  CRS84H,
+		}},
+		CollectionType: "3d-container",
+		CRS:            []string{CRS84H},
+		Content: []Link{
+			{Href: href + "/3dtiles/" + tiles3d.TILESET_FILE, Rel: "original", Type: TILES3D_TYPE, Title: v.Title},
+		},
+	}, nil
+}
+
+func (s *Server) serveVolume(w http.ResponseWriter, r *http.Request, base string, v *Volume, rest []string) error {
+	if len(rest) == 0 {
+		c, err := s.volumeCollection(base, v)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, JSON_TYPE, c)
+	}
+	if rest[0] != "3dtiles" {
+		return notFound(r.URL.Path)
+	}
+	// CORS headers are set by the server already
+	h := &tiles3d.Handler{FS: v.Tileset}
+	fr := r.Clone(r.Context())
+	fr.URL.Path, fr.URL.RawPath = strings.Join(rest[1:], "/"), ""
+	h.ServeHTTP(w, fr)
+	return nil
+}
@@ -0,0 +1,227 @@
+// Package ogcapi implements OGC API - Features - Part 1: Core with GeoJSON
+// encoding and the collections of OGC API - 3D GeoVolumes.
+//
+// Feature collections are the feature types of a wfs.Store and 3D
+// collections are 3D Tiles tilesets, so one server exposes both 2D features
+// and 3D content under /collections.
+package ogcapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"pinkey.ltd/xr/ows"
+	"pinkey.ltd/xr/wfs"
+)
+
+// Conformance classes.
+const (
+	CONFORMANCE_COMMON      = "http://www.opengis.net/spec/ogcapi-common-1/1.0/conf/core"
+	CONFORMANCE_COLLECTIONS = "http://www.opengis.net/spec/ogcapi-common-2/1.0/conf/collections"
+	CONFORMANCE_FEATURES    = "http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/core"
+	CONFORMANCE_GEOJSON     = "http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/geojson"
+	CONFORMANCE_GEOVOLUMES  = "http://www.opengis.net/spec/ogcapi-geovolumes-1/1.0/conf/core"
+)
+
+const (
+	CRS84  = "http://www.opengis.net/def/crs/OGC/1.3/CRS84"
+	CRS84H = "http://www.opengis.net/def/crs/OGC/0/CRS84h"
+
+	JSON_TYPE    = "application/json"
+	GEOJSON_TYPE = "application/geo+json"
+
+	DEFAULT_LIMIT = 10
+	MAX_LIMIT     = 10000
+)
+
+// Link is a web link of OGC API documents.
+type Link struct {
+	Href  string `json:"href"`
+	Rel   string `json:"rel"`
+	Type  string `json:"type,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+// Server serves the landing page, conformance declaration and collections
+// of an OGC API.
+type Server struct {
+	Title       string
+	Description string
+	// Store provides the feature collections, it may be nil.
+	Store   wfs.Store
+	Volumes []*Volume
+	// TimeProperty is the feature property holding the RFC 3339 instant
+	// matched by datetime queries.
+	TimeProperty string
+	DefaultLimit int
+	MaxLimit     int
+	// BaseURL is the public URL of the API, derived from requests when
+	// empty.
+	BaseURL     string
+	AllowOrigin string // value of Access-Control-Allow-Origin, CORS is off when empty
+}
+
+func NewServer(title string, store wfs.Store) *Server {
+	return &Server{
+		Title:        title,
+		Store:        store,
+		TimeProperty: "datetime",
+		DefaultLimit: DEFAULT_LIMIT,
+		MaxLimit:     MAX_LIMIT,
+		AllowOrigin:  "*",
+	}
+}
+
+// apiError is the JSON exception of OGC API.
+type apiError struct {
+	status      int
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+func (e *apiError) Error() string {
+	return e.Description
+}
+
+func badRequest(msg string) *apiError {
+	return &apiError{status: http.StatusBadRequest, Code: "InvalidParameterValue", Description: msg}
+}
+
+func notFound(what string) *apiError {
+	return &apiError{status: http.StatusNotFound, Code: "NotFound", Description: what + " not found"}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.AllowOrigin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", s.AllowOrigin)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, &apiError{status: http.StatusMethodNotAllowed, Code: "MethodNotAllowed", Description: "method not allowed"})
+		return
+	}
+	if err := s.serve(w, r); err != nil {
+		writeError(w, err)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) error {
+	base := s.BaseURL
+	if base == "" {
+		base = ows.BaseURL(r)
+	}
+	base = strings.TrimSuffix(base, "/")
+	if f := r.URL.Query().Get("f"); f != "" && f != "json" && f != "geojson" {
+		return &apiError{status: http.StatusNotAcceptable, Code: "NotAcceptable", Description: "unsupported format " + f}
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+	switch {
+	case len(parts) == 0:
+		return writeJSON(w, JSON_TYPE, s.landingPage(base))
+	case len(parts) == 1 && parts[0] == "conformance":
+		return writeJSON(w, JSON_TYPE, s.conformance())
+	case parts[0] != "collections":
+		return notFound(r.URL.Path)
+	case len(parts) == 1:
+		cs, err := s.collections(base)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, JSON_TYPE, cs)
+	}
+
+	id := parts[1]
+	if v := s.volume(id); v != nil {
+		return s.serveVolume(w, r, base, v, parts[2:])
+	}
+	ft, err := s.featureType(id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(parts) == 2:
+		return writeJSON(w, JSON_TYPE, s.featureCollection(base, ft))
+	case parts[2] != "items" || len(parts) > 4:
+		return notFound(r.URL.Path)
+	case len(parts) == 3:
+		return s.items(w, r, base, ft)
+	}
+	return s.item(w, r, base, ft, parts[3])
+}
+
+type landingPage struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Links       []Link `json:"links"`
+}
+
+func (s *Server) landingPage(base string) *landingPage {
+	return &landingPage{
+		Title:       s.Title,
+		Description: s.Description,
+		Links: []Link{
+			{Href: base + "/", Rel: "self", Type: JSON_TYPE, Title: "this document"},
+			{Href: base + "/conformance", Rel: "conformance", Type: JSON_TYPE, Title: "conformance classes"},
+			{Href: base + "/collections", Rel: "data", Type: JSON_TYPE, Title: "collections"},
+		},
+	}
+}
+
+func (s *Server) conformance() interface{} {
+	classes := []string{CONFORMANCE_COMMON, CONFORMANCE_COLLECTIONS, CONFORMANCE_FEATURES, CONFORMANCE_GEOJSON}
+	if len(s.Volumes) > 0 {
+		classes = append(classes, CONFORMANCE_GEOVOLUMES)
+	}
+	return map[string][]string{"conformsTo": classes}
+}
+
+type collections struct {
+	Links       []Link        `json:"links"`
+	Collections []*Collection `json:"collections"`
+}
+
+func (s *Server) collections(base string) (*collections, error) {
+	cs := &collections{
+		Links:       []Link{{Href: base + "/collections", Rel: "self", Type: JSON_TYPE, Title: "this document"}},
+		Collections: []*Collection{},
+	}
+	if s.Store != nil {
+		for _, ft := range s.Store.FeatureTypes() {
+			cs.Collections = append(cs.Collections, s.featureCollection(base, ft))
+		}
+	}
+	for _, v := range s.Volumes {
+		c, err := s.volumeCollection(base, v)
+		if err != nil {
+			return nil, err
+		}
+		cs.Collections = append(cs.Collections, c)
+	}
+	return cs, nil
+}
+
+func writeJSON(w http.ResponseWriter, contentType string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(data)
+	return nil
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	e, ok := err.(*apiError)
+	if !ok {
+		e = &apiError{status: http.StatusInternalServerError, Code: "ServerError", Description: err.Error()}
+	}
+	w.Header().Set("Content-Type", JSON_TYPE)
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(e)
+}
@@ -0,0 +1,225 @@
+package ogcapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/mst"
+	"pinkey.ltd/xr/tiles3d"
+	"pinkey.ltd/xr/wfs"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	cities := geojson.NewFeatureCollection()
+	for i, c := range []struct {
+		name     string
+		lon, lat float64
+		founded  string
+	}{
+		{"Beijing", 116.4, 39.9, "2020-01-01T00:00:00Z"},
+		{"Shanghai", 121.5, 31.2, "2020-06-15"},
+		{"Guangzhou", 113.3, 23.1, "2021-03-01T12:00:00Z"},
+		{"Chengdu", 104.1, 30.7, "2022-01-01T00:00:00Z"},
+		{"Harbin", 126.6, 45.8, "2023-01-01T00:00:00Z"},
+	} {
+		f := geojson.NewFeature(geojson.NewPointGeometry(vec3.Vec[float64]{c.lon, c.lat, 0}))
+		f.ID = float64(i + 1)
+		f.Properties["name"] = c.name
+		f.Properties["datetime"] = c.founded
+		cities.Append(f)
+	}
+	store := wfs.NewMemoryStore()
+	store.Add(&wfs.FeatureType{Name: "cities", Title: "Cities"}, cities)
+
+	ms := mst.NewMesh[float32]()
+	nd := &mst.MeshNode[float32]{Vertices: []vec3.Vec[float32]{{0, 0, 0}, {30, 0, 0}, {0, 40, 10}}}
+	nd.FaceGroup = []*mst.MeshTriangle{{Faces: []*mst.Face{{Vertex: [3]uint32{0, 1, 2}}}}}
+	ms.Nodes = append(ms.Nodes, nd)
+	ms.Materials = append(ms.Materials, &mst.BaseMaterial{Color: [3]byte{255, 0, 0}})
+	files, err := tiles3d.FromMesh(ms, 116.4, 39.9, 40)
+	assert.Nil(t, err)
+
+	s := NewServer("test api", store)
+	s.Volumes = []*Volume{{ID: "buildings", Title: "Buildings", Tileset: files}}
+	return httptest.NewServer(http.StripPrefix("/api", s))
+}
+
+func getJSON(t *testing.T, u string, v interface{}) *http.Response {
+	resp, err := http.Get(u)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	if v != nil {
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp
+}
+
+func TestLandingAndConformance(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	var landing landingPage
+	resp := getJSON(t, srv.URL+"/api/", &landing)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, JSON_TYPE, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "test api", landing.Title)
+	assert.Equal(t, srv.URL+"/api/collections", landing.Links[2].Href)
+
+	var conf struct {
+		ConformsTo []string `json:"conformsTo"`
+	}
+	getJSON(t, srv.URL+"/api/conformance", &conf)
+	assert.Contains(t, conf.ConformsTo, CONFORMANCE_FEATURES)
+	assert.Contains(t, conf.ConformsTo, CONFORMANCE_GEOVOLUMES)
+
+	var cs collections
+	getJSON(t, srv.URL+"/api/collections", &cs)
+	assert.Equal(t, 2, len(cs.Collections))
+	assert.Equal(t, "cities", cs.Collections[0].ID)
+	assert.Equal(t, "feature", cs.Collections[0].ItemType)
+	assert.Equal(t, []float64{104.1, 23.1, 126.6, 45.8}, cs.Collections[0].Extent.Spatial.BBox[0])
+	assert.Equal(t, "buildings", cs.Collections[1].ID)
+	assert.Equal(t, "3d-container", cs.Collections[1].CollectionType)
+
+	resp = getJSON(t, srv.URL+"/api/collections?f=html", nil)
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/collections", nil)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+type itemsPage struct {
+	Features []struct {
+		ID         interface{}            `json:"id"`
+		Properties map[string]interface{} `json:"properties"`
+	} `json:"features"`
+	Links          []Link `json:"links"`
+	NumberMatched  int    `json:"numberMatched"`
+	NumberReturned int    `json:"numberReturned"`
+}
+
+func (p *itemsPage) names() []string {
+	var ns []string
+	for _, f := range p.Features {
+		ns = append(ns, f.Properties["name"].(string))
+	}
+	return ns
+}
+
+func (p *itemsPage) link(rel string) string {
+	for _, l := range p.Links {
+		if l.Rel == rel {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+func TestItems(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+	items := srv.URL + "/api/collections/cities/items"
+
+	var page itemsPage
+	resp := getJSON(t, items+"?limit=2", &page)
+	assert.Equal(t, GEOJSON_TYPE, resp.Header.Get("Content-Type"))
+	assert.Equal(t, []string{"Beijing", "Shanghai"}, page.names())
+	assert.Equal(t, 5, page.NumberMatched)
+	assert.Equal(t, 2, page.NumberReturned)
+	assert.Equal(t, "", page.link("prev"))
+	next := page.link("next")
+	assert.Contains(t, next, "offset=2")
+
+	page = itemsPage{}
+	getJSON(t, next, &page)
+	assert.Equal(t, []string{"Guangzhou", "Chengdu"}, page.names())
+	assert.NotEmpty(t, page.link("prev"))
+
+	tests := []struct {
+		query string
+		names []string
+	}{
+		{"bbox=110,30,125,50", []string{"Beijing", "Shanghai"}},
+		{"bbox=110,30,0,125,50,100", []string{"Beijing", "Shanghai"}},
+		{"datetime=2020-06-15T10:00:00Z", []string{"Shanghai"}},
+		{"datetime=2021-01-01T00:00:00Z/..", []string{"Guangzhou", "Chengdu", "Harbin"}},
+		{"datetime=../2020-12-31T00:00:00Z", []string{"Beijing", "Shanghai"}},
+		{"datetime=2021-01-01/2022-01-01&bbox=100,20,115,35", []string{"Guangzhou", "Chengdu"}},
+		{"name=Harbin", []string{"Harbin"}},
+	}
+	for _, tt := range tests {
+		page = itemsPage{}
+		resp = getJSON(t, items+"?"+tt.query, &page)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, tt.query)
+		assert.Equal(t, tt.names, page.names(), tt.query)
+	}
+
+	for _, q := range []string{"limit=0", "offset=-1", "bbox=1,2,3", "bbox=5,5,1,1", "datetime=yesterday", "color=red", "bbox=0,0,1,1&bbox-crs=EPSG:3857"} {
+		var e apiError
+		resp = getJSON(t, items+"?"+q, &e)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, q)
+		assert.Equal(t, "InvalidParameterValue", e.Code, q)
+	}
+
+	var item struct {
+		ID         float64                `json:"id"`
+		Properties map[string]interface{} `json:"properties"`
+		Links      []Link                 `json:"links"`
+	}
+	resp = getJSON(t, items+"/3", &item)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3.0, item.ID)
+	assert.Equal(t, "Guangzhou", item.Properties["name"])
+	assert.Equal(t, items+"/3", item.Links[0].Href)
+
+	for _, p := range []string{"/3/x", "/9", "/../../rivers/items"} {
+		resp = getJSON(t, items+p, nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, p)
+	}
+	resp = getJSON(t, srv.URL+"/api/collections/rivers/items", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestGeoVolumes(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+	coll := srv.URL + "/api/collections/buildings"
+
+	var c Collection
+	getJSON(t, coll, &c)
+	assert.Equal(t, "buildings", c.ID)
+	assert.Equal(t, CRS84H, c.Extent.Spatial.CRS)
+	bbox := c.Extent.Spatial.BBox[0]
+	assert.Equal(t, 6, len(bbox))
+	assert.InDelta(t, 116.4, bbox[0], 1e-6)
+	assert.InDelta(t, 39.9, bbox[1], 1e-6)
+	assert.InDelta(t, 40, bbox[2], 0.01)
+	assert.InDelta(t, 50, bbox[5], 0.01)
+	assert.Equal(t, coll+"/3dtiles/tileset.json", c.Content[0].Href)
+	assert.Equal(t, TILES3D_TYPE, c.Content[0].Type)
+
+	var ts tiles3d.Tileset
+	resp := getJSON(t, c.Content[0].Href, &ts)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, tiles3d.CONTENT_FILE, ts.Root.Content.URI)
+
+	resp, err := http.Get(coll + "/3dtiles/" + ts.Root.Content.URI)
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "model/gltf-binary", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "glTF", string(body[:4]))
+
+	for _, p := range []string{"/3dtiles/missing.glb", "/items"} {
+		resp = getJSON(t, coll+p, nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, p)
+	}
+}
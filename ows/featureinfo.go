@@ -0,0 +1,36 @@
+package ows
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"pinkey.ltd/xr/geojson"
+)
+
+// WriteFeatureInfo writes the features found by a GetFeatureInfo request,
+// as a listing of their properties for text/plain and as GeoJSON otherwise.
+func WriteFeatureInfo(w http.ResponseWriter, hits *geojson.FeatureCollection, format string) error {
+	if format == "text/plain" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for i, f := range hits.Features {
+			fmt.Fprintf(w, "Feature %d", i)
+			if f.ID != nil {
+				fmt.Fprintf(w, " (id %v)", f.ID)
+			}
+			fmt.Fprintln(w, ":")
+			keys := make([]string, 0, len(f.Properties))
+			for k := range f.Properties {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				fmt.Fprintf(w, "  %s = %v\n", k, f.Properties[k])
+			}
+		}
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(hits)
+}
@@ -0,0 +1,263 @@
+// Package ows holds the OGC Web Services Common 1.1 elements shared by the
+// OGC service packages: capabilities sections, exception reports and key
+// value pair request parameters.
+//
+// Elements are marshalled with literal "ows:" and "xlink:" prefixes, the
+// root element of a document declares them with Namespaces.
+package ows
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	OWS_NAMESPACE   = "http://www.opengis.net/ows/1.1"
+	XLINK_NAMESPACE = "http://www.w3.org/1999/xlink"
+	XSI_NAMESPACE   = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// Namespaces are the xmlns attributes for the ows and xlink prefixes.
+type Namespaces struct {
+	Ows   string `xml:"xmlns:ows,attr"`
+	Xlink string `xml:"xmlns:xlink,attr"`
+}
+
+func NewNamespaces() Namespaces {
+	return Namespaces{Ows: OWS_NAMESPACE, Xlink: XLINK_NAMESPACE}
+}
+
+type ServiceIdentification struct {
+	Title              string   `xml:"ows:Title"`
+	Abstract           string   `xml:"ows:Abstract,omitempty"`
+	Keywords           []string `xml:"ows:Keywords>ows:Keyword,omitempty"`
+	ServiceType        string   `xml:"ows:ServiceType"`
+	ServiceTypeVersion []string `xml:"ows:ServiceTypeVersion"`
+	Fees               string   `xml:"ows:Fees,omitempty"`
+	AccessConstraints  string   `xml:"ows:AccessConstraints,omitempty"`
+}
+
+type ServiceProvider struct {
+	ProviderName string `xml:"ows:ProviderName"`
+	ProviderSite *Link  `xml:"ows:ProviderSite,omitempty"`
+}
+
+type Link struct {
+	Href string `xml:"xlink:href,attr"`
+}
+
+// Domain is a named list of allowed values, used for parameters and
+// constraints.
+type Domain struct {
+	Name          string    `xml:"name,attr"`
+	AllowedValues []string  `xml:"ows:AllowedValues>ows:Value,omitempty"`
+	NoValues      *struct{} `xml:"ows:NoValues,omitempty"`
+	DefaultValue  string    `xml:"ows:DefaultValue,omitempty"`
+}
+
+type Method struct {
+	Href        string   `xml:"xlink:href,attr"`
+	Constraints []Domain `xml:"ows:Constraint,omitempty"`
+}
+
+type DCP struct {
+	Get  []Method `xml:"ows:HTTP>ows:Get,omitempty"`
+	Post []Method `xml:"ows:HTTP>ows:Post,omitempty"`
+}
+
+type Operation struct {
+	Name       string   `xml:"name,attr"`
+	DCP        DCP      `xml:"ows:DCP"`
+	Parameters []Domain `xml:"ows:Parameter,omitempty"`
+}
+
+type OperationsMetadata struct {
+	Operations  []Operation `xml:"ows:Operation"`
+	Parameters  []Domain    `xml:"ows:Parameter,omitempty"`
+	Constraints []Domain    `xml:"ows:Constraint,omitempty"`
+}
+
+// NewGetOperation creates an operation reachable with HTTP GET at href.
+// Encodings such as "KVP" or "RESTful" are listed in a GetEncoding
+// constraint when given.
+func NewGetOperation(name, href string, encodings ...string) Operation {
+	m := Method{Href: href}
+	if len(encodings) > 0 {
+		m.Constraints = []Domain{{Name: "GetEncoding", AllowedValues: encodings}}
+	}
+	return Operation{Name: name, DCP: DCP{Get: []Method{m}}}
+}
+
+// BoundingBox is written as "ows:BoundingBox" or "ows:WGS84BoundingBox"
+// depending on the field tag of the parent.
+type BoundingBox struct {
+	CRS         string `xml:"crs,attr,omitempty"`
+	LowerCorner string `xml:"ows:LowerCorner"`
+	UpperCorner string `xml:"ows:UpperCorner"`
+}
+
+// NewBoundingBox formats the corners as space separated ordinates.
+func NewBoundingBox(crs string, minX, minY, maxX, maxY float64) *BoundingBox {
+	return &BoundingBox{CRS: crs, LowerCorner: FormatFloats(minX, minY), UpperCorner: FormatFloats(maxX, maxY)}
+}
+
+// FormatFloats joins numbers with spaces in the shortest exact notation.
+func FormatFloats(vs ...float64) string {
+	s := make([]string, len(vs))
+	for i, v := range vs {
+		s[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strings.Join(s, " ")
+}
+
+// Exception codes of OWS Common, services define additional codes.
+const (
+	MISSING_PARAMETER_VALUE    = "MissingParameterValue"
+	INVALID_PARAMETER_VALUE    = "InvalidParameterValue"
+	OPERATION_NOT_SUPPORTED    = "OperationNotSupported"
+	VERSION_NEGOTIATION_FAILED = "VersionNegotiationFailed"
+	NO_APPLICABLE_CODE         = "NoApplicableCode"
+)
+
+// Error is an exception reported to a client.
+type Error struct {
+	Code    string
+	Locator string
+	Text    string
+	Status  int
+}
+
+// NewError creates an exception. The HTTP status is 501 for unsupported
+// operations, 500 for NoApplicableCode and 400 otherwise.
+func NewError(code, locator, format string, args ...interface{}) *Error {
+	status := http.StatusBadRequest
+	switch code {
+	case OPERATION_NOT_SUPPORTED:
+		status = http.StatusNotImplemented
+	case NO_APPLICABLE_CODE:
+		status = http.StatusInternalServerError
+	}
+	return &Error{Code: code, Locator: locator, Text: fmt.Sprintf(format, args...), Status: status}
+}
+
+func (e *Error) Error() string {
+	if e.Locator != "" {
+		return fmt.Sprintf("%s (%s): %s", e.Code, e.Locator, e.Text)
+	}
+	return e.Code + ": " + e.Text
+}
+
+type Exception struct {
+	Code    string   `xml:"exceptionCode,attr"`
+	Locator string   `xml:"locator,attr,omitempty"`
+	Text    []string `xml:"ows:ExceptionText,omitempty"`
+}
+
+type ExceptionReport struct {
+	XMLName    xml.Name    `xml:"ows:ExceptionReport"`
+	Xmlns      string      `xml:"xmlns:ows,attr"`
+	Version    string      `xml:"version,attr"`
+	Lang       string      `xml:"xml:lang,attr,omitempty"`
+	Exceptions []Exception `xml:"ows:Exception"`
+}
+
+// WriteError writes err as an exception report. Errors that are not an
+// *Error are reported as NoApplicableCode.
+func WriteError(w http.ResponseWriter, err error, version string) {
+	e, ok := err.(*Error)
+	if !ok {
+		e = NewError(NO_APPLICABLE_CODE, "", "%s", err.Error())
+	}
+	rep := &ExceptionReport{
+		Xmlns:      OWS_NAMESPACE,
+		Version:    version,
+		Exceptions: []Exception{{Code: e.Code, Locator: e.Locator, Text: []string{e.Text}}},
+	}
+	WriteXML(w, e.Status, rep)
+}
+
+// WriteXML writes v as an XML document with the given status.
+func WriteXML(w http.ResponseWriter, status int, v interface{}) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+}
+
+// Params are key value pair request parameters with case insensitive names.
+type Params map[string]string
+
+// ParseParams keeps the first value of every query parameter.
+func ParseParams(q url.Values) Params {
+	p := Params{}
+	for k, v := range q {
+		if len(v) > 0 {
+			k = strings.ToUpper(k)
+			if _, ok := p[k]; !ok {
+				p[k] = v[0]
+			}
+		}
+	}
+	return p
+}
+
+func (p Params) Get(name string) string {
+	return p[strings.ToUpper(name)]
+}
+
+// Require returns a parameter or a MissingParameterValue error.
+func (p Params) Require(name string) (string, error) {
+	v := p.Get(name)
+	if v == "" {
+		return "", NewError(MISSING_PARAMETER_VALUE, name, "missing parameter %s", name)
+	}
+	return v, nil
+}
+
+// Int parses an integer parameter, def is returned when it is absent.
+func (p Params) Int(name string, def int) (int, error) {
+	v := p.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, NewError(INVALID_PARAMETER_VALUE, name, "%s is not an integer: %q", name, v)
+	}
+	return n, nil
+}
+
+// BaseURL returns the public URL of the handler serving r. When the
+// handler is mounted with http.StripPrefix the stripped prefix is kept.
+// X-Forwarded-Proto and X-Forwarded-Host headers are honoured.
+func BaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		scheme = p
+	}
+	host := r.Host
+	if h := r.Header.Get("X-Forwarded-Host"); h != "" {
+		host = h
+	}
+	orig := r.RequestURI
+	if u, err := url.ParseRequestURI(orig); err == nil {
+		orig = u.Path
+	}
+	prefix := strings.TrimSuffix(orig, r.URL.Path)
+	if orig == "" || !strings.HasSuffix(orig, r.URL.Path) {
+		prefix = ""
+	}
+	return scheme + "://" + host + strings.TrimSuffix(prefix, "/")
+}
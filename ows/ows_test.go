@@ -0,0 +1,94 @@
+package ows
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec3"
+)
+
+func TestParams(t *testing.T) {
+	q, _ := url.ParseQuery("service=WMTS&Request=GetTile&TileRow=3&tilecol=x")
+	p := ParseParams(q)
+	assert.Equal(t, "WMTS", p.Get("SERVICE"))
+	assert.Equal(t, "GetTile", p.Get("request"))
+
+	n, err := p.Int("TILEROW", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	n, err = p.Int("TILEMATRIX", 7)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, n)
+	_, err = p.Int("TILECOL", 0)
+	assert.Equal(t, INVALID_PARAMETER_VALUE, err.(*Error).Code)
+
+	_, err = p.Require("LAYER")
+	assert.Equal(t, &Error{Code: MISSING_PARAMETER_VALUE, Locator: "LAYER", Text: "missing parameter LAYER", Status: 400}, err)
+}
+
+func TestWriteError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteError(rec, NewError(OPERATION_NOT_SUPPORTED, "REQUEST", "no %s", "GetLegend"), "1.0.0")
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	var rep struct {
+		XMLName   xml.Name `xml:"http://www.opengis.net/ows/1.1 ExceptionReport"`
+		Version   string   `xml:"version,attr"`
+		Exception struct {
+			Code    string `xml:"exceptionCode,attr"`
+			Locator string `xml:"locator,attr"`
+			Text    string `xml:"http://www.opengis.net/ows/1.1 ExceptionText"`
+		} `xml:"http://www.opengis.net/ows/1.1 Exception"`
+	}
+	assert.Nil(t, xml.Unmarshal(rec.Body.Bytes(), &rep))
+	assert.Equal(t, "1.0.0", rep.Version)
+	assert.Equal(t, OPERATION_NOT_SUPPORTED, rep.Exception.Code)
+	assert.Equal(t, "REQUEST", rep.Exception.Locator)
+	assert.Equal(t, "no GetLegend", rep.Exception.Text)
+
+	rec = httptest.NewRecorder()
+	WriteError(rec, errors.New("disk full"), "2.0.0")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), `exceptionCode="NoApplicableCode"`)
+}
+
+func TestBaseURL(t *testing.T) {
+	var got string
+	h := http.StripPrefix("/ogc/wmts", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = BaseURL(r)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/ogc/wmts/1.0.0/WMTSCapabilities.xml?x=1", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "http://example.com/ogc/wmts", got)
+
+	r = httptest.NewRequest(http.MethodGet, "http://internal:8080/ogc/wmts?SERVICE=WMTS", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "maps.example.com")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "https://maps.example.com/ogc/wmts", got)
+}
+
+func TestWriteFeatureInfo(t *testing.T) {
+	f := geojson.NewFeature(geojson.NewPointGeometry(vec3.Vec[float64]{116, 40, 0}))
+	f.ID = "pole-7"
+	f.Properties["kind"] = "pole"
+	f.Properties["height"] = 12.5
+	hits := geojson.NewFeatureCollection()
+	hits.Append(f)
+
+	rec := httptest.NewRecorder()
+	assert.Nil(t, WriteFeatureInfo(rec, hits, "text/plain"))
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "Feature 0 (id pole-7):\n  height = 12.5\n  kind = pole\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	assert.Nil(t, WriteFeatureInfo(rec, hits, "application/json"))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `"pole-7"`)
+}
@@ -0,0 +1,217 @@
+package proj
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// CRSKind classifies coordinate reference systems.
+type CRSKind int
+
+const (
+	// Geographic coordinates are longitude, latitude in degrees and height in metres.
+	Geographic CRSKind = iota
+	// Geocentric coordinates are earth centred, earth fixed cartesian metres.
+	Geocentric
+	// Projected coordinates are easting, northing and height in the CRS unit.
+	Projected
+)
+
+// CRS is a coordinate reference system.
+type CRS struct {
+	Name       string
+	Code       int // EPSG code, zero when unknown
+	Kind       CRSKind
+	Datum      *Datum
+	Projection Projection // only used by Projected
+	ToMeter    float64    // size of the horizontal unit of a Projected CRS in metres
+	Geoid      *Geoid     // heights are orthometric above this geoid, nil for ellipsoidal heights
+}
+
+// NewGeographic creates a geographic CRS on the given datum.
+func NewGeographic(d *Datum) *CRS {
+	return &CRS{Name: d.Name, Kind: Geographic, Datum: d, ToMeter: 1}
+}
+
+// NewGeocentric creates a geocentric CRS on the given datum.
+func NewGeocentric(d *Datum) *CRS {
+	return &CRS{Name: d.Name, Kind: Geocentric, Datum: d, ToMeter: 1}
+}
+
+// NewProjected creates a projected CRS on the given datum.
+func NewProjected(d *Datum, p Projection) *CRS {
+	return &CRS{Name: d.Name, Kind: Projected, Datum: d, Projection: p, ToMeter: 1}
+}
+
+// WithGeoid returns a copy of the CRS whose heights are orthometric heights
+// above the geoid. Transforming from it to the plain CRS lifts coordinates
+// to ellipsoidal heights. Geocentric coordinates have no height and ignore
+// the geoid.
+func (c *CRS) WithGeoid(g *Geoid) *CRS {
+	r := *c
+	r.Geoid = g
+	if g != nil {
+		r.Code = 0
+	}
+	return &r
+}
+
+// Parse creates a CRS from an "EPSG:<code>" reference, a PROJ string or a
+// WKT CRS definition.
+func Parse(def string) (*CRS, error) {
+	s := strings.TrimSpace(def)
+	switch {
+	case s == "":
+		return nil, errors.New("proj: empty CRS definition")
+	case strings.HasPrefix(s, "+"):
+		return ParseProjString(s)
+	case strings.ContainsAny(s, "[("):
+		return ParseWKT(s)
+	}
+	code, err := ParseEPSGCode(s)
+	if err != nil {
+		return nil, err
+	}
+	return FromEPSG(code)
+}
+
+// IsGeographic reports whether coordinates are longitude and latitude in degrees.
+func (c *CRS) IsGeographic() bool {
+	return c.Kind == Geographic
+}
+
+// ProjString formats the CRS as PROJ string.
+func (c *CRS) ProjString() string {
+	var b strings.Builder
+	switch c.Kind {
+	case Geographic:
+		b.WriteString("+proj=longlat")
+	case Geocentric:
+		b.WriteString("+proj=geocent")
+	case Projected:
+		b.WriteString(c.Projection.ProjString())
+	}
+	ell := c.Datum.Ellipsoid
+	if known, ok := LookupEllipsoid(ell.Name); ok && known.Equal(ell) {
+		fmt.Fprintf(&b, " +ellps=%s", ell.Name)
+	} else if ell.F == 0 {
+		fmt.Fprintf(&b, " +a=%s +b=%s", fmtFloat(ell.A), fmtFloat(ell.A))
+	} else {
+		fmt.Fprintf(&b, " +a=%s +rf=%s", fmtFloat(ell.A), fmtFloat(1/ell.F))
+	}
+	if !c.Datum.ToWGS84.IsIdentity() {
+		fmt.Fprintf(&b, " +towgs84=%s", c.Datum.ToWGS84.String())
+	}
+	if c.Kind == Projected && c.ToMeter != 1 {
+		fmt.Fprintf(&b, " +to_meter=%s", fmtFloat(c.ToMeter))
+	}
+	if c.Geoid != nil && c.Geoid.Name != "" {
+		fmt.Fprintf(&b, " +geoidgrids=%s", c.Geoid.Name)
+	}
+	b.WriteString(" +no_defs")
+	return b.String()
+}
+
+// String returns the EPSG reference of the CRS or its PROJ string.
+func (c *CRS) String() string {
+	if c.Code != 0 {
+		return fmt.Sprintf("EPSG:%d", c.Code)
+	}
+	return c.ProjString()
+}
+
+// toGeodetic converts coordinates of the CRS to geodetic coordinates on its datum.
+func (c *CRS) toGeodetic(x, y, z float64) (float64, float64, float64, error) {
+	switch c.Kind {
+	case Geocentric:
+		lon, lat, h := c.Datum.Ellipsoid.FromEcef(x, y, z)
+		return lon, lat, h, nil
+	case Projected:
+		lon, lat, err := c.Projection.Inverse(x*c.ToMeter, y*c.ToMeter)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		x, y = lon, lat
+	}
+	if c.Geoid != nil {
+		h, err := c.Geoid.ToEllipsoidal(x, y, z)
+		return x, y, h, err
+	}
+	return x, y, z, nil
+}
+
+// fromGeodetic converts geodetic coordinates on the datum to coordinates of the CRS.
+func (c *CRS) fromGeodetic(lon, lat, h float64) (float64, float64, float64, error) {
+	if c.Kind == Geocentric {
+		x, y, z := c.Datum.Ellipsoid.ToEcef(lon, lat, h)
+		return x, y, z, nil
+	}
+	if c.Geoid != nil {
+		var err error
+		if h, err = c.Geoid.ToOrthometric(lon, lat, h); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	switch c.Kind {
+	case Projected:
+		x, y, err := c.Projection.Forward(lon, lat)
+		return x / c.ToMeter, y / c.ToMeter, h, err
+	}
+	return lon, lat, h, nil
+}
+
+// Transformer converts coordinates between two coordinate reference systems.
+type Transformer struct {
+	Src *CRS
+	Dst *CRS
+
+	sameDatum bool
+}
+
+// NewTransformer creates a transformer from src to dst.
+func NewTransformer(src, dst *CRS) (*Transformer, error) {
+	if src == nil || dst == nil {
+		return nil, errors.New("proj: nil CRS")
+	}
+	if src.Datum == nil || dst.Datum == nil {
+		return nil, errors.New("proj: CRS without datum")
+	}
+	return &Transformer{Src: src, Dst: dst, sameDatum: src.Datum.Equal(dst.Datum)}, nil
+}
+
+// Transform converts a single coordinate.
+func (t *Transformer) Transform(x, y, z float64) (float64, float64, float64, error) {
+	lon, lat, h, err := t.Src.toGeodetic(x, y, z)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if !t.sameDatum {
+		lon, lat, h = t.Src.Datum.toWGS84(lon, lat, h)
+		lon, lat, h = t.Dst.Datum.fromWGS84(lon, lat, h)
+	}
+	x, y, z, err = t.Dst.fromGeodetic(lon, lat, h)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if math.IsNaN(x) || math.IsNaN(y) || math.IsNaN(z) {
+		return 0, 0, 0, ErrOutOfDomain
+	}
+	return x, y, z, nil
+}
+
+// Inverse converts a single coordinate from the destination to the source CRS.
+func (t *Transformer) Inverse(x, y, z float64) (float64, float64, float64, error) {
+	inv := Transformer{Src: t.Dst, Dst: t.Src, sameDatum: t.sameDatum}
+	return inv.Transform(x, y, z)
+}
+
+// Transform converts a single coordinate from src to dst.
+func Transform(src, dst *CRS, x, y, z float64) (float64, float64, float64, error) {
+	t, err := NewTransformer(src, dst)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return t.Transform(x, y, z)
+}
@@ -0,0 +1,278 @@
+package proj
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// HelmertConvention selects the sign convention of the Helmert rotations.
+type HelmertConvention int
+
+const (
+	// PositionVector is the convention used by PROJ's +towgs84 and EPSG method 9606.
+	PositionVector HelmertConvention = iota
+	// CoordinateFrame is the convention of EPSG method 9607, used by most Chinese
+	// survey documents. Its rotations have the opposite sign.
+	CoordinateFrame
+)
+
+// Helmert holds the parameters of a seven-parameter similarity transformation
+// between two geocentric frames.
+type Helmert struct {
+	Tx, Ty, Tz float64 // translations in metres
+	Rx, Ry, Rz float64 // rotations in arc-seconds
+	S          float64 // scale difference in parts per million
+	Convention HelmertConvention
+}
+
+// ParseTowgs84 parses a comma separated list of three or seven +towgs84 values.
+func ParseTowgs84(s string) (*Helmert, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 && len(parts) != 7 {
+		return nil, fmt.Errorf("proj: towgs84 needs 3 or 7 values, got %d", len(parts))
+	}
+	var v [7]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("proj: invalid towgs84 value %q", p)
+		}
+		v[i] = f
+	}
+	return &Helmert{Tx: v[0], Ty: v[1], Tz: v[2], Rx: v[3], Ry: v[4], Rz: v[5], S: v[6]}, nil
+}
+
+// IsIdentity reports whether the transformation leaves coordinates unchanged.
+func (h *Helmert) IsIdentity() bool {
+	return h == nil || (h.Tx == 0 && h.Ty == 0 && h.Tz == 0 && h.Rx == 0 && h.Ry == 0 && h.Rz == 0 && h.S == 0)
+}
+
+// IsTranslation reports whether the transformation has no rotation or scale.
+func (h *Helmert) IsTranslation() bool {
+	return h.Rx == 0 && h.Ry == 0 && h.Rz == 0 && h.S == 0
+}
+
+// String formats the parameters as a +towgs84 value in position vector convention.
+func (h *Helmert) String() string {
+	rx, ry, rz := h.Rx, h.Ry, h.Rz
+	if h.Convention == CoordinateFrame {
+		rx, ry, rz = -rx, -ry, -rz
+	}
+	v := []float64{h.Tx, h.Ty, h.Tz}
+	if !h.IsTranslation() {
+		v = append(v, rx, ry, rz, h.S)
+	}
+	s := make([]string, len(v))
+	for i, f := range v {
+		s[i] = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strings.Join(s, ",")
+}
+
+func (h *Helmert) matrix() [3][3]float64 {
+	rx, ry, rz := h.Rx*sec2rad, h.Ry*sec2rad, h.Rz*sec2rad
+	if h.Convention == CoordinateFrame {
+		rx, ry, rz = -rx, -ry, -rz
+	}
+	m := 1 + h.S*1e-6
+	return [3][3]float64{
+		{m, -rz * m, ry * m},
+		{rz * m, m, -rx * m},
+		{-ry * m, rx * m, m},
+	}
+}
+
+// Forward applies the transformation to a geocentric position.
+func (h *Helmert) Forward(x, y, z float64) (float64, float64, float64) {
+	r := h.matrix()
+	return h.Tx + r[0][0]*x + r[0][1]*y + r[0][2]*z,
+		h.Ty + r[1][0]*x + r[1][1]*y + r[1][2]*z,
+		h.Tz + r[2][0]*x + r[2][1]*y + r[2][2]*z
+}
+
+// Inverse applies the exact inverse of the transformation to a geocentric position.
+func (h *Helmert) Inverse(x, y, z float64) (float64, float64, float64) {
+	r := h.matrix()
+	x, y, z = x-h.Tx, y-h.Ty, z-h.Tz
+	return solve3(&r, x, y, z)
+}
+
+// solve3 solves m * v = (x, y, z) using Cramer's rule.
+func solve3(m *[3][3]float64, x, y, z float64) (float64, float64, float64) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	dx := x*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(y*m[2][2]-m[1][2]*z) +
+		m[0][2]*(y*m[2][1]-m[1][1]*z)
+	dy := m[0][0]*(y*m[2][2]-m[1][2]*z) -
+		x*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*z-y*m[2][0])
+	dz := m[0][0]*(m[1][1]*z-y*m[2][1]) -
+		m[0][1]*(m[1][0]*z-y*m[2][0]) +
+		x*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	return dx / det, dy / det, dz / det
+}
+
+// Molodensky shifts geodetic coordinates between two datums with the standard
+// Molodensky formulas. dx, dy and dz are the geocentric translations from the
+// source to the target datum.
+func Molodensky(lon, lat, h float64, from, to *Ellipsoid, dx, dy, dz float64) (float64, float64, float64) {
+	lam := lon * deg2rad
+	phi := lat * deg2rad
+	a := from.A
+	f := from.F
+	b := from.B()
+	e2 := from.E2()
+	da := to.A - a
+	df := to.F - f
+
+	sinPhi, cosPhi := math.Sincos(phi)
+	sinLam, cosLam := math.Sincos(lam)
+	w := 1 - e2*sinPhi*sinPhi
+	rn := a / math.Sqrt(w)
+	rm := a * (1 - e2) / (w * math.Sqrt(w))
+
+	dPhi := (-dx*sinPhi*cosLam - dy*sinPhi*sinLam + dz*cosPhi +
+		da*(rn*e2*sinPhi*cosPhi)/a +
+		df*(rm*a/b+rn*b/a)*sinPhi*cosPhi) / (rm + h)
+	dLam := (-dx*sinLam + dy*cosLam) / ((rn + h) * cosPhi)
+	dH := dx*cosPhi*cosLam + dy*cosPhi*sinLam + dz*sinPhi - da*a/rn + df*b/a*rn*sinPhi*sinPhi
+
+	return lon + dLam*rad2deg, lat + dPhi*rad2deg, h + dH
+}
+
+// AbridgedMolodensky shifts geodetic coordinates between two datums with the
+// abridged Molodensky formulas.
+func AbridgedMolodensky(lon, lat, h float64, from, to *Ellipsoid, dx, dy, dz float64) (float64, float64, float64) {
+	lam := lon * deg2rad
+	phi := lat * deg2rad
+	a := from.A
+	f := from.F
+	e2 := from.E2()
+	da := to.A - a
+	df := to.F - f
+
+	sinPhi, cosPhi := math.Sincos(phi)
+	sinLam, cosLam := math.Sincos(lam)
+	w := 1 - e2*sinPhi*sinPhi
+	rn := a / math.Sqrt(w)
+	rm := a * (1 - e2) / (w * math.Sqrt(w))
+
+	dPhi := (-dx*sinPhi*cosLam - dy*sinPhi*sinLam + dz*cosPhi + (a*df+f*da)*math.Sin(2*phi)) / rm
+	dLam := (-dx*sinLam + dy*cosLam) / (rn * cosPhi)
+	dH := dx*cosPhi*cosLam + dy*cosPhi*sinLam + dz*sinPhi + (a*df+f*da)*sinPhi*sinPhi - da
+
+	return lon + dLam*rad2deg, lat + dPhi*rad2deg, h + dH
+}
+
+// ShiftMethod selects how a datum is shifted to WGS84.
+type ShiftMethod int
+
+const (
+	// ShiftHelmert applies ToWGS84 as a geocentric Helmert transformation.
+	ShiftHelmert ShiftMethod = iota
+	// ShiftMolodensky applies the translations of ToWGS84 with the standard
+	// Molodensky formulas. Rotations and scale are ignored.
+	ShiftMolodensky
+	// ShiftAbridgedMolodensky is like ShiftMolodensky using the abridged formulas.
+	ShiftAbridgedMolodensky
+)
+
+// Datum is a geodetic datum: an ellipsoid and its relation to WGS84.
+type Datum struct {
+	Name      string
+	Ellipsoid *Ellipsoid
+	// ToWGS84 transforms geocentric coordinates of this datum to WGS84.
+	// A nil value means the datum is treated as coincident with WGS84.
+	ToWGS84 *Helmert
+	Method  ShiftMethod
+}
+
+var (
+	// WGS84 is the World Geodetic System 1984.
+	WGS84 = &Datum{Name: "WGS84", Ellipsoid: WGS84Ellipsoid}
+	// CGCS2000 is the China Geodetic Coordinate System 2000, which agrees with
+	// WGS84 at the centimetre level.
+	CGCS2000 = &Datum{Name: "CGCS2000", Ellipsoid: CGCS2000Ellipsoid}
+	// Beijing54 is the Beijing 1954 datum.
+	Beijing54 = &Datum{Name: "Beijing54", Ellipsoid: KrassowskyEllipsoid, ToWGS84: &Helmert{Tx: 15.8, Ty: -154.4, Tz: -82.3}}
+	// Xian80 is the Xian 1980 datum. No official WGS84 parameters exist, so
+	// projects are expected to supply their own with a +towgs84 definition.
+	Xian80 = &Datum{Name: "Xian80", Ellipsoid: IAG75Ellipsoid}
+	// NAD83 is the North American Datum 1983.
+	NAD83 = &Datum{Name: "NAD83", Ellipsoid: GRS80Ellipsoid}
+	// NAD27 is the North American Datum 1927.
+	NAD27 = &Datum{Name: "NAD27", Ellipsoid: Clarke1866Ellipsoid, ToWGS84: &Helmert{Tx: -8, Ty: 160, Tz: 176}}
+)
+
+var datums = map[string]*Datum{
+	"wgs84":     WGS84,
+	"cgcs2000":  CGCS2000,
+	"beijing54": Beijing54,
+	"xian80":    Xian80,
+	"nad83":     NAD83,
+	"nad27":     NAD27,
+}
+
+// LookupDatum returns a well known datum by its PROJ name.
+func LookupDatum(name string) (*Datum, bool) {
+	d, ok := datums[strings.ToLower(name)]
+	return d, ok
+}
+
+// Equal reports whether both datums describe the same frame.
+func (d *Datum) Equal(o *Datum) bool {
+	if d == o {
+		return true
+	}
+	if d == nil || o == nil || !d.Ellipsoid.Equal(o.Ellipsoid) {
+		return false
+	}
+	if d.ToWGS84.IsIdentity() || o.ToWGS84.IsIdentity() {
+		return d.ToWGS84.IsIdentity() && o.ToWGS84.IsIdentity()
+	}
+	return *d.ToWGS84 == *o.ToWGS84 && d.Method == o.Method
+}
+
+// toWGS84 converts geodetic coordinates of the datum to WGS84 geodetic coordinates.
+func (d *Datum) toWGS84(lon, lat, h float64) (float64, float64, float64) {
+	switch d.Method {
+	case ShiftMolodensky, ShiftAbridgedMolodensky:
+		var tx, ty, tz float64
+		if d.ToWGS84 != nil {
+			tx, ty, tz = d.ToWGS84.Tx, d.ToWGS84.Ty, d.ToWGS84.Tz
+		}
+		if d.Method == ShiftMolodensky {
+			return Molodensky(lon, lat, h, d.Ellipsoid, WGS84Ellipsoid, tx, ty, tz)
+		}
+		return AbridgedMolodensky(lon, lat, h, d.Ellipsoid, WGS84Ellipsoid, tx, ty, tz)
+	}
+	x, y, z := d.Ellipsoid.ToEcef(lon, lat, h)
+	if d.ToWGS84 != nil {
+		x, y, z = d.ToWGS84.Forward(x, y, z)
+	}
+	return WGS84Ellipsoid.FromEcef(x, y, z)
+}
+
+// fromWGS84 converts WGS84 geodetic coordinates to geodetic coordinates of the datum.
+func (d *Datum) fromWGS84(lon, lat, h float64) (float64, float64, float64) {
+	switch d.Method {
+	case ShiftMolodensky, ShiftAbridgedMolodensky:
+		var tx, ty, tz float64
+		if d.ToWGS84 != nil {
+			tx, ty, tz = d.ToWGS84.Tx, d.ToWGS84.Ty, d.ToWGS84.Tz
+		}
+		if d.Method == ShiftMolodensky {
+			return Molodensky(lon, lat, h, WGS84Ellipsoid, d.Ellipsoid, -tx, -ty, -tz)
+		}
+		return AbridgedMolodensky(lon, lat, h, WGS84Ellipsoid, d.Ellipsoid, -tx, -ty, -tz)
+	}
+	x, y, z := WGS84Ellipsoid.ToEcef(lon, lat, h)
+	if d.ToWGS84 != nil {
+		x, y, z = d.ToWGS84.Inverse(x, y, z)
+	}
+	return d.Ellipsoid.FromEcef(x, y, z)
+}
@@ -0,0 +1,156 @@
+// Package proj provides coordinate reference systems, map projections and
+// datum transformations for georeferencing meshes and vector data.
+//
+// Geographic coordinates are always expressed as (longitude, latitude, height)
+// in degrees and metres, geocentric coordinates as ECEF metres.
+package proj
+
+import (
+	"math"
+	"strings"
+
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec4"
+)
+
+const (
+	deg2rad = math.Pi / 180
+	rad2deg = 180 / math.Pi
+	// sec2rad converts arc-seconds to radians.
+	sec2rad = deg2rad / 3600
+)
+
+// Ellipsoid is a reference ellipsoid of revolution.
+type Ellipsoid struct {
+	Name string
+	A    float64 // semi-major axis in metres
+	F    float64 // flattening, zero for a sphere
+}
+
+var (
+	// WGS84Ellipsoid is the ellipsoid of the World Geodetic System 1984.
+	WGS84Ellipsoid = NewEllipsoid("WGS84", 6378137, 298.257223563)
+	// GRS80Ellipsoid is the Geodetic Reference System 1980 ellipsoid.
+	GRS80Ellipsoid = NewEllipsoid("GRS80", 6378137, 298.257222101)
+	// CGCS2000Ellipsoid is the ellipsoid of the China Geodetic Coordinate System 2000.
+	CGCS2000Ellipsoid = NewEllipsoid("CGCS2000", 6378137, 298.257222101)
+	// KrassowskyEllipsoid is the Krassowsky 1940 ellipsoid used by Beijing 1954.
+	KrassowskyEllipsoid = NewEllipsoid("krass", 6378245, 298.3)
+	// IAG75Ellipsoid is the IAG 1975 ellipsoid used by Xian 1980.
+	IAG75Ellipsoid = NewEllipsoid("IAG75", 6378140, 298.257)
+	// Clarke1866Ellipsoid is the Clarke 1866 ellipsoid used by NAD27.
+	Clarke1866Ellipsoid = NewEllipsoid("clrk66", 6378206.4, 294.9786982)
+	// InternationalEllipsoid is the International 1924 (Hayford) ellipsoid.
+	InternationalEllipsoid = NewEllipsoid("intl", 6378388, 297)
+	// BesselEllipsoid is the Bessel 1841 ellipsoid.
+	BesselEllipsoid = NewEllipsoid("bessel", 6377397.155, 299.1528128)
+)
+
+var ellipsoids = map[string]*Ellipsoid{
+	"wgs84":    WGS84Ellipsoid,
+	"grs80":    GRS80Ellipsoid,
+	"cgcs2000": CGCS2000Ellipsoid,
+	"krass":    KrassowskyEllipsoid,
+	"iag75":    IAG75Ellipsoid,
+	"iau76":    IAG75Ellipsoid,
+	"clrk66":   Clarke1866Ellipsoid,
+	"intl":     InternationalEllipsoid,
+	"bessel":   BesselEllipsoid,
+}
+
+// NewEllipsoid creates an ellipsoid from its semi-major axis and inverse
+// flattening. An inverse flattening of zero describes a sphere.
+func NewEllipsoid(name string, a, rf float64) *Ellipsoid {
+	e := &Ellipsoid{Name: name, A: a}
+	if rf != 0 {
+		e.F = 1 / rf
+	}
+	return e
+}
+
+// LookupEllipsoid returns a well known ellipsoid by its PROJ name.
+func LookupEllipsoid(name string) (*Ellipsoid, bool) {
+	e, ok := ellipsoids[strings.ToLower(name)]
+	return e, ok
+}
+
+// B returns the semi-minor axis.
+func (e *Ellipsoid) B() float64 {
+	return e.A * (1 - e.F)
+}
+
+// E2 returns the square of the first eccentricity.
+func (e *Ellipsoid) E2() float64 {
+	return e.F * (2 - e.F)
+}
+
+// Equal reports whether both ellipsoids have the same shape.
+func (e *Ellipsoid) Equal(o *Ellipsoid) bool {
+	return math.Abs(e.A-o.A) < 1e-4 && math.Abs(e.F-o.F) < 1e-12
+}
+
+// ToEcef converts geodetic coordinates in degrees and metres to ECEF.
+func (e *Ellipsoid) ToEcef(lon, lat, h float64) (x, y, z float64) {
+	lam := lon * deg2rad
+	phi := lat * deg2rad
+	e2 := e.E2()
+	sinPhi := math.Sin(phi)
+	cosPhi := math.Cos(phi)
+	n := e.A / math.Sqrt(1-e2*sinPhi*sinPhi)
+	x = (n + h) * cosPhi * math.Cos(lam)
+	y = (n + h) * cosPhi * math.Sin(lam)
+	z = (n*(1-e2) + h) * sinPhi
+	return x, y, z
+}
+
+// FromEcef converts ECEF coordinates to geodetic coordinates in degrees and metres.
+func (e *Ellipsoid) FromEcef(x, y, z float64) (lon, lat, h float64) {
+	e2 := e.E2()
+	p := math.Hypot(x, y)
+	lam := math.Atan2(y, x)
+	phi := math.Atan2(z, p*(1-e2))
+	var n float64
+	for i := 0; i < 10; i++ {
+		sinPhi := math.Sin(phi)
+		n = e.A / math.Sqrt(1-e2*sinPhi*sinPhi)
+		next := math.Atan2(z+e2*n*sinPhi, p)
+		if math.Abs(next-phi) < 1e-15 {
+			phi = next
+			break
+		}
+		phi = next
+	}
+	sinPhi := math.Sin(phi)
+	n = e.A / math.Sqrt(1-e2*sinPhi*sinPhi)
+	h = p*math.Cos(phi) + z*sinPhi - e.A*e.A/n
+	return lam * rad2deg, phi * rad2deg, h
+}
+
+// EnuToEcef returns the matrix that maps a local east, north, up frame
+// with its origin at the given geodetic position to ECEF.
+func (e *Ellipsoid) EnuToEcef(lon, lat, h float64) *mat4.Mat[float64] {
+	x, y, z := e.ToEcef(lon, lat, h)
+	sinLam, cosLam := math.Sincos(lon * deg2rad)
+	sinPhi, cosPhi := math.Sincos(lat * deg2rad)
+	return &mat4.Mat[float64]{
+		vec4.Vec[float64]{-sinLam, cosLam, 0, 0},
+		vec4.Vec[float64]{-sinPhi * cosLam, -sinPhi * sinLam, cosPhi, 0},
+		vec4.Vec[float64]{cosPhi * cosLam, cosPhi * sinLam, sinPhi, 0},
+		vec4.Vec[float64]{x, y, z, 1},
+	}
+}
+
+// Lonlat2Ecef converts WGS84 geodetic coordinates to ECEF.
+func Lonlat2Ecef(lon, lat, h float64) (x, y, z float64) {
+	return WGS84Ellipsoid.ToEcef(lon, lat, h)
+}
+
+// Ecef2Lonlat converts ECEF coordinates to WGS84 geodetic coordinates.
+func Ecef2Lonlat(x, y, z float64) (lon, lat, h float64) {
+	return WGS84Ellipsoid.FromEcef(x, y, z)
+}
+
+// Enu2Ecef returns the east, north, up frame at a WGS84 position.
+func Enu2Ecef(lon, lat, h float64) *mat4.Mat[float64] {
+	return WGS84Ellipsoid.EnuToEcef(lon, lat, h)
+}
@@ -0,0 +1,151 @@
+package proj
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	epsgMu   sync.RWMutex
+	epsgDefs = map[int]string{
+		4326: "+proj=longlat +datum=WGS84 +no_defs",
+		4978: "+proj=geocent +datum=WGS84 +units=m +no_defs",
+		3857: "+proj=webmerc +datum=WGS84 +units=m +no_defs",
+		3395: "+proj=merc +lon_0=0 +k=1 +x_0=0 +y_0=0 +datum=WGS84 +units=m +no_defs",
+		4490: "+proj=longlat +ellps=CGCS2000 +no_defs",
+		4479: "+proj=geocent +ellps=CGCS2000 +units=m +no_defs",
+		4214: "+proj=longlat +datum=Beijing54 +no_defs",
+		4610: "+proj=longlat +datum=Xian80 +no_defs",
+		4269: "+proj=longlat +datum=NAD83 +no_defs",
+		4267: "+proj=longlat +datum=NAD27 +no_defs",
+	}
+	epsgNames = map[int]string{
+		4326: "WGS 84",
+		4978: "WGS 84",
+		3857: "WGS 84 / Pseudo-Mercator",
+		3395: "WGS 84 / World Mercator",
+		4490: "China Geodetic Coordinate System 2000",
+		4479: "China Geodetic Coordinate System 2000",
+		4214: "Beijing 1954",
+		4610: "Xian 1980",
+		4269: "NAD83",
+		4267: "NAD27",
+	}
+)
+
+func init() {
+	for zone := 1; zone <= 60; zone++ {
+		epsgDefs[32600+zone] = fmt.Sprintf("+proj=utm +zone=%d +datum=WGS84 +units=m +no_defs", zone)
+		epsgNames[32600+zone] = fmt.Sprintf("WGS 84 / UTM zone %dN", zone)
+		epsgDefs[32700+zone] = fmt.Sprintf("+proj=utm +zone=%d +south +datum=WGS84 +units=m +no_defs", zone)
+		epsgNames[32700+zone] = fmt.Sprintf("WGS 84 / UTM zone %dS", zone)
+	}
+
+	// Gauss-Krüger zones of the Chinese national systems. Every system has
+	// 6° and 3° zones, each with and without the zone number prefixed to the
+	// false easting.
+	gk := []struct {
+		name  string
+		datum string
+		six   [2]int // first code of 6° zones 13-23 with prefix, and CM 75E-135E
+		three [2]int // first code of 3° zones 25-45 with prefix, and CM 75E-135E
+	}{
+		{"CGCS2000", "+ellps=CGCS2000", [2]int{4491, 4502}, [2]int{4513, 4534}},
+		{"Beijing 1954", "+datum=Beijing54", [2]int{21413, 21453}, [2]int{2401, 2422}},
+		{"Xian 1980", "+datum=Xian80", [2]int{2327, 2338}, [2]int{2349, 2370}},
+	}
+	tmpl := "+proj=tmerc +lat_0=0 +lon_0=%d +k=1 +x_0=%d +y_0=0 %s +units=m +no_defs"
+	for _, s := range gk {
+		for i := 0; i < 11; i++ {
+			zone := 13 + i
+			cm := zone*6 - 3
+			epsgDefs[s.six[0]+i] = fmt.Sprintf(tmpl, cm, zone*1000000+500000, s.datum)
+			epsgNames[s.six[0]+i] = fmt.Sprintf("%s / Gauss-Kruger zone %d", s.name, zone)
+			epsgDefs[s.six[1]+i] = fmt.Sprintf(tmpl, cm, 500000, s.datum)
+			epsgNames[s.six[1]+i] = fmt.Sprintf("%s / Gauss-Kruger CM %dE", s.name, cm)
+		}
+		for i := 0; i < 21; i++ {
+			zone := 25 + i
+			cm := zone * 3
+			epsgDefs[s.three[0]+i] = fmt.Sprintf(tmpl, cm, zone*1000000+500000, s.datum)
+			epsgNames[s.three[0]+i] = fmt.Sprintf("%s / 3-degree Gauss-Kruger zone %d", s.name, zone)
+			epsgDefs[s.three[1]+i] = fmt.Sprintf(tmpl, cm, 500000, s.datum)
+			epsgNames[s.three[1]+i] = fmt.Sprintf("%s / 3-degree Gauss-Kruger CM %dE", s.name, cm)
+		}
+	}
+}
+
+// RegisterEPSG adds or replaces the definition of an EPSG code. The
+// definition may be a PROJ string or WKT.
+func RegisterEPSG(code int, name, def string) error {
+	c, err := Parse(def)
+	if err != nil {
+		return err
+	}
+	if c.Code != 0 && c.Code != code {
+		return fmt.Errorf("proj: definition of EPSG:%d refers to EPSG:%d", code, c.Code)
+	}
+	epsgMu.Lock()
+	defer epsgMu.Unlock()
+	epsgDefs[code] = def
+	epsgNames[code] = name
+	return nil
+}
+
+// EPSGDefinition returns the definition registered for an EPSG code.
+func EPSGDefinition(code int) (string, bool) {
+	epsgMu.RLock()
+	defer epsgMu.RUnlock()
+	def, ok := epsgDefs[code]
+	return def, ok
+}
+
+// FromEPSG creates the CRS registered for an EPSG code.
+func FromEPSG(code int) (*CRS, error) {
+	epsgMu.RLock()
+	def, ok := epsgDefs[code]
+	name := epsgNames[code]
+	epsgMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("proj: unknown EPSG code %d", code)
+	}
+	c, err := Parse(def)
+	if err != nil {
+		return nil, err
+	}
+	c.Code = code
+	if name != "" {
+		c.Name = name
+	}
+	return c, nil
+}
+
+// ParseEPSGCode extracts the EPSG code from a CRS reference. It accepts
+// "EPSG:4326", "urn:ogc:def:crs:EPSG::4326",
+// "http://www.opengis.net/def/crs/EPSG/0/4326" and the aliases CRS:84 and OGC:CRS84.
+func ParseEPSGCode(s string) (int, error) {
+	u := strings.ToUpper(strings.TrimSpace(s))
+	switch u {
+	case "CRS:84", "OGC:CRS84", "URN:OGC:DEF:CRS:OGC:1.3:CRS84", "URN:OGC:DEF:CRS:OGC::CRS84",
+		"HTTP://WWW.OPENGIS.NET/DEF/CRS/OGC/1.3/CRS84":
+		return 4326, nil
+	}
+	var num string
+	switch {
+	case strings.HasPrefix(u, "EPSG:"):
+		num = u[len("EPSG:"):]
+	case strings.HasPrefix(u, "URN:OGC:DEF:CRS:EPSG:"):
+		num = u[strings.LastIndex(u, ":")+1:]
+	case strings.HasPrefix(u, "HTTP://WWW.OPENGIS.NET/DEF/CRS/EPSG/"):
+		num = u[strings.LastIndex(u, "/")+1:]
+	default:
+		num = u
+	}
+	code, err := strconv.Atoi(num)
+	if err != nil {
+		return 0, fmt.Errorf("proj: unrecognised CRS reference %q", s)
+	}
+	return code, nil
+}
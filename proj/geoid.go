@@ -0,0 +1,331 @@
+package proj
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Interpolation selects how a geoid grid is sampled between its nodes.
+type Interpolation int
+
+const (
+	// Bilinear interpolates between the four surrounding nodes.
+	Bilinear Interpolation = iota
+	// Bicubic fits a Catmull-Rom spline through the sixteen surrounding nodes.
+	Bicubic
+)
+
+// gtxNoData marks missing values in .gtx grids.
+const gtxNoData = -88.8888
+
+// Geoid is a regular grid of geoid undulations, the height of the geoid
+// above the ellipsoid in metres. Rows run from south to north and columns
+// from west to east. Orthometric heights H relate to ellipsoidal heights h
+// by h = H + N.
+type Geoid struct {
+	Name          string
+	Lat0, Lon0    float64 // south west node in degrees
+	DLat, DLon    float64 // node spacing in degrees
+	Rows, Cols    int
+	Data          []float32 // Rows*Cols undulations, NaN where the grid has no data
+	Interpolation Interpolation
+}
+
+// NewGeoid creates a geoid grid and checks its dimensions.
+func NewGeoid(name string, lat0, lon0, dlat, dlon float64, rows, cols int, data []float32) (*Geoid, error) {
+	if rows < 2 || cols < 2 || dlat <= 0 || dlon <= 0 {
+		return nil, fmt.Errorf("proj: invalid geoid grid %dx%d with spacing %g,%g", rows, cols, dlat, dlon)
+	}
+	if len(data) != rows*cols {
+		return nil, fmt.Errorf("proj: geoid grid expects %d values, got %d", rows*cols, len(data))
+	}
+	return &Geoid{Name: name, Lat0: lat0, Lon0: lon0, DLat: dlat, DLon: dlon, Rows: rows, Cols: cols, Data: data}, nil
+}
+
+// ReadGTX reads a grid in the NOAA .gtx format used by PROJ: a big endian
+// header of south west latitude and longitude, latitude and longitude
+// spacing, row and column count followed by float32 rows from the south.
+func ReadGTX(r io.Reader) (*Geoid, error) {
+	var hdr struct {
+		Lat0, Lon0, DLat, DLon float64
+		Rows, Cols             int32
+	}
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("proj: reading gtx header: %w", err)
+	}
+	if hdr.Rows < 2 || hdr.Cols < 2 || int64(hdr.Rows)*int64(hdr.Cols) > math.MaxInt32 {
+		return nil, fmt.Errorf("proj: invalid gtx size %dx%d", hdr.Rows, hdr.Cols)
+	}
+	data := make([]float32, int(hdr.Rows)*int(hdr.Cols))
+	if err := binary.Read(r, binary.BigEndian, data); err != nil {
+		return nil, fmt.Errorf("proj: reading gtx data: %w", err)
+	}
+	for i, v := range data {
+		if math.Abs(float64(v)-gtxNoData) < 1e-4 {
+			data[i] = float32(math.NaN())
+		}
+	}
+	return NewGeoid("", hdr.Lat0, hdr.Lon0, hdr.DLat, hdr.DLon, int(hdr.Rows), int(hdr.Cols), data)
+}
+
+// ReadPGM reads a global grid in the GeographicLib PGM format. The header
+// comments "# Offset" and "# Scale" convert the stored integers to metres;
+// rows run from 90 to -90 degrees and columns start at 0 degrees longitude.
+func ReadPGM(r io.Reader) (*Geoid, error) {
+	br := bufio.NewReader(r)
+	offset, scale := 0.0, 1.0
+	var fields []string
+	for len(fields) < 4 {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("proj: reading pgm header: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if c, ok := strings.CutPrefix(line, "#"); ok {
+			k, v, _ := strings.Cut(strings.TrimSpace(c), " ")
+			switch k {
+			case "Offset":
+				offset, err = strconv.ParseFloat(strings.TrimSpace(v), 64)
+			case "Scale":
+				scale, err = strconv.ParseFloat(strings.TrimSpace(v), 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("proj: invalid pgm %s %q", k, v)
+			}
+			continue
+		}
+		fields = append(fields, strings.Fields(line)...)
+	}
+	if fields[0] != "P5" {
+		return nil, fmt.Errorf("proj: unsupported pgm magic %q", fields[0])
+	}
+	var dims [3]int
+	for i := range dims {
+		v, err := strconv.Atoi(fields[i+1])
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("proj: invalid pgm header %q", strings.Join(fields, " "))
+		}
+		dims[i] = v
+	}
+	cols, rows, maxval := dims[0], dims[1], dims[2]
+	if rows < 2 || cols < 2 {
+		return nil, fmt.Errorf("proj: invalid pgm size %dx%d", cols, rows)
+	}
+
+	data := make([]float32, rows*cols)
+	var raw []byte
+	if maxval < 256 {
+		raw = make([]byte, cols)
+	} else {
+		raw = make([]byte, cols*2)
+	}
+	for row := 0; row < rows; row++ {
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return nil, fmt.Errorf("proj: reading pgm data: %w", err)
+		}
+		// store the rows from the south like gtx grids
+		dst := data[(rows-1-row)*cols : (rows-row)*cols]
+		for col := range dst {
+			var v uint16
+			if maxval < 256 {
+				v = uint16(raw[col])
+			} else {
+				v = binary.BigEndian.Uint16(raw[col*2:])
+			}
+			dst[col] = float32(offset + scale*float64(v))
+		}
+	}
+	return NewGeoid("", -90, 0, 180/float64(rows-1), 360/float64(cols), rows, cols, data)
+}
+
+// LoadGeoid reads a .gtx or GeographicLib .pgm geoid grid from a file.
+func LoadGeoid(path string) (*Geoid, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var g *Geoid
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gtx":
+		g, err = ReadGTX(f)
+	case ".pgm":
+		g, err = ReadPGM(f)
+	default:
+		return nil, fmt.Errorf("proj: unsupported geoid grid %q", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.Name = path
+	return g, nil
+}
+
+var (
+	geoidMu    sync.RWMutex
+	geoidGrids = make(map[string]*Geoid)
+)
+
+// RegisterGeoid makes a grid available to "+geoidgrids" under name.
+func RegisterGeoid(name string, g *Geoid) {
+	geoidMu.Lock()
+	defer geoidMu.Unlock()
+	geoidGrids[name] = g
+}
+
+// lookupGeoid returns a registered grid or loads and registers the file name.
+func lookupGeoid(name string) (*Geoid, error) {
+	geoidMu.RLock()
+	g, ok := geoidGrids[name]
+	geoidMu.RUnlock()
+	if ok {
+		return g, nil
+	}
+	g, err := LoadGeoid(name)
+	if err != nil {
+		return nil, err
+	}
+	RegisterGeoid(name, g)
+	return g, nil
+}
+
+// global reports whether the grid wraps around in longitude.
+func (g *Geoid) global() bool {
+	return float64(g.Cols)*g.DLon >= 360-1e-9
+}
+
+// period returns the columns of a turn, global grids may repeat the first
+// column at 360 degrees.
+func (g *Geoid) period() int {
+	return int(math.Round(360 / g.DLon))
+}
+
+func (g *Geoid) node(row, col int) float64 {
+	if row < 0 {
+		row = 0
+	} else if row >= g.Rows {
+		row = g.Rows - 1
+	}
+	if g.global() {
+		if p := g.period(); col < 0 || col >= g.Cols {
+			col = ((col % p) + p) % p
+		}
+	} else if col < 0 {
+		col = 0
+	} else if col >= g.Cols {
+		col = g.Cols - 1
+	}
+	return float64(g.Data[row*g.Cols+col])
+}
+
+// Undulation returns the geoid height above the ellipsoid at a position
+// given in degrees. ErrOutOfDomain is returned outside of the grid or where
+// the grid has no data.
+func (g *Geoid) Undulation(lon, lat float64) (float64, error) {
+	const eps = 1e-9
+	y := (lat - g.Lat0) / g.DLat
+	if y < -eps || y > float64(g.Rows-1)+eps {
+		return 0, ErrOutOfDomain
+	}
+	x := (lon - g.Lon0) / g.DLon
+	if g.global() {
+		p := float64(g.period())
+		x = math.Mod(x, p)
+		if x < 0 {
+			x += p
+		}
+	} else {
+		// grids may use 0..360 or -180..180 longitudes
+		turn := 360 / g.DLon
+		if x < -eps {
+			x += turn
+		} else if x > float64(g.Cols-1)+eps {
+			x -= turn
+		}
+		if x < -eps || x > float64(g.Cols-1)+eps {
+			return 0, ErrOutOfDomain
+		}
+	}
+	y = math.Max(0, math.Min(y, float64(g.Rows-1)))
+	if !g.global() {
+		x = math.Max(0, math.Min(x, float64(g.Cols-1)))
+	}
+
+	row, col := int(math.Floor(y)), int(math.Floor(x))
+	if row == g.Rows-1 {
+		row--
+	}
+	if !g.global() && col == g.Cols-1 {
+		col--
+	}
+	fy, fx := y-float64(row), x-float64(col)
+
+	var n float64
+	switch g.Interpolation {
+	case Bicubic:
+		var rows [4]float64
+		for i := range rows {
+			r := row - 1 + i
+			rows[i] = catmullRom(g.node(r, col-1), g.node(r, col), g.node(r, col+1), g.node(r, col+2), fx)
+		}
+		n = catmullRom(rows[0], rows[1], rows[2], rows[3], fy)
+	default:
+		n00, n01 := g.node(row, col), g.node(row, col+1)
+		n10, n11 := g.node(row+1, col), g.node(row+1, col+1)
+		n = (1-fy)*((1-fx)*n00+fx*n01) + fy*((1-fx)*n10+fx*n11)
+	}
+	if math.IsNaN(n) {
+		return 0, ErrOutOfDomain
+	}
+	return n, nil
+}
+
+func catmullRom(p0, p1, p2, p3, t float64) float64 {
+	return p1 + 0.5*t*(p2-p0+t*(2*p0-5*p1+4*p2-p3+t*(3*(p1-p2)+p3-p0)))
+}
+
+// ToEllipsoidal converts an orthometric height to an ellipsoidal height.
+func (g *Geoid) ToEllipsoidal(lon, lat, height float64) (float64, error) {
+	n, err := g.Undulation(lon, lat)
+	if err != nil {
+		return 0, err
+	}
+	return height + n, nil
+}
+
+// ToOrthometric converts an ellipsoidal height to an orthometric height.
+func (g *Geoid) ToOrthometric(lon, lat, height float64) (float64, error) {
+	n, err := g.Undulation(lon, lat)
+	if err != nil {
+		return 0, err
+	}
+	return height - n, nil
+}
+
+// parseGeoidGrids resolves a "+geoidgrids" list. Grids prefixed with '@'
+// are optional; the first grid that can be loaded is used.
+func parseGeoidGrids(v string) (*Geoid, error) {
+	for _, name := range strings.Split(v, ",") {
+		optional := strings.HasPrefix(name, "@")
+		name = strings.TrimPrefix(name, "@")
+		if name == "" || name == "null" {
+			continue
+		}
+		g, err := lookupGeoid(name)
+		if err == nil {
+			return g, nil
+		}
+		if !optional {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
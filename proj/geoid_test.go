@@ -0,0 +1,190 @@
+package proj
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/mst"
+)
+
+// planeUndulation is the field sampled by the synthetic test grids.
+func planeUndulation(lon, lat float64) float64 {
+	return -30 + 0.5*lon - 0.25*lat
+}
+
+func writeTestGTX(t *testing.T, lat0, lon0, d float64, rows, cols int) []byte {
+	var buf bytes.Buffer
+	assert.Nil(t, binary.Write(&buf, binary.BigEndian, []float64{lat0, lon0, d, d}))
+	assert.Nil(t, binary.Write(&buf, binary.BigEndian, []int32{int32(rows), int32(cols)}))
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			v := float32(planeUndulation(lon0+float64(c)*d, lat0+float64(r)*d))
+			if r == rows-1 && c == cols-1 {
+				v = gtxNoData
+			}
+			assert.Nil(t, binary.Write(&buf, binary.BigEndian, v))
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestReadGTX(t *testing.T) {
+	g, err := ReadGTX(bytes.NewReader(writeTestGTX(t, 30, 110, 0.5, 11, 21)))
+	assert.Nil(t, err)
+	assert.Equal(t, 11, g.Rows)
+	assert.Equal(t, 21, g.Cols)
+
+	for _, interp := range []Interpolation{Bilinear, Bicubic} {
+		g.Interpolation = interp
+		for _, p := range [][2]float64{{110, 30}, {112.25, 31.75}, {114.1, 33.3}, {115.5, 34.5}} {
+			n, err := g.Undulation(p[0], p[1])
+			assert.Nil(t, err)
+			assert.InDelta(t, planeUndulation(p[0], p[1]), n, 1e-5, "%v", p)
+		}
+	}
+
+	_, err = g.Undulation(109, 31)
+	assert.ErrorIs(t, err, ErrOutOfDomain)
+	_, err = g.Undulation(112, 36)
+	assert.ErrorIs(t, err, ErrOutOfDomain)
+	// the north east node has no data
+	_, err = g.Undulation(119.9, 34.9)
+	assert.ErrorIs(t, err, ErrOutOfDomain)
+
+	_, err = ReadGTX(bytes.NewReader([]byte{1, 2, 3}))
+	assert.NotNil(t, err)
+}
+
+func TestGTXLongitudeWrap(t *testing.T) {
+	// grids in 0..360 longitudes accept negative longitudes
+	g, err := ReadGTX(bytes.NewReader(writeTestGTX(t, 0, 350, 1, 5, 9)))
+	assert.Nil(t, err)
+	n, err := g.Undulation(-8, 2)
+	assert.Nil(t, err)
+	assert.InDelta(t, planeUndulation(352, 2), n, 1e-5)
+}
+
+func TestGTXRepeatedColumn(t *testing.T) {
+	// a global 1 degree grid repeating its first column at 360
+	wave := func(lon float64) float64 { return 100 * math.Sin(lon*math.Pi/18) }
+	var buf bytes.Buffer
+	assert.Nil(t, binary.Write(&buf, binary.BigEndian, []float64{-1, 0, 1, 1}))
+	assert.Nil(t, binary.Write(&buf, binary.BigEndian, []int32{3, 361}))
+	for r := 0; r < 3; r++ {
+		for c := 0; c <= 360; c++ {
+			assert.Nil(t, binary.Write(&buf, binary.BigEndian, float32(wave(float64(c)))))
+		}
+	}
+	g, err := ReadGTX(&buf)
+	assert.Nil(t, err)
+	for _, interp := range []Interpolation{Bilinear, Bicubic} {
+		g.Interpolation = interp
+		for _, lon := range []float64{-10, -0.5, 0, 359.5, 360, 370} {
+			n, err := g.Undulation(lon, 0)
+			assert.Nil(t, err)
+			assert.InDelta(t, wave(lon), n, 1.5, "%v", lon)
+		}
+		n, err := g.Undulation(-10, 0)
+		assert.Nil(t, err)
+		assert.InDelta(t, wave(350), n, 1e-4)
+	}
+}
+
+func TestReadPGM(t *testing.T) {
+	const rows, cols = 7, 12 // 30 degree spacing
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "P5\n# Geoid file in PGM format for the GeographicLib::Geoid class\n# Offset -108\n# Scale 0.003\n%d %d\n65535\n", cols, rows)
+	raw := func(lat, lon float64) uint16 {
+		return uint16(math.Round((10 + 0.1*lat + 0.2*math.Mod(lon, 360) + 108) / 0.003))
+	}
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			assert.Nil(t, binary.Write(&buf, binary.BigEndian, raw(90-float64(r)*30, float64(c)*30)))
+		}
+	}
+	g, err := ReadPGM(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, -90.0, g.Lat0)
+	assert.Equal(t, 30.0, g.DLat)
+	assert.Equal(t, 30.0, g.DLon)
+
+	n, err := g.Undulation(60, 30)
+	assert.Nil(t, err)
+	assert.InDelta(t, 10+3+12, n, 0.002)
+	n, err = g.Undulation(-30, -60)
+	assert.Nil(t, err)
+	assert.InDelta(t, 10-6+66, n, 0.002)
+	n, err = g.Undulation(45, 45)
+	assert.Nil(t, err)
+	assert.InDelta(t, 10+4.5+9, n, 0.002)
+	_, err = g.Undulation(0, 90)
+	assert.Nil(t, err)
+}
+
+func TestGeoidHeights(t *testing.T) {
+	data := writeTestGTX(t, 30, 110, 0.5, 11, 21)
+	path := filepath.Join(t.TempDir(), "plane.gtx")
+	assert.Nil(t, os.WriteFile(path, data, 0644))
+
+	g, err := LoadGeoid(path)
+	assert.Nil(t, err)
+	assert.Equal(t, path, g.Name)
+
+	n := planeUndulation(116, 32)
+	h, err := g.ToEllipsoidal(116, 32, 100)
+	assert.Nil(t, err)
+	assert.InDelta(t, 100+n, h, 1e-5)
+	H, err := g.ToOrthometric(116, 32, h)
+	assert.Nil(t, err)
+	assert.InDelta(t, 100, H, 1e-9)
+
+	ortho, err := ParseProjString("+proj=longlat +datum=WGS84 +geoidgrids=" + path)
+	assert.Nil(t, err)
+	assert.NotNil(t, ortho.Geoid)
+	assert.Contains(t, ortho.ProjString(), "+geoidgrids="+path)
+
+	_, err = ParseProjString("+proj=longlat +datum=WGS84 +geoidgrids=missing.gtx")
+	assert.NotNil(t, err)
+	opt, err := ParseProjString("+proj=longlat +datum=WGS84 +geoidgrids=@missing.gtx")
+	assert.Nil(t, err)
+	assert.Nil(t, opt.Geoid)
+
+	lonlat, err := FromEPSG(4326)
+	assert.Nil(t, err)
+	x, y, z, err := Transform(ortho, lonlat, 116, 32, 100)
+	assert.Nil(t, err)
+	assert.InDelta(t, 116, x, 1e-12)
+	assert.InDelta(t, 32, y, 1e-12)
+	assert.InDelta(t, 100+n, z, 1e-5)
+
+	_, _, z, err = Transform(lonlat, ortho, 116, 32, 100+n)
+	assert.Nil(t, err)
+	assert.InDelta(t, 100, z, 1e-5)
+}
+
+func TestTransformMeshWithGeoid(t *testing.T) {
+	g, err := ReadGTX(bytes.NewReader(writeTestGTX(t, 30, 110, 0.5, 11, 21)))
+	assert.Nil(t, err)
+	g.Interpolation = Bicubic
+	lonlat, err := FromEPSG(4326)
+	assert.Nil(t, err)
+	ecef, err := FromEPSG(4978)
+	assert.Nil(t, err)
+
+	ms := mst.NewMesh[float64]()
+	ms.Nodes = append(ms.Nodes, &mst.MeshNode[float64]{Vertices: []vec3.Vec[float64]{{116, 32, 50}, {116.01, 32.01, 60}}})
+	assert.Nil(t, TransformMesh(ms, lonlat.WithGeoid(g), ecef))
+	for i, v := range []vec3.Vec[float64]{{116, 32, 50}, {116.01, 32.01, 60}} {
+		x, y, z := Lonlat2Ecef(v[0], v[1], v[2]+planeUndulation(v[0], v[1]))
+		assert.InDelta(t, x, ms.Nodes[0].Vertices[i][0], 1e-4)
+		assert.InDelta(t, y, ms.Nodes[0].Vertices[i][1], 1e-4)
+		assert.InDelta(t, z, ms.Nodes[0].Vertices[i][2], 1e-4)
+	}
+}
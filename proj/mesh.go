@@ -0,0 +1,182 @@
+package proj
+
+import (
+	"math"
+
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/go3d/vec4"
+	"pinkey.ltd/xr/mst"
+)
+
+// TransformMesh converts all vertices of the mesh from one CRS to another.
+//
+// Computations are done in float64. Node matrices are baked into the vertices
+// before the conversion since a non-linear transformation cannot be expressed
+// as a matrix. Normals are rotated with the local Jacobian of the
+// transformation at the node centre. Instance transforms keep their local
+// geometry: the translation is converted exactly and the rotation and scale
+// columns are carried through the Jacobian at the instance origin.
+func TransformMesh[T float64 | float32](ms *mst.Mesh[T], from, to *CRS) error {
+	t, err := NewTransformer(from, to)
+	if err != nil {
+		return err
+	}
+	for _, nd := range ms.Nodes {
+		if err := transformNode(t, nd); err != nil {
+			return err
+		}
+	}
+	for _, inst := range ms.InstanceNode {
+		for i, mt := range inst.Transfors {
+			m, err := transformMatrix(t, toFloat64Mat(mt))
+			if err != nil {
+				return err
+			}
+			inst.Transfors[i] = fromFloat64Mat[T](m)
+		}
+		if inst.BBox != nil {
+			bx, err := transformBox(t, inst.BBox)
+			if err != nil {
+				return err
+			}
+			inst.BBox = bx
+		}
+	}
+	return nil
+}
+
+func transformNode[T float64 | float32](t *Transformer, nd *mst.MeshNode[T]) error {
+	var world *mat4.Mat[float64]
+	if nd.Mat != nil {
+		world = toFloat64Mat(nd.Mat)
+	}
+	center := vec3.Vec[float64]{}
+	for i := range nd.Vertices {
+		v := vec3.Vec[float64]{float64(nd.Vertices[i][0]), float64(nd.Vertices[i][1]), float64(nd.Vertices[i][2])}
+		if world != nil {
+			world.TransformVec3(&v)
+		}
+		center.Add(&v)
+		x, y, z, err := t.Transform(v[0], v[1], v[2])
+		if err != nil {
+			return err
+		}
+		nd.Vertices[i] = vec3.Vec[T]{T(x), T(y), T(z)}
+	}
+	if len(nd.Vertices) > 0 && len(nd.Normals) > 0 {
+		center.Scale(1 / float64(len(nd.Vertices)))
+		j, err := jacobian(t, &center)
+		if err != nil {
+			return err
+		}
+		if world != nil {
+			lin := *world
+			lin[3] = vec4.Vec[float64]{0, 0, 0, 1}
+			j = mat4.AssignMul(j, &lin)
+		}
+		nm := normalMatrix(j)
+		for i := range nd.Normals {
+			n := vec3.Vec[float64]{float64(nd.Normals[i][0]), float64(nd.Normals[i][1]), float64(nd.Normals[i][2])}
+			nm.TransformVec3W(&n, 0)
+			n.Normalize()
+			nd.Normals[i] = vec3.Vec[T]{T(n[0]), T(n[1]), T(n[2])}
+		}
+	}
+	nd.Mat = nil
+	return nil
+}
+
+// normalMatrix returns the inverse transpose of the linear part of m.
+func normalMatrix(m *mat4.Mat[float64]) *mat4.Mat[float64] {
+	r := *m
+	r[3] = vec4.Vec[float64]{0, 0, 0, 1}
+	r.Invert()
+	r.Transpose()
+	return &r
+}
+
+// jacobian estimates the derivative of the transformation at p with central
+// differences. The step is chosen for the unit of the source CRS.
+func jacobian(t *Transformer, p *vec3.Vec[float64]) (*mat4.Mat[float64], error) {
+	step := 0.01
+	if t.Src.IsGeographic() {
+		step = 1e-7
+	}
+	j := &mat4.Mat[float64]{
+		vec4.Vec[float64]{1, 0, 0, 0},
+		vec4.Vec[float64]{0, 1, 0, 0},
+		vec4.Vec[float64]{0, 0, 1, 0},
+		vec4.Vec[float64]{0, 0, 0, 1},
+	}
+	for axis := 0; axis < 3; axis++ {
+		h := step
+		if axis == 2 {
+			// heights are always metres
+			h = 0.01
+		}
+		a, b := *p, *p
+		a[axis] += h
+		b[axis] -= h
+		ax, ay, az, err := t.Transform(a[0], a[1], a[2])
+		if err != nil {
+			return nil, err
+		}
+		bx, by, bz, err := t.Transform(b[0], b[1], b[2])
+		if err != nil {
+			return nil, err
+		}
+		j[axis] = vec4.Vec[float64]{(ax - bx) / (2 * h), (ay - by) / (2 * h), (az - bz) / (2 * h), 0}
+	}
+	return j, nil
+}
+
+func transformMatrix(t *Transformer, m *mat4.Mat[float64]) (*mat4.Mat[float64], error) {
+	origin := vec3.Vec[float64]{m[3][0], m[3][1], m[3][2]}
+	j, err := jacobian(t, &origin)
+	if err != nil {
+		return nil, err
+	}
+	x, y, z, err := t.Transform(origin[0], origin[1], origin[2])
+	if err != nil {
+		return nil, err
+	}
+	lin := *m
+	lin[3] = vec4.Vec[float64]{0, 0, 0, 1}
+	res := mat4.AssignMul(j, &lin)
+	res[3] = vec4.Vec[float64]{x, y, z, 1}
+	return res, nil
+}
+
+func transformBox(t *Transformer, bx *[6]float64) (*[6]float64, error) {
+	res := &[6]float64{math.MaxFloat64, math.MaxFloat64, math.MaxFloat64, -math.MaxFloat64, -math.MaxFloat64, -math.MaxFloat64}
+	for i := 0; i < 8; i++ {
+		x, y, z, err := t.Transform(bx[(i&1)*3], bx[1+(i>>1&1)*3], bx[2+(i>>2&1)*3])
+		if err != nil {
+			return nil, err
+		}
+		res[0], res[1], res[2] = math.Min(res[0], x), math.Min(res[1], y), math.Min(res[2], z)
+		res[3], res[4], res[5] = math.Max(res[3], x), math.Max(res[4], y), math.Max(res[5], z)
+	}
+	return res, nil
+}
+
+func toFloat64Mat[T float64 | float32](m *mat4.Mat[T]) *mat4.Mat[float64] {
+	var r mat4.Mat[float64]
+	for c := 0; c < 4; c++ {
+		for k := 0; k < 4; k++ {
+			r[c][k] = float64(m[c][k])
+		}
+	}
+	return &r
+}
+
+func fromFloat64Mat[T float64 | float32](m *mat4.Mat[float64]) *mat4.Mat[T] {
+	var r mat4.Mat[T]
+	for c := 0; c < 4; c++ {
+		for k := 0; k < 4; k++ {
+			r[c][k] = T(m[c][k])
+		}
+	}
+	return &r
+}
@@ -0,0 +1,327 @@
+package proj
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/mat4"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/go3d/vec4"
+	"pinkey.ltd/xr/mst"
+)
+
+func TestEcefRoundTrip(t *testing.T) {
+	tests := []struct {
+		name          string
+		lon, lat, alt float64
+	}{
+		{"Beijing", 116.391, 39.907, 50},
+		{"Equator", 0, 0, 0},
+		{"SouthPole", -45, -89.9999, 2800},
+		{"Deep", 120, 30, -5000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, y, z := Lonlat2Ecef(tt.lon, tt.lat, tt.alt)
+			lon, lat, alt := Ecef2Lonlat(x, y, z)
+			assert.InDelta(t, tt.lon, lon, 1e-10)
+			assert.InDelta(t, tt.lat, lat, 1e-10)
+			assert.InDelta(t, tt.alt, alt, 1e-6)
+		})
+	}
+
+	x, y, z := Lonlat2Ecef(0, 0, 0)
+	assert.InDelta(t, 6378137, x, 1e-9)
+	assert.InDelta(t, 0, y, 1e-9)
+	assert.InDelta(t, 0, z, 1e-9)
+}
+
+func TestProjections(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int
+		lon, lat float64
+		x, y     float64
+	}{
+		{"UTM32N", 32632, 12, 55, 691875.632, 6098907.825},
+		{"WebMercator", 3857, 180, 0, 20037508.342789244, 0},
+		{"GaussKrugerCM", 4548, 117, 0, 500000, 0},
+		{"GaussKrugerZone", 4527, 117, 0, 39500000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crs, err := FromEPSG(tt.code)
+			assert.Nil(t, err)
+			x, y, err := crs.Projection.Forward(tt.lon, tt.lat)
+			assert.Nil(t, err)
+			assert.InDelta(t, tt.x, x, 1e-3)
+			assert.InDelta(t, tt.y, y, 1e-3)
+			lon, lat, err := crs.Projection.Inverse(x, y)
+			assert.Nil(t, err)
+			assert.InDelta(t, tt.lon, lon, 1e-9)
+			assert.InDelta(t, tt.lat, lat, 1e-9)
+		})
+	}
+}
+
+func TestTransverseMercatorRoundTrip(t *testing.T) {
+	tm := NewTransverseMercator(CGCS2000Ellipsoid, 117, 0, 1, 500000, 0)
+	for lat := -80.0; lat <= 80; lat += 10 {
+		for dl := -3.0; dl <= 3; dl += 1.5 {
+			x, y, err := tm.Forward(117+dl, lat)
+			assert.Nil(t, err)
+			lon, la, err := tm.Inverse(x, y)
+			assert.Nil(t, err)
+			assert.InDelta(t, 117+dl, lon, 1e-10)
+			assert.InDelta(t, lat, la, 1e-10)
+		}
+	}
+	_, _, err := tm.Forward(-63, 30)
+	assert.Equal(t, ErrOutOfDomain, err)
+}
+
+func TestHelmert(t *testing.T) {
+	h := &Helmert{Tx: -24, Ty: 123, Tz: 94, Rx: 0.02, Ry: -0.25, Rz: -0.13, S: 1.1}
+	x, y, z := Lonlat2Ecef(116, 40, 100)
+	fx, fy, fz := h.Forward(x, y, z)
+	assert.NotEqual(t, x, fx)
+	ix, iy, iz := h.Inverse(fx, fy, fz)
+	assert.InDelta(t, x, ix, 1e-6)
+	assert.InDelta(t, y, iy, 1e-6)
+	assert.InDelta(t, z, iz, 1e-6)
+
+	cf := *h
+	cf.Convention = CoordinateFrame
+	cf.Rx, cf.Ry, cf.Rz = -h.Rx, -h.Ry, -h.Rz
+	cx, cy, cz := cf.Forward(x, y, z)
+	assert.InDelta(t, fx, cx, 1e-9)
+	assert.InDelta(t, fy, cy, 1e-9)
+	assert.InDelta(t, fz, cz, 1e-9)
+	assert.Equal(t, h.String(), cf.String())
+
+	p, err := ParseTowgs84(h.String())
+	assert.Nil(t, err)
+	assert.Equal(t, *h, *p)
+	_, err = ParseTowgs84("1,2")
+	assert.NotNil(t, err)
+}
+
+func TestMolodensky(t *testing.T) {
+	tx, ty, tz := 15.8, -154.4, -82.3
+	lon, lat, h := 116.0, 40.0, 50.0
+
+	// reference: geocentric translation through ECEF
+	x, y, z := KrassowskyEllipsoid.ToEcef(lon, lat, h)
+	rlon, rlat, rh := WGS84Ellipsoid.FromEcef(x+tx, y+ty, z+tz)
+
+	mlon, mlat, mh := Molodensky(lon, lat, h, KrassowskyEllipsoid, WGS84Ellipsoid, tx, ty, tz)
+	assert.InDelta(t, rlon, mlon, 1e-7)
+	assert.InDelta(t, rlat, mlat, 1e-7)
+	assert.InDelta(t, rh, mh, 0.1)
+
+	alon, alat, ah := AbridgedMolodensky(lon, lat, h, KrassowskyEllipsoid, WGS84Ellipsoid, tx, ty, tz)
+	assert.InDelta(t, rlon, alon, 1e-5)
+	assert.InDelta(t, rlat, alat, 1e-5)
+	assert.InDelta(t, rh, ah, 1)
+
+	d := *Beijing54
+	d.Method = ShiftMolodensky
+	src := NewGeographic(&d)
+	dst, _ := FromEPSG(4326)
+	wlon, wlat, _, err := Transform(src, dst, lon, lat, h)
+	assert.Nil(t, err)
+	assert.InDelta(t, rlon, wlon, 1e-7)
+	assert.InDelta(t, rlat, wlat, 1e-7)
+}
+
+func TestDatumTransform(t *testing.T) {
+	bj, err := FromEPSG(2436) // Beijing 1954 / 3-degree Gauss-Kruger CM 117E
+	assert.Nil(t, err)
+	assert.Equal(t, "Beijing 1954 / 3-degree Gauss-Kruger CM 117E", bj.Name)
+	cg, err := Parse("EPSG:4548")
+	assert.Nil(t, err)
+
+	tr, err := NewTransformer(bj, cg)
+	assert.Nil(t, err)
+	x, y, z, err := tr.Transform(500000, 4427757, 50)
+	assert.Nil(t, err)
+	// the datum shift moves points by tens of metres
+	d := math.Hypot(x-500000, y-4427757)
+	assert.Greater(t, d, 10.0)
+	assert.Less(t, d, 200.0)
+
+	bx, by, bz, err := tr.Inverse(x, y, z)
+	assert.Nil(t, err)
+	assert.InDelta(t, 500000, bx, 1e-6)
+	assert.InDelta(t, 4427757, by, 1e-6)
+	assert.InDelta(t, 50, bz, 1e-6)
+
+	same, _ := NewTransformer(cg, cg)
+	x, y, z, _ = same.Transform(1, 2, 3)
+	assert.InDelta(t, 1, x, 1e-6)
+	assert.InDelta(t, 2, y, 1e-6)
+	assert.Equal(t, 3.0, z)
+}
+
+func TestParseProjString(t *testing.T) {
+	c, err := ParseProjString("+proj=tmerc +lat_0=0 +lon_0=114 +k=1 +x_0=38500000 +y_0=0 +a=6378140 +b=6356755.288157528 +towgs84=-24,123,94,0.02,-0.25,-0.13,1.1 +units=m +no_defs")
+	assert.Nil(t, err)
+	assert.Equal(t, Projected, c.Kind)
+	assert.InDelta(t, 298.257, 1/c.Datum.Ellipsoid.F, 1e-6)
+	assert.Equal(t, -24.0, c.Datum.ToWGS84.Tx)
+	assert.Equal(t, 1.1, c.Datum.ToWGS84.S)
+
+	r, err := ParseProjString(c.ProjString())
+	assert.Nil(t, err)
+	x1, y1, _ := r.Projection.Forward(114.5, 30)
+	x2, y2, _ := c.Projection.Forward(114.5, 30)
+	assert.InDelta(t, x2, x1, 1e-6)
+	assert.InDelta(t, y2, y1, 1e-6)
+
+	c, err = ParseProjString("+proj=merc +a=6378137 +b=6378137 +lat_ts=0 +lon_0=0 +x_0=0 +y_0=0 +k=1 +units=m +nadgrids=@null +wktext +no_defs")
+	assert.Nil(t, err)
+	x, _, _ := c.Projection.Forward(180, 0)
+	assert.InDelta(t, 20037508.342789244, x, 1e-6)
+	assert.True(t, c.Datum.Equal(WGS84))
+
+	c, err = ParseProjString("+proj=utm +zone=50 +south +ellps=WGS84 +units=us-ft")
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.3048006, c.ToMeter, 1e-7)
+
+	for _, bad := range []string{"+proj=lcc +lat_1=30", "+proj=utm +zone=61", "+ellps=WGS84", "+proj=tmerc +k=x", "+proj=longlat +ellps=foo"} {
+		_, err := ParseProjString(bad)
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestParseWKT(t *testing.T) {
+	wkt1 := `PROJCS["CGCS2000 / 3-degree Gauss-Kruger CM 117E",GEOGCS["China Geodetic Coordinate System 2000",DATUM["China_2000",SPHEROID["CGCS2000",6378137,298.257222101,AUTHORITY["EPSG","1024"]],AUTHORITY["EPSG","1043"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AUTHORITY["EPSG","4490"]],PROJECTION["Transverse_Mercator"],PARAMETER["latitude_of_origin",0],PARAMETER["central_meridian",117],PARAMETER["scale_factor",1],PARAMETER["false_easting",500000],PARAMETER["false_northing",0],UNIT["metre",1,AUTHORITY["EPSG","9001"]],AUTHORITY["EPSG","4548"]]`
+	c, err := ParseWKT(wkt1)
+	assert.Nil(t, err)
+	assert.Equal(t, 4548, c.Code)
+	assert.Equal(t, "CGCS2000", c.Datum.Ellipsoid.Name)
+	tm := c.Projection.(*TransverseMercator)
+	assert.Equal(t, 117.0, tm.CentralMeridian)
+	assert.Equal(t, 500000.0, tm.FalseEasting)
+
+	wkt2 := `PROJCRS["Beijing 1954 / 3-degree Gauss-Kruger CM 117E",
+    BASEGEOGCRS["Beijing 1954",
+        DATUM["Beijing 1954",
+            ELLIPSOID["Krassowsky 1940",6378245,298.3,LENGTHUNIT["metre",1]]],
+        PRIMEM["Greenwich",0,ANGLEUNIT["degree",0.0174532925199433]],
+        ID["EPSG",4214]],
+    CONVERSION["3-degree Gauss-Kruger CM 117E",
+        METHOD["Transverse Mercator",ID["EPSG",9807]],
+        PARAMETER["Latitude of natural origin",0,ANGLEUNIT["degree",0.0174532925199433]],
+        PARAMETER["Longitude of natural origin",117,ANGLEUNIT["degree",0.0174532925199433]],
+        PARAMETER["Scale factor at natural origin",1,SCALEUNIT["unity",1]],
+        PARAMETER["False easting",500000,LENGTHUNIT["metre",1]],
+        PARAMETER["False northing",0,LENGTHUNIT["metre",1]]],
+    CS[Cartesian,2],
+        AXIS["northing (X)",north,ORDER[1],LENGTHUNIT["metre",1]],
+        AXIS["easting (Y)",east,ORDER[2],LENGTHUNIT["metre",1]],
+    ID["EPSG",2436]]`
+	c, err = ParseWKT(wkt2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2436, c.Code)
+	assert.Equal(t, "krass", c.Datum.Ellipsoid.Name)
+	assert.Equal(t, 15.8, c.Datum.ToWGS84.Tx)
+	tm = c.Projection.(*TransverseMercator)
+	assert.InDelta(t, 117.0, tm.CentralMeridian, 1e-12)
+
+	reg, _ := FromEPSG(2436)
+	x1, y1, _ := c.Projection.Forward(117.3, 40)
+	x2, y2, _ := reg.Projection.Forward(117.3, 40)
+	assert.InDelta(t, x2, x1, 1e-6)
+	assert.InDelta(t, y2, y1, 1e-6)
+
+	geoc, err := Parse(`GEOCCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563]],PRIMEM["Greenwich",0],UNIT["metre",1],AUTHORITY["EPSG","4978"]]`)
+	assert.Nil(t, err)
+	assert.Equal(t, Geocentric, geoc.Kind)
+
+	_, err = ParseWKT(`PROJCS["x",GEOGCS["y",DATUM["z",SPHEROID["s",6378137,298.257223563]]],PROJECTION["Lambert_Conformal_Conic_2SP"]]`)
+	assert.NotNil(t, err)
+	_, err = ParseWKT(`GEOGCS["y",DATUM["z"`)
+	assert.NotNil(t, err)
+}
+
+func TestParseEPSGCode(t *testing.T) {
+	for s, code := range map[string]int{
+		"EPSG:4326":                  4326,
+		"epsg:3857":                  3857,
+		"urn:ogc:def:crs:EPSG::4490": 4490,
+		"http://www.opengis.net/def/crs/EPSG/0/4548": 4548,
+		"CRS:84": 4326,
+	} {
+		c, err := ParseEPSGCode(s)
+		assert.Nil(t, err)
+		assert.Equal(t, code, c)
+	}
+	_, err := FromEPSG(1)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, RegisterEPSG(900913, "Google", "+proj=webmerc +datum=WGS84"))
+	c, err := FromEPSG(900913)
+	assert.Nil(t, err)
+	assert.Equal(t, "Google", c.Name)
+}
+
+func TestTransformMesh(t *testing.T) {
+	src, _ := FromEPSG(4548)
+	dst, _ := FromEPSG(4978)
+
+	ms := mst.NewMesh[float64]()
+	nd := &mst.MeshNode[float64]{
+		Vertices:  []vec3.Vec[float64]{{0, 0, 0}, {10, 0, 0}, {0, 10, 0}},
+		Normals:   []vec3.Vec[float64]{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}},
+		FaceGroup: []*mst.MeshTriangle{{Batchid: 0, Faces: []*mst.Face{{Vertex: [3]uint32{0, 1, 2}}}}},
+	}
+	mt := mat4.Mat[float64]{
+		vec4.Vec[float64]{1, 0, 0, 0},
+		vec4.Vec[float64]{0, 1, 0, 0},
+		vec4.Vec[float64]{0, 0, 1, 0},
+		vec4.Vec[float64]{500000, 4427757, 50, 1},
+	}
+	nd.Mat = &mt
+	ms.Nodes = append(ms.Nodes, nd)
+	inst := mt
+	ms.InstanceNode = append(ms.InstanceNode, &mst.InstanceMesh[float64]{
+		Transfors: []*mat4.Mat[float64]{&inst},
+		BBox:      &[6]float64{499990, 4427747, 40, 500010, 4427767, 60},
+		Mesh:      &mst.BaseMesh[float64]{},
+	})
+
+	assert.Nil(t, TransformMesh(ms, src, dst))
+	assert.Nil(t, nd.Mat)
+
+	ex, ey, ez, _ := Transform(src, dst, 500010, 4427757, 50)
+	assert.InDelta(t, ex, nd.Vertices[1][0], 1e-6)
+	assert.InDelta(t, ey, nd.Vertices[1][1], 1e-6)
+	assert.InDelta(t, ez, nd.Vertices[1][2], 1e-6)
+
+	// the up normal becomes the ellipsoid normal
+	up := vec3.Vec[float64]{ex, ey, ez}
+	up.Normalize()
+	n := nd.Normals[0]
+	assert.Greater(t, vec3.Dot(&n, &up), 0.99)
+
+	// instance origin and local axes follow the transformation
+	m := ms.InstanceNode[0].Transfors[0]
+	ox, oy, oz, _ := Transform(src, dst, 500000, 4427757, 50)
+	assert.InDelta(t, ox, m[3][0], 1e-6)
+	assert.InDelta(t, oy, m[3][1], 1e-6)
+	assert.InDelta(t, oz, m[3][2], 1e-6)
+	local := vec3.Vec[float64]{10, 0, 0}
+	p := m.MulVec3(&local)
+	assert.InDelta(t, ex, p[0], 1e-3)
+	assert.InDelta(t, ey, p[1], 1e-3)
+	assert.InDelta(t, ez, p[2], 1e-3)
+	bx := ms.InstanceNode[0].BBox
+	assert.True(t, bx[0] < ox && ox < bx[3])
+
+	assert.Nil(t, TransformMesh(ms, dst, src))
+	assert.InDelta(t, 500010, nd.Vertices[1][0], 1e-6)
+	assert.InDelta(t, 4427757, nd.Vertices[1][1], 1e-6)
+	assert.InDelta(t, 50, nd.Vertices[1][2], 1e-6)
+}
@@ -0,0 +1,221 @@
+package proj
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ErrOutOfDomain is returned when a coordinate cannot be projected.
+var ErrOutOfDomain = errors.New("proj: coordinate outside projection domain")
+
+// Projection maps geodetic longitude and latitude in degrees to planar
+// coordinates in metres and back.
+type Projection interface {
+	Forward(lon, lat float64) (x, y float64, err error)
+	Inverse(x, y float64) (lon, lat float64, err error)
+	// ProjString returns the projection parameters as PROJ string fragment.
+	ProjString() string
+}
+
+func fmtFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// TransverseMercator is the ellipsoidal transverse Mercator projection, also
+// known as Gauss-Krüger. It uses Krüger's series to sixth order in n, which is
+// accurate to a few nanometres within 4000 km of the central meridian.
+type TransverseMercator struct {
+	Ellipsoid       *Ellipsoid
+	CentralMeridian float64 // lon_0 in degrees
+	LatitudeOrigin  float64 // lat_0 in degrees
+	Scale           float64 // k_0
+	FalseEasting    float64 // x_0 in metres
+	FalseNorthing   float64 // y_0 in metres
+
+	e     float64
+	ka    float64 // k_0 * rectifying radius
+	alpha [6]float64
+	beta  [6]float64
+	y0    float64 // k_0 * meridian arc of lat_0
+}
+
+// NewTransverseMercator creates a transverse Mercator projection.
+func NewTransverseMercator(ell *Ellipsoid, lon0, lat0, k0, x0, y0 float64) *TransverseMercator {
+	tm := &TransverseMercator{
+		Ellipsoid:       ell,
+		CentralMeridian: lon0,
+		LatitudeOrigin:  lat0,
+		Scale:           k0,
+		FalseEasting:    x0,
+		FalseNorthing:   y0,
+	}
+	f := ell.F
+	n := f / (2 - f)
+	n2 := n * n
+	n3 := n2 * n
+	n4 := n3 * n
+	n5 := n4 * n
+	n6 := n5 * n
+	tm.e = math.Sqrt(ell.E2())
+	tm.ka = k0 * ell.A / (1 + n) * (1 + n2/4 + n4/64 + n6/256)
+	tm.alpha = [6]float64{
+		n/2 - 2*n2/3 + 5*n3/16 + 41*n4/180 - 127*n5/288 + 7891*n6/37800,
+		13*n2/48 - 3*n3/5 + 557*n4/1440 + 281*n5/630 - 1983433*n6/1935360,
+		61*n3/240 - 103*n4/140 + 15061*n5/26880 + 167603*n6/181440,
+		49561*n4/161280 - 179*n5/168 + 6601661*n6/7257600,
+		34729*n5/80640 - 3418889*n6/1995840,
+		212378941 * n6 / 319334400,
+	}
+	tm.beta = [6]float64{
+		n/2 - 2*n2/3 + 37*n3/96 - n4/360 - 81*n5/512 + 96199*n6/604800,
+		n2/48 + n3/15 - 437*n4/1440 + 46*n5/105 - 1118711*n6/3870720,
+		17*n3/480 - 37*n4/840 - 209*n5/4480 + 5569*n6/90720,
+		4397*n4/161280 - 11*n5/504 - 830251*n6/7257600,
+		4583*n5/161280 - 108847*n6/3991680,
+		20648693 * n6 / 638668800,
+	}
+	if lat0 != 0 {
+		xi, _ := tm.series(lat0*deg2rad, 0)
+		tm.y0 = tm.ka * xi
+	}
+	return tm
+}
+
+// NewUTM creates the transverse Mercator projection of a WGS84 UTM zone.
+func NewUTM(ell *Ellipsoid, zone int, south bool) *TransverseMercator {
+	y0 := 0.0
+	if south {
+		y0 = 10000000
+	}
+	return NewTransverseMercator(ell, float64(zone*6-183), 0, 0.9996, 500000, y0)
+}
+
+// conformal returns tan of the conformal latitude for the latitude phi.
+func (tm *TransverseMercator) conformal(phi float64) float64 {
+	tau := math.Tan(phi)
+	sigma := math.Sinh(tm.e * math.Atanh(tm.e*tau/math.Sqrt(1+tau*tau)))
+	return tau*math.Sqrt(1+sigma*sigma) - sigma*math.Sqrt(1+tau*tau)
+}
+
+func (tm *TransverseMercator) series(phi, lam float64) (xi, eta float64) {
+	t := tm.conformal(phi)
+	xiP := math.Atan2(t, math.Cos(lam))
+	etaP := math.Asinh(math.Sin(lam) / math.Hypot(t, math.Cos(lam)))
+	xi, eta = xiP, etaP
+	for j := 1; j <= 6; j++ {
+		a := tm.alpha[j-1]
+		xi += a * math.Sin(2*float64(j)*xiP) * math.Cosh(2*float64(j)*etaP)
+		eta += a * math.Cos(2*float64(j)*xiP) * math.Sinh(2*float64(j)*etaP)
+	}
+	return xi, eta
+}
+
+// Forward implements Projection.
+func (tm *TransverseMercator) Forward(lon, lat float64) (float64, float64, error) {
+	lam := math.Remainder(lon-tm.CentralMeridian, 360) * deg2rad
+	if math.Abs(lam) > math.Pi/2 || math.Abs(lat) > 90 {
+		return 0, 0, ErrOutOfDomain
+	}
+	xi, eta := tm.series(lat*deg2rad, lam)
+	return tm.FalseEasting + tm.ka*eta, tm.FalseNorthing + tm.ka*xi - tm.y0, nil
+}
+
+// Inverse implements Projection.
+func (tm *TransverseMercator) Inverse(x, y float64) (float64, float64, error) {
+	xi := (y - tm.FalseNorthing + tm.y0) / tm.ka
+	eta := (x - tm.FalseEasting) / tm.ka
+	xiP, etaP := xi, eta
+	for j := 1; j <= 6; j++ {
+		b := tm.beta[j-1]
+		xiP -= b * math.Sin(2*float64(j)*xi) * math.Cosh(2*float64(j)*eta)
+		etaP -= b * math.Cos(2*float64(j)*xi) * math.Sinh(2*float64(j)*eta)
+	}
+	lam := math.Atan2(math.Sinh(etaP), math.Cos(xiP))
+	tauP := math.Sin(xiP) / math.Hypot(math.Sinh(etaP), math.Cos(xiP))
+
+	e2 := tm.e * tm.e
+	tau := tauP
+	for i := 0; i < 10; i++ {
+		ti := tm.conformal(math.Atan(tau))
+		d := (tauP - ti) / math.Sqrt(1+ti*ti) * (1 + (1-e2)*tau*tau) / ((1 - e2) * math.Sqrt(1+tau*tau))
+		tau += d
+		if math.Abs(d) < 1e-14 {
+			break
+		}
+	}
+	return tm.CentralMeridian + lam*rad2deg, math.Atan(tau) * rad2deg, nil
+}
+
+// ProjString implements Projection.
+func (tm *TransverseMercator) ProjString() string {
+	return fmt.Sprintf("+proj=tmerc +lat_0=%s +lon_0=%s +k=%s +x_0=%s +y_0=%s",
+		fmtFloat(tm.LatitudeOrigin), fmtFloat(tm.CentralMeridian), fmtFloat(tm.Scale),
+		fmtFloat(tm.FalseEasting), fmtFloat(tm.FalseNorthing))
+}
+
+// Mercator is the normal Mercator projection. With Spherical set the
+// latitude is projected on a sphere of the ellipsoid's semi-major axis,
+// which gives the Web Mercator (EPSG:3857) projection.
+type Mercator struct {
+	Ellipsoid       *Ellipsoid
+	CentralMeridian float64
+	Scale           float64
+	FalseEasting    float64
+	FalseNorthing   float64
+	Spherical       bool
+}
+
+// NewWebMercator creates the Web Mercator projection on WGS84.
+func NewWebMercator() *Mercator {
+	return &Mercator{Ellipsoid: WGS84Ellipsoid, Scale: 1, Spherical: true}
+}
+
+// Forward implements Projection.
+func (m *Mercator) Forward(lon, lat float64) (float64, float64, error) {
+	if math.Abs(lat) >= 90 {
+		return 0, 0, ErrOutOfDomain
+	}
+	ka := m.Scale * m.Ellipsoid.A
+	lam := (lon - m.CentralMeridian) * deg2rad
+	phi := lat * deg2rad
+	y := math.Log(math.Tan(math.Pi/4 + phi/2))
+	if !m.Spherical {
+		e := math.Sqrt(m.Ellipsoid.E2())
+		es := e * math.Sin(phi)
+		y -= e * math.Atanh(es)
+	}
+	return m.FalseEasting + ka*lam, m.FalseNorthing + ka*y, nil
+}
+
+// Inverse implements Projection.
+func (m *Mercator) Inverse(x, y float64) (float64, float64, error) {
+	ka := m.Scale * m.Ellipsoid.A
+	lam := (x - m.FalseEasting) / ka
+	ts := math.Exp(-(y - m.FalseNorthing) / ka)
+	phi := math.Pi/2 - 2*math.Atan(ts)
+	if !m.Spherical {
+		e := math.Sqrt(m.Ellipsoid.E2())
+		for i := 0; i < 15; i++ {
+			es := e * math.Sin(phi)
+			next := math.Pi/2 - 2*math.Atan(ts*math.Pow((1-es)/(1+es), e/2))
+			if math.Abs(next-phi) < 1e-15 {
+				phi = next
+				break
+			}
+			phi = next
+		}
+	}
+	return m.CentralMeridian + lam*rad2deg, phi * rad2deg, nil
+}
+
+// ProjString implements Projection.
+func (m *Mercator) ProjString() string {
+	if m.Spherical {
+		return fmt.Sprintf("+proj=webmerc +lon_0=%s +x_0=%s +y_0=%s",
+			fmtFloat(m.CentralMeridian), fmtFloat(m.FalseEasting), fmtFloat(m.FalseNorthing))
+	}
+	return fmt.Sprintf("+proj=merc +lon_0=%s +k=%s +x_0=%s +y_0=%s",
+		fmtFloat(m.CentralMeridian), fmtFloat(m.Scale), fmtFloat(m.FalseEasting), fmtFloat(m.FalseNorthing))
+}
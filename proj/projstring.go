@@ -0,0 +1,200 @@
+package proj
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var unitsToMeter = map[string]float64{
+	"m":     1,
+	"km":    1000,
+	"ft":    0.3048,
+	"us-ft": 1200.0 / 3937.0,
+}
+
+// ParseProjString creates a CRS from a PROJ string such as
+// "+proj=tmerc +lon_0=117 +k=1 +x_0=500000 +ellps=GRS80 +units=m".
+//
+// Supported projections are longlat, geocent, tmerc, utm, merc and webmerc.
+func ParseProjString(s string) (*CRS, error) {
+	params := make(map[string]string)
+	for _, tok := range strings.Fields(s) {
+		tok = strings.TrimPrefix(tok, "+")
+		if tok == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(tok, "=")
+		params[strings.ToLower(k)] = v
+	}
+	if init, ok := params["init"]; ok {
+		return Parse(init)
+	}
+
+	num := func(key string, def float64) (float64, error) {
+		v, ok := params[key]
+		if !ok {
+			return def, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("proj: invalid +%s=%s", key, v)
+		}
+		return f, nil
+	}
+
+	datum, err := projStringDatum(params, num)
+	if err != nil {
+		return nil, err
+	}
+
+	k0, err := num("k_0", 1)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := params["k"]; ok {
+		if k0, err = num("k", 1); err != nil {
+			return nil, err
+		}
+	}
+	var p [4]float64
+	for i, key := range []string{"lon_0", "lat_0", "x_0", "y_0"} {
+		if p[i], err = num(key, 0); err != nil {
+			return nil, err
+		}
+	}
+	lon0, lat0, x0, y0 := p[0], p[1], p[2], p[3]
+
+	var crs *CRS
+	name := params["proj"]
+	switch name {
+	case "longlat", "latlong", "lonlat", "latlon":
+		crs = NewGeographic(datum)
+	case "geocent", "cart":
+		crs = NewGeocentric(datum)
+	case "tmerc", "gauss", "gauss-kruger":
+		crs = NewProjected(datum, NewTransverseMercator(datum.Ellipsoid, lon0, lat0, k0, x0, y0))
+	case "utm":
+		zone, err := strconv.Atoi(params["zone"])
+		if err != nil || zone < 1 || zone > 60 {
+			return nil, fmt.Errorf("proj: invalid utm zone %q", params["zone"])
+		}
+		_, south := params["south"]
+		crs = NewProjected(datum, NewUTM(datum.Ellipsoid, zone, south))
+	case "merc":
+		_, null := params["nadgrids"]
+		if datum.Ellipsoid.F == 0 && null {
+			// the classic EPSG:3857 definition projects WGS84 latitudes on a sphere
+			m := NewWebMercator()
+			m.CentralMeridian, m.FalseEasting, m.FalseNorthing = lon0, x0, y0
+			crs = NewProjected(WGS84, m)
+		} else {
+			crs = NewProjected(datum, &Mercator{Ellipsoid: datum.Ellipsoid, CentralMeridian: lon0, Scale: k0,
+				FalseEasting: x0, FalseNorthing: y0, Spherical: datum.Ellipsoid.F == 0})
+		}
+	case "webmerc":
+		m := NewWebMercator()
+		m.Ellipsoid = datum.Ellipsoid
+		m.CentralMeridian, m.FalseEasting, m.FalseNorthing = lon0, x0, y0
+		crs = NewProjected(datum, m)
+	case "":
+		return nil, fmt.Errorf("proj: missing +proj in %q", s)
+	default:
+		return nil, fmt.Errorf("proj: unsupported projection %q", name)
+	}
+
+	if u, ok := params["units"]; ok {
+		f, ok := unitsToMeter[u]
+		if !ok {
+			return nil, fmt.Errorf("proj: unsupported unit %q", u)
+		}
+		crs.ToMeter = f
+	}
+	if crs.ToMeter, err = num("to_meter", crs.ToMeter); err != nil {
+		return nil, err
+	}
+	if v, ok := params["geoidgrids"]; ok && crs.Kind != Geocentric {
+		if crs.Geoid, err = parseGeoidGrids(v); err != nil {
+			return nil, err
+		}
+	}
+	return crs, nil
+}
+
+func projStringDatum(params map[string]string, num func(string, float64) (float64, error)) (*Datum, error) {
+	var datum *Datum
+	if name, ok := params["datum"]; ok {
+		d, ok := LookupDatum(name)
+		if !ok {
+			return nil, fmt.Errorf("proj: unknown datum %q", name)
+		}
+		datum = d
+	}
+
+	var ell *Ellipsoid
+	if name, ok := params["ellps"]; ok {
+		e, ok := LookupEllipsoid(name)
+		if !ok {
+			return nil, fmt.Errorf("proj: unknown ellipsoid %q", name)
+		}
+		ell = e
+	}
+	if _, ok := params["a"]; ok {
+		a, err := num("a", 0)
+		if err != nil {
+			return nil, err
+		}
+		rf, err := num("rf", 0)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := params["b"]; ok {
+			b, err := num("b", a)
+			if err != nil {
+				return nil, err
+			}
+			if b != a {
+				rf = a / (a - b)
+			}
+		} else if _, ok := params["f"]; ok {
+			f, err := num("f", 0)
+			if err != nil {
+				return nil, err
+			}
+			if f != 0 {
+				rf = 1 / f
+			}
+		}
+		ell = NewEllipsoid("", a, rf)
+	}
+
+	var towgs84 *Helmert
+	if v, ok := params["towgs84"]; ok {
+		h, err := ParseTowgs84(v)
+		if err != nil {
+			return nil, err
+		}
+		towgs84 = h
+	}
+
+	switch {
+	case datum != nil && ell == nil && towgs84 == nil:
+		return datum, nil
+	case datum != nil:
+		d := *datum
+		if ell != nil {
+			d.Ellipsoid = ell
+		}
+		if towgs84 != nil {
+			d.ToWGS84 = towgs84
+		}
+		return &d, nil
+	case ell == nil:
+		ell = WGS84Ellipsoid
+	}
+	name := ell.Name
+	if name == "" {
+		name = "unknown"
+	}
+	return &Datum{Name: name, Ellipsoid: ell, ToWGS84: towgs84}, nil
+}
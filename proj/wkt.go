@@ -0,0 +1,374 @@
+package proj
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// wktNode is one KEYWORD[...] element of a WKT string. Values holds the
+// quoted strings, numbers and bare identifiers in order of appearance.
+type wktNode struct {
+	Keyword  string
+	Values   []string
+	Children []*wktNode
+}
+
+func (n *wktNode) child(keywords ...string) *wktNode {
+	for _, c := range n.Children {
+		for _, k := range keywords {
+			if c.Keyword == k {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+func (n *wktNode) value(i int) string {
+	if i < len(n.Values) {
+		return n.Values[i]
+	}
+	return ""
+}
+
+func (n *wktNode) number(i int) (float64, error) {
+	v := n.value(i)
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("proj: %s expects a number, got %q", n.Keyword, v)
+	}
+	return f, nil
+}
+
+type wktParser struct {
+	s   string
+	pos int
+}
+
+func (p *wktParser) skipSpace() {
+	for p.pos < len(p.s) && strings.ContainsRune(" \t\r\n", rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *wktParser) parseNode() (*wktNode, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && (isWKTIdent(p.s[p.pos])) {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, fmt.Errorf("proj: WKT keyword expected at offset %d", p.pos)
+	}
+	n := &wktNode{Keyword: strings.ToUpper(p.s[start:p.pos])}
+	p.skipSpace()
+	if p.pos >= len(p.s) || (p.s[p.pos] != '[' && p.s[p.pos] != '(') {
+		return nil, fmt.Errorf("proj: '[' expected after %s", n.Keyword)
+	}
+	closing := byte(']')
+	if p.s[p.pos] == '(' {
+		closing = ')'
+	}
+	p.pos++
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.s) {
+			return nil, fmt.Errorf("proj: unterminated %s", n.Keyword)
+		}
+		switch c := p.s[p.pos]; {
+		case c == closing:
+			p.pos++
+			return n, nil
+		case c == ',':
+			p.pos++
+		case c == '"':
+			p.pos++
+			var b strings.Builder
+			for {
+				if p.pos >= len(p.s) {
+					return nil, errors.New("proj: unterminated WKT string")
+				}
+				if p.s[p.pos] == '"' {
+					// a doubled quote is an escaped quote
+					if p.pos+1 < len(p.s) && p.s[p.pos+1] == '"' {
+						b.WriteByte('"')
+						p.pos += 2
+						continue
+					}
+					p.pos++
+					break
+				}
+				b.WriteByte(p.s[p.pos])
+				p.pos++
+			}
+			n.Values = append(n.Values, b.String())
+		default:
+			save := p.pos
+			for p.pos < len(p.s) && (isWKTIdent(p.s[p.pos]) || strings.IndexByte("+-.", p.s[p.pos]) >= 0) {
+				p.pos++
+			}
+			tok := p.s[save:p.pos]
+			p.skipSpace()
+			if p.pos < len(p.s) && (p.s[p.pos] == '[' || p.s[p.pos] == '(') {
+				p.pos = save
+				child, err := p.parseNode()
+				if err != nil {
+					return nil, err
+				}
+				n.Children = append(n.Children, child)
+				continue
+			}
+			if tok == "" {
+				return nil, fmt.Errorf("proj: unexpected %q in WKT at offset %d", c, p.pos)
+			}
+			n.Values = append(n.Values, tok)
+		}
+	}
+}
+
+func isWKTIdent(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// ParseWKT creates a CRS from a WKT1 (OGC 01-009) or WKT2 (ISO 19162)
+// definition of a geographic, geocentric or projected CRS.
+func ParseWKT(s string) (*CRS, error) {
+	p := &wktParser{s: s}
+	root, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	crs, err := wktCRS(root)
+	if err != nil {
+		return nil, err
+	}
+	crs.Code = wktEPSG(root)
+	if crs.Code != 0 && crs.Datum.ToWGS84 == nil {
+		// WKT2 has no TOWGS84, fall back to the shift of the registered code
+		if def, ok := EPSGDefinition(crs.Code); ok && !strings.ContainsAny(def, "[(") {
+			if reg, err := ParseProjString(def); err == nil && reg.Datum.Ellipsoid.Equal(crs.Datum.Ellipsoid) {
+				d := *crs.Datum
+				d.ToWGS84 = reg.Datum.ToWGS84
+				crs.Datum = &d
+			}
+		}
+	}
+	return crs, nil
+}
+
+func wktEPSG(n *wktNode) int {
+	id := n.child("AUTHORITY", "ID")
+	if id == nil || !strings.EqualFold(id.value(0), "EPSG") {
+		return 0
+	}
+	code, _ := strconv.Atoi(id.value(1))
+	return code
+}
+
+func wktCRS(n *wktNode) (*CRS, error) {
+	switch n.Keyword {
+	case "GEOGCS", "GEOGCRS", "GEOGRAPHICCRS", "BASEGEOGCRS":
+		d, err := wktDatum(n)
+		if err != nil {
+			return nil, err
+		}
+		c := NewGeographic(d)
+		c.Name = n.value(0)
+		return c, nil
+	case "GEOCCS":
+		d, err := wktDatum(n)
+		if err != nil {
+			return nil, err
+		}
+		c := NewGeocentric(d)
+		c.Name = n.value(0)
+		return c, nil
+	case "GEODCRS", "GEODETICCRS", "BASEGEODCRS":
+		d, err := wktDatum(n)
+		if err != nil {
+			return nil, err
+		}
+		var c *CRS
+		if cs := n.child("CS"); cs != nil && strings.EqualFold(cs.value(0), "cartesian") {
+			c = NewGeocentric(d)
+		} else {
+			c = NewGeographic(d)
+		}
+		c.Name = n.value(0)
+		return c, nil
+	case "PROJCS", "PROJCRS", "PROJECTEDCRS":
+		return wktProjected(n)
+	case "COMPD_CS", "COMPOUNDCRS":
+		for _, c := range n.Children {
+			if crs, err := wktCRS(c); err == nil {
+				return crs, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("proj: unsupported WKT CRS %s", n.Keyword)
+}
+
+func wktDatum(n *wktNode) (*Datum, error) {
+	dn := n.child("DATUM", "GEODETICDATUM", "TRF", "ENSEMBLE")
+	if dn == nil {
+		return nil, fmt.Errorf("proj: %s without DATUM", n.Keyword)
+	}
+	en := dn.child("SPHEROID", "ELLIPSOID")
+	if en == nil {
+		return nil, fmt.Errorf("proj: DATUM %q without ELLIPSOID", dn.value(0))
+	}
+	a, err := en.number(1)
+	if err != nil {
+		return nil, err
+	}
+	rf, err := en.number(2)
+	if err != nil {
+		return nil, err
+	}
+	if u := en.child("LENGTHUNIT", "UNIT"); u != nil {
+		if f, err := u.number(1); err == nil {
+			a *= f
+		}
+	}
+	ell := NewEllipsoid(wktEllipsoidName(en.value(0), a, rf), a, rf)
+	d := &Datum{Name: dn.value(0), Ellipsoid: ell}
+	if t := dn.child("TOWGS84"); t != nil {
+		h, err := ParseTowgs84(strings.Join(t.Values, ","))
+		if err != nil {
+			return nil, err
+		}
+		if !h.IsIdentity() {
+			d.ToWGS84 = h
+		}
+	}
+	return d, nil
+}
+
+// wktEllipsoidName maps an ellipsoid to its PROJ name when it is a known one.
+func wktEllipsoidName(name string, a, rf float64) string {
+	tmp := NewEllipsoid(name, a, rf)
+	for _, k := range []string{"wgs84", "cgcs2000", "grs80", "krass", "iag75", "clrk66", "intl", "bessel"} {
+		if e := ellipsoids[k]; e.Equal(tmp) {
+			return e.Name
+		}
+	}
+	return name
+}
+
+func wktProjected(n *wktNode) (*CRS, error) {
+	base := n.child("GEOGCS", "BASEGEOGCRS", "BASEGEODCRS", "GEOGCRS")
+	if base == nil {
+		return nil, fmt.Errorf("proj: %s without base CRS", n.Keyword)
+	}
+	d, err := wktDatum(base)
+	if err != nil {
+		return nil, err
+	}
+
+	var method string
+	params := make(map[string]float64)
+	readParams := func(parent *wktNode) error {
+		for _, c := range parent.Children {
+			if c.Keyword != "PARAMETER" {
+				continue
+			}
+			v, err := c.number(1)
+			if err != nil {
+				return err
+			}
+			if u := c.child("ANGLEUNIT"); u != nil {
+				if f, err := u.number(1); err == nil {
+					v *= f * rad2deg
+				}
+			} else if u := c.child("LENGTHUNIT", "SCALEUNIT"); u != nil {
+				if f, err := u.number(1); err == nil {
+					v *= f
+				}
+			}
+			params[wktParamKey(c.value(0))] = v
+		}
+		return nil
+	}
+	if conv := n.child("CONVERSION"); conv != nil {
+		if m := conv.child("METHOD"); m != nil {
+			method = m.value(0)
+		}
+		if err := readParams(conv); err != nil {
+			return nil, err
+		}
+	} else {
+		if m := n.child("PROJECTION"); m != nil {
+			method = m.value(0)
+		}
+		if err := readParams(n); err != nil {
+			return nil, err
+		}
+	}
+
+	k0, ok := params["k_0"]
+	if !ok {
+		k0 = 1
+	}
+	lon0, lat0, x0, y0 := params["lon_0"], params["lat_0"], params["x_0"], params["y_0"]
+
+	toMeter := 1.0
+	if u := n.child("UNIT", "LENGTHUNIT"); u != nil {
+		if f, err := u.number(1); err == nil {
+			toMeter = f
+		}
+	} else if cs := n.child("CS"); cs != nil {
+		for _, ax := range n.Children {
+			if ax.Keyword != "AXIS" {
+				continue
+			}
+			if u := ax.child("LENGTHUNIT"); u != nil {
+				if f, err := u.number(1); err == nil {
+					toMeter = f
+				}
+				break
+			}
+		}
+	}
+	// WKT1 false easting and northing are expressed in the CRS unit
+	if n.child("CONVERSION") == nil {
+		x0 *= toMeter
+		y0 *= toMeter
+	}
+
+	var p Projection
+	switch strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(method)) {
+	case "transverse_mercator", "gauss_kruger", "transverse_mercator_(south_orientated)":
+		p = NewTransverseMercator(d.Ellipsoid, lon0, lat0, k0, x0, y0)
+	case "mercator_1sp", "mercator_(variant_a)", "mercator":
+		p = &Mercator{Ellipsoid: d.Ellipsoid, CentralMeridian: lon0, Scale: k0, FalseEasting: x0, FalseNorthing: y0}
+	case "popular_visualisation_pseudo_mercator", "mercator_auxiliary_sphere", "pseudo_mercator":
+		m := NewWebMercator()
+		m.Ellipsoid = d.Ellipsoid
+		m.CentralMeridian, m.FalseEasting, m.FalseNorthing = lon0, x0, y0
+		p = m
+	default:
+		return nil, fmt.Errorf("proj: unsupported WKT projection %q", method)
+	}
+	c := NewProjected(d, p)
+	c.Name = n.value(0)
+	c.ToMeter = toMeter
+	return c, nil
+}
+
+func wktParamKey(name string) string {
+	switch strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(name)) {
+	case "central_meridian", "longitude_of_natural_origin", "longitude_of_origin", "longitude_of_center":
+		return "lon_0"
+	case "latitude_of_origin", "latitude_of_natural_origin", "latitude_of_center":
+		return "lat_0"
+	case "scale_factor", "scale_factor_at_natural_origin":
+		return "k_0"
+	case "false_easting":
+		return "x_0"
+	case "false_northing":
+		return "y_0"
+	}
+	return name
+}
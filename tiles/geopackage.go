@@ -0,0 +1,454 @@
+package tiles
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/proj"
+)
+
+const (
+	GPKG_APPLICATION_ID = 0x47504B47 // "GPKG"
+	GPKG_USER_VERSION   = 10300      // GeoPackage 1.3
+
+	// GPKG_TILESET_EXTENSION registers the TILESET_TABLE in gpkg_extensions.
+	GPKG_TILESET_EXTENSION = "xr_tileset_files"
+)
+
+var srsWKT = map[int]string{
+	4326: `GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AUTHORITY["EPSG","4326"]]`,
+	3857: `PROJCS["WGS 84 / Pseudo-Mercator",GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AUTHORITY["EPSG","4326"]],PROJECTION["Mercator_1SP"],PARAMETER["central_meridian",0],PARAMETER["scale_factor",1],PARAMETER["false_easting",0],PARAMETER["false_northing",0],UNIT["metre",1,AUTHORITY["EPSG","9001"]],AXIS["X",EAST],AXIS["Y",NORTH],EXTENSION["PROJ4","+proj=merc +a=6378137 +b=6378137 +lat_ts=0 +lon_0=0 +x_0=0 +y_0=0 +k=1 +units=m +nadgrids=@null +wktext +no_defs"],AUTHORITY["EPSG","3857"]]`,
+}
+
+const gpkgSchema = `CREATE TABLE IF NOT EXISTS gpkg_spatial_ref_sys (
+	srs_name TEXT NOT NULL, srs_id INTEGER PRIMARY KEY NOT NULL, organization TEXT NOT NULL,
+	organization_coordsys_id INTEGER NOT NULL, definition TEXT NOT NULL, description TEXT);
+CREATE TABLE IF NOT EXISTS gpkg_contents (
+	table_name TEXT PRIMARY KEY NOT NULL, data_type TEXT NOT NULL, identifier TEXT UNIQUE, description TEXT DEFAULT '',
+	last_change DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+	min_x DOUBLE, min_y DOUBLE, max_x DOUBLE, max_y DOUBLE,
+	srs_id INTEGER, CONSTRAINT fk_gc_r_srs_id FOREIGN KEY (srs_id) REFERENCES gpkg_spatial_ref_sys(srs_id));
+CREATE TABLE IF NOT EXISTS gpkg_tile_matrix_set (
+	table_name TEXT PRIMARY KEY NOT NULL, srs_id INTEGER NOT NULL,
+	min_x DOUBLE NOT NULL, min_y DOUBLE NOT NULL, max_x DOUBLE NOT NULL, max_y DOUBLE NOT NULL,
+	CONSTRAINT fk_gtms_table_name FOREIGN KEY (table_name) REFERENCES gpkg_contents(table_name),
+	CONSTRAINT fk_gtms_srs FOREIGN KEY (srs_id) REFERENCES gpkg_spatial_ref_sys (srs_id));
+CREATE TABLE IF NOT EXISTS gpkg_tile_matrix (
+	table_name TEXT NOT NULL, zoom_level INTEGER NOT NULL, matrix_width INTEGER NOT NULL, matrix_height INTEGER NOT NULL,
+	tile_width INTEGER NOT NULL, tile_height INTEGER NOT NULL, pixel_x_size DOUBLE NOT NULL, pixel_y_size DOUBLE NOT NULL,
+	CONSTRAINT pk_ttm PRIMARY KEY (table_name, zoom_level),
+	CONSTRAINT fk_tmm_table_name FOREIGN KEY (table_name) REFERENCES gpkg_contents(table_name));
+CREATE TABLE IF NOT EXISTS gpkg_extensions (
+	table_name TEXT, column_name TEXT, extension_name TEXT NOT NULL, definition TEXT NOT NULL, scope TEXT NOT NULL,
+	CONSTRAINT ge_tce UNIQUE (table_name, column_name, extension_name));
+CREATE TABLE IF NOT EXISTS gpkg_metadata (
+	id INTEGER CONSTRAINT m_pk PRIMARY KEY ASC NOT NULL, md_scope TEXT NOT NULL DEFAULT 'dataset',
+	md_standard_uri TEXT NOT NULL, mime_type TEXT NOT NULL DEFAULT 'text/xml', metadata TEXT NOT NULL DEFAULT '');
+CREATE TABLE IF NOT EXISTS gpkg_metadata_reference (
+	reference_scope TEXT NOT NULL, table_name TEXT, column_name TEXT, row_id_value INTEGER,
+	timestamp DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+	md_file_id INTEGER NOT NULL, md_parent_id INTEGER,
+	CONSTRAINT crmr_mfi_fk FOREIGN KEY (md_file_id) REFERENCES gpkg_metadata(id),
+	CONSTRAINT crmr_mpi_fk FOREIGN KEY (md_parent_id) REFERENCES gpkg_metadata(id));
+INSERT OR IGNORE INTO gpkg_spatial_ref_sys VALUES ('Undefined cartesian SRS', -1, 'NONE', -1, 'undefined', 'undefined cartesian coordinate reference system');
+INSERT OR IGNORE INTO gpkg_spatial_ref_sys VALUES ('Undefined geographic SRS', 0, 'NONE', 0, 'undefined', 'undefined geographic coordinate reference system');
+`
+
+// GeoPackage reads and writes a tile pyramid table of an OGC GeoPackage.
+// Tile rows count from the top like XYZ tiles. The metadata of the table is
+// a JSON object in gpkg_metadata and the embedded TilesetFiles keeps a 3D
+// Tiles tileset in the same file.
+type GeoPackage struct {
+	TilesetFiles
+	Table    string
+	info     Info
+	writable bool
+	Metadata map[string]string
+	mdID     int64 // row of the metadata in gpkg_metadata, 0 when missing
+}
+
+// OpenGeoPackage opens a tiles table of a GeoPackage for reading. An empty
+// table selects the first tiles table of gpkg_contents.
+func OpenGeoPackage(path, table string) (*GeoPackage, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", sqliteDSN(path, "ro"))
+	if err != nil {
+		return nil, err
+	}
+	g := &GeoPackage{TilesetFiles: TilesetFiles{db: db, modTime: st.ModTime()}, Table: table, Metadata: map[string]string{}}
+	if err := g.read(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("tiles: %s: %w", path, err)
+	}
+	return g, nil
+}
+
+// CreateGeoPackage creates a GeoPackage, or opens an existing one, and adds
+// the tiles table if missing. The grid of info defaults to WebMercator and
+// its bounds to the grid extent.
+func CreateGeoPackage(path, table string, info Info) (*GeoPackage, error) {
+	db, err := sql.Open("sqlite", sqliteDSN(path, "rwc"))
+	if err != nil {
+		return nil, err
+	}
+	g := &GeoPackage{TilesetFiles: TilesetFiles{db: db, modTime: time.Now()}, Table: table, writable: true, Metadata: map[string]string{}}
+	if err := g.create(info); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("tiles: %s: %w", path, err)
+	}
+	return g, nil
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func (g *GeoPackage) create(info Info) error {
+	if g.Table == "" {
+		return errors.New("missing table name")
+	}
+	if info.Grid == nil {
+		info.Grid = WebMercator
+	}
+	if info.Format == "" {
+		info.Format = PNG
+	}
+	grid := info.Grid
+	ctx := context.Background()
+	if _, err := g.db.ExecContext(ctx, fmt.Sprintf("PRAGMA application_id = %d; PRAGMA user_version = %d", GPKG_APPLICATION_ID, GPKG_USER_VERSION)); err != nil {
+		return err
+	}
+	if _, err := g.db.ExecContext(ctx, gpkgSchema); err != nil {
+		return err
+	}
+	for _, code := range []int{4326, grid.EPSG} {
+		if err := g.addSRS(ctx, code); err != nil {
+			return err
+		}
+	}
+
+	_, err := g.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+quoteIdent(g.Table)+` (
+	id INTEGER PRIMARY KEY AUTOINCREMENT, zoom_level INTEGER NOT NULL, tile_column INTEGER NOT NULL,
+	tile_row INTEGER NOT NULL, tile_data BLOB NOT NULL, UNIQUE (zoom_level, tile_column, tile_row))`)
+	if err != nil {
+		return err
+	}
+	bounds := grid.Extent
+	if info.Bounds != (vec2.Rect[float64]{}) {
+		minX, minY, err := grid.LonLat(info.Bounds.Min[0], info.Bounds.Min[1])
+		if err != nil {
+			return err
+		}
+		maxX, maxY, err := grid.LonLat(info.Bounds.Max[0], info.Bounds.Max[1])
+		if err != nil {
+			return err
+		}
+		bounds = vec2.Rect[float64]{Min: vec2.Vec[float64]{minX, minY}, Max: vec2.Vec[float64]{maxX, maxY}}
+	}
+	identifier := info.Name
+	if identifier == "" {
+		identifier = g.Table
+	}
+	_, err = g.db.ExecContext(ctx, "INSERT OR IGNORE INTO gpkg_contents (table_name, data_type, identifier, min_x, min_y, max_x, max_y, srs_id) VALUES (?, 'tiles', ?, ?, ?, ?, ?, ?)",
+		g.Table, identifier, bounds.Min[0], bounds.Min[1], bounds.Max[0], bounds.Max[1], grid.EPSG)
+	if err != nil {
+		return err
+	}
+	e := grid.Extent
+	_, err = g.db.ExecContext(ctx, "INSERT OR IGNORE INTO gpkg_tile_matrix_set VALUES (?, ?, ?, ?, ?, ?)", g.Table, grid.EPSG, e.Min[0], e.Min[1], e.Max[0], e.Max[1])
+	if err != nil {
+		return err
+	}
+
+	if err := g.createTable(ctx); err != nil {
+		return err
+	}
+	for _, e := range [][3]string{
+		{"gpkg_metadata", "gpkg_metadata", "http://www.geopackage.org/spec/#extension_metadata"},
+		{"gpkg_metadata_reference", "gpkg_metadata", "http://www.geopackage.org/spec/#extension_metadata"},
+		{TILESET_TABLE, GPKG_TILESET_EXTENSION, "path and content of 3D Tiles tileset files"},
+	} {
+		if err := g.addExtension(ctx, e[0], e[1], e[2]); err != nil {
+			return err
+		}
+	}
+
+	if err := g.read(); err != nil {
+		return err
+	}
+	// the format of an empty table cannot be sniffed
+	g.info.Format = info.Format
+	var n int
+	if err := g.db.QueryRowContext(ctx, "SELECT count(*) FROM "+quoteIdent(g.Table)).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		// without tile matrices the grid cannot be read back either
+		g.info.Grid = grid
+		g.info.MinZoom, g.info.MaxZoom = -1, -1
+	}
+	return nil
+}
+
+// addExtension registers a table extension once, the unique constraint of
+// gpkg_extensions does not catch rows without column.
+func (g *GeoPackage) addExtension(ctx context.Context, table, name, definition string) error {
+	_, err := g.db.ExecContext(ctx, `INSERT INTO gpkg_extensions SELECT ?, NULL, ?, ?, 'read-write'
+WHERE NOT EXISTS (SELECT 1 FROM gpkg_extensions WHERE table_name = ? AND column_name IS NULL AND extension_name = ?)`, table, name, definition, table, name)
+	return err
+}
+
+func (g *GeoPackage) addSRS(ctx context.Context, code int) error {
+	name := fmt.Sprintf("EPSG:%d", code)
+	if crs, err := proj.FromEPSG(code); err == nil && crs.Name != "" {
+		name = crs.Name
+	}
+	def, ok := srsWKT[code]
+	if !ok {
+		def = "undefined"
+	}
+	_, err := g.db.ExecContext(ctx, "INSERT OR IGNORE INTO gpkg_spatial_ref_sys VALUES (?, ?, 'EPSG', ?, ?, NULL)", name, code, code, def)
+	return err
+}
+
+func (g *GeoPackage) read() error {
+	ctx := context.Background()
+	if g.Table == "" {
+		err := g.db.QueryRowContext(ctx, "SELECT table_name FROM gpkg_contents WHERE data_type = 'tiles' ORDER BY table_name LIMIT 1").Scan(&g.Table)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("no tiles table")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var identifier sql.NullString
+	var minX, minY, maxX, maxY sql.NullFloat64
+	err := g.db.QueryRowContext(ctx, "SELECT identifier, min_x, min_y, max_x, max_y FROM gpkg_contents WHERE table_name = ? AND data_type = 'tiles'", g.Table).
+		Scan(&identifier, &minX, &minY, &maxX, &maxY)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no tiles table %s", g.Table)
+	}
+	if err != nil {
+		return err
+	}
+	var srs int
+	var e vec2.Rect[float64]
+	err = g.db.QueryRowContext(ctx, "SELECT srs_id, min_x, min_y, max_x, max_y FROM gpkg_tile_matrix_set WHERE table_name = ?", g.Table).
+		Scan(&srs, &e.Min[0], &e.Min[1], &e.Max[0], &e.Max[1])
+	if err != nil {
+		return err
+	}
+	grid, minZoom, maxZoom, err := g.readGrid(ctx, srs, e)
+	if err != nil {
+		return err
+	}
+	g.info = Info{Name: identifier.String, Grid: grid, MinZoom: minZoom, MaxZoom: maxZoom}
+	if g.info.Name == "" {
+		g.info.Name = g.Table
+	}
+
+	b := e
+	if minX.Valid && minY.Valid && maxX.Valid && maxY.Valid {
+		b = vec2.Rect[float64]{Min: vec2.Vec[float64]{minX.Float64, minY.Float64}, Max: vec2.Vec[float64]{maxX.Float64, maxY.Float64}}
+	}
+	if g.info.Bounds.Min[0], g.info.Bounds.Min[1], err = grid.ToLonLat(b.Min[0], b.Min[1]); err != nil {
+		return err
+	}
+	if g.info.Bounds.Max[0], g.info.Bounds.Max[1], err = grid.ToLonLat(b.Max[0], b.Max[1]); err != nil {
+		return err
+	}
+
+	var data []byte
+	err = g.db.QueryRowContext(ctx, "SELECT tile_data FROM "+quoteIdent(g.Table)+" LIMIT 1").Scan(&data)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	g.info.Format = sniffFormat(data)
+	return g.readMetadata(ctx)
+}
+
+// readGrid matches the tile matrices with a grid doubling at every zoom
+// level, preferring the well known grids.
+func (g *GeoPackage) readGrid(ctx context.Context, srs int, e vec2.Rect[float64]) (*Grid, int, int, error) {
+	rows, err := g.db.QueryContext(ctx, "SELECT zoom_level, matrix_width, matrix_height, tile_width FROM gpkg_tile_matrix WHERE table_name = ? ORDER BY zoom_level", g.Table)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rows.Close()
+	grid := &Grid{Name: g.Table, EPSG: srs, Extent: e, TileSize: 256, Width: 1, Height: 1}
+	minZoom, maxZoom := -1, -1
+	for rows.Next() {
+		var z, w, h, size int
+		if err := rows.Scan(&z, &w, &h, &size); err != nil {
+			return nil, 0, 0, err
+		}
+		if minZoom < 0 {
+			minZoom = z
+			grid.TileSize, grid.Width, grid.Height = size, w>>z, h>>z
+		}
+		maxZoom = z
+		if gw, gh := grid.MatrixSize(z); gw != w || gh != h || size != grid.TileSize {
+			return nil, 0, 0, fmt.Errorf("tile matrix %d of %s does not double the previous ones", z, g.Table)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+	for _, known := range []*Grid{WebMercator, Geodetic} {
+		if sameGrid(grid, known) {
+			grid = known
+		}
+	}
+	if minZoom < 0 {
+		minZoom, maxZoom = 0, 0
+	}
+	return grid, minZoom, maxZoom, nil
+}
+
+func sameGrid(a, b *Grid) bool {
+	eps := (b.Extent.Max[0] - b.Extent.Min[0]) * 1e-9
+	for i := range 2 {
+		if math.Abs(a.Extent.Min[i]-b.Extent.Min[i]) > eps || math.Abs(a.Extent.Max[i]-b.Extent.Max[i]) > eps {
+			return false
+		}
+	}
+	return a.EPSG == b.EPSG && a.TileSize == b.TileSize && a.Width == b.Width && a.Height == b.Height
+}
+
+var (
+	pngMagic  = []byte("\x89PNG")
+	jpegMagic = []byte{0xff, 0xd8, 0xff}
+)
+
+// sniffFormat detects the format of encoded tile data, anything that is no
+// image is taken as vector tile.
+func sniffFormat(data []byte) Format {
+	switch {
+	case len(data) == 0 || bytes.HasPrefix(data, pngMagic):
+		return PNG
+	case bytes.HasPrefix(data, jpegMagic):
+		return JPEG
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return WEBP
+	}
+	return PBF
+}
+
+func (g *GeoPackage) readMetadata(ctx context.Context) error {
+	var doc string
+	err := g.db.QueryRowContext(ctx, `SELECT m.id, m.metadata FROM gpkg_metadata m JOIN gpkg_metadata_reference r ON r.md_file_id = m.id
+WHERE r.reference_scope = 'table' AND r.table_name = ? AND m.mime_type = 'application/json' LIMIT 1`, g.Table).Scan(&g.mdID, &doc)
+	if errors.Is(err, sql.ErrNoRows) || isNoTable(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(doc), &g.Metadata)
+}
+
+// SetMetadata sets an entry of the metadata of the tiles table.
+func (g *GeoPackage) SetMetadata(name, value string) error {
+	md := make(map[string]string, len(g.Metadata)+1)
+	for k, v := range g.Metadata {
+		md[k] = v
+	}
+	md[name] = value
+	doc, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	if g.mdID != 0 {
+		_, err = g.db.Exec("UPDATE gpkg_metadata SET metadata = ? WHERE id = ?", string(doc), g.mdID)
+	} else {
+		err = g.insertMetadata(string(doc))
+	}
+	if err != nil {
+		return err
+	}
+	g.Metadata = md
+	return nil
+}
+
+func (g *GeoPackage) insertMetadata(doc string) error {
+	res, err := g.db.Exec("INSERT INTO gpkg_metadata (md_scope, md_standard_uri, mime_type, metadata) VALUES ('dataset', 'http://www.iana.org/assignments/media-types/application/json', 'application/json', ?)", doc)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if _, err := g.db.Exec("INSERT INTO gpkg_metadata_reference (reference_scope, table_name, md_file_id) VALUES ('table', ?, ?)", g.Table, id); err != nil {
+		return err
+	}
+	g.mdID = id
+	return nil
+}
+
+func (g *GeoPackage) Info() *Info {
+	return &g.info
+}
+
+func (g *GeoPackage) Tile(ctx context.Context, t Tile) (*TileData, error) {
+	if !g.info.Grid.Valid(t) {
+		return nil, ErrTileNotFound
+	}
+	var data []byte
+	err := g.db.QueryRowContext(ctx, "SELECT tile_data FROM "+quoteIdent(g.Table)+" WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?", t.Z, t.X, t.Y).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newTileData(data, g.modTime), nil
+}
+
+// PutTile writes a tile, replacing an existing one, and adds the tile
+// matrix of its zoom level when missing.
+func (g *GeoPackage) PutTile(ctx context.Context, t Tile, data []byte) error {
+	grid := g.info.Grid
+	if !grid.Valid(t) {
+		return fmt.Errorf("tiles: invalid tile %s", t)
+	}
+	w, h := grid.MatrixSize(t.Z)
+	dx, dy := grid.TileSpan(t.Z)
+	_, err := g.db.ExecContext(ctx, "INSERT OR IGNORE INTO gpkg_tile_matrix VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		g.Table, t.Z, w, h, grid.TileSize, grid.TileSize, dx/float64(grid.TileSize), dy/float64(grid.TileSize))
+	if err != nil {
+		return err
+	}
+	_, err = g.db.ExecContext(ctx, "INSERT OR REPLACE INTO "+quoteIdent(g.Table)+" (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)", t.Z, t.X, t.Y, data)
+	if err != nil {
+		return err
+	}
+	g.info.extendZoom(t.Z)
+	return nil
+}
+
+// Close closes the database. A writable GeoPackage updates the last change
+// of its tiles table first.
+func (g *GeoPackage) Close() error {
+	if g.writable {
+		if _, err := g.db.Exec("UPDATE gpkg_contents SET last_change = strftime('%Y-%m-%dT%H:%M:%fZ','now') WHERE table_name = ?", g.Table); err != nil {
+			g.db.Close()
+			return err
+		}
+	}
+	return g.db.Close()
+}
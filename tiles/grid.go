@@ -0,0 +1,220 @@
+// Package tiles serves XYZ and TMS map tiles over HTTP.
+//
+// Tiles are addressed with the XYZ convention where row 0 is the northern
+// edge of the grid. TMS addressing counts rows from the south and is
+// converted with Grid.FlipY.
+package tiles
+
+import (
+	"fmt"
+	"math"
+
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/proj"
+)
+
+// Tile is the address of a tile in a grid.
+type Tile struct {
+	Z, X, Y int
+}
+
+func (t Tile) String() string {
+	return fmt.Sprintf("%d/%d/%d", t.Z, t.X, t.Y)
+}
+
+// Parent returns the tile of the previous zoom level covering t.
+func (t Tile) Parent() Tile {
+	return Tile{Z: t.Z - 1, X: t.X >> 1, Y: t.Y >> 1}
+}
+
+// Children returns the four tiles of the next zoom level covered by t.
+func (t Tile) Children() [4]Tile {
+	x, y, z := t.X<<1, t.Y<<1, t.Z+1
+	return [4]Tile{{z, x, y}, {z, x + 1, y}, {z, x, y + 1}, {z, x + 1, y + 1}}
+}
+
+const WEB_MERCATOR_HALF_WIDTH = 20037508.342789244
+
+// Grid is a tile pyramid where every zoom level doubles the number of rows
+// and columns of the previous one.
+type Grid struct {
+	Name     string
+	EPSG     int                // code of the grid CRS
+	Extent   vec2.Rect[float64] // grid extent in CRS units, x east and y north
+	TileSize int                // tile width and height in pixels
+	Width    int                // number of columns at zoom 0
+	Height   int                // number of rows at zoom 0
+}
+
+var (
+	// WebMercator is the Google Maps compatible grid used by XYZ services.
+	WebMercator = &Grid{
+		Name:     "GoogleMapsCompatible",
+		EPSG:     3857,
+		Extent:   vec2.Rect[float64]{Min: vec2.Vec[float64]{-WEB_MERCATOR_HALF_WIDTH, -WEB_MERCATOR_HALF_WIDTH}, Max: vec2.Vec[float64]{WEB_MERCATOR_HALF_WIDTH, WEB_MERCATOR_HALF_WIDTH}},
+		TileSize: 256,
+		Width:    1,
+		Height:   1,
+	}
+	// Geodetic is the WGS84 grid with two tiles at zoom 0.
+	Geodetic = &Grid{
+		Name:     "WorldCRS84Quad",
+		EPSG:     4326,
+		Extent:   vec2.Rect[float64]{Min: vec2.Vec[float64]{-180, -90}, Max: vec2.Vec[float64]{180, 90}},
+		TileSize: 256,
+		Width:    2,
+		Height:   1,
+	}
+)
+
+// MatrixSize returns the number of columns and rows at zoom z.
+func (g *Grid) MatrixSize(z int) (int, int) {
+	return g.Width << z, g.Height << z
+}
+
+// TileSpan returns the width and height of a tile at zoom z in CRS units.
+func (g *Grid) TileSpan(z int) (float64, float64) {
+	w, h := g.MatrixSize(z)
+	return (g.Extent.Max[0] - g.Extent.Min[0]) / float64(w), (g.Extent.Max[1] - g.Extent.Min[1]) / float64(h)
+}
+
+// Resolution returns the horizontal size of a pixel at zoom z in CRS units.
+func (g *Grid) Resolution(z int) float64 {
+	w, _ := g.TileSpan(z)
+	return w / float64(g.TileSize)
+}
+
+// Valid reports whether t lies inside the grid.
+func (g *Grid) Valid(t Tile) bool {
+	if t.Z < 0 || t.Z > 30 {
+		return false
+	}
+	w, h := g.MatrixSize(t.Z)
+	return t.X >= 0 && t.Y >= 0 && t.X < w && t.Y < h
+}
+
+// FlipY converts between XYZ and TMS row numbering. Tiles of zooms outside
+// the grid are returned as they are.
+func (g *Grid) FlipY(t Tile) Tile {
+	if t.Z < 0 || t.Z > 30 {
+		return t
+	}
+	_, h := g.MatrixSize(t.Z)
+	t.Y = h - 1 - t.Y
+	return t
+}
+
+// TileBounds returns the extent of t in CRS units.
+func (g *Grid) TileBounds(t Tile) vec2.Rect[float64] {
+	dx, dy := g.TileSpan(t.Z)
+	minX := g.Extent.Min[0] + float64(t.X)*dx
+	maxY := g.Extent.Max[1] - float64(t.Y)*dy
+	return vec2.Rect[float64]{Min: vec2.Vec[float64]{minX, maxY - dy}, Max: vec2.Vec[float64]{minX + dx, maxY}}
+}
+
+// TileAt returns the tile at zoom z containing the CRS position x, y.
+// Positions outside the grid are clamped to the border tiles.
+func (g *Grid) TileAt(x, y float64, z int) Tile {
+	dx, dy := g.TileSpan(z)
+	w, h := g.MatrixSize(z)
+	col := int(math.Floor((x - g.Extent.Min[0]) / dx))
+	row := int(math.Floor((g.Extent.Max[1] - y) / dy))
+	return Tile{Z: z, X: min(max(col, 0), w-1), Y: min(max(row, 0), h-1)}
+}
+
+// TileRange returns the top left and bottom right tiles at zoom z covering
+// the CRS rectangle r.
+func (g *Grid) TileRange(r vec2.Rect[float64], z int) (Tile, Tile) {
+	// shrink the far edges so that a rectangle ending on a tile border does
+	// not pull in the next tile
+	dx, dy := g.TileSpan(z)
+	eps := 1e-9
+	return g.TileAt(r.Min[0], r.Max[1], z), g.TileAt(r.Max[0]-dx*eps, r.Min[1]+dy*eps, z)
+}
+
+// ZoomForResolution returns the first zoom level whose resolution is at
+// least as fine as res.
+func (g *Grid) ZoomForResolution(res float64) int {
+	z := 0
+	for z < 30 && g.Resolution(z) > res*(1+1e-9) {
+		z++
+	}
+	return z
+}
+
+// LonLat converts a WGS84 longitude and latitude to grid CRS units.
+func (g *Grid) LonLat(lon, lat float64) (float64, float64, error) {
+	switch g.EPSG {
+	case 4326:
+		return lon, lat, nil
+	case 3857:
+		x, y := lonLatToMercator(lon, lat)
+		return x, y, nil
+	}
+	wgs84, err := proj.FromEPSG(4326)
+	if err != nil {
+		return 0, 0, err
+	}
+	crs, err := proj.FromEPSG(g.EPSG)
+	if err != nil {
+		return 0, 0, err
+	}
+	x, y, _, err := proj.Transform(wgs84, crs, lon, lat, 0)
+	return x, y, err
+}
+
+// ToLonLat converts grid CRS units to WGS84 longitude and latitude.
+func (g *Grid) ToLonLat(x, y float64) (float64, float64, error) {
+	switch g.EPSG {
+	case 4326:
+		return x, y, nil
+	case 3857:
+		lon, lat := mercatorToLonLat(x, y)
+		return lon, lat, nil
+	}
+	wgs84, err := proj.FromEPSG(4326)
+	if err != nil {
+		return 0, 0, err
+	}
+	crs, err := proj.FromEPSG(g.EPSG)
+	if err != nil {
+		return 0, 0, err
+	}
+	lon, lat, _, err := proj.Transform(crs, wgs84, x, y, 0)
+	return lon, lat, err
+}
+
+// LonLatBounds returns the WGS84 extent of t.
+func (g *Grid) LonLatBounds(t Tile) (vec2.Rect[float64], error) {
+	b := g.TileBounds(t)
+	minLon, minLat, err := g.ToLonLat(b.Min[0], b.Min[1])
+	if err != nil {
+		return b, err
+	}
+	maxLon, maxLat, err := g.ToLonLat(b.Max[0], b.Max[1])
+	if err != nil {
+		return b, err
+	}
+	return vec2.Rect[float64]{Min: vec2.Vec[float64]{minLon, minLat}, Max: vec2.Vec[float64]{maxLon, maxLat}}, nil
+}
+
+// LonLatToTile returns the WebMercator tile at zoom z containing a WGS84
+// position.
+func LonLatToTile(lon, lat float64, z int) Tile {
+	x, y := lonLatToMercator(lon, lat)
+	return WebMercator.TileAt(x, y, z)
+}
+
+func lonLatToMercator(lon, lat float64) (float64, float64) {
+	const maxLat = 85.05112877980659
+	lat = math.Max(-maxLat, math.Min(maxLat, lat))
+	x := lon * WEB_MERCATOR_HALF_WIDTH / 180
+	y := math.Log(math.Tan((90+lat)*math.Pi/360)) * WEB_MERCATOR_HALF_WIDTH / math.Pi
+	return x, y
+}
+
+func mercatorToLonLat(x, y float64) (float64, float64) {
+	lon := x * 180 / WEB_MERCATOR_HALF_WIDTH
+	lat := math.Atan(math.Sinh(y*math.Pi/WEB_MERCATOR_HALF_WIDTH)) * 180 / math.Pi
+	return lon, lat
+}
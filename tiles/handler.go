@@ -0,0 +1,122 @@
+package tiles
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"pinkey.ltd/xr/utils"
+)
+
+// Handler serves tiles of a TileSource at paths ending in /{z}/{x}/{y}.{ext},
+// so it can be mounted under any prefix.
+type Handler struct {
+	Source       TileSource
+	TMS          bool   // rows in request paths count from the south
+	CacheControl string // value of the Cache-Control header, omitted when empty
+	AllowOrigin  string // value of Access-Control-Allow-Origin, CORS is off when empty
+}
+
+// NewHandler creates a handler that allows requests from any origin.
+func NewHandler(src TileSource) *Handler {
+	return &Handler{Source: src, CacheControl: "public, max-age=3600", AllowOrigin: "*"}
+}
+
+// ParseTilePath parses the trailing {z}/{x}/{y}.{ext} of p.
+func ParseTilePath(p string) (Tile, string, error) {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	if len(parts) < 3 {
+		return Tile{}, "", errors.New("tiles: path needs z/x/y")
+	}
+	parts = parts[len(parts)-3:]
+	ext := path.Ext(parts[2])
+	parts[2] = strings.TrimSuffix(parts[2], ext)
+	var v [3]int
+	for i, s := range parts {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return Tile{}, "", errors.New("tiles: invalid tile path " + p)
+		}
+		v[i] = n
+	}
+	return Tile{Z: v[0], X: v[1], Y: v[2]}, strings.TrimPrefix(ext, "."), nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !utils.AllowReadOnly(w, r, h.AllowOrigin) {
+		return
+	}
+
+	info := h.Source.Info()
+	t, ext, err := ParseTilePath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ext != "" {
+		if f, err := ParseFormat(ext); err != nil || f != info.Format {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	if !info.Grid.Valid(t) {
+		http.NotFound(w, r)
+		return
+	}
+	if h.TMS {
+		t = info.Grid.FlipY(t)
+	}
+	h.ServeTile(w, r, t)
+}
+
+// ServeTile writes tile t of the source with caching headers, compressing
+// or decompressing the content to match the Accept-Encoding of r.
+func (h *Handler) ServeTile(w http.ResponseWriter, r *http.Request, t Tile) {
+	info := h.Source.Info()
+	if !info.Grid.Valid(t) || t.Z < info.MinZoom || t.Z > info.MaxZoom {
+		http.NotFound(w, r)
+		return
+	}
+	td, err := h.Source.Tile(r.Context(), t)
+	if errors.Is(err, ErrTileNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body, encoding := td.Data, td.Encoding
+	gz := utils.AcceptsGzip(r)
+	switch {
+	case encoding == "gzip" && !gz:
+		if body, err = utils.Gunzip(body); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		encoding = ""
+	case encoding == "" && gz && info.Format.Compressible():
+		body, encoding = utils.Gzip(body), "gzip"
+	}
+
+	hd := w.Header()
+	hd.Set("Content-Type", info.Format.ContentType())
+	if encoding != "" {
+		hd.Set("Content-Encoding", encoding)
+	}
+	if td.Encoding != "" || info.Format.Compressible() {
+		hd.Add("Vary", "Accept-Encoding")
+	}
+	if h.CacheControl != "" {
+		hd.Set("Cache-Control", h.CacheControl)
+	}
+	sum := sha1.Sum(body)
+	hd.Set("ETag", `"`+hex.EncodeToString(sum[:10])+`"`)
+	http.ServeContent(w, r, "", td.ModTime, bytes.NewReader(body))
+}
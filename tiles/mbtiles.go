@@ -0,0 +1,229 @@
+package tiles
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"pinkey.ltd/xr/go3d/vec2"
+
+	_ "modernc.org/sqlite"
+)
+
+// MBTiles reads and writes tiles of an MBTiles 1.3 database. The embedded
+// TilesetFiles keeps a 3D Tiles tileset in the same file.
+type MBTiles struct {
+	TilesetFiles
+	info     Info
+	writable bool
+	Metadata map[string]string
+}
+
+// sqliteDSN returns the URI of the file at path opened in mode, with any
+// '?', '#' or '%' of the path escaped.
+func sqliteDSN(path, mode string) string {
+	u := url.URL{Scheme: "file", Path: path, RawQuery: "mode=" + mode, OmitHost: true}
+	return u.String()
+}
+
+// OpenMBTiles opens an MBTiles file for reading.
+func OpenMBTiles(path string) (*MBTiles, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", sqliteDSN(path, "ro"))
+	if err != nil {
+		return nil, err
+	}
+	m := &MBTiles{TilesetFiles: TilesetFiles{db: db, modTime: st.ModTime()}, Metadata: map[string]string{}}
+	if err := m.readMetadata(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("tiles: %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// CreateMBTiles creates an MBTiles file, or opens an existing one, for
+// writing. The name, format and bounds of info go to the metadata table,
+// the zoom range follows the tiles written.
+func CreateMBTiles(path string, info Info) (*MBTiles, error) {
+	if info.Grid != nil && info.Grid != WebMercator {
+		return nil, fmt.Errorf("tiles: MBTiles needs the WebMercator grid, not %s", info.Grid.Name)
+	}
+	db, err := sql.Open("sqlite", sqliteDSN(path, "rwc"))
+	if err != nil {
+		return nil, err
+	}
+	m := &MBTiles{TilesetFiles: TilesetFiles{db: db, modTime: time.Now()}, writable: true, Metadata: map[string]string{}}
+	if err := m.create(info); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("tiles: %s: %w", path, err)
+	}
+	return m, nil
+}
+
+func (m *MBTiles) create(info Info) error {
+	ctx := context.Background()
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS metadata (name TEXT PRIMARY KEY NOT NULL, value TEXT);
+CREATE TABLE IF NOT EXISTS tiles (zoom_level INTEGER NOT NULL, tile_column INTEGER NOT NULL, tile_row INTEGER NOT NULL, tile_data BLOB NOT NULL);
+CREATE UNIQUE INDEX IF NOT EXISTS tile_index ON tiles (zoom_level, tile_column, tile_row)`)
+	if err != nil {
+		return err
+	}
+	if err := m.createTable(ctx); err != nil {
+		return err
+	}
+	if info.Format == "" {
+		info.Format = PNG
+	}
+	if info.Bounds == (vec2.Rect[float64]{}) {
+		info.Bounds = vec2.Rect[float64]{Min: vec2.Vec[float64]{-180, -85.05112877980659}, Max: vec2.Vec[float64]{180, 85.05112877980659}}
+	}
+	b := info.Bounds
+	meta := [][2]string{
+		{"name", info.Name},
+		{"format", string(info.Format)},
+		{"bounds", fmt.Sprintf("%g,%g,%g,%g", b.Min[0], b.Min[1], b.Max[0], b.Max[1])},
+	}
+	for _, kv := range meta {
+		if err := m.SetMetadata(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	if err := m.readMetadata(); err != nil {
+		return err
+	}
+	var n int
+	if err := m.db.QueryRowContext(ctx, "SELECT count(*) FROM tiles").Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		m.info.MinZoom, m.info.MaxZoom = -1, -1
+	}
+	return nil
+}
+
+// SetMetadata sets a row of the metadata table.
+func (m *MBTiles) SetMetadata(name, value string) error {
+	// the metadata table of older files has no primary key to replace on
+	if _, err := m.db.Exec("DELETE FROM metadata WHERE name = ?", name); err != nil {
+		return err
+	}
+	if _, err := m.db.Exec("INSERT INTO metadata (name, value) VALUES (?, ?)", name, value); err != nil {
+		return err
+	}
+	m.Metadata[name] = value
+	return nil
+}
+
+// PutTile writes a tile, replacing an existing one. Like Tile, t is in XYZ
+// addressing.
+func (m *MBTiles) PutTile(ctx context.Context, t Tile, data []byte) error {
+	if !m.info.Grid.Valid(t) {
+		return fmt.Errorf("tiles: invalid tile %s", t)
+	}
+	r := m.info.Grid.FlipY(t)
+	_, err := m.db.ExecContext(ctx, "INSERT OR REPLACE INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)", r.Z, r.X, r.Y, data)
+	if err != nil {
+		return err
+	}
+	m.info.extendZoom(t.Z)
+	return nil
+}
+
+func (m *MBTiles) readMetadata() error {
+	rows, err := m.db.Query("SELECT name, value FROM metadata")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+		m.Metadata[k] = v
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	m.info = Info{Name: m.Metadata["name"], Grid: WebMercator, Format: PNG}
+	if s := m.Metadata["format"]; s != "" {
+		if m.info.Format, err = ParseFormat(s); err != nil {
+			return err
+		}
+	}
+	minZoom, errMin := strconv.Atoi(m.Metadata["minzoom"])
+	maxZoom, errMax := strconv.Atoi(m.Metadata["maxzoom"])
+	if errMin != nil || errMax != nil {
+		var lo, hi sql.NullInt64
+		if err := m.db.QueryRow("SELECT min(zoom_level), max(zoom_level) FROM tiles").Scan(&lo, &hi); err != nil {
+			return err
+		}
+		minZoom, maxZoom = int(lo.Int64), int(hi.Int64)
+	}
+	m.info.MinZoom, m.info.MaxZoom = minZoom, maxZoom
+	m.info.Bounds = vec2.Rect[float64]{Min: vec2.Vec[float64]{-180, -85.05112877980659}, Max: vec2.Vec[float64]{180, 85.05112877980659}}
+	if b, err := parseBounds(m.Metadata["bounds"]); err == nil {
+		m.info.Bounds = b
+	}
+	return nil
+}
+
+func parseBounds(s string) (vec2.Rect[float64], error) {
+	var v [4]float64
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return vec2.Rect[float64]{}, fmt.Errorf("tiles: invalid bounds %q", s)
+	}
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return vec2.Rect[float64]{}, err
+		}
+		v[i] = f
+	}
+	return vec2.Rect[float64]{Min: vec2.Vec[float64]{v[0], v[1]}, Max: vec2.Vec[float64]{v[2], v[3]}}, nil
+}
+
+func (m *MBTiles) Info() *Info {
+	return &m.info
+}
+
+// Tile reads a tile. MBTiles stores TMS rows, the row of t is flipped.
+func (m *MBTiles) Tile(ctx context.Context, t Tile) (*TileData, error) {
+	if !m.info.Grid.Valid(t) {
+		return nil, ErrTileNotFound
+	}
+	t = m.info.Grid.FlipY(t)
+	var data []byte
+	err := m.db.QueryRowContext(ctx, "SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?", t.Z, t.X, t.Y).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newTileData(data, m.modTime), nil
+}
+
+// Close closes the database. A writable MBTiles records the zoom range of
+// its tiles first.
+func (m *MBTiles) Close() error {
+	if m.writable && m.info.MaxZoom >= 0 {
+		err := errors.Join(m.SetMetadata("minzoom", strconv.Itoa(m.info.MinZoom)), m.SetMetadata("maxzoom", strconv.Itoa(m.info.MaxZoom)))
+		if err != nil {
+			m.db.Close()
+			return err
+		}
+	}
+	return m.db.Close()
+}
@@ -0,0 +1,194 @@
+package tiles
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pinkey.ltd/xr/go3d/vec2"
+)
+
+// ErrTileNotFound is returned by a TileSource for tiles it does not have.
+var ErrTileNotFound = errors.New("tiles: tile not found")
+
+// Format is the encoding of the tiles of a source, named after the file
+// extension.
+type Format string
+
+const (
+	PNG  Format = "png"
+	JPEG Format = "jpg"
+	WEBP Format = "webp"
+	PBF  Format = "pbf"
+)
+
+var formatContentTypes = map[Format]string{
+	PNG:  "image/png",
+	JPEG: "image/jpeg",
+	WEBP: "image/webp",
+	PBF:  "application/vnd.mapbox-vector-tile",
+}
+
+// ParseFormat parses a file extension or MBTiles format name.
+func ParseFormat(s string) (Format, error) {
+	s = strings.ToLower(strings.TrimPrefix(s, "."))
+	switch s {
+	case "jpeg":
+		return JPEG, nil
+	case "mvt":
+		return PBF, nil
+	}
+	if _, ok := formatContentTypes[Format(s)]; !ok {
+		return "", fmt.Errorf("tiles: unsupported tile format %q", s)
+	}
+	return Format(s), nil
+}
+
+func (f Format) ContentType() string {
+	if ct, ok := formatContentTypes[f]; ok {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// Compressible reports whether tiles of the format benefit from gzip.
+func (f Format) Compressible() bool {
+	return f == PBF
+}
+
+// Info describes a tile source.
+type Info struct {
+	Name    string
+	Format  Format
+	Grid    *Grid
+	MinZoom int
+	MaxZoom int
+	Bounds  vec2.Rect[float64] // WGS84 longitude and latitude
+}
+
+// extendZoom widens the zoom range to z, a negative MaxZoom is an empty range.
+func (i *Info) extendZoom(z int) {
+	if i.MaxZoom < 0 {
+		i.MinZoom, i.MaxZoom = z, z
+		return
+	}
+	i.MinZoom, i.MaxZoom = min(i.MinZoom, z), max(i.MaxZoom, z)
+}
+
+// TileData is the encoded content of a tile.
+type TileData struct {
+	Data     []byte
+	Encoding string // content encoding of Data, "gzip" or empty
+	ModTime  time.Time
+}
+
+// TileSource provides the tiles of a tile pyramid. Tiles are addressed in
+// the XYZ convention of Info().Grid.
+type TileSource interface {
+	Info() *Info
+	Tile(ctx context.Context, t Tile) (*TileData, error)
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func newTileData(data []byte, mod time.Time) *TileData {
+	td := &TileData{Data: data, ModTime: mod}
+	if bytes.HasPrefix(data, gzipMagic) {
+		td.Encoding = "gzip"
+	}
+	return td
+}
+
+// DirSource reads tiles stored as {z}/{x}/{y}.{ext} files.
+type DirSource struct {
+	Root string
+	TMS  bool // rows in file names count from the south
+	info Info
+}
+
+// NewDirSource opens a tile directory. The zoom range is taken from the
+// numeric sub directories and an empty format is detected from the first
+// tile found.
+func NewDirSource(root string, format Format) (*DirSource, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var zooms []int
+	for _, e := range entries {
+		if z, err := strconv.Atoi(e.Name()); err == nil && e.IsDir() && z >= 0 {
+			zooms = append(zooms, z)
+		}
+	}
+	if len(zooms) == 0 {
+		return nil, fmt.Errorf("tiles: no zoom levels in %s", root)
+	}
+	sort.Ints(zooms)
+	if format == "" {
+		if format, err = detectFormat(filepath.Join(root, strconv.Itoa(zooms[0]))); err != nil {
+			return nil, err
+		}
+	}
+	return &DirSource{
+		Root: root,
+		info: Info{
+			Name:    filepath.Base(root),
+			Format:  format,
+			Grid:    WebMercator,
+			MinZoom: zooms[0],
+			MaxZoom: zooms[len(zooms)-1],
+			Bounds:  vec2.Rect[float64]{Min: vec2.Vec[float64]{-180, -85.05112877980659}, Max: vec2.Vec[float64]{180, 85.05112877980659}},
+		},
+	}, nil
+}
+
+func detectFormat(dir string) (Format, error) {
+	var found Format
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if f, err := ParseFormat(filepath.Ext(path)); err == nil {
+			found = f
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err == nil && found == "" {
+		err = fmt.Errorf("tiles: no tiles in %s", dir)
+	}
+	return found, err
+}
+
+func (s *DirSource) Info() *Info {
+	return &s.info
+}
+
+func (s *DirSource) Tile(ctx context.Context, t Tile) (*TileData, error) {
+	if !s.info.Grid.Valid(t) {
+		return nil, ErrTileNotFound
+	}
+	if s.TMS {
+		t = s.info.Grid.FlipY(t)
+	}
+	path := filepath.Join(s.Root, strconv.Itoa(t.Z), strconv.Itoa(t.X), strconv.Itoa(t.Y)+"."+string(s.info.Format))
+	st, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrTileNotFound
+		}
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newTileData(data, st.ModTime()), nil
+}
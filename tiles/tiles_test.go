@@ -0,0 +1,449 @@
+package tiles
+
+import (
+	"database/sql"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/mst"
+	"pinkey.ltd/xr/tiles3d"
+	"pinkey.ltd/xr/utils"
+)
+
+func TestWebMercatorGrid(t *testing.T) {
+	g := WebMercator
+	assert.InDelta(t, 156543.03392804097, g.Resolution(0), 1e-6)
+	assert.InDelta(t, 0.5971642834779395, g.Resolution(18), 1e-9)
+
+	tests := []struct {
+		lon, lat float64
+		z        int
+		tile     Tile
+	}{
+		{0, 0, 0, Tile{0, 0, 0}},
+		{0.1, 0.1, 1, Tile{1, 1, 0}},
+		{-0.1, -0.1, 1, Tile{1, 0, 1}},
+		{116.391, 39.907, 10, Tile{10, 843, 388}},
+		{-122.4194, 37.7749, 12, Tile{12, 655, 1583}},
+		{180, -90, 3, Tile{3, 7, 7}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.tile, LonLatToTile(tt.lon, tt.lat, tt.z))
+	}
+
+	b, err := g.LonLatBounds(Tile{1, 1, 0})
+	assert.Nil(t, err)
+	assert.InDelta(t, 0, b.Min[0], 1e-9)
+	assert.InDelta(t, 180, b.Max[0], 1e-9)
+	assert.InDelta(t, 0, b.Min[1], 1e-9)
+	assert.InDelta(t, 85.05112877980659, b.Max[1], 1e-9)
+
+	x, y, err := g.LonLat(116.391, 39.907)
+	assert.Nil(t, err)
+	lon, lat, err := g.ToLonLat(x, y)
+	assert.Nil(t, err)
+	assert.InDelta(t, 116.391, lon, 1e-9)
+	assert.InDelta(t, 39.907, lat, 1e-9)
+}
+
+func TestGeodeticGrid(t *testing.T) {
+	g := Geodetic
+	w, h := g.MatrixSize(2)
+	assert.Equal(t, 8, w)
+	assert.Equal(t, 4, h)
+	assert.Equal(t, 180.0/256, g.Resolution(0))
+	assert.Equal(t, vec2.Rect[float64]{Min: vec2.Vec[float64]{-180, -90}, Max: vec2.Vec[float64]{0, 90}}, g.TileBounds(Tile{0, 0, 0}))
+	assert.Equal(t, Tile{1, 3, 0}, g.TileAt(135, 45, 1))
+
+	lo, hi := g.TileRange(vec2.Rect[float64]{Min: vec2.Vec[float64]{-90, 0}, Max: vec2.Vec[float64]{90, 90}}, 1)
+	assert.Equal(t, Tile{1, 1, 0}, lo)
+	assert.Equal(t, Tile{1, 2, 0}, hi)
+
+	assert.Equal(t, Tile{2, 5, 3}, g.FlipY(Tile{2, 5, 0}))
+	assert.True(t, g.Valid(Tile{2, 7, 3}))
+	assert.False(t, g.Valid(Tile{2, 8, 0}))
+	assert.False(t, g.Valid(Tile{2, 0, -1}))
+	assert.Equal(t, 3, g.ZoomForResolution(g.Resolution(3)))
+
+	assert.Equal(t, Tile{3, 4, 6}, Tile{4, 9, 13}.Parent())
+	assert.Equal(t, Tile{5, 19, 27}, Tile{4, 9, 13}.Children()[3])
+	assert.Equal(t, "4/9/13", Tile{4, 9, 13}.String())
+}
+
+func writeTile(t *testing.T, root string, tile Tile, ext string, data []byte) {
+	dir := filepath.Join(root, strconv.Itoa(tile.Z), strconv.Itoa(tile.X))
+	assert.Nil(t, os.MkdirAll(dir, 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, strconv.Itoa(tile.Y)+"."+ext), data, 0o644))
+}
+
+func TestDirSource(t *testing.T) {
+	root := t.TempDir()
+	writeTile(t, root, Tile{1, 1, 0}, "png", []byte("tile-1-1-0"))
+	writeTile(t, root, Tile{3, 2, 5}, "png", []byte("tile-3-2-5"))
+
+	src, err := NewDirSource(root, "")
+	assert.Nil(t, err)
+	assert.Equal(t, PNG, src.Info().Format)
+	assert.Equal(t, 1, src.Info().MinZoom)
+	assert.Equal(t, 3, src.Info().MaxZoom)
+
+	td, err := src.Tile(t.Context(), Tile{1, 1, 0})
+	assert.Nil(t, err)
+	assert.Equal(t, "tile-1-1-0", string(td.Data))
+	_, err = src.Tile(t.Context(), Tile{1, 0, 0})
+	assert.Equal(t, ErrTileNotFound, err)
+
+	// the same files read as TMS
+	src.TMS = true
+	td, err = src.Tile(t.Context(), Tile{3, 2, 2})
+	assert.Nil(t, err)
+	assert.Equal(t, "tile-3-2-5", string(td.Data))
+
+	_, err = NewDirSource(t.TempDir(), PNG)
+	assert.NotNil(t, err)
+}
+
+func createMBTiles(t *testing.T, meta map[string]string, tiles map[Tile][]byte) string {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := sql.Open("sqlite", path)
+	assert.Nil(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE metadata (name text, value text); CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob)")
+	assert.Nil(t, err)
+	for k, v := range meta {
+		_, err = db.Exec("INSERT INTO metadata VALUES (?, ?)", k, v)
+		assert.Nil(t, err)
+	}
+	for tile, data := range tiles {
+		_, err = db.Exec("INSERT INTO tiles VALUES (?, ?, ?, ?)", tile.Z, tile.X, tile.Y, data)
+		assert.Nil(t, err)
+	}
+	return path
+}
+
+func TestMBTiles(t *testing.T) {
+	path := createMBTiles(t, map[string]string{
+		"name":   "roads",
+		"format": "pbf",
+		"bounds": "115.5,39.5,117.5,41",
+	}, map[Tile][]byte{
+		{2, 3, 1}: utils.Gzip([]byte("vector")), // TMS row 1 is XYZ row 2
+		{4, 1, 1}: []byte("deep"),
+	})
+	m, err := OpenMBTiles(path)
+	assert.Nil(t, err)
+	defer m.Close()
+
+	info := m.Info()
+	assert.Equal(t, "roads", info.Name)
+	assert.Equal(t, PBF, info.Format)
+	assert.Equal(t, 2, info.MinZoom)
+	assert.Equal(t, 4, info.MaxZoom)
+	assert.Equal(t, vec2.Vec[float64]{115.5, 39.5}, info.Bounds.Min)
+
+	td, err := m.Tile(t.Context(), Tile{2, 3, 2})
+	assert.Nil(t, err)
+	assert.Equal(t, "gzip", td.Encoding)
+	_, err = m.Tile(t.Context(), Tile{2, 3, 1})
+	assert.Equal(t, ErrTileNotFound, err)
+
+	_, err = OpenMBTiles(filepath.Join(t.TempDir(), "missing.mbtiles"))
+	assert.NotNil(t, err)
+}
+
+func testTileset(t *testing.T) tiles3d.Files {
+	ms := mst.NewMesh[float32]()
+	nd := &mst.MeshNode[float32]{Vertices: []vec3.Vec[float32]{{0, 0, 0}, {10, 0, 0}, {0, 10, 5}}}
+	nd.FaceGroup = []*mst.MeshTriangle{{Faces: []*mst.Face{{Vertex: [3]uint32{0, 1, 2}}}}}
+	ms.Nodes = append(ms.Nodes, nd)
+	ms.Materials = append(ms.Materials, &mst.BaseMaterial{Color: [3]byte{0, 128, 255}})
+	files, err := tiles3d.FromMesh(ms, 116.4, 39.9, 0)
+	assert.Nil(t, err)
+	return files
+}
+
+func TestMBTilesWrite(t *testing.T) {
+	// characters of the URI stay in the file name
+	path := filepath.Join(t.TempDir(), "write?mode=ro#1%.mbtiles")
+	m, err := CreateMBTiles(path, Info{Name: "roads", Format: PBF, Bounds: vec2.Rect[float64]{Min: vec2.Vec[float64]{115, 39}, Max: vec2.Vec[float64]{118, 41}}})
+	assert.Nil(t, err)
+	assert.Equal(t, -1, m.Info().MaxZoom)
+	assert.Nil(t, m.PutTile(t.Context(), Tile{3, 6, 3}, []byte("first")))
+	assert.Nil(t, m.PutTile(t.Context(), Tile{3, 6, 3}, []byte("replaced")))
+	assert.Nil(t, m.PutTile(t.Context(), Tile{5, 26, 12}, []byte("deep")))
+	assert.NotNil(t, m.PutTile(t.Context(), Tile{1, 2, 0}, []byte("outside")))
+	assert.Nil(t, m.SetMetadata("attribution", "xr"))
+	tileset := testTileset(t)
+	assert.Nil(t, m.PutFS(t.Context(), tileset))
+	assert.Nil(t, m.Close())
+	_, err = os.Stat(path)
+	assert.Nil(t, err)
+
+	m, err = OpenMBTiles(path)
+	assert.Nil(t, err)
+	defer m.Close()
+	info := m.Info()
+	assert.Equal(t, "roads", info.Name)
+	assert.Equal(t, PBF, info.Format)
+	assert.Equal(t, 3, info.MinZoom)
+	assert.Equal(t, 5, info.MaxZoom)
+	assert.Equal(t, vec2.Vec[float64]{118, 41}, info.Bounds.Max)
+	assert.Equal(t, "xr", m.Metadata["attribution"])
+	td, err := m.Tile(t.Context(), Tile{3, 6, 3})
+	assert.Nil(t, err)
+	assert.Equal(t, "replaced", string(td.Data))
+
+	// rows are stored in TMS order
+	var row int
+	assert.Nil(t, m.db.QueryRow("SELECT tile_row FROM tiles WHERE zoom_level = 5").Scan(&row))
+	assert.Equal(t, 19, row)
+
+	fsys := m.FS()
+	for name, want := range tileset {
+		data, err := fs.ReadFile(fsys, name)
+		assert.Nil(t, err)
+		assert.Equal(t, want, data)
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	assert.Nil(t, err)
+	assert.Equal(t, len(tileset), len(entries))
+	_, err = m.File(t.Context(), "missing.glb")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// files without a tileset table have no tileset files
+	old, err := OpenMBTiles(createMBTiles(t, map[string]string{}, nil))
+	assert.Nil(t, err)
+	defer old.Close()
+	_, err = fs.ReadFile(old.FS(), tiles3d.TILESET_FILE)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = CreateMBTiles(filepath.Join(t.TempDir(), "geodetic.mbtiles"), Info{Grid: Geodetic})
+	assert.NotNil(t, err)
+}
+
+func TestTilesetFilesNonASCII(t *testing.T) {
+	// directory names longer in bytes than in characters
+	nested := fstest.MapFS{
+		"瓦片/0/0.b3dm":   {Data: []byte("zero")},
+		"瓦片/1.b3dm":     {Data: []byte("one")},
+		"瓦片0/2.b3dm":    {Data: []byte("two")},
+		"ä/é/tile.b3dm": {Data: []byte("three")},
+	}
+	path := filepath.Join(t.TempDir(), "nested.mbtiles")
+	m, err := CreateMBTiles(path, Info{Format: PBF})
+	assert.Nil(t, err)
+	assert.Nil(t, m.PutFS(t.Context(), nested))
+	assert.Nil(t, m.Close())
+
+	m, err = OpenMBTiles(path)
+	assert.Nil(t, err)
+	defer m.Close()
+	fsys := m.FS()
+	var walked []string
+	assert.Nil(t, fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			walked = append(walked, p)
+			data, err := fs.ReadFile(fsys, p)
+			assert.Nil(t, err)
+			assert.Equal(t, nested[p].Data, data)
+		}
+		return err
+	}))
+	assert.ElementsMatch(t, []string{"瓦片/0/0.b3dm", "瓦片/1.b3dm", "瓦片0/2.b3dm", "ä/é/tile.b3dm"}, walked)
+	entries, err := fs.ReadDir(fsys, "瓦片")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	_, err = fs.ReadDir(fsys, "瓦")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestGeoPackage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.gpkg")
+	tests := []struct {
+		table  string
+		grid   *Grid
+		format Format
+		tile   Tile
+		data   []byte
+	}{
+		{"imagery", WebMercator, PNG, Tile{2, 3, 1}, []byte("\x89PNG\r\n\x1a\nimage")},
+		{"elevation", Geodetic, JPEG, Tile{1, 3, 0}, []byte{0xff, 0xd8, 0xff, 0xe0}},
+	}
+	for _, tt := range tests {
+		g, err := CreateGeoPackage(path, tt.table, Info{Name: tt.table + " tiles", Grid: tt.grid, Format: tt.format})
+		assert.Nil(t, err)
+		assert.Nil(t, g.PutTile(t.Context(), tt.tile, tt.data))
+		assert.Nil(t, g.PutTile(t.Context(), Tile{0, 0, 0}, tt.data))
+		assert.Nil(t, g.SetMetadata("source", tt.table))
+		assert.Nil(t, g.SetMetadata("license", "CC0"))
+		assert.Nil(t, g.Close())
+	}
+	g, err := CreateGeoPackage(path, "imagery", Info{})
+	assert.Nil(t, err)
+	tileset := testTileset(t)
+	assert.Nil(t, g.PutFS(t.Context(), tileset))
+	assert.Nil(t, g.Close())
+
+	for _, tt := range tests {
+		g, err := OpenGeoPackage(path, tt.table)
+		assert.Nil(t, err)
+		info := g.Info()
+		assert.Equal(t, tt.table+" tiles", info.Name)
+		assert.Equal(t, tt.grid, info.Grid)
+		assert.Equal(t, tt.format, info.Format)
+		assert.Equal(t, 0, info.MinZoom)
+		assert.Equal(t, tt.tile.Z, info.MaxZoom)
+		assert.InDelta(t, 180, info.Bounds.Max[0], 1e-9)
+		assert.Equal(t, map[string]string{"source": tt.table, "license": "CC0"}, g.Metadata)
+		td, err := g.Tile(t.Context(), tt.tile)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.data, td.Data)
+		_, err = g.Tile(t.Context(), Tile{tt.tile.Z, 0, 0})
+		assert.Equal(t, ErrTileNotFound, err)
+		assert.Nil(t, g.Close())
+	}
+
+	g, err = OpenGeoPackage(path, "")
+	assert.Nil(t, err)
+	defer g.Close()
+	assert.Equal(t, "elevation", g.Table)
+	data, err := fs.ReadFile(g.FS(), tiles3d.TILESET_FILE)
+	assert.Nil(t, err)
+	assert.Equal(t, tileset[tiles3d.TILESET_FILE], data)
+	var appID, ext int
+	assert.Nil(t, g.db.QueryRow("PRAGMA application_id").Scan(&appID))
+	assert.Equal(t, GPKG_APPLICATION_ID, appID)
+	assert.Nil(t, g.db.QueryRow("SELECT count(*) FROM gpkg_extensions WHERE extension_name = ?", GPKG_TILESET_EXTENSION).Scan(&ext))
+	assert.Equal(t, 1, ext)
+
+	_, err = OpenGeoPackage(path, "missing")
+	assert.NotNil(t, err)
+}
+
+func TestHandler(t *testing.T) {
+	root := t.TempDir()
+	writeTile(t, root, Tile{2, 1, 1}, "png", []byte("png-data"))
+	src, err := NewDirSource(root, PNG)
+	assert.Nil(t, err)
+	srv := httptest.NewServer(http.StripPrefix("/tiles", NewHandler(src)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/tiles/2/1/1.png")
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "png-data", string(body))
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, resp.Header.Get("Last-Modified"))
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/tiles/2/1/1.png", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/tiles/2/1/1.png", nil)
+	req.Header.Set("If-Modified-Since", "Sat, 01 Jan 2100 00:00:00 GMT")
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	for path, code := range map[string]int{
+		"/tiles/2/1/2.png": http.StatusNotFound,
+		"/tiles/2/1/1.jpg": http.StatusNotFound,
+		"/tiles/9/1/1.png": http.StatusNotFound,
+		"/tiles/2/x/1.png": http.StatusBadRequest,
+	} {
+		resp, err = http.Get(srv.URL + path)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, code, resp.StatusCode, path)
+	}
+
+	req, _ = http.NewRequest(http.MethodOptions, srv.URL+"/tiles/2/1/1.png", nil)
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Access-Control-Allow-Methods"), "GET")
+
+	// TMS request rows are flipped: XYZ row 1 at zoom 2 is TMS row 2
+	h := NewHandler(src)
+	h.TMS = true
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/2/1/2.png", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "png-data", rec.Body.String())
+	for _, path := range []string{"/-1/0/0.png", "/31/0/0.png", "/64/0/0.png", "/2/0/4.png"} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code, path)
+	}
+	assert.Equal(t, Tile{-1, 0, 5}, WebMercator.FlipY(Tile{-1, 0, 5}))
+	assert.Equal(t, Tile{64, 0, 5}, WebMercator.FlipY(Tile{64, 0, 5}))
+}
+
+func TestHandlerGzip(t *testing.T) {
+	path := createMBTiles(t, map[string]string{"format": "pbf", "minzoom": "0", "maxzoom": "4"}, map[Tile][]byte{
+		{1, 0, 0}: utils.Gzip([]byte("stored-gzip")),
+	})
+	m, err := OpenMBTiles(path)
+	assert.Nil(t, err)
+	defer m.Close()
+	root := t.TempDir()
+	writeTile(t, root, Tile{1, 0, 1}, "pbf", []byte("plain"))
+	dir, err := NewDirSource(root, PBF)
+	assert.Nil(t, err)
+
+	get := func(h http.Handler, path string, gzip bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if gzip {
+			req.Header.Set("Accept-Encoding", "gzip, deflate")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get(NewHandler(m), "/1/0/1.pbf", true)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "application/vnd.mapbox-vector-tile", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+	plain, err := utils.Gunzip(rec.Body.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, "stored-gzip", string(plain))
+
+	rec = get(NewHandler(m), "/1/0/1.pbf", false)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "stored-gzip", rec.Body.String())
+
+	rec = get(NewHandler(dir), "/1/0/1.mvt", true)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	plain, err = utils.Gunzip(rec.Body.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, "plain", string(plain))
+
+	// a zero quality refuses gzip however it is written
+	req := httptest.NewRequest(http.MethodGet, "/1/0/1.pbf", nil)
+	req.Header.Set("Accept-Encoding", "br, gzip;q=0.0")
+	rec = httptest.NewRecorder()
+	NewHandler(m).ServeHTTP(rec, req)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "stored-gzip", rec.Body.String())
+}
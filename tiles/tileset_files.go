@@ -0,0 +1,188 @@
+package tiles
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// TILESET_TABLE holds the files of a 3D Tiles tileset, such as the tileset
+// JSON and the tile contents, keyed by their slash separated path.
+const TILESET_TABLE = "tileset_files"
+
+// TilesetFiles stores a 3D Tiles tileset next to the tiles of a database,
+// so that a whole tileset ships as one file.
+type TilesetFiles struct {
+	db      *sql.DB
+	modTime time.Time
+}
+
+func (f *TilesetFiles) createTable(ctx context.Context) error {
+	_, err := f.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+TILESET_TABLE+" (path TEXT PRIMARY KEY NOT NULL, data BLOB NOT NULL)")
+	return err
+}
+
+// PutFile stores a file of the tileset, replacing a file with the same path.
+func (f *TilesetFiles) PutFile(ctx context.Context, name string, data []byte) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "put", Path: name, Err: fs.ErrInvalid}
+	}
+	_, err := f.db.ExecContext(ctx, "INSERT OR REPLACE INTO "+TILESET_TABLE+" (path, data) VALUES (?, ?)", name, data)
+	return err
+}
+
+// PutFS stores every file of fsys.
+func (f *TilesetFiles) PutFS(ctx context.Context, fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		return f.PutFile(ctx, name, data)
+	})
+}
+
+// File reads a file of the tileset. Missing files yield fs.ErrNotExist.
+func (f *TilesetFiles) File(ctx context.Context, name string) ([]byte, error) {
+	var data []byte
+	err := f.db.QueryRowContext(ctx, "SELECT data FROM "+TILESET_TABLE+" WHERE path = ?", name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) || isNoTable(err) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return data, err
+}
+
+// FS gives access to the tileset files, for example to serve them.
+func (f *TilesetFiles) FS() fs.FS {
+	return tilesetFS{f}
+}
+
+func isNoTable(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no such table")
+}
+
+type tilesetFS struct {
+	f *TilesetFiles
+}
+
+func (t tilesetFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	ctx := context.Background()
+	if name != "." {
+		data, err := t.f.File(ctx, name)
+		if err == nil {
+			return &blobFile{Reader: bytes.NewReader(data), info: blobInfo{name: path.Base(name), size: int64(len(data)), mod: t.f.modTime}}, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	// a directory lists the paths below it, compared as bytes so that the
+	// range ends before the paths of name followed by '0', next to '/'
+	prefix := name + "/"
+	query, args := "SELECT path, length(data) FROM "+TILESET_TABLE+" WHERE path >= ? AND path < ? ORDER BY path", []any{prefix, name + "0"}
+	if name == "." {
+		prefix = ""
+		query, args = "SELECT path, length(data) FROM "+TILESET_TABLE+" ORDER BY path", nil
+	}
+	rows, err := t.f.db.QueryContext(ctx, query, args...)
+	if isNoTable(err) {
+		rows, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []fs.DirEntry
+	seen := map[string]bool{}
+	if rows != nil {
+		defer rows.Close()
+		for rows.Next() {
+			var p string
+			var size int64
+			if err := rows.Scan(&p, &size); err != nil {
+				return nil, err
+			}
+			child, _, isDir := strings.Cut(strings.TrimPrefix(p, prefix), "/")
+			if seen[child] {
+				continue
+			}
+			seen[child] = true
+			info := blobInfo{name: child, size: size, mod: t.f.modTime, dir: isDir}
+			if isDir {
+				info.size = 0
+			}
+			entries = append(entries, fs.FileInfoToDirEntry(info))
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &blobDir{info: blobInfo{name: path.Base(name), mod: t.f.modTime, dir: true}, entries: entries}, nil
+}
+
+type blobInfo struct {
+	name string
+	size int64
+	mod  time.Time
+	dir  bool
+}
+
+func (i blobInfo) Name() string { return i.name }
+func (i blobInfo) Size() int64  { return i.size }
+func (i blobInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+func (i blobInfo) ModTime() time.Time { return i.mod }
+func (i blobInfo) IsDir() bool        { return i.dir }
+func (i blobInfo) Sys() interface{}   { return nil }
+
+type blobFile struct {
+	*bytes.Reader
+	info blobInfo
+}
+
+func (f *blobFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *blobFile) Close() error               { return nil }
+
+type blobDir struct {
+	info    blobInfo
+	entries []fs.DirEntry
+}
+
+func (d *blobDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *blobDir) Close() error               { return nil }
+func (d *blobDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *blobDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n > 0 && len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n >= len(d.entries) {
+		es := d.entries
+		d.entries = nil
+		return es, nil
+	}
+	es := d.entries[:n]
+	d.entries = d.entries[n:]
+	return es, nil
+}
@@ -0,0 +1,304 @@
+package tiles3d
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// ARCHIVE_INDEX is the last entry of a 3TZ archive. It lists the MD5 hash
+// of every path with the offset of its local file header, so that a file
+// is found with a binary search and read with one ranged access.
+const ARCHIVE_INDEX = "@3dtilesIndex1@"
+
+const (
+	indexEntrySize  = 24
+	localHeaderSize = 30
+	localHeaderSig  = 0x04034b50
+)
+
+type indexEntry struct {
+	hash   [16]byte
+	offset uint64
+}
+
+// less orders hashes as two little endian uint64, the upper half first.
+func (e indexEntry) less(h [16]byte) bool {
+	aHi, bHi := binary.LittleEndian.Uint64(e.hash[8:]), binary.LittleEndian.Uint64(h[8:])
+	if aHi != bHi {
+		return aHi < bHi
+	}
+	return binary.LittleEndian.Uint64(e.hash[:8]) < binary.LittleEndian.Uint64(h[:8])
+}
+
+// Archive reads a 3TZ archive, a zip file of a tileset ending with the
+// ARCHIVE_INDEX. It implements fs.FS, archives without index are read
+// through the zip central directory.
+type Archive struct {
+	r      io.ReaderAt
+	zr     *zip.Reader
+	index  []indexEntry
+	closer io.Closer
+}
+
+// OpenArchive reads the directory and index of an archive of size bytes.
+func OpenArchive(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{r: r, zr: zr}
+	if n := len(zr.File); n > 0 && zr.File[n-1].Name == ARCHIVE_INDEX {
+		if err := a.readIndex(zr.File[n-1]); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// OpenArchiveFile opens a 3TZ file, it must be closed after use.
+func OpenArchiveFile(name string) (*Archive, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a, err := OpenArchive(f, st.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("tiles3d: %s: %w", name, err)
+	}
+	a.closer = f
+	return a, nil
+}
+
+func (a *Archive) readIndex(f *zip.File) error {
+	if f.Method != zip.Store || f.UncompressedSize64%indexEntrySize != 0 {
+		return errors.New("tiles3d: invalid archive index")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	a.index = make([]indexEntry, len(data)/indexEntrySize)
+	for i := range a.index {
+		b := data[i*indexEntrySize:]
+		copy(a.index[i].hash[:], b[:16])
+		a.index[i].offset = binary.LittleEndian.Uint64(b[16:24])
+	}
+	return nil
+}
+
+func (a *Archive) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+func (a *Archive) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	switch {
+	case name == ARCHIVE_INDEX:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case name == ".":
+		f, err := a.zr.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &archiveRoot{f.(fs.ReadDirFile)}, nil
+	case a.index == nil:
+		return a.zr.Open(name)
+	}
+	h := md5.Sum([]byte(name))
+	i := sort.Search(len(a.index), func(i int) bool { return !a.index[i].less(h) })
+	if i == len(a.index) || a.index[i].hash != h {
+		// directories are not indexed
+		return a.zr.Open(name)
+	}
+	data, fh, err := a.readLocal(int64(a.index[i].offset), name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if data == nil {
+		return a.zr.Open(name)
+	}
+	return &archiveFile{Reader: bytes.NewReader(data), info: fh.FileInfo()}, nil
+}
+
+type archiveFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *archiveFile) Close() error               { return nil }
+
+// archiveRoot hides the index from the listing of the root directory.
+type archiveRoot struct {
+	fs.ReadDirFile
+}
+
+func (d *archiveRoot) ReadDir(n int) ([]fs.DirEntry, error) {
+	es, err := d.ReadDirFile.ReadDir(n)
+	for i, e := range es {
+		if e.Name() == ARCHIVE_INDEX {
+			es = append(es[:i], es[i+1:]...)
+			if len(es) == 0 && n > 0 && err == nil {
+				return d.ReadDir(n)
+			}
+			break
+		}
+	}
+	return es, err
+}
+
+// readLocal reads the file whose local header starts at off. It returns
+// no data for entries whose sizes are not in the local header.
+func (a *Archive) readLocal(off int64, name string) ([]byte, *zip.FileHeader, error) {
+	var hdr [localHeaderSize]byte
+	if _, err := a.r.ReadAt(hdr[:], off); err != nil {
+		return nil, nil, err
+	}
+	le := binary.LittleEndian
+	if le.Uint32(hdr[0:]) != localHeaderSig {
+		return nil, nil, errors.New("invalid local file header")
+	}
+	fh := &zip.FileHeader{
+		Name:               name,
+		Flags:              le.Uint16(hdr[6:]),
+		Method:             le.Uint16(hdr[8:]),
+		ModifiedTime:       le.Uint16(hdr[10:]),
+		ModifiedDate:       le.Uint16(hdr[12:]),
+		CRC32:              le.Uint32(hdr[14:]),
+		CompressedSize64:   uint64(le.Uint32(hdr[18:])),
+		UncompressedSize64: uint64(le.Uint32(hdr[22:])),
+	}
+	nameLen, extraLen := int64(le.Uint16(hdr[26:])), int64(le.Uint16(hdr[28:]))
+	if fh.Flags&0x8 != 0 || fh.CompressedSize64 == 0xffffffff || fh.UncompressedSize64 == 0xffffffff {
+		// sizes follow the data or live in the zip64 extra field
+		return nil, fh, nil
+	}
+	stored := make([]byte, nameLen)
+	if _, err := a.r.ReadAt(stored, off+localHeaderSize); err != nil {
+		return nil, nil, err
+	}
+	if string(stored) != name {
+		return nil, nil, fs.ErrNotExist
+	}
+	sr := io.NewSectionReader(a.r, off+localHeaderSize+nameLen+extraLen, int64(fh.CompressedSize64))
+	var data []byte
+	var err error
+	switch fh.Method {
+	case zip.Store:
+		data, err = io.ReadAll(sr)
+	case zip.Deflate:
+		fr := flate.NewReader(sr)
+		data, err = io.ReadAll(fr)
+		fr.Close()
+	default:
+		return nil, nil, zip.ErrAlgorithm
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if uint64(len(data)) != fh.UncompressedSize64 || crc32.ChecksumIEEE(data) != fh.CRC32 {
+		return nil, nil, zip.ErrChecksum
+	}
+	return data, fh, nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteArchive writes the files of fsys as 3TZ archive. Files are deflated
+// unless that does not make them smaller.
+func WriteArchive(w io.Writer, fsys fs.FS) error {
+	cw := &countWriter{w: w}
+	zw := zip.NewWriter(cw)
+	var index []indexEntry
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		if err := zw.Flush(); err != nil {
+			return err
+		}
+		index = append(index, indexEntry{hash: md5.Sum([]byte(name)), offset: uint64(cw.n)})
+		return writeRaw(zw, name, data, true)
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(index, func(i, j int) bool { return index[i].less(index[j].hash) })
+	buf := make([]byte, len(index)*indexEntrySize)
+	for i, e := range index {
+		copy(buf[i*indexEntrySize:], e.hash[:])
+		binary.LittleEndian.PutUint64(buf[i*indexEntrySize+16:], e.offset)
+	}
+	if err := writeRaw(zw, ARCHIVE_INDEX, buf, false); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeRaw writes a zip entry with the sizes in the local header, which
+// the index lookup relies on.
+func writeRaw(zw *zip.Writer, name string, data []byte, compress bool) error {
+	fh := &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(data),
+		UncompressedSize64: uint64(len(data)),
+	}
+	body := data
+	if compress {
+		var buf bytes.Buffer
+		fw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		fw.Write(data)
+		fw.Close()
+		if buf.Len() < len(data) {
+			fh.Method, body = zip.Deflate, buf.Bytes()
+		}
+	}
+	fh.CompressedSize64 = uint64(len(body))
+	fw, err := zw.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(body)
+	return err
+}
@@ -0,0 +1,68 @@
+package tiles3d
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+
+	"github.com/qmuntal/gltf"
+	"pinkey.ltd/xr/mst"
+	"pinkey.ltd/xr/proj"
+)
+
+const CONTENT_FILE = "content.glb"
+
+// FromMesh builds a tileset with a single tile holding the mesh as glTF
+// binary content. The mesh is in east, north, up meters around the WGS84
+// position lon, lat, h, which the root transform places on the globe. The
+// returned files hold TILESET_FILE and CONTENT_FILE.
+func FromMesh[T float64 | float32](m *mst.Mesh[T], lon, lat, h float64) (Files, error) {
+	bbox := m.ComputeBBox()
+	if len(m.Nodes) == 0 || bbox.Min[0] > bbox.Max[0] {
+		return nil, errors.New("tiles3d: empty mesh")
+	}
+	doc, err := mst.MstToGltf([]*mst.Mesh[T]{m})
+	if err != nil {
+		return nil, err
+	}
+	// glTF is y-up, 3D Tiles rotates content from y-up to z-up
+	root := &gltf.Node{Name: "z-up", Rotation: [4]float64{-math.Sqrt2 / 2, 0, 0, math.Sqrt2 / 2}, Children: doc.Scenes[0].Nodes}
+	doc.Nodes = append(doc.Nodes, root)
+	doc.Scenes[0].Nodes = []int{len(doc.Nodes) - 1}
+	glb, err := mst.GetGltfBinary(doc, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	center, half := bbox.Center(), bbox.Diagonal()
+	for i := range half {
+		half[i] /= 2
+	}
+	diag := half.Length() * 2
+	enu := proj.Enu2Ecef(lon, lat, h)
+	var tr []float64
+	for _, col := range enu {
+		tr = append(tr, col[:]...)
+	}
+	ts := &Tileset{
+		Asset:          Asset{Version: VERSION},
+		GeometricError: diag,
+		Root: &Tile{
+			BoundingVolume: BoundingVolume{Box: []float64{
+				center[0], center[1], center[2],
+				half[0], 0, 0,
+				0, half[1], 0,
+				0, 0, half[2],
+			}},
+			GeometricError: 0,
+			Refine:         REFINE_REPLACE,
+			Transform:      tr,
+			Content:        &Content{URI: CONTENT_FILE},
+		},
+	}
+	js, err := json.MarshalIndent(ts, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return Files{TILESET_FILE: js, CONTENT_FILE: glb}, nil
+}
@@ -0,0 +1,221 @@
+package tiles3d
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"pinkey.ltd/xr/utils"
+)
+
+var contentTypes = map[string]string{
+	".json":    "application/json",
+	".glb":     "model/gltf-binary",
+	".gltf":    "model/gltf+json",
+	".b3dm":    "application/octet-stream",
+	".i3dm":    "application/octet-stream",
+	".pnts":    "application/octet-stream",
+	".cmpt":    "application/octet-stream",
+	".subtree": "application/octet-stream",
+	".png":     "image/png",
+	".jpg":     "image/jpeg",
+	".jpeg":    "image/jpeg",
+	".webp":    "image/webp",
+	".ktx2":    "image/ktx2",
+}
+
+// ContentType returns the media type of a tileset file by its extension.
+func ContentType(name string) string {
+	if ct, ok := contentTypes[strings.ToLower(path.Ext(name))]; ok {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// compressible reports whether gzip pays off for a file, images are
+// compressed already.
+func compressible(name string) bool {
+	return !strings.HasPrefix(ContentType(name), "image/")
+}
+
+// Handler serves the files of a tileset, such as a directory opened with
+// os.DirFS or an Archive. Files stored gzipped are sent as they are to
+// clients accepting gzip and decompressed for others.
+type Handler struct {
+	FS           fs.FS
+	CacheControl string // value of the Cache-Control header, omitted when empty
+	AllowOrigin  string // value of Access-Control-Allow-Origin, CORS is off when empty
+}
+
+// NewHandler creates a handler that allows requests from any origin.
+func NewHandler(fsys fs.FS) *Handler {
+	return &Handler{FS: fsys, CacheControl: "public, max-age=3600", AllowOrigin: "*"}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !utils.AllowReadOnly(w, r, h.AllowOrigin) {
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = TILESET_FILE
+	}
+	f, err := h.FS.Open(name)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if st.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	gzipped := bytes.HasPrefix(body, gzipMagic)
+	encoding := ""
+	gz := utils.AcceptsGzip(r)
+	switch {
+	case gzipped && gz:
+		encoding = "gzip"
+	case gzipped:
+		if body, err = utils.Gunzip(body); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case gz && compressible(name):
+		body, encoding = utils.Gzip(body), "gzip"
+	}
+
+	hd := w.Header()
+	hd.Set("Content-Type", ContentType(name))
+	if encoding != "" {
+		hd.Set("Content-Encoding", encoding)
+	}
+	if gzipped || compressible(name) {
+		hd.Add("Vary", "Accept-Encoding")
+	}
+	if h.CacheControl != "" {
+		hd.Set("Cache-Control", h.CacheControl)
+	}
+	sum := sha1.Sum(body)
+	hd.Set("ETag", `"`+hex.EncodeToString(sum[:10])+`"`)
+	http.ServeContent(w, r, "", st.ModTime(), bytes.NewReader(body))
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Load fetches a tileset JSON file and everything it references through h
+// in process, following external tilesets. The files are returned by their
+// path relative to the handler root, decoded as a client would see them.
+func Load(h http.Handler, name string) (Files, error) {
+	files := Files{}
+	if err := load(h, files, name); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func load(h http.Handler, files Files, name string) error {
+	if _, ok := files[name]; ok {
+		return nil
+	}
+	data, err := fetch(h, name)
+	if err != nil {
+		return err
+	}
+	files[name] = data
+	if path.Ext(name) != ".json" {
+		return nil
+	}
+	ts := &Tileset{}
+	if err := json.Unmarshal(data, ts); err != nil {
+		return fmt.Errorf("tiles3d: %s: %w", name, err)
+	}
+	if ts.Root == nil {
+		return fmt.Errorf("tiles3d: %s: tileset without root tile", name)
+	}
+	dir := path.Dir(name)
+	var walk func(t *Tile) error
+	walk = func(t *Tile) error {
+		if t.Content != nil {
+			u, err := url.Parse(t.Content.URI)
+			if err != nil {
+				return err
+			}
+			if u.IsAbs() || u.Host != "" {
+				return fmt.Errorf("tiles3d: %s: content %s is not relative", name, t.Content.URI)
+			}
+			if err := load(h, files, path.Join(dir, u.Path)); err != nil {
+				return err
+			}
+		}
+		for _, c := range t.Children {
+			if err := walk(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(ts.Root)
+}
+
+// recorder is the response writer of in process requests.
+type recorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header { return r.header }
+
+func (r *recorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(p)
+}
+
+func fetch(h http.Handler, name string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, "/"+(&url.URL{Path: name}).EscapedPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := &recorder{header: http.Header{}}
+	h.ServeHTTP(rec, req)
+	if rec.code != http.StatusOK {
+		return nil, fmt.Errorf("tiles3d: GET %s: %s", name, http.StatusText(rec.code))
+	}
+	if rec.header.Get("Content-Encoding") == "gzip" {
+		return utils.Gunzip(rec.body.Bytes())
+	}
+	return rec.body.Bytes(), nil
+}
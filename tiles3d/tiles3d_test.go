@@ -0,0 +1,237 @@
+package tiles3d
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/mst"
+	"pinkey.ltd/xr/utils"
+)
+
+// testMesh returns the bottom and top faces of a 100 x 50 x 20 meter box.
+func testMesh() *mst.Mesh[float32] {
+	ms := mst.NewMesh[float32]()
+	nd := &mst.MeshNode[float32]{}
+	for i := 0; i < 8; i++ {
+		nd.Vertices = append(nd.Vertices, vec3.Vec[float32]{float32(i&1) * 100, float32(i>>1&1) * 50, float32(i>>2&1) * 20})
+	}
+	nd.FaceGroup = []*mst.MeshTriangle{{Faces: []*mst.Face{
+		{Vertex: [3]uint32{0, 2, 1}}, {Vertex: [3]uint32{1, 2, 3}},
+		{Vertex: [3]uint32{4, 5, 6}}, {Vertex: [3]uint32{5, 7, 6}},
+	}}}
+	ms.Nodes = append(ms.Nodes, nd)
+	ms.Materials = append(ms.Materials, &mst.BaseMaterial{Color: [3]byte{200, 200, 200}})
+	return ms
+}
+
+func TestFromMesh(t *testing.T) {
+	files, err := FromMesh(testMesh(), 116.39, 39.9, 50)
+	assert.Nil(t, err)
+	assert.Nil(t, fstest.TestFS(files, TILESET_FILE, CONTENT_FILE))
+	assert.True(t, bytes.HasPrefix(files[CONTENT_FILE], []byte("glTF")))
+
+	ts, err := ReadTileset(files, TILESET_FILE)
+	assert.Nil(t, err)
+	assert.Equal(t, VERSION, ts.Asset.Version)
+	assert.Equal(t, CONTENT_FILE, ts.Root.Content.URI)
+	assert.Equal(t, 16, len(ts.Root.Transform))
+	assert.InDelta(t, 113.58, ts.GeometricError, 0.01)
+
+	r, err := ts.Region()
+	assert.Nil(t, err)
+	assert.InDelta(t, 116.39, r.Min[0], 1e-6)
+	assert.InDelta(t, 116.39+100/85300.0, r.Max[0], 1e-4)
+	assert.InDelta(t, 39.9, r.Min[1], 1e-6)
+	assert.InDelta(t, 50, r.Min[2], 0.01)
+	assert.InDelta(t, 70, r.Max[2], 0.01)
+
+	_, err = FromMesh(mst.NewMesh[float32](), 0, 0, 0)
+	assert.NotNil(t, err)
+}
+
+func TestRegion(t *testing.T) {
+	ts := &Tileset{Root: &Tile{BoundingVolume: BoundingVolume{Region: []float64{-0.1, 0.2, 0.3, 0.4, -5, 100}}}}
+	r, err := ts.Region()
+	assert.Nil(t, err)
+	assert.InDelta(t, -5.729578, r.Min[0], 1e-6)
+	assert.InDelta(t, 22.918312, r.Max[1], 1e-6)
+	assert.Equal(t, 100.0, r.Max[2])
+
+	// a sphere of 1 km around the ECEF position of 0, 0
+	ts.Root.BoundingVolume = BoundingVolume{Sphere: []float64{6378137, 0, 0, 1000}}
+	r, err = ts.Region()
+	assert.Nil(t, err)
+	assert.InDelta(t, -0.009, r.Min[0], 1e-3)
+	assert.InDelta(t, 0.009, r.Max[1], 1e-3)
+
+	ts.Root.BoundingVolume = BoundingVolume{}
+	_, err = ts.Region()
+	assert.NotNil(t, err)
+}
+
+func TestFiles(t *testing.T) {
+	files := Files{"tileset.json": []byte("{}"), "a/b/0.glb": []byte("glb"), "a/1.glb": []byte("1")}
+	assert.Nil(t, fstest.TestFS(files, "tileset.json", "a/b/0.glb", "a/1.glb"))
+	_, err := files.Open("a/2.glb")
+	assert.NotNil(t, err)
+}
+
+// testTileset returns a tileset whose root refers to an external tileset
+// in a sub directory.
+func testTileset(t *testing.T) Files {
+	files, err := FromMesh(testMesh(), 116.39, 39.9, 50)
+	assert.Nil(t, err)
+	ts, err := ReadTileset(files, TILESET_FILE)
+	assert.Nil(t, err)
+	sub := &Tileset{Asset: ts.Asset, GeometricError: 10, Root: &Tile{
+		BoundingVolume: ts.Root.BoundingVolume,
+		Transform:      ts.Root.Transform,
+		Content:        &Content{URI: "part%201.glb"},
+	}}
+	ts.Root.Children = []*Tile{{BoundingVolume: ts.Root.BoundingVolume, Content: &Content{URI: "sub/tileset.json"}}}
+	files[TILESET_FILE], _ = json.Marshal(ts)
+	files["sub/tileset.json"], _ = json.Marshal(sub)
+	files["sub/part 1.glb"] = files[CONTENT_FILE]
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("subtree"))
+	zw.Close()
+	files["sub/0.0.0.subtree"] = buf.Bytes()
+	return files
+}
+
+func TestArchive(t *testing.T) {
+	files := testTileset(t)
+	var buf bytes.Buffer
+	assert.Nil(t, WriteArchive(&buf, files))
+	path := filepath.Join(t.TempDir(), "test.3tz")
+	assert.Nil(t, os.WriteFile(path, buf.Bytes(), 0644))
+
+	a, err := OpenArchiveFile(path)
+	assert.Nil(t, err)
+	defer a.Close()
+	assert.Equal(t, len(files), len(a.index))
+	for i := 1; i < len(a.index); i++ {
+		assert.True(t, a.index[i-1].less(a.index[i].hash))
+	}
+	var names []string
+	for name, want := range files {
+		names = append(names, name)
+		f, err := a.Open(name)
+		assert.Nil(t, err)
+		data, err := io.ReadAll(f)
+		assert.Nil(t, err)
+		assert.Equal(t, want, data, name)
+	}
+	assert.Nil(t, fstest.TestFS(a, names...))
+	_, err = a.Open(ARCHIVE_INDEX)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = a.Open("sub/missing.glb")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// the index is the last entry and stored uncompressed
+	n := len(a.zr.File)
+	assert.Equal(t, ARCHIVE_INDEX, a.zr.File[n-1].Name)
+	assert.Equal(t, uint64(len(files)*indexEntrySize), a.zr.File[n-1].CompressedSize64)
+}
+
+func TestHandler(t *testing.T) {
+	files := testTileset(t)
+	var buf bytes.Buffer
+	assert.Nil(t, WriteArchive(&buf, files))
+	a, err := OpenArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	h := NewHandler(a)
+
+	get := func(path, encoding string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if encoding != "" {
+			req.Header.Set("Accept-Encoding", encoding)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		path, contentType, encoding string
+		gzip                        bool
+		body                        []byte
+	}{
+		{"/", "application/json", "", false, files[TILESET_FILE]},
+		{"/tileset.json", "application/json", "gzip", true, files[TILESET_FILE]},
+		{"/content.glb", "model/gltf-binary", "gzip", true, files[CONTENT_FILE]},
+		{"/sub/part%201.glb", "model/gltf-binary", "", false, files[CONTENT_FILE]},
+		{"/sub/0.0.0.subtree", "application/octet-stream", "gzip", true, files["sub/0.0.0.subtree"]},
+		{"/sub/0.0.0.subtree", "application/octet-stream", "gzip;q=0", false, []byte("subtree")},
+	}
+	for _, tt := range tests {
+		rec := get(tt.path, tt.encoding)
+		assert.Equal(t, http.StatusOK, rec.Code, tt.path)
+		assert.Equal(t, tt.contentType, rec.Header().Get("Content-Type"), tt.path)
+		assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+		body := rec.Body.Bytes()
+		if tt.gzip {
+			assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"), tt.path)
+			if !bytes.Equal(body, tt.body) {
+				body, err = utils.Gunzip(body)
+				assert.Nil(t, err)
+			}
+		}
+		assert.Equal(t, tt.body, body, tt.path)
+	}
+
+	etag := get("/content.glb", "").Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, http.StatusNotModified, get("/content.glb", "", "If-None-Match", etag).Code)
+	rec := get("/content.glb", "", "Range", "bytes=0-3")
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "glTF", rec.Body.String())
+
+	for _, p := range []string{"/missing.glb", "/sub", "/" + ARCHIVE_INDEX, "/../tileset.json/x"} {
+		assert.Equal(t, http.StatusNotFound, get(p, "").Code, p)
+	}
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	req = httptest.NewRequest(http.MethodPut, "/", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestLoad(t *testing.T) {
+	files := testTileset(t)
+	dir := t.TempDir()
+	for name, data := range files {
+		assert.Nil(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+
+	loaded, err := Load(NewHandler(os.DirFS(dir)), TILESET_FILE)
+	assert.Nil(t, err)
+	for _, name := range []string{TILESET_FILE, CONTENT_FILE, "sub/tileset.json", "sub/part 1.glb"} {
+		assert.Equal(t, files[name], loaded[name], name)
+	}
+	// the subtree is not referenced by content
+	assert.Equal(t, 4, len(loaded))
+
+	assert.Nil(t, os.Remove(filepath.Join(dir, "sub", "part 1.glb")))
+	_, err = Load(NewHandler(os.DirFS(dir)), TILESET_FILE)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,146 @@
+// Package tiles3d reads, writes and serves OGC 3D Tiles 1.1 tilesets.
+//
+// Tilesets are accessed through io/fs so that directories, archives and
+// tilesets generated in memory are handled alike.
+package tiles3d
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/proj"
+)
+
+const (
+	VERSION      = "1.1"
+	TILESET_FILE = "tileset.json"
+
+	REFINE_ADD     = "ADD"
+	REFINE_REPLACE = "REPLACE"
+)
+
+// Tileset is the content of a tileset JSON file.
+type Tileset struct {
+	Asset              Asset                  `json:"asset"`
+	Properties         map[string]interface{} `json:"properties,omitempty"`
+	GeometricError     float64                `json:"geometricError"`
+	Root               *Tile                  `json:"root"`
+	ExtensionsUsed     []string               `json:"extensionsUsed,omitempty"`
+	ExtensionsRequired []string               `json:"extensionsRequired,omitempty"`
+	Extras             map[string]interface{} `json:"extras,omitempty"`
+}
+
+type Asset struct {
+	Version        string `json:"version"`
+	TilesetVersion string `json:"tilesetVersion,omitempty"`
+}
+
+// BoundingVolume holds one of a box, a region or a sphere.
+type BoundingVolume struct {
+	// Box is the center followed by the x, y and z half axes.
+	Box []float64 `json:"box,omitempty"`
+	// Region is west, south, east and north in radians followed by the
+	// minimum and maximum height in meters above the WGS84 ellipsoid.
+	Region []float64 `json:"region,omitempty"`
+	// Sphere is the center followed by the radius.
+	Sphere []float64 `json:"sphere,omitempty"`
+}
+
+type Content struct {
+	URI            string          `json:"uri"`
+	BoundingVolume *BoundingVolume `json:"boundingVolume,omitempty"`
+}
+
+type Tile struct {
+	BoundingVolume BoundingVolume `json:"boundingVolume"`
+	GeometricError float64        `json:"geometricError"`
+	Refine         string         `json:"refine,omitempty"`
+	// Transform is a column major 4x4 matrix.
+	Transform []float64 `json:"transform,omitempty"`
+	Content   *Content  `json:"content,omitempty"`
+	Children  []*Tile   `json:"children,omitempty"`
+}
+
+// ReadTileset reads and decodes a tileset JSON file of fsys.
+func ReadTileset(fsys fs.FS, name string) (*Tileset, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	ts := &Tileset{}
+	if err := json.Unmarshal(data, ts); err != nil {
+		return nil, err
+	}
+	if ts.Root == nil {
+		return nil, errors.New("tiles3d: tileset without root tile")
+	}
+	return ts, nil
+}
+
+// Region returns the WGS84 extent of the root tile as longitude and
+// latitude in degrees and ellipsoidal height in meters. Boxes and spheres
+// are placed with the root transform and assumed to be in ECEF.
+func (ts *Tileset) Region() (vec3.Box[float64], error) {
+	bv := ts.Root.BoundingVolume
+	if len(bv.Region) == 6 {
+		r := bv.Region
+		const deg = 180 / math.Pi
+		return vec3.Box[float64]{
+			Min: vec3.Vec[float64]{r[0] * deg, r[1] * deg, r[4]},
+			Max: vec3.Vec[float64]{r[2] * deg, r[3] * deg, r[5]},
+		}, nil
+	}
+
+	var center vec3.Vec[float64]
+	var axes [3]vec3.Vec[float64]
+	switch {
+	case len(bv.Box) == 12:
+		b := bv.Box
+		center = vec3.Vec[float64]{b[0], b[1], b[2]}
+		for i := range axes {
+			axes[i] = vec3.Vec[float64]{b[3+3*i], b[4+3*i], b[5+3*i]}
+		}
+	case len(bv.Sphere) == 4:
+		s := bv.Sphere
+		center = vec3.Vec[float64]{s[0], s[1], s[2]}
+		for i := range axes {
+			axes[i][i] = s[3]
+		}
+	default:
+		return vec3.Box[float64]{}, errors.New("tiles3d: invalid root bounding volume")
+	}
+	if len(ts.Root.Transform) != 0 && len(ts.Root.Transform) != 16 {
+		return vec3.Box[float64]{}, errors.New("tiles3d: invalid root transform")
+	}
+
+	box := vec3.MinBox
+	for i := 0; i < 8; i++ {
+		p := center
+		for a := range axes {
+			sign := float64(1 - 2*((i>>a)&1))
+			for k := 0; k < 3; k++ {
+				p[k] += sign * axes[a][k]
+			}
+		}
+		p = transform(ts.Root.Transform, p)
+		lon, lat, h := proj.Ecef2Lonlat(p[0], p[1], p[2])
+		ll := vec3.Vec[float64]{lon, lat, h}
+		box.Extend(&ll)
+	}
+	return box, nil
+}
+
+// transform applies a column major matrix, which may be empty, to p.
+func transform(m []float64, p vec3.Vec[float64]) vec3.Vec[float64] {
+	if len(m) != 16 {
+		return p
+	}
+	var r vec3.Vec[float64]
+	for k := 0; k < 3; k++ {
+		r[k] = m[k]*p[0] + m[4+k]*p[1] + m[8+k]*p[2] + m[12+k]
+	}
+	return r
+}
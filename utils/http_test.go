@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, GZIP", true},
+		{"gzip;q=0.5", true},
+		{"gzip; q=0", false},
+		{"gzip;q=0.0", false},
+		{"gzip;q=0.000, br", false},
+		{"gzip;q=x", false},
+		{"br;q=1, identity", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", tt.header)
+		assert.Equal(t, tt.want, AcceptsGzip(r), tt.header)
+	}
+}
+
+func TestGzip(t *testing.T) {
+	b, err := Gunzip(Gzip([]byte("tile")))
+	assert.Nil(t, err)
+	assert.Equal(t, "tile", string(b))
+	_, err = Gunzip([]byte("tile"))
+	assert.NotNil(t, err)
+}
+
+func TestAllowReadOnly(t *testing.T) {
+	tests := []struct {
+		method string
+		serve  bool
+		code   int
+	}{
+		{http.MethodGet, true, http.StatusOK},
+		{http.MethodHead, true, http.StatusOK},
+		{http.MethodOptions, false, http.StatusNoContent},
+		{http.MethodPost, false, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		assert.Equal(t, tt.serve, AllowReadOnly(rec, httptest.NewRequest(tt.method, "/", nil), "*"), tt.method)
+		assert.Equal(t, tt.code, rec.Code, tt.method)
+		assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	rec := httptest.NewRecorder()
+	AllowReadOnly(rec, httptest.NewRequest(http.MethodGet, "/", nil), "")
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
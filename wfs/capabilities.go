@@ -0,0 +1,153 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"strconv"
+
+	"pinkey.ltd/xr/ows"
+)
+
+const WFS_NAMESPACE = "http://www.opengis.net/wfs/2.0"
+
+// Capabilities is the WFS 2.0 service metadata document.
+type Capabilities struct {
+	XMLName xml.Name `xml:"wfs:WFS_Capabilities"`
+	Wfs     string   `xml:"xmlns:wfs,attr"`
+	Fes     string   `xml:"xmlns:fes,attr"`
+	Gml     string   `xml:"xmlns:gml,attr"`
+	ows.Namespaces
+	AppNamespace          xml.Attr                   `xml:",attr"`
+	Version               string                     `xml:"version,attr"`
+	ServiceIdentification *ows.ServiceIdentification `xml:"ows:ServiceIdentification"`
+	OperationsMetadata    *ows.OperationsMetadata    `xml:"ows:OperationsMetadata"`
+	FeatureTypes          []*FeatureTypeInfo         `xml:"wfs:FeatureTypeList>wfs:FeatureType"`
+	FilterCapabilities    *FilterCapabilities        `xml:"fes:Filter_Capabilities"`
+}
+
+type FeatureTypeInfo struct {
+	Name             string           `xml:"wfs:Name"`
+	Title            string           `xml:"wfs:Title"`
+	Abstract         string           `xml:"wfs:Abstract,omitempty"`
+	DefaultCRS       string           `xml:"wfs:DefaultCRS"`
+	OtherCRS         []string         `xml:"wfs:OtherCRS"`
+	OutputFormats    []string         `xml:"wfs:OutputFormats>wfs:Format"`
+	WGS84BoundingBox *ows.BoundingBox `xml:"ows:WGS84BoundingBox"`
+}
+
+type FilterCapabilities struct {
+	Conformance         []ows.Domain `xml:"fes:Conformance>fes:Constraint"`
+	ResourceIdentifiers []Named      `xml:"fes:Id_Capabilities>fes:ResourceIdentifier"`
+	LogicalOperators    struct{}     `xml:"fes:Scalar_Capabilities>fes:LogicalOperators"`
+	ComparisonOperators []Named      `xml:"fes:Scalar_Capabilities>fes:ComparisonOperators>fes:ComparisonOperator"`
+	GeometryOperands    []Named      `xml:"fes:Spatial_Capabilities>fes:GeometryOperands>fes:GeometryOperand"`
+	SpatialOperators    []Named      `xml:"fes:Spatial_Capabilities>fes:SpatialOperators>fes:SpatialOperator"`
+}
+
+type Named struct {
+	Name string `xml:"name,attr"`
+}
+
+func named(names []string) []Named {
+	ns := make([]Named, len(names))
+	for i, n := range names {
+		ns[i] = Named{Name: n}
+	}
+	return ns
+}
+
+// constraint is a boolean or valued constraint of OWS Common.
+func constraint(name, value string) ows.Domain {
+	return ows.Domain{Name: name, NoValues: &struct{}{}, DefaultValue: value}
+}
+
+// Capabilities builds the service metadata for clients reaching the
+// service at baseURL.
+func (s *Service) Capabilities(baseURL string) *Capabilities {
+	kvp := baseURL + "?"
+	getFeature := ows.NewGetOperation("GetFeature", kvp)
+	getFeature.Parameters = []ows.Domain{
+		{Name: "outputFormat", AllowedValues: outputFormats},
+		{Name: "resultType", AllowedValues: []string{"results", "hits"}},
+	}
+	caps := &Capabilities{
+		Wfs:          WFS_NAMESPACE,
+		Fes:          FES_NAMESPACE,
+		Gml:          GML_NAMESPACE,
+		Namespaces:   ows.NewNamespaces(),
+		AppNamespace: xml.Attr{Name: xml.Name{Local: "xmlns:" + s.Prefix}, Value: s.Namespace},
+		Version:      VERSION,
+		ServiceIdentification: &ows.ServiceIdentification{
+			Title:              s.Title,
+			Abstract:           s.Abstract,
+			ServiceType:        "WFS",
+			ServiceTypeVersion: []string{VERSION},
+		},
+		OperationsMetadata: &ows.OperationsMetadata{
+			Operations: []ows.Operation{
+				ows.NewGetOperation("GetCapabilities", kvp),
+				ows.NewGetOperation("DescribeFeatureType", kvp),
+				getFeature,
+			},
+			Constraints: []ows.Domain{
+				constraint("ImplementsBasicWFS", "TRUE"),
+				constraint("ImplementsTransactionalWFS", "FALSE"),
+				constraint("ImplementsLockingWFS", "FALSE"),
+				constraint("KVPEncoding", "TRUE"),
+				constraint("XMLEncoding", "FALSE"),
+				constraint("SOAPEncoding", "FALSE"),
+				constraint("ImplementsInheritance", "FALSE"),
+				constraint("ImplementsRemoteResolve", "FALSE"),
+				constraint("ImplementsResultPaging", "TRUE"),
+				constraint("ImplementsStandardJoins", "FALSE"),
+				constraint("ImplementsSpatialJoins", "FALSE"),
+				constraint("ImplementsTemporalJoins", "FALSE"),
+				constraint("ImplementsFeatureVersioning", "FALSE"),
+				constraint("ManageStoredQueries", "FALSE"),
+				constraint("CountDefault", strconv.Itoa(s.MaxFeatures)),
+			},
+		},
+		FilterCapabilities: &FilterCapabilities{
+			Conformance: []ows.Domain{
+				constraint("ImplementsQuery", "TRUE"),
+				constraint("ImplementsAdHocQuery", "TRUE"),
+				constraint("ImplementsFunctions", "FALSE"),
+				constraint("ImplementsResourceId", "TRUE"),
+				constraint("ImplementsMinStandardFilter", "TRUE"),
+				constraint("ImplementsStandardFilter", "TRUE"),
+				constraint("ImplementsMinSpatialFilter", "TRUE"),
+				constraint("ImplementsSpatialFilter", "FALSE"),
+				constraint("ImplementsMinTemporalFilter", "FALSE"),
+				constraint("ImplementsTemporalFilter", "FALSE"),
+				constraint("ImplementsVersionNav", "FALSE"),
+				constraint("ImplementsSorting", "FALSE"),
+				constraint("ImplementsExtendedOperators", "FALSE"),
+				constraint("ImplementsMinimumXPath", "TRUE"),
+				constraint("ImplementsSchemaElementFunc", "FALSE"),
+			},
+			ResourceIdentifiers: named([]string{"fes:ResourceId"}),
+			ComparisonOperators: named(comparisonOperators),
+			GeometryOperands:    named(geometryOperands),
+			SpatialOperators:    named(spatialOperators),
+		},
+	}
+	var other []string
+	for _, code := range s.OtherCRS {
+		other = append(other, crsURN(code))
+	}
+	for _, ft := range s.Store.FeatureTypes() {
+		info := &FeatureTypeInfo{
+			Name:             s.Prefix + ":" + ft.Name,
+			Title:            ft.Title,
+			Abstract:         ft.Abstract,
+			DefaultCRS:       crsURN(4326),
+			OtherCRS:         other,
+			OutputFormats:    outputFormats,
+			WGS84BoundingBox: ows.NewBoundingBox("", ft.Bounds.Min[0], ft.Bounds.Min[1], ft.Bounds.Max[0], ft.Bounds.Max[1]),
+		}
+		if info.Title == "" {
+			info.Title = ft.Name
+		}
+		caps.FeatureTypes = append(caps.FeatureTypes, info)
+	}
+	return caps
+}
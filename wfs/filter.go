@@ -0,0 +1,407 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"pinkey.ltd/xr/geojson"
+)
+
+const FES_NAMESPACE = "http://www.opengis.net/fes/2.0"
+
+// Filter selects features. Filters are built from OGC Filter Encoding 2.0
+// documents by ParseFilter or assembled directly by stores and tests.
+type Filter interface {
+	Match(f *Feature) bool
+}
+
+// Feature is a stored feature together with its type name, which qualifies
+// resource identifiers.
+type Feature struct {
+	*geojson.Feature
+	TypeName string
+}
+
+// ResourceID returns the identifier of the feature as used by GML and
+// resource id filters: the type name and the feature id joined by a dot.
+func (f *Feature) ResourceID() string {
+	if f.ID == nil {
+		return ""
+	}
+	return f.TypeName + "." + fmt.Sprint(f.ID)
+}
+
+// Comparison operators.
+const (
+	PROPERTY_IS_EQUAL_TO                 = "PropertyIsEqualTo"
+	PROPERTY_IS_NOT_EQUAL_TO             = "PropertyIsNotEqualTo"
+	PROPERTY_IS_LESS_THAN                = "PropertyIsLessThan"
+	PROPERTY_IS_GREATER_THAN             = "PropertyIsGreaterThan"
+	PROPERTY_IS_LESS_THAN_OR_EQUAL_TO    = "PropertyIsLessThanOrEqualTo"
+	PROPERTY_IS_GREATER_THAN_OR_EQUAL_TO = "PropertyIsGreaterThanOrEqualTo"
+	PROPERTY_IS_LIKE                     = "PropertyIsLike"
+	PROPERTY_IS_NULL                     = "PropertyIsNull"
+	PROPERTY_IS_BETWEEN                  = "PropertyIsBetween"
+)
+
+// Spatial operators.
+const (
+	BBOX       = "BBOX"
+	INTERSECTS = "Intersects"
+	DISJOINT   = "Disjoint"
+)
+
+var (
+	comparisonOperators = []string{
+		PROPERTY_IS_EQUAL_TO, PROPERTY_IS_NOT_EQUAL_TO, PROPERTY_IS_LESS_THAN, PROPERTY_IS_GREATER_THAN,
+		PROPERTY_IS_LESS_THAN_OR_EQUAL_TO, PROPERTY_IS_GREATER_THAN_OR_EQUAL_TO,
+		PROPERTY_IS_LIKE, PROPERTY_IS_NULL, PROPERTY_IS_BETWEEN,
+	}
+	spatialOperators = []string{BBOX, INTERSECTS, DISJOINT}
+	geometryOperands = []string{"gml:Envelope", "gml:Point", "gml:LineString", "gml:Polygon", "gml:MultiPoint", "gml:MultiCurve", "gml:MultiSurface"}
+)
+
+type And []Filter
+
+func (a And) Match(f *Feature) bool {
+	for _, c := range a {
+		if !c.Match(f) {
+			return false
+		}
+	}
+	return true
+}
+
+type Or []Filter
+
+func (o Or) Match(f *Feature) bool {
+	for _, c := range o {
+		if c.Match(f) {
+			return true
+		}
+	}
+	return false
+}
+
+type Not struct {
+	Filter Filter
+}
+
+func (n *Not) Match(f *Feature) bool {
+	return !n.Filter.Match(f)
+}
+
+// ResourceID matches features by identifier, either the bare feature id or
+// the id qualified by the type name.
+type ResourceID []string
+
+func (r ResourceID) Match(f *Feature) bool {
+	if f.ID == nil {
+		return false
+	}
+	id, rid := fmt.Sprint(f.ID), f.ResourceID()
+	for _, v := range r {
+		if v == rid || v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// compare orders a property value and a literal, numerically when both are
+// numbers. ok is false when the property is absent.
+func compare(v interface{}, literal string, matchCase bool) (c int, ok bool) {
+	if v == nil {
+		return 0, false
+	}
+	var s string
+	switch x := v.(type) {
+	case float64, float32, int, int64, int32:
+		n, _ := strconv.ParseFloat(fmt.Sprint(x), 64)
+		if l, err := strconv.ParseFloat(strings.TrimSpace(literal), 64); err == nil {
+			switch {
+			case n < l:
+				return -1, true
+			case n > l:
+				return 1, true
+			}
+			return 0, true
+		}
+		s = fmt.Sprint(x)
+	default:
+		s = fmt.Sprint(x)
+	}
+	if !matchCase {
+		s, literal = strings.ToLower(s), strings.ToLower(literal)
+	}
+	return strings.Compare(s, literal), true
+}
+
+// Comparison compares a property with a literal.
+type Comparison struct {
+	Op        string
+	Property  string
+	Literal   string
+	MatchCase bool
+}
+
+func (c *Comparison) Match(f *Feature) bool {
+	r, ok := compare(f.Properties[c.Property], c.Literal, c.MatchCase)
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case PROPERTY_IS_EQUAL_TO:
+		return r == 0
+	case PROPERTY_IS_NOT_EQUAL_TO:
+		return r != 0
+	case PROPERTY_IS_LESS_THAN:
+		return r < 0
+	case PROPERTY_IS_GREATER_THAN:
+		return r > 0
+	case PROPERTY_IS_LESS_THAN_OR_EQUAL_TO:
+		return r <= 0
+	case PROPERTY_IS_GREATER_THAN_OR_EQUAL_TO:
+		return r >= 0
+	}
+	return false
+}
+
+type Between struct {
+	Property     string
+	Lower, Upper string
+}
+
+func (b *Between) Match(f *Feature) bool {
+	v := f.Properties[b.Property]
+	lo, ok1 := compare(v, b.Lower, true)
+	hi, ok2 := compare(v, b.Upper, true)
+	return ok1 && ok2 && lo >= 0 && hi <= 0
+}
+
+// IsNull matches features whose property is absent or null.
+type IsNull struct {
+	Property string
+}
+
+func (n *IsNull) Match(f *Feature) bool {
+	return f.Properties[n.Property] == nil
+}
+
+// Like matches a property against a pattern with wildcards.
+type Like struct {
+	Property string
+	re       *regexp.Regexp
+}
+
+// NewLike compiles a pattern in which wildCard matches any run of
+// characters, singleChar one character and escape quotes the next one.
+func NewLike(property, pattern, wildCard, singleChar, escape string, matchCase bool) (*Like, error) {
+	var b strings.Builder
+	if !matchCase {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	rs := []rune(pattern)
+	for i := 0; i < len(rs); i++ {
+		c := string(rs[i])
+		switch {
+		case escape != "" && c == escape && i+1 < len(rs):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(rs[i])))
+		case wildCard != "" && c == wildCard:
+			b.WriteString(".*")
+		case singleChar != "" && c == singleChar:
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(c))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, err
+	}
+	return &Like{Property: property, re: re}, nil
+}
+
+func (l *Like) Match(f *Feature) bool {
+	v := f.Properties[l.Property]
+	return v != nil && l.re.MatchString(fmt.Sprint(v))
+}
+
+// Spatial tests the geometry of a feature against a WGS84 geometry.
+// BBOX and Intersects match intersecting features, Disjoint the others.
+type Spatial struct {
+	Op       string
+	Geometry *geojson.Geometry
+}
+
+func (s *Spatial) Match(f *Feature) bool {
+	if f.Geometry == nil {
+		return false
+	}
+	hit := f.Geometry.Intersects(s.Geometry)
+	if s.Op == DISJOINT {
+		return !hit
+	}
+	return hit
+}
+
+// ParseFilter reads a fes:Filter element of Filter Encoding 2.0. The
+// ogc:Filter of Filter Encoding 1.1 is accepted as well. Coordinates of
+// geometries without srsName are in the default CRS of the feature types.
+func ParseFilter(data []byte) (Filter, error) {
+	var root node
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("wfs: invalid filter: %v", err)
+	}
+	if root.XMLName.Local != "Filter" {
+		return nil, fmt.Errorf("wfs: expected Filter element, got %s", root.XMLName.Local)
+	}
+	return parseOperators(root.Children)
+}
+
+func parseOperators(ns []*node) (Filter, error) {
+	// consecutive resource ids form one filter
+	var ids ResourceID
+	var fs []Filter
+	for _, n := range ns {
+		f, err := parseOperator(n)
+		if err != nil {
+			return nil, err
+		}
+		if id, ok := f.(ResourceID); ok {
+			ids = append(ids, id...)
+		} else {
+			fs = append(fs, f)
+		}
+	}
+	if len(ids) > 0 {
+		fs = append(fs, ids)
+	}
+	if len(fs) != 1 {
+		return nil, fmt.Errorf("wfs: expected one filter operator, got %d", len(fs))
+	}
+	return fs[0], nil
+}
+
+// propertyName strips the namespace prefix of a value reference.
+func propertyName(n *node) string {
+	s := strings.TrimSpace(n.Text)
+	if i := strings.LastIndexByte(s, ':'); i >= 0 {
+		s = s[i+1:]
+	}
+	return s
+}
+
+func isValueReference(n *node) bool {
+	return n.XMLName.Local == "ValueReference" || n.XMLName.Local == "PropertyName"
+}
+
+// operands returns the property and literal of a binary comparison.
+func operands(n *node) (property, literal string, err error) {
+	var hasProp, hasLit bool
+	for _, c := range n.Children {
+		switch {
+		case isValueReference(c):
+			property, hasProp = propertyName(c), true
+		case c.XMLName.Local == "Literal":
+			literal, hasLit = c.Text, true
+		}
+	}
+	if !hasProp || !hasLit {
+		return "", "", fmt.Errorf("wfs: %s needs a ValueReference and a Literal", n.XMLName.Local)
+	}
+	return property, literal, nil
+}
+
+func parseOperator(n *node) (Filter, error) {
+	op := n.XMLName.Local
+	switch op {
+	case "ResourceId":
+		return ResourceID{n.attr("rid")}, nil
+	case "FeatureId":
+		return ResourceID{n.attr("fid")}, nil
+	case "GmlObjectId":
+		return ResourceID{n.attr("id")}, nil
+	case "And", "Or":
+		var fs []Filter
+		for _, c := range n.Children {
+			f, err := parseOperator(c)
+			if err != nil {
+				return nil, err
+			}
+			fs = append(fs, f)
+		}
+		if len(fs) < 2 {
+			return nil, fmt.Errorf("wfs: %s needs at least two operands", op)
+		}
+		if op == "And" {
+			return And(fs), nil
+		}
+		return Or(fs), nil
+	case "Not":
+		if len(n.Children) != 1 {
+			return nil, fmt.Errorf("wfs: Not needs one operand")
+		}
+		f, err := parseOperator(n.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Filter: f}, nil
+	case PROPERTY_IS_EQUAL_TO, PROPERTY_IS_NOT_EQUAL_TO, PROPERTY_IS_LESS_THAN, PROPERTY_IS_GREATER_THAN,
+		PROPERTY_IS_LESS_THAN_OR_EQUAL_TO, PROPERTY_IS_GREATER_THAN_OR_EQUAL_TO:
+		prop, lit, err := operands(n)
+		if err != nil {
+			return nil, err
+		}
+		return &Comparison{Op: op, Property: prop, Literal: lit, MatchCase: n.attr("matchCase") != "false"}, nil
+	case PROPERTY_IS_LIKE:
+		prop, lit, err := operands(n)
+		if err != nil {
+			return nil, err
+		}
+		escape := n.attr("escapeChar")
+		if escape == "" {
+			escape = n.attr("escape")
+		}
+		return NewLike(prop, lit, n.attr("wildCard"), n.attr("singleChar"), escape, n.attr("matchCase") != "false")
+	case PROPERTY_IS_NULL, "PropertyIsNil":
+		for _, c := range n.Children {
+			if isValueReference(c) {
+				return &IsNull{Property: propertyName(c)}, nil
+			}
+		}
+		return nil, fmt.Errorf("wfs: %s needs a ValueReference", op)
+	case PROPERTY_IS_BETWEEN:
+		b := &Between{}
+		lo, hi := n.child("LowerBoundary"), n.child("UpperBoundary")
+		for _, c := range n.Children {
+			if isValueReference(c) {
+				b.Property = propertyName(c)
+			}
+		}
+		if b.Property == "" || lo == nil || hi == nil || lo.child("Literal") == nil || hi.child("Literal") == nil {
+			return nil, fmt.Errorf("wfs: %s needs a ValueReference and literal boundaries", op)
+		}
+		b.Lower, b.Upper = lo.child("Literal").Text, hi.child("Literal").Text
+		return b, nil
+	case BBOX, INTERSECTS, DISJOINT:
+		for _, c := range n.Children {
+			if isValueReference(c) {
+				continue
+			}
+			g, err := gmlReader{}.geometry(c)
+			if err != nil {
+				return nil, err
+			}
+			return &Spatial{Op: op, Geometry: g}, nil
+		}
+		return nil, fmt.Errorf("wfs: %s needs a geometry", op)
+	}
+	return nil, fmt.Errorf("wfs: unsupported filter operator %s", op)
+}
@@ -0,0 +1,475 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/proj"
+)
+
+const GML_NAMESPACE = "http://www.opengis.net/gml/3.2"
+
+// crs is the coordinate reference system of request or response
+// coordinates. Features are stored in WGS84 longitude, latitude order.
+type crs struct {
+	code int
+	// latFirst is set for geographic CRSs named with an URN or URI, which
+	// follow the EPSG axis order. The short "EPSG:4326" form and CRS84 are
+	// longitude first.
+	latFirst bool
+	tr       *proj.Transformer // WGS84 to code, nil for WGS84
+}
+
+// parseCRS resolves an srsName, the empty name is the default CRS of all
+// feature types.
+func parseCRS(ref string) (*crs, error) {
+	if ref == "" {
+		ref = crsURN(4326)
+	}
+	code, err := proj.ParseEPSGCode(ref)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := proj.FromEPSG(code)
+	if err != nil {
+		return nil, err
+	}
+	u := strings.ToUpper(ref)
+	c := &crs{code: code}
+	if dst.IsGeographic() {
+		c.latFirst = !strings.HasPrefix(u, "EPSG:") && !strings.Contains(u, "CRS84")
+	}
+	if code != 4326 {
+		src, _ := proj.FromEPSG(4326)
+		if c.tr, err = proj.NewTransformer(src, dst); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func crsURN(code int) string {
+	return "urn:ogc:def:crs:EPSG::" + strconv.Itoa(code)
+}
+
+func (c *crs) urn() string {
+	return crsURN(c.code)
+}
+
+// fromWGS84 converts a stored position to the axis order of the CRS.
+func (c *crs) fromWGS84(p vec3.Vec[float64]) (vec3.Vec[float64], error) {
+	if c.tr != nil {
+		x, y, z, err := c.tr.Transform(p[0], p[1], p[2])
+		if err != nil {
+			return p, err
+		}
+		p = vec3.Vec[float64]{x, y, z}
+	}
+	if c.latFirst {
+		p[0], p[1] = p[1], p[0]
+	}
+	return p, nil
+}
+
+func (c *crs) toWGS84(p vec3.Vec[float64]) (vec3.Vec[float64], error) {
+	if c.latFirst {
+		p[0], p[1] = p[1], p[0]
+	}
+	if c.tr != nil {
+		x, y, z, err := c.tr.Inverse(p[0], p[1], p[2])
+		if err != nil {
+			return p, err
+		}
+		p = vec3.Vec[float64]{x, y, z}
+	}
+	return p, nil
+}
+
+// transformGeometry returns a copy of g with every position converted.
+func transformGeometry(g *geojson.Geometry, fn func(vec3.Vec[float64]) (vec3.Vec[float64], error)) (*geojson.Geometry, error) {
+	var err error
+	conv := func(ps []vec3.Vec[float64]) []vec3.Vec[float64] {
+		out := make([]vec3.Vec[float64], len(ps))
+		for i, p := range ps {
+			if err == nil {
+				out[i], err = fn(p)
+			}
+		}
+		return out
+	}
+	rings := func(rs [][]vec3.Vec[float64]) [][]vec3.Vec[float64] {
+		out := make([][]vec3.Vec[float64], len(rs))
+		for i, r := range rs {
+			out[i] = conv(r)
+		}
+		return out
+	}
+	r := &geojson.Geometry{Type: g.Type, HasZ: g.HasZ}
+	switch g.Type {
+	case geojson.Point:
+		r.Point, err = fn(g.Point)
+	case geojson.MultiPoint:
+		r.MultiPoint = conv(g.MultiPoint)
+	case geojson.LineString:
+		r.LineString = conv(g.LineString)
+	case geojson.MultiLineString:
+		r.MultiLineString = rings(g.MultiLineString)
+	case geojson.Polygon:
+		r.Polygon = rings(g.Polygon)
+	case geojson.MultiPolygon:
+		r.MultiPolygon = make([][][]vec3.Vec[float64], len(g.MultiPolygon))
+		for i, poly := range g.MultiPolygon {
+			r.MultiPolygon[i] = rings(poly)
+		}
+	case geojson.GeometryCollection:
+		for _, c := range g.Geometries {
+			var sub *geojson.Geometry
+			if sub, err = transformGeometry(c, fn); err != nil {
+				break
+			}
+			r.Geometries = append(r.Geometries, sub)
+		}
+	}
+	return r, err
+}
+
+// gmlWriter writes GML 3.2 elements with literal prefixes to an encoder.
+type gmlWriter struct {
+	enc *xml.Encoder
+	err error
+}
+
+func (w *gmlWriter) start(name string, attrs ...string) {
+	se := xml.StartElement{Name: xml.Name{Local: name}}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		se.Attr = append(se.Attr, xml.Attr{Name: xml.Name{Local: attrs[i]}, Value: attrs[i+1]})
+	}
+	w.token(se)
+}
+
+func (w *gmlWriter) end(name string) {
+	w.token(xml.EndElement{Name: xml.Name{Local: name}})
+}
+
+func (w *gmlWriter) token(t xml.Token) {
+	if w.err == nil {
+		w.err = w.enc.EncodeToken(t)
+	}
+}
+
+func (w *gmlWriter) text(name, s string, attrs ...string) {
+	w.start(name, attrs...)
+	w.token(xml.CharData(s))
+	w.end(name)
+}
+
+func formatPositions(ps []vec3.Vec[float64], hasZ bool) string {
+	var b strings.Builder
+	for i, p := range ps {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		n := 2
+		if hasZ {
+			n = 3
+		}
+		for j := 0; j < n; j++ {
+			if j > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(strconv.FormatFloat(p[j], 'f', -1, 64))
+		}
+	}
+	return b.String()
+}
+
+func (w *gmlWriter) posList(name string, ps []vec3.Vec[float64], hasZ bool) {
+	if hasZ {
+		w.text(name, formatPositions(ps, true), "srsDimension", "3")
+	} else {
+		w.text(name, formatPositions(ps, false))
+	}
+}
+
+func (w *gmlWriter) lineString(id string, line []vec3.Vec[float64], hasZ bool, attrs ...string) {
+	w.start("gml:LineString", append([]string{"gml:id", id}, attrs...)...)
+	w.posList("gml:posList", line, hasZ)
+	w.end("gml:LineString")
+}
+
+func (w *gmlWriter) polygon(id string, rings [][]vec3.Vec[float64], hasZ bool, attrs ...string) {
+	w.start("gml:Polygon", append([]string{"gml:id", id}, attrs...)...)
+	for i, r := range rings {
+		name := "gml:interior"
+		if i == 0 {
+			name = "gml:exterior"
+		}
+		w.start(name)
+		w.start("gml:LinearRing")
+		w.posList("gml:posList", r, hasZ)
+		w.end("gml:LinearRing")
+		w.end(name)
+	}
+	w.end("gml:Polygon")
+}
+
+// geometry writes g, already in the output CRS, with gml:id values derived
+// from id.
+func (w *gmlWriter) geometry(g *geojson.Geometry, id, srsName string) {
+	var attrs []string
+	if srsName != "" {
+		attrs = []string{"srsName", srsName}
+	}
+	sub := func(i int) string { return id + "." + strconv.Itoa(i) }
+	switch g.Type {
+	case geojson.Point:
+		w.start("gml:Point", append([]string{"gml:id", id}, attrs...)...)
+		w.posList("gml:pos", []vec3.Vec[float64]{g.Point}, g.HasZ)
+		w.end("gml:Point")
+	case geojson.MultiPoint:
+		w.start("gml:MultiPoint", append([]string{"gml:id", id}, attrs...)...)
+		for i, p := range g.MultiPoint {
+			w.start("gml:pointMember")
+			w.start("gml:Point", "gml:id", sub(i))
+			w.posList("gml:pos", []vec3.Vec[float64]{p}, g.HasZ)
+			w.end("gml:Point")
+			w.end("gml:pointMember")
+		}
+		w.end("gml:MultiPoint")
+	case geojson.LineString:
+		w.lineString(id, g.LineString, g.HasZ, attrs...)
+	case geojson.MultiLineString:
+		w.start("gml:MultiCurve", append([]string{"gml:id", id}, attrs...)...)
+		for i, l := range g.MultiLineString {
+			w.start("gml:curveMember")
+			w.lineString(sub(i), l, g.HasZ)
+			w.end("gml:curveMember")
+		}
+		w.end("gml:MultiCurve")
+	case geojson.Polygon:
+		w.polygon(id, g.Polygon, g.HasZ, attrs...)
+	case geojson.MultiPolygon:
+		w.start("gml:MultiSurface", append([]string{"gml:id", id}, attrs...)...)
+		for i, poly := range g.MultiPolygon {
+			w.start("gml:surfaceMember")
+			w.polygon(sub(i), poly, g.HasZ)
+			w.end("gml:surfaceMember")
+		}
+		w.end("gml:MultiSurface")
+	case geojson.GeometryCollection:
+		w.start("gml:MultiGeometry", append([]string{"gml:id", id}, attrs...)...)
+		for i, c := range g.Geometries {
+			w.start("gml:geometryMember")
+			w.geometry(c, sub(i), "")
+			w.end("gml:geometryMember")
+		}
+		w.end("gml:MultiGeometry")
+	}
+}
+
+// node is a generic XML element used to read filters and GML.
+type node struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []*node    `xml:",any"`
+}
+
+func (n *node) attr(local string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *node) child(local string) *node {
+	for _, c := range n.Children {
+		if c.XMLName.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+func parseFloats(s string) ([]float64, error) {
+	fields := strings.Fields(s)
+	vs := make([]float64, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, fmt.Errorf("wfs: invalid coordinate %q", f)
+		}
+		vs[i] = v
+	}
+	return vs, nil
+}
+
+// gmlReader converts GML geometries to WGS84 GeoJSON geometries.
+type gmlReader struct {
+	srsName string
+	dim     int
+}
+
+func (r gmlReader) inherit(n *node) (gmlReader, error) {
+	if s := n.attr("srsName"); s != "" {
+		r.srsName = s
+	}
+	if d := n.attr("srsDimension"); d != "" {
+		v, err := strconv.Atoi(d)
+		if err != nil || v < 2 || v > 3 {
+			return r, fmt.Errorf("wfs: invalid srsDimension %q", d)
+		}
+		r.dim = v
+	}
+	return r, nil
+}
+
+func (r gmlReader) positions(n *node) ([]vec3.Vec[float64], error) {
+	var vs []float64
+	var err error
+	if pl := n.child("posList"); pl != nil {
+		if r, err = r.inherit(pl); err != nil {
+			return nil, err
+		}
+		if vs, err = parseFloats(pl.Text); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, p := range n.Children {
+			if p.XMLName.Local != "pos" {
+				continue
+			}
+			pr, err := r.inherit(p)
+			if err != nil {
+				return nil, err
+			}
+			r.dim = pr.dim
+			v, err := parseFloats(p.Text)
+			if err != nil {
+				return nil, err
+			}
+			vs = append(vs, v...)
+		}
+	}
+	c, err := parseCRS(r.srsName)
+	if err != nil {
+		return nil, err
+	}
+	if len(vs) == 0 || len(vs)%r.dim != 0 {
+		return nil, fmt.Errorf("wfs: %d ordinates do not form %d dimensional positions", len(vs), r.dim)
+	}
+	ps := make([]vec3.Vec[float64], len(vs)/r.dim)
+	for i := range ps {
+		copy(ps[i][:], vs[i*r.dim:(i+1)*r.dim])
+		if ps[i], err = c.toWGS84(ps[i]); err != nil {
+			return nil, err
+		}
+	}
+	return ps, nil
+}
+
+func (r gmlReader) ring(n *node) ([]vec3.Vec[float64], error) {
+	lr := n.child("LinearRing")
+	if lr == nil {
+		return nil, fmt.Errorf("wfs: %s without LinearRing", n.XMLName.Local)
+	}
+	return r.positions(lr)
+}
+
+func (r gmlReader) polygon(n *node) ([][]vec3.Vec[float64], error) {
+	var rings [][]vec3.Vec[float64]
+	for _, c := range n.Children {
+		if c.XMLName.Local != "exterior" && c.XMLName.Local != "interior" {
+			continue
+		}
+		ring, err := r.ring(c)
+		if err != nil {
+			return nil, err
+		}
+		if c.XMLName.Local == "exterior" {
+			rings = append([][]vec3.Vec[float64]{ring}, rings...)
+		} else {
+			rings = append(rings, ring)
+		}
+	}
+	if len(rings) == 0 {
+		return nil, fmt.Errorf("wfs: polygon without exterior")
+	}
+	return rings, nil
+}
+
+// members reads the geometries inside the member elements of a multi
+// geometry.
+func (r gmlReader) members(n *node) ([]*geojson.Geometry, error) {
+	var gs []*geojson.Geometry
+	for _, m := range n.Children {
+		for _, c := range m.Children {
+			g, err := r.geometry(c)
+			if err != nil {
+				return nil, err
+			}
+			gs = append(gs, g)
+		}
+	}
+	return gs, nil
+}
+
+// geometry reads a GML 3.2 geometry or envelope.
+func (r gmlReader) geometry(n *node) (*geojson.Geometry, error) {
+	r, err := r.inherit(n)
+	if err != nil {
+		return nil, err
+	}
+	if r.dim == 0 {
+		r.dim = 2
+	}
+	switch n.XMLName.Local {
+	case "Point":
+		ps, err := r.positions(n)
+		if err != nil {
+			return nil, err
+		}
+		return geojson.NewPointGeometry(ps[0]), nil
+	case "LineString":
+		ps, err := r.positions(n)
+		if err != nil {
+			return nil, err
+		}
+		return geojson.NewLineStringGeometry(ps), nil
+	case "Polygon":
+		rings, err := r.polygon(n)
+		if err != nil {
+			return nil, err
+		}
+		return geojson.NewPolygonGeometry(rings), nil
+	case "Envelope":
+		lo, hi := n.child("lowerCorner"), n.child("upperCorner")
+		if lo == nil || hi == nil {
+			return nil, fmt.Errorf("wfs: envelope needs lowerCorner and upperCorner")
+		}
+		ps, err := r.positions(&node{Children: []*node{
+			{XMLName: xml.Name{Local: "pos"}, Text: lo.Text},
+			{XMLName: xml.Name{Local: "pos"}, Text: hi.Text},
+		}})
+		if err != nil {
+			return nil, err
+		}
+		a, b := ps[0], ps[1]
+		return geojson.NewPolygonGeometry([][]vec3.Vec[float64]{{
+			{a[0], a[1], 0}, {b[0], a[1], 0}, {b[0], b[1], 0}, {a[0], b[1], 0}, {a[0], a[1], 0},
+		}}), nil
+	case "MultiPoint", "MultiCurve", "MultiLineString", "MultiSurface", "MultiPolygon", "MultiGeometry":
+		gs, err := r.members(n)
+		if err != nil {
+			return nil, err
+		}
+		return geojson.NewGeometryCollection(gs...), nil
+	}
+	return nil, fmt.Errorf("wfs: unsupported GML geometry %s", n.XMLName.Local)
+}
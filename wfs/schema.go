@@ -0,0 +1,77 @@
+package wfs
+
+import "encoding/xml"
+
+const XSD_NAMESPACE = "http://www.w3.org/2001/XMLSchema"
+
+// GEOMETRY_PROPERTY is the element holding the geometry of every feature.
+const GEOMETRY_PROPERTY = "geometry"
+
+// Schema is the XML Schema returned by DescribeFeatureType.
+type Schema struct {
+	XMLName              xml.Name        `xml:"xsd:schema"`
+	Xsd                  string          `xml:"xmlns:xsd,attr"`
+	Gml                  string          `xml:"xmlns:gml,attr"`
+	AppNamespace         xml.Attr        `xml:",attr"`
+	TargetNamespace      string          `xml:"targetNamespace,attr"`
+	ElementFormDefault   string          `xml:"elementFormDefault,attr"`
+	AttributeFormDefault string          `xml:"attributeFormDefault,attr"`
+	Import               SchemaImport    `xml:"xsd:import"`
+	ComplexTypes         []ComplexType   `xml:"xsd:complexType"`
+	Elements             []SchemaElement `xml:"xsd:element"`
+}
+
+type SchemaImport struct {
+	Namespace      string `xml:"namespace,attr"`
+	SchemaLocation string `xml:"schemaLocation,attr"`
+}
+
+type ComplexType struct {
+	Name      string    `xml:"name,attr"`
+	Extension Extension `xml:"xsd:complexContent>xsd:extension"`
+}
+
+type Extension struct {
+	Base     string          `xml:"base,attr"`
+	Elements []SchemaElement `xml:"xsd:sequence>xsd:element"`
+}
+
+type SchemaElement struct {
+	Name              string `xml:"name,attr"`
+	Type              string `xml:"type,attr"`
+	SubstitutionGroup string `xml:"substitutionGroup,attr,omitempty"`
+	MinOccurs         string `xml:"minOccurs,attr,omitempty"`
+	Nillable          string `xml:"nillable,attr,omitempty"`
+}
+
+func (s *Service) schema(fts []*FeatureType) *Schema {
+	sc := &Schema{
+		Xsd:                  XSD_NAMESPACE,
+		Gml:                  GML_NAMESPACE,
+		AppNamespace:         xml.Attr{Name: xml.Name{Local: "xmlns:" + s.Prefix}, Value: s.Namespace},
+		TargetNamespace:      s.Namespace,
+		ElementFormDefault:   "qualified",
+		AttributeFormDefault: "unqualified",
+		Import:               SchemaImport{Namespace: GML_NAMESPACE, SchemaLocation: "http://schemas.opengis.net/gml/3.2.1/gml.xsd"},
+	}
+	for _, ft := range fts {
+		ct := ComplexType{Name: ft.Name + "Type", Extension: Extension{
+			Base:     "gml:AbstractFeatureType",
+			Elements: []SchemaElement{{Name: GEOMETRY_PROPERTY, Type: "gml:GeometryPropertyType", MinOccurs: "0", Nillable: "true"}},
+		}}
+		for _, p := range ft.Properties {
+			t := p.Type
+			if t == "" {
+				t = "string"
+			}
+			ct.Extension.Elements = append(ct.Extension.Elements, SchemaElement{Name: p.Name, Type: "xsd:" + t, MinOccurs: "0", Nillable: "true"})
+		}
+		sc.ComplexTypes = append(sc.ComplexTypes, ct)
+		sc.Elements = append(sc.Elements, SchemaElement{
+			Name:              ft.Name,
+			Type:              s.Prefix + ":" + ft.Name + "Type",
+			SubstitutionGroup: "gml:AbstractFeature",
+		})
+	}
+	return sc
+}
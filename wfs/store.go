@@ -0,0 +1,142 @@
+package wfs
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec2"
+)
+
+// Property is an attribute of a feature type with an XML Schema type such
+// as "string", "double", "long", "boolean" or "dateTime".
+type Property struct {
+	Name string
+	Type string
+}
+
+// FeatureType describes features sharing a schema.
+type FeatureType struct {
+	Name       string
+	Title      string
+	Abstract   string
+	Properties []Property
+	// Bounds is the WGS84 extent of the features.
+	Bounds vec2.Rect[float64]
+}
+
+// Query selects features of one type.
+type Query struct {
+	TypeName string
+	// Filter is nil to select all features.
+	Filter     Filter
+	StartIndex int
+	// Count limits the number of returned features, negative for no limit.
+	Count int
+}
+
+// Store provides the features served by a Service. Geometries are in
+// WGS84 longitude, latitude order.
+type Store interface {
+	FeatureTypes() []*FeatureType
+	// Query returns a page of the matching features and the number of
+	// features matching in total.
+	Query(ctx context.Context, q *Query) (features []*Feature, matched int, err error)
+}
+
+// MemoryStore keeps feature collections in memory.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	types    []*FeatureType
+	features map[string][]*Feature
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{features: map[string][]*Feature{}}
+}
+
+// Add registers a feature type with its features, replacing a type of the
+// same name. Missing properties and bounds are derived from the features.
+func (s *MemoryStore) Add(ft *FeatureType, fc *geojson.FeatureCollection) {
+	if ft.Properties == nil {
+		ft.Properties = inferProperties(fc)
+	}
+	if ft.Bounds == (vec2.Rect[float64]{}) && len(fc.Features) > 0 {
+		ft.Bounds = fc.Bound()
+	}
+	fs := make([]*Feature, len(fc.Features))
+	for i, f := range fc.Features {
+		fs[i] = &Feature{Feature: f, TypeName: ft.Name}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.types {
+		if t.Name == ft.Name {
+			s.types = append(s.types[:i], s.types[i+1:]...)
+			break
+		}
+	}
+	s.types = append(s.types, ft)
+	s.features[ft.Name] = fs
+}
+
+// inferProperties lists the properties of all features sorted by name.
+// Types that differ between features fall back to string.
+func inferProperties(fc *geojson.FeatureCollection) []Property {
+	types := map[string]string{}
+	for _, f := range fc.Features {
+		for k, v := range f.Properties {
+			t := "string"
+			switch v.(type) {
+			case nil:
+				continue
+			case float64, float32:
+				t = "double"
+			case int, int32, int64:
+				t = "long"
+			case bool:
+				t = "boolean"
+			}
+			if old, ok := types[k]; ok && old != t {
+				t = "string"
+			}
+			types[k] = t
+		}
+	}
+	props := make([]Property, 0, len(types))
+	for k, t := range types {
+		props = append(props, Property{Name: k, Type: t})
+	}
+	sort.Slice(props, func(i, j int) bool { return props[i].Name < props[j].Name })
+	return props
+}
+
+func (s *MemoryStore) FeatureTypes() []*FeatureType {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*FeatureType(nil), s.types...)
+}
+
+func (s *MemoryStore) Query(ctx context.Context, q *Query) ([]*Feature, int, error) {
+	s.mu.RLock()
+	fs := s.features[q.TypeName]
+	s.mu.RUnlock()
+
+	var page []*Feature
+	matched := 0
+	for _, f := range fs {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		if q.Filter != nil && !q.Filter.Match(f) {
+			continue
+		}
+		if matched >= q.StartIndex && (q.Count < 0 || len(page) < q.Count) {
+			page = append(page, f)
+		}
+		matched++
+	}
+	return page, matched, nil
+}
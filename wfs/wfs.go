@@ -0,0 +1,456 @@
+// Package wfs implements an OGC WFS 2.0 server with the key value pair
+// encoding: GetCapabilities, DescribeFeatureType and GetFeature with BBOX,
+// resource id and Filter Encoding 2.0 queries, paging and output as GML 3.2
+// or GeoJSON.
+//
+// Feature types are qualified with a namespace prefix. Their default CRS is
+// urn:ogc:def:crs:EPSG::4326 with latitude before longitude, as required by
+// WFS 2.0. GeoJSON output is always longitude first.
+package wfs
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/ows"
+)
+
+const (
+	VERSION = "2.0.0"
+
+	DEFAULT_NAMESPACE = "http://pinkey.ltd/xr/features"
+	DEFAULT_PREFIX    = "xr"
+
+	GML_FORMAT     = "application/gml+xml; version=3.2"
+	GEOJSON_FORMAT = "application/geo+json"
+
+	// OPERATION_PARSING_FAILED is reported for malformed filters.
+	OPERATION_PARSING_FAILED = "OperationParsingFailed"
+)
+
+var outputFormats = []string{GML_FORMAT, "text/xml; subtype=gml/3.2", GEOJSON_FORMAT, "application/json"}
+
+// outputFormat maps the OUTPUTFORMAT aliases used by clients to the GML or
+// GeoJSON format.
+func outputFormat(s string) (string, bool) {
+	switch strings.ToLower(strings.ReplaceAll(s, " ", "")) {
+	case "", "application/gml+xml;version=3.2", "text/xml;subtype=gml/3.2", "text/xml;subtype=gml/3.2.1", "gml32", "application/gml+xml":
+		return GML_FORMAT, true
+	case "application/geo+json", "application/json", "json", "geojson":
+		return GEOJSON_FORMAT, true
+	}
+	return "", false
+}
+
+// Service is a WFS 2.0 server.
+type Service struct {
+	Title    string
+	Abstract string
+	Store    Store
+	// Namespace and Prefix qualify the feature type names.
+	Namespace string
+	Prefix    string
+	// OtherCRS lists EPSG codes offered besides the default EPSG:4326.
+	OtherCRS []int
+	// MaxFeatures is the default and upper limit of COUNT.
+	MaxFeatures int
+	// BaseURL is the public URL of the service used in documents, derived
+	// from each request when empty.
+	BaseURL string
+}
+
+func NewService(title string, store Store) *Service {
+	return &Service{
+		Title:       title,
+		Store:       store,
+		Namespace:   DEFAULT_NAMESPACE,
+		Prefix:      DEFAULT_PREFIX,
+		OtherCRS:    []int{3857},
+		MaxFeatures: 10000,
+	}
+}
+
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if err := s.serve(w, r); err != nil {
+		ows.WriteError(w, err, VERSION)
+	}
+}
+
+func (s *Service) serve(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return ows.NewError(ows.OPERATION_NOT_SUPPORTED, "", "method %s is not supported, use the KVP encoding", r.Method)
+	}
+	p := ows.ParseParams(r.URL.Query())
+	if svc := p.Get("SERVICE"); !strings.EqualFold(svc, "WFS") {
+		if svc == "" {
+			return ows.NewError(ows.MISSING_PARAMETER_VALUE, "service", "missing parameter SERVICE")
+		}
+		return ows.NewError(ows.INVALID_PARAMETER_VALUE, "service", "service must be WFS, got %q", svc)
+	}
+	base := s.BaseURL
+	if base == "" {
+		base = ows.BaseURL(r)
+	}
+	op := p.Get("REQUEST")
+	if !strings.EqualFold(op, "GetCapabilities") {
+		if v := p.Get("VERSION"); v != "" && !strings.HasPrefix(v, "2.0") {
+			return ows.NewError(ows.INVALID_PARAMETER_VALUE, "version", "unsupported version %q", v)
+		}
+	}
+	switch {
+	case strings.EqualFold(op, "GetCapabilities"):
+		if v := p.Get("ACCEPTVERSIONS"); v != "" && !strings.Contains(v, "2.0") {
+			return ows.NewError(ows.VERSION_NEGOTIATION_FAILED, "AcceptVersions", "only version %s is supported", VERSION)
+		}
+		ows.WriteXML(w, http.StatusOK, s.Capabilities(base))
+		return nil
+	case strings.EqualFold(op, "DescribeFeatureType"):
+		return s.describeFeatureType(w, p)
+	case strings.EqualFold(op, "GetFeature"):
+		return s.getFeature(w, r, p, base)
+	case op == "":
+		return ows.NewError(ows.MISSING_PARAMETER_VALUE, "request", "missing parameter REQUEST")
+	}
+	return ows.NewError(ows.OPERATION_NOT_SUPPORTED, "request", "unsupported request %q", op)
+}
+
+// featureTypes resolves a comma separated list of type names with or
+// without namespace prefix, all types when the list is empty.
+func (s *Service) featureTypes(list, locator string) ([]*FeatureType, error) {
+	all := s.Store.FeatureTypes()
+	if list == "" {
+		return all, nil
+	}
+	var fts []*FeatureType
+	for _, name := range strings.Split(list, ",") {
+		name = strings.Trim(strings.TrimSpace(name), "()")
+		if i := strings.LastIndexByte(name, ':'); i >= 0 {
+			name = name[i+1:]
+		}
+		found := false
+		for _, ft := range all {
+			if ft.Name == name {
+				fts = append(fts, ft)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, locator, "unknown feature type %q", name)
+		}
+	}
+	return fts, nil
+}
+
+func typeNames(p ows.Params) string {
+	if v := p.Get("TYPENAMES"); v != "" {
+		return v
+	}
+	return p.Get("TYPENAME")
+}
+
+func (s *Service) describeFeatureType(w http.ResponseWriter, p ows.Params) error {
+	if f := p.Get("OUTPUTFORMAT"); f != "" {
+		if format, ok := outputFormat(f); !ok || format != GML_FORMAT {
+			return ows.NewError(ows.INVALID_PARAMETER_VALUE, "outputFormat", "unsupported output format %q", f)
+		}
+	}
+	fts, err := s.featureTypes(typeNames(p), "typeNames")
+	if err != nil {
+		return err
+	}
+	b, err := xml.MarshalIndent(s.schema(fts), "", "  ")
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", GML_FORMAT)
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+	return nil
+}
+
+// query is a parsed GetFeature request.
+type query struct {
+	types      []*FeatureType
+	filter     Filter
+	startIndex int
+	count      int
+	hits       bool
+	format     string
+	srs        *crs
+	srsName    string
+}
+
+func (s *Service) parseQuery(p ows.Params) (*query, error) {
+	q := &query{}
+	var err error
+	ids := p.Get("RESOURCEID")
+	names := typeNames(p)
+	if names == "" && ids == "" {
+		return nil, ows.NewError(ows.MISSING_PARAMETER_VALUE, "typeNames", "missing parameter TYPENAMES")
+	}
+	if q.types, err = s.featureTypes(names, "typeNames"); err != nil {
+		return nil, err
+	}
+
+	bbox, filter := p.Get("BBOX"), p.Get("FILTER")
+	n := 0
+	for _, v := range []string{ids, bbox, filter} {
+		if v != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "filter", "RESOURCEID, BBOX and FILTER are mutually exclusive")
+	}
+	switch {
+	case ids != "":
+		q.filter = ResourceID(strings.Split(ids, ","))
+	case bbox != "":
+		if q.filter, err = parseBBox(bbox); err != nil {
+			return nil, err
+		}
+	case filter != "":
+		if q.filter, err = ParseFilter([]byte(filter)); err != nil {
+			return nil, ows.NewError(OPERATION_PARSING_FAILED, "filter", "%s", err.Error())
+		}
+	}
+
+	if q.startIndex, err = p.Int("STARTINDEX", 0); err != nil {
+		return nil, err
+	}
+	count := p.Get("COUNT")
+	if count == "" {
+		count = p.Get("MAXFEATURES")
+	}
+	q.count = s.MaxFeatures
+	if count != "" {
+		if q.count, err = strconv.Atoi(count); err != nil || q.count < 0 {
+			return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "count", "invalid count %q", count)
+		}
+		q.count = min(q.count, s.MaxFeatures)
+	}
+	if q.startIndex < 0 {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "startIndex", "negative startIndex")
+	}
+
+	switch rt := p.Get("RESULTTYPE"); {
+	case strings.EqualFold(rt, "hits"):
+		q.hits = true
+	case rt != "" && !strings.EqualFold(rt, "results"):
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "resultType", "invalid result type %q", rt)
+	}
+	var ok bool
+	if q.format, ok = outputFormat(p.Get("OUTPUTFORMAT")); !ok {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "outputFormat", "unsupported output format %q", p.Get("OUTPUTFORMAT"))
+	}
+	q.srsName = p.Get("SRSNAME")
+	if q.srs, err = parseCRS(q.srsName); err != nil {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "srsName", "unsupported CRS %q", q.srsName)
+	}
+	if q.srsName == "" {
+		q.srsName = q.srs.urn()
+	}
+	return q, nil
+}
+
+// parseBBox reads minx,miny,maxx,maxy with an optional CRS in the axis
+// order of that CRS.
+func parseBBox(s string) (Filter, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 && len(parts) != 5 {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "bbox", "BBOX needs four numbers and an optional CRS, got %q", s)
+	}
+	var v [4]float64
+	for i := range v {
+		var err error
+		if v[i], err = strconv.ParseFloat(strings.TrimSpace(parts[i]), 64); err != nil {
+			return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "bbox", "invalid BBOX %q", s)
+		}
+	}
+	ref := ""
+	if len(parts) == 5 {
+		ref = strings.TrimSpace(parts[4])
+	}
+	c, err := parseCRS(ref)
+	if err != nil {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "bbox", "unsupported CRS %q", ref)
+	}
+	lo, err1 := c.toWGS84(vec3.Vec[float64]{v[0], v[1], 0})
+	hi, err2 := c.toWGS84(vec3.Vec[float64]{v[2], v[3], 0})
+	if err1 != nil || err2 != nil || lo[0] > hi[0] || lo[1] > hi[1] {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "bbox", "invalid BBOX %q", s)
+	}
+	return &Spatial{Op: BBOX, Geometry: geojson.NewPolygonGeometry([][]vec3.Vec[float64]{{
+		{lo[0], lo[1], 0}, {hi[0], lo[1], 0}, {hi[0], hi[1], 0}, {lo[0], hi[1], 0}, {lo[0], lo[1], 0},
+	}})}, nil
+}
+
+func (s *Service) getFeature(w http.ResponseWriter, r *http.Request, p ows.Params, base string) error {
+	q, err := s.parseQuery(p)
+	if err != nil {
+		return err
+	}
+	// page across the feature types in order
+	var features []*Feature
+	matched := 0
+	start, count := q.startIndex, q.count
+	if q.hits {
+		count = 0
+	}
+	for _, ft := range q.types {
+		fs, n, err := s.Store.Query(r.Context(), &Query{TypeName: ft.Name, Filter: q.filter, StartIndex: start, Count: count})
+		if err != nil {
+			return err
+		}
+		features = append(features, fs...)
+		matched += n
+		start = max(0, start-n)
+		count -= len(fs)
+	}
+
+	stamp := time.Now().UTC().Format(time.RFC3339)
+	if q.format == GEOJSON_FORMAT {
+		return s.writeGeoJSON(w, q, features, matched, stamp)
+	}
+	return s.writeGML(w, q, features, matched, stamp, base)
+}
+
+type featureCollectionJSON struct {
+	Type           string             `json:"type"`
+	NumberMatched  int                `json:"numberMatched"`
+	NumberReturned int                `json:"numberReturned"`
+	TimeStamp      string             `json:"timeStamp"`
+	Features       []*geojson.Feature `json:"features"`
+}
+
+func (s *Service) writeGeoJSON(w http.ResponseWriter, q *query, features []*Feature, matched int, stamp string) error {
+	fc := &featureCollectionJSON{
+		Type:           geojson.TYPE_FEATURE_COLLECTION,
+		NumberMatched:  matched,
+		NumberReturned: len(features),
+		TimeStamp:      stamp,
+		Features:       []*geojson.Feature{},
+	}
+	// GeoJSON is longitude first in any CRS
+	srs := *q.srs
+	srs.latFirst = false
+	for _, f := range features {
+		out := &geojson.Feature{Properties: f.Properties}
+		if f.ID != nil {
+			out.ID = f.ResourceID()
+		}
+		if f.Geometry != nil {
+			g, err := transformGeometry(f.Geometry, srs.fromWGS84)
+			if err != nil {
+				return err
+			}
+			out.Geometry = g
+		}
+		fc.Features = append(fc.Features, out)
+	}
+	w.Header().Set("Content-Type", GEOJSON_FORMAT)
+	return json.NewEncoder(w).Encode(fc)
+}
+
+var invalidIDChars = regexp.MustCompile(`[^A-Za-z0-9_.\-]`)
+
+// gmlID turns a resource id into an XML NCName.
+func gmlID(id string) string {
+	id = invalidIDChars.ReplaceAllString(id, "_")
+	if id == "" || !(id[0] == '_' || id[0] >= 'A' && id[0] <= 'Z' || id[0] >= 'a' && id[0] <= 'z') {
+		id = "_" + id
+	}
+	return id
+}
+
+// formatValue writes a property value as XML Schema text, other values
+// than scalars as JSON.
+func formatValue(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool, int, int64, int32, float32:
+		return fmt.Sprint(x)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func (s *Service) writeGML(w http.ResponseWriter, q *query, features []*Feature, matched int, stamp, base string) error {
+	var names []string
+	for _, ft := range q.types {
+		names = append(names, s.Prefix+":"+ft.Name)
+	}
+	describe := base + "?SERVICE=WFS&VERSION=" + VERSION + "&REQUEST=DescribeFeatureType&TYPENAMES=" + strings.Join(names, ",")
+	props := map[string][]Property{}
+	for _, ft := range q.types {
+		props[ft.Name] = ft.Properties
+	}
+
+	geoms := make([]*geojson.Geometry, len(features))
+	for i, f := range features {
+		if f.Geometry != nil {
+			g, err := transformGeometry(f.Geometry, q.srs.fromWGS84)
+			if err != nil {
+				return ows.NewError(ows.INVALID_PARAMETER_VALUE, "srsName", "feature %s: %s", f.ResourceID(), err.Error())
+			}
+			geoms[i] = g
+		}
+	}
+
+	w.Header().Set("Content-Type", GML_FORMAT)
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	gw := &gmlWriter{enc: enc}
+	gw.start("wfs:FeatureCollection",
+		"xmlns:wfs", WFS_NAMESPACE,
+		"xmlns:gml", GML_NAMESPACE,
+		"xmlns:xsi", ows.XSI_NAMESPACE,
+		"xmlns:"+s.Prefix, s.Namespace,
+		"xsi:schemaLocation", WFS_NAMESPACE+" http://schemas.opengis.net/wfs/2.0/wfs.xsd "+
+			GML_NAMESPACE+" http://schemas.opengis.net/gml/3.2.1/gml.xsd "+s.Namespace+" "+describe,
+		"numberMatched", strconv.Itoa(matched),
+		"numberReturned", strconv.Itoa(len(features)),
+		"timeStamp", stamp,
+	)
+	for i, f := range features {
+		id := f.ResourceID()
+		if id == "" {
+			id = f.TypeName + "." + strconv.Itoa(q.startIndex+i)
+		}
+		id = gmlID(id)
+		elem := s.Prefix + ":" + f.TypeName
+		gw.start("wfs:member")
+		gw.start(elem, "gml:id", id)
+		if g := geoms[i]; g != nil {
+			gw.start(s.Prefix + ":" + GEOMETRY_PROPERTY)
+			gw.geometry(g, id+".geom", q.srsName)
+			gw.end(s.Prefix + ":" + GEOMETRY_PROPERTY)
+		}
+		for _, prop := range props[f.TypeName] {
+			if v := f.Properties[prop.Name]; v != nil {
+				gw.text(s.Prefix+":"+prop.Name, formatValue(v))
+			}
+		}
+		gw.end(elem)
+		gw.end("wfs:member")
+	}
+	gw.end("wfs:FeatureCollection")
+	if gw.err == nil {
+		gw.err = enc.Flush()
+	}
+	return gw.err
+}
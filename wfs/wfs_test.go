@@ -0,0 +1,387 @@
+package wfs
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/ows"
+)
+
+func newTestStore() *MemoryStore {
+	cities := geojson.NewFeatureCollection()
+	for i, c := range []struct {
+		name     string
+		lon, lat float64
+		pop      float64
+	}{
+		{"Beijing", 116.4, 39.9, 21.5},
+		{"Shanghai", 121.5, 31.2, 24.9},
+		{"Guangzhou", 113.3, 23.1, 18.7},
+		{"Chengdu", 104.1, 30.7, 21.2},
+		{"Harbin", 126.6, 45.8, 10.0},
+	} {
+		f := geojson.NewFeature(geojson.NewPointGeometry(vec3.Vec[float64]{c.lon, c.lat, 0}))
+		f.ID = float64(i + 1)
+		f.Properties["name"] = c.name
+		f.Properties["population"] = c.pop
+		cities.Append(f)
+	}
+	rivers := geojson.NewFeatureCollection()
+	r := geojson.NewFeature(geojson.NewLineStringGeometry([]vec3.Vec[float64]{{100, 30, 0}, {110, 30, 0}, {121, 31, 0}}))
+	r.ID = "yangtze"
+	r.Properties["name"] = "Yangtze & tributaries"
+	rivers.Append(r)
+
+	s := NewMemoryStore()
+	s.Add(&FeatureType{Name: "cities", Title: "Cities"}, cities)
+	s.Add(&FeatureType{Name: "rivers"}, rivers)
+	return s
+}
+
+func get(t *testing.T, u string) (*http.Response, []byte) {
+	resp, err := http.Get(u)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return resp, body
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := newTestStore()
+	fts := s.FeatureTypes()
+	assert.Len(t, fts, 2)
+	assert.Equal(t, []Property{{"name", "string"}, {"population", "double"}}, fts[0].Properties)
+	assert.Equal(t, 104.1, fts[0].Bounds.Min[0])
+	assert.Equal(t, 45.8, fts[0].Bounds.Max[1])
+
+	fs, n, err := s.Query(context.Background(), &Query{TypeName: "cities", StartIndex: 1, Count: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	assert.Len(t, fs, 2)
+	assert.Equal(t, "cities.2", fs[0].ResourceID())
+
+	fs, n, _ = s.Query(context.Background(), &Query{TypeName: "cities", Filter: &Comparison{Op: PROPERTY_IS_GREATER_THAN, Property: "population", Literal: "20"}, Count: -1})
+	assert.Equal(t, 3, n)
+	assert.Len(t, fs, 3)
+}
+
+func TestParseFilter(t *testing.T) {
+	s := newTestStore()
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0"><fes:PropertyIsEqualTo><fes:ValueReference>xr:name</fes:ValueReference><fes:Literal>Harbin</fes:Literal></fes:PropertyIsEqualTo></fes:Filter>`,
+			[]string{"Harbin"}},
+		{`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0"><fes:PropertyIsEqualTo matchCase="false"><fes:ValueReference>name</fes:ValueReference><fes:Literal>harbin</fes:Literal></fes:PropertyIsEqualTo></fes:Filter>`,
+			[]string{"Harbin"}},
+		{`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0"><fes:PropertyIsLessThan><fes:ValueReference>population</fes:ValueReference><fes:Literal>19</fes:Literal></fes:PropertyIsLessThan></fes:Filter>`,
+			[]string{"Guangzhou", "Harbin"}},
+		{`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0"><fes:PropertyIsLike wildCard="*" singleChar="?" escapeChar="\"><fes:ValueReference>name</fes:ValueReference><fes:Literal>?h*</fes:Literal></fes:PropertyIsLike></fes:Filter>`,
+			[]string{"Shanghai", "Chengdu"}},
+		{`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0"><fes:PropertyIsBetween><fes:ValueReference>population</fes:ValueReference><fes:LowerBoundary><fes:Literal>18.7</fes:Literal></fes:LowerBoundary><fes:UpperBoundary><fes:Literal>21.2</fes:Literal></fes:UpperBoundary></fes:PropertyIsBetween></fes:Filter>`,
+			[]string{"Guangzhou", "Chengdu"}},
+		{`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0"><fes:Or><fes:ResourceId rid="cities.1"/><fes:Not><fes:PropertyIsGreaterThanOrEqualTo><fes:ValueReference>population</fes:ValueReference><fes:Literal>11</fes:Literal></fes:PropertyIsGreaterThanOrEqualTo></fes:Not></fes:Or></fes:Filter>`,
+			[]string{"Beijing", "Harbin"}},
+		{`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0"><fes:ResourceId rid="cities.2"/><fes:ResourceId rid="3"/></fes:Filter>`,
+			[]string{"Shanghai", "Guangzhou"}},
+		// latitude first in the default CRS
+		{`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0" xmlns:gml="http://www.opengis.net/gml/3.2"><fes:BBOX><fes:ValueReference>geometry</fes:ValueReference><gml:Envelope srsName="urn:ogc:def:crs:EPSG::4326"><gml:lowerCorner>30 110</gml:lowerCorner><gml:upperCorner>50 130</gml:upperCorner></gml:Envelope></fes:BBOX></fes:Filter>`,
+			[]string{"Beijing", "Shanghai", "Harbin"}},
+		{`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0" xmlns:gml="http://www.opengis.net/gml/3.2"><fes:Intersects><gml:Polygon gml:id="p" srsName="http://www.opengis.net/def/crs/OGC/1.3/CRS84"><gml:exterior><gml:LinearRing><gml:posList>100 20 115 20 115 42 100 20</gml:posList></gml:LinearRing></gml:exterior></gml:Polygon></fes:Intersects></fes:Filter>`,
+			[]string{"Guangzhou"}},
+		{`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0" xmlns:gml="http://www.opengis.net/gml/3.2"><fes:Disjoint><gml:Envelope srsName="EPSG:3857"><gml:lowerCorner>12900000 4800000</gml:lowerCorner><gml:upperCorner>13000000 4900000</gml:upperCorner></gml:Envelope></fes:Disjoint></fes:Filter>`,
+			[]string{"Shanghai", "Guangzhou", "Chengdu", "Harbin"}},
+		// filter encoding 1.1
+		{`<ogc:Filter xmlns:ogc="http://www.opengis.net/ogc"><ogc:PropertyIsNotEqualTo><ogc:PropertyName>name</ogc:PropertyName><ogc:Literal>Beijing</ogc:Literal></ogc:PropertyIsNotEqualTo></ogc:Filter>`,
+			[]string{"Shanghai", "Guangzhou", "Chengdu", "Harbin"}},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter([]byte(tt.filter))
+		if !assert.Nil(t, err, tt.filter) {
+			continue
+		}
+		fs, _, err := s.Query(context.Background(), &Query{TypeName: "cities", Filter: f, Count: -1})
+		assert.Nil(t, err)
+		var names []string
+		for _, f := range fs {
+			names = append(names, f.Properties["name"].(string))
+		}
+		assert.Equal(t, tt.want, names, tt.filter)
+	}
+
+	for _, bad := range []string{
+		`<Filter/>`,
+		`<fes:Query xmlns:fes="http://www.opengis.net/fes/2.0"/>`,
+		`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0"><fes:PropertyIsEqualTo><fes:Literal>1</fes:Literal></fes:PropertyIsEqualTo></fes:Filter>`,
+		`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0"><fes:Beyond/></fes:Filter>`,
+		`<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0"><fes:BBOX><gml:Envelope xmlns:gml="http://www.opengis.net/gml/3.2"><gml:lowerCorner>1</gml:lowerCorner><gml:upperCorner>2 3</gml:upperCorner></gml:Envelope></fes:BBOX></fes:Filter>`,
+		`<fes:Filter`,
+	} {
+		_, err := ParseFilter([]byte(bad))
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	srv := httptest.NewServer(http.StripPrefix("/wfs", NewService("test features", newTestStore())))
+	defer srv.Close()
+
+	resp, body := get(t, srv.URL+"/wfs?SERVICE=WFS&REQUEST=GetCapabilities&ACCEPTVERSIONS=2.0.0")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// every element must resolve to a declared namespace
+	known := map[string]bool{WFS_NAMESPACE: true, ows.OWS_NAMESPACE: true, FES_NAMESPACE: true}
+	dec := xml.NewDecoder(strings.NewReader(string(body)))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		if se, ok := tok.(xml.StartElement); ok {
+			assert.True(t, known[se.Name.Space], se.Name.Space+" "+se.Name.Local)
+		}
+	}
+
+	var caps struct {
+		XMLName    xml.Name `xml:"http://www.opengis.net/wfs/2.0 WFS_Capabilities"`
+		Version    string   `xml:"version,attr"`
+		Title      string   `xml:"http://www.opengis.net/ows/1.1 ServiceIdentification>Title"`
+		Operations []struct {
+			Name string `xml:"name,attr"`
+			Get  struct {
+				Href string `xml:"http://www.w3.org/1999/xlink href,attr"`
+			} `xml:"http://www.opengis.net/ows/1.1 DCP>HTTP>Get"`
+		} `xml:"http://www.opengis.net/ows/1.1 OperationsMetadata>Operation"`
+		Constraints []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"http://www.opengis.net/ows/1.1 DefaultValue"`
+		} `xml:"http://www.opengis.net/ows/1.1 OperationsMetadata>Constraint"`
+		FeatureTypes []struct {
+			Name       string   `xml:"Name"`
+			Title      string   `xml:"Title"`
+			DefaultCRS string   `xml:"DefaultCRS"`
+			OtherCRS   []string `xml:"OtherCRS"`
+			Lower      string   `xml:"http://www.opengis.net/ows/1.1 WGS84BoundingBox>LowerCorner"`
+		} `xml:"FeatureTypeList>FeatureType"`
+		SpatialOperators []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"http://www.opengis.net/fes/2.0 Filter_Capabilities>Spatial_Capabilities>SpatialOperators>SpatialOperator"`
+	}
+	assert.Nil(t, xml.Unmarshal(body, &caps))
+	assert.Equal(t, "2.0.0", caps.Version)
+	assert.Equal(t, "test features", caps.Title)
+	assert.Len(t, caps.Operations, 3)
+	assert.Equal(t, "GetFeature", caps.Operations[2].Name)
+	assert.Equal(t, srv.URL+"/wfs?", caps.Operations[2].Get.Href)
+	assert.Contains(t, caps.Constraints, struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"http://www.opengis.net/ows/1.1 DefaultValue"`
+	}{"ImplementsResultPaging", "TRUE"})
+	assert.Len(t, caps.FeatureTypes, 2)
+	assert.Equal(t, "xr:cities", caps.FeatureTypes[0].Name)
+	assert.Equal(t, "Cities", caps.FeatureTypes[0].Title)
+	assert.Equal(t, "urn:ogc:def:crs:EPSG::4326", caps.FeatureTypes[0].DefaultCRS)
+	assert.Equal(t, []string{"urn:ogc:def:crs:EPSG::3857"}, caps.FeatureTypes[0].OtherCRS)
+	assert.Equal(t, "104.1 23.1", caps.FeatureTypes[0].Lower)
+	assert.Equal(t, "rivers", caps.FeatureTypes[1].Title)
+	assert.Len(t, caps.SpatialOperators, 3)
+}
+
+func TestDescribeFeatureType(t *testing.T) {
+	srv := httptest.NewServer(NewService("test features", newTestStore()))
+	defer srv.Close()
+
+	resp, body := get(t, srv.URL+"/?SERVICE=WFS&VERSION=2.0.0&REQUEST=DescribeFeatureType&TYPENAMES=xr:cities")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var schema struct {
+		TargetNamespace string `xml:"targetNamespace,attr"`
+		ComplexTypes    []struct {
+			Name      string `xml:"name,attr"`
+			Extension struct {
+				Base     string `xml:"base,attr"`
+				Elements []struct {
+					Name string `xml:"name,attr"`
+					Type string `xml:"type,attr"`
+				} `xml:"sequence>element"`
+			} `xml:"complexContent>extension"`
+		} `xml:"http://www.w3.org/2001/XMLSchema complexType"`
+		Elements []struct {
+			Name              string `xml:"name,attr"`
+			Type              string `xml:"type,attr"`
+			SubstitutionGroup string `xml:"substitutionGroup,attr"`
+		} `xml:"http://www.w3.org/2001/XMLSchema element"`
+	}
+	assert.Nil(t, xml.Unmarshal(body, &schema))
+	assert.Equal(t, DEFAULT_NAMESPACE, schema.TargetNamespace)
+	if assert.Len(t, schema.ComplexTypes, 1) {
+		ct := schema.ComplexTypes[0]
+		assert.Equal(t, "citiesType", ct.Name)
+		assert.Equal(t, "gml:AbstractFeatureType", ct.Extension.Base)
+		els := ct.Extension.Elements
+		if assert.Len(t, els, 3) {
+			assert.Equal(t, "gml:GeometryPropertyType", els[0].Type)
+			assert.Equal(t, "population", els[2].Name)
+			assert.Equal(t, "xsd:double", els[2].Type)
+		}
+	}
+	assert.Equal(t, "xr:citiesType", schema.Elements[0].Type)
+	assert.Equal(t, "gml:AbstractFeature", schema.Elements[0].SubstitutionGroup)
+
+	// all types without TYPENAMES
+	_, body = get(t, srv.URL+"/?SERVICE=WFS&VERSION=2.0.0&REQUEST=DescribeFeatureType")
+	schema.ComplexTypes = nil
+	assert.Nil(t, xml.Unmarshal(body, &schema))
+	assert.Len(t, schema.ComplexTypes, 2)
+}
+
+type gmlCollection struct {
+	NumberMatched  int `xml:"numberMatched,attr"`
+	NumberReturned int `xml:"numberReturned,attr"`
+	Members        []struct {
+		Feature struct {
+			XMLName xml.Name
+			ID      string `xml:"http://www.opengis.net/gml/3.2 id,attr"`
+			Point   struct {
+				SrsName string `xml:"srsName,attr"`
+				Pos     string `xml:"http://www.opengis.net/gml/3.2 pos"`
+			} `xml:"geometry>Point"`
+			Line struct {
+				PosList string `xml:"http://www.opengis.net/gml/3.2 posList"`
+			} `xml:"geometry>LineString"`
+			Name       string `xml:"http://pinkey.ltd/xr/features name"`
+			Population string `xml:"http://pinkey.ltd/xr/features population"`
+		} `xml:",any"`
+	} `xml:"http://www.opengis.net/wfs/2.0 member"`
+}
+
+func TestGetFeature(t *testing.T) {
+	srv := httptest.NewServer(NewService("test features", newTestStore()))
+	defer srv.Close()
+	base := srv.URL + "/?SERVICE=WFS&VERSION=2.0.0&REQUEST=GetFeature"
+
+	resp, body := get(t, base+"&TYPENAMES=xr:cities&COUNT=2&STARTINDEX=1")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, GML_FORMAT, resp.Header.Get("Content-Type"))
+	var fc gmlCollection
+	assert.Nil(t, xml.Unmarshal(body, &fc))
+	assert.Equal(t, 5, fc.NumberMatched)
+	assert.Equal(t, 2, fc.NumberReturned)
+	if assert.Len(t, fc.Members, 2) {
+		f := fc.Members[0].Feature
+		assert.Equal(t, xml.Name{Space: DEFAULT_NAMESPACE, Local: "cities"}, f.XMLName)
+		assert.Equal(t, "cities.2", f.ID)
+		assert.Equal(t, "urn:ogc:def:crs:EPSG::4326", f.Point.SrsName)
+		assert.Equal(t, "31.2 121.5", f.Point.Pos)
+		assert.Equal(t, "Shanghai", f.Name)
+		assert.Equal(t, "24.9", f.Population)
+	}
+
+	// longitude first for the short CRS form, projected coordinates for 3857
+	_, body = get(t, base+"&TYPENAMES=cities&RESOURCEID=cities.1&SRSNAME=EPSG:4326")
+	fc = gmlCollection{}
+	assert.Nil(t, xml.Unmarshal(body, &fc))
+	assert.Equal(t, "116.4 39.9", fc.Members[0].Feature.Point.Pos)
+	_, body = get(t, base+"&RESOURCEID=cities.1&SRSNAME=urn:ogc:def:crs:EPSG::3857")
+	fc = gmlCollection{}
+	assert.Nil(t, xml.Unmarshal(body, &fc))
+	assert.True(t, strings.HasPrefix(fc.Members[0].Feature.Point.Pos, "12957588.728"), fc.Members[0].Feature.Point.Pos)
+
+	// paging continues across types
+	_, body = get(t, base+"&TYPENAMES=cities,rivers&STARTINDEX=4&COUNT=5")
+	fc = gmlCollection{}
+	assert.Nil(t, xml.Unmarshal(body, &fc))
+	assert.Equal(t, 6, fc.NumberMatched)
+	if assert.Len(t, fc.Members, 2) {
+		assert.Equal(t, "Harbin", fc.Members[0].Feature.Name)
+		r := fc.Members[1].Feature
+		assert.Equal(t, "rivers.yangtze", r.ID)
+		assert.Equal(t, "30 100 30 110 31 121", r.Line.PosList)
+		assert.Equal(t, "Yangtze & tributaries", r.Name)
+	}
+
+	_, body = get(t, base+"&TYPENAMES=cities&RESULTTYPE=hits&BBOX=30,110,50,130")
+	fc = gmlCollection{}
+	assert.Nil(t, xml.Unmarshal(body, &fc))
+	assert.Equal(t, 3, fc.NumberMatched)
+	assert.Equal(t, 0, fc.NumberReturned)
+	assert.Empty(t, fc.Members)
+
+	filter := `<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0"><fes:PropertyIsLike wildCard="%" singleChar="_" escapeChar="!"><fes:ValueReference>name</fes:ValueReference><fes:Literal>%n</fes:Literal></fes:PropertyIsLike></fes:Filter>`
+	resp, body = get(t, base+"&TYPENAMES=cities&OUTPUTFORMAT=application/json&FILTER="+url.QueryEscape(filter))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, GEOJSON_FORMAT, resp.Header.Get("Content-Type"))
+	var counts struct {
+		NumberMatched  int `json:"numberMatched"`
+		NumberReturned int `json:"numberReturned"`
+	}
+	assert.Nil(t, json.Unmarshal(body, &counts))
+	assert.Equal(t, 1, counts.NumberMatched)
+	assert.Equal(t, 1, counts.NumberReturned)
+	var js geojson.FeatureCollection
+	assert.Nil(t, json.Unmarshal(body, &js))
+	if assert.Len(t, js.Features, 1) {
+		assert.Equal(t, "cities.5", js.Features[0].ID)
+		assert.Equal(t, vec3.Vec[float64]{126.6, 45.8, 0}, js.Features[0].Geometry.Point)
+	}
+
+	// bbox in web mercator around Guangzhou
+	_, body = get(t, base+"&TYPENAMES=cities&OUTPUTFORMAT=json&BBOX=12500000,2500000,12700000,2700000,EPSG:3857")
+	js.Features = nil
+	assert.Nil(t, json.Unmarshal(body, &js))
+	if assert.Len(t, js.Features, 1) {
+		assert.Equal(t, "Guangzhou", js.Features[0].Properties["name"])
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	srv := httptest.NewServer(NewService("test features", newTestStore()))
+	defer srv.Close()
+
+	tests := []struct {
+		query, code, locator string
+		status               int
+	}{
+		{"?REQUEST=GetCapabilities", ows.MISSING_PARAMETER_VALUE, "service", 400},
+		{"?SERVICE=WMS&REQUEST=GetCapabilities", ows.INVALID_PARAMETER_VALUE, "service", 400},
+		{"?SERVICE=WFS&REQUEST=GetCapabilities&ACCEPTVERSIONS=1.1.0", ows.VERSION_NEGOTIATION_FAILED, "AcceptVersions", 400},
+		{"?SERVICE=WFS&REQUEST=Transaction", ows.OPERATION_NOT_SUPPORTED, "request", 501},
+		{"?SERVICE=WFS&VERSION=1.1.0&REQUEST=GetFeature&TYPENAMES=cities", ows.INVALID_PARAMETER_VALUE, "version", 400},
+		{"?SERVICE=WFS&REQUEST=GetFeature", ows.MISSING_PARAMETER_VALUE, "typeNames", 400},
+		{"?SERVICE=WFS&REQUEST=GetFeature&TYPENAMES=roads", ows.INVALID_PARAMETER_VALUE, "typeNames", 400},
+		{"?SERVICE=WFS&REQUEST=GetFeature&TYPENAMES=cities&BBOX=1,2,3", ows.INVALID_PARAMETER_VALUE, "bbox", 400},
+		{"?SERVICE=WFS&REQUEST=GetFeature&TYPENAMES=cities&BBOX=1,2,3,4&RESOURCEID=cities.1", ows.INVALID_PARAMETER_VALUE, "filter", 400},
+		{"?SERVICE=WFS&REQUEST=GetFeature&TYPENAMES=cities&FILTER=%3CFilter", OPERATION_PARSING_FAILED, "filter", 400},
+		{"?SERVICE=WFS&REQUEST=GetFeature&TYPENAMES=cities&COUNT=-1", ows.INVALID_PARAMETER_VALUE, "count", 400},
+		{"?SERVICE=WFS&REQUEST=GetFeature&TYPENAMES=cities&OUTPUTFORMAT=shape-zip", ows.INVALID_PARAMETER_VALUE, "outputFormat", 400},
+		{"?SERVICE=WFS&REQUEST=GetFeature&TYPENAMES=cities&SRSNAME=EPSG:99999", ows.INVALID_PARAMETER_VALUE, "srsName", 400},
+		{"?SERVICE=WFS&REQUEST=DescribeFeatureType&OUTPUTFORMAT=application/json", ows.INVALID_PARAMETER_VALUE, "outputFormat", 400},
+	}
+	for _, tt := range tests {
+		resp, body := get(t, srv.URL+"/"+tt.query)
+		assert.Equal(t, tt.status, resp.StatusCode, tt.query)
+		var rep struct {
+			Exceptions []struct {
+				Code    string `xml:"exceptionCode,attr"`
+				Locator string `xml:"locator,attr"`
+			} `xml:"http://www.opengis.net/ows/1.1 Exception"`
+		}
+		assert.Nil(t, xml.Unmarshal(body, &rep), tt.query)
+		if assert.Len(t, rep.Exceptions, 1, tt.query) {
+			assert.Equal(t, tt.code, rep.Exceptions[0].Code, tt.query)
+			assert.Equal(t, tt.locator, rep.Exceptions[0].Locator, tt.query)
+		}
+	}
+}
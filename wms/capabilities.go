@@ -0,0 +1,244 @@
+package wms
+
+import (
+	"encoding/xml"
+	"math"
+	"strconv"
+
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/ows"
+	"pinkey.ltd/xr/proj"
+)
+
+// Capabilities is the service metadata of both WMS versions. The root
+// element is WMS_Capabilities for 1.3.0 and WMT_MS_Capabilities for 1.1.1.
+type Capabilities struct {
+	XMLName    xml.Name
+	Xmlns      string      `xml:"xmlns,attr,omitempty"`
+	Xlink      string      `xml:"xmlns:xlink,attr"`
+	Version    string      `xml:"version,attr"`
+	Service    ServiceInfo `xml:"Service"`
+	Capability Capability  `xml:"Capability"`
+}
+
+type ServiceInfo struct {
+	Name           string          `xml:"Name"`
+	Title          string          `xml:"Title"`
+	Abstract       string          `xml:"Abstract,omitempty"`
+	OnlineResource *OnlineResource `xml:"OnlineResource"`
+	MaxWidth       int             `xml:"MaxWidth,omitempty"`
+	MaxHeight      int             `xml:"MaxHeight,omitempty"`
+}
+
+type OnlineResource struct {
+	Type string `xml:"xlink:type,attr"`
+	Href string `xml:"xlink:href,attr"`
+}
+
+type Capability struct {
+	Request   Request    `xml:"Request"`
+	Exception []string   `xml:"Exception>Format"`
+	Layer     *LayerInfo `xml:"Layer"`
+}
+
+type Request struct {
+	GetCapabilities *Operation `xml:"GetCapabilities"`
+	GetMap          *Operation `xml:"GetMap"`
+	GetFeatureInfo  *Operation `xml:"GetFeatureInfo"`
+}
+
+type Operation struct {
+	Formats []string        `xml:"Format"`
+	Get     *OnlineResource `xml:"DCPType>HTTP>Get>OnlineResource"`
+}
+
+type LayerInfo struct {
+	Queryable         int                `xml:"queryable,attr,omitempty"`
+	Name              string             `xml:"Name,omitempty"`
+	Title             string             `xml:"Title"`
+	Abstract          string             `xml:"Abstract,omitempty"`
+	CRS               []string           `xml:"CRS,omitempty"`
+	SRS               []string           `xml:"SRS,omitempty"`
+	GeographicBBox    *GeographicBBox    `xml:"EX_GeographicBoundingBox,omitempty"`
+	LatLonBoundingBox *LatLonBoundingBox `xml:"LatLonBoundingBox,omitempty"`
+	BoundingBoxes     []BoundingBox      `xml:"BoundingBox"`
+	Styles            []StyleInfo        `xml:"Style"`
+	Layers            []*LayerInfo       `xml:"Layer"`
+}
+
+type GeographicBBox struct {
+	West  float64 `xml:"westBoundLongitude"`
+	East  float64 `xml:"eastBoundLongitude"`
+	South float64 `xml:"southBoundLatitude"`
+	North float64 `xml:"northBoundLatitude"`
+}
+
+type LatLonBoundingBox struct {
+	MinX float64 `xml:"minx,attr"`
+	MinY float64 `xml:"miny,attr"`
+	MaxX float64 `xml:"maxx,attr"`
+	MaxY float64 `xml:"maxy,attr"`
+}
+
+type BoundingBox struct {
+	CRS  string  `xml:"CRS,attr,omitempty"`
+	SRS  string  `xml:"SRS,attr,omitempty"`
+	MinX float64 `xml:"minx,attr"`
+	MinY float64 `xml:"miny,attr"`
+	MaxX float64 `xml:"maxx,attr"`
+	MaxY float64 `xml:"maxy,attr"`
+}
+
+type StyleInfo struct {
+	Name  string `xml:"Name"`
+	Title string `xml:"Title"`
+}
+
+// MAX_MERCATOR_LAT is the latitude limit of EPSG:3857.
+const MAX_MERCATOR_LAT = 85.0511287798066
+
+// projectBounds returns the extent of a WGS84 rectangle in an EPSG CRS,
+// sampling the edges so curved meridians and parallels are covered.
+func projectBounds(b vec2.Rect[float64], code int) (vec2.Rect[float64], bool) {
+	if code == 4326 {
+		return b, true
+	}
+	dst, err := proj.FromEPSG(code)
+	if err != nil {
+		return b, false
+	}
+	src, _ := proj.FromEPSG(4326)
+	tr, err := proj.NewTransformer(src, dst)
+	if err != nil {
+		return b, false
+	}
+	if code == 3857 {
+		b.Min[1] = max(b.Min[1], -MAX_MERCATOR_LAT)
+		b.Max[1] = min(b.Max[1], MAX_MERCATOR_LAT)
+	}
+	const n = 8
+	out := vec2.Rect[float64]{
+		Min: vec2.Vec[float64]{math.Inf(1), math.Inf(1)},
+		Max: vec2.Vec[float64]{math.Inf(-1), math.Inf(-1)},
+	}
+	for i := 0; i <= n; i++ {
+		f := float64(i) / n
+		lon := b.Min[0] + f*(b.Max[0]-b.Min[0])
+		lat := b.Min[1] + f*(b.Max[1]-b.Min[1])
+		for _, p := range [][2]float64{{lon, b.Min[1]}, {lon, b.Max[1]}, {b.Min[0], lat}, {b.Max[0], lat}} {
+			x, y, _, err := tr.Transform(p[0], p[1], 0)
+			if err != nil || math.IsNaN(x) || math.IsNaN(y) {
+				return b, false
+			}
+			out.Min[0], out.Min[1] = min(out.Min[0], x), min(out.Min[1], y)
+			out.Max[0], out.Max[1] = max(out.Max[0], x), max(out.Max[1], y)
+		}
+	}
+	return out, true
+}
+
+func (s *Service) boundingBoxes(b vec2.Rect[float64], version string) []BoundingBox {
+	var bbs []BoundingBox
+	for _, code := range s.CRS {
+		r, ok := projectBounds(b, code)
+		if !ok {
+			continue
+		}
+		bb := BoundingBox{MinX: r.Min[0], MinY: r.Min[1], MaxX: r.Max[0], MaxY: r.Max[1]}
+		ref := "EPSG:" + strconv.Itoa(code)
+		if version == VERSION_111 {
+			bb.SRS = ref
+		} else {
+			bb.CRS = ref
+			if crs, err := proj.FromEPSG(code); err == nil && crs.IsGeographic() {
+				bb.MinX, bb.MinY, bb.MaxX, bb.MaxY = bb.MinY, bb.MinX, bb.MaxY, bb.MaxX
+			}
+		}
+		bbs = append(bbs, bb)
+	}
+	return bbs
+}
+
+func (s *Service) setGeographicBounds(li *LayerInfo, b vec2.Rect[float64], version string) {
+	if version == VERSION_111 {
+		li.LatLonBoundingBox = &LatLonBoundingBox{MinX: b.Min[0], MinY: b.Min[1], MaxX: b.Max[0], MaxY: b.Max[1]}
+	} else {
+		li.GeographicBBox = &GeographicBBox{West: b.Min[0], East: b.Max[0], South: b.Min[1], North: b.Max[1]}
+	}
+	li.BoundingBoxes = s.boundingBoxes(b, version)
+}
+
+// Capabilities builds the service metadata of a WMS version for clients
+// reaching the service at baseURL.
+func (s *Service) Capabilities(baseURL, version string) *Capabilities {
+	online := &OnlineResource{Type: "simple", Href: baseURL + "?"}
+	caps := &Capabilities{
+		Xlink:   ows.XLINK_NAMESPACE,
+		Version: version,
+		Service: ServiceInfo{
+			Name:           "WMS",
+			Title:          s.Title,
+			Abstract:       s.Abstract,
+			OnlineResource: &OnlineResource{Type: "simple", Href: baseURL},
+		},
+	}
+	capsFormat, exceptionFormat := "text/xml", "XML"
+	if version == VERSION_111 {
+		caps.XMLName.Local = "WMT_MS_Capabilities"
+		caps.Service.Name = "OGC:WMS"
+		capsFormat, exceptionFormat = "application/vnd.ogc.wms_xml", "application/vnd.ogc.se_xml"
+	} else {
+		caps.XMLName.Local = "WMS_Capabilities"
+		caps.Xmlns = WMS_NAMESPACE
+		caps.Service.MaxWidth = s.MaxWidth
+		caps.Service.MaxHeight = s.MaxHeight
+	}
+	caps.Capability.Request = Request{
+		GetCapabilities: &Operation{Formats: []string{capsFormat}, Get: online},
+		GetMap:          &Operation{Formats: mapFormats, Get: online},
+		GetFeatureInfo:  &Operation{Formats: infoFormats, Get: online},
+	}
+	caps.Capability.Exception = []string{exceptionFormat}
+
+	root := &LayerInfo{Title: s.Title}
+	for _, code := range s.CRS {
+		ref := "EPSG:" + strconv.Itoa(code)
+		if version == VERSION_111 {
+			root.SRS = append(root.SRS, ref)
+		} else {
+			root.CRS = append(root.CRS, ref)
+		}
+	}
+	if version == VERSION_130 {
+		root.CRS = append(root.CRS, "CRS:84")
+	}
+
+	var all vec2.Rect[float64]
+	for i, l := range s.Layers {
+		b := l.bounds()
+		li := &LayerInfo{
+			Name:     l.Name,
+			Title:    l.Title,
+			Abstract: l.Abstract,
+			Styles:   []StyleInfo{{Name: DEFAULT_STYLE, Title: "Default"}},
+		}
+		if li.Title == "" {
+			li.Title = l.Name
+		}
+		if l.queryable() {
+			li.Queryable = 1
+		}
+		s.setGeographicBounds(li, b, version)
+		root.Layers = append(root.Layers, li)
+		if i == 0 {
+			all = b
+		} else {
+			all = vec2.Joined(&all, &b)
+		}
+	}
+	if len(s.Layers) > 0 {
+		s.setGeographicBounds(root, all, version)
+	}
+	caps.Capability.Layer = root
+	return caps
+}
@@ -0,0 +1,378 @@
+package wms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+
+	_ "golang.org/x/image/webp"
+
+	"golang.org/x/image/vector"
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/proj"
+	"pinkey.ltd/xr/tiles"
+)
+
+// Style is the symbology of a vector layer. Widths and radii are in pixels.
+type Style struct {
+	Fill        color.NRGBA
+	Stroke      color.NRGBA
+	StrokeWidth float64
+	PointRadius float64
+}
+
+// DefaultStyle draws translucent blue areas with solid outlines.
+var DefaultStyle = &Style{
+	Fill:        color.NRGBA{0x33, 0x88, 0xff, 0x66},
+	Stroke:      color.NRGBA{0x33, 0x88, 0xff, 0xff},
+	StrokeWidth: 2,
+	PointRadius: 4,
+}
+
+// CIRCLE_SEGMENTS is the number of edges of the polygon drawn for round
+// points and line joins.
+const CIRCLE_SEGMENTS = 16
+
+// mapping converts between pixels of the requested image, the request CRS
+// and WGS84 longitude and latitude.
+type mapping struct {
+	crs           *proj.CRS
+	code          int
+	minX, minY    float64 // request extent, x east and y north
+	maxX, maxY    float64
+	width, height int
+	wgs84         *proj.Transformer // WGS84 to crs, nil when crs is WGS84
+}
+
+func newMapping(code int, bbox [4]float64, width, height int) (*mapping, error) {
+	crs, err := proj.FromEPSG(code)
+	if err != nil {
+		return nil, err
+	}
+	m := &mapping{crs: crs, code: code, minX: bbox[0], minY: bbox[1], maxX: bbox[2], maxY: bbox[3], width: width, height: height}
+	if code != 4326 {
+		wgs84, err := proj.FromEPSG(4326)
+		if err != nil {
+			return nil, err
+		}
+		if m.wgs84, err = proj.NewTransformer(wgs84, crs); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *mapping) resX() float64 { return (m.maxX - m.minX) / float64(m.width) }
+func (m *mapping) resY() float64 { return (m.maxY - m.minY) / float64(m.height) }
+
+// pixelToCRS returns the CRS position of an image position in pixels.
+func (m *mapping) pixelToCRS(px, py float64) (float64, float64) {
+	return m.minX + px*m.resX(), m.maxY - py*m.resY()
+}
+
+func (m *mapping) crsToPixel(x, y float64) (float64, float64) {
+	return (x - m.minX) / m.resX(), (m.maxY - y) / m.resY()
+}
+
+func (m *mapping) toLonLat(x, y float64) (float64, float64, error) {
+	if m.wgs84 == nil {
+		return x, y, nil
+	}
+	lon, lat, _, err := m.wgs84.Inverse(x, y, 0)
+	return lon, lat, err
+}
+
+func (m *mapping) lonLatToPixel(p vec3.Vec[float64]) (float64, float64, error) {
+	x, y := p[0], p[1]
+	if m.wgs84 != nil {
+		var err error
+		if x, y, _, err = m.wgs84.Transform(x, y, 0); err != nil {
+			return 0, 0, err
+		}
+	}
+	px, py := m.crsToPixel(x, y)
+	return px, py, nil
+}
+
+// canvas rasterizes vector geometry onto an image.
+type canvas struct {
+	dst *image.RGBA
+	m   *mapping
+	z   *vector.Rasterizer
+}
+
+func newCanvas(dst *image.RGBA, m *mapping) *canvas {
+	b := dst.Bounds()
+	return &canvas{dst: dst, m: m, z: vector.NewRasterizer(b.Dx(), b.Dy())}
+}
+
+func (c *canvas) reset() {
+	b := c.dst.Bounds()
+	c.z.Reset(b.Dx(), b.Dy())
+}
+
+func (c *canvas) paint(col color.NRGBA) {
+	if col.A == 0 {
+		return
+	}
+	c.z.Draw(c.dst, c.dst.Bounds(), image.NewUniform(col), image.Point{})
+}
+
+// project converts a WGS84 path to pixels.
+func (c *canvas) project(path []vec3.Vec[float64]) ([][2]float64, error) {
+	out := make([][2]float64, len(path))
+	for i, p := range path {
+		x, y, err := c.m.lonLatToPixel(p)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = [2]float64{x, y}
+	}
+	return out, nil
+}
+
+// The rasterizer accumulates signed coverage, so every shape is added with
+// the same orientation to let overlapping strokes merge instead of cancel.
+// Holes of polygons are added with the opposite one.
+
+func signedArea(ring [][2]float64) float64 {
+	a := 0.0
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a += ring[j][0]*ring[i][1] - ring[i][0]*ring[j][1]
+	}
+	return a / 2
+}
+
+func (c *canvas) addRing(ring [][2]float64, positive bool) {
+	if len(ring) < 3 {
+		return
+	}
+	if (signedArea(ring) > 0) != positive {
+		r := make([][2]float64, len(ring))
+		for i := range ring {
+			r[i] = ring[len(ring)-1-i]
+		}
+		ring = r
+	}
+	c.z.MoveTo(float32(ring[0][0]), float32(ring[0][1]))
+	for _, p := range ring[1:] {
+		c.z.LineTo(float32(p[0]), float32(p[1]))
+	}
+	c.z.ClosePath()
+}
+
+func (c *canvas) addCircle(p [2]float64, r float64) {
+	ring := make([][2]float64, CIRCLE_SEGMENTS)
+	for i := range ring {
+		a := 2 * math.Pi * float64(i) / CIRCLE_SEGMENTS
+		ring[i] = [2]float64{p[0] + r*math.Cos(a), p[1] + r*math.Sin(a)}
+	}
+	c.addRing(ring, false)
+}
+
+func (c *canvas) addStroke(line [][2]float64, width float64) {
+	h := width / 2
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		dx, dy := b[0]-a[0], b[1]-a[1]
+		l := math.Hypot(dx, dy)
+		if l == 0 {
+			continue
+		}
+		nx, ny := -dy/l*h, dx/l*h
+		c.addRing([][2]float64{{a[0] + nx, a[1] + ny}, {b[0] + nx, b[1] + ny}, {b[0] - nx, b[1] - ny}, {a[0] - nx, a[1] - ny}}, false)
+	}
+	// round joins and caps
+	if width > 1.5 {
+		for _, p := range line {
+			c.addCircle(p, h)
+		}
+	}
+}
+
+func (c *canvas) drawLines(lines [][]vec3.Vec[float64], s *Style) error {
+	if s.StrokeWidth <= 0 {
+		return nil
+	}
+	c.reset()
+	for _, l := range lines {
+		px, err := c.project(l)
+		if err != nil {
+			return err
+		}
+		c.addStroke(px, s.StrokeWidth)
+	}
+	c.paint(s.Stroke)
+	return nil
+}
+
+func (c *canvas) drawPolygons(polys [][][]vec3.Vec[float64], s *Style) error {
+	c.reset()
+	var outlines [][]vec3.Vec[float64]
+	for _, rings := range polys {
+		for i, r := range rings {
+			px, err := c.project(r)
+			if err != nil {
+				return err
+			}
+			c.addRing(px, i == 0)
+			outlines = append(outlines, r)
+		}
+	}
+	c.paint(s.Fill)
+	return c.drawLines(outlines, s)
+}
+
+func (c *canvas) drawPoints(pts []vec3.Vec[float64], s *Style) error {
+	px, err := c.project(pts)
+	if err != nil {
+		return err
+	}
+	c.reset()
+	for _, p := range px {
+		c.addCircle(p, s.PointRadius)
+	}
+	c.paint(s.Fill)
+	if s.StrokeWidth > 0 {
+		c.reset()
+		for _, p := range px {
+			ring := make([][2]float64, CIRCLE_SEGMENTS+1)
+			for i := range ring {
+				a := 2 * math.Pi * float64(i) / CIRCLE_SEGMENTS
+				ring[i] = [2]float64{p[0] + s.PointRadius*math.Cos(a), p[1] + s.PointRadius*math.Sin(a)}
+			}
+			c.addStroke(ring, s.StrokeWidth)
+		}
+		c.paint(s.Stroke)
+	}
+	return nil
+}
+
+func (c *canvas) drawGeometry(g *geojson.Geometry, s *Style) error {
+	switch g.Type {
+	case geojson.Point:
+		return c.drawPoints([]vec3.Vec[float64]{g.Point}, s)
+	case geojson.MultiPoint:
+		return c.drawPoints(g.MultiPoint, s)
+	case geojson.LineString:
+		return c.drawLines([][]vec3.Vec[float64]{g.LineString}, s)
+	case geojson.MultiLineString:
+		return c.drawLines(g.MultiLineString, s)
+	case geojson.Polygon:
+		return c.drawPolygons([][][]vec3.Vec[float64]{g.Polygon}, s)
+	case geojson.MultiPolygon:
+		return c.drawPolygons(g.MultiPolygon, s)
+	}
+	for _, sub := range g.Geometries {
+		if err := c.drawGeometry(sub, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drawFeatures renders the features of a vector layer. Features that
+// cannot be projected to the request CRS are skipped.
+func drawFeatures(dst *image.RGBA, m *mapping, fc *geojson.FeatureCollection, s *Style) {
+	if s == nil {
+		s = DefaultStyle
+	}
+	c := newCanvas(dst, m)
+	for _, f := range fc.Features {
+		if f.Geometry != nil {
+			c.drawGeometry(f.Geometry, s)
+		}
+	}
+}
+
+// drawTiles resamples the tiles of a raster source into the requested
+// image with nearest neighbour sampling, using the zoom level whose
+// resolution best matches the request.
+func drawTiles(ctx context.Context, dst *image.RGBA, m *mapping, src tiles.TileSource) error {
+	info := src.Info()
+	g := info.Grid
+	grid, err := proj.FromEPSG(g.EPSG)
+	if err != nil {
+		return err
+	}
+	var tr *proj.Transformer
+	if g.EPSG != m.code {
+		if tr, err = proj.NewTransformer(m.crs, grid); err != nil {
+			return err
+		}
+	}
+	toGrid := func(px, py float64) (float64, float64, error) {
+		x, y := m.pixelToCRS(px, py)
+		if tr == nil {
+			return x, y, nil
+		}
+		x, y, _, err := tr.Transform(x, y, 0)
+		return x, y, err
+	}
+
+	// resolution in grid units at the image centre
+	cx, cy := float64(m.width)/2, float64(m.height)/2
+	x0, y0, err := toGrid(cx, cy)
+	if err != nil {
+		return err
+	}
+	x1, y1, err := toGrid(cx+1, cy)
+	if err != nil {
+		return err
+	}
+	z := g.ZoomForResolution(math.Hypot(x1-x0, y1-y0))
+	z = max(info.MinZoom, min(info.MaxZoom, z))
+	dx, dy := g.TileSpan(z)
+	size := float64(g.TileSize)
+
+	cache := map[tiles.Tile]image.Image{}
+	fetch := func(t tiles.Tile) (image.Image, error) {
+		if img, ok := cache[t]; ok {
+			return img, nil
+		}
+		td, err := src.Tile(ctx, t)
+		var img image.Image
+		if err == nil {
+			img, _, err = image.Decode(bytes.NewReader(td.Data))
+		}
+		if errors.Is(err, tiles.ErrTileNotFound) {
+			err = nil
+		}
+		cache[t] = img
+		return img, err
+	}
+
+	layer := image.NewRGBA(dst.Bounds())
+	for py := 0; py < m.height; py++ {
+		for px := 0; px < m.width; px++ {
+			x, y, err := toGrid(float64(px)+0.5, float64(py)+0.5)
+			if err != nil || x < g.Extent.Min[0] || x >= g.Extent.Max[0] || y <= g.Extent.Min[1] || y > g.Extent.Max[1] {
+				continue
+			}
+			t := g.TileAt(x, y, z)
+			img, err := fetch(t)
+			if err != nil {
+				return err
+			}
+			if img == nil {
+				continue
+			}
+			b := g.TileBounds(t)
+			ix := int((x - b.Min[0]) / dx * size)
+			iy := int((b.Max[1] - y) / dy * size)
+			ib := img.Bounds()
+			ix = min(ib.Min.X+ix*ib.Dx()/g.TileSize, ib.Max.X-1)
+			iy = min(ib.Min.Y+iy*ib.Dy()/g.TileSize, ib.Max.Y-1)
+			layer.Set(px, py, img.At(ix, iy))
+		}
+	}
+	draw.Draw(dst, dst.Bounds(), layer, image.Point{}, draw.Over)
+	return nil
+}
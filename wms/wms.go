@@ -0,0 +1,429 @@
+// Package wms implements an OGC WMS 1.1.1 and 1.3.0 server that renders
+// vector layers and resamples raster tile sources without an external map
+// engine.
+//
+// WMS 1.3.0 lists coordinates in the axis order of the CRS, so a BBOX in a
+// geographic EPSG CRS such as EPSG:4326 is latitude first. CRS:84 and all
+// WMS 1.1.1 requests are longitude first.
+package wms
+
+import (
+	"encoding/xml"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/ows"
+	"pinkey.ltd/xr/proj"
+	"pinkey.ltd/xr/tiles"
+)
+
+const (
+	VERSION_111 = "1.1.1"
+	VERSION_130 = "1.3.0"
+
+	WMS_NAMESPACE = "http://www.opengis.net/wms"
+	OGC_NAMESPACE = "http://www.opengis.net/ogc"
+
+	DEFAULT_STYLE = "default"
+
+	// FEATURE_INFO_RADIUS is the GetFeatureInfo search radius in pixels.
+	FEATURE_INFO_RADIUS = 3
+)
+
+// Service exception codes.
+const (
+	INVALID_FORMAT      = "InvalidFormat"
+	INVALID_CRS         = "InvalidCRS"
+	INVALID_SRS         = "InvalidSRS"
+	LAYER_NOT_DEFINED   = "LayerNotDefined"
+	STYLE_NOT_DEFINED   = "StyleNotDefined"
+	LAYER_NOT_QUERYABLE = "LayerNotQueryable"
+	INVALID_POINT       = "InvalidPoint"
+)
+
+var (
+	mapFormats  = []string{"image/png", "image/jpeg"}
+	infoFormats = []string{"application/json", "text/plain"}
+)
+
+// Layer is a vector layer when Features is set and a raster layer when
+// Source is set.
+type Layer struct {
+	Name     string
+	Title    string
+	Abstract string
+	// Features are in WGS84 longitude and latitude.
+	Features *geojson.FeatureCollection
+	Style    *Style
+	Source   tiles.TileSource
+}
+
+func (l *Layer) queryable() bool {
+	return l.Features != nil
+}
+
+// bounds returns the WGS84 extent of the layer.
+func (l *Layer) bounds() vec2.Rect[float64] {
+	if l.Source != nil {
+		return l.Source.Info().Bounds
+	}
+	return l.Features.Bound()
+}
+
+// Service is a WMS server.
+type Service struct {
+	Title    string
+	Abstract string
+	Layers   []*Layer
+	// CRS lists the EPSG codes advertised in the capabilities. GetMap
+	// accepts any CRS known to the proj package.
+	CRS []int
+	// MaxWidth and MaxHeight limit the size of rendered images.
+	MaxWidth  int
+	MaxHeight int
+	// BaseURL is the public URL of the service used in capabilities,
+	// derived from each request when empty.
+	BaseURL string
+}
+
+func NewService(title string, layers ...*Layer) *Service {
+	return &Service{Title: title, Layers: layers, CRS: []int{4326, 3857}, MaxWidth: 4096, MaxHeight: 4096}
+}
+
+func (s *Service) layer(name string) (*Layer, bool) {
+	for _, l := range s.Layers {
+		if l.Name == name {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	p := ows.ParseParams(r.URL.Query())
+	version := p.Get("VERSION")
+	if version == "" {
+		version = p.Get("WMTVER")
+	}
+	if version != VERSION_111 {
+		version = VERSION_130
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, ows.NewError(ows.OPERATION_NOT_SUPPORTED, "", "method %s is not supported", r.Method), version)
+		return
+	}
+	if svc := p.Get("SERVICE"); svc != "" && !strings.EqualFold(svc, "WMS") {
+		writeError(w, ows.NewError(ows.INVALID_PARAMETER_VALUE, "SERVICE", "service must be WMS, got %q", svc), version)
+		return
+	}
+
+	var err error
+	switch op := p.Get("REQUEST"); {
+	case strings.EqualFold(op, "GetCapabilities"), strings.EqualFold(op, "capabilities"):
+		base := s.BaseURL
+		if base == "" {
+			base = ows.BaseURL(r)
+		}
+		caps := s.Capabilities(base, version)
+		b, _ := xml.MarshalIndent(caps, "", "  ")
+		ct := "text/xml; charset=utf-8"
+		if version == VERSION_111 {
+			ct = "application/vnd.ogc.wms_xml; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", ct)
+		w.Write([]byte(xml.Header))
+		w.Write(b)
+	case strings.EqualFold(op, "GetMap"), strings.EqualFold(op, "map"):
+		err = s.getMap(w, r, p, version)
+	case strings.EqualFold(op, "GetFeatureInfo"), strings.EqualFold(op, "feature_info"):
+		err = s.getFeatureInfo(w, p, version)
+	case op == "":
+		err = ows.NewError(ows.MISSING_PARAMETER_VALUE, "REQUEST", "missing parameter REQUEST")
+	default:
+		err = ows.NewError(ows.OPERATION_NOT_SUPPORTED, "REQUEST", "unsupported request %q", op)
+	}
+	if err != nil {
+		writeError(w, err, version)
+	}
+}
+
+// mapRequest holds the parameters shared by GetMap and GetFeatureInfo.
+type mapRequest struct {
+	layers []*Layer
+	m      *mapping
+	format string
+}
+
+func (s *Service) parseMap(p ows.Params, version string, needFormat bool) (*mapRequest, error) {
+	names, err := p.Require("LAYERS")
+	if err != nil {
+		return nil, err
+	}
+	req := &mapRequest{}
+	for _, n := range strings.Split(names, ",") {
+		l, ok := s.layer(n)
+		if !ok {
+			return nil, ows.NewError(LAYER_NOT_DEFINED, "LAYERS", "unknown layer %q", n)
+		}
+		req.layers = append(req.layers, l)
+	}
+	if styles := p.Get("STYLES"); styles != "" {
+		for _, st := range strings.Split(styles, ",") {
+			if st != "" && st != DEFAULT_STYLE {
+				return nil, ows.NewError(STYLE_NOT_DEFINED, "STYLES", "unknown style %q", st)
+			}
+		}
+	}
+
+	crsParam, crsCode := "CRS", INVALID_CRS
+	if version == VERSION_111 {
+		crsParam, crsCode = "SRS", INVALID_SRS
+	}
+	ref, err := p.Require(crsParam)
+	if err != nil {
+		return nil, err
+	}
+	code, err := proj.ParseEPSGCode(ref)
+	if err != nil {
+		return nil, ows.NewError(crsCode, crsParam, "unsupported %s %q", crsParam, ref)
+	}
+	crs, err := proj.FromEPSG(code)
+	if err != nil {
+		return nil, ows.NewError(crsCode, crsParam, "unsupported %s %q", crsParam, ref)
+	}
+
+	bb, err := p.Require("BBOX")
+	if err != nil {
+		return nil, err
+	}
+	var bbox [4]float64
+	parts := strings.Split(bb, ",")
+	if len(parts) != 4 {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "BBOX", "BBOX needs four numbers, got %q", bb)
+	}
+	for i, part := range parts {
+		if bbox[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64); err != nil {
+			return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "BBOX", "invalid BBOX %q", bb)
+		}
+	}
+	if swapAxes(version, ref, crs) {
+		bbox = [4]float64{bbox[1], bbox[0], bbox[3], bbox[2]}
+	}
+	if bbox[0] >= bbox[2] || bbox[1] >= bbox[3] {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "BBOX", "BBOX minimum must be less than maximum: %q", bb)
+	}
+
+	width, err := requireInt(p, "WIDTH")
+	if err != nil {
+		return nil, err
+	}
+	height, err := requireInt(p, "HEIGHT")
+	if err != nil {
+		return nil, err
+	}
+	if width <= 0 || height <= 0 || width > s.MaxWidth || height > s.MaxHeight {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "WIDTH", "image size %dx%d is outside 1x1 to %dx%d", width, height, s.MaxWidth, s.MaxHeight)
+	}
+
+	if needFormat {
+		if req.format, err = p.Require("FORMAT"); err != nil {
+			return nil, err
+		}
+		if !contains(mapFormats, req.format) {
+			return nil, ows.NewError(INVALID_FORMAT, "FORMAT", "unsupported format %q", req.format)
+		}
+	}
+	if req.m, err = newMapping(code, bbox, width, height); err != nil {
+		return nil, ows.NewError(crsCode, crsParam, "%s", err.Error())
+	}
+	return req, nil
+}
+
+// swapAxes reports whether a request lists latitude before longitude.
+func swapAxes(version, ref string, crs *proj.CRS) bool {
+	if version != VERSION_130 || !crs.IsGeographic() {
+		return false
+	}
+	u := strings.ToUpper(ref)
+	return !strings.Contains(u, "CRS84") && !strings.Contains(u, "CRS:84")
+}
+
+func requireInt(p ows.Params, name string) (int, error) {
+	if _, err := p.Require(name); err != nil {
+		return 0, err
+	}
+	return p.Int(name, 0)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseColor parses a BGCOLOR value of the form 0xRRGGBB.
+func parseColor(s string) (color.NRGBA, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"), 16, 32)
+	if err != nil || len(s) != 8 {
+		return color.NRGBA{}, ows.NewError(ows.INVALID_PARAMETER_VALUE, "BGCOLOR", "invalid BGCOLOR %q", s)
+	}
+	return color.NRGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
+}
+
+func (s *Service) getMap(w http.ResponseWriter, r *http.Request, p ows.Params, version string) error {
+	req, err := s.parseMap(p, version, true)
+	if err != nil {
+		return err
+	}
+	bg := color.NRGBA{0xff, 0xff, 0xff, 0xff}
+	if v := p.Get("BGCOLOR"); v != "" {
+		if bg, err = parseColor(v); err != nil {
+			return err
+		}
+	}
+	transparent := strings.EqualFold(p.Get("TRANSPARENT"), "TRUE") && req.format == "image/png"
+
+	img := image.NewRGBA(image.Rect(0, 0, req.m.width, req.m.height))
+	if !transparent {
+		draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	}
+	for _, l := range req.layers {
+		if l.Source != nil {
+			if err := drawTiles(r.Context(), img, req.m, l.Source); err != nil {
+				return err
+			}
+		} else if l.Features != nil {
+			drawFeatures(img, req.m, l.Features, l.Style)
+		}
+	}
+
+	w.Header().Set("Content-Type", req.format)
+	if req.format == "image/jpeg" {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+	}
+	return png.Encode(w, img)
+}
+
+func (s *Service) getFeatureInfo(w http.ResponseWriter, p ows.Params, version string) error {
+	req, err := s.parseMap(p, version, false)
+	if err != nil {
+		return err
+	}
+	names, err := p.Require("QUERY_LAYERS")
+	if err != nil {
+		return err
+	}
+	var queried []*Layer
+	for _, n := range strings.Split(names, ",") {
+		l, ok := s.layer(n)
+		if !ok {
+			return ows.NewError(LAYER_NOT_DEFINED, "QUERY_LAYERS", "unknown layer %q", n)
+		}
+		if !l.queryable() {
+			return ows.NewError(LAYER_NOT_QUERYABLE, "QUERY_LAYERS", "layer %s is not queryable", n)
+		}
+		queried = append(queried, l)
+	}
+	format, err := p.Require("INFO_FORMAT")
+	if err != nil {
+		return err
+	}
+	if !contains(infoFormats, format) {
+		return ows.NewError(INVALID_FORMAT, "INFO_FORMAT", "unsupported info format %q", format)
+	}
+	iName, jName := "I", "J"
+	if version == VERSION_111 {
+		iName, jName = "X", "Y"
+	}
+	i, err := requireInt(p, iName)
+	if err != nil {
+		return err
+	}
+	j, err := requireInt(p, jName)
+	if err != nil {
+		return err
+	}
+	if i < 0 || j < 0 || i >= req.m.width || j >= req.m.height {
+		return ows.NewError(INVALID_POINT, iName, "pixel %d,%d is outside the image", i, j)
+	}
+	count, err := p.Int("FEATURE_COUNT", 1)
+	if err != nil {
+		return err
+	}
+
+	m := req.m
+	x, y := m.pixelToCRS(float64(i)+0.5, float64(j)+0.5)
+	lon, lat, err := m.toLonLat(x, y)
+	if err != nil {
+		return ows.NewError(INVALID_POINT, iName, "%s", err.Error())
+	}
+	lon2, lat2, err := m.toLonLat(x+FEATURE_INFO_RADIUS*m.resX(), y)
+	if err != nil {
+		return ows.NewError(INVALID_POINT, iName, "%s", err.Error())
+	}
+	pt := vec2.Vec[float64]{lon, lat}
+	tol := (&vec2.Vec[float64]{lon2 - lon, lat2 - lat}).Length()
+
+	hits := geojson.NewFeatureCollection()
+	for _, l := range queried {
+		for _, f := range l.Features.Features {
+			if len(hits.Features) >= count {
+				break
+			}
+			if f.Geometry != nil && f.Geometry.Distance(pt) <= tol {
+				hits.Append(f)
+			}
+		}
+	}
+
+	return ows.WriteFeatureInfo(w, hits, format)
+}
+
+type serviceException struct {
+	Code    string `xml:"code,attr,omitempty"`
+	Locator string `xml:"locator,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+type serviceExceptionReport struct {
+	XMLName    xml.Name           `xml:"ServiceExceptionReport"`
+	Xmlns      string             `xml:"xmlns,attr,omitempty"`
+	Version    string             `xml:"version,attr"`
+	Exceptions []serviceException `xml:"ServiceException"`
+}
+
+// writeError writes a WMS service exception report. Errors that are not
+// an *ows.Error are reported without a code.
+func writeError(w http.ResponseWriter, err error, version string) {
+	e, ok := err.(*ows.Error)
+	if !ok {
+		e = &ows.Error{Text: err.Error(), Status: http.StatusInternalServerError}
+	}
+	rep := &serviceExceptionReport{
+		Version:    version,
+		Exceptions: []serviceException{{Code: e.Code, Locator: e.Locator, Text: e.Text}},
+	}
+	ct := "text/xml; charset=utf-8"
+	if version == VERSION_130 {
+		rep.Xmlns = OGC_NAMESPACE
+	} else {
+		ct = "application/vnd.ogc.se_xml; charset=utf-8"
+	}
+	b, _ := xml.MarshalIndent(rep, "", "  ")
+	w.Header().Set("Content-Type", ct)
+	w.WriteHeader(e.Status)
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+}
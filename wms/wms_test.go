@@ -0,0 +1,271 @@
+package wms
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/tiles"
+)
+
+var (
+	red   = color.NRGBA{0xff, 0, 0, 0xff}
+	green = color.NRGBA{0, 0xff, 0, 0xff}
+	white = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+func newTestService(t *testing.T) *Service {
+	// a single red world tile at zoom 0
+	root := t.TempDir()
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	for i := 0; i < len(img.Pix); i += 4 {
+		copy(img.Pix[i:], []uint8{red.R, red.G, red.B, red.A})
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, png.Encode(&buf, img))
+	path := filepath.Join(root, "0", "0", "0.png")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	assert.Nil(t, os.WriteFile(path, buf.Bytes(), 0o644))
+	src, err := tiles.NewDirSource(root, tiles.PNG)
+	assert.Nil(t, err)
+
+	// a square from 0,40 to 10,50
+	sq := geojson.NewFeature(geojson.NewPolygonGeometry([][]vec3.Vec[float64]{{
+		{0, 40, 0}, {10, 40, 0}, {10, 50, 0}, {0, 50, 0}, {0, 40, 0},
+	}}))
+	sq.ID = "block-1"
+	sq.Properties["name"] = "square"
+	fc := geojson.NewFeatureCollection()
+	fc.Append(sq)
+
+	return NewService("test map",
+		&Layer{Name: "base", Source: src},
+		&Layer{Name: "blocks", Title: "Blocks", Features: fc, Style: &Style{Fill: green}},
+	)
+}
+
+func get(t *testing.T, url string) (*http.Response, []byte) {
+	resp, err := http.Get(url)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return resp, body
+}
+
+func getImage(t *testing.T, url string) image.Image {
+	resp, body := get(t, url)
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode, string(body)) {
+		return image.NewNRGBA(image.Rect(0, 0, 0, 0))
+	}
+	img, _, err := image.Decode(bytes.NewReader(body))
+	assert.Nil(t, err)
+	return img
+}
+
+func at(img image.Image, x, y int) color.NRGBA {
+	return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+}
+
+type layerCaps struct {
+	Queryable int      `xml:"queryable,attr"`
+	Name      string   `xml:"Name"`
+	Title     string   `xml:"Title"`
+	CRS       []string `xml:"CRS"`
+	SRS       []string `xml:"SRS"`
+	West      float64  `xml:"EX_GeographicBoundingBox>westBoundLongitude"`
+	North     float64  `xml:"EX_GeographicBoundingBox>northBoundLatitude"`
+	LatLon    struct {
+		MinX float64 `xml:"minx,attr"`
+		MaxY float64 `xml:"maxy,attr"`
+	} `xml:"LatLonBoundingBox"`
+	BBoxes []struct {
+		CRS  string  `xml:"CRS,attr"`
+		SRS  string  `xml:"SRS,attr"`
+		MinX float64 `xml:"minx,attr"`
+		MinY float64 `xml:"miny,attr"`
+	} `xml:"BoundingBox"`
+	Layers []layerCaps `xml:"Layer"`
+}
+
+type capabilities struct {
+	XMLName   xml.Name
+	Version   string   `xml:"version,attr"`
+	Title     string   `xml:"Service>Title"`
+	MapFormat []string `xml:"Capability>Request>GetMap>Format"`
+	MapURL    struct {
+		Href string `xml:"http://www.w3.org/1999/xlink href,attr"`
+	} `xml:"Capability>Request>GetMap>DCPType>HTTP>Get>OnlineResource"`
+	Layer layerCaps `xml:"Capability>Layer"`
+}
+
+func TestCapabilities(t *testing.T) {
+	srv := httptest.NewServer(http.StripPrefix("/wms", newTestService(t)))
+	defer srv.Close()
+
+	resp, body := get(t, srv.URL+"/wms?SERVICE=WMS&REQUEST=GetCapabilities")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/xml; charset=utf-8", resp.Header.Get("Content-Type"))
+	var caps capabilities
+	assert.Nil(t, xml.Unmarshal(body, &caps))
+	assert.Equal(t, xml.Name{Space: WMS_NAMESPACE, Local: "WMS_Capabilities"}, caps.XMLName)
+	assert.Equal(t, "1.3.0", caps.Version)
+	assert.Equal(t, "test map", caps.Title)
+	assert.Equal(t, []string{"image/png", "image/jpeg"}, caps.MapFormat)
+	assert.Equal(t, srv.URL+"/wms?", caps.MapURL.Href)
+	assert.Equal(t, []string{"EPSG:4326", "EPSG:3857", "CRS:84"}, caps.Layer.CRS)
+	assert.Len(t, caps.Layer.Layers, 2)
+	blocks := caps.Layer.Layers[1]
+	assert.Equal(t, 1, blocks.Queryable)
+	assert.Equal(t, 0, caps.Layer.Layers[0].Queryable)
+	assert.Equal(t, "Blocks", blocks.Title)
+	assert.Equal(t, 0.0, blocks.West)
+	assert.Equal(t, 50.0, blocks.North)
+	if assert.Len(t, blocks.BBoxes, 2) {
+		// latitude first for EPSG:4326
+		assert.Equal(t, "EPSG:4326", blocks.BBoxes[0].CRS)
+		assert.Equal(t, 40.0, blocks.BBoxes[0].MinX)
+		assert.Equal(t, 0.0, blocks.BBoxes[0].MinY)
+		assert.Equal(t, "EPSG:3857", blocks.BBoxes[1].CRS)
+		assert.InDelta(t, 4865942.28, blocks.BBoxes[1].MinY, 0.01)
+	}
+
+	resp, body = get(t, srv.URL+"/wms?SERVICE=WMS&REQUEST=GetCapabilities&VERSION=1.1.1")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/vnd.ogc.wms_xml; charset=utf-8", resp.Header.Get("Content-Type"))
+	caps = capabilities{}
+	assert.Nil(t, xml.Unmarshal(body, &caps))
+	assert.Equal(t, xml.Name{Local: "WMT_MS_Capabilities"}, caps.XMLName)
+	assert.Equal(t, "1.1.1", caps.Version)
+	assert.Equal(t, []string{"EPSG:4326", "EPSG:3857"}, caps.Layer.SRS)
+	blocks = caps.Layer.Layers[1]
+	assert.Equal(t, 0.0, blocks.LatLon.MinX)
+	assert.Equal(t, 50.0, blocks.LatLon.MaxY)
+	assert.Equal(t, "EPSG:4326", blocks.BBoxes[0].SRS)
+	assert.Equal(t, 0.0, blocks.BBoxes[0].MinX)
+}
+
+func TestGetMap(t *testing.T) {
+	srv := httptest.NewServer(newTestService(t))
+	defer srv.Close()
+	base := srv.URL + "/?SERVICE=WMS&REQUEST=GetMap&STYLES=&FORMAT=image/png&WIDTH=20&HEIGHT=20"
+
+	// the square covers the left half of the image in every axis order
+	for _, q := range []string{
+		"&VERSION=1.1.1&SRS=EPSG:4326&BBOX=0,40,20,50",
+		"&VERSION=1.3.0&CRS=EPSG:4326&BBOX=40,0,50,20",
+		"&VERSION=1.3.0&CRS=CRS:84&BBOX=0,40,20,50",
+	} {
+		img := getImage(t, base+"&LAYERS=blocks"+q)
+		assert.Equal(t, image.Rect(0, 0, 20, 20), img.Bounds(), q)
+		assert.Equal(t, green, at(img, 5, 10), q)
+		assert.Equal(t, white, at(img, 15, 10), q)
+	}
+
+	// transparent background
+	img := getImage(t, base+"&LAYERS=blocks&VERSION=1.3.0&CRS=CRS:84&BBOX=0,40,20,50&TRANSPARENT=TRUE")
+	assert.Equal(t, uint8(0), at(img, 15, 10).A)
+	assert.Equal(t, green, at(img, 5, 10))
+
+	// raster tiles in web mercator, reprojected to 4326
+	img = getImage(t, base+"&LAYERS=base,blocks&VERSION=1.1.1&SRS=EPSG:3857&BBOX=-20037508.34,-20037508.34,20037508.34,20037508.34")
+	assert.Equal(t, red, at(img, 2, 2))
+	img = getImage(t, base+"&LAYERS=base,blocks&VERSION=1.1.1&SRS=EPSG:4326&BBOX=0,40,20,50&BGCOLOR=0x0000FF")
+	assert.Equal(t, green, at(img, 5, 10))
+	assert.Equal(t, red, at(img, 15, 10))
+	// beyond the mercator latitude limit the background shows
+	img = getImage(t, base+"&LAYERS=base&VERSION=1.1.1&SRS=EPSG:4326&BBOX=0,80,20,90&BGCOLOR=0x0000FF")
+	assert.Equal(t, color.NRGBA{0, 0, 0xff, 0xff}, at(img, 10, 1))
+	assert.Equal(t, red, at(img, 10, 18))
+
+	resp, body := get(t, strings.Replace(base, "image/png", "image/jpeg", 1)+"&LAYERS=blocks&VERSION=1.3.0&CRS=CRS:84&BBOX=0,40,20,50")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+	_, format, err := image.Decode(bytes.NewReader(body))
+	assert.Nil(t, err)
+	assert.Equal(t, "jpeg", format)
+}
+
+func TestGetFeatureInfo(t *testing.T) {
+	srv := httptest.NewServer(newTestService(t))
+	defer srv.Close()
+	base := srv.URL + "/?SERVICE=WMS&REQUEST=GetFeatureInfo&LAYERS=blocks&QUERY_LAYERS=blocks&STYLES=&WIDTH=20&HEIGHT=20"
+
+	resp, body := get(t, base+"&VERSION=1.3.0&CRS=EPSG:4326&BBOX=40,0,50,20&INFO_FORMAT=application/json&I=5&J=10")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var fc geojson.FeatureCollection
+	assert.Nil(t, json.Unmarshal(body, &fc))
+	if assert.Len(t, fc.Features, 1) {
+		assert.Equal(t, "block-1", fc.Features[0].ID)
+	}
+
+	// within three pixels of the edge
+	_, body = get(t, base+"&VERSION=1.1.1&SRS=EPSG:4326&BBOX=0,40,20,50&INFO_FORMAT=application/json&X=12&Y=10")
+	assert.Nil(t, json.Unmarshal(body, &fc))
+	assert.Len(t, fc.Features, 1)
+	_, body = get(t, base+"&VERSION=1.1.1&SRS=EPSG:4326&BBOX=0,40,20,50&INFO_FORMAT=application/json&X=15&Y=10")
+	assert.Nil(t, json.Unmarshal(body, &fc))
+	assert.Empty(t, fc.Features)
+
+	resp, body = get(t, base+"&VERSION=1.3.0&CRS=CRS:84&BBOX=0,40,20,50&INFO_FORMAT=text/plain&I=5&J=10")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Feature 0 (id block-1):\n  name = square\n", string(body))
+}
+
+func TestExceptions(t *testing.T) {
+	srv := httptest.NewServer(newTestService(t))
+	defer srv.Close()
+	getMap := "?SERVICE=WMS&REQUEST=GetMap&WIDTH=20&HEIGHT=20"
+
+	tests := []struct {
+		query, code, locator string
+		status               int
+	}{
+		{getMap + "&VERSION=1.3.0&LAYERS=roads&CRS=CRS:84&FORMAT=image/png&BBOX=0,40,20,50", LAYER_NOT_DEFINED, "LAYERS", 400},
+		{getMap + "&VERSION=1.3.0&LAYERS=blocks&CRS=EPSG:9999&FORMAT=image/png&BBOX=0,40,20,50", INVALID_CRS, "CRS", 400},
+		{getMap + "&VERSION=1.1.1&LAYERS=blocks&SRS=EPSG:9999&FORMAT=image/png&BBOX=0,40,20,50", INVALID_SRS, "SRS", 400},
+		{getMap + "&VERSION=1.3.0&LAYERS=blocks&CRS=CRS:84&FORMAT=image/gif&BBOX=0,40,20,50", INVALID_FORMAT, "FORMAT", 400},
+		{getMap + "&VERSION=1.3.0&LAYERS=blocks&CRS=CRS:84&FORMAT=image/png&BBOX=0,40,20,50&STYLES=fancy", STYLE_NOT_DEFINED, "STYLES", 400},
+		{getMap + "&VERSION=1.3.0&LAYERS=blocks&CRS=CRS:84&BBOX=0,40,20,50", "MissingParameterValue", "FORMAT", 400},
+		// latitude first, so the minimum is above the maximum
+		{getMap + "&VERSION=1.3.0&LAYERS=blocks&CRS=EPSG:4326&FORMAT=image/png&BBOX=0,40,20,30", "InvalidParameterValue", "BBOX", 400},
+		{"?SERVICE=WMS&VERSION=1.3.0&REQUEST=GetFeatureInfo&LAYERS=base&QUERY_LAYERS=base&WIDTH=20&HEIGHT=20&BBOX=0,40,20,50&CRS=CRS:84&INFO_FORMAT=text/plain&I=1&J=1", LAYER_NOT_QUERYABLE, "QUERY_LAYERS", 400},
+		{"?SERVICE=WMS&VERSION=1.3.0&REQUEST=GetFeatureInfo&LAYERS=blocks&QUERY_LAYERS=blocks&WIDTH=20&HEIGHT=20&BBOX=0,40,20,50&CRS=CRS:84&INFO_FORMAT=text/plain&I=30&J=1", INVALID_POINT, "I", 400},
+		{"?SERVICE=WMS&VERSION=1.3.0&REQUEST=GetLegendGraphic", "OperationNotSupported", "REQUEST", 501},
+	}
+	for _, tt := range tests {
+		resp, body := get(t, srv.URL+"/"+tt.query)
+		assert.Equal(t, tt.status, resp.StatusCode, tt.query)
+		var rep struct {
+			XMLName    xml.Name
+			Exceptions []struct {
+				Code    string `xml:"code,attr"`
+				Locator string `xml:"locator,attr"`
+			} `xml:"ServiceException"`
+		}
+		assert.Nil(t, xml.Unmarshal(body, &rep), tt.query)
+		if assert.Len(t, rep.Exceptions, 1, tt.query) {
+			assert.Equal(t, tt.code, rep.Exceptions[0].Code, tt.query)
+			assert.Equal(t, tt.locator, rep.Exceptions[0].Locator, tt.query)
+		}
+		if strings.Contains(tt.query, "1.1.1") {
+			assert.Equal(t, "application/vnd.ogc.se_xml; charset=utf-8", resp.Header.Get("Content-Type"))
+			assert.Equal(t, "", rep.XMLName.Space)
+		} else {
+			assert.Equal(t, OGC_NAMESPACE, rep.XMLName.Space)
+		}
+	}
+}
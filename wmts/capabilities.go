@@ -0,0 +1,217 @@
+package wmts
+
+import (
+	"encoding/xml"
+	"math"
+	"strconv"
+
+	"pinkey.ltd/xr/ows"
+	"pinkey.ltd/xr/proj"
+)
+
+const WMTS_NAMESPACE = "http://www.opengis.net/wmts/1.0"
+
+// Capabilities is the WMTS 1.0.0 service metadata document.
+type Capabilities struct {
+	XMLName xml.Name `xml:"Capabilities"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	ows.Namespaces
+	Version               string                     `xml:"version,attr"`
+	ServiceIdentification *ows.ServiceIdentification `xml:"ows:ServiceIdentification"`
+	OperationsMetadata    *ows.OperationsMetadata    `xml:"ows:OperationsMetadata"`
+	Contents              Contents                   `xml:"Contents"`
+	ServiceMetadataURL    *ows.Link                  `xml:"ServiceMetadataURL,omitempty"`
+}
+
+type Contents struct {
+	Layers         []*LayerInfo         `xml:"Layer"`
+	TileMatrixSets []*TileMatrixSetInfo `xml:"TileMatrixSet"`
+}
+
+type LayerInfo struct {
+	Title              string              `xml:"ows:Title"`
+	Abstract           string              `xml:"ows:Abstract,omitempty"`
+	WGS84BoundingBox   *ows.BoundingBox    `xml:"ows:WGS84BoundingBox"`
+	Identifier         string              `xml:"ows:Identifier"`
+	Styles             []Style             `xml:"Style"`
+	Formats            []string            `xml:"Format"`
+	InfoFormats        []string            `xml:"InfoFormat,omitempty"`
+	TileMatrixSetLinks []TileMatrixSetLink `xml:"TileMatrixSetLink"`
+	ResourceURLs       []ResourceURL       `xml:"ResourceURL"`
+}
+
+type Style struct {
+	IsDefault  bool   `xml:"isDefault,attr"`
+	Identifier string `xml:"ows:Identifier"`
+}
+
+type TileMatrixSetLink struct {
+	TileMatrixSet string             `xml:"TileMatrixSet"`
+	Limits        []TileMatrixLimits `xml:"TileMatrixSetLimits>TileMatrixLimits,omitempty"`
+}
+
+type TileMatrixLimits struct {
+	TileMatrix string `xml:"TileMatrix"`
+	MinTileRow int    `xml:"MinTileRow"`
+	MaxTileRow int    `xml:"MaxTileRow"`
+	MinTileCol int    `xml:"MinTileCol"`
+	MaxTileCol int    `xml:"MaxTileCol"`
+}
+
+type ResourceURL struct {
+	Format       string `xml:"format,attr"`
+	ResourceType string `xml:"resourceType,attr"`
+	Template     string `xml:"template,attr"`
+}
+
+type TileMatrixSetInfo struct {
+	Identifier        string            `xml:"ows:Identifier"`
+	SupportedCRS      string            `xml:"ows:SupportedCRS"`
+	WellKnownScaleSet string            `xml:"WellKnownScaleSet,omitempty"`
+	TileMatrices      []*TileMatrixInfo `xml:"TileMatrix"`
+}
+
+type TileMatrixInfo struct {
+	Identifier       string  `xml:"ows:Identifier"`
+	ScaleDenominator float64 `xml:"ScaleDenominator"`
+	TopLeftCorner    string  `xml:"TopLeftCorner"`
+	TileWidth        int     `xml:"TileWidth"`
+	TileHeight       int     `xml:"TileHeight"`
+	MatrixWidth      int     `xml:"MatrixWidth"`
+	MatrixHeight     int     `xml:"MatrixHeight"`
+}
+
+// PIXEL_SIZE is the standardized rendering pixel size of 0.28 mm.
+const PIXEL_SIZE = 0.00028
+
+// crsURN returns the OGC URN of an EPSG code.
+func crsURN(code int) string {
+	return "urn:ogc:def:crs:EPSG::" + strconv.Itoa(code)
+}
+
+// isGeographic reports whether an EPSG CRS has degree units, which WMTS
+// lists in latitude, longitude order.
+func isGeographic(code int) bool {
+	crs, err := proj.FromEPSG(code)
+	return err == nil && crs.IsGeographic()
+}
+
+// metersPerUnit converts grid units to meters for scale denominators.
+func metersPerUnit(code int) float64 {
+	if isGeographic(code) {
+		return 2 * math.Pi * proj.WGS84.Ellipsoid.A / 360
+	}
+	return 1
+}
+
+func (s *TileMatrixSet) info() *TileMatrixSetInfo {
+	g := s.Grid
+	info := &TileMatrixSetInfo{
+		Identifier:        s.Identifier,
+		SupportedCRS:      crsURN(g.EPSG),
+		WellKnownScaleSet: s.WellKnownScaleSet,
+	}
+	corner := ows.FormatFloats(g.Extent.Min[0], g.Extent.Max[1])
+	if isGeographic(g.EPSG) {
+		corner = ows.FormatFloats(g.Extent.Max[1], g.Extent.Min[0])
+	}
+	mpu := metersPerUnit(g.EPSG)
+	for z := 0; z <= s.MaxZoom; z++ {
+		w, h := g.MatrixSize(z)
+		info.TileMatrices = append(info.TileMatrices, &TileMatrixInfo{
+			Identifier:       strconv.Itoa(z),
+			ScaleDenominator: g.Resolution(z) * mpu / PIXEL_SIZE,
+			TopLeftCorner:    corner,
+			TileWidth:        g.TileSize,
+			TileHeight:       g.TileSize,
+			MatrixWidth:      w,
+			MatrixHeight:     h,
+		})
+	}
+	return info
+}
+
+// limits returns the tile ranges of the layer bounds for every zoom level.
+func (l *Layer) limits() []TileMatrixLimits {
+	info := l.Source.Info()
+	g := info.Grid
+	minX, minY, err1 := g.LonLat(info.Bounds.Min[0], info.Bounds.Min[1])
+	maxX, maxY, err2 := g.LonLat(info.Bounds.Max[0], info.Bounds.Max[1])
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	var ls []TileMatrixLimits
+	for z := info.MinZoom; z <= info.MaxZoom; z++ {
+		lo := g.TileAt(minX, maxY, z)
+		hi := g.TileAt(maxX, minY, z)
+		ls = append(ls, TileMatrixLimits{
+			TileMatrix: strconv.Itoa(z),
+			MinTileRow: lo.Y, MaxTileRow: hi.Y,
+			MinTileCol: lo.X, MaxTileCol: hi.X,
+		})
+	}
+	return ls
+}
+
+// Capabilities builds the service metadata for clients reaching the
+// service at baseURL.
+func (s *Service) Capabilities(baseURL string) *Capabilities {
+	kvp := baseURL + "?"
+	caps := &Capabilities{
+		Xmlns:      WMTS_NAMESPACE,
+		Namespaces: ows.NewNamespaces(),
+		Version:    VERSION,
+		ServiceIdentification: &ows.ServiceIdentification{
+			Title:              s.Title,
+			Abstract:           s.Abstract,
+			ServiceType:        "OGC WMTS",
+			ServiceTypeVersion: []string{VERSION},
+		},
+		OperationsMetadata: &ows.OperationsMetadata{Operations: []ows.Operation{
+			ows.NewGetOperation("GetCapabilities", kvp, "KVP", "RESTful"),
+			ows.NewGetOperation("GetTile", kvp, "KVP", "RESTful"),
+			ows.NewGetOperation("GetFeatureInfo", kvp, "KVP", "RESTful"),
+		}},
+		ServiceMetadataURL: &ows.Link{Href: baseURL + "/" + VERSION + "/WMTSCapabilities.xml"},
+	}
+
+	sets := map[string]*TileMatrixSet{}
+	var order []string
+	for _, l := range s.Layers {
+		info := l.Source.Info()
+		tms := l.tileMatrixSet()
+		if _, ok := sets[tms.Identifier]; !ok {
+			sets[tms.Identifier] = &TileMatrixSet{Identifier: tms.Identifier, Grid: tms.Grid, WellKnownScaleSet: tms.WellKnownScaleSet}
+			order = append(order, tms.Identifier)
+		}
+		set := sets[tms.Identifier]
+		set.MaxZoom = max(set.MaxZoom, tms.MaxZoom)
+
+		format := info.Format.ContentType()
+		li := &LayerInfo{
+			Title:              l.Title,
+			Abstract:           l.Abstract,
+			WGS84BoundingBox:   ows.NewBoundingBox("", info.Bounds.Min[0], info.Bounds.Min[1], info.Bounds.Max[0], info.Bounds.Max[1]),
+			Identifier:         l.Identifier,
+			Styles:             []Style{{IsDefault: true, Identifier: DEFAULT_STYLE}},
+			Formats:            []string{format},
+			TileMatrixSetLinks: []TileMatrixSetLink{{TileMatrixSet: tms.Identifier, Limits: l.limits()}},
+		}
+		if li.Title == "" {
+			li.Title = l.Identifier
+		}
+		prefix := baseURL + "/" + VERSION + "/" + l.Identifier + "/{Style}/{TileMatrixSet}/{TileMatrix}/{TileRow}/{TileCol}"
+		li.ResourceURLs = append(li.ResourceURLs, ResourceURL{Format: format, ResourceType: "tile", Template: prefix + "." + string(info.Format)})
+		if l.Features != nil {
+			li.InfoFormats = infoFormats
+			for _, f := range infoFormats {
+				li.ResourceURLs = append(li.ResourceURLs, ResourceURL{Format: f, ResourceType: "FeatureInfo", Template: prefix + "/{J}/{I}." + infoExtensions[f]})
+			}
+		}
+		caps.Contents.Layers = append(caps.Contents.Layers, li)
+	}
+	for _, id := range order {
+		caps.Contents.TileMatrixSets = append(caps.Contents.TileMatrixSets, sets[id].info())
+	}
+	return caps
+}
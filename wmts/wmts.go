@@ -0,0 +1,331 @@
+// Package wmts implements an OGC WMTS 1.0.0 server on top of tile sources.
+//
+// The service answers KVP requests at its base URL and RESTful requests
+// below /1.0.0/. Tile matrices are identified by their zoom level.
+package wmts
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec2"
+	"pinkey.ltd/xr/ows"
+	"pinkey.ltd/xr/tiles"
+)
+
+const (
+	VERSION       = "1.0.0"
+	DEFAULT_STYLE = "default"
+
+	// TILE_OUT_OF_RANGE is the WMTS exception code for rows, columns or
+	// matrices outside the tile matrix set.
+	TILE_OUT_OF_RANGE = "TileOutOfRange"
+)
+
+// FEATURE_INFO_RADIUS is the GetFeatureInfo search radius in pixels.
+const FEATURE_INFO_RADIUS = 3
+
+var (
+	infoFormats    = []string{"application/json", "text/plain"}
+	infoExtensions = map[string]string{"application/json": "json", "text/plain": "txt"}
+)
+
+// TileMatrixSet names a tile grid. Its matrices are the zoom levels 0 to
+// MaxZoom.
+type TileMatrixSet struct {
+	Identifier        string
+	Grid              *tiles.Grid
+	MaxZoom           int
+	WellKnownScaleSet string
+}
+
+// NewTileMatrixSet creates a set for the grid, named after the grid.
+func NewTileMatrixSet(g *tiles.Grid, maxZoom int) *TileMatrixSet {
+	s := &TileMatrixSet{Identifier: g.Name, Grid: g, MaxZoom: maxZoom}
+	if g == tiles.WebMercator {
+		s.WellKnownScaleSet = "urn:ogc:def:wkss:OGC:1.0:GoogleMapsCompatible"
+	}
+	return s
+}
+
+// Layer publishes a tile source.
+type Layer struct {
+	Identifier string
+	Title      string
+	Abstract   string
+	Source     tiles.TileSource
+	// Features answers GetFeatureInfo, positions are WGS84 longitude and
+	// latitude. The operation is not offered when nil.
+	Features *geojson.FeatureCollection
+}
+
+func (l *Layer) tileMatrixSet() *TileMatrixSet {
+	info := l.Source.Info()
+	return NewTileMatrixSet(info.Grid, info.MaxZoom)
+}
+
+// Service is a WMTS server.
+type Service struct {
+	Title    string
+	Abstract string
+	Layers   []*Layer
+	// BaseURL is the public URL of the service used in capabilities,
+	// derived from each request when empty.
+	BaseURL      string
+	CacheControl string
+}
+
+func NewService(title string, layers ...*Layer) *Service {
+	return &Service{Title: title, Layers: layers, CacheControl: "public, max-age=3600"}
+}
+
+func (s *Service) layer(id string) (*Layer, error) {
+	for _, l := range s.Layers {
+		if l.Identifier == id {
+			return l, nil
+		}
+	}
+	return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "LAYER", "unknown layer %q", id)
+}
+
+// request is a GetTile or GetFeatureInfo request after decoding either
+// encoding.
+type request struct {
+	layer      *Layer
+	tile       tiles.Tile
+	format     string
+	infoFormat string
+	i, j       int
+}
+
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		ows.WriteError(w, ows.NewError(ows.OPERATION_NOT_SUPPORTED, "", "method %s is not supported", r.Method), VERSION)
+		return
+	}
+	base := s.BaseURL
+	if base == "" {
+		base = ows.BaseURL(r)
+	}
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" {
+		s.serveKVP(w, r, base)
+		return
+	}
+	if err := s.serveREST(w, r, base, path); err != nil {
+		ows.WriteError(w, err, VERSION)
+	}
+}
+
+func (s *Service) serveKVP(w http.ResponseWriter, r *http.Request, base string) {
+	p := ows.ParseParams(r.URL.Query())
+	if svc := p.Get("SERVICE"); !strings.EqualFold(svc, "WMTS") {
+		ows.WriteError(w, ows.NewError(ows.INVALID_PARAMETER_VALUE, "SERVICE", "service must be WMTS, got %q", svc), VERSION)
+		return
+	}
+	op, err := p.Require("REQUEST")
+	if err != nil {
+		ows.WriteError(w, err, VERSION)
+		return
+	}
+	if strings.EqualFold(op, "GetCapabilities") {
+		ows.WriteXML(w, http.StatusOK, s.Capabilities(base))
+		return
+	}
+	if v := p.Get("VERSION"); v != "" && v != VERSION {
+		ows.WriteError(w, ows.NewError(ows.INVALID_PARAMETER_VALUE, "VERSION", "unsupported version %q", v), VERSION)
+		return
+	}
+	switch {
+	case strings.EqualFold(op, "GetTile"):
+		req, err := s.parseKVP(p, false)
+		if err == nil {
+			err = s.getTile(w, r, req)
+		}
+		if err != nil {
+			ows.WriteError(w, err, VERSION)
+		}
+	case strings.EqualFold(op, "GetFeatureInfo"):
+		req, err := s.parseKVP(p, true)
+		if err == nil {
+			err = s.getFeatureInfo(w, req)
+		}
+		if err != nil {
+			ows.WriteError(w, err, VERSION)
+		}
+	default:
+		ows.WriteError(w, ows.NewError(ows.OPERATION_NOT_SUPPORTED, "REQUEST", "unsupported request %q", op), VERSION)
+	}
+}
+
+func (s *Service) parseKVP(p ows.Params, info bool) (*request, error) {
+	for _, name := range []string{"LAYER", "STYLE", "FORMAT", "TILEMATRIXSET", "TILEMATRIX", "TILEROW", "TILECOL"} {
+		if _, err := p.Require(name); err != nil {
+			return nil, err
+		}
+	}
+	req, err := s.resolve(p.Get("LAYER"), p.Get("STYLE"), p.Get("TILEMATRIXSET"), p.Get("TILEMATRIX"), p.Get("TILEROW"), p.Get("TILECOL"))
+	if err != nil {
+		return nil, err
+	}
+	req.format = p.Get("FORMAT")
+	if info {
+		if req.infoFormat, err = p.Require("INFOFORMAT"); err != nil {
+			return nil, err
+		}
+		if req.i, err = requireInt(p, "I"); err != nil {
+			return nil, err
+		}
+		if req.j, err = requireInt(p, "J"); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+func requireInt(p ows.Params, name string) (int, error) {
+	if _, err := p.Require(name); err != nil {
+		return 0, err
+	}
+	return p.Int(name, 0)
+}
+
+// serveREST handles the resource paths listed in the capabilities:
+//
+//	1.0.0/WMTSCapabilities.xml
+//	1.0.0/{layer}/{style}/{set}/{matrix}/{row}/{col}.{ext}
+//	1.0.0/{layer}/{style}/{set}/{matrix}/{row}/{col}/{j}/{i}.{ext}
+func (s *Service) serveREST(w http.ResponseWriter, r *http.Request, base, path string) error {
+	parts := strings.Split(path, "/")
+	if parts[0] != VERSION {
+		return ows.NewError(ows.INVALID_PARAMETER_VALUE, "VERSION", "unsupported version %q", parts[0])
+	}
+	parts = parts[1:]
+	if len(parts) == 1 && parts[0] == "WMTSCapabilities.xml" {
+		ows.WriteXML(w, http.StatusOK, s.Capabilities(base))
+		return nil
+	}
+	if len(parts) != 6 && len(parts) != 8 {
+		return ows.NewError(ows.OPERATION_NOT_SUPPORTED, "", "unknown resource %q", path)
+	}
+	last := parts[len(parts)-1]
+	dot := strings.LastIndexByte(last, '.')
+	if dot < 0 {
+		return ows.NewError(ows.INVALID_PARAMETER_VALUE, "FORMAT", "missing format extension in %q", path)
+	}
+	parts[len(parts)-1], last = last[:dot], last[dot+1:]
+
+	req, err := s.resolve(parts[0], parts[1], parts[2], parts[3], parts[4], parts[5])
+	if err != nil {
+		return err
+	}
+	if len(parts) == 6 {
+		f, err := tiles.ParseFormat(last)
+		if err != nil {
+			return ows.NewError(ows.INVALID_PARAMETER_VALUE, "FORMAT", "unsupported format %q", last)
+		}
+		req.format = f.ContentType()
+		return s.getTile(w, r, req)
+	}
+	for f, ext := range infoExtensions {
+		if ext == last {
+			req.infoFormat = f
+		}
+	}
+	if req.j, err = strconv.Atoi(parts[6]); err != nil {
+		return ows.NewError(ows.INVALID_PARAMETER_VALUE, "J", "J is not an integer: %q", parts[6])
+	}
+	if req.i, err = strconv.Atoi(parts[7]); err != nil {
+		return ows.NewError(ows.INVALID_PARAMETER_VALUE, "I", "I is not an integer: %q", parts[7])
+	}
+	return s.getFeatureInfo(w, req)
+}
+
+// resolve checks the tile address shared by GetTile and GetFeatureInfo.
+func (s *Service) resolve(layer, style, set, matrix, row, col string) (*request, error) {
+	l, err := s.layer(layer)
+	if err != nil {
+		return nil, err
+	}
+	if style != DEFAULT_STYLE && style != "" {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "STYLE", "unknown style %q", style)
+	}
+	tms := l.tileMatrixSet()
+	if set != tms.Identifier {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "TILEMATRIXSET", "layer %s is not available in %q", layer, set)
+	}
+	// the layer limits leave out the matrices above and below its zooms
+	z, err := strconv.Atoi(matrix)
+	if err != nil || z < max(0, l.Source.Info().MinZoom) || z > tms.MaxZoom {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "TILEMATRIX", "unknown tile matrix %q", matrix)
+	}
+	y, err := strconv.Atoi(row)
+	if err != nil {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "TILEROW", "TILEROW is not an integer: %q", row)
+	}
+	x, err := strconv.Atoi(col)
+	if err != nil {
+		return nil, ows.NewError(ows.INVALID_PARAMETER_VALUE, "TILECOL", "TILECOL is not an integer: %q", col)
+	}
+	t := tiles.Tile{Z: z, X: x, Y: y}
+	if w, h := tms.Grid.MatrixSize(z); y < 0 || y >= h {
+		return nil, ows.NewError(TILE_OUT_OF_RANGE, "TILEROW", "row %d is outside 0..%d", y, h-1)
+	} else if x < 0 || x >= w {
+		return nil, ows.NewError(TILE_OUT_OF_RANGE, "TILECOL", "column %d is outside 0..%d", x, w-1)
+	}
+	return &request{layer: l, tile: t}, nil
+}
+
+func (s *Service) getTile(w http.ResponseWriter, r *http.Request, req *request) error {
+	l := req.layer
+	if ct := l.Source.Info().Format.ContentType(); req.format != ct {
+		return ows.NewError(ows.INVALID_PARAMETER_VALUE, "FORMAT", "layer %s is only available as %s", l.Identifier, ct)
+	}
+	h := &tiles.Handler{Source: l.Source, CacheControl: s.CacheControl}
+	h.ServeTile(w, r, req.tile)
+	return nil
+}
+
+func (s *Service) getFeatureInfo(w http.ResponseWriter, req *request) error {
+	l := req.layer
+	if l.Features == nil {
+		return ows.NewError(ows.OPERATION_NOT_SUPPORTED, "REQUEST", "layer %s is not queryable", l.Identifier)
+	}
+	if _, ok := infoExtensions[req.infoFormat]; !ok {
+		return ows.NewError(ows.INVALID_PARAMETER_VALUE, "INFOFORMAT", "unsupported info format %q", req.infoFormat)
+	}
+	g := l.Source.Info().Grid
+	if req.i < 0 || req.j < 0 || req.i >= g.TileSize || req.j >= g.TileSize {
+		return ows.NewError(ows.INVALID_PARAMETER_VALUE, "I", "pixel %d,%d is outside the tile", req.i, req.j)
+	}
+
+	// pixel centre and search radius in WGS84
+	b := g.TileBounds(req.tile)
+	res := g.Resolution(req.tile.Z)
+	x := b.Min[0] + (float64(req.i)+0.5)*res
+	y := b.Max[1] - (float64(req.j)+0.5)*res
+	lon, lat, err := g.ToLonLat(x, y)
+	if err != nil {
+		return err
+	}
+	lon2, lat2, err := g.ToLonLat(x+FEATURE_INFO_RADIUS*res, y)
+	if err != nil {
+		return err
+	}
+	radius := vec2.Vec[float64]{lon2 - lon, lat2 - lat}
+	tol := radius.Length()
+
+	hits := geojson.NewFeatureCollection()
+	p := vec2.Vec[float64]{lon, lat}
+	for _, f := range l.Features.Features {
+		if f.Geometry != nil && f.Geometry.Distance(p) <= tol {
+			hits.Append(f)
+		}
+	}
+
+	return ows.WriteFeatureInfo(w, hits, req.infoFormat)
+}
@@ -0,0 +1,282 @@
+package wmts
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pinkey.ltd/xr/geojson"
+	"pinkey.ltd/xr/go3d/vec3"
+	"pinkey.ltd/xr/ows"
+	"pinkey.ltd/xr/tiles"
+)
+
+func newTestService(t *testing.T) *Service {
+	root := t.TempDir()
+	for _, p := range []string{"0/0/0.png", "2/1/1.png", "2/3/2.png"} {
+		path := filepath.Join(root, p)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.Nil(t, os.WriteFile(path, []byte("png:"+p), 0o644))
+	}
+	src, err := tiles.NewDirSource(root, tiles.PNG)
+	assert.Nil(t, err)
+
+	// a point at the centre of pixel 10, 20 of tile 2/1/1
+	g := tiles.WebMercator
+	b := g.TileBounds(tiles.Tile{Z: 2, X: 1, Y: 1})
+	res := g.Resolution(2)
+	lon, lat, err := g.ToLonLat(b.Min[0]+10.5*res, b.Max[1]-20.5*res)
+	assert.Nil(t, err)
+	f := geojson.NewFeature(geojson.NewPointGeometry(vec3.Vec[float64]{lon, lat, 0}))
+	f.ID = "pole-7"
+	f.Properties["height"] = 12.5
+	fc := geojson.NewFeatureCollection()
+	fc.Append(f)
+
+	return NewService("test tiles",
+		&Layer{Identifier: "base", Title: "Base map", Source: src, Features: fc},
+		&Layer{Identifier: "geo", Source: &geodeticSource{}},
+	)
+}
+
+// geodeticSource has a tile for every address of the WGS84 grid.
+type geodeticSource struct{}
+
+func (s *geodeticSource) Info() *tiles.Info {
+	return &tiles.Info{Name: "geo", Format: tiles.JPEG, Grid: tiles.Geodetic, MaxZoom: 3, Bounds: tiles.Geodetic.Extent}
+}
+
+func (s *geodeticSource) Tile(ctx context.Context, t tiles.Tile) (*tiles.TileData, error) {
+	return &tiles.TileData{Data: []byte("jpg:" + t.String())}, nil
+}
+
+// shallowSource has the geodetic tiles from zoom 2 on.
+type shallowSource struct{ geodeticSource }
+
+func (s *shallowSource) Info() *tiles.Info {
+	info := s.geodeticSource.Info()
+	info.MinZoom = 2
+	return info
+}
+
+// capabilities mirrors the parts of the document checked by the tests with
+// namespace qualified names.
+type capabilities struct {
+	XMLName  xml.Name `xml:"http://www.opengis.net/wmts/1.0 Capabilities"`
+	Version  string   `xml:"version,attr"`
+	Title    string   `xml:"http://www.opengis.net/ows/1.1 ServiceIdentification>Title"`
+	Metadata struct {
+		Href string `xml:"http://www.w3.org/1999/xlink href,attr"`
+	} `xml:"http://www.opengis.net/wmts/1.0 ServiceMetadataURL"`
+	Operations []struct {
+		Name string `xml:"name,attr"`
+		Get  struct {
+			Href string `xml:"http://www.w3.org/1999/xlink href,attr"`
+		} `xml:"http://www.opengis.net/ows/1.1 DCP>HTTP>Get"`
+	} `xml:"http://www.opengis.net/ows/1.1 OperationsMetadata>Operation"`
+	Layers []struct {
+		Identifier  string   `xml:"http://www.opengis.net/ows/1.1 Identifier"`
+		Lower       string   `xml:"http://www.opengis.net/ows/1.1 WGS84BoundingBox>LowerCorner"`
+		Formats     []string `xml:"Format"`
+		InfoFormats []string `xml:"InfoFormat"`
+		Link        string   `xml:"TileMatrixSetLink>TileMatrixSet"`
+		Limits      []struct {
+			TileMatrix string
+			MaxTileCol int
+		} `xml:"TileMatrixSetLink>TileMatrixSetLimits>TileMatrixLimits"`
+		Resources []struct {
+			Format       string `xml:"format,attr"`
+			ResourceType string `xml:"resourceType,attr"`
+			Template     string `xml:"template,attr"`
+		} `xml:"ResourceURL"`
+	} `xml:"Contents>Layer"`
+	Sets []struct {
+		Identifier string `xml:"http://www.opengis.net/ows/1.1 Identifier"`
+		CRS        string `xml:"http://www.opengis.net/ows/1.1 SupportedCRS"`
+		ScaleSet   string `xml:"WellKnownScaleSet"`
+		Matrices   []struct {
+			Identifier       string `xml:"http://www.opengis.net/ows/1.1 Identifier"`
+			ScaleDenominator float64
+			TopLeftCorner    string
+			MatrixWidth      int
+			MatrixHeight     int
+		} `xml:"TileMatrix"`
+	} `xml:"Contents>TileMatrixSet"`
+}
+
+func get(t *testing.T, url string) (*http.Response, []byte) {
+	resp, err := http.Get(url)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return resp, body
+}
+
+func TestCapabilities(t *testing.T) {
+	srv := httptest.NewServer(http.StripPrefix("/wmts", newTestService(t)))
+	defer srv.Close()
+
+	resp, body := get(t, srv.URL+"/wmts?service=WMTS&request=GetCapabilities")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(string(body), xml.Header))
+
+	// every element must resolve to a declared namespace
+	known := map[string]bool{WMTS_NAMESPACE: true, ows.OWS_NAMESPACE: true}
+	dec := xml.NewDecoder(strings.NewReader(string(body)))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		if se, ok := tok.(xml.StartElement); ok {
+			assert.True(t, known[se.Name.Space], se.Name.Space+" "+se.Name.Local)
+			for _, a := range se.Attr {
+				assert.NotEqual(t, "xlink", a.Name.Space)
+			}
+		}
+	}
+
+	var caps capabilities
+	assert.Nil(t, xml.Unmarshal(body, &caps))
+	assert.Equal(t, "1.0.0", caps.Version)
+	assert.Equal(t, "test tiles", caps.Title)
+	assert.Equal(t, srv.URL+"/wmts/1.0.0/WMTSCapabilities.xml", caps.Metadata.Href)
+	assert.Len(t, caps.Operations, 3)
+	assert.Equal(t, srv.URL+"/wmts?", caps.Operations[1].Get.Href)
+
+	assert.Len(t, caps.Layers, 2)
+	base := caps.Layers[0]
+	assert.Equal(t, "base", base.Identifier)
+	assert.Equal(t, []string{"image/png"}, base.Formats)
+	assert.Equal(t, []string{"application/json", "text/plain"}, base.InfoFormats)
+	assert.Equal(t, "GoogleMapsCompatible", base.Link)
+	assert.Len(t, base.Limits, 3)
+	assert.Equal(t, 3, base.Limits[2].MaxTileCol)
+	assert.Equal(t, srv.URL+"/wmts/1.0.0/base/{Style}/{TileMatrixSet}/{TileMatrix}/{TileRow}/{TileCol}.png", base.Resources[0].Template)
+	assert.Equal(t, "FeatureInfo", base.Resources[1].ResourceType)
+	assert.Empty(t, caps.Layers[1].InfoFormats)
+	assert.Equal(t, "-180 -90", caps.Layers[1].Lower)
+
+	assert.Len(t, caps.Sets, 2)
+	merc := caps.Sets[0]
+	assert.Equal(t, "urn:ogc:def:crs:EPSG::3857", merc.CRS)
+	assert.Equal(t, "urn:ogc:def:wkss:OGC:1.0:GoogleMapsCompatible", merc.ScaleSet)
+	assert.Len(t, merc.Matrices, 3)
+	assert.InDelta(t, 559082264.0287178, merc.Matrices[0].ScaleDenominator, 1e-6)
+	assert.InDelta(t, 139770566.00717944, merc.Matrices[2].ScaleDenominator, 1e-6)
+	assert.Equal(t, "-20037508.342789244 20037508.342789244", merc.Matrices[0].TopLeftCorner)
+
+	geo := caps.Sets[1]
+	assert.Equal(t, "WorldCRS84Quad", geo.Identifier)
+	assert.Equal(t, "urn:ogc:def:crs:EPSG::4326", geo.CRS)
+	assert.Equal(t, "90 -180", geo.Matrices[0].TopLeftCorner)
+	assert.InDelta(t, 279541132.0143589, geo.Matrices[0].ScaleDenominator, 1e-6)
+	assert.Equal(t, 2, geo.Matrices[0].MatrixWidth)
+	assert.Equal(t, 8, geo.Matrices[3].MatrixHeight)
+
+	resp, rest := get(t, srv.URL+"/wmts/1.0.0/WMTSCapabilities.xml")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, body, rest)
+}
+
+func TestGetTile(t *testing.T) {
+	srv := httptest.NewServer(http.StripPrefix("/wmts", newTestService(t)))
+	defer srv.Close()
+
+	resp, body := get(t, srv.URL+"/wmts?SERVICE=WMTS&REQUEST=GetTile&VERSION=1.0.0&LAYER=base&STYLE=default&TILEMATRIXSET=GoogleMapsCompatible&TILEMATRIX=2&TILEROW=2&TILECOL=3&FORMAT=image/png")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "png:2/3/2.png", string(body))
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	assert.NotEmpty(t, resp.Header.Get("ETag"))
+
+	resp, body = get(t, srv.URL+"/wmts/1.0.0/base/default/GoogleMapsCompatible/2/1/1.png")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "png:2/1/1.png", string(body))
+
+	resp, body = get(t, srv.URL+"/wmts/1.0.0/geo/default/WorldCRS84Quad/3/7/15.jpg")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "jpg:3/15/7", string(body))
+
+	// missing tile in range is a plain 404
+	resp, _ = get(t, srv.URL+"/wmts/1.0.0/base/default/GoogleMapsCompatible/2/0/0.png")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	tests := []struct {
+		url, code, locator string
+		status             int
+	}{
+		{"?SERVICE=WMTS&REQUEST=GetTile&LAYER=base", ows.MISSING_PARAMETER_VALUE, "STYLE", 400},
+		{"?SERVICE=WMS&REQUEST=GetTile", ows.INVALID_PARAMETER_VALUE, "SERVICE", 400},
+		{"?SERVICE=WMTS&REQUEST=GetLegend", ows.OPERATION_NOT_SUPPORTED, "REQUEST", 501},
+		{"/1.0.0/base/default/GoogleMapsCompatible/2/4/0.png", TILE_OUT_OF_RANGE, "TILEROW", 400},
+		{"/1.0.0/base/default/GoogleMapsCompatible/2/0/-1.png", TILE_OUT_OF_RANGE, "TILECOL", 400},
+		{"/1.0.0/base/default/GoogleMapsCompatible/5/0/0.png", ows.INVALID_PARAMETER_VALUE, "TILEMATRIX", 400},
+		{"/1.0.0/base/default/WorldCRS84Quad/1/0/0.png", ows.INVALID_PARAMETER_VALUE, "TILEMATRIXSET", 400},
+		{"/1.0.0/roads/default/GoogleMapsCompatible/1/0/0.png", ows.INVALID_PARAMETER_VALUE, "LAYER", 400},
+		{"/1.0.0/base/fancy/GoogleMapsCompatible/1/0/0.png", ows.INVALID_PARAMETER_VALUE, "STYLE", 400},
+		{"/1.0.0/base/default/GoogleMapsCompatible/1/0/0.jpg", ows.INVALID_PARAMETER_VALUE, "FORMAT", 400},
+	}
+	for _, tt := range tests {
+		resp, body := get(t, srv.URL+"/wmts"+tt.url)
+		assert.Equal(t, tt.status, resp.StatusCode, tt.url)
+		var rep struct {
+			Exceptions []struct {
+				Code    string `xml:"exceptionCode,attr"`
+				Locator string `xml:"locator,attr"`
+			} `xml:"http://www.opengis.net/ows/1.1 Exception"`
+		}
+		assert.Nil(t, xml.Unmarshal(body, &rep), tt.url)
+		if assert.Len(t, rep.Exceptions, 1, tt.url) {
+			assert.Equal(t, tt.code, rep.Exceptions[0].Code, tt.url)
+			assert.Equal(t, tt.locator, rep.Exceptions[0].Locator, tt.url)
+		}
+	}
+
+	// matrices below the layer are unknown like the ones above it
+	srv2 := httptest.NewServer(NewService("shallow", &Layer{Identifier: "geo", Source: &shallowSource{}}))
+	defer srv2.Close()
+	for z, status := range []int{400, 400, 200, 200, 400} {
+		resp, _ := get(t, fmt.Sprintf("%s/1.0.0/geo/default/WorldCRS84Quad/%d/0/0.jpg", srv2.URL, z))
+		assert.Equal(t, status, resp.StatusCode, z)
+	}
+}
+
+func TestGetFeatureInfo(t *testing.T) {
+	srv := httptest.NewServer(newTestService(t))
+	defer srv.Close()
+
+	resp, body := get(t, srv.URL+"/?SERVICE=WMTS&REQUEST=GetFeatureInfo&VERSION=1.0.0&LAYER=base&STYLE=default&TILEMATRIXSET=GoogleMapsCompatible&TILEMATRIX=2&TILEROW=1&TILECOL=1&FORMAT=image/png&INFOFORMAT=application/json&I=11&J=19")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var fc geojson.FeatureCollection
+	assert.Nil(t, json.Unmarshal(body, &fc))
+	if assert.Len(t, fc.Features, 1) {
+		assert.Equal(t, "pole-7", fc.Features[0].ID)
+	}
+
+	// outside the search radius
+	_, body = get(t, srv.URL+"/1.0.0/base/default/GoogleMapsCompatible/2/1/1/40/10.json")
+	assert.Nil(t, json.Unmarshal(body, &fc))
+	assert.Empty(t, fc.Features)
+
+	resp, body = get(t, srv.URL+"/1.0.0/base/default/GoogleMapsCompatible/2/1/1/20/10.txt")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Feature 0 (id pole-7):\n  height = 12.5\n", string(body))
+
+	resp, _ = get(t, srv.URL+"/1.0.0/geo/default/WorldCRS84Quad/1/0/0/20/10.json")
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	resp, _ = get(t, srv.URL+"/1.0.0/base/default/GoogleMapsCompatible/2/1/1/20/300.json")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = get(t, srv.URL+"/1.0.0/base/default/GoogleMapsCompatible/2/1/1/20/10.html")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}